@@ -0,0 +1,305 @@
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/pcap/ja3"
+)
+
+const (
+	// Connections to a destination whose intervals and sizes are scored.
+	DefaultBeaconWindow = 32
+
+	DefaultBeaconMaxDestinations = 10000
+
+	// Long enough to span the intervals of slow beacons.
+	DefaultBeaconIdleTimeout = 6 * time.Hour
+
+	// JA3 prevalence is only meaningful once this many TLS clients are seen.
+	beaconMinJA3Clients = 5
+)
+
+// Weights of the signals in the score of a BeaconDetector.
+const (
+	beaconPeriodicityWeight = 0.5
+	beaconSizeWeight        = 0.3
+	beaconJA3Weight         = 0.2
+)
+
+type BeaconOptions struct {
+	// Minimum number of connections to a destination before it is scored.
+	MinConnections int
+
+	// Intervals and sizes are scored over the latest Window connections.
+	Window int
+
+	// The most client and destination pairs, and the most connections
+	// awaiting their end, tracked at once. The least recently active are
+	// forgotten first. 0 for no limit.
+	MaxDestinations int
+
+	// Pairs and connections are forgotten once nothing has been seen of them
+	// for this long, in observation time. 0 for no limit.
+	IdleTimeout time.Duration
+
+	// Findings are emitted once their score reaches this threshold.
+	ScoreThreshold float64
+}
+
+func NewBeaconOptions() BeaconOptions {
+	return BeaconOptions{
+		MinConnections:  DefaultBeaconMinConnections,
+		Window:          DefaultBeaconWindow,
+		MaxDestinations: DefaultBeaconMaxDestinations,
+		IdleTimeout:     DefaultBeaconIdleTimeout,
+		ScoreThreshold:  DefaultScoreThreshold,
+	}
+}
+
+// BeaconDetector looks for hosts calling back to command-and-control servers.
+// It scores the TCP connections from each host to each destination, as they
+// end, on three signals: how regularly they start, how uniform the amount of
+// data they carry is, and how rare the JA3 fingerprint of their TLS client is
+// among all TLS clients seen. It needs the gnet.TCPConnectionMetadata of
+// connections, and their gnet.TLSClientHello for JA3.
+//
+// Each pair is reported at most once, when its score first reaches the
+// threshold. Safe for concurrent use.
+type BeaconDetector struct {
+	opts BeaconOptions
+
+	mu sync.Mutex
+
+	// By client and destination.
+	dests *lru[*beaconDest]
+
+	// Client hellos of connections that have not ended yet, by connection ID.
+	hellos *lru[gnet.TLSClientHello]
+
+	// The JA3 hashes of the TLS clients seen, by client address, and the
+	// number of those clients using each hash.
+	clients    *lru[map[string]struct{}]
+	ja3Clients map[string]int
+}
+
+type beaconDest struct {
+	// The starts of the latest connections in order, and their bytes in the
+	// order the connections ended.
+	starts []time.Time
+	sizes  []float64
+
+	ja3, serverName string
+	reported        bool
+}
+
+func NewBeaconDetector(opts BeaconOptions) *BeaconDetector {
+	if opts.Window < 2 {
+		opts.Window = 2
+	}
+	d := &BeaconDetector{
+		opts:       opts,
+		dests:      newLRU[*beaconDest](opts.MaxDestinations, opts.IdleTimeout),
+		hellos:     newLRU[gnet.TLSClientHello](opts.MaxDestinations, opts.IdleTimeout),
+		clients:    newLRU[map[string]struct{}](opts.MaxDestinations, opts.IdleTimeout),
+		ja3Clients: map[string]int{},
+	}
+	d.clients.forget = d.forgetClient
+	return d
+}
+
+// Stops counting a forgotten client among the users of its JA3 hashes.
+func (d *BeaconDetector) forgetClient(_ string, hashes map[string]struct{}) {
+	for hash := range hashes {
+		if d.ja3Clients[hash]--; d.ja3Clients[hash] <= 0 {
+			delete(d.ja3Clients, hash)
+		}
+	}
+}
+
+// Run passes through all traffic from in, interleaving a NetTraffic carrying a
+// gnet.BeaconSuspicion after the connection that raised it. The returned
+// channel is closed once in is closed.
+func (d *BeaconDetector) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			s, found := d.Observe(t)
+			out <- t
+			if found {
+				out <- gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           s.SrcIP,
+					DstIP:           s.DstIP,
+					DstPort:         s.DstPort,
+					Content:         s,
+					ConnectionID:    t.ConnectionID,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: t.FinalPacketTime,
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Observe updates the detector's state with t and returns the suspicion that
+// t caused to cross the score threshold, if any.
+func (d *BeaconDetector) Observe(t gnet.NetTraffic) (gnet.BeaconSuspicion, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.dests.expire(t.ObservationTime)
+	d.hellos.expire(t.ObservationTime)
+	d.clients.expire(t.ObservationTime)
+
+	switch c := t.Content.(type) {
+	case gnet.TLSClientHello:
+		d.hellos.put(t.ConnectionID.String(), c, t.ObservationTime)
+	case gnet.TCPConnectionMetadata:
+		hello, tls := d.hellos.remove(t.ConnectionID.String())
+		return d.observeConnection(t, c, hello, tls)
+	}
+	return gnet.BeaconSuspicion{}, false
+}
+
+func (d *BeaconDetector) observeConnection(t gnet.NetTraffic, m gnet.TCPConnectionMetadata, hello gnet.TLSClientHello, tls bool) (gnet.BeaconSuspicion, bool) {
+	client, server, port := t.SrcIP, t.DstIP, t.DstPort
+	if m.Initiator == gnet.DestInitiator {
+		client, server, port = t.DstIP, t.SrcIP, t.SrcPort
+	}
+
+	key := fmt.Sprintf("%s>%s:%d", client, server, port)
+	dest, ok := d.dests.get(key, t.ObservationTime)
+	if !ok {
+		dest = &beaconDest{}
+		d.dests.put(key, dest, t.ObservationTime)
+	}
+	if tls {
+		_, hash := ja3.GetJa3Hash(hello)
+		dest.ja3, dest.serverName = hash, hello.ServerName
+		hashes, ok := d.clients.get(client.String(), t.ObservationTime)
+		if !ok {
+			hashes = map[string]struct{}{}
+			d.clients.put(client.String(), hashes, t.ObservationTime)
+		}
+		if _, ok := hashes[hash]; !ok {
+			hashes[hash] = struct{}{}
+			d.ja3Clients[hash]++
+		}
+	}
+
+	// Connections are seen as they end, which is not the order they start in
+	// if they overlap.
+	dest.starts = insertWindow(dest.starts, t.ObservationTime, d.opts.Window)
+	dest.sizes = appendWindow(dest.sizes, float64(m.SourceToDest.Bytes+m.DestToSource.Bytes), d.opts.Window)
+
+	if dest.reported || len(dest.sizes) < d.opts.MinConnections || len(dest.starts) < 2 {
+		return gnet.BeaconSuspicion{}, false
+	}
+	s := d.score(dest, client, server, port)
+	if s.Score < d.opts.ScoreThreshold {
+		return gnet.BeaconSuspicion{}, false
+	}
+	dest.reported = true
+	return s, true
+}
+
+func (d *BeaconDetector) score(dest *beaconDest, client, server net.IP, port int) gnet.BeaconSuspicion {
+	s := gnet.BeaconSuspicion{
+		SrcIP:       client,
+		DstIP:       server,
+		DstPort:     port,
+		ServerName:  dest.serverName,
+		Connections: len(dest.sizes),
+		JA3:         dest.ja3,
+	}
+
+	interval, intervalCV := meanCV(intervals(dest.starts))
+	s.Interval = time.Duration(interval * float64(time.Second))
+	s.IntervalJitter = intervalCV
+	periodicity := math.Max(0, 1-intervalCV)
+	if interval == 0 {
+		periodicity = 0
+	} else if intervalCV < 0.2 {
+		s.Reasons = append(s.Reasons, fmt.Sprintf("%d connections every %.1fs (jitter %.1f%%)", s.Connections, interval, intervalCV*100))
+	}
+
+	size, sizeCV := meanCV(dest.sizes)
+	s.MeanBytes = int64(size)
+	s.SizeJitter = sizeCV
+	uniformity := math.Max(0, 1-sizeCV)
+	if sizeCV < 0.2 {
+		s.Reasons = append(s.Reasons, fmt.Sprintf("%.0f bytes per connection (jitter %.1f%%)", size, sizeCV*100))
+	}
+
+	total := periodicity*beaconPeriodicityWeight + uniformity*beaconSizeWeight
+	weights := beaconPeriodicityWeight + beaconSizeWeight
+	if dest.ja3 != "" && d.clients.len() >= beaconMinJA3Clients {
+		s.JA3Prevalence = float64(d.ja3Clients[dest.ja3]) / float64(d.clients.len())
+		total += (1 - s.JA3Prevalence) * beaconJA3Weight
+		weights += beaconJA3Weight
+		if s.JA3Prevalence <= 0.1 {
+			s.Reasons = append(s.Reasons, fmt.Sprintf("JA3 %s used by %.0f%% of TLS clients", dest.ja3, s.JA3Prevalence*100))
+		}
+	}
+	s.Score = total / weights
+	return s
+}
+
+// Appends x to xs, keeping the latest n values.
+func appendWindow(xs []float64, x float64, n int) []float64 {
+	xs = append(xs, x)
+	if len(xs) > n {
+		xs = xs[len(xs)-n:]
+	}
+	return xs
+}
+
+// Inserts t into the sorted ts, keeping the latest n values.
+func insertWindow(ts []time.Time, t time.Time, n int) []time.Time {
+	i := sort.Search(len(ts), func(i int) bool { return ts[i].After(t) })
+	ts = append(ts, time.Time{})
+	copy(ts[i+1:], ts[i:])
+	ts[i] = t
+	if len(ts) > n {
+		ts = ts[len(ts)-n:]
+	}
+	return ts
+}
+
+// Returns the seconds between consecutive times of the sorted ts.
+func intervals(ts []time.Time) []float64 {
+	var xs []float64
+	for i := 1; i < len(ts); i++ {
+		xs = append(xs, ts[i].Sub(ts[i-1]).Seconds())
+	}
+	return xs
+}
+
+// Returns the mean of xs and their coefficient of variation, which is 0 if
+// the mean is.
+func meanCV(xs []float64) (mean, cv float64) {
+	mean, stddev := meanStddev(xs)
+	if mean == 0 {
+		return 0, 0
+	}
+	return mean, stddev / mean
+}
+
+func meanStddev(xs []float64) (mean, stddev float64) {
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	for _, x := range xs {
+		stddev += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(xs)))
+}
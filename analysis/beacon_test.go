@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestBeaconDetector(t *testing.T) {
+	d := NewBeaconDetector(NewBeaconOptions())
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Ends a connection from client to server:443 started at, carrying bytes,
+	// with a client hello of the given cipher suites, if any.
+	connect := func(client net.IP, server net.IP, at time.Duration, bytes int64, ciphers ...uint16) (gnet.BeaconSuspicion, bool) {
+		conn := uuid.New()
+		if len(ciphers) > 0 {
+			d.Observe(gnet.NetTraffic{
+				ConnectionID: conn,
+				Content:      gnet.TLSClientHello{Version: 0x0303, CipherSuites: ciphers, ServerName: "c2.example.com"},
+			})
+		}
+		return d.Observe(gnet.NetTraffic{
+			SrcIP: client, SrcPort: 40000, DstIP: server, DstPort: 443,
+			ConnectionID:    conn,
+			ObservationTime: start.Add(at),
+			Content: gnet.TCPConnectionMetadata{
+				Initiator:    gnet.SourceInitiator,
+				SourceToDest: gnet.TCPDirectionStats{Bytes: bytes / 2},
+				DestToSource: gnet.TCPDirectionStats{Bytes: bytes - bytes/2},
+			},
+		})
+	}
+
+	// Common TLS clients browsing.
+	for i := 0; i < 9; i++ {
+		browser := net.IPv4(10, 0, 1, byte(i))
+		for j := 0; j < 8; j++ {
+			_, found := connect(browser, net.IPv4(192, 0, 2, byte(j)), time.Duration(i*j*j)*time.Second, int64(1000*(j+1)), 0x1301, 0x1302)
+			assert.False(t, found)
+		}
+	}
+
+	jitter := []time.Duration{0, 300, -200, 100, -400, 250, 0, -100}
+	var s gnet.BeaconSuspicion
+	var found bool
+	for i := 0; i < DefaultBeaconMinConnections && !found; i++ {
+		s, found = connect(clientIP, serverIP, time.Duration(i)*time.Minute+jitter[i]*time.Millisecond, 2048, 0xc02f)
+	}
+	if assert.True(t, found) {
+		assert.True(t, s.SrcIP.Equal(clientIP))
+		assert.True(t, s.DstIP.Equal(serverIP))
+		assert.Equal(t, 443, s.DstPort)
+		assert.Equal(t, "c2.example.com", s.ServerName)
+		assert.Equal(t, DefaultBeaconMinConnections, s.Connections)
+		assert.InDelta(t, float64(time.Minute), float64(s.Interval), float64(time.Second))
+		assert.Equal(t, int64(2048), s.MeanBytes)
+		assert.Equal(t, 0.1, s.JA3Prevalence)
+		assert.Greater(t, s.Score, 0.9)
+		assert.Len(t, s.Reasons, 3)
+	}
+
+	// Reported once.
+	_, found = connect(clientIP, serverIP, 10*time.Minute, 2048, 0xc02f)
+	assert.False(t, found)
+}
+
+func TestBeaconDetectorIrregular(t *testing.T) {
+	d := NewBeaconDetector(NewBeaconOptions())
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	at := time.Duration(0)
+	for i := 0; i < 20; i++ {
+		at += time.Duration(1+(i*7)%13) * time.Minute
+		// Oriented like the server's first packet.
+		_, found := d.Observe(gnet.NetTraffic{
+			SrcIP: serverIP, SrcPort: 80, DstIP: clientIP, DstPort: 40000 + i,
+			ObservationTime: start.Add(at),
+			Content: gnet.TCPConnectionMetadata{
+				Initiator:    gnet.DestInitiator,
+				DestToSource: gnet.TCPDirectionStats{Bytes: int64(100 + (i*3001)%50000)},
+			},
+		})
+		assert.False(t, found)
+	}
+	assert.Equal(t, 1, d.dests.len())
+	_, ok := d.dests.get("10.0.0.1>10.0.0.2:80", time.Time{})
+	assert.True(t, ok)
+}
+
+func TestBeaconDetectorForgetsHellos(t *testing.T) {
+	opts := NewBeaconOptions()
+	opts.MaxDestinations = 2
+	opts.IdleTimeout = time.Hour
+	d := NewBeaconDetector(opts)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Connections that never end.
+	for i := 0; i < 3; i++ {
+		d.Observe(gnet.NetTraffic{
+			ConnectionID:    uuid.New(),
+			ObservationTime: start.Add(time.Duration(i) * time.Minute),
+			Content:         gnet.TLSClientHello{Version: 0x0303},
+		})
+	}
+	assert.Equal(t, 2, d.hellos.len())
+
+	d.Observe(gnet.NetTraffic{ObservationTime: start.Add(2 * time.Hour)})
+	assert.Equal(t, 0, d.hellos.len())
+}
+
+func TestBeaconDetectorOverlappingConnections(t *testing.T) {
+	d := NewBeaconDetector(NewBeaconOptions())
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Connections start every minute and alternately last 150s and 10s, so
+	// each odd one ends before the even one started a minute earlier.
+	type conn struct{ start, end time.Duration }
+	var conns []conn
+	for i := 0; i < DefaultBeaconMinConnections; i++ {
+		c := conn{start: time.Duration(i) * time.Minute}
+		if i%2 == 0 {
+			c.end = c.start + 150*time.Second
+		} else {
+			c.end = c.start + 10*time.Second
+		}
+		conns = append(conns, c)
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].end < conns[j].end })
+
+	var s gnet.BeaconSuspicion
+	var found bool
+	for _, c := range conns {
+		if found {
+			break
+		}
+		s, found = d.Observe(gnet.NetTraffic{
+			SrcIP: clientIP, SrcPort: 40000, DstIP: serverIP, DstPort: 443,
+			ObservationTime: start.Add(c.start),
+			Content: gnet.TCPConnectionMetadata{
+				Initiator:    gnet.SourceInitiator,
+				SourceToDest: gnet.TCPDirectionStats{Bytes: 1024},
+			},
+		})
+	}
+	if assert.True(t, found) {
+		assert.Equal(t, time.Minute, s.Interval)
+		assert.Equal(t, 0.0, s.IntervalJitter)
+	}
+}
+
+func TestBeaconDetectorForgetsClients(t *testing.T) {
+	opts := NewBeaconOptions()
+	opts.MaxDestinations = 2
+	opts.IdleTimeout = time.Hour
+	d := NewBeaconDetector(opts)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		conn := uuid.New()
+		d.Observe(gnet.NetTraffic{
+			ConnectionID: conn,
+			Content:      gnet.TLSClientHello{Version: 0x0303, CipherSuites: []uint16{0x1301}},
+		})
+		d.Observe(gnet.NetTraffic{
+			SrcIP: net.IPv4(10, 0, 1, byte(i)), SrcPort: 40000, DstIP: serverIP, DstPort: 443,
+			ConnectionID:    conn,
+			ObservationTime: start.Add(time.Duration(i) * time.Minute),
+			Content:         gnet.TCPConnectionMetadata{Initiator: gnet.SourceInitiator},
+		})
+	}
+	assert.Equal(t, 2, d.clients.len())
+	if assert.Len(t, d.ja3Clients, 1) {
+		for _, n := range d.ja3Clients {
+			assert.Equal(t, 2, n)
+		}
+	}
+
+	d.Observe(gnet.NetTraffic{ObservationTime: start.Add(2 * time.Hour)})
+	assert.Equal(t, 0, d.clients.len())
+	assert.Empty(t, d.ja3Clients)
+}
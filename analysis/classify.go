@@ -0,0 +1,237 @@
+package analysis
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Confidence given to each kind of evidence used by ClassifyPayload.
+const (
+	magicConfidence     = 0.9
+	bannerConfidence    = 0.6
+	portConfidence      = 0.4
+	printableConfidence = 0.3
+)
+
+// Fraction of printable bytes above which data is considered text, and below
+// which it is considered binary.
+const (
+	textThreshold   = 0.9
+	binaryThreshold = 0.3
+)
+
+// A recognizable prefix of a protocol's first message in either direction.
+type protocolMagic struct {
+	protocol   string
+	prefix     []byte
+	confidence float64
+}
+
+var protocolMagics = []protocolMagic{
+	{"SSH", []byte("SSH-"), magicConfidence},
+	{"HTTP/2", []byte("PRI * HTTP/2.0"), magicConfidence},
+	{"HTTP", []byte("HTTP/1."), magicConfidence},
+	{"BitTorrent", []byte("\x13BitTorrent protocol"), magicConfidence},
+	{"VNC", []byte("RFB 0"), magicConfidence},
+	{"AMQP", []byte("AMQP"), magicConfidence},
+	{"IMAP", []byte("* OK"), bannerConfidence},
+	{"POP3", []byte("+OK"), bannerConfidence},
+	{"SMTP", []byte("EHLO "), bannerConfidence},
+	{"SMTP", []byte("HELO "), bannerConfidence},
+}
+
+// Well-known server ports, used when the data itself is not recognized.
+var protocolPorts = map[int]string{
+	21:    "FTP",
+	22:    "SSH",
+	23:    "Telnet",
+	25:    "SMTP",
+	53:    "DNS",
+	80:    "HTTP",
+	110:   "POP3",
+	143:   "IMAP",
+	389:   "LDAP",
+	443:   "TLS",
+	445:   "SMB",
+	465:   "TLS",
+	587:   "SMTP",
+	636:   "TLS",
+	993:   "TLS",
+	995:   "TLS",
+	1433:  "MSSQL",
+	1883:  "MQTT",
+	3306:  "MySQL",
+	3389:  "RDP",
+	5060:  "SIP",
+	5432:  "PostgreSQL",
+	5672:  "AMQP",
+	5900:  "VNC",
+	6379:  "Redis",
+	8080:  "HTTP",
+	9092:  "Kafka",
+	11211: "Memcached",
+	27017: "MongoDB",
+}
+
+// ClassifyPayload guesses the protocol of data that no parser accepted, from
+// magic bytes at its start, then the ports, then the fraction of printable
+// bytes. The payload should be the start of the data in one direction of a
+// connection, since that is where protocols are most recognizable.
+func ClassifyPayload(payload []byte, srcPort, dstPort int) (protocol string, confidence float64, reason string) {
+	if protocol, confidence := classifyMagic(payload); protocol != "" {
+		return protocol, confidence, "magic bytes"
+	}
+
+	for _, port := range []int{dstPort, srcPort} {
+		if protocol, ok := protocolPorts[port]; ok {
+			return protocol, portConfidence, fmt.Sprintf("port %d", port)
+		}
+	}
+
+	if len(payload) == 0 {
+		return "", 0, ""
+	}
+	ratio := printableRatio(payload)
+	switch {
+	case ratio >= textThreshold:
+		return "text", printableConfidence, fmt.Sprintf("%.0f%% printable", ratio*100)
+	case ratio <= binaryThreshold:
+		return "binary", printableConfidence, fmt.Sprintf("%.0f%% printable", ratio*100)
+	}
+	return "", 0, ""
+}
+
+func classifyMagic(p []byte) (string, float64) {
+	for _, m := range protocolMagics {
+		if bytes.HasPrefix(p, m.prefix) {
+			return m.protocol, m.confidence
+		}
+	}
+
+	switch {
+	case len(p) >= 3 && (p[0] == 0x16 || p[0] == 0x17 || p[0] == 0x15) && p[1] == 0x03 && p[2] <= 0x04:
+		// A TLS handshake, application data or alert record header.
+		return "TLS", magicConfidence
+
+	case len(p) >= 8 && p[0] == 0x00 && (bytes.Equal(p[4:8], []byte("\xffSMB")) || bytes.Equal(p[4:8], []byte("\xfeSMB"))):
+		return "SMB", magicConfidence
+
+	case len(p) >= 8 && bytes.Equal(p[4:8], []byte{0x00, 0x03, 0x00, 0x00}):
+		// A PostgreSQL StartupMessage for protocol 3.0.
+		return "PostgreSQL", magicConfidence
+
+	case len(p) >= 5 && p[3] == 0x00 && p[4] == 0x0a && int(p[0])|int(p[1])<<8|int(p[2])<<16 == len(p)-4:
+		// A MySQL server greeting: a packet with sequence number 0 and
+		// protocol version 10.
+		return "MySQL", bannerConfidence
+
+	case len(p) >= 4 && p[0] == 0x03 && p[1] == 0x00 && int(p[2])<<8|int(p[3]) == len(p):
+		// A TPKT header, as used by RDP.
+		return "RDP", bannerConfidence
+
+	case len(p) >= 10 && p[0] == 0x10 && bytes.Contains(p[2:10], []byte("MQTT")):
+		return "MQTT", magicConfidence
+
+	case len(p) >= 4 && p[0] == '*' && p[1] >= '1' && p[1] <= '9' && bytes.Contains(p, []byte("\r\n$")):
+		// A Redis command array.
+		return "Redis", bannerConfidence
+
+	case len(p) >= 4 && bytes.HasPrefix(p, []byte("220")) && (p[3] == ' ' || p[3] == '-'):
+		// A greeting shared by FTP and SMTP.
+		if bytes.Contains(p, []byte("SMTP")) {
+			return "SMTP", bannerConfidence
+		}
+		if bytes.Contains(p, []byte("FTP")) {
+			return "FTP", bannerConfidence
+		}
+	}
+	return "", 0
+}
+
+// Returns the fraction of bytes in p that are printable ASCII or whitespace.
+func printableRatio(p []byte) float64 {
+	printable := 0
+	for _, b := range p {
+		if (b >= 0x20 && b < 0x7f) || b == '\r' || b == '\n' || b == '\t' {
+			printable++
+		}
+	}
+	return float64(printable) / float64(len(p))
+}
+
+// ProtocolClassifier replaces the DroppedBytes that result when no parser
+// accepts some data with UnknownTraffic labelled by ClassifyPayload.
+//
+// Each direction of a connection is classified from its first unparsed data
+// that gives a guess, and later data in that direction reuses the guess.
+// Place it after any stage that consumes DroppedBytes, such as
+// gnet.FTPTracker. Safe for concurrent use.
+type ProtocolClassifier struct {
+	mu sync.Mutex
+
+	// Guesses by connection and source endpoint.
+	guesses map[string]gnet.UnknownTraffic
+}
+
+func NewProtocolClassifier() *ProtocolClassifier {
+	return &ProtocolClassifier{
+		guesses: map[string]gnet.UnknownTraffic{},
+	}
+}
+
+// Run passes through all traffic from in, with DroppedBytes replaced by
+// UnknownTraffic. The returned channel is closed once in is closed.
+func (c *ProtocolClassifier) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			out <- c.Observe(t)
+		}
+	}()
+	return out
+}
+
+// Observe returns t, with its content replaced by UnknownTraffic if it is
+// DroppedBytes.
+func (c *ProtocolClassifier) Observe(t gnet.NetTraffic) gnet.NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch content := t.Content.(type) {
+	case gnet.DroppedBytes:
+		key := flowKey(t.ConnectionID, t.SrcIP, t.SrcPort)
+		guess, ok := c.guesses[key]
+		if !ok {
+			guess.ProbableProtocol, guess.Confidence, guess.Reason = ClassifyPayload(t.Payload, t.SrcPort, t.DstPort)
+			if guess.ProbableProtocol != "" {
+				c.guesses[key] = guess
+			}
+		}
+		guess.ConnectionID = t.ConnectionID
+		guess.Length = int64(content)
+		t.Content = guess
+
+	case gnet.TCPPacketMetadata:
+		// No more data follows in the direction that was closed, or in either
+		// direction after a reset.
+		if content.FIN || content.RST {
+			delete(c.guesses, flowKey(t.ConnectionID, t.SrcIP, t.SrcPort))
+		}
+		if content.RST {
+			delete(c.guesses, flowKey(t.ConnectionID, t.DstIP, t.DstPort))
+		}
+	}
+	return t
+}
+
+// Identifies one direction of a connection by its source.
+func flowKey(id uuid.UUID, ip net.IP, port int) string {
+	return fmt.Sprintf("%s/%s/%d", id, ip, port)
+}
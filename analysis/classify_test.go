@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestClassifyPayload(t *testing.T) {
+	tests := []struct {
+		payload  []byte
+		srcPort  int
+		dstPort  int
+		protocol string
+		reason   string
+	}{
+		{[]byte("SSH-2.0-OpenSSH_9.0\r\n"), 50000, 2222, "SSH", "magic bytes"},
+		{[]byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}, 50000, 8443, "TLS", "magic bytes"},
+		{[]byte{0x00, 0x00, 0x00, 0x08, 0x00, 0x03, 0x00, 0x00}, 50000, 6000, "PostgreSQL", "magic bytes"},
+		{[]byte{0x05, 0x00, 0x00, 0x00, 0x0a, '8', '.', '0', 0x00}, 3307, 50000, "MySQL", "magic bytes"},
+		{[]byte("*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"), 50000, 7000, "Redis", "magic bytes"},
+		{[]byte("220 mail.example.com ESMTP Postfix\r\n"), 2525, 50000, "SMTP", "magic bytes"},
+		{[]byte{0x01, 0x02, 0x03}, 50000, 3306, "MySQL", "port 3306"},
+		{[]byte("hello there, how are you?\n"), 50000, 50001, "text", "100% printable"},
+		{[]byte{0x01, 0x02, 0x03, 0xf0}, 50000, 50001, "binary", "0% printable"},
+		{nil, 50000, 50001, "", ""},
+	}
+	for _, tc := range tests {
+		protocol, _, reason := ClassifyPayload(tc.payload, tc.srcPort, tc.dstPort)
+		assert.Equal(t, tc.protocol, protocol, "%q", tc.payload)
+		assert.Equal(t, tc.reason, reason, "%q", tc.payload)
+	}
+}
+
+func TestProtocolClassifier(t *testing.T) {
+	c := NewProtocolClassifier()
+	conn := uuid.New()
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+
+	dropped := func(payload string) gnet.NetTraffic {
+		return gnet.NetTraffic{
+			SrcIP: client, SrcPort: 50000, DstIP: server, DstPort: 2222,
+			ConnectionID: conn,
+			Content:      gnet.DroppedBytes(len(payload)),
+			Payload:      []byte(payload),
+		}
+	}
+
+	r := c.Observe(dropped("SSH-2.0-client\r\n"))
+	assert.Equal(t, gnet.UnknownTraffic{
+		ConnectionID:     conn,
+		Length:           16,
+		ProbableProtocol: "SSH",
+		Confidence:       magicConfidence,
+		Reason:           "magic bytes",
+	}, r.Content)
+
+	// Later data in the same direction keeps the guess.
+	r = c.Observe(dropped("\x00\x00\x01\x2c\x0a\x14"))
+	assert.Equal(t, "SSH", r.Content.(gnet.UnknownTraffic).ProbableProtocol)
+	assert.Equal(t, int64(6), r.Content.(gnet.UnknownTraffic).Length)
+
+	// Other content is untouched.
+	r = c.Observe(gnet.NetTraffic{Content: gnet.TCPPacketMetadata{SYN: true}})
+	assert.Equal(t, gnet.TCPPacketMetadata{SYN: true}, r.Content)
+}
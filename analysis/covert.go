@@ -0,0 +1,388 @@
+// Package analysis contains heuristics that run over a stream of parsed
+// NetTraffic to flag activity that no single message reveals on its own.
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	DefaultICMPMinPackets       = 10
+	DefaultICMPLargePayload     = 128
+	DefaultICMPRateThreshold    = 5.0
+	DefaultDNSMinQueries        = 20
+	DefaultDNSLongLabel         = 40
+	DefaultDNSEntropyThreshold  = 3.5
+	DefaultBeaconMinConnections = 6
+	DefaultScoreThreshold       = 0.5
+	DefaultCovertMaxTracked     = 10000
+
+	// Long enough to span the intervals of slow beacons.
+	DefaultCovertIdleTimeout = 6 * time.Hour
+)
+
+type CovertChannelOptions struct {
+	// Minimum number of echo messages between two hosts before they are scored.
+	ICMPMinPackets int
+
+	// Average echo payload size, in bytes, above which traffic is considered
+	// unusually large. Most ping implementations send 32 to 64 bytes.
+	ICMPLargePayload int
+
+	// Echo messages per second above which traffic is considered unusually
+	// frequent.
+	ICMPRateThreshold float64
+
+	// Minimum number of distinct names queried under one domain before the
+	// domain is scored.
+	DNSMinQueries int
+
+	// Average length of the leftmost label above which names are considered
+	// unusually long.
+	DNSLongLabel int
+
+	// Shannon entropy, in bits per character, above which labels are considered
+	// to carry encoded data.
+	DNSEntropyThreshold float64
+
+	// Minimum number of connections to the same destination before the
+	// intervals between them are scored.
+	BeaconMinConnections int
+
+	// Findings are emitted once their score reaches this threshold.
+	ScoreThreshold float64
+
+	// The most host pairs, domains and destinations tracked at once, each.
+	// The least recently active are forgotten first. 0 for no limit.
+	MaxTracked int
+
+	// Host pairs, domains and destinations are forgotten once nothing has been
+	// seen of them for this long, in observation time. 0 for no limit.
+	IdleTimeout time.Duration
+}
+
+func NewCovertChannelOptions() CovertChannelOptions {
+	return CovertChannelOptions{
+		ICMPMinPackets:       DefaultICMPMinPackets,
+		ICMPLargePayload:     DefaultICMPLargePayload,
+		ICMPRateThreshold:    DefaultICMPRateThreshold,
+		DNSMinQueries:        DefaultDNSMinQueries,
+		DNSLongLabel:         DefaultDNSLongLabel,
+		DNSEntropyThreshold:  DefaultDNSEntropyThreshold,
+		BeaconMinConnections: DefaultBeaconMinConnections,
+		ScoreThreshold:       DefaultScoreThreshold,
+		MaxTracked:           DefaultCovertMaxTracked,
+		IdleTimeout:          DefaultCovertIdleTimeout,
+	}
+}
+
+// CovertChannelDetector looks for ICMP tunnels, DNS tunnels and beaconing in
+// a stream of NetTraffic. Beaconing is scored by a BeaconDetector, and
+// reported as a gnet.ThreatAnnotation like the rest. Each suspicious host
+// pair, domain or destination is reported at most once, when its score first
+// reaches the threshold.
+//
+// Safe for concurrent use.
+type CovertChannelDetector struct {
+	opts CovertChannelOptions
+
+	mu      sync.Mutex
+	icmp    *lru[*icmpStats]
+	dns     *lru[*dnsStats]
+	beacons *BeaconDetector
+}
+
+func NewCovertChannelDetector(opts CovertChannelOptions) *CovertChannelDetector {
+	return &CovertChannelDetector{
+		opts: opts,
+		icmp: newLRU[*icmpStats](opts.MaxTracked, opts.IdleTimeout),
+		dns:  newLRU[*dnsStats](opts.MaxTracked, opts.IdleTimeout),
+		beacons: NewBeaconDetector(BeaconOptions{
+			MinConnections:  opts.BeaconMinConnections,
+			Window:          DefaultBeaconWindow,
+			MaxDestinations: opts.MaxTracked,
+			IdleTimeout:     opts.IdleTimeout,
+			ScoreThreshold:  opts.ScoreThreshold,
+		}),
+	}
+}
+
+// Run passes through all traffic from in, interleaving a NetTraffic carrying a
+// gnet.ThreatAnnotation after the traffic that triggered it. The returned
+// channel is closed once in is closed.
+func (d *CovertChannelDetector) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			annotations := d.Observe(t)
+			out <- t
+			for _, a := range annotations {
+				out <- gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           a.SrcIP,
+					DstIP:           a.DstIP,
+					DstPort:         a.DstPort,
+					Content:         a,
+					ConnectionID:    t.ConnectionID,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: t.ObservationTime,
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Observe updates the detector's state with t and returns any findings that
+// t caused to cross the score threshold.
+func (d *CovertChannelDetector) Observe(t gnet.NetTraffic) []gnet.ThreatAnnotation {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.icmp.expire(t.ObservationTime)
+	d.dns.expire(t.ObservationTime)
+
+	switch c := t.Content.(type) {
+	case gnet.ICMPv4:
+		switch c.TypeCode.Type() {
+		case layers.ICMPv4TypeEchoRequest:
+			return d.observeICMP(t, true)
+		case layers.ICMPv4TypeEchoReply:
+			return d.observeICMP(t, false)
+		}
+	case gnet.DNSRequest:
+		// Link-local name resolution never leaves the network, so it can't be
+		// used to tunnel data out.
+		if !c.QR && (c.Protocol == "" || c.Protocol == gnet.DNSProtocol) {
+			return d.observeDNS(t, c)
+		}
+	case gnet.TLSClientHello, gnet.TCPConnectionMetadata:
+		if s, found := d.beacons.Observe(t); found {
+			return []gnet.ThreatAnnotation{{
+				Kind:    gnet.BeaconThreat,
+				Score:   s.Score,
+				Reasons: s.Reasons,
+				SrcIP:   s.SrcIP,
+				DstIP:   s.DstIP,
+				DstPort: s.DstPort,
+			}}
+		}
+	case gnet.ICMPv6:
+		switch c.TypeCode.Type() {
+		case layers.ICMPv6TypeEchoRequest:
+			return d.observeICMP(t, true)
+		case layers.ICMPv6TypeEchoReply:
+			return d.observeICMP(t, false)
+		}
+	}
+	return nil
+}
+
+type icmpStats struct {
+	// The host that sent the first echo request.
+	client, server net.IP
+
+	requests, replies        int
+	requestBytes, replyBytes int
+	first, last              time.Time
+	reported                 bool
+}
+
+// Echo header: type, code, checksum, identifier, sequence number.
+const icmpEchoHeaderLength = 8
+
+func (d *CovertChannelDetector) observeICMP(t gnet.NetTraffic, isRequest bool) []gnet.ThreatAnnotation {
+	client, server := t.SrcIP, t.DstIP
+	if !isRequest {
+		client, server = server, client
+	}
+	key := client.String() + ">" + server.String()
+
+	s, ok := d.icmp.get(key, t.ObservationTime)
+	if !ok {
+		s = &icmpStats{client: client, server: server, first: t.ObservationTime}
+		d.icmp.put(key, s, t.ObservationTime)
+	}
+	s.last = t.ObservationTime
+
+	payload := len(t.Payload) - icmpEchoHeaderLength
+	if payload < 0 {
+		payload = 0
+	}
+	if isRequest {
+		s.requests++
+		s.requestBytes += payload
+	} else {
+		s.replies++
+		s.replyBytes += payload
+	}
+
+	if s.reported || s.requests+s.replies < d.opts.ICMPMinPackets {
+		return nil
+	}
+
+	var score float64
+	var reasons []string
+
+	avg := float64(s.requestBytes+s.replyBytes) / float64(s.requests+s.replies)
+	if avg > float64(d.opts.ICMPLargePayload) {
+		score += 0.4
+		reasons = append(reasons, fmt.Sprintf("average echo payload of %.0f bytes", avg))
+	}
+
+	if elapsed := s.last.Sub(s.first).Seconds(); elapsed > 0 {
+		if rate := float64(s.requests+s.replies) / elapsed; rate > d.opts.ICMPRateThreshold {
+			score += 0.3
+			reasons = append(reasons, fmt.Sprintf("%.1f echo messages per second", rate))
+		}
+	}
+
+	// Echo replies mirror the request payload, so the two directions should
+	// carry about the same number of bytes. Tunnels use replies as a return
+	// channel with different content.
+	if ratio := asymmetry(s.requestBytes, s.replyBytes); ratio > 2 {
+		score += 0.3
+		reasons = append(reasons, fmt.Sprintf("request/reply bytes differ by a factor of %.1f", ratio))
+	}
+
+	if score < d.opts.ScoreThreshold {
+		return nil
+	}
+	s.reported = true
+	return []gnet.ThreatAnnotation{{
+		Kind:    gnet.ICMPTunnelThreat,
+		Score:   math.Min(score, 1),
+		Reasons: reasons,
+		SrcIP:   s.client,
+		DstIP:   s.server,
+	}}
+}
+
+// Returns how many times larger the bigger of a and b is than the smaller.
+func asymmetry(a, b int) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	if b == 0 {
+		if a == 0 {
+			return 1
+		}
+		return math.Inf(1)
+	}
+	return float64(a) / float64(b)
+}
+
+type dnsStats struct {
+	client   net.IP
+	resolver net.IP
+
+	names        map[string]struct{}
+	labelLength  int
+	entropy      float64
+	unusualTypes int
+	reported     bool
+}
+
+// The most distinct names kept per domain. Names beyond them are not scored.
+const maxDNSNames = 1000
+
+func (d *CovertChannelDetector) observeDNS(t gnet.NetTraffic, req gnet.DNSRequest) []gnet.ThreatAnnotation {
+	var results []gnet.ThreatAnnotation
+	for _, q := range req.Questions {
+		name := strings.TrimSuffix(strings.ToLower(string(q.Name)), ".")
+		domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+		if err != nil || domain == name {
+			// Nothing below the registered domain to carry data.
+			continue
+		}
+		labels := strings.Split(name, ".")
+
+		s, ok := d.dns.get(domain, t.ObservationTime)
+		if !ok {
+			s = &dnsStats{
+				client:   t.SrcIP,
+				resolver: t.DstIP,
+				names:    map[string]struct{}{},
+			}
+			d.dns.put(domain, s, t.ObservationTime)
+		}
+		if _, seen := s.names[name]; seen || s.reported || len(s.names) >= maxDNSNames {
+			continue
+		}
+		s.names[name] = struct{}{}
+		s.labelLength += len(labels[0])
+		s.entropy += shannonEntropy(labels[0])
+		switch q.Type {
+		case layers.DNSTypeTXT, layers.DNSTypeNULL:
+			s.unusualTypes++
+		}
+
+		if len(s.names) < d.opts.DNSMinQueries {
+			continue
+		}
+
+		n := float64(len(s.names))
+		var score float64
+		var reasons []string
+		if avg := float64(s.labelLength) / n; avg > float64(d.opts.DNSLongLabel) {
+			score += 0.4
+			reasons = append(reasons, fmt.Sprintf("average label length of %.0f", avg))
+		}
+		if avg := s.entropy / n; avg > d.opts.DNSEntropyThreshold {
+			score += 0.3
+			reasons = append(reasons, fmt.Sprintf("average label entropy of %.2f bits", avg))
+		}
+		if s.unusualTypes*2 > len(s.names) {
+			score += 0.2
+			reasons = append(reasons, "mostly TXT or NULL queries")
+		}
+		score += 0.1
+		reasons = append(reasons, fmt.Sprintf("%d distinct names queried", len(s.names)))
+
+		if score < d.opts.ScoreThreshold {
+			continue
+		}
+		s.reported = true
+		results = append(results, gnet.ThreatAnnotation{
+			Kind:    gnet.DNSTunnelThreat,
+			Score:   math.Min(score, 1),
+			Reasons: reasons,
+			SrcIP:   s.client,
+			DstIP:   s.resolver,
+			DstPort: t.DstPort,
+			Domain:  domain,
+		})
+	}
+	return results
+}
+
+// Returns the Shannon entropy of s in bits per byte.
+func shannonEntropy(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var entropy float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
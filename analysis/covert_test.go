@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var (
+	clientIP = net.IP{10, 0, 0, 1}
+	serverIP = net.IP{10, 0, 0, 2}
+	start    = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func icmpEcho(reply bool, size int, at time.Time) gnet.NetTraffic {
+	t := gnet.NetTraffic{
+		LayerType:       "ICMPv4",
+		SrcIP:           clientIP,
+		DstIP:           serverIP,
+		Payload:         make([]byte, icmpEchoHeaderLength+size),
+		ObservationTime: at,
+		Content: gnet.ICMPv4{
+			TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+		},
+	}
+	if reply {
+		t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+		t.Content = gnet.ICMPv4{
+			TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0),
+		}
+	}
+	return t
+}
+
+func TestICMPTunnel(t *testing.T) {
+	d := NewCovertChannelDetector(NewCovertChannelOptions())
+
+	var found []gnet.ThreatAnnotation
+	for i := 0; i < 20; i++ {
+		at := start.Add(time.Duration(i) * 50 * time.Millisecond)
+		found = append(found, d.Observe(icmpEcho(false, 1000, at))...)
+		found = append(found, d.Observe(icmpEcho(true, 16, at))...)
+	}
+
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, gnet.ICMPTunnelThreat, found[0].Kind)
+		assert.True(t, found[0].SrcIP.Equal(clientIP))
+	}
+}
+
+func TestOrdinaryPing(t *testing.T) {
+	d := NewCovertChannelDetector(NewCovertChannelOptions())
+
+	for i := 0; i < 20; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		assert.Empty(t, d.Observe(icmpEcho(false, 56, at)))
+		assert.Empty(t, d.Observe(icmpEcho(true, 56, at)))
+	}
+}
+
+func TestDNSTunnel(t *testing.T) {
+	d := NewCovertChannelDetector(NewCovertChannelOptions())
+
+	var found []gnet.ThreatAnnotation
+	for i := 0; i < 30; i++ {
+		name := fmt.Sprintf("%x%x.t.example.com", i*7919+104729, []byte("q9Zr1LmX0pK7aWc3Vb6NyTe4"))
+		found = append(found, d.Observe(gnet.NetTraffic{
+			SrcIP:   clientIP,
+			DstIP:   serverIP,
+			DstPort: 53,
+			Content: gnet.DNSRequest{
+				Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeTXT}},
+			},
+		})...)
+	}
+
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, gnet.DNSTunnelThreat, found[0].Kind)
+		assert.Equal(t, "example.com", found[0].Domain)
+	}
+}
+
+func TestDNSTunnelUnderPublicSuffix(t *testing.T) {
+	d := NewCovertChannelDetector(NewCovertChannelOptions())
+
+	query := func(name string) []gnet.ThreatAnnotation {
+		return d.Observe(gnet.NetTraffic{
+			SrcIP:   clientIP,
+			DstIP:   serverIP,
+			DstPort: 53,
+			Content: gnet.DNSRequest{
+				Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeTXT}},
+			},
+		})
+	}
+
+	// Names of other sites under co.uk are not counted with the tunnel's.
+	for i := 0; i < 30; i++ {
+		assert.Empty(t, query(fmt.Sprintf("www.site%d.co.uk", i)))
+	}
+
+	var found []gnet.ThreatAnnotation
+	for i := 0; i < 30; i++ {
+		found = append(found, query(fmt.Sprintf("%x%x.example.co.uk", i*7919+104729, []byte("q9Zr1LmX0pK7aWc3Vb6NyTe4")))...)
+	}
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "example.co.uk", found[0].Domain)
+	}
+}
+
+func TestBeacon(t *testing.T) {
+	d := NewCovertChannelDetector(NewCovertChannelOptions())
+
+	var found []gnet.ThreatAnnotation
+	for i := 0; i < 10; i++ {
+		found = append(found, d.Observe(gnet.NetTraffic{
+			SrcIP:           clientIP,
+			DstIP:           serverIP,
+			DstPort:         443,
+			Content:         gnet.TCPConnectionMetadata{SourceToDest: gnet.TCPDirectionStats{Bytes: 512}},
+			ObservationTime: start.Add(time.Duration(i) * time.Minute),
+		})...)
+	}
+
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, gnet.BeaconThreat, found[0].Kind)
+		assert.Equal(t, 443, found[0].DstPort)
+	}
+}
+
+func TestCovertChannelDetectorForgets(t *testing.T) {
+	opts := NewCovertChannelOptions()
+	opts.MaxTracked = 2
+	opts.IdleTimeout = time.Hour
+	d := NewCovertChannelDetector(opts)
+
+	for i := 0; i < 3; i++ {
+		echo := icmpEcho(false, 56, start.Add(time.Duration(i)*time.Minute))
+		echo.DstIP = net.IPv4(192, 0, 2, byte(i))
+		d.Observe(echo)
+	}
+	assert.Equal(t, 2, d.icmp.len())
+
+	d.Observe(icmpEcho(false, 56, start.Add(2*time.Hour)))
+	assert.Equal(t, 1, d.icmp.len())
+}
@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Conventional port for DNS over TLS (RFC 7858).
+const DNSOverTLSPort = 853
+
+// Media types of DoH messages: the wire format from RFC 8484, and the JSON
+// format offered by several public resolvers.
+const (
+	dnsMessageMediaType = "application/dns-message"
+	dnsJSONMediaType    = "application/dns-json"
+)
+
+// EncryptedDNSDetector recognizes connections carrying DNS over TLS, from TLS
+// Client Hellos sent to port 853, and DNS over HTTPS, from the media types and
+// paths of parsed HTTP messages. DoH is only visible once HTTP is parsed, so
+// it is only detected in cleartext or decrypted traffic.
+//
+// Each connection is reported at most once. Safe for concurrent use.
+type EncryptedDNSDetector struct {
+	mu       sync.Mutex
+	reported map[string]struct{}
+}
+
+func NewEncryptedDNSDetector() *EncryptedDNSDetector {
+	return &EncryptedDNSDetector{
+		reported: map[string]struct{}{},
+	}
+}
+
+// Run passes through all traffic from in, interleaving a NetTraffic carrying a
+// gnet.EncryptedDNSMetadata after the traffic that revealed it. The returned
+// channel is closed once in is closed.
+func (d *EncryptedDNSDetector) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			m, found := d.Observe(t)
+			out <- t
+			if found {
+				out <- gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           t.SrcIP,
+					SrcPort:         t.SrcPort,
+					DstIP:           t.DstIP,
+					DstPort:         t.DstPort,
+					Content:         m,
+					ConnectionID:    t.ConnectionID,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: t.FinalPacketTime,
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Observe returns the encrypted DNS connection that t reveals, if t is the
+// first traffic to reveal it.
+func (d *EncryptedDNSDetector) Observe(t gnet.NetTraffic) (gnet.EncryptedDNSMetadata, bool) {
+	m := gnet.EncryptedDNSMetadata{ConnectionID: t.ConnectionID}
+
+	switch c := t.Content.(type) {
+	case gnet.TLSClientHello:
+		if t.DstPort != DNSOverTLSPort {
+			return m, false
+		}
+		m.Protocol = gnet.DoTProtocol
+		m.ServerName = c.ServerName
+		m.ResolverIP, m.ResolverPort = t.DstIP, t.DstPort
+
+	case gnet.HTTPRequest:
+		if !isDoHRequest(c) {
+			return m, false
+		}
+		m.Protocol = gnet.DoHProtocol
+		m.ServerName = c.Host
+		if c.URL != nil {
+			m.Path = c.URL.Path
+		}
+		m.ResolverIP, m.ResolverPort = t.DstIP, t.DstPort
+
+	case gnet.HTTPResponse:
+		if !isDNSMediaType(c.Header.Get("Content-Type")) {
+			return m, false
+		}
+		m.Protocol = gnet.DoHProtocol
+		m.ResolverIP, m.ResolverPort = t.SrcIP, t.SrcPort
+
+	default:
+		return m, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := t.ConnectionID.String() + ":" + string(m.Protocol)
+	if _, ok := d.reported[key]; ok {
+		return m, false
+	}
+	d.reported[key] = struct{}{}
+	return m, true
+}
+
+// Reports whether r looks like a DoH query: a POST of a DNS message, or a GET
+// that asks for one, either through the Accept header or through the
+// conventional path and query parameter.
+func isDoHRequest(r gnet.HTTPRequest) bool {
+	if isDNSMediaType(r.Header.Get("Content-Type")) {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if isDNSMediaType(accept) {
+			return true
+		}
+	}
+
+	if r.Method != "GET" || r.URL == nil {
+		return false
+	}
+	query := r.URL.Query()
+	switch r.URL.Path {
+	case "/dns-query":
+		return query.Get("dns") != "" || query.Get("name") != ""
+	case "/resolve":
+		return query.Get("name") != ""
+	}
+	return false
+}
+
+func isDNSMediaType(v string) bool {
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+	if err != nil {
+		return false
+	}
+	return mediaType == dnsMessageMediaType || mediaType == dnsJSONMediaType
+}
@@ -0,0 +1,119 @@
+package analysis
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestDoT(t *testing.T) {
+	d := NewEncryptedDNSDetector()
+	conn := uuid.New()
+
+	hello := gnet.NetTraffic{
+		SrcIP:        clientIP,
+		DstIP:        serverIP,
+		DstPort:      DNSOverTLSPort,
+		ConnectionID: conn,
+		Content:      gnet.TLSClientHello{ServerName: "dns.example.net"},
+	}
+	m, found := d.Observe(hello)
+	if assert.True(t, found) {
+		assert.Equal(t, gnet.DoTProtocol, m.Protocol)
+		assert.Equal(t, "dns.example.net", m.ServerName)
+		assert.True(t, m.ResolverIP.Equal(serverIP))
+		assert.Equal(t, DNSOverTLSPort, m.ResolverPort)
+	}
+
+	// Reported once per connection.
+	_, found = d.Observe(hello)
+	assert.False(t, found)
+
+	hello.DstPort = 443
+	hello.ConnectionID = uuid.New()
+	_, found = d.Observe(hello)
+	assert.False(t, found)
+}
+
+func TestDoH(t *testing.T) {
+	tests := []struct {
+		name string
+		req  gnet.HTTPRequest
+		doh  bool
+	}{
+		{
+			name: "POST wire format",
+			req: gnet.HTTPRequest{
+				Method: "POST",
+				URL:    &url.URL{Path: "/dns-query"},
+				Header: http.Header{"Content-Type": {"application/dns-message"}},
+			},
+			doh: true,
+		},
+		{
+			name: "GET wire format",
+			req: gnet.HTTPRequest{
+				Method: "GET",
+				URL:    &url.URL{Path: "/dns-query", RawQuery: "dns=AAABAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE"},
+			},
+			doh: true,
+		},
+		{
+			name: "JSON API",
+			req: gnet.HTTPRequest{
+				Method: "GET",
+				URL:    &url.URL{Path: "/resolve", RawQuery: "name=example.com&type=A"},
+				Header: http.Header{"Accept": {"text/html, application/dns-json"}},
+			},
+			doh: true,
+		},
+		{
+			name: "ordinary request",
+			req: gnet.HTTPRequest{
+				Method: "GET",
+				URL:    &url.URL{Path: "/resolve"},
+				Header: http.Header{"Accept": {"text/html"}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		d := NewEncryptedDNSDetector()
+		tc.req.Host = "resolver.example.net"
+		m, found := d.Observe(gnet.NetTraffic{
+			SrcIP:   clientIP,
+			DstIP:   serverIP,
+			DstPort: 443,
+			Content: tc.req,
+		})
+		assert.Equal(t, tc.doh, found, tc.name)
+		if found {
+			assert.Equal(t, gnet.DoHProtocol, m.Protocol, tc.name)
+			assert.Equal(t, "resolver.example.net", m.ServerName, tc.name)
+			assert.Equal(t, tc.req.URL.Path, m.Path, tc.name)
+			assert.True(t, m.ResolverIP.Equal(serverIP), tc.name)
+		}
+	}
+}
+
+func TestDoHResponse(t *testing.T) {
+	d := NewEncryptedDNSDetector()
+	m, found := d.Observe(gnet.NetTraffic{
+		SrcIP:   serverIP,
+		SrcPort: 443,
+		DstIP:   clientIP,
+		Content: gnet.HTTPResponse{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/dns-message"}},
+		},
+	})
+	if assert.True(t, found) {
+		assert.True(t, m.ResolverIP.Equal(serverIP))
+		assert.Equal(t, 443, m.ResolverPort)
+	}
+}
@@ -0,0 +1,486 @@
+package analysis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/pcap/ja3"
+)
+
+// Default time between checks of indicator files for changes.
+const DefaultIndicatorReloadInterval = time.Minute
+
+var ja3HashPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+type IndicatorOptions struct {
+	// Files of indicators in the format read by ReadIndicators. The
+	// indicators of each file are given its base name as their source.
+	Files []string
+
+	// How often Watch checks Files for changes.
+	ReloadInterval time.Duration
+}
+
+func NewIndicatorOptions() IndicatorOptions {
+	return IndicatorOptions{
+		ReloadInterval: DefaultIndicatorReloadInterval,
+	}
+}
+
+// ReadIndicators reads indicators, one per line, from r. A line holds the type
+// of the indicator, its value, and optionally a description, separated by
+// whitespace:
+//
+//	ip 203.0.113.0/24 Known C2 range
+//	domain evil.example
+//	ja3 e7d705a3286e19ea42f587b344ee6865
+//	url http://evil.example/payload.exe
+//
+// The type may be left out of lines holding a value alone, in which case it is
+// told from the value. Blank lines and lines starting with '#' are ignored.
+func ReadIndicators(r io.Reader, source string) ([]gnet.Indicator, error) {
+	var indicators []gnet.Indicator
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		ind := gnet.Indicator{Source: source}
+		if len(fields) == 1 {
+			ind.Type, ind.Value = guessIndicatorType(fields[0]), fields[0]
+		} else {
+			ind.Type, ind.Value = gnet.IndicatorType(strings.ToLower(fields[0])), fields[1]
+			ind.Description = strings.Join(fields[2:], " ")
+		}
+		if _, _, err := indicatorKey(ind); err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", source, line)
+		}
+		indicators = append(indicators, ind)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read indicators from %s", source)
+	}
+	return indicators, nil
+}
+
+func guessIndicatorType(value string) gnet.IndicatorType {
+	if net.ParseIP(value) != nil {
+		return gnet.IPIndicator
+	}
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return gnet.IPIndicator
+	}
+	if ja3HashPattern.MatchString(value) {
+		return gnet.JA3Indicator
+	}
+	if strings.Contains(value, "/") {
+		return gnet.URLIndicator
+	}
+	return gnet.DomainIndicator
+}
+
+// Returns the normalized form of the value of ind under which it is looked
+// up, or the prefix it covers for a CIDR indicator.
+func indicatorKey(ind gnet.Indicator) (string, *net.IPNet, error) {
+	switch ind.Type {
+	case gnet.IPIndicator:
+		if ip := net.ParseIP(ind.Value); ip != nil {
+			return ip.String(), nil, nil
+		}
+		_, prefix, err := net.ParseCIDR(ind.Value)
+		if err != nil {
+			return "", nil, errors.Errorf("invalid IP indicator %q", ind.Value)
+		}
+		return "", prefix, nil
+	case gnet.DomainIndicator:
+		domain := normalizeDomain(ind.Value)
+		if domain == "" {
+			return "", nil, errors.Errorf("invalid domain indicator %q", ind.Value)
+		}
+		return domain, nil, nil
+	case gnet.JA3Indicator:
+		if !ja3HashPattern.MatchString(ind.Value) {
+			return "", nil, errors.Errorf("invalid JA3 indicator %q", ind.Value)
+		}
+		return strings.ToLower(ind.Value), nil, nil
+	case gnet.URLIndicator:
+		value := ind.Value
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return "", nil, errors.Errorf("invalid URL indicator %q", ind.Value)
+		}
+		return normalizeURL(u.Host, u.RequestURI()), nil, nil
+	}
+	return "", nil, errors.Errorf("unknown indicator type %q", ind.Type)
+}
+
+func normalizeDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// Returns host and requestURI as "host/path?query", without the default HTTP
+// ports.
+func normalizeURL(host, requestURI string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		host = h
+	}
+	if !strings.HasPrefix(requestURI, "/") {
+		requestURI = "/" + requestURI
+	}
+	return host + requestURI
+}
+
+// Indicators compiled for lookup.
+type indicatorIndex struct {
+	ips      map[string][]gnet.Indicator
+	prefixes []prefixIndicator
+	domains  map[string][]gnet.Indicator
+	ja3s     map[string][]gnet.Indicator
+	urls     map[string][]gnet.Indicator
+}
+
+type prefixIndicator struct {
+	prefix    *net.IPNet
+	indicator gnet.Indicator
+}
+
+func newIndicatorIndex(sets map[string][]gnet.Indicator) *indicatorIndex {
+	index := &indicatorIndex{
+		ips:     map[string][]gnet.Indicator{},
+		domains: map[string][]gnet.Indicator{},
+		ja3s:    map[string][]gnet.Indicator{},
+		urls:    map[string][]gnet.Indicator{},
+	}
+	for _, set := range sets {
+		for _, ind := range set {
+			key, prefix, err := indicatorKey(ind)
+			if err != nil {
+				continue
+			}
+			switch {
+			case prefix != nil:
+				index.prefixes = append(index.prefixes, prefixIndicator{prefix, ind})
+			case ind.Type == gnet.IPIndicator:
+				index.ips[key] = append(index.ips[key], ind)
+			case ind.Type == gnet.DomainIndicator:
+				index.domains[key] = append(index.domains[key], ind)
+			case ind.Type == gnet.JA3Indicator:
+				index.ja3s[key] = append(index.ja3s[key], ind)
+			case ind.Type == gnet.URLIndicator:
+				index.urls[key] = append(index.urls[key], ind)
+			}
+		}
+	}
+	return index
+}
+
+func (index *indicatorIndex) ip(ip net.IP) []gnet.Indicator {
+	if ip == nil {
+		return nil
+	}
+	found := index.ips[ip.String()]
+	for _, p := range index.prefixes {
+		if p.prefix.Contains(ip) {
+			found = append(found[:len(found):len(found)], p.indicator)
+		}
+	}
+	return found
+}
+
+// Returns the indicators of name and of the domains it is under.
+func (index *indicatorIndex) domain(name string) []gnet.Indicator {
+	var found []gnet.Indicator
+	for name = normalizeDomain(name); name != ""; {
+		found = append(found, index.domains[name]...)
+		_, parent, ok := strings.Cut(name, ".")
+		if !ok {
+			break
+		}
+		name = parent
+	}
+	return found
+}
+
+// Returns the indicators of the URL, and of the URL without its query.
+func (index *indicatorIndex) url(host, requestURI string) []gnet.Indicator {
+	key := normalizeURL(host, requestURI)
+	found := index.urls[key]
+	if path, _, ok := strings.Cut(key, "?"); ok {
+		found = append(found[:len(found):len(found)], index.urls[path]...)
+	}
+	return found
+}
+
+// IndicatorMatcher matches traffic against sets of threat intelligence
+// indicators: the addresses of its endpoints against IP indicators, DNS
+// queries, TLS server names and HTTP hosts against domain indicators, TLS
+// client hellos against JA3 indicators, and HTTP requests against URL
+// indicators.
+//
+// Indicator sets are loaded from files, which Watch reloads as they change,
+// or set directly with SetIndicators. Lookups always see a complete set: a
+// file that fails to load leaves its previous indicators in place.
+//
+// Safe for concurrent use.
+type IndicatorMatcher struct {
+	opts IndicatorOptions
+
+	mu    sync.RWMutex
+	index *indicatorIndex
+
+	// Indicators by source, and the state of the file of each source loaded
+	// from one.
+	sets  map[string][]gnet.Indicator
+	files map[string]os.FileInfo
+	err   error
+}
+
+// Creates an IndicatorMatcher and loads opts.Files. Fails if any of them
+// cannot be loaded.
+func NewIndicatorMatcher(opts IndicatorOptions) (*IndicatorMatcher, error) {
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = DefaultIndicatorReloadInterval
+	}
+	m := &IndicatorMatcher{
+		opts:  opts,
+		index: newIndicatorIndex(nil),
+		sets:  map[string][]gnet.Indicator{},
+		files: map[string]os.FileInfo{},
+	}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SetIndicators replaces the indicators from source, or removes them if
+// indicators is empty. Their Source is set to source.
+func (m *IndicatorMatcher) SetIndicators(source string, indicators []gnet.Indicator) {
+	set := make([]gnet.Indicator, len(indicators))
+	for i, ind := range indicators {
+		ind.Source = source
+		set[i] = ind
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(set) == 0 {
+		delete(m.sets, source)
+	} else {
+		m.sets[source] = set
+	}
+	m.index = newIndicatorIndex(m.sets)
+}
+
+// Reload loads the files of the matcher that changed since they were last
+// loaded, and returns the first error encountered.
+func (m *IndicatorMatcher) Reload() error {
+	var firstErr error
+	for _, path := range m.opts.Files {
+		if err := m.reloadFile(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	m.mu.Lock()
+	m.err = firstErr
+	m.mu.Unlock()
+	return firstErr
+}
+
+func (m *IndicatorMatcher) reloadFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to load indicators")
+	}
+	m.mu.RLock()
+	last, loaded := m.files[path]
+	m.mu.RUnlock()
+	if loaded && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to load indicators")
+	}
+	defer f.Close()
+	indicators, err := ReadIndicators(f, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	m.SetIndicators(filepath.Base(path), indicators)
+	m.mu.Lock()
+	m.files[path] = info
+	m.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the files of the matcher every opts.ReloadInterval, until ctx
+// is done. Errors are kept for Err.
+func (m *IndicatorMatcher) Watch(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Reload()
+		}
+	}
+}
+
+// Returns the error from the latest reload, if it failed.
+func (m *IndicatorMatcher) Err() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.err
+}
+
+// Run passes through all traffic from in, with the indicators it matched
+// added to its Indicators. The returned channel is closed once in is closed.
+func (m *IndicatorMatcher) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			t.Indicators = append(t.Indicators, m.Match(t)...)
+			out <- t
+		}
+	}()
+	return out
+}
+
+// RunFindings passes through all traffic from in unchanged, and sends a
+// NetTraffic carrying a gnet.IndicatorMatch on findings for each indicator it
+// matched. An indicator is reported once per connection, until the connection
+// ends. Both channels must be drained, and are closed once in is closed.
+func (m *IndicatorMatcher) RunFindings(in <-chan gnet.NetTraffic) (traffic, findings <-chan gnet.NetTraffic) {
+	out := make(chan gnet.NetTraffic, cap(in))
+	found := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		defer close(found)
+
+		reported := map[uuid.UUID]map[string]struct{}{}
+		for t := range in {
+			for _, match := range m.Match(t) {
+				if t.ConnectionID != uuid.Nil {
+					key := fmt.Sprintf("%s\x00%s\x00%s\x00%s", match.Indicator.Source, match.Indicator.Type, match.Indicator.Value, match.Field)
+					if _, ok := reported[t.ConnectionID][key]; ok {
+						continue
+					}
+					if reported[t.ConnectionID] == nil {
+						reported[t.ConnectionID] = map[string]struct{}{}
+					}
+					reported[t.ConnectionID][key] = struct{}{}
+				}
+				found <- gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           t.SrcIP,
+					SrcPort:         t.SrcPort,
+					DstIP:           t.DstIP,
+					DstPort:         t.DstPort,
+					Content:         match,
+					ConnectionID:    t.ConnectionID,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: t.FinalPacketTime,
+				}
+			}
+			if _, ok := t.Content.(gnet.TCPConnectionMetadata); ok {
+				delete(reported, t.ConnectionID)
+			}
+			out <- t
+		}
+	}()
+	return out, found
+}
+
+// Match returns the indicators that t matches.
+func (m *IndicatorMatcher) Match(t gnet.NetTraffic) []gnet.IndicatorMatch {
+	m.mu.RLock()
+	index := m.index
+	m.mu.RUnlock()
+
+	var matches []gnet.IndicatorMatch
+	add := func(field, observed string, indicators []gnet.Indicator) {
+		for _, ind := range indicators {
+			matches = append(matches, gnet.IndicatorMatch{
+				ConnectionID: t.ConnectionID,
+				Indicator:    ind,
+				Field:        field,
+				Observed:     observed,
+			})
+		}
+	}
+
+	if t.SrcIP != nil {
+		add("src_ip", t.SrcIP.String(), index.ip(t.SrcIP))
+	}
+	if t.DstIP != nil {
+		add("dst_ip", t.DstIP.String(), index.ip(t.DstIP))
+	}
+
+	switch c := t.Content.(type) {
+	case gnet.DNSRequest:
+		for _, q := range c.Questions {
+			add("dns_query", string(q.Name), index.domain(string(q.Name)))
+		}
+	case gnet.TLSClientHello:
+		if c.ServerName != "" {
+			add("tls_server_name", c.ServerName, index.domain(c.ServerName))
+		}
+		if len(index.ja3s) > 0 {
+			_, hash := ja3.GetJa3Hash(c)
+			add("ja3", hash, index.ja3s[hash])
+		}
+	case gnet.HTTPRequest:
+		matchHTTP(index, c, add)
+	case gnet.HTTPExchange:
+		if c.Request != nil {
+			matchHTTP(index, *c.Request, add)
+		}
+	}
+	return matches
+}
+
+func matchHTTP(index *indicatorIndex, r gnet.HTTPRequest, add func(field, observed string, indicators []gnet.Indicator)) {
+	host := r.Host
+	if host == "" && r.URL != nil {
+		host = r.URL.Host
+	}
+	if host == "" {
+		return
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	add("http_host", name, index.domain(name))
+	if r.URL != nil {
+		requestURI := r.URL.RequestURI()
+		add("url", host+requestURI, index.url(host, requestURI))
+	}
+}
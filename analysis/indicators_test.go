@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/pcap/ja3"
+)
+
+func TestReadIndicators(t *testing.T) {
+	indicators, err := ReadIndicators(strings.NewReader(`# feed
+ip 203.0.113.0/24 Known C2 range
+
+Evil.Example.
+e7d705a3286e19ea42f587b344ee6865
+evil.example/payload.exe
+`), "feed.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []gnet.Indicator{
+		{Type: gnet.IPIndicator, Value: "203.0.113.0/24", Source: "feed.txt", Description: "Known C2 range"},
+		{Type: gnet.DomainIndicator, Value: "Evil.Example.", Source: "feed.txt"},
+		{Type: gnet.JA3Indicator, Value: "e7d705a3286e19ea42f587b344ee6865", Source: "feed.txt"},
+		{Type: gnet.URLIndicator, Value: "evil.example/payload.exe", Source: "feed.txt"},
+	}, indicators)
+
+	_, err = ReadIndicators(strings.NewReader("ip 10.0.0.1\nhash abc\n"), "bad.txt")
+	assert.EqualError(t, err, `bad.txt:2: unknown indicator type "hash"`)
+}
+
+func TestIndicatorMatcher(t *testing.T) {
+	m, err := NewIndicatorMatcher(NewIndicatorOptions())
+	if !assert.NoError(t, err) {
+		return
+	}
+	hello := gnet.TLSClientHello{Version: 0x0303, CipherSuites: []uint16{0xc02f}, ServerName: "cdn.evil.example"}
+	_, hash := ja3.GetJa3Hash(hello)
+	m.SetIndicators("feed", []gnet.Indicator{
+		{Type: gnet.IPIndicator, Value: "10.0.0.0/8"},
+		{Type: gnet.IPIndicator, Value: "10.0.0.2"},
+		{Type: gnet.DomainIndicator, Value: "evil.example"},
+		{Type: gnet.JA3Indicator, Value: strings.ToUpper(hash)},
+		{Type: gnet.URLIndicator, Value: "http://good.example:80/payload.exe"},
+	})
+
+	matches := m.Match(gnet.NetTraffic{SrcIP: clientIP, DstIP: net.IPv4(192, 0, 2, 1), Content: hello})
+	var fields []string
+	for _, match := range matches {
+		assert.Equal(t, "feed", match.Indicator.Source)
+		fields = append(fields, match.Field+" "+match.Observed)
+	}
+	assert.Equal(t, []string{"src_ip 10.0.0.1", "tls_server_name cdn.evil.example", "ja3 " + hash}, fields)
+
+	// An address in both a prefix and an exact indicator matches both.
+	assert.Len(t, m.Match(gnet.NetTraffic{SrcIP: serverIP}), 2)
+
+	req := gnet.HTTPRequest{Host: "GOOD.example", URL: &url.URL{Path: "/payload.exe", RawQuery: "x=1"}}
+	matches = m.Match(gnet.NetTraffic{Content: req})
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "url", matches[0].Field)
+		assert.Equal(t, "GOOD.example/payload.exe?x=1", matches[0].Observed)
+	}
+
+	dns := gnet.DNSRequest{Questions: []layers.DNSQuestion{{Name: []byte("a.evil.example")}, {Name: []byte("notevil.example")}}}
+	assert.Len(t, m.Match(gnet.NetTraffic{Content: dns}), 1)
+
+	m.SetIndicators("feed", nil)
+	assert.Empty(t, m.Match(gnet.NetTraffic{SrcIP: clientIP, Content: hello}))
+}
+
+func TestIndicatorMatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ips.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("10.0.0.1\n"), 0o644))
+
+	opts := NewIndicatorOptions()
+	opts.Files = []string{path}
+	m, err := NewIndicatorMatcher(opts)
+	if !assert.NoError(t, err) {
+		return
+	}
+	matches := m.Match(gnet.NetTraffic{SrcIP: clientIP})
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "ips.txt", matches[0].Indicator.Source)
+	}
+
+	// A file that fails to load leaves the indicators in place.
+	assert.NoError(t, os.WriteFile(path, []byte("not an ip/\nip x\n"), 0o644))
+	assert.Error(t, m.Reload())
+	assert.Error(t, m.Err())
+	assert.Len(t, m.Match(gnet.NetTraffic{SrcIP: clientIP}), 1)
+
+	assert.NoError(t, os.WriteFile(path, []byte("10.0.0.2\n"), 0o644))
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	assert.NoError(t, m.Reload())
+	assert.NoError(t, m.Err())
+	assert.Empty(t, m.Match(gnet.NetTraffic{SrcIP: clientIP}))
+	assert.Len(t, m.Match(gnet.NetTraffic{SrcIP: serverIP}), 1)
+}
+
+func TestIndicatorMatcherRun(t *testing.T) {
+	m, _ := NewIndicatorMatcher(NewIndicatorOptions())
+	m.SetIndicators("feed", []gnet.Indicator{{Type: gnet.IPIndicator, Value: serverIP.String()}})
+	conn := uuid.New()
+	traffic := []gnet.NetTraffic{
+		{SrcIP: clientIP, DstIP: serverIP, ConnectionID: conn, Content: gnet.TCPPacketMetadata{SYN: true}},
+		{SrcIP: serverIP, DstIP: clientIP, ConnectionID: conn, Content: gnet.TCPPacketMetadata{SYN: true, ACK: true}},
+		{SrcIP: clientIP, DstIP: serverIP, ConnectionID: conn, Content: gnet.TCPConnectionMetadata{}},
+		{SrcIP: clientIP, DstIP: serverIP, ConnectionID: conn, Content: gnet.TCPPacketMetadata{}},
+		{SrcIP: clientIP, DstIP: net.IPv4(192, 0, 2, 1)},
+	}
+
+	in := make(chan gnet.NetTraffic, len(traffic))
+	for _, tr := range traffic {
+		in <- tr
+	}
+	close(in)
+	var tagged int
+	for tr := range m.Run(in) {
+		if len(tr.Indicators) > 0 {
+			tagged++
+			assert.Equal(t, conn, tr.Indicators[0].ConnectionID)
+		}
+	}
+	assert.Equal(t, 4, tagged)
+
+	in = make(chan gnet.NetTraffic, len(traffic))
+	for _, tr := range traffic {
+		in <- tr
+	}
+	close(in)
+	out, findings := m.RunFindings(in)
+	var passed int
+	for range out {
+		passed++
+	}
+	var fields []string
+	for f := range findings {
+		fields = append(fields, f.Content.(gnet.IndicatorMatch).Field)
+	}
+	assert.Equal(t, len(traffic), passed)
+	// Once per connection and field, until the connection ends.
+	assert.Equal(t, []string{"dst_ip", "src_ip", "dst_ip"}, fields)
+}
@@ -0,0 +1,118 @@
+package analysis
+
+import (
+	"container/list"
+	"time"
+)
+
+// A map of per-key state that forgets the least recently used keys beyond a
+// limit, and keys that have been idle for too long, so that detectors running
+// over long live captures do not grow without bound. Idleness is measured in
+// observation time. Not safe for concurrent use.
+type lru[V any] struct {
+	max  int           // 0 for no limit
+	idle time.Duration // 0 for no limit
+
+	entries map[string]*list.Element
+	order   *list.List // of *lruEntry[V], least recently used first
+
+	// If set, called with the keys forgotten for the limit or for being idle,
+	// but not those removed.
+	forget func(key string, value V)
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+	last  time.Time
+}
+
+func newLRU[V any](max int, idle time.Duration) *lru[V] {
+	return &lru[V]{
+		max:     max,
+		idle:    idle,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Returns the value of key, marking it as used at now. Times that are zero are
+// ignored.
+func (c *lru[V]) get(key string, now time.Time) (V, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.touch(elem, now)
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+// Sets the value of key, marking it as used at now, and forgets the least
+// recently used key if there are too many.
+func (c *lru[V]) put(key string, value V, now time.Time) {
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*lruEntry[V]).value = value
+		c.touch(elem, now)
+		return
+	}
+	if c.max > 0 && c.order.Len() >= c.max {
+		c.forgetElement(c.order.Front())
+	}
+	c.entries[key] = c.order.PushBack(&lruEntry[V]{key: key, value: value, last: now})
+}
+
+// Removes key and returns its value, if it was present.
+func (c *lru[V]) remove(key string) (V, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return c.removeElement(elem), true
+}
+
+// Forgets the keys that have not been used for the idle timeout as of now.
+// Keys only used at zero times are timed from the first call with a time.
+func (c *lru[V]) expire(now time.Time) {
+	if c.idle <= 0 || now.IsZero() {
+		return
+	}
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		e := elem.Value.(*lruEntry[V])
+		if e.last.IsZero() {
+			e.last = now
+		} else if now.Sub(e.last) < c.idle {
+			return
+		} else {
+			c.forgetElement(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *lru[V]) len() int {
+	return c.order.Len()
+}
+
+func (c *lru[V]) touch(elem *list.Element, now time.Time) {
+	c.order.MoveToBack(elem)
+	if e := elem.Value.(*lruEntry[V]); now.After(e.last) {
+		e.last = now
+	}
+}
+
+func (c *lru[V]) removeElement(elem *list.Element) V {
+	e := c.order.Remove(elem).(*lruEntry[V])
+	delete(c.entries, e.key)
+	return e.value
+}
+
+func (c *lru[V]) forgetElement(elem *list.Element) {
+	key := elem.Value.(*lruEntry[V]).key
+	value := c.removeElement(elem)
+	if c.forget != nil {
+		c.forget(key, value)
+	}
+}
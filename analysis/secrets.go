@@ -0,0 +1,324 @@
+package analysis
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Default amount of each HTTP body searched for API keys and tokens.
+const DefaultSecretBodyScanLimit = 64 << 10
+
+type SecretOptions struct {
+	// Report secrets as seen, rather than masked.
+	RevealSecrets bool
+
+	// The number of bytes at the start of each HTTP body searched for API keys
+	// and tokens. 0 to search headers only.
+	BodyScanLimit int
+}
+
+func NewSecretOptions() SecretOptions {
+	return SecretOptions{
+		BodyScanLimit: DefaultSecretBodyScanLimit,
+	}
+}
+
+// Formats of well-known API keys.
+var apiKeyPatterns = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+}
+
+var jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+// Headers that carry API keys, whatever their format.
+var apiKeyHeaders = []string{"X-Api-Key", "Api-Key", "X-Auth-Token", "X-Access-Token"}
+
+// Form fields holding passwords, and the usernames that go with them.
+var (
+	passwordFields = map[string]bool{"password": true, "passwd": true, "pass": true, "pwd": true}
+	usernameFields = map[string]bool{"username": true, "user": true, "login": true, "email": true}
+)
+
+// SecretDetector looks for secrets in parsed content: cleartext credentials
+// in HTTP Basic authentication, login forms, FTP USER and PASS commands and
+// Telnet logins, as recorded by gnet.TelnetTracker, and API keys and JWTs in
+// HTTP headers and bodies. Each secret is reported once per connection.
+//
+// Safe for concurrent use.
+type SecretDetector struct {
+	opts SecretOptions
+
+	mu sync.Mutex
+
+	// The last FTP USER of each connection, until its PASS.
+	ftpUsers map[uuid.UUID]string
+
+	// Secrets reported on each connection, until it ends.
+	reported map[uuid.UUID]map[string]struct{}
+}
+
+func NewSecretDetector(opts SecretOptions) *SecretDetector {
+	return &SecretDetector{
+		opts:     opts,
+		ftpUsers: map[uuid.UUID]string{},
+		reported: map[uuid.UUID]map[string]struct{}{},
+	}
+}
+
+// Run passes through all traffic from in, interleaving a NetTraffic carrying a
+// gnet.SecurityFinding after the traffic it was found in. The returned channel
+// is closed once in is closed.
+func (d *SecretDetector) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			findings := d.Observe(t)
+			out <- t
+			for _, f := range findings {
+				out <- gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           t.SrcIP,
+					SrcPort:         t.SrcPort,
+					DstIP:           t.DstIP,
+					DstPort:         t.DstPort,
+					Content:         f,
+					ConnectionID:    t.ConnectionID,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: t.FinalPacketTime,
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Observe returns the secrets in t not yet reported on its connection.
+func (d *SecretDetector) Observe(t gnet.NetTraffic) []gnet.SecurityFinding {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var found []gnet.SecurityFinding
+	switch c := t.Content.(type) {
+	case gnet.HTTPRequest:
+		found = d.httpRequest(c)
+	case gnet.HTTPResponse:
+		found = d.scan(c.Header, c.Body.SubView(0, d.bodyLimit(c.Body.Len())).String(), "response")
+	case gnet.HTTPExchange:
+		if c.Request != nil {
+			found = d.httpRequest(*c.Request)
+		}
+		if c.Response != nil {
+			body := c.Response.Body
+			found = append(found, d.scan(c.Response.Header, body.SubView(0, d.bodyLimit(body.Len())).String(), "response")...)
+		}
+	case gnet.FtpSmtpRequest:
+		found = d.ftpCommand(t.ConnectionID, c)
+	case gnet.TelnetSession:
+		for _, login := range c.Logins {
+			if login.Password != "" {
+				found = append(found, gnet.SecurityFinding{
+					Category: gnet.CredentialFinding,
+					Type:     "Telnet",
+					Location: "login prompt",
+					Username: login.Username,
+					Secret:   login.Password,
+				})
+			}
+		}
+	case gnet.TCPConnectionMetadata:
+		delete(d.ftpUsers, t.ConnectionID)
+		delete(d.reported, t.ConnectionID)
+		return nil
+	}
+	return d.report(t.ConnectionID, found)
+}
+
+func (d *SecretDetector) httpRequest(r gnet.HTTPRequest) []gnet.SecurityFinding {
+	var found []gnet.SecurityFinding
+	for _, h := range []string{"Authorization", "Proxy-Authorization"} {
+		scheme, value, _ := strings.Cut(r.Header.Get(h), " ")
+		if !strings.EqualFold(scheme, "Basic") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		user, password, _ := strings.Cut(string(decoded), ":")
+		found = append(found, gnet.SecurityFinding{
+			Category: gnet.CredentialFinding,
+			Type:     "HTTP Basic",
+			Location: "header " + h,
+			Username: user,
+			Secret:   password,
+		})
+	}
+
+	if parts, _ := r.FormParts(); len(parts) > 0 {
+		var user string
+		var passwords []string
+		for _, p := range parts {
+			name := strings.ToLower(p.Name)
+			if usernameFields[name] && user == "" {
+				user = p.Payload.String()
+			} else if passwordFields[name] && p.Payload.Len() > 0 {
+				passwords = append(passwords, p.Payload.String())
+			}
+		}
+		for _, p := range passwords {
+			found = append(found, gnet.SecurityFinding{
+				Category: gnet.CredentialFinding,
+				Type:     "HTML form",
+				Location: "request body",
+				Username: user,
+				Secret:   p,
+			})
+		}
+	}
+
+	return append(found, d.scan(r.Header, r.Body.SubView(0, d.bodyLimit(r.Body.Len())).String(), "request")...)
+}
+
+// Looks for API keys and tokens in the headers and body of an HTTP message.
+func (d *SecretDetector) scan(header http.Header, body, message string) []gnet.SecurityFinding {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var found []gnet.SecurityFinding
+	for _, name := range names {
+		for _, v := range header[name] {
+			found = append(found, scanText(v, "header "+name)...)
+		}
+	}
+	for _, name := range apiKeyHeaders {
+		if v := header.Get(name); v != "" && len(scanText(v, "")) == 0 {
+			found = append(found, gnet.SecurityFinding{
+				Category: gnet.APIKeyFinding,
+				Type:     "API key",
+				Location: "header " + name,
+				Secret:   v,
+			})
+		}
+	}
+	return append(found, scanText(body, message+" body")...)
+}
+
+// Returns the API keys and JWTs in s.
+func scanText(s, location string) []gnet.SecurityFinding {
+	var found []gnet.SecurityFinding
+	for _, p := range apiKeyPatterns {
+		for _, key := range p.pattern.FindAllString(s, -1) {
+			found = append(found, gnet.SecurityFinding{
+				Category: gnet.APIKeyFinding,
+				Type:     p.name,
+				Location: location,
+				Secret:   key,
+			})
+		}
+	}
+	for _, token := range jwtPattern.FindAllString(s, -1) {
+		if isJWT(token) {
+			found = append(found, gnet.SecurityFinding{
+				Category: gnet.TokenFinding,
+				Type:     "JWT",
+				Location: location,
+				Secret:   token,
+			})
+		}
+	}
+	return found
+}
+
+// Reports whether token has a JOSE header naming its algorithm.
+func isJWT(token string) bool {
+	header, _, _ := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	return json.Unmarshal(data, &h) == nil && h.Alg != ""
+}
+
+func (d *SecretDetector) ftpCommand(conn uuid.UUID, r gnet.FtpSmtpRequest) []gnet.SecurityFinding {
+	switch strings.ToUpper(r.CMD) {
+	case "USER":
+		d.ftpUsers[conn] = r.Arg
+	case "PASS":
+		user := d.ftpUsers[conn]
+		delete(d.ftpUsers, conn)
+		// Anonymous logins conventionally send an email address.
+		if strings.EqualFold(user, "anonymous") || strings.EqualFold(user, "ftp") {
+			return nil
+		}
+		return []gnet.SecurityFinding{{
+			Category: gnet.CredentialFinding,
+			Type:     "FTP",
+			Location: "command PASS",
+			Username: user,
+			Secret:   r.Arg,
+		}}
+	}
+	return nil
+}
+
+func (d *SecretDetector) bodyLimit(n int64) int64 {
+	if n > int64(d.opts.BodyScanLimit) {
+		return int64(d.opts.BodyScanLimit)
+	}
+	return n
+}
+
+// Masks and returns the findings not yet reported on conn.
+func (d *SecretDetector) report(conn uuid.UUID, found []gnet.SecurityFinding) []gnet.SecurityFinding {
+	var result []gnet.SecurityFinding
+	for _, f := range found {
+		key := string(f.Category) + "\x00" + f.Type + "\x00" + f.Username + "\x00" + f.Secret
+		reported := d.reported[conn]
+		if reported == nil {
+			reported = map[string]struct{}{}
+			d.reported[conn] = reported
+		}
+		if _, ok := reported[key]; ok {
+			continue
+		}
+		reported[key] = struct{}{}
+
+		f.ConnectionID = conn
+		if !d.opts.RevealSecrets {
+			f.Secret = maskSecret(f.Secret)
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Keeps a few characters of long secrets, enough to tell them apart.
+func maskSecret(s string) string {
+	if len(s) < 12 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", len(s)-8) + s[len(s)-4:]
+}
@@ -0,0 +1,20 @@
+// Package all registers every built-in TCP parser with the gnet parser
+// registry. Import it for its side effects:
+//
+//	import _ "github.com/mel2oo/go-pcap/gnet/all"
+package all
+
+import (
+	_ "github.com/mel2oo/go-pcap/gnet/ctp"
+	_ "github.com/mel2oo/go-pcap/gnet/http"
+	_ "github.com/mel2oo/go-pcap/gnet/http2"
+	_ "github.com/mel2oo/go-pcap/gnet/imap"
+	_ "github.com/mel2oo/go-pcap/gnet/kerberos"
+	_ "github.com/mel2oo/go-pcap/gnet/pop3"
+	_ "github.com/mel2oo/go-pcap/gnet/sip"
+	_ "github.com/mel2oo/go-pcap/gnet/smb"
+	_ "github.com/mel2oo/go-pcap/gnet/syslog"
+	_ "github.com/mel2oo/go-pcap/gnet/telnet"
+	_ "github.com/mel2oo/go-pcap/gnet/tls"
+	_ "github.com/mel2oo/go-pcap/gnet/websocket"
+)
@@ -0,0 +1,130 @@
+package gnet
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identifies the kind of suspicious activity that a ThreatAnnotation reports.
+type ThreatKind string
+
+const (
+	// Echo traffic whose size, rate or asymmetry suggests data is being
+	// tunnelled through ICMP.
+	ICMPTunnelThreat ThreatKind = "ICMP_TUNNEL"
+
+	// DNS queries whose names look like encoded data rather than hostnames.
+	DNSTunnelThreat ThreatKind = "DNS_TUNNEL"
+
+	// Connections to the same destination opened at suspiciously regular
+	// intervals.
+	BeaconThreat ThreatKind = "BEACON"
+)
+
+// Represents a heuristic finding produced by analysing a sequence of
+// NetTraffic, rather than by parsing a single message.
+type ThreatAnnotation struct {
+	Kind ThreatKind
+
+	// Confidence in the finding, between 0 and 1.
+	Score float64
+
+	// Human-readable explanations of the signals that contributed to Score.
+	Reasons []string
+
+	// The endpoints involved. SrcIP is the host suspected of initiating the
+	// covert channel. DstPort is zero for protocols without ports.
+	SrcIP   net.IP
+	DstIP   net.IP
+	DstPort int
+
+	// The registrable domain, one label below its public suffix, under which
+	// tunnelled names were seen, for DNSTunnelThreat.
+	Domain string
+}
+
+var _ ParsedNetworkContent = (*ThreatAnnotation)(nil)
+
+func (ThreatAnnotation) ReleaseBuffers() {}
+
+// Represents a destination that a host connects to the way malware calls back
+// to its command-and-control server: at regular intervals, exchanging much the
+// same amount of data each time, often with an unusual TLS client.
+type BeaconSuspicion struct {
+	// The host making the connections, and the destination.
+	SrcIP   net.IP
+	DstIP   net.IP
+	DstPort int
+
+	// The TLS server name of the latest connection, if any.
+	ServerName string
+
+	// The number of connections scored.
+	Connections int
+
+	// The mean time between the starts of connections, and its coefficient of
+	// variation: 0 for perfectly regular connections.
+	Interval       time.Duration
+	IntervalJitter float64
+
+	// The mean bytes exchanged per connection, in both directions, and its
+	// coefficient of variation.
+	MeanBytes  int64
+	SizeJitter float64
+
+	// The JA3 hash of the latest TLS client hello, if any, and the fraction
+	// of the TLS clients seen that used it.
+	JA3           string
+	JA3Prevalence float64
+
+	// Confidence in the finding, between 0 and 1.
+	Score float64
+
+	// Human-readable explanations of the signals that contributed to Score.
+	Reasons []string
+}
+
+var _ ParsedNetworkContent = BeaconSuspicion{}
+
+func (BeaconSuspicion) ReleaseBuffers() {}
+
+// Identifies the kind of secret that a SecurityFinding reports.
+type FindingCategory string
+
+const (
+	// A username and password, or a password alone, sent in cleartext.
+	CredentialFinding FindingCategory = "CREDENTIAL"
+
+	// A key for a third-party API, recognized by its format or by the header
+	// carrying it.
+	APIKeyFinding FindingCategory = "API_KEY"
+
+	// A bearer token, such as a JWT.
+	TokenFinding FindingCategory = "TOKEN"
+)
+
+// Represents a secret seen in parsed content.
+type SecurityFinding struct {
+	ConnectionID uuid.UUID
+
+	Category FindingCategory
+
+	// What was found, e.g. "HTTP Basic", "FTP", "AWS access key" or "JWT".
+	Type string
+
+	// Where it was found, e.g. "header Authorization", "request body" or
+	// "command PASS".
+	Location string
+
+	// The user the secret belongs to, if known.
+	Username string
+
+	// The secret, masked unless the detector was told to reveal secrets.
+	Secret string
+}
+
+var _ ParsedNetworkContent = SecurityFinding{}
+
+func (SecurityFinding) ReleaseBuffers() {}
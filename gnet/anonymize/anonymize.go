@@ -0,0 +1,327 @@
+// Package anonymize rewrites parsed traffic so that it can be shared without
+// exposing the hosts it was captured from. Addresses and names are replaced
+// consistently, so that the same input always maps to the same output under
+// the same key, across all the places it appears: endpoints, DNS answers, TLS
+// server names, and so on.
+//
+// IP addresses are anonymized with Crypto-PAn, which preserves prefixes: two
+// addresses sharing an n-bit prefix share an n-bit prefix once anonymized, so
+// subnets remain recognizable. MAC addresses keep their multicast and locally
+// administered bits, and host names keep their top-level domain and number of
+// labels.
+//
+// Raw payloads cannot be rewritten, so they are dropped. Message bodies and
+// other free-form content are left as they are.
+package anonymize
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// The length of keys passed to New.
+const KeySize = 32
+
+// Labels of anonymized host names are this many bytes of hash.
+const labelHashSize = 5
+
+var labelEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Anonymizer anonymizes traffic with a secret key. Safe for concurrent use.
+type Anonymizer struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+
+	// Keys hashing of MAC addresses and names.
+	hashKey []byte
+}
+
+// Creates an Anonymizer from a key of KeySize bytes. The first half keys the
+// encryption of IP addresses and the second half seeds it, as in Crypto-PAn.
+// Anonymizing the same traffic with the same key gives the same result.
+func New(key []byte) (*Anonymizer, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("anonymization key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cipher")
+	}
+	a := &Anonymizer{block: block}
+	block.Encrypt(a.pad[:], key[16:])
+
+	h := sha256.Sum256(key)
+	a.hashKey = h[:]
+	return a, nil
+}
+
+// Returns the anonymized form of ip. IPv4 addresses stay IPv4 addresses, in
+// their 4-byte form.
+func (a *Anonymizer) IP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	} else if len(ip) != net.IPv6len {
+		return ip
+	}
+
+	// Bit i of the result is bit i of ip flipped by the first bit of the
+	// encryption of ip's first i bits, padded with the rest of the pad.
+	out := make(net.IP, len(ip))
+	var in, enc [aes.BlockSize]byte
+	for i := 0; i < len(ip)*8; i++ {
+		n, rem := i/8, uint(i%8)
+		copy(in[:], a.pad[:])
+		copy(in[:n], ip[:n])
+		mask := byte(0xff) << (8 - rem)
+		in[n] = ip[n]&mask | a.pad[n]&^mask
+
+		a.block.Encrypt(enc[:], in[:])
+		bit := ip[n]>>(7-rem)&1 ^ enc[0]>>7
+		out[n] |= bit << (7 - rem)
+	}
+	return out
+}
+
+// Returns the anonymized form of mac. The broadcast address is kept as is, as
+// are the multicast and locally administered bits of others.
+func (a *Anonymizer) MAC(mac net.HardwareAddr) net.HardwareAddr {
+	if len(mac) == 0 || bytes.Equal(mac, layers.EthernetBroadcast) {
+		return mac
+	}
+	sum := a.hash(mac)
+	out := make(net.HardwareAddr, len(mac))
+	copy(out, sum)
+	out[0] = out[0]&^0x03 | mac[0]&0x03
+	return out
+}
+
+// Returns the anonymized form of a host name. Each label but the last is
+// replaced by a hash, so that names in the same domain stay in the same
+// domain. A trailing dot is kept.
+func (a *Anonymizer) Hostname(name string) string {
+	if name == "" {
+		return name
+	}
+	trimmed := strings.TrimSuffix(name, ".")
+	labels := strings.Split(strings.ToLower(trimmed), ".")
+	if len(labels) < 2 {
+		labels = append(labels, "")
+	}
+
+	// Labels are hashed along with their parent domain, so that the same
+	// label under different domains is not recognizable.
+	for i := len(labels) - 2; i >= 0; i-- {
+		parent := strings.Join(labels[i:], ".")
+		labels[i] = strings.ToLower(labelEncoding.EncodeToString(a.hash([]byte(parent))[:labelHashSize]))
+	}
+	if labels[len(labels)-1] == "" {
+		labels = labels[:len(labels)-1]
+	}
+
+	result := strings.Join(labels, ".")
+	if trimmed != name {
+		result += "."
+	}
+	return result
+}
+
+func (a *Anonymizer) hash(b []byte) []byte {
+	m := hmac.New(sha256.New, a.hashKey)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+// Returns an anonymized copy of t. The payload is dropped.
+func (a *Anonymizer) Traffic(t gnet.NetTraffic) gnet.NetTraffic {
+	t.SrcIP = a.IP(t.SrcIP)
+	t.DstIP = a.IP(t.DstIP)
+	t.Payload = nil
+	if len(t.Tunnels) > 0 {
+		tunnels := make([]gnet.Tunnel, len(t.Tunnels))
+		for i, tun := range t.Tunnels {
+			tun.SrcIP = a.IP(tun.SrcIP)
+			tun.DstIP = a.IP(tun.DstIP)
+			tunnels[i] = tun
+		}
+		t.Tunnels = tunnels
+	}
+	t.Content = a.content(t.Content)
+	return t
+}
+
+// Run passes through all traffic from in, anonymized.
+func (a *Anonymizer) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			out <- a.Traffic(t)
+		}
+	}()
+	return out
+}
+
+func (a *Anonymizer) content(c gnet.ParsedNetworkContent) gnet.ParsedNetworkContent {
+	switch c := c.(type) {
+	case gnet.DNSRequest:
+		return a.dns(c)
+	case gnet.HTTPRequest:
+		return a.httpRequest(c)
+	case gnet.HTTPExchange:
+		if c.Request != nil {
+			r := a.httpRequest(*c.Request)
+			c.Request = &r
+		}
+		return c
+	case gnet.TLSClientHello:
+		c.ServerName = a.Hostname(c.ServerName)
+		return c
+	case gnet.TLSHandshakeMetadata:
+		if c.SNIHostname != nil {
+			name := a.Hostname(*c.SNIHostname)
+			c.SNIHostname = &name
+		}
+		return c
+	case gnet.QUICHandshakeMetadata:
+		c.ServerName = a.Hostname(c.ServerName)
+		if c.ClientHello != nil {
+			hello := *c.ClientHello
+			hello.ServerName = a.Hostname(hello.ServerName)
+			c.ClientHello = &hello
+		}
+		return c
+	case gnet.ARP:
+		c.SenderMAC = a.MAC(c.SenderMAC)
+		c.SenderIP = a.IP(c.SenderIP)
+		c.TargetMAC = a.MAC(c.TargetMAC)
+		c.TargetIP = a.IP(c.TargetIP)
+		return c
+	case gnet.NDP:
+		c.TargetIP = a.IP(c.TargetIP)
+		c.SourceMAC = a.MAC(c.SourceMAC)
+		c.TargetMAC = a.MAC(c.TargetMAC)
+		return c
+	case gnet.DHCPMessage:
+		c.ClientMAC = a.MAC(c.ClientMAC)
+		c.RequestedIP = a.IP(c.RequestedIP)
+		c.AssignedIP = a.IP(c.AssignedIP)
+		c.ServerID = a.IP(c.ServerID)
+		c.Hostname = a.Hostname(c.Hostname)
+		return c
+	case gnet.ICMPv4:
+		c.Original = a.icmpOriginal(c.Original)
+		return c
+	case gnet.ICMPv6:
+		c.Original = a.icmpOriginal(c.Original)
+		return c
+	}
+	return c
+}
+
+func (a *Anonymizer) icmpOriginal(o *gnet.ICMPOriginal) *gnet.ICMPOriginal {
+	if o == nil {
+		return nil
+	}
+	copied := *o
+	copied.SrcIP = a.IP(o.SrcIP)
+	copied.DstIP = a.IP(o.DstIP)
+	return &copied
+}
+
+// Anonymizes the host of a request, wherever it appears.
+func (a *Anonymizer) httpRequest(r gnet.HTTPRequest) gnet.HTTPRequest {
+	r.Host = a.host(r.Host)
+	if r.URL != nil {
+		u := *r.URL
+		u.Host = a.host(u.Host)
+		r.URL = &u
+	}
+	if h := r.Header.Get("Host"); h != "" {
+		r.Header = r.Header.Clone()
+		r.Header.Set("Host", a.host(h))
+	}
+	return r
+}
+
+// Anonymizes a host with an optional port, which may be a name or an IP
+// address.
+func (a *Anonymizer) host(hostport string) string {
+	if hostport == "" {
+		return hostport
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, ""
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(host); ip != nil {
+		host = a.IP(ip).String()
+	} else {
+		host = a.Hostname(host)
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func (a *Anonymizer) dns(d gnet.DNSRequest) gnet.DNSRequest {
+	if len(d.Questions) > 0 {
+		questions := make([]layers.DNSQuestion, len(d.Questions))
+		for i, q := range d.Questions {
+			q.Name = a.name(q.Name)
+			questions[i] = q
+		}
+		d.Questions = questions
+	}
+	d.Answers = a.records(d.Answers)
+	d.Authorities = a.records(d.Authorities)
+	d.Additionals = a.records(d.Additionals)
+	return d
+}
+
+func (a *Anonymizer) records(rrs []layers.DNSResourceRecord) []layers.DNSResourceRecord {
+	if len(rrs) == 0 {
+		return rrs
+	}
+	out := make([]layers.DNSResourceRecord, len(rrs))
+	for i, rr := range rrs {
+		rr.Name = a.name(rr.Name)
+		rr.IP = a.IP(rr.IP)
+		rr.NS = a.name(rr.NS)
+		rr.CNAME = a.name(rr.CNAME)
+		rr.PTR = a.name(rr.PTR)
+		rr.MX.Name = a.name(rr.MX.Name)
+		rr.SRV.Name = a.name(rr.SRV.Name)
+		rr.SOA.MName = a.name(rr.SOA.MName)
+		rr.SOA.RName = a.name(rr.SOA.RName)
+		// Record data is also kept in raw form.
+		rr.Data = nil
+		out[i] = rr
+	}
+	return out
+}
+
+func (a *Anonymizer) name(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	return []byte(a.Hostname(string(b)))
+}
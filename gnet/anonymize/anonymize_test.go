@@ -0,0 +1,101 @@
+package anonymize
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func newAnonymizer(t *testing.T) *Anonymizer {
+	a, err := New([]byte("0123456789abcdef0123456789abcdef"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return a
+}
+
+// Returns the number of leading bits a and b have in common.
+func commonPrefix(a, b net.IP) int {
+	for i := 0; i < len(a)*8; i++ {
+		if a[i/8]>>(7-i%8)&1 != b[i/8]>>(7-i%8)&1 {
+			return i
+		}
+	}
+	return len(a) * 8
+}
+
+func TestIPPreservesPrefixes(t *testing.T) {
+	a := newAnonymizer(t)
+
+	for _, pair := range [][2]string{
+		{"192.168.1.10", "192.168.1.20"},
+		{"10.0.0.1", "10.255.0.1"},
+		{"2001:db8::1", "2001:db8:0:1::1"},
+	} {
+		x, y := net.ParseIP(pair[0]), net.ParseIP(pair[1])
+		ax, ay := a.IP(x), a.IP(y)
+		if v4 := x.To4(); v4 != nil {
+			x, y = v4, y.To4()
+			assert.Len(t, ax, net.IPv4len)
+		}
+		assert.NotEqual(t, x, ax)
+		assert.Equal(t, commonPrefix(x, y), commonPrefix(ax, ay), pair)
+	}
+
+	// The same address maps to the same result in either form.
+	assert.Equal(t, a.IP(net.IPv4(1, 2, 3, 4)), a.IP(net.IP{1, 2, 3, 4}))
+}
+
+func TestHostname(t *testing.T) {
+	a := newAnonymizer(t)
+
+	www, api := a.Hostname("www.Example.com"), a.Hostname("api.example.com.")
+	assert.Equal(t, www, a.Hostname("www.example.com"))
+	assert.Regexp(t, `^[a-z2-7]{8}\.[a-z2-7]{8}\.com$`, www)
+	assert.Regexp(t, `^[a-z2-7]{8}\.[a-z2-7]{8}\.com\.$`, api)
+
+	// Names in the same domain stay in the same domain.
+	assert.Equal(t, www[9:], api[9:len(api)-1])
+}
+
+func TestMAC(t *testing.T) {
+	a := newAnonymizer(t)
+
+	mac := net.HardwareAddr{0x02, 0x11, 0x22, 0x33, 0x44, 0x55}
+	anon := a.MAC(mac)
+	assert.NotEqual(t, mac, anon)
+	assert.Equal(t, mac[0]&0x03, anon[0]&0x03)
+	assert.Equal(t, net.HardwareAddr(layers.EthernetBroadcast), a.MAC(layers.EthernetBroadcast))
+}
+
+func TestTrafficIsConsistent(t *testing.T) {
+	a := newAnonymizer(t)
+	server := net.IP{93, 184, 216, 34}
+
+	dns := a.Traffic(gnet.NetTraffic{
+		SrcIP:   server,
+		Payload: []byte("raw"),
+		Content: gnet.DNSRequest{
+			Questions: []layers.DNSQuestion{{Name: []byte("example.com")}},
+			Answers: []layers.DNSResourceRecord{{
+				Name: []byte("example.com"),
+				Type: layers.DNSTypeA,
+				IP:   server,
+			}},
+		},
+	})
+	assert.Nil(t, dns.Payload)
+	answer := dns.Content.(gnet.DNSRequest).Answers[0]
+	assert.Equal(t, dns.SrcIP, answer.IP)
+
+	hello := a.Traffic(gnet.NetTraffic{
+		DstIP:   server,
+		Content: gnet.TLSClientHello{ServerName: "example.com"},
+	})
+	assert.Equal(t, dns.SrcIP, hello.DstIP)
+	assert.Equal(t, string(answer.Name), hello.Content.(gnet.TLSClientHello).ServerName)
+}
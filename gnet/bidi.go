@@ -0,0 +1,65 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// The direction of data on a TCP connection parsed by a TCPBidiParser. The
+// client is the sender of the SYN, or, if the handshake was missed, of the
+// first packet seen.
+type FlowDirection int
+
+const (
+	ClientToServer FlowDirection = iota
+	ServerToClient
+)
+
+func (d FlowDirection) Reverse() FlowDirection {
+	if d == ClientToServer {
+		return ServerToClient
+	}
+	return ClientToServer
+}
+
+func (d FlowDirection) String() string {
+	if d == ClientToServer {
+		return "client to server"
+	}
+	return "server to client"
+}
+
+// TCPBidiParserFactory is implemented by factories for protocols that cannot
+// be parsed one direction at a time, e.g. because what a message means depends
+// on the messages sent the other way. When such a factory accepts the data of
+// either direction of a connection, a single parser it creates receives the
+// data of both directions from then on, and no other parser is used for the
+// connection.
+type TCPBidiParserFactory interface {
+	TCPParserFactory
+
+	CreateBidiParser(id uuid.UUID) TCPBidiParser
+}
+
+// TCPBidiParser parses both directions of a TCP connection. Unlike TCPParser,
+// it is used for the rest of the connection, and buffers any data it needs to
+// keep.
+type TCPBidiParser interface {
+	Name() string
+
+	// Consumes the next data sent in direction dir, and returns the content
+	// completed by it, in either direction. isEnd is true once no more data is
+	// forthcoming in dir, with empty input.
+	//
+	// An error ends the use of the parser. Other parsers are selected for the
+	// data of the connection from then on.
+	Parse(dir FlowDirection, input memview.MemView, isEnd bool) ([]BidiResult, error)
+}
+
+// Content parsed by a TCPBidiParser, and the direction of the data it was
+// parsed from.
+type BidiResult struct {
+	Dir     FlowDirection
+	Content ParsedNetworkContent
+}
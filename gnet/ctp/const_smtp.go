@@ -1,5 +1,7 @@
 package ctp
 
+import "strings"
+
 // SMTP COMMANDS
 const (
 	SmtpEhlo CMD = "EHLO"
@@ -39,3 +41,17 @@ func CheckSmtpCMD(b []byte) bool {
 	}
 	return false
 }
+
+var (
+	crlf = []byte("\r\n")
+
+	// Ends the message sent after DATA: a line holding a single dot.
+	smtpDataTerminator = []byte("\r\n.\r\n")
+)
+
+// Messages longer than this are dropped rather than buffered.
+const maxSmtpMessageLengthBytes int64 = 32 * 1024 * 1024
+
+func isSmtpData(cmd string) bool {
+	return strings.EqualFold(cmd, string(SmtpData))
+}
@@ -22,6 +22,11 @@ func newCtpResponseParser(bidiID uuid.UUID) *ctpResponseParser {
 
 type ctpRequestParser struct {
 	connectionID uuid.UUID
+
+	// Set once an SMTP DATA command is seen, after which input is buffered
+	// until the end of the message.
+	data     bool
+	allInput memview.MemView
 }
 
 var _ gnet.TCPParser = (*ctpRequestParser)(nil)
@@ -31,19 +36,20 @@ func (*ctpRequestParser) Name() string {
 }
 
 func (p *ctpRequestParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	if p.data {
+		return p.parseData(input, isEnd)
+	}
+
 	// request cmd
 	data := input.Bytes()
-	i := bytes.Index(data, []byte{0x20})
-	var cmd, arg string
-	if i == -1 {
-		cmd = string(getRequestArg(data))
-	} else {
-		cmd = string(data[:i])
-		arg = string(getRequestArg(data[i+1:]))
-	}
+	cmd, arg := splitRequestLine(getRequestArg(data))
 	if cmd == "" {
 		return
 	}
+	if isSmtpData(cmd) {
+		p.data = true
+		return p.parseData(input, isEnd)
+	}
 	result = gnet.FtpSmtpRequest{
 		ConnectionID: p.connectionID,
 		CMD:          cmd,
@@ -52,6 +58,35 @@ func (p *ctpRequestParser) Parse(input memview.MemView, isEnd bool) (result gnet
 	return
 }
 
+// Buffers the DATA command and the message that follows it, up to and
+// including the line holding a single dot.
+func (p *ctpRequestParser) parseData(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	p.allInput.Append(input)
+	totalBytesConsumed = p.allInput.Len()
+
+	// The message starts after the command line. Search for the terminator
+	// from the command line's CRLF, so that an empty message is found.
+	start := p.allInput.Index(0, crlf)
+	if start >= 0 {
+		if end := p.allInput.Index(start, smtpDataTerminator); end >= 0 {
+			msg := parseSMTPMessage(p.allInput.SubView(start+int64(len(crlf)), end+int64(len(crlf))).Bytes())
+			msg.ConnectionID = p.connectionID
+
+			consumed := end + int64(len(smtpDataTerminator))
+			unused = p.allInput.SubView(consumed, p.allInput.Len())
+			return msg, unused, consumed, nil
+		}
+	}
+
+	if p.allInput.Len() > maxSmtpMessageLengthBytes {
+		return nil, memview.MemView{}, totalBytesConsumed, errors.New("SMTP message too long")
+	}
+	if isEnd {
+		return nil, memview.MemView{}, totalBytesConsumed, errors.New("incomplete SMTP message")
+	}
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
 type ctpResponseParser struct {
 	connectionID uuid.UUID
 }
@@ -81,6 +116,15 @@ func (p *ctpResponseParser) Parse(input memview.MemView, isEnd bool) (result gne
 	return
 }
 
+// Splits a request line into its command and argument.
+func splitRequestLine(line []byte) (cmd, arg string) {
+	i := bytes.IndexByte(line, 0x20)
+	if i == -1 {
+		return string(line), ""
+	}
+	return string(line[:i]), string(line[i+1:])
+}
+
 func getRequestArg(data []byte) []byte {
 	i := bytes.Index(data, []byte{0x0d, 0x0a})
 	if i == -1 {
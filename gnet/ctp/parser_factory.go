@@ -1,8 +1,6 @@
 package ctp
 
 import (
-	"bytes"
-
 	"github.com/google/gopacket/reassembly"
 	"github.com/google/uuid"
 	"github.com/mel2oo/go-pcap/gnet"
@@ -62,17 +60,15 @@ func (*ctpRequestParserFactory) accepts(input memview.MemView) (decision gnet.Ac
 	}
 
 	data := input.Bytes()
-	i := bytes.Index(data, []byte{0x20})
-	var cmd []byte
-	if i == -1 {
-		cmd = getRequestArg(data)
-	} else {
-		cmd = data[:i]
-	}
+	cmd, _ := splitRequestLine(getRequestArg(data))
 	// match request cmd
-	if !CheckRequestCMD(cmd) {
+	if !CheckRequestCMD([]byte(cmd)) {
 		return gnet.Reject, 0
 	}
+	// The message after DATA may already follow the command.
+	if isSmtpData(cmd) {
+		return gnet.Accept, 0
+	}
 	// match end
 	length := len(data)
 	if data[length-2] != 0x0d || data[length-1] != 0x0a {
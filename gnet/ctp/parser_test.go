@@ -0,0 +1,83 @@
+package ctp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob@example.com, Carol <carol@example.com>\r\n" +
+	"Subject: =?UTF-8?B?UmVwb3J0?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"See attached.\r\n" +
+	"..and a stuffed line.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\n" +
+	"LjQK\r\n" +
+	"--b1--\r\n"
+
+func TestSMTPData(t *testing.T) {
+	f := NewCtpRequestParserFactory()
+	decision, _ := f.Accepts(memview.New([]byte("DATA\r\n")), false)
+	assert.Equal(t, gnet.Accept, decision)
+
+	p := f.CreateParser(uuid.New(), 0, 0)
+	result, _, _, err := p.Parse(memview.New([]byte("DATA\r\n")), false)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, _, _, err = p.Parse(memview.New([]byte(testMessage[:100])), false)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, unused, consumed, err := p.Parse(memview.New([]byte(testMessage[100:]+".\r\nQUIT\r\n")), false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "QUIT\r\n", unused.String())
+	assert.Equal(t, int64(len("DATA\r\n")+len(testMessage)+len(".\r\n")), consumed)
+
+	msg := result.(gnet.SMTPMessage)
+	assert.Equal(t, "Alice <alice@example.com>", msg.From)
+	assert.Equal(t, []string{"bob@example.com", "carol@example.com"}, msg.To)
+	assert.Equal(t, "Report", msg.Subject)
+	assert.Equal(t, "multipart/mixed", msg.ContentType)
+	assert.Equal(t, "See attached.\r\n.and a stuffed line.", msg.Text)
+
+	sum := sha256.Sum256([]byte("%PDF-1.4\n"))
+	assert.Equal(t, []gnet.SMTPAttachment{{
+		Filename:    "report.pdf",
+		ContentType: "application/pdf",
+		Size:        9,
+		SHA256:      hex.EncodeToString(sum[:]),
+	}}, msg.Attachments)
+}
+
+func TestSMTPEmptyData(t *testing.T) {
+	p := newCtpRequestParser(uuid.New())
+	result, unused, _, err := p.Parse(memview.New([]byte("DATA\r\n.\r\n")), false)
+	if assert.NoError(t, err) {
+		assert.Empty(t, result.(gnet.SMTPMessage).Data)
+		assert.Equal(t, int64(0), unused.Len())
+	}
+
+	p = newCtpRequestParser(uuid.New())
+	_, _, _, err = p.Parse(memview.New([]byte("DATA\r\nSubject: x\r\n")), true)
+	assert.Error(t, err)
+}
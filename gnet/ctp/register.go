@@ -0,0 +1,15 @@
+package ctp
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("ctp", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{
+			NewCtpRequestParserFactory(),
+			NewCtpResponseParserFactory(),
+		}
+	}, gnet.TextTCPParserPriority)
+}
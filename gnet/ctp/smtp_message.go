@@ -0,0 +1,184 @@
+package ctp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Limits the nesting of multipart bodies that are searched for attachments.
+const maxMimeDepth = 8
+
+// Parses a message sent after DATA, which still carries its dot-stuffing.
+// Header and MIME errors are tolerated; whatever could be parsed is returned.
+func parseSMTPMessage(data []byte) gnet.SMTPMessage {
+	data = unstuffDots(data)
+	msg := gnet.SMTPMessage{
+		Data: data,
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return msg
+	}
+
+	msg.From = m.Header.Get("From")
+	msg.To = addressList(m.Header, "To")
+	msg.Cc = addressList(m.Header, "Cc")
+	msg.Subject = decodeHeader(m.Header.Get("Subject"))
+	msg.Date = m.Header.Get("Date")
+	msg.MessageID = m.Header.Get("Message-Id")
+
+	msg.ContentType = "text/plain"
+	if mediaType, _, err := mime.ParseMediaType(m.Header.Get("Content-Type")); err == nil {
+		msg.ContentType = mediaType
+	}
+
+	walkMimePart(m.Header.Get("Content-Type"), m.Header.Get("Content-Disposition"),
+		m.Header.Get("Content-Transfer-Encoding"), m.Body, 0, func(leaf mimeLeaf) {
+			if leaf.attachment {
+				sum := sha256.Sum256(leaf.content)
+				msg.Attachments = append(msg.Attachments, gnet.SMTPAttachment{
+					Filename:    leaf.filename,
+					ContentType: leaf.mediaType,
+					Size:        int64(len(leaf.content)),
+					SHA256:      hex.EncodeToString(sum[:]),
+				})
+			} else if leaf.mediaType == "text/plain" && msg.Text == "" {
+				msg.Text = string(leaf.content)
+			}
+		})
+	return msg
+}
+
+// WalkAttachments calls fn with the filename, media type and decoded content
+// of each attachment of a message, as in gnet.SMTPMessage.Data.
+func WalkAttachments(data []byte, fn func(filename, contentType string, content []byte)) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	walkMimePart(m.Header.Get("Content-Type"), m.Header.Get("Content-Disposition"),
+		m.Header.Get("Content-Transfer-Encoding"), m.Body, 0, func(leaf mimeLeaf) {
+			if leaf.attachment {
+				fn(leaf.filename, leaf.mediaType, leaf.content)
+			}
+		})
+}
+
+// A MIME part that is not multipart, with its content decoded.
+type mimeLeaf struct {
+	mediaType  string
+	filename   string
+	attachment bool
+	content    []byte
+}
+
+// Calls visit with each part of a MIME body that is not multipart, descending
+// into multipart bodies.
+func walkMimePart(contentType, disposition, encoding string, body io.Reader, depth int, visit func(mimeLeaf)) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMimeDepth || params["boundary"] == "" {
+			return
+		}
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextRawPart()
+			if err != nil {
+				return
+			}
+			walkMimePart(part.Header.Get("Content-Type"), part.Header.Get("Content-Disposition"),
+				part.Header.Get("Content-Transfer-Encoding"), part, depth+1, visit)
+		}
+	}
+
+	content, err := io.ReadAll(decodeTransferEncoding(encoding, body))
+	if err != nil {
+		return
+	}
+
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	visit(mimeLeaf{
+		mediaType:  mediaType,
+		filename:   decodeHeader(filename),
+		attachment: dispositionType == "attachment" || filename != "",
+		content:    content,
+	})
+}
+
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// Returns the addresses in a header field, falling back to the raw value if
+// it can't be parsed.
+func addressList(h mail.Header, key string) []string {
+	if h.Get(key) == "" {
+		return nil
+	}
+	addrs, err := h.AddressList(key)
+	if err != nil {
+		return []string{h.Get(key)}
+	}
+	result := make([]string, len(addrs))
+	for i, a := range addrs {
+		result[i] = a.Address
+	}
+	return result
+}
+
+// Decodes RFC 2047 encoded-words, such as =?UTF-8?B?...?=.
+func decodeHeader(s string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(s)
+	if err != nil {
+		return s
+	}
+	return decoded
+}
+
+// Removes the extra dot that SMTP adds to lines starting with a dot.
+func unstuffDots(data []byte) []byte {
+	if !bytes.Contains(data, []byte("\n..")) && !bytes.HasPrefix(data, []byte("..")) {
+		return data
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		data = data[len(line):]
+		if bytes.HasPrefix(line, []byte("..")) {
+			line = line[1:]
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,168 @@
+package gnet
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Represents a DHCPv4 or DHCPv6 message.
+type DHCPMessage struct {
+	// 4 for DHCPv4, 6 for DHCPv6.
+	Version int
+
+	// e.g. "Discover" or "Ack" for DHCPv4, "Solicit" or "Reply" for DHCPv6.
+	MessageType string
+
+	TransactionID uint32
+
+	// Hardware address of the client. For DHCPv6, taken from the client's DUID
+	// if it is link-layer based.
+	ClientMAC net.HardwareAddr
+
+	// The address the client asked for: option 50 for DHCPv4, or the IA_NA
+	// address in a DHCPv6 client message.
+	RequestedIP net.IP
+
+	// The address offered or assigned by the server: yiaddr for DHCPv4, or the
+	// IA_NA address in a DHCPv6 server message.
+	AssignedIP net.IP
+
+	// Server identifier, option 54. DHCPv4 only.
+	ServerID net.IP
+
+	// Option 12 for DHCPv4, or the Client FQDN option for DHCPv6.
+	Hostname string
+
+	// Option 51 for DHCPv4, or the valid lifetime of the IA_NA address for
+	// DHCPv6.
+	LeaseTime time.Duration
+}
+
+var _ ParsedNetworkContent = (*DHCPMessage)(nil)
+
+func (DHCPMessage) ReleaseBuffers() {}
+
+func FromDHCPv4(l *layers.DHCPv4) DHCPMessage {
+	m := DHCPMessage{
+		Version:       4,
+		TransactionID: l.Xid,
+		ClientMAC:     l.ClientHWAddr,
+	}
+	if ip := l.YourClientIP; ip != nil && !ip.IsUnspecified() {
+		m.AssignedIP = ip
+	}
+
+	for _, o := range l.Options {
+		switch o.Type {
+		case layers.DHCPOptMessageType:
+			if len(o.Data) == 1 {
+				m.MessageType = layers.DHCPMsgType(o.Data[0]).String()
+			}
+		case layers.DHCPOptRequestIP:
+			if len(o.Data) == 4 {
+				m.RequestedIP = net.IP(o.Data)
+			}
+		case layers.DHCPOptServerID:
+			if len(o.Data) == 4 {
+				m.ServerID = net.IP(o.Data)
+			}
+		case layers.DHCPOptHostname:
+			m.Hostname = string(o.Data)
+		case layers.DHCPOptLeaseTime:
+			if len(o.Data) == 4 {
+				m.LeaseTime = time.Duration(binary.BigEndian.Uint32(o.Data)) * time.Second
+			}
+		}
+	}
+
+	return m
+}
+
+func FromDHCPv6(l *layers.DHCPv6) DHCPMessage {
+	m := DHCPMessage{
+		Version:     6,
+		MessageType: l.MsgType.String(),
+	}
+	for _, b := range l.TransactionID {
+		m.TransactionID = m.TransactionID<<8 | uint32(b)
+	}
+
+	fromServer := false
+	switch l.MsgType {
+	case layers.DHCPv6MsgTypeAdvertise, layers.DHCPv6MsgTypeReply, layers.DHCPv6MsgTypeReconfigure:
+		fromServer = true
+	}
+
+	for _, o := range l.Options {
+		switch o.Code {
+		case layers.DHCPv6OptClientID:
+			var duid layers.DHCPv6DUID
+			if err := duid.DecodeFromBytes(o.Data); err == nil && len(duid.LinkLayerAddress) > 0 {
+				m.ClientMAC = duid.LinkLayerAddress
+			}
+		case layers.DHCPv6OptIANA:
+			addr, valid := dhcpv6IANAAddress(o.Data)
+			if addr == nil {
+				continue
+			}
+			if fromServer {
+				m.AssignedIP = addr
+				m.LeaseTime = valid
+			} else {
+				m.RequestedIP = addr
+			}
+		case layers.DHCPv6OptClientFQDN:
+			// A flags byte followed by a domain name in DNS wire format.
+			if len(o.Data) > 1 {
+				m.Hostname = dnsWireName(o.Data[1:])
+			}
+		}
+	}
+
+	return m
+}
+
+// Returns the first address in an IA_NA option and its valid lifetime.
+func dhcpv6IANAAddress(data []byte) (net.IP, time.Duration) {
+	// IAID, T1 and T2 precede the IA_NA options.
+	const ianaHeaderLength = 12
+	if len(data) < ianaHeaderLength {
+		return nil, 0
+	}
+
+	opts := data[ianaHeaderLength:]
+	for len(opts) >= 4 {
+		code := layers.DHCPv6Opt(binary.BigEndian.Uint16(opts))
+		length := int(binary.BigEndian.Uint16(opts[2:]))
+		if len(opts) < 4+length {
+			break
+		}
+		body := opts[4 : 4+length]
+		opts = opts[4+length:]
+
+		// An address, preferred lifetime and valid lifetime.
+		if code == layers.DHCPv6OptIAAddr && len(body) >= 24 {
+			return net.IP(body[:16]), time.Duration(binary.BigEndian.Uint32(body[20:])) * time.Second
+		}
+	}
+	return nil, 0
+}
+
+// Decodes a possibly unterminated domain name in DNS wire format, without
+// support for compression.
+func dnsWireName(data []byte) string {
+	var labels []string
+	for len(data) > 0 {
+		n := int(data[0])
+		if n == 0 || len(data) < 1+n {
+			break
+		}
+		labels = append(labels, string(data[1:1+n]))
+		data = data[1+n:]
+	}
+	return strings.Join(labels, ".")
+}
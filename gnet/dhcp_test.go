@@ -0,0 +1,60 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromDHCPv4(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	m := FromDHCPv4(&layers.DHCPv4{
+		Operation:    layers.DHCPOpRequest,
+		Xid:          0x3903f326,
+		ClientHWAddr: mac,
+		YourClientIP: net.IPv4zero,
+		Options: layers.DHCPOptions{
+			layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}),
+			layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{192, 168, 1, 100}),
+			layers.NewDHCPOption(layers.DHCPOptHostname, []byte("laptop")),
+			layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0, 0, 0x0e, 0x10}),
+		},
+	})
+
+	assert.Equal(t, 4, m.Version)
+	assert.Equal(t, "Request", m.MessageType)
+	assert.Equal(t, uint32(0x3903f326), m.TransactionID)
+	assert.Equal(t, mac, m.ClientMAC)
+	assert.True(t, m.RequestedIP.Equal(net.IP{192, 168, 1, 100}))
+	assert.Nil(t, m.AssignedIP)
+	assert.Equal(t, "laptop", m.Hostname)
+	assert.Equal(t, time.Hour, m.LeaseTime)
+}
+
+func TestFromDHCPv6(t *testing.T) {
+	addr := net.ParseIP("2001:db8::10")
+	iaAddr := append(append([]byte(nil), addr...), 0, 0, 0x0e, 0x10, 0, 0, 0x1c, 0x20)
+	iana := append(make([]byte, 12), 0, byte(layers.DHCPv6OptIAAddr), 0, byte(len(iaAddr)))
+	iana = append(iana, iaAddr...)
+
+	m := FromDHCPv6(&layers.DHCPv6{
+		MsgType:       layers.DHCPv6MsgTypeReply,
+		TransactionID: []byte{0x01, 0x02, 0x03},
+		Options: layers.DHCPv6Options{
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientID, []byte{0, 3, 0, 1, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55}),
+			layers.NewDHCPv6Option(layers.DHCPv6OptIANA, iana),
+			layers.NewDHCPv6Option(layers.DHCPv6OptClientFQDN, []byte("\x01\x06laptop\x07example\x03com\x00")),
+		},
+	})
+
+	assert.Equal(t, 6, m.Version)
+	assert.Equal(t, "Reply", m.MessageType)
+	assert.Equal(t, uint32(0x010203), m.TransactionID)
+	assert.Equal(t, net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, m.ClientMAC)
+	assert.True(t, m.AssignedIP.Equal(addr))
+	assert.Equal(t, 2*time.Hour, m.LeaseTime)
+	assert.Equal(t, "laptop.example.com", m.Hostname)
+}
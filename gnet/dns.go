@@ -0,0 +1,101 @@
+package gnet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Identifies a protocol that uses the DNS message format for name resolution.
+type NameResolutionProtocol string
+
+const (
+	DNSProtocol NameResolutionProtocol = "DNS"
+
+	// Multicast DNS (RFC 6762), UDP port 5353.
+	MDNSProtocol NameResolutionProtocol = "mDNS"
+
+	// Link-Local Multicast Name Resolution (RFC 4795), UDP port 5355.
+	LLMNRProtocol NameResolutionProtocol = "LLMNR"
+
+	// NetBIOS Name Service (RFC 1002), UDP port 137. Names in questions and
+	// answers are decoded from the NetBIOS first-level encoding into the
+	// conventional "NAME<XX>" form, where XX is the hex suffix byte.
+	NBNSProtocol NameResolutionProtocol = "NBNS"
+)
+
+// Converts a decoded DNS-format message into a DNSRequest.
+func FromDNS(l *layers.DNS, protocol NameResolutionProtocol) DNSRequest {
+	r := DNSRequest{
+		Protocol: protocol,
+
+		ID:     l.ID,
+		QR:     l.QR,
+		OpCode: l.OpCode,
+
+		AA: l.AA,
+		TC: l.TC,
+		RD: l.RD,
+		RA: l.RA,
+		Z:  l.Z,
+
+		ResponseCode: l.ResponseCode,
+		QDCount:      l.QDCount,
+		ANCount:      l.ANCount,
+		NSCount:      l.NSCount,
+		ARCount:      l.ARCount,
+
+		Questions:   l.Questions,
+		Answers:     l.Answers,
+		Authorities: l.Authorities,
+		Additionals: l.Additionals,
+	}
+
+	if protocol == NBNSProtocol {
+		for i := range r.Questions {
+			r.Questions[i].Name = decodeNetBIOSNameInPlace(r.Questions[i].Name)
+		}
+		for _, rrs := range [][]layers.DNSResourceRecord{r.Answers, r.Authorities, r.Additionals} {
+			for i := range rrs {
+				rrs[i].Name = decodeNetBIOSNameInPlace(rrs[i].Name)
+			}
+		}
+	}
+
+	return r
+}
+
+func decodeNetBIOSNameInPlace(encoded []byte) []byte {
+	if name, ok := DecodeNetBIOSName(encoded); ok {
+		return []byte(name)
+	}
+	return encoded
+}
+
+// Decodes a NetBIOS name from the first-level encoding of RFC 1001 Section
+// 14.1, in which each byte of the 16-byte name is split into two nibbles
+// stored as 'A'+nibble. A scope ID, if any, follows the encoded name after a
+// dot and is kept as is. Returns the name in "NAME<XX>" form, with padding
+// removed and XX being the suffix byte that identifies the service.
+func DecodeNetBIOSName(encoded []byte) (string, bool) {
+	label, scope := string(encoded), ""
+	if i := strings.IndexByte(label, '.'); i >= 0 {
+		label, scope = label[:i], label[i:]
+	}
+	if len(label) != 32 {
+		return "", false
+	}
+
+	var raw [16]byte
+	for i := range raw {
+		hi, lo := label[2*i]-'A', label[2*i+1]-'A'
+		if hi > 0xf || lo > 0xf {
+			return "", false
+		}
+		raw[i] = hi<<4 | lo
+	}
+
+	name := strings.TrimRight(string(raw[:15]), " ")
+	return fmt.Sprintf("%s<%02X>%s", name, raw[15], scope), true
+}
@@ -0,0 +1,202 @@
+package gnet
+
+import (
+	"container/list"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Default number of addresses a DNSNameCache remembers names for.
+const DefaultDNSCacheSize = 100000
+
+// The most names remembered for a single address, such as one shared by many
+// sites behind a CDN.
+const maxDNSNamesPerAddress = 16
+
+// Names are remembered for at least this long, whatever the TTL of the answer,
+// since clients often keep using addresses past their TTL.
+const MinDNSNameLifetime = 5 * time.Minute
+
+// DNSNameCache remembers the A, AAAA and CNAME records of DNS answers, and
+// annotates later traffic to or from the addresses they resolved to with the
+// names they resolved from. This names the endpoints of connections that carry
+// no name of their own, such as TLS without SNI.
+//
+// As with PairCollector, time is measured by observation times in the
+// traffic, so captures read from files are handled as if live.
+//
+// Safe for concurrent use.
+type DNSNameCache struct {
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // of *dnsCacheEntry, least recently answered first
+}
+
+type dnsCacheEntry struct {
+	// The address, as 16 bytes.
+	addr  string
+	names []dnsCacheName
+}
+
+type dnsCacheName struct {
+	name    string
+	expires time.Time
+}
+
+// Creates a DNSNameCache that remembers names for up to maxSize addresses. If
+// maxSize is not positive, DefaultDNSCacheSize is used.
+func NewDNSNameCache(maxSize int) *DNSNameCache {
+	if maxSize <= 0 {
+		maxSize = DefaultDNSCacheSize
+	}
+	return &DNSNameCache{
+		maxSize: maxSize,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Run passes through all traffic from in, annotated by Observe.
+func (c *DNSNameCache) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, 100)
+	go func() {
+		defer close(out)
+		for t := range in {
+			out <- c.Observe(t)
+		}
+	}()
+	return out
+}
+
+// Observe learns the names in t if it is a DNS answer, and otherwise returns t
+// with the DNSNames of its endpoints' Enrichment set from names learned
+// earlier.
+func (c *DNSNameCache) Observe(t NetTraffic) NetTraffic {
+	if d, ok := t.Content.(DNSRequest); ok {
+		if d.QR && d.ResponseCode == layers.DNSResponseCodeNoErr {
+			c.learn(d, t.ObservationTime)
+		}
+		return t
+	}
+
+	src := c.Names(t.SrcIP, t.ObservationTime)
+	dst := c.Names(t.DstIP, t.ObservationTime)
+	if len(src) == 0 && len(dst) == 0 {
+		return t
+	}
+
+	// The enrichment may be shared with other copies of the traffic.
+	var enrichment Enrichment
+	if t.Enrichment != nil {
+		enrichment = *t.Enrichment
+	}
+	withNames := func(info *EndpointInfo, names []string) *EndpointInfo {
+		if len(names) == 0 {
+			return info
+		}
+		var result EndpointInfo
+		if info != nil {
+			result = *info
+		}
+		result.DNSNames = names
+		return &result
+	}
+	enrichment.Src = withNames(enrichment.Src, src)
+	enrichment.Dst = withNames(enrichment.Dst, dst)
+	t.Enrichment = &enrichment
+	return t
+}
+
+// Returns the names that resolved to ip and had not expired at the given time,
+// most recently answered first. The name that was asked for comes before any
+// aliases it led to.
+func (c *DNSNameCache) Names(ip net.IP, at time.Time) []string {
+	if ip == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elt, ok := c.entries[string(ip.To16())]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, n := range elt.Value.(*dnsCacheEntry).names {
+		if !at.After(n.expires) {
+			names = append(names, n.name)
+		}
+	}
+	return names
+}
+
+func (c *DNSNameCache) learn(d DNSRequest, at time.Time) {
+	// Aliases by the name they are the target of, to follow CNAME chains back
+	// to the name that was asked for.
+	aliasOf := map[string]string{}
+	for _, rr := range d.Answers {
+		if rr.Type == layers.DNSTypeCNAME {
+			aliasOf[dnsName(rr.CNAME)] = dnsName(rr.Name)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rr := range d.Answers {
+		if rr.Type != layers.DNSTypeA && rr.Type != layers.DNSTypeAAAA || rr.IP == nil {
+			continue
+		}
+		lifetime := time.Duration(rr.TTL) * time.Second
+		if lifetime < MinDNSNameLifetime {
+			lifetime = MinDNSNameLifetime
+		}
+
+		// The chain from the record's name back to the name asked for,
+		// stopping at loops.
+		chain := []string{dnsName(rr.Name)}
+		seen := map[string]bool{chain[0]: true}
+		for name := aliasOf[chain[0]]; name != "" && !seen[name]; name = aliasOf[name] {
+			seen[name] = true
+			chain = append(chain, name)
+		}
+		for _, name := range chain {
+			c.add(rr.IP, name, at.Add(lifetime))
+		}
+	}
+}
+
+// Records that name resolved to ip, as its most recent name. Must be called
+// with mu held.
+func (c *DNSNameCache) add(ip net.IP, name string, expires time.Time) {
+	key := string(ip.To16())
+	elt, ok := c.entries[key]
+	if ok {
+		c.order.MoveToBack(elt)
+	} else {
+		if c.order.Len() >= c.maxSize {
+			oldest := c.order.Remove(c.order.Front()).(*dnsCacheEntry)
+			delete(c.entries, oldest.addr)
+		}
+		elt = c.order.PushBack(&dnsCacheEntry{addr: key})
+		c.entries[key] = elt
+	}
+
+	e := elt.Value.(*dnsCacheEntry)
+	names := []dnsCacheName{{name: name, expires: expires}}
+	for _, n := range e.names {
+		if n.name != name && len(names) < maxDNSNamesPerAddress {
+			names = append(names, n)
+		}
+	}
+	e.names = names
+}
+
+func dnsName(b []byte) string {
+	return strings.ToLower(strings.TrimSuffix(string(b), "."))
+}
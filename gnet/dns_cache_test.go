@@ -0,0 +1,52 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSNameCache(t *testing.T) {
+	c := NewDNSNameCache(1)
+	start := time.Unix(1700000000, 0)
+	server := net.IPv4(192, 0, 2, 10)
+
+	answer := NetTraffic{
+		ObservationTime: start,
+		Content: DNSRequest{
+			QR: true,
+			Answers: []layers.DNSResourceRecord{
+				{Name: []byte("www.example.com"), Type: layers.DNSTypeCNAME, CNAME: []byte("edge.cdn.example.")},
+				{Name: []byte("edge.cdn.example"), Type: layers.DNSTypeA, IP: server, TTL: 600},
+			},
+		},
+	}
+	assert.Equal(t, answer, c.Observe(answer))
+
+	conn := NetTraffic{
+		SrcIP: net.IPv4(10, 0, 0, 1), DstIP: server,
+		ObservationTime: start.Add(time.Minute),
+		Content:         TLSClientHello{},
+		Enrichment:      &Enrichment{Dst: &EndpointInfo{Country: "US"}},
+	}
+	annotated := c.Observe(conn)
+	if assert.NotNil(t, annotated.Enrichment) {
+		assert.Nil(t, annotated.Enrichment.Src)
+		assert.Equal(t, &EndpointInfo{Country: "US", DNSNames: []string{"www.example.com", "edge.cdn.example"}}, annotated.Enrichment.Dst)
+	}
+	// The original enrichment is not modified.
+	assert.Empty(t, conn.Enrichment.Dst.DNSNames)
+
+	// Expired.
+	assert.Empty(t, c.Names(server, start.Add(11*time.Minute)))
+
+	// Evicted by a newer address.
+	c.Observe(NetTraffic{ObservationTime: start, Content: DNSRequest{QR: true, Answers: []layers.DNSResourceRecord{
+		{Name: []byte("other.example"), Type: layers.DNSTypeAAAA, IP: net.ParseIP("2001:db8::1")},
+	}}})
+	assert.Empty(t, c.Names(server, start))
+	assert.Equal(t, []string{"other.example"}, c.Names(net.ParseIP("2001:db8::1"), start.Add(MinDNSNameLifetime)))
+}
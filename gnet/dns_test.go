@@ -0,0 +1,30 @@
+package gnet
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeNetBIOSName(t *testing.T) {
+	name, ok := DecodeNetBIOSName([]byte("FEEFFDFEEPFCCACACACACACACACACAAA"))
+	assert.True(t, ok)
+	assert.Equal(t, "TESTOR<00>", name)
+
+	name, ok = DecodeNetBIOSName([]byte("EOGFHEGCGJGPHDCACACACACACACACABN.corp"))
+	assert.True(t, ok)
+	assert.Equal(t, "Netbios<1D>.corp", name)
+
+	_, ok = DecodeNetBIOSName([]byte("example.com"))
+	assert.False(t, ok)
+}
+
+func TestFromDNSNetBIOS(t *testing.T) {
+	r := FromDNS(&layers.DNS{
+		Questions: []layers.DNSQuestion{{Name: []byte("FEEFFDFEEPFCCACACACACACACACACAAA"), Type: 0x20}},
+	}, NBNSProtocol)
+
+	assert.Equal(t, NBNSProtocol, r.Protocol)
+	assert.Equal(t, "TESTOR<00>", string(r.Questions[0].Name))
+}
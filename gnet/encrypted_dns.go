@@ -0,0 +1,41 @@
+package gnet
+
+import (
+	"net"
+
+	"github.com/google/uuid"
+)
+
+// Identifies how DNS queries are being carried when they are encrypted.
+type EncryptedDNSProtocol string
+
+const (
+	// DNS over HTTPS (RFC 8484), or a resolver's JSON API over HTTPS.
+	DoHProtocol EncryptedDNSProtocol = "DoH"
+
+	// DNS over TLS (RFC 7858).
+	DoTProtocol EncryptedDNSProtocol = "DoT"
+)
+
+// Represents a connection that was recognized as carrying encrypted DNS. The
+// queries themselves are not visible.
+type EncryptedDNSMetadata struct {
+	// Identifies the connection to the resolver.
+	ConnectionID uuid.UUID
+
+	Protocol EncryptedDNSProtocol
+
+	// The resolver's endpoint.
+	ResolverIP   net.IP
+	ResolverPort int
+
+	// The resolver's name from the TLS SNI or the HTTP Host, if known.
+	ServerName string
+
+	// The URL path queries are sent to, for DoH.
+	Path string
+}
+
+var _ ParsedNetworkContent = (*EncryptedDNSMetadata)(nil)
+
+func (EncryptedDNSMetadata) ReleaseBuffers() {}
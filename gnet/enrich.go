@@ -0,0 +1,202 @@
+package gnet
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time to wait for a reverse DNS lookup.
+const DefaultReverseDNSTimeout = 2 * time.Second
+
+// Information about an IP address from outside the capture, such as a GeoIP
+// database or reverse DNS.
+type EndpointInfo struct {
+	// ISO 3166-1 alpha-2 code of the country the address is located in.
+	Country string `json:"country,omitempty"`
+
+	// The autonomous system the address belongs to. 0 if unknown.
+	ASN            uint32 `json:"asn,omitempty"`
+	ASOrganization string `json:"as_organization,omitempty"`
+
+	// Names from reverse DNS, without the trailing dot.
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// Names that resolved to the address in DNS answers seen earlier in the
+	// capture. See DNSNameCache.
+	DNSNames []string `json:"dns_names,omitempty"`
+}
+
+func (i EndpointInfo) isEmpty() bool {
+	return i.Country == "" && i.ASN == 0 && i.ASOrganization == "" && len(i.Hostnames) == 0 && len(i.DNSNames) == 0
+}
+
+// Information about the endpoints of traffic. Either side is nil if nothing
+// is known about it.
+type Enrichment struct {
+	Src *EndpointInfo `json:"src,omitempty"`
+	Dst *EndpointInfo `json:"dst,omitempty"`
+}
+
+// Enricher looks up information about IP addresses. It is called for both
+// endpoints of every traffic, from the goroutine that delivers the traffic, so
+// it should answer quickly, e.g. from a local database or a cache.
+//
+// A MaxMind GeoIP2 or GeoLite2 reader can be adapted with EnricherFunc:
+//
+//	gnet.EnricherFunc(func(ip net.IP) (gnet.EndpointInfo, bool) {
+//		city, err := db.City(ip)
+//		if err != nil {
+//			return gnet.EndpointInfo{}, false
+//		}
+//		return gnet.EndpointInfo{Country: city.Country.IsoCode}, true
+//	})
+type Enricher interface {
+	Lookup(ip net.IP) (info EndpointInfo, ok bool)
+}
+
+type EnricherFunc func(ip net.IP) (EndpointInfo, bool)
+
+func (f EnricherFunc) Lookup(ip net.IP) (EndpointInfo, bool) {
+	return f(ip)
+}
+
+// Combines enrichers. Each fills in the fields left empty by those before it.
+func ChainEnrichers(es ...Enricher) Enricher {
+	return EnricherFunc(func(ip net.IP) (EndpointInfo, bool) {
+		var result EndpointInfo
+		found := false
+		for _, e := range es {
+			info, ok := e.Lookup(ip)
+			if !ok {
+				continue
+			}
+			found = true
+			if result.Country == "" {
+				result.Country = info.Country
+			}
+			if result.ASN == 0 {
+				result.ASN = info.ASN
+			}
+			if result.ASOrganization == "" {
+				result.ASOrganization = info.ASOrganization
+			}
+			if len(result.Hostnames) == 0 {
+				result.Hostnames = info.Hostnames
+			}
+			if len(result.DNSNames) == 0 {
+				result.DNSNames = info.DNSNames
+			}
+		}
+		return result, found
+	})
+}
+
+// Returns t with its Enrichment set from the information e has about its
+// endpoints. Unchanged if e knows nothing about either.
+func Enrich(e Enricher, t NetTraffic) NetTraffic {
+	var enrichment Enrichment
+	lookup := func(ip net.IP) *EndpointInfo {
+		if ip == nil {
+			return nil
+		}
+		if info, ok := e.Lookup(ip); ok && !info.isEmpty() {
+			return &info
+		}
+		return nil
+	}
+	enrichment.Src = lookup(t.SrcIP)
+	enrichment.Dst = lookup(t.DstIP)
+	if enrichment.Src != nil || enrichment.Dst != nil {
+		t.Enrichment = &enrichment
+	}
+	return t
+}
+
+// ReverseDNSEnricher looks up the names of addresses in the background, so
+// that it never holds up traffic: the first lookup of an address finds
+// nothing, and later lookups find the names once they are resolved. Results,
+// including failures, are cached.
+//
+// Safe for concurrent use.
+type ReverseDNSEnricher struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+	maxSize  int
+
+	mu    sync.Mutex
+	names map[string][]string
+	// Addresses in the cache, oldest first.
+	order []string
+}
+
+// Creates a ReverseDNSEnricher that caches the names of up to maxSize
+// addresses. A nil resolver uses net.DefaultResolver, and a non-positive
+// timeout DefaultReverseDNSTimeout.
+func NewReverseDNSEnricher(resolver *net.Resolver, timeout time.Duration, maxSize int) *ReverseDNSEnricher {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if timeout <= 0 {
+		timeout = DefaultReverseDNSTimeout
+	}
+	if maxSize <= 0 {
+		maxSize = 1
+	}
+	return &ReverseDNSEnricher{
+		resolver: resolver,
+		timeout:  timeout,
+		maxSize:  maxSize,
+		names:    map[string][]string{},
+	}
+}
+
+func (r *ReverseDNSEnricher) Lookup(ip net.IP) (EndpointInfo, bool) {
+	key := ip.String()
+
+	r.mu.Lock()
+	names, cached := r.names[key]
+	if !cached {
+		// Marks the lookup as in progress.
+		r.add(key, nil)
+	}
+	r.mu.Unlock()
+
+	if !cached {
+		go r.resolve(key)
+		return EndpointInfo{}, false
+	}
+	return EndpointInfo{Hostnames: names}, len(names) > 0
+}
+
+func (r *ReverseDNSEnricher) resolve(addr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	names, err := r.resolver.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return
+	}
+	for i, n := range names {
+		names[i] = strings.TrimSuffix(n, ".")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Only update addresses still in the cache.
+	if _, ok := r.names[addr]; ok {
+		r.names[addr] = names
+	}
+}
+
+// Adds an address to the cache, evicting the oldest if it is full. Must be
+// called with mu held.
+func (r *ReverseDNSEnricher) add(addr string, names []string) {
+	if len(r.order) >= r.maxSize {
+		delete(r.names, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.names[addr] = names
+	r.order = append(r.order, addr)
+}
@@ -0,0 +1,58 @@
+package gnet
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrich(t *testing.T) {
+	geo := EnricherFunc(func(ip net.IP) (EndpointInfo, bool) {
+		if ip.Equal(net.IPv4(8, 8, 8, 8)) {
+			return EndpointInfo{Country: "US", ASN: 15169}, true
+		}
+		return EndpointInfo{}, false
+	})
+	names := EnricherFunc(func(ip net.IP) (EndpointInfo, bool) {
+		return EndpointInfo{Country: "XX", Hostnames: []string{"dns.google"}}, ip.Equal(net.IPv4(8, 8, 8, 8))
+	})
+
+	traffic := Enrich(ChainEnrichers(geo, names), NetTraffic{
+		SrcIP: net.IPv4(10, 0, 0, 1),
+		DstIP: net.IPv4(8, 8, 8, 8),
+	})
+	if assert.NotNil(t, traffic.Enrichment) {
+		assert.Nil(t, traffic.Enrichment.Src)
+		assert.Equal(t, &EndpointInfo{Country: "US", ASN: 15169, Hostnames: []string{"dns.google"}}, traffic.Enrichment.Dst)
+	}
+
+	b, err := json.Marshal(traffic)
+	if assert.NoError(t, err) {
+		var decoded NetTraffic
+		assert.NoError(t, json.Unmarshal(b, &decoded))
+		assert.Equal(t, traffic.Enrichment, decoded.Enrichment)
+	}
+
+	unknown := Enrich(geo, NetTraffic{SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)})
+	assert.Nil(t, unknown.Enrichment)
+}
+
+func TestReverseDNSEnricherCache(t *testing.T) {
+	r := NewReverseDNSEnricher(nil, 0, 1)
+	r.mu.Lock()
+	r.add("192.0.2.1", []string{"host.example"})
+	r.mu.Unlock()
+
+	info, ok := r.Lookup(net.IPv4(192, 0, 2, 1))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"host.example"}, info.Hostnames)
+
+	// Evicts the first address.
+	r.mu.Lock()
+	r.add("192.0.2.2", nil)
+	_, cached := r.names["192.0.2.1"]
+	r.mu.Unlock()
+	assert.False(t, cached)
+}
@@ -0,0 +1,345 @@
+// Package extract carves the objects transferred in parsed traffic out to a
+// Sink, as Zeek's file extraction does:
+//
+//   - HTTP response bodies, from gnet.HTTPResponse or gnet.HTTPExchange
+//   - files sent over FTP data connections, from the gnet.FTPData and
+//     gnet.FTPTransfer added by gnet.FTPTracker
+//   - attachments of gnet.SMTPMessage
+//
+// Each object written is reported as a gnet.ExtractedFile with its size and
+// hashes. HTTP bodies are only as complete as the HTTP parser's body limit
+// allows; FTP data needs the TCP payloads of the data connection, which
+// unparsed traffic carries.
+package extract
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/ctp"
+)
+
+// Protocols objects are extracted from.
+const (
+	HTTP = "HTTP"
+	FTP  = "FTP"
+	SMTP = "SMTP"
+)
+
+const DefaultMaxSize = 100 << 20
+
+type Options struct {
+	// Objects are cut short after this many bytes, and reported as
+	// truncated. 0 for no limit.
+	MaxSize int64
+
+	// Protocols to extract objects from, among HTTP, FTP and SMTP. All of
+	// them if empty.
+	Sources []string
+
+	// If set, only objects of these MIME types are extracted, e.g.
+	// "application/pdf". The type is the one declared in the traffic, or else
+	// sniffed from the start of the object.
+	MIMETypes []string
+}
+
+func NewOptions() Options {
+	return Options{
+		MaxSize: DefaultMaxSize,
+	}
+}
+
+// Extractor writes out the objects transferred in traffic. Objects that the
+// sink fails to create or write are left out, and the first such error is
+// kept for Err.
+//
+// Safe for concurrent use.
+type Extractor struct {
+	sink      Sink
+	opts      Options
+	sources   map[string]bool
+	mimeTypes map[string]bool
+
+	mu sync.Mutex
+
+	// FTP transfers being written, by data connection.
+	ftp map[uuid.UUID]*object
+
+	err error
+}
+
+func NewExtractor(sink Sink, opts Options) *Extractor {
+	e := &Extractor{
+		sink: sink,
+		opts: opts,
+		ftp:  map[uuid.UUID]*object{},
+	}
+	if len(opts.Sources) > 0 {
+		e.sources = map[string]bool{}
+		for _, s := range opts.Sources {
+			e.sources[strings.ToUpper(s)] = true
+		}
+	}
+	if len(opts.MIMETypes) > 0 {
+		e.mimeTypes = map[string]bool{}
+		for _, t := range opts.MIMETypes {
+			e.mimeTypes[strings.ToLower(t)] = true
+		}
+	}
+	return e
+}
+
+// Run passes through all traffic from in, adding a gnet.ExtractedFile after
+// the traffic that completes each object. FTP transfers still being written
+// when in is closed are completed at the end.
+func (e *Extractor) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range e.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range e.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe extracts the objects in t, and returns t followed by the
+// gnet.ExtractedFile of each object it completes.
+func (e *Extractor) Observe(t gnet.NetTraffic) []gnet.NetTraffic {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	results := []gnet.NetTraffic{t}
+	switch c := t.Content.(type) {
+	case gnet.HTTPResponse:
+		results = e.extractHTTP(results, t, nil, &c)
+	case gnet.HTTPExchange:
+		if c.Response != nil {
+			results = e.extractHTTP(results, t, c.Request, c.Response)
+		}
+	case gnet.SMTPMessage:
+		if !e.enabled(SMTP) {
+			break
+		}
+		ctp.WalkAttachments(c.Data, func(filename, contentType string, content []byte) {
+			o := e.create(t, SMTP, filename, contentType, content)
+			if o != nil {
+				o.write(content)
+				results = e.finish(results, o)
+			}
+		})
+	case gnet.FTPData:
+		if !e.enabled(FTP) || !isFileTransfer(c.Command) {
+			break
+		}
+		o, ok := e.ftp[t.ConnectionID]
+		if !ok {
+			o = e.create(t, FTP, c.Filename, "", t.Payload)
+			// Transfers that are not extracted are remembered as nil.
+			e.ftp[t.ConnectionID] = o
+		}
+		if o != nil {
+			o.write(t.Payload)
+		}
+	case gnet.FTPTransfer:
+		if o, ok := e.ftp[c.DataConnectionID]; ok {
+			delete(e.ftp, c.DataConnectionID)
+			if o != nil {
+				o.traffic = t
+				results = e.finish(results, o)
+			}
+		}
+	}
+	return results
+}
+
+// Flush completes the FTP transfers being written.
+func (e *Extractor) Flush() []gnet.NetTraffic {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var results []gnet.NetTraffic
+	for id, o := range e.ftp {
+		delete(e.ftp, id)
+		if o != nil {
+			results = e.finish(results, o)
+		}
+	}
+	return results
+}
+
+// Returns the first error from the sink.
+func (e *Extractor) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+func (e *Extractor) extractHTTP(results []gnet.NetTraffic, t gnet.NetTraffic, req *gnet.HTTPRequest, resp *gnet.HTTPResponse) []gnet.NetTraffic {
+	if !e.enabled(HTTP) || resp.Body.Len() == 0 {
+		return results
+	}
+
+	var filename string
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		filename = params["filename"]
+	}
+	if filename == "" && req != nil && req.URL != nil {
+		if base := path.Base(req.URL.Path); base != "/" && base != "." {
+			filename = base
+		}
+	}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	sniff := resp.Body.Len()
+	if sniff > 512 {
+		sniff = 512
+	}
+	o := e.create(t, HTTP, filename, contentType, resp.Body.SubView(0, sniff).Bytes())
+	if o == nil {
+		return results
+	}
+	resp.Body.Chunks(func(b []byte) bool {
+		return o.write(b)
+	})
+	if resp.Truncated || resp.BodySize > resp.Body.Len() {
+		o.file.Truncated = true
+	}
+	return e.finish(results, o)
+}
+
+func (e *Extractor) enabled(source string) bool {
+	return e.sources == nil || e.sources[source]
+}
+
+// Creates an object for the sink, unless its MIME type, declared or sniffed
+// from the first bytes of its content, is not extracted. Returns nil if not
+// extracted.
+func (e *Extractor) create(t gnet.NetTraffic, source, filename, mimeType string, first []byte) *object {
+	if mimeType == "" {
+		mimeType, _, _ = mime.ParseMediaType(http.DetectContentType(first))
+	}
+	mimeType = strings.ToLower(mimeType)
+	if e.mimeTypes != nil && !e.mimeTypes[mimeType] {
+		return nil
+	}
+
+	f := File{
+		ID:           uuid.New(),
+		ConnectionID: t.ConnectionID,
+		Source:       source,
+		Filename:     filename,
+		MIMEType:     mimeType,
+	}
+	w, err := e.sink.Create(f)
+	if err != nil {
+		e.setErr(err)
+		return nil
+	}
+	o := &object{
+		file: gnet.ExtractedFile{
+			ID:           f.ID,
+			ConnectionID: f.ConnectionID,
+			Source:       source,
+			Filename:     filename,
+			MIMEType:     mimeType,
+		},
+		traffic: t,
+		w:       w,
+		max:     e.opts.MaxSize,
+		md5:     md5.New(),
+		sha1:    sha1.New(),
+		sha256:  sha256.New(),
+	}
+	if n, ok := w.(interface{ Name() string }); ok {
+		o.file.Path = n.Name()
+	}
+	return o
+}
+
+// Closes o and appends its gnet.ExtractedFile to results, unless it could not
+// be written.
+func (e *Extractor) finish(results []gnet.NetTraffic, o *object) []gnet.NetTraffic {
+	if err := o.w.Close(); err != nil && o.err == nil {
+		o.err = err
+	}
+	if o.err != nil {
+		e.setErr(o.err)
+		return results
+	}
+	o.file.MD5 = hex.EncodeToString(o.md5.Sum(nil))
+	o.file.SHA1 = hex.EncodeToString(o.sha1.Sum(nil))
+	o.file.SHA256 = hex.EncodeToString(o.sha256.Sum(nil))
+
+	t := o.traffic
+	t.Content = o.file
+	t.Payload = nil
+	return append(results, t)
+}
+
+func (e *Extractor) setErr(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Commands whose data connection carries a file, rather than a listing.
+func isFileTransfer(cmd string) bool {
+	switch cmd {
+	case "RETR", "STOR", "STOU", "APPE":
+		return true
+	}
+	return false
+}
+
+// An object being written to the sink.
+type object struct {
+	file gnet.ExtractedFile
+
+	// The traffic the gnet.ExtractedFile is reported with.
+	traffic gnet.NetTraffic
+
+	w   io.WriteCloser
+	max int64
+	err error
+
+	md5, sha1, sha256 hash.Hash
+}
+
+// Writes p, up to the size limit. Returns false once nothing more can be
+// written.
+func (o *object) write(p []byte) bool {
+	if o.err != nil || o.file.Truncated {
+		return false
+	}
+	if o.max > 0 && o.file.Size+int64(len(p)) > o.max {
+		p = p[:o.max-o.file.Size]
+		o.file.Truncated = true
+	}
+	if _, err := o.w.Write(p); err != nil {
+		o.err = err
+		return false
+	}
+	o.md5.Write(p)
+	o.sha1.Write(p)
+	o.sha256.Write(p)
+	o.file.Size += int64(len(p))
+	return !o.file.Truncated
+}
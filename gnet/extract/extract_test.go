@@ -0,0 +1,196 @@
+package extract
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+type buffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *buffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// Returns a sink that keeps objects in memory, by ID.
+func memorySink() (Sink, map[uuid.UUID]*buffer) {
+	files := map[uuid.UUID]*buffer{}
+	return SinkFunc(func(f File) (io.WriteCloser, error) {
+		b := &buffer{}
+		files[f.ID] = b
+		return b, nil
+	}), files
+}
+
+// Returns the gnet.ExtractedFiles in traffic.
+func extracted(traffic []gnet.NetTraffic) []gnet.ExtractedFile {
+	var files []gnet.ExtractedFile
+	for _, t := range traffic {
+		if f, ok := t.Content.(gnet.ExtractedFile); ok {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractHTTP(t *testing.T) {
+	sink, files := memorySink()
+	opts := NewOptions()
+	opts.MaxSize = 10
+	e := NewExtractor(sink, opts)
+
+	req := gnet.HTTPRequest{URL: &url.URL{Path: "/files/report.pdf"}}
+	resp := gnet.HTTPResponse{
+		Header: http.Header{"Content-Type": {"application/pdf"}},
+		Body:   memview.New([]byte("%PDF-1.4 and more")),
+	}
+	results := e.Observe(gnet.NetTraffic{Content: gnet.HTTPExchange{Request: &req, Response: &resp}})
+	if assert.Len(t, results, 2) {
+		f := results[1].Content.(gnet.ExtractedFile)
+		assert.Equal(t, HTTP, f.Source)
+		assert.Equal(t, "report.pdf", f.Filename)
+		assert.Equal(t, "application/pdf", f.MIMEType)
+		assert.Equal(t, int64(10), f.Size)
+		assert.True(t, f.Truncated)
+		assert.Equal(t, sha256Hex("%PDF-1.4 a"), f.SHA256)
+		assert.Equal(t, "%PDF-1.4 a", files[f.ID].String())
+		assert.True(t, files[f.ID].closed)
+	}
+
+	// The type is sniffed when not declared.
+	resp = gnet.HTTPResponse{
+		Header: http.Header{"Content-Disposition": {`attachment; filename="a.png"`}},
+		Body:   memview.New([]byte("\x89PNG\r\n\x1a\n")),
+	}
+	results = e.Observe(gnet.NetTraffic{Content: resp})
+	if assert.Len(t, extracted(results), 1) {
+		f := extracted(results)[0]
+		assert.Equal(t, "a.png", f.Filename)
+		assert.Equal(t, "image/png", f.MIMEType)
+		assert.False(t, f.Truncated)
+	}
+}
+
+func TestExtractFTP(t *testing.T) {
+	sink, files := memorySink()
+	e := NewExtractor(sink, NewOptions())
+	control, data := uuid.New(), uuid.New()
+
+	for _, chunk := range []string{"hello, ", "world"} {
+		results := e.Observe(gnet.NetTraffic{
+			ConnectionID: data,
+			Payload:      []byte(chunk),
+			Content:      gnet.FTPData{ControlConnectionID: control, Command: "RETR", Filename: "hello.txt"},
+		})
+		assert.Len(t, results, 1)
+	}
+	// Listings are not extracted.
+	e.Observe(gnet.NetTraffic{
+		ConnectionID: uuid.New(),
+		Payload:      []byte("-rw-r--r-- hello.txt"),
+		Content:      gnet.FTPData{Command: "LIST"},
+	})
+
+	results := e.Observe(gnet.NetTraffic{Content: gnet.FTPTransfer{DataConnectionID: data}})
+	if assert.Len(t, extracted(results), 1) {
+		f := extracted(results)[0]
+		assert.Equal(t, FTP, f.Source)
+		assert.Equal(t, data, f.ConnectionID)
+		assert.Equal(t, "hello.txt", f.Filename)
+		assert.Equal(t, "text/plain", f.MIMEType)
+		assert.Equal(t, "hello, world", files[f.ID].String())
+	}
+	assert.Len(t, files, 1)
+	assert.Empty(t, e.Flush())
+}
+
+func TestExtractSMTP(t *testing.T) {
+	message := strings.ReplaceAll(`From: a@example.com
+To: b@example.com
+Subject: files
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See attached.
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="data.bin"
+Content-Transfer-Encoding: base64
+
+AAECAw==
+--b--
+`, "\n", "\r\n")
+
+	sink, files := memorySink()
+	opts := NewOptions()
+	opts.Sources = []string{"smtp"}
+	e := NewExtractor(sink, opts)
+
+	results := e.Observe(gnet.NetTraffic{Content: gnet.SMTPMessage{Data: []byte(message)}})
+	if assert.Len(t, extracted(results), 1) {
+		f := extracted(results)[0]
+		assert.Equal(t, SMTP, f.Source)
+		assert.Equal(t, "data.bin", f.Filename)
+		assert.Equal(t, "application/octet-stream", f.MIMEType)
+		assert.Equal(t, []byte{0, 1, 2, 3}, files[f.ID].Bytes())
+	}
+
+	// HTTP is not among the sources.
+	results = e.Observe(gnet.NetTraffic{Content: gnet.HTTPResponse{Body: memview.New([]byte("x"))}})
+	assert.Empty(t, extracted(results))
+}
+
+func TestExtractMIMETypes(t *testing.T) {
+	sink, files := memorySink()
+	opts := NewOptions()
+	opts.MIMETypes = []string{"application/PDF"}
+	e := NewExtractor(sink, opts)
+
+	e.Observe(gnet.NetTraffic{Content: gnet.HTTPResponse{Body: memview.New([]byte("<html></html>"))}})
+	e.Observe(gnet.NetTraffic{Content: gnet.HTTPResponse{Body: memview.New([]byte("%PDF-1.4"))}})
+	assert.Len(t, files, 1)
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	e := NewExtractor(Dir(dir), NewOptions())
+	results := e.Observe(gnet.NetTraffic{Content: gnet.HTTPResponse{
+		Header: http.Header{"Content-Disposition": {`attachment; filename="../../etc/passwd.t/xt"`}},
+		Body:   memview.New([]byte("body")),
+	}})
+	assert.NoError(t, e.Err())
+	if assert.Len(t, extracted(results), 1) {
+		f := extracted(results)[0]
+		assert.Equal(t, dir, filepath.Dir(f.Path))
+		assert.Equal(t, "http-"+f.ID.String(), filepath.Base(f.Path))
+		content, err := os.ReadFile(f.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(content))
+	}
+	assert.Equal(t, ".pdf", extension("report.pdf"))
+	assert.Equal(t, "", extension("archive.tar.g z"))
+}
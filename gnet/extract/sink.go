@@ -0,0 +1,60 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Describes an object about to be written to a Sink.
+type File struct {
+	ID           uuid.UUID
+	ConnectionID uuid.UUID
+
+	// As in gnet.ExtractedFile.
+	Source   string
+	Filename string
+	MIMEType string
+}
+
+// Sink creates the writers that extracted objects are written to, one for each
+// object. If the writer has a Name method, as *os.File does, its name is
+// reported as the Path of the gnet.ExtractedFile.
+type Sink interface {
+	Create(f File) (io.WriteCloser, error)
+}
+
+type SinkFunc func(f File) (io.WriteCloser, error)
+
+func (fn SinkFunc) Create(f File) (io.WriteCloser, error) {
+	return fn(f)
+}
+
+// Returns a Sink that writes each object to a new file in dir, named after its
+// source and ID, and the extension of its filename, e.g.
+// http-0b5c3d7e-....pdf. Filenames from traffic are otherwise not used, as
+// they cannot be trusted.
+func Dir(dir string) Sink {
+	return SinkFunc(func(f File) (io.WriteCloser, error) {
+		name := fmt.Sprintf("%s-%s%s", strings.ToLower(f.Source), f.ID, extension(f.Filename))
+		return os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	})
+}
+
+// Returns the extension of filename if it is short and alphanumeric.
+func extension(filename string) string {
+	ext := filepath.Ext(strings.ReplaceAll(filename, "\\", "/"))
+	if len(ext) < 2 || len(ext) > 8 {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+			return ""
+		}
+	}
+	return ext
+}
@@ -0,0 +1,38 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// Describes an object carved out of traffic and written out, such as an HTTP
+// response body, a file sent over FTP or a mail attachment. See package
+// extract.
+type ExtractedFile struct {
+	ID           uuid.UUID
+	ConnectionID uuid.UUID
+
+	// The protocol the object was transferred with: "HTTP", "FTP" or "SMTP".
+	Source string
+
+	// The name the object was transferred under, if any, as sent: it must be
+	// sanitized before use as a path.
+	Filename string
+	MIMEType string
+
+	// Where the object was written, if the sink has names for its files.
+	Path string
+
+	// The number of bytes written, and whether that is less than the whole
+	// object, because it exceeded the size limit or was not captured whole.
+	Size      int64
+	Truncated bool
+
+	// Hex-encoded hashes of the bytes written.
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+var _ ParsedNetworkContent = ExtractedFile{}
+
+func (ExtractedFile) ReleaseBuffers() {}
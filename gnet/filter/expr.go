@@ -0,0 +1,289 @@
+package filter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Compile compiles a filter expression. Primitives are
+//
+//	proto NAME               as Proto
+//	type NAME                as ContentType
+//	[src|dst] host IP        either endpoint, or the given one
+//	[src|dst] port [OP] N    likewise; OP is one of = == != < <= > >=
+//	status [OP] N            HTTP status code, as HTTPStatus
+//
+// combined with "and" (or "&&"), "or" ("||"), "not" ("!") and parentheses.
+// "and" binds tighter than "or". Keywords and protocol names are not case
+// sensitive, content type names are.
+func Compile(expr string) (Filter, error) {
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.text != "" {
+		return nil, errors.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return f, nil
+}
+
+// Like Compile, but panics on an invalid expression.
+func MustCompile(expr string) Filter {
+	f, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+type token struct {
+	text string
+	pos  int
+}
+
+// Splits expr into words, operators and parentheses. The last token is empty,
+// and positioned at the end of expr.
+func lex(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, token{expr[i : i+1], i})
+			i++
+		case strings.ContainsRune("=!<>&|", rune(c)):
+			n := 1
+			if i+1 < len(expr) {
+				switch expr[i : i+2] {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					n = 2
+				}
+			}
+			op := expr[i : i+n]
+			if op == "&" || op == "|" {
+				return nil, errors.Errorf("unexpected %q at offset %d", op, i)
+			}
+			toks = append(toks, token{op, i})
+			i += n
+		default:
+			start := i
+			for i < len(expr) && !strings.ContainsRune(" \t\n\r()=!<>&|", rune(expr[i])) {
+				i++
+			}
+			toks = append(toks, token{expr[start:i], start})
+		}
+	}
+	return append(toks, token{"", len(expr)}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return t
+}
+
+// Consumes the next token if it is one of words, ignoring case.
+func (p *parser) accept(words ...string) bool {
+	for _, w := range words {
+		if strings.EqualFold(p.peek().text, w) {
+			p.next()
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the next token, which must not be the end of the expression.
+func (p *parser) operand(what string) (token, error) {
+	t := p.next()
+	if t.text == "" {
+		return t, errors.Errorf("expected %s at end of expression", what)
+	}
+	return t, nil
+}
+
+func (p *parser) or() (Filter, error) {
+	f, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	fs := []Filter{f}
+	for p.accept("or", "||") {
+		f, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return Or(fs...), nil
+}
+
+func (p *parser) and() (Filter, error) {
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	fs := []Filter{f}
+	for p.accept("and", "&&") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return And(fs...), nil
+}
+
+func (p *parser) unary() (Filter, error) {
+	if p.accept("not", "!") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+	}
+	if p.accept("(") {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.text != ")" {
+			return nil, errors.Errorf("expected \")\" at offset %d", t.pos)
+		}
+		return f, nil
+	}
+	return p.primitive()
+}
+
+func (p *parser) primitive() (Filter, error) {
+	t, err := p.operand("a filter")
+	if err != nil {
+		return nil, err
+	}
+	kw := strings.ToLower(t.text)
+
+	dir := ""
+	if kw == "src" || kw == "dst" {
+		dir = kw
+		if t, err = p.operand("host or port"); err != nil {
+			return nil, err
+		}
+		kw = strings.ToLower(t.text)
+		if kw != "host" && kw != "port" {
+			return nil, errors.Errorf("expected host or port at offset %d, got %q", t.pos, t.text)
+		}
+	}
+
+	switch kw {
+	case "proto":
+		name, err := p.operand("a protocol")
+		if err != nil {
+			return nil, err
+		}
+		return Proto(name.text), nil
+	case "type":
+		name, err := p.operand("a content type")
+		if err != nil {
+			return nil, err
+		}
+		return ContentType(name.text), nil
+	case "host":
+		a, err := p.operand("an IP address")
+		if err != nil {
+			return nil, err
+		}
+		ip := net.ParseIP(a.text)
+		if ip == nil {
+			return nil, errors.Errorf("invalid IP address %q at offset %d", a.text, a.pos)
+		}
+		switch dir {
+		case "src":
+			return func(t gnet.NetTraffic) bool { return ip.Equal(t.SrcIP) }, nil
+		case "dst":
+			return func(t gnet.NetTraffic) bool { return ip.Equal(t.DstIP) }, nil
+		}
+		return Host(ip), nil
+	case "port":
+		cmp, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		switch dir {
+		case "src":
+			return func(t gnet.NetTraffic) bool { return cmp(t.SrcPort) }, nil
+		case "dst":
+			return func(t gnet.NetTraffic) bool { return cmp(t.DstPort) }, nil
+		}
+		return func(t gnet.NetTraffic) bool { return cmp(t.SrcPort) || cmp(t.DstPort) }, nil
+	case "status":
+		cmp, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		return func(t gnet.NetTraffic) bool {
+			status, ok := httpStatus(t.Content)
+			return ok && cmp(status)
+		}, nil
+	}
+	return nil, errors.Errorf("unknown filter %q at offset %d", t.text, t.pos)
+}
+
+// Parses an optional comparison operator and a number, and returns the
+// comparison of its argument with the number.
+func (p *parser) comparison() (func(int) bool, error) {
+	op := "="
+	switch p.peek().text {
+	case "=", "==", "!=", "<", "<=", ">", ">=":
+		op = p.next().text
+	}
+	t, err := p.operand("a number")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return nil, errors.Errorf("invalid number %q at offset %d", t.text, t.pos)
+	}
+	switch op {
+	case "!=":
+		return func(v int) bool { return v != n }, nil
+	case "<":
+		return func(v int) bool { return v < n }, nil
+	case "<=":
+		return func(v int) bool { return v <= n }, nil
+	case ">":
+		return func(v int) bool { return v > n }, nil
+	case ">=":
+		return func(v int) bool { return v >= n }, nil
+	}
+	return func(v int) bool { return v == n }, nil
+}
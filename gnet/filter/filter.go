@@ -0,0 +1,129 @@
+// Package filter selects parsed traffic after parsing, where BPF filters,
+// which only see packets, cannot: by protocol, content type or HTTP status as
+// well as by host and port. Filters are Go predicates, combined with And, Or
+// and Not, or compiled from expressions such as
+//
+//	proto http and status >= 500 and not host 10.0.0.1
+//
+// See Compile for the syntax.
+package filter
+
+import (
+	"net"
+	"strings"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Reports whether to keep traffic.
+type Filter func(t gnet.NetTraffic) bool
+
+// Matches traffic matched by all of fs, or all traffic if fs is empty.
+func And(fs ...Filter) Filter {
+	return func(t gnet.NetTraffic) bool {
+		for _, f := range fs {
+			if !f(t) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Matches traffic matched by any of fs, or no traffic if fs is empty.
+func Or(fs ...Filter) Filter {
+	return func(t gnet.NetTraffic) bool {
+		for _, f := range fs {
+			if f(t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(f Filter) Filter {
+	return func(t gnet.NetTraffic) bool {
+		return !f(t)
+	}
+}
+
+// Matches traffic whose LayerType is name, or whose content type was
+// registered under a name starting with name, ignoring case: "http" matches
+// HTTPRequest and HTTPResponse, "udp" UDP datagrams.
+func Proto(name string) Filter {
+	return func(t gnet.NetTraffic) bool {
+		if strings.EqualFold(t.LayerType, name) {
+			return true
+		}
+		if t.Content == nil {
+			return false
+		}
+		ct, ok := gnet.ContentTypeName(t.Content)
+		return ok && len(ct) >= len(name) && strings.EqualFold(ct[:len(name)], name)
+	}
+}
+
+// Matches traffic with content of a type registered under one of names, e.g.
+// "HTTPRequest". See gnet.RegisterContentType.
+func ContentType(names ...string) Filter {
+	return func(t gnet.NetTraffic) bool {
+		if t.Content == nil {
+			return false
+		}
+		ct, ok := gnet.ContentTypeName(t.Content)
+		if !ok {
+			return false
+		}
+		for _, name := range names {
+			if ct == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Matches traffic with ip as either endpoint.
+func Host(ip net.IP) Filter {
+	return func(t gnet.NetTraffic) bool {
+		return ip.Equal(t.SrcIP) || ip.Equal(t.DstIP)
+	}
+}
+
+// Matches traffic with port as either endpoint.
+func Port(port int) Filter {
+	return func(t gnet.NetTraffic) bool {
+		return t.SrcPort == port || t.DstPort == port
+	}
+}
+
+// Matches HTTP responses, alone or in exchanges, whose status code is one of
+// codes.
+func HTTPStatus(codes ...int) Filter {
+	return func(t gnet.NetTraffic) bool {
+		status, ok := httpStatus(t.Content)
+		if !ok {
+			return false
+		}
+		for _, c := range codes {
+			if status == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns the HTTP status code of c, if it is a response.
+func httpStatus(c gnet.ParsedNetworkContent) (int, bool) {
+	switch c := c.(type) {
+	case gnet.HTTPResponse:
+		return c.StatusCode, true
+	case gnet.HTTPExchange:
+		if c.Response != nil {
+			return c.Response.StatusCode, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestCompile(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	request := gnet.NetTraffic{
+		LayerType: "TCP",
+		SrcIP:     client, SrcPort: 40000,
+		DstIP: server, DstPort: 80,
+		Content: gnet.HTTPRequest{Method: "GET"},
+	}
+	response := gnet.NetTraffic{
+		LayerType: "TCP",
+		SrcIP:     server, SrcPort: 80,
+		DstIP: client, DstPort: 40000,
+		Content: gnet.HTTPResponse{StatusCode: 503},
+	}
+	exchange := response
+	exchange.Content = gnet.HTTPExchange{Response: &gnet.HTTPResponse{StatusCode: 404}}
+	dns := gnet.NetTraffic{
+		LayerType: "UDP",
+		SrcIP:     client, SrcPort: 53000,
+		DstIP: net.IPv4(8, 8, 8, 8), DstPort: 53,
+	}
+
+	testCases := []struct {
+		expr string
+		want []bool // request, response, exchange, dns
+	}{
+		{"proto http", []bool{true, true, true, false}},
+		{"PROTO udp", []bool{false, false, false, true}},
+		{"type HTTPRequest", []bool{true, false, false, false}},
+		{"host 10.0.0.2", []bool{true, true, true, false}},
+		{"src host 10.0.0.1", []bool{true, false, false, true}},
+		{"dst port 80", []bool{true, false, false, false}},
+		{"port < 1024", []bool{true, true, true, true}},
+		{"src port >= 1024 and src port != 53000", []bool{true, false, false, false}},
+		{"status >= 500", []bool{false, true, false, false}},
+		{"status 404 || status == 503", []bool{false, true, true, false}},
+		{"proto http and not (status >= 400)", []bool{true, false, false, false}},
+		{"!proto http or dst host 8.8.8.8 and port 53", []bool{false, false, false, true}},
+	}
+	for _, c := range testCases {
+		f, err := Compile(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		var got []bool
+		for _, tr := range []gnet.NetTraffic{request, response, exchange, dns} {
+			got = append(got, f(tr))
+		}
+		assert.Equal(t, c.want, got, c.expr)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"proto",
+		"host example.com",
+		"port x",
+		"src proto http",
+		"status >",
+		"(proto http",
+		"proto http)",
+		"proto http and",
+		"port & 80",
+		"bogus 1",
+	} {
+		_, err := Compile(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,342 @@
+package flow
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Messages are kept small enough to be sent over UDP without fragmentation.
+const maxMessageSize = 1400
+
+const (
+	ipfixVersion      = 10
+	ipfixHeaderLen    = 16
+	ipfixTemplateSet  = 2
+	netflowV9Version  = 9
+	netflowHeaderLen  = 20
+	netflowTemplateID = 0
+
+	// Templates for flows between IPv4 and IPv6 addresses. Data sets must use
+	// IDs of 256 and above.
+	templateIPv4 = 256
+	templateIPv6 = 257
+)
+
+// Information element IDs, shared by IPFIX and NetFlow v9.
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieTCPControlBits           = 6
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieLastSwitched             = 21
+	ieFirstSwitched            = 22
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieFlowStartMilliseconds    = 152
+	ieFlowEndMilliseconds      = 153
+)
+
+// Exporter sends flow records somewhere, such as a collector.
+type Exporter interface {
+	Export(records []Record) error
+}
+
+// JSONExporter writes each record as a JSON object on its own line.
+type JSONExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *JSONExporter) Export(records []Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		if err := e.enc.Encode(r); err != nil {
+			return errors.Wrap(err, "failed to write flow record")
+		}
+	}
+	return nil
+}
+
+// A field of a template, and how to encode its value.
+type field struct {
+	id, length uint16
+	put        func(b []byte, r *Record)
+}
+
+type template struct {
+	id        uint16
+	fields    []field
+	recordLen int
+}
+
+func newTemplate(id uint16, fields ...field) template {
+	t := template{id: id, fields: fields}
+	for _, f := range fields {
+		t.recordLen += int(f.length)
+	}
+	return t
+}
+
+// Length of the template set or flowset announcing t.
+func (t template) setLen() int {
+	return 8 + 4*len(t.fields)
+}
+
+func (t template) appendSet(b []byte, setID uint16) []byte {
+	b = appendUint16(b, setID)
+	b = appendUint16(b, uint16(t.setLen()))
+	b = appendUint16(b, t.id)
+	b = appendUint16(b, uint16(len(t.fields)))
+	for _, f := range t.fields {
+		b = appendUint16(b, f.id)
+		b = appendUint16(b, f.length)
+	}
+	return b
+}
+
+// Appends a data set of records described by t, padded to a multiple of pad
+// bytes.
+func (t template) appendData(b []byte, records []Record, pad int) []byte {
+	n := 4 + len(records)*t.recordLen
+	if rem := n % pad; rem != 0 {
+		n += pad - rem
+	}
+	b = appendUint16(b, t.id)
+	b = appendUint16(b, uint16(n))
+	for i := range records {
+		rec := make([]byte, t.recordLen)
+		off := 0
+		for _, f := range t.fields {
+			f.put(rec[off:off+int(f.length)], &records[i])
+			off += int(f.length)
+		}
+		b = append(b, rec...)
+	}
+	for len(b)%pad != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// The fields common to IPFIX and NetFlow v9, followed by the given timestamp
+// fields.
+func commonFields(v6 bool, timestamps ...field) []field {
+	addrLen, src, dst := uint16(4), uint16(ieSourceIPv4Address), uint16(ieDestinationIPv4Address)
+	if v6 {
+		addrLen, src, dst = 16, ieSourceIPv6Address, ieDestinationIPv6Address
+	}
+	putIP := func(b []byte, ip net.IP) {
+		if v6 {
+			copy(b, ip.To16())
+		} else {
+			copy(b, ip.To4())
+		}
+	}
+	fields := []field{
+		{src, addrLen, func(b []byte, r *Record) { putIP(b, r.SrcIP) }},
+		{dst, addrLen, func(b []byte, r *Record) { putIP(b, r.DstIP) }},
+		{ieSourceTransportPort, 2, func(b []byte, r *Record) { binary.BigEndian.PutUint16(b, uint16(r.SrcPort)) }},
+		{ieDestinationTransportPort, 2, func(b []byte, r *Record) { binary.BigEndian.PutUint16(b, uint16(r.DstPort)) }},
+		{ieProtocolIdentifier, 1, func(b []byte, r *Record) { b[0] = uint8(r.Protocol) }},
+		{ieTCPControlBits, 1, func(b []byte, r *Record) { b[0] = r.TCPFlags }},
+		{iePacketDeltaCount, 8, func(b []byte, r *Record) { binary.BigEndian.PutUint64(b, r.Packets) }},
+		{ieOctetDeltaCount, 8, func(b []byte, r *Record) { binary.BigEndian.PutUint64(b, r.Bytes) }},
+	}
+	return append(fields, timestamps...)
+}
+
+// Splits records into the IPv4 and IPv6 flows, then into batches that fit in
+// messages with the given overhead besides the data records.
+func batches(records []Record, overhead func(t template) int, templates [2]template) (batches [][]Record, ts []template) {
+	var byFamily [2][]Record
+	for _, r := range records {
+		if r.SrcIP.To4() != nil && r.DstIP.To4() != nil {
+			byFamily[0] = append(byFamily[0], r)
+		} else {
+			byFamily[1] = append(byFamily[1], r)
+		}
+	}
+	for i, rs := range byFamily {
+		t := templates[i]
+		per := (maxMessageSize - overhead(t)) / t.recordLen
+		for len(rs) > 0 {
+			n := per
+			if n > len(rs) {
+				n = len(rs)
+			}
+			batches = append(batches, rs[:n])
+			ts = append(ts, t)
+			rs = rs[n:]
+		}
+	}
+	return batches, ts
+}
+
+// Returns the end time of the latest flow in records.
+func latestEnd(records []Record) time.Time {
+	var t time.Time
+	for _, r := range records {
+		if r.End.After(t) {
+			t = r.End
+		}
+	}
+	return t
+}
+
+// IPFIXExporter writes each batch of records as IPFIX (RFC 7011) messages,
+// one Write per message, so w may be a UDP connection to a collector.
+// Every message carries the template of its records.
+//
+// The export time of each message is the end of its latest flow, so captures
+// read from files export consistent times.
+type IPFIXExporter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	domainID  uint32
+	seq       uint32
+	templates [2]template
+}
+
+func NewIPFIXExporter(w io.Writer, observationDomainID uint32) *IPFIXExporter {
+	millis := func(t func(r *Record) time.Time) func(b []byte, r *Record) {
+		return func(b []byte, r *Record) {
+			binary.BigEndian.PutUint64(b, uint64(t(r).UnixMilli()))
+		}
+	}
+	timestamps := []field{
+		{ieFlowStartMilliseconds, 8, millis(func(r *Record) time.Time { return r.Start })},
+		{ieFlowEndMilliseconds, 8, millis(func(r *Record) time.Time { return r.End })},
+	}
+	return &IPFIXExporter{
+		w:        w,
+		domainID: observationDomainID,
+		templates: [2]template{
+			newTemplate(templateIPv4, commonFields(false, timestamps...)...),
+			newTemplate(templateIPv6, commonFields(true, timestamps...)...),
+		},
+	}
+}
+
+func (e *IPFIXExporter) Export(records []Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	overhead := func(t template) int { return ipfixHeaderLen + t.setLen() + 4 }
+	bs, ts := batches(records, overhead, e.templates)
+	for i, batch := range bs {
+		b := make([]byte, ipfixHeaderLen, maxMessageSize)
+		b = ts[i].appendSet(b, ipfixTemplateSet)
+		b = ts[i].appendData(b, batch, 1)
+
+		binary.BigEndian.PutUint16(b[0:], ipfixVersion)
+		binary.BigEndian.PutUint16(b[2:], uint16(len(b)))
+		binary.BigEndian.PutUint32(b[4:], uint32(latestEnd(batch).Unix()))
+		// The number of data records sent before this message.
+		binary.BigEndian.PutUint32(b[8:], e.seq)
+		binary.BigEndian.PutUint32(b[12:], e.domainID)
+		e.seq += uint32(len(batch))
+
+		if _, err := e.w.Write(b); err != nil {
+			return errors.Wrap(err, "failed to write IPFIX message")
+		}
+	}
+	return nil
+}
+
+// NetFlowV9Exporter writes each batch of records as NetFlow v9 (RFC 3954)
+// export packets, one Write per packet. Every packet carries the template of
+// its records.
+//
+// NetFlow v9 timestamps are relative to the boot of the exporter, which is
+// taken to be the start of the earliest flow of the first export. Like for
+// IPFIXExporter, packet times are the end of the latest flow in the packet.
+type NetFlowV9Exporter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	sourceID  uint32
+	seq       uint32
+	boot      time.Time
+	templates [2]template
+}
+
+func NewNetFlowV9Exporter(w io.Writer, sourceID uint32) *NetFlowV9Exporter {
+	e := &NetFlowV9Exporter{w: w, sourceID: sourceID}
+	uptime := func(t func(r *Record) time.Time) func(b []byte, r *Record) {
+		return func(b []byte, r *Record) {
+			binary.BigEndian.PutUint32(b, e.uptime(t(r)))
+		}
+	}
+	timestamps := []field{
+		{ieFirstSwitched, 4, uptime(func(r *Record) time.Time { return r.Start })},
+		{ieLastSwitched, 4, uptime(func(r *Record) time.Time { return r.End })},
+	}
+	e.templates = [2]template{
+		newTemplate(templateIPv4, commonFields(false, timestamps...)...),
+		newTemplate(templateIPv6, commonFields(true, timestamps...)...),
+	}
+	return e
+}
+
+// Milliseconds from the boot of the exporter to t.
+func (e *NetFlowV9Exporter) uptime(t time.Time) uint32 {
+	if t.Before(e.boot) {
+		return 0
+	}
+	return uint32(t.Sub(e.boot).Milliseconds())
+}
+
+func (e *NetFlowV9Exporter) Export(records []Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.boot.IsZero() {
+		for _, r := range records {
+			if e.boot.IsZero() || r.Start.Before(e.boot) {
+				e.boot = r.Start
+			}
+		}
+	}
+
+	overhead := func(t template) int { return netflowHeaderLen + t.setLen() + 4 + 3 }
+	bs, ts := batches(records, overhead, e.templates)
+	for i, batch := range bs {
+		b := make([]byte, netflowHeaderLen, maxMessageSize)
+		b = ts[i].appendSet(b, netflowTemplateID)
+		b = ts[i].appendData(b, batch, 4)
+
+		now := latestEnd(batch)
+		binary.BigEndian.PutUint16(b[0:], netflowV9Version)
+		// The template and the data records.
+		binary.BigEndian.PutUint16(b[2:], uint16(1+len(batch)))
+		binary.BigEndian.PutUint32(b[4:], e.uptime(now))
+		binary.BigEndian.PutUint32(b[8:], uint32(now.Unix()))
+		// The number of packets sent before this one.
+		binary.BigEndian.PutUint32(b[12:], e.seq)
+		binary.BigEndian.PutUint32(b[16:], e.sourceID)
+		e.seq++
+
+		if _, err := e.w.Write(b); err != nil {
+			return errors.Wrap(err, "failed to write NetFlow v9 packet")
+		}
+	}
+	return nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
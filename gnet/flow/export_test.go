@@ -0,0 +1,124 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+// Collects the messages written to it.
+type messages [][]byte
+
+func (m *messages) Write(b []byte) (int, error) {
+	*m = append(*m, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func testRecords() []Record {
+	return []Record{
+		{
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    clientIP, SrcPort: 40000,
+			DstIP: serverIP, DstPort: 80,
+			Packets: 3, Bytes: 100,
+			Start: start, End: start.Add(1500 * time.Millisecond),
+			TCPFlags: TCPFlagSYN | TCPFlagACK,
+		},
+		{
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.ParseIP("fe80::1"), SrcPort: 5353,
+			DstIP: net.ParseIP("ff02::fb"), DstPort: 5353,
+			Packets: 1, Bytes: 40,
+			Start: start.Add(time.Second), End: start.Add(time.Second),
+		},
+	}
+}
+
+func TestIPFIXExporter(t *testing.T) {
+	var out messages
+	e := NewIPFIXExporter(&out, 7)
+	assert.NoError(t, e.Export(testRecords()))
+	assert.NoError(t, e.Export(testRecords()[:1]))
+
+	// IPv4 and IPv6 flows go in separate messages.
+	if !assert.Len(t, out, 3) {
+		return
+	}
+	m := out[0]
+	assert.Equal(t, uint16(10), binary.BigEndian.Uint16(m[0:]))
+	assert.Equal(t, len(m), int(binary.BigEndian.Uint16(m[2:])))
+	assert.Equal(t, uint32(start.Unix()+1), binary.BigEndian.Uint32(m[4:]))
+	assert.Equal(t, uint32(0), binary.BigEndian.Uint32(m[8:]))
+	assert.Equal(t, uint32(7), binary.BigEndian.Uint32(m[12:]))
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(out[2][8:]))
+
+	// Template set: 10 fields.
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(m[16:]))
+	assert.Equal(t, uint16(48), binary.BigEndian.Uint16(m[18:]))
+	assert.Equal(t, uint16(256), binary.BigEndian.Uint16(m[20:]))
+	assert.Equal(t, uint16(10), binary.BigEndian.Uint16(m[22:]))
+
+	// Data set with one record of 46 bytes.
+	data := m[16+48:]
+	assert.Equal(t, uint16(256), binary.BigEndian.Uint16(data[0:]))
+	assert.Equal(t, uint16(50), binary.BigEndian.Uint16(data[2:]))
+	rec := data[4:]
+	assert.Equal(t, []byte{10, 0, 0, 1, 10, 0, 0, 2}, rec[0:8])
+	assert.Equal(t, uint16(40000), binary.BigEndian.Uint16(rec[8:]))
+	assert.Equal(t, uint16(80), binary.BigEndian.Uint16(rec[10:]))
+	assert.Equal(t, uint8(6), rec[12])
+	assert.Equal(t, TCPFlagSYN|TCPFlagACK, rec[13])
+	assert.Equal(t, uint64(3), binary.BigEndian.Uint64(rec[14:]))
+	assert.Equal(t, uint64(100), binary.BigEndian.Uint64(rec[22:]))
+	assert.Equal(t, uint64(start.UnixMilli()), binary.BigEndian.Uint64(rec[30:]))
+	assert.Equal(t, uint64(start.UnixMilli()+1500), binary.BigEndian.Uint64(rec[38:]))
+
+	v6 := out[1]
+	assert.Equal(t, uint16(257), binary.BigEndian.Uint16(v6[16+48:]))
+	assert.Equal(t, net.ParseIP("fe80::1").To16(), net.IP(v6[16+48+4:16+48+20]))
+}
+
+func TestNetFlowV9Exporter(t *testing.T) {
+	var out messages
+	e := NewNetFlowV9Exporter(&out, 3)
+	assert.NoError(t, e.Export(testRecords()[:1]))
+	if !assert.Len(t, out, 1) {
+		return
+	}
+
+	m := out[0]
+	assert.Equal(t, uint16(9), binary.BigEndian.Uint16(m[0:]))
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(m[2:]))
+	assert.Equal(t, uint32(1500), binary.BigEndian.Uint32(m[4:]))
+	assert.Equal(t, uint32(start.Unix()+1), binary.BigEndian.Uint32(m[8:]))
+	assert.Equal(t, uint32(3), binary.BigEndian.Uint32(m[16:]))
+	assert.Equal(t, 0, len(m)%4)
+
+	data := m[20+48:]
+	assert.Equal(t, uint16(256), binary.BigEndian.Uint16(data[0:]))
+	// 4 + 38 bytes, padded.
+	assert.Equal(t, uint16(44), binary.BigEndian.Uint16(data[2:]))
+	rec := data[4:]
+	assert.Equal(t, uint32(0), binary.BigEndian.Uint32(rec[30:]))
+	assert.Equal(t, uint32(1500), binary.BigEndian.Uint32(rec[34:]))
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewJSONExporter(&buf).Export(testRecords()))
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 2) {
+		var r Record
+		assert.NoError(t, json.Unmarshal(lines[0], &r))
+		assert.Equal(t, 40000, r.SrcPort)
+		assert.Equal(t, uint64(100), r.Bytes)
+		assert.True(t, clientIP.Equal(r.SrcIP))
+	}
+}
@@ -0,0 +1,267 @@
+// Package flow rolls parsed NetTraffic up into unidirectional flow records,
+// keyed by protocol, addresses and ports like NetFlow and IPFIX, and exports
+// them as IPFIX, NetFlow v9 or JSON.
+//
+// RateMeter accounts for the same packets over fixed windows instead, by
+// connection, host and protocol.
+//
+// Records count the packets the parser reports individually: every TCP packet,
+// through its gnet.TCPPacketMetadata, and every UDP and ICMP packet. Content
+// reassembled from TCP streams, such as HTTP messages, is not counted again.
+package flow
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	// The defaults of most NetFlow exporters.
+	DefaultActiveTimeout = 30 * time.Minute
+	DefaultIdleTimeout   = 15 * time.Second
+)
+
+// TCP flags as they appear in the TCP header, for Record.TCPFlags.
+const (
+	TCPFlagFIN uint8 = 0x01
+	TCPFlagSYN uint8 = 0x02
+	TCPFlagRST uint8 = 0x04
+	TCPFlagACK uint8 = 0x10
+)
+
+// A unidirectional flow of packets sharing a protocol, addresses and ports.
+type Record struct {
+	Protocol layers.IPProtocol `json:"protocol"`
+	SrcIP    net.IP            `json:"src_ip"`
+	DstIP    net.IP            `json:"dst_ip"`
+
+	// 0 for ICMP.
+	SrcPort int `json:"src_port"`
+	DstPort int `json:"dst_port"`
+
+	Packets uint64 `json:"packets"`
+
+	// Bytes of transport payload. Headers are not counted, since the parser
+	// does not report packet sizes.
+	Bytes uint64 `json:"bytes"`
+
+	// Observation times of the first and last packets.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	// Union of the TCP flags of all packets of a TCP flow.
+	TCPFlags uint8 `json:"tcp_flags,omitempty"`
+}
+
+type Options struct {
+	// A flow is exported once it has been active this long, and a new record
+	// is started for its later packets. 0 for no limit.
+	ActiveTimeout time.Duration
+
+	// A flow is exported once no packet has been seen for this long. TCP flows
+	// are also exported once a FIN or RST is seen. 0 for no limit.
+	IdleTimeout time.Duration
+}
+
+func NewOptions() Options {
+	return Options{
+		ActiveTimeout: DefaultActiveTimeout,
+		IdleTimeout:   DefaultIdleTimeout,
+	}
+}
+
+type key struct {
+	protocol         layers.IPProtocol
+	srcIP, dstIP     netip.Addr
+	srcPort, dstPort int
+}
+
+// Aggregator accumulates flow records from NetTraffic. Timeouts are measured in
+// observation time, so captures read from files expire flows as they would
+// have been live.
+//
+// Safe for concurrent use.
+type Aggregator struct {
+	mu    sync.Mutex
+	opts  Options
+	flows map[key]*Record
+	// The latest observation time seen.
+	now time.Time
+	// The first error from exporting flows in Run.
+	err error
+}
+
+func NewAggregator(opts Options) *Aggregator {
+	return &Aggregator{
+		opts:  opts,
+		flows: map[key]*Record{},
+	}
+}
+
+// Counts t in its flow. Reports whether t was a packet that could be counted.
+func (a *Aggregator) Observe(t gnet.NetTraffic) bool {
+	protocol, bytes, flags, ok := packetOf(t)
+	if !ok {
+		return false
+	}
+	srcIP, ok1 := netip.AddrFromSlice(t.SrcIP)
+	dstIP, ok2 := netip.AddrFromSlice(t.DstIP)
+	if !ok1 || !ok2 {
+		return false
+	}
+	k := key{protocol, srcIP.Unmap(), dstIP.Unmap(), t.SrcPort, t.DstPort}
+	if protocol != layers.IPProtocolTCP && protocol != layers.IPProtocolUDP {
+		k.srcPort, k.dstPort = 0, 0
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t.ObservationTime.After(a.now) {
+		a.now = t.ObservationTime
+	}
+
+	r, ok := a.flows[k]
+	if !ok {
+		r = &Record{
+			Protocol: protocol,
+			SrcIP:    t.SrcIP,
+			DstIP:    t.DstIP,
+			SrcPort:  k.srcPort,
+			DstPort:  k.dstPort,
+			Start:    t.ObservationTime,
+		}
+		a.flows[k] = r
+	}
+	r.Packets++
+	r.Bytes += uint64(bytes)
+	r.TCPFlags |= flags
+	if t.ObservationTime.After(r.End) {
+		r.End = t.ObservationTime
+	}
+	return true
+}
+
+// Removes and returns the flows that have timed out or, for TCP, ended as of
+// the latest observation time, ordered by start time.
+func (a *Aggregator) Expire() []Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.remove(func(r *Record) bool {
+		if r.TCPFlags&(TCPFlagFIN|TCPFlagRST) != 0 {
+			return true
+		}
+		if a.opts.IdleTimeout > 0 && a.now.Sub(r.End) >= a.opts.IdleTimeout {
+			return true
+		}
+		return a.opts.ActiveTimeout > 0 && a.now.Sub(r.Start) >= a.opts.ActiveTimeout
+	})
+}
+
+// Removes and returns all flows, ordered by start time.
+func (a *Aggregator) Flush() []Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.remove(func(*Record) bool { return true })
+}
+
+func (a *Aggregator) remove(expired func(*Record) bool) []Record {
+	var records []Record
+	for k, r := range a.flows {
+		if expired(r) {
+			records = append(records, *r)
+			delete(a.flows, k)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+	return records
+}
+
+// Run passes through all traffic from in, observing each, and exports flows to
+// e as they expire. The remaining flows are exported once in is closed, before
+// the returned channel is closed. Export errors are reported by Err.
+func (a *Aggregator) Run(in <-chan gnet.NetTraffic, e Exporter) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		var lastExpiry time.Time
+		for t := range in {
+			a.Observe(t)
+			// Checking every second of observation time is enough for
+			// timeouts measured in seconds.
+			if t.ObservationTime.Sub(lastExpiry) >= time.Second {
+				lastExpiry = t.ObservationTime
+				a.export(e, a.Expire())
+			}
+			out <- t
+		}
+		a.export(e, a.Flush())
+	}()
+	return out
+}
+
+// Returns the first error encountered while exporting flows from Run.
+func (a *Aggregator) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+func (a *Aggregator) export(e Exporter, records []Record) {
+	if len(records) == 0 {
+		return
+	}
+	if err := e.Export(records); err != nil {
+		a.mu.Lock()
+		if a.err == nil {
+			a.err = err
+		}
+		a.mu.Unlock()
+	}
+}
+
+// Returns the IP protocol, payload size and TCP flags of t if it reports a
+// single packet.
+func packetOf(t gnet.NetTraffic) (layers.IPProtocol, int, uint8, bool) {
+	if t.ConnectionID != uuid.Nil {
+		// Only the per-packet metadata of TCP streams is counted.
+		m, ok := t.Content.(gnet.TCPPacketMetadata)
+		if !ok {
+			return 0, 0, 0, false
+		}
+		var flags uint8
+		if m.FIN {
+			flags |= TCPFlagFIN
+		}
+		if m.SYN {
+			flags |= TCPFlagSYN
+		}
+		if m.RST {
+			flags |= TCPFlagRST
+		}
+		if m.ACK {
+			flags |= TCPFlagACK
+		}
+		return layers.IPProtocolTCP, m.PayloadLength, flags, true
+	}
+
+	switch {
+	case t.LayerType == layers.LayerTypeICMPv4.String():
+		return layers.IPProtocolICMPv4, len(t.Payload), 0, true
+	case t.LayerType == layers.LayerTypeICMPv6.String():
+		return layers.IPProtocolICMPv6, len(t.Payload), 0, true
+	case t.SrcPort != 0 || t.DstPort != 0:
+		// Everything else with ports was carried over UDP.
+		return layers.IPProtocolUDP, len(t.Payload), 0, true
+	}
+	return 0, 0, 0, false
+}
@@ -0,0 +1,118 @@
+package flow
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var (
+	clientIP = net.IPv4(10, 0, 0, 1)
+	serverIP = net.IPv4(10, 0, 0, 2)
+	start    = time.Unix(1700000000, 0)
+)
+
+func tcpPacket(id uuid.UUID, src, dst net.IP, srcPort, dstPort int, m gnet.TCPPacketMetadata, offset time.Duration) gnet.NetTraffic {
+	return gnet.NetTraffic{
+		LayerType: "TCP",
+		SrcIP:     src, SrcPort: srcPort,
+		DstIP: dst, DstPort: dstPort,
+		ConnectionID:    id,
+		Content:         m,
+		ObservationTime: start.Add(offset),
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	id := uuid.New()
+	a := NewAggregator(NewOptions())
+
+	assert.True(t, a.Observe(tcpPacket(id, clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{SYN: true}, 0)))
+	assert.True(t, a.Observe(tcpPacket(id, serverIP, clientIP, 80, 40000, gnet.TCPPacketMetadata{SYN: true, ACK: true}, time.Millisecond)))
+	assert.True(t, a.Observe(tcpPacket(id, clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{ACK: true, PayloadLength: 100}, time.Second)))
+	// Reassembled content is not a packet.
+	assert.False(t, a.Observe(gnet.NetTraffic{
+		SrcIP: clientIP, SrcPort: 40000, DstIP: serverIP, DstPort: 80,
+		ConnectionID: id, Content: gnet.HTTPRequest{}, ObservationTime: start.Add(time.Second),
+	}))
+	assert.True(t, a.Observe(gnet.NetTraffic{
+		LayerType: "DNS", SrcIP: clientIP, SrcPort: 5000, DstIP: serverIP, DstPort: 53,
+		Payload: make([]byte, 30), ObservationTime: start.Add(2 * time.Second),
+	}))
+	assert.True(t, a.Observe(gnet.NetTraffic{
+		LayerType: "ICMPv4", SrcIP: clientIP, DstIP: serverIP,
+		Payload: make([]byte, 56), ObservationTime: start.Add(20 * time.Second),
+	}))
+
+	// The TCP flows are idle, and the DNS flow is too.
+	expired := a.Expire()
+	if assert.Len(t, expired, 3) {
+		assert.Equal(t, Record{
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    clientIP, SrcPort: 40000,
+			DstIP: serverIP, DstPort: 80,
+			Packets: 2, Bytes: 100,
+			Start: start, End: start.Add(time.Second),
+			TCPFlags: TCPFlagSYN | TCPFlagACK,
+		}, expired[0])
+		assert.Equal(t, uint8(TCPFlagSYN|TCPFlagACK), expired[1].TCPFlags)
+		assert.Equal(t, layers.IPProtocolUDP, expired[2].Protocol)
+		assert.Equal(t, uint64(30), expired[2].Bytes)
+	}
+
+	rest := a.Flush()
+	if assert.Len(t, rest, 1) {
+		assert.Equal(t, layers.IPProtocolICMPv4, rest[0].Protocol)
+		assert.Equal(t, 0, rest[0].SrcPort)
+	}
+	assert.Empty(t, a.Flush())
+}
+
+func TestAggregatorEndsTCPFlows(t *testing.T) {
+	id := uuid.New()
+	a := NewAggregator(Options{})
+	a.Observe(tcpPacket(id, clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{ACK: true}, 0))
+	a.Observe(tcpPacket(id, serverIP, clientIP, 80, 40000, gnet.TCPPacketMetadata{RST: true}, time.Millisecond))
+
+	expired := a.Expire()
+	if assert.Len(t, expired, 1) {
+		assert.True(t, serverIP.Equal(expired[0].SrcIP))
+	}
+}
+
+type recordingExporter struct {
+	records []Record
+}
+
+func (e *recordingExporter) Export(records []Record) error {
+	e.records = append(e.records, records...)
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	in := make(chan gnet.NetTraffic, 3)
+	in <- tcpPacket(uuid.New(), clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{SYN: true}, 0)
+	in <- tcpPacket(uuid.New(), clientIP, serverIP, 40001, 80, gnet.TCPPacketMetadata{SYN: true}, time.Minute)
+	in <- gnet.NetTraffic{LayerType: "ARP", ObservationTime: start.Add(time.Minute)}
+	close(in)
+
+	var e recordingExporter
+	a := NewAggregator(NewOptions())
+	n := 0
+	for range a.Run(in, &e) {
+		n++
+	}
+	assert.Equal(t, 3, n)
+	assert.NoError(t, a.Err())
+	if assert.Len(t, e.records, 2) {
+		// The first flow expired before the second was flushed.
+		assert.Equal(t, 40000, e.records[0].SrcPort)
+		assert.Equal(t, 40001, e.records[1].SrcPort)
+	}
+}
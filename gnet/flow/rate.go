@@ -0,0 +1,381 @@
+package flow
+
+import (
+	"net"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	DefaultRateWindow         = 10 * time.Second
+	DefaultRateMaxConnections = 100
+	DefaultRateMaxHosts       = 100
+)
+
+// Counts of what was seen during a window, and their rates over the window.
+type Rate struct {
+	Packets  uint64 `json:"packets"`
+	Bytes    uint64 `json:"bytes"`
+	Requests uint64 `json:"requests"`
+
+	BytesPerSecond    float64 `json:"bytes_per_second"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// The traffic of a connection in both directions. The endpoints are those of
+// the first traffic seen on it.
+type ConnectionRate struct {
+	// Nil for traffic without a connection, such as UDP, which is told apart
+	// by its endpoints.
+	ConnectionID uuid.UUID `json:"connection_id"`
+
+	Protocol string `json:"protocol"`
+	SrcIP    net.IP `json:"src_ip"`
+	DstIP    net.IP `json:"dst_ip"`
+	SrcPort  int    `json:"src_port"`
+	DstPort  int    `json:"dst_port"`
+
+	Rate
+}
+
+// The traffic sent to a host.
+type HostRate struct {
+	Host net.IP `json:"host"`
+	Rate
+}
+
+type ProtocolRate struct {
+	Protocol string `json:"protocol"`
+	Rate
+}
+
+// The traffic seen during one window. Connections and hosts are ordered by
+// bytes, most first, and protocols by name.
+type RateReport struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+
+	Connections []ConnectionRate `json:"connections"`
+	Hosts       []HostRate       `json:"hosts"`
+	Protocols   []ProtocolRate   `json:"protocols"`
+
+	// The traffic of all connections and hosts, including those left out of
+	// the report.
+	Total Rate `json:"total"`
+}
+
+type RateOptions struct {
+	// Length of the windows that traffic is accounted over. Windows start at
+	// multiples of it, in observation time.
+	Window time.Duration
+
+	// Most connections and hosts included in a report. 0 for no limit.
+	MaxConnections int
+	MaxHosts       int
+}
+
+func NewRateOptions() RateOptions {
+	return RateOptions{
+		Window:         DefaultRateWindow,
+		MaxConnections: DefaultRateMaxConnections,
+		MaxHosts:       DefaultRateMaxHosts,
+	}
+}
+
+type connectionKey struct {
+	id       uuid.UUID
+	protocol layers.IPProtocol
+	// Ordered, so that both directions share a key.
+	a, b netip.AddrPort
+}
+
+type connectionState struct {
+	rate ConnectionRate
+
+	// Whether the connection was seen in the current window.
+	active bool
+}
+
+// RateMeter accounts for packets, bytes and requests by connection,
+// destination host and protocol over fixed windows of observation time, and
+// reports each window once traffic after it is seen. Windows in which nothing
+// was seen are not reported. Packets and bytes are counted as by Aggregator.
+// Requests are HTTP, DNS, FTP and SMTP requests.
+//
+// The protocol of a TCP connection is learned from its parsed content, and is
+// forgotten once the connection is idle for a whole window. Other traffic is
+// accounted under its layer type, such as DNS or ICMPv4.
+//
+// Safe for concurrent use.
+type RateMeter struct {
+	opts RateOptions
+
+	mu          sync.Mutex
+	start       time.Time // of the current window, zero before any traffic
+	connections map[connectionKey]*connectionState
+	hosts       map[netip.Addr]*HostRate
+}
+
+// Creates a RateMeter. If opts.Window is not positive, DefaultRateWindow is
+// used.
+func NewRateMeter(opts RateOptions) *RateMeter {
+	if opts.Window <= 0 {
+		opts.Window = DefaultRateWindow
+	}
+	return &RateMeter{
+		opts:        opts,
+		connections: map[connectionKey]*connectionState{},
+		hosts:       map[netip.Addr]*HostRate{},
+	}
+}
+
+// Run passes through all traffic from in, observing each, and calls report
+// with each window as it ends. The last window is reported once in is closed,
+// before the returned channel is closed.
+func (m *RateMeter) Run(in <-chan gnet.NetTraffic, report func(RateReport)) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range m.Observe(t) {
+				report(r)
+			}
+			out <- t
+		}
+		for _, r := range m.Flush() {
+			report(r)
+		}
+	}()
+	return out
+}
+
+// Observe accounts for t and returns the report of the window that t ended, if
+// any. Traffic observed before the current window is accounted in it.
+func (m *RateMeter) Observe(t gnet.NetTraffic) []RateReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var reports []RateReport
+	if !t.ObservationTime.IsZero() {
+		windowStart := t.ObservationTime.Truncate(m.opts.Window)
+		if m.start.IsZero() {
+			m.start = windowStart
+		} else if windowStart.After(m.start) {
+			if r, ok := m.report(); ok {
+				reports = append(reports, r)
+			}
+			m.start = windowStart
+		}
+	}
+
+	protocol, bytes, _, isPacket := packetOf(t)
+	requests := uint64(0)
+	if isRequest(t.Content) {
+		requests = 1
+	}
+	if !isPacket && requests == 0 {
+		if p, ok := applicationProtocol(t.Content); ok {
+			if c := m.connection(t, layers.IPProtocolTCP); c != nil {
+				c.rate.Protocol = p
+			}
+		}
+		return reports
+	}
+	if !isPacket {
+		protocol = layers.IPProtocolTCP
+		if t.ConnectionID == uuid.Nil {
+			protocol = layers.IPProtocolUDP
+		}
+	}
+
+	c := m.connection(t, protocol)
+	if c == nil {
+		return reports
+	}
+	if isPacket {
+		c.rate.Packets++
+		c.rate.Bytes += uint64(bytes)
+	}
+	c.rate.Requests += requests
+	// Requests that were also packets, such as DNS over UDP, say what the
+	// protocol is.
+	if p, ok := applicationProtocol(t.Content); ok {
+		c.rate.Protocol = p
+	}
+	c.active = true
+
+	dst, _ := netip.AddrFromSlice(t.DstIP)
+	dst = dst.Unmap()
+	h, ok := m.hosts[dst]
+	if !ok {
+		h = &HostRate{Host: t.DstIP}
+		m.hosts[dst] = h
+	}
+	if isPacket {
+		h.Packets++
+		h.Bytes += uint64(bytes)
+	}
+	h.Requests += requests
+	return reports
+}
+
+// Flush returns the report of the current window, if anything was seen in it.
+func (m *RateMeter) Flush() []RateReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.report()
+	m.start = time.Time{}
+	m.connections = map[connectionKey]*connectionState{}
+	if !ok {
+		return nil
+	}
+	return []RateReport{r}
+}
+
+// Returns the state of the connection that t belongs to, creating it if
+// needed, or nil if t has no addresses.
+func (m *RateMeter) connection(t gnet.NetTraffic, protocol layers.IPProtocol) *connectionState {
+	srcIP, ok1 := netip.AddrFromSlice(t.SrcIP)
+	dstIP, ok2 := netip.AddrFromSlice(t.DstIP)
+	if !ok1 || !ok2 {
+		return nil
+	}
+	src := netip.AddrPortFrom(srcIP.Unmap(), uint16(t.SrcPort))
+	dst := netip.AddrPortFrom(dstIP.Unmap(), uint16(t.DstPort))
+	if protocol != layers.IPProtocolTCP && protocol != layers.IPProtocolUDP {
+		src, dst = netip.AddrPortFrom(src.Addr(), 0), netip.AddrPortFrom(dst.Addr(), 0)
+	}
+	k := connectionKey{id: t.ConnectionID, protocol: protocol, a: src, b: dst}
+	if addrPortLess(dst, src) {
+		k.a, k.b = dst, src
+	}
+
+	c, ok := m.connections[k]
+	if !ok {
+		c = &connectionState{rate: ConnectionRate{
+			ConnectionID: t.ConnectionID,
+			Protocol:     protocol.String(),
+			SrcIP:        t.SrcIP,
+			DstIP:        t.DstIP,
+			SrcPort:      int(src.Port()),
+			DstPort:      int(dst.Port()),
+		}}
+		if protocol != layers.IPProtocolTCP && t.LayerType != "" {
+			c.rate.Protocol = t.LayerType
+		}
+		m.connections[k] = c
+	}
+	return c
+}
+
+// Returns the report of the current window and starts a new one. Reports
+// false if nothing was seen in the window.
+func (m *RateMeter) report() (RateReport, bool) {
+	r := RateReport{Start: m.start, End: m.start.Add(m.opts.Window)}
+	seconds := m.opts.Window.Seconds()
+
+	protocols := map[string]*ProtocolRate{}
+	for k, c := range m.connections {
+		if !c.active {
+			delete(m.connections, k)
+			continue
+		}
+		rate := c.rate
+		rate.Rate = withRates(rate.Rate, seconds)
+		r.Connections = append(r.Connections, rate)
+
+		p, ok := protocols[rate.Protocol]
+		if !ok {
+			p = &ProtocolRate{Protocol: rate.Protocol}
+			protocols[rate.Protocol] = p
+		}
+		p.Rate = addCounts(p.Rate, rate.Rate)
+		r.Total = addCounts(r.Total, rate.Rate)
+
+		c.rate.Rate = Rate{}
+		c.active = false
+	}
+	for _, h := range m.hosts {
+		host := *h
+		host.Rate = withRates(host.Rate, seconds)
+		r.Hosts = append(r.Hosts, host)
+	}
+	m.hosts = map[netip.Addr]*HostRate{}
+	for _, p := range protocols {
+		r.Protocols = append(r.Protocols, ProtocolRate{Protocol: p.Protocol, Rate: withRates(p.Rate, seconds)})
+	}
+	r.Total = withRates(r.Total, seconds)
+
+	sort.Slice(r.Connections, func(i, j int) bool {
+		return r.Connections[i].Bytes > r.Connections[j].Bytes
+	})
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return r.Hosts[i].Bytes > r.Hosts[j].Bytes
+	})
+	sort.Slice(r.Protocols, func(i, j int) bool {
+		return r.Protocols[i].Protocol < r.Protocols[j].Protocol
+	})
+	if m.opts.MaxConnections > 0 && len(r.Connections) > m.opts.MaxConnections {
+		r.Connections = r.Connections[:m.opts.MaxConnections]
+	}
+	if m.opts.MaxHosts > 0 && len(r.Hosts) > m.opts.MaxHosts {
+		r.Hosts = r.Hosts[:m.opts.MaxHosts]
+	}
+	return r, len(r.Connections) > 0
+}
+
+func addCounts(r, other Rate) Rate {
+	r.Packets += other.Packets
+	r.Bytes += other.Bytes
+	r.Requests += other.Requests
+	return r
+}
+
+func withRates(r Rate, seconds float64) Rate {
+	r.BytesPerSecond = float64(r.Bytes) / seconds
+	r.RequestsPerSecond = float64(r.Requests) / seconds
+	return r
+}
+
+func addrPortLess(a, b netip.AddrPort) bool {
+	if a.Addr() != b.Addr() {
+		return a.Addr().Less(b.Addr())
+	}
+	return a.Port() < b.Port()
+}
+
+func isRequest(c gnet.ParsedNetworkContent) bool {
+	switch c := c.(type) {
+	case gnet.HTTPRequest, gnet.FtpSmtpRequest:
+		return true
+	case gnet.HTTPExchange:
+		return c.Request != nil
+	case gnet.DNSRequest:
+		return !c.QR
+	}
+	return false
+}
+
+// Returns the application protocol that content reassembled from a TCP
+// connection reveals.
+func applicationProtocol(c gnet.ParsedNetworkContent) (string, bool) {
+	switch c.(type) {
+	case gnet.HTTPRequest, gnet.HTTPResponse, gnet.HTTPExchange:
+		return "HTTP", true
+	case gnet.HTTP2ConnectionPreface:
+		return "HTTP/2", true
+	case gnet.TLSClientHello, gnet.TLSServerHello, gnet.TLSHandshakeMetadata:
+		return "TLS", true
+	case gnet.DNSRequest:
+		return "DNS", true
+	}
+	return "", false
+}
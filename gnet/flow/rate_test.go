@@ -0,0 +1,89 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestRateMeter(t *testing.T) {
+	id := uuid.New()
+	m := NewRateMeter(RateOptions{Window: 10 * time.Second})
+
+	assert.Empty(t, m.Observe(tcpPacket(id, clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{ACK: true, PayloadLength: 100}, 0)))
+	assert.Empty(t, m.Observe(gnet.NetTraffic{
+		LayerType: "TCP", SrcIP: clientIP, SrcPort: 40000, DstIP: serverIP, DstPort: 80,
+		ConnectionID: id, Content: gnet.HTTPRequest{Method: "GET"}, ObservationTime: start,
+	}))
+	assert.Empty(t, m.Observe(tcpPacket(id, serverIP, clientIP, 80, 40000, gnet.TCPPacketMetadata{ACK: true, PayloadLength: 900}, time.Second)))
+	assert.Empty(t, m.Observe(gnet.NetTraffic{
+		LayerType: "DNS", SrcIP: clientIP, SrcPort: 5000, DstIP: serverIP, DstPort: 53,
+		Content: gnet.DNSRequest{}, Payload: make([]byte, 30), ObservationTime: start.Add(2 * time.Second),
+	}))
+
+	// Traffic in the next window ends the first.
+	reports := m.Observe(tcpPacket(id, clientIP, serverIP, 40000, 80, gnet.TCPPacketMetadata{ACK: true, PayloadLength: 50}, 10*time.Second))
+	if assert.Len(t, reports, 1) {
+		r := reports[0]
+		assert.Equal(t, start, r.Start)
+		assert.Equal(t, start.Add(10*time.Second), r.End)
+		assert.Equal(t, Rate{Packets: 3, Bytes: 1030, Requests: 2, BytesPerSecond: 103, RequestsPerSecond: 0.2}, r.Total)
+
+		if assert.Len(t, r.Connections, 2) {
+			c := r.Connections[0]
+			assert.Equal(t, id, c.ConnectionID)
+			assert.Equal(t, "HTTP", c.Protocol)
+			assert.True(t, clientIP.Equal(c.SrcIP))
+			assert.Equal(t, 80, c.DstPort)
+			assert.Equal(t, Rate{Packets: 2, Bytes: 1000, Requests: 1, BytesPerSecond: 100, RequestsPerSecond: 0.1}, c.Rate)
+			assert.Equal(t, "DNS", r.Connections[1].Protocol)
+		}
+		if assert.Len(t, r.Hosts, 2) {
+			assert.True(t, clientIP.Equal(r.Hosts[0].Host))
+			assert.Equal(t, uint64(900), r.Hosts[0].Bytes)
+			assert.True(t, serverIP.Equal(r.Hosts[1].Host))
+			assert.Equal(t, uint64(2), r.Hosts[1].Requests)
+		}
+		if assert.Len(t, r.Protocols, 2) {
+			assert.Equal(t, "DNS", r.Protocols[0].Protocol)
+			assert.Equal(t, "HTTP", r.Protocols[1].Protocol)
+			assert.Equal(t, uint64(1000), r.Protocols[1].Bytes)
+		}
+	}
+
+	// The connection's protocol is remembered while it stays active.
+	reports = m.Flush()
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, start.Add(10*time.Second), reports[0].Start)
+		if assert.Len(t, reports[0].Connections, 1) {
+			assert.Equal(t, "HTTP", reports[0].Connections[0].Protocol)
+			assert.Equal(t, uint64(50), reports[0].Connections[0].Bytes)
+		}
+	}
+	assert.Empty(t, m.Flush())
+}
+
+func TestRateMeterLimits(t *testing.T) {
+	m := NewRateMeter(RateOptions{Window: time.Second, MaxConnections: 1, MaxHosts: 1})
+	for i := 0; i < 3; i++ {
+		m.Observe(tcpPacket(uuid.New(), clientIP, serverIP, 40000+i, 80, gnet.TCPPacketMetadata{PayloadLength: 10 * (i + 1)}, 0))
+	}
+	m.Observe(tcpPacket(uuid.New(), serverIP, clientIP, 80, 40000, gnet.TCPPacketMetadata{PayloadLength: 5}, 0))
+
+	reports := m.Flush()
+	if assert.Len(t, reports, 1) {
+		r := reports[0]
+		if assert.Len(t, r.Connections, 1) {
+			assert.Equal(t, 40002, r.Connections[0].SrcPort)
+			assert.Equal(t, "TCP", r.Connections[0].Protocol)
+		}
+		if assert.Len(t, r.Hosts, 1) {
+			assert.True(t, serverIP.Equal(r.Hosts[0].Host))
+		}
+		assert.Equal(t, uint64(65), r.Total.Bytes)
+	}
+}
@@ -0,0 +1,162 @@
+package gnet
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// A field of a form submitted in an HTTP request body, either as
+// application/x-www-form-urlencoded or as multipart/form-data.
+type HTTPFormPart struct {
+	Name string
+
+	// The name of an uploaded file. Empty for other fields.
+	Filename string
+
+	// The content type of a multipart part, if it has one.
+	ContentType string
+
+	// The headers of a multipart part. Nil for urlencoded fields.
+	Header textproto.MIMEHeader
+
+	// The length of Payload.
+	Size int64
+
+	// The value of the field. For multipart parts, this is a view on the
+	// request body, and is only valid until the request's buffers are
+	// released. Urlencoded values are unescaped into a copy.
+	Payload memview.MemView
+}
+
+// Decodes a form in the request body into its fields, in the order they
+// appear. Returns nil if the body is not a form. If a multipart body is cut
+// short, the parts before the cut are returned along with an error.
+func (r HTTPRequest) FormParts() ([]HTTPFormPart, error) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+	default:
+		return nil, nil
+	}
+
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "identity" && !r.BodyDecompressed {
+		return nil, errors.Errorf("form body has content encoding %q", enc)
+	}
+
+	if mediaType == "multipart/form-data" {
+		boundary := params["boundary"]
+		if boundary == "" {
+			return nil, errors.New("multipart form has no boundary")
+		}
+		return parseMultipartForm(r.Body, boundary)
+	}
+	return parseURLEncodedForm(r.Body.String())
+}
+
+func parseURLEncodedForm(body string) ([]HTTPFormPart, error) {
+	var parts []HTTPFormPart
+	for _, field := range strings.Split(body, "&") {
+		if field == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(field, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			return parts, errors.Wrap(err, "invalid form field name")
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return parts, errors.Wrapf(err, "invalid value for form field %q", name)
+		}
+		parts = append(parts, HTTPFormPart{
+			Name:    name,
+			Size:    int64(len(value)),
+			Payload: memview.New([]byte(value)),
+		})
+	}
+	return parts, nil
+}
+
+func parseMultipartForm(body memview.MemView, boundary string) ([]HTTPFormPart, error) {
+	// Parts are separated by the boundary at the start of a line.
+	delimiter := []byte("\r\n--" + boundary)
+
+	// Skip the preamble, if any.
+	var pos int64
+	if !bytes.HasPrefix(body.SubView(0, int64(len(delimiter)-2)).Bytes(), delimiter[2:]) {
+		if pos = body.Index(0, delimiter); pos < 0 {
+			return nil, errors.New("multipart form has no parts")
+		}
+		pos += 2
+	}
+	pos += int64(len(delimiter) - 2)
+
+	var parts []HTTPFormPart
+	for {
+		// The last delimiter is followed by "--".
+		if body.Len() >= pos+2 && body.GetByte(pos) == '-' && body.GetByte(pos+1) == '-' {
+			return parts, nil
+		}
+
+		// Skip to the end of the delimiter line.
+		nl := body.Index(pos, []byte("\n"))
+		if nl < 0 {
+			return parts, errors.New("multipart form ends before its final boundary")
+		}
+		start := nl + 1
+
+		headerEnd := emptyLineEnd(body, start)
+		if headerEnd < 0 {
+			return parts, errors.New("multipart form ends before its final boundary")
+		}
+		header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(body.SubView(start, headerEnd).Bytes()))).ReadMIMEHeader()
+		if err != nil {
+			return parts, errors.Wrap(err, "invalid multipart part header")
+		}
+
+		end := body.Index(headerEnd, delimiter)
+		if end < 0 {
+			return parts, errors.New("multipart form ends before its final boundary")
+		}
+
+		part := HTTPFormPart{
+			ContentType: header.Get("Content-Type"),
+			Header:      header,
+			Size:        end - headerEnd,
+			Payload:     body.SubView(headerEnd, end),
+		}
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+			part.Name = params["name"]
+			part.Filename = params["filename"]
+		}
+		parts = append(parts, part)
+
+		pos = end + int64(len(delimiter))
+	}
+}
+
+// Returns the position just past the first empty line at or after start, or
+// -1 if there is none.
+func emptyLineEnd(mv memview.MemView, start int64) int64 {
+	for {
+		nl := mv.Index(start, []byte("\n"))
+		if nl < 0 {
+			return -1
+		}
+		if n := nl - start; n == 0 || (n == 1 && mv.GetByte(start) == '\r') {
+			return nl + 1
+		}
+		start = nl + 1
+	}
+}
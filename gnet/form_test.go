@@ -0,0 +1,68 @@
+package gnet
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestFormPartsMultipart(t *testing.T) {
+	body := "preamble\r\n" +
+		"--xyz\r\n" +
+		"Content-Disposition: form-data; name=\"title\"\r\n" +
+		"\r\n" +
+		"hello\r\n" +
+		"--xyz\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"line 1\r\nline 2\r\n" +
+		"--xyz--\r\n"
+	r := HTTPRequest{
+		Header: http.Header{"Content-Type": {"multipart/form-data; boundary=xyz"}},
+		Body:   memview.New([]byte(body)),
+	}
+
+	parts, err := r.FormParts()
+	if assert.NoError(t, err) && assert.Len(t, parts, 2) {
+		assert.Equal(t, "title", parts[0].Name)
+		assert.Equal(t, "hello", parts[0].Payload.String())
+		assert.Equal(t, int64(5), parts[0].Size)
+
+		assert.Equal(t, "file", parts[1].Name)
+		assert.Equal(t, "a.txt", parts[1].Filename)
+		assert.Equal(t, "text/plain", parts[1].ContentType)
+		assert.Equal(t, "line 1\r\nline 2", parts[1].Payload.String())
+	}
+
+	// A truncated body keeps the complete parts.
+	r.Body = memview.New([]byte(body[:len(body)-30]))
+	parts, err = r.FormParts()
+	assert.Error(t, err)
+	assert.Len(t, parts, 1)
+}
+
+func TestFormPartsURLEncoded(t *testing.T) {
+	r := HTTPRequest{
+		Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+		Body:   memview.New([]byte("b=1&a=x+y%21&empty")),
+	}
+
+	parts, err := r.FormParts()
+	if assert.NoError(t, err) && assert.Len(t, parts, 3) {
+		assert.Equal(t, "b", parts[0].Name)
+		assert.Equal(t, "1", parts[0].Payload.String())
+		assert.Equal(t, "a", parts[1].Name)
+		assert.Equal(t, "x y!", parts[1].Payload.String())
+		assert.Equal(t, "empty", parts[2].Name)
+		assert.Equal(t, int64(0), parts[2].Size)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	parts, err = r.FormParts()
+	assert.NoError(t, err)
+	assert.Nil(t, parts)
+}
@@ -0,0 +1,48 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// Identifies the FTP data connection that a piece of traffic belongs to. The
+// FTPTracker sets this as the Content of data-connection traffic, which would
+// otherwise carry only DroppedBytes.
+type FTPData struct {
+	// The control connection on which the transfer was negotiated.
+	ControlConnectionID uuid.UUID
+
+	// The command that started the transfer, e.g. RETR, STOR or LIST, and its
+	// argument. Empty if the data arrived before the command was seen.
+	Command  string
+	Filename string
+
+	// Whether the server opened the data port (PASV or EPSV) rather than the
+	// client (PORT or EPRT).
+	Passive bool
+
+	// The number of bytes in this piece of traffic, and in the data
+	// connection so far, including this piece.
+	Length     int64
+	TotalBytes int64
+}
+
+var _ ParsedNetworkContent = (*FTPData)(nil)
+
+func (FTPData) ReleaseBuffers() {}
+
+// Summarizes a completed FTP data transfer.
+type FTPTransfer struct {
+	ControlConnectionID uuid.UUID
+	DataConnectionID    uuid.UUID
+
+	Command  string
+	Filename string
+	Passive  bool
+
+	// The number of bytes carried by the data connection.
+	TotalBytes int64
+}
+
+var _ ParsedNetworkContent = (*FTPTransfer)(nil)
+
+func (FTPTransfer) ReleaseBuffers() {}
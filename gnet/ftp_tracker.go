@@ -0,0 +1,365 @@
+package gnet
+
+import (
+	"container/list"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default time to wait for an announced FTP data connection to be opened, and
+// for an open data connection to carry more data.
+const DefaultFTPDataTimeout = 30 * time.Second
+
+// FTPTracker correlates FTP data connections with the control connections that
+// negotiated them.
+//
+// It watches control connections for PORT and EPRT commands and for replies
+// to PASV and EPSV, and expects a data connection to the announced endpoint.
+// Traffic on that data connection has its content replaced with FTPData, and
+// an FTPTransfer is emitted once the data connection closes, goes idle for the
+// timeout, or on Flush. As with PairCollector, timeouts are measured against
+// observation times in the traffic.
+type FTPTracker struct {
+	timeout time.Duration
+
+	mu sync.Mutex
+
+	// The latest transfer announced on each control connection.
+	announced map[uuid.UUID]*ftpTransfer
+
+	// Transfers waiting for their data connection, by the announced endpoint.
+	expected map[string]*list.Element
+
+	// Transfers whose data connection has been seen, by its connection ID.
+	active map[uuid.UUID]*list.Element
+
+	order *list.List // of *ftpTransfer, least recently active first
+}
+
+type ftpTransfer struct {
+	FTPTransfer
+
+	// The announced endpoint, while the data connection is expected.
+	endpoint string
+
+	// Whether the data connection has been seen to close in each direction,
+	// indexed by whether the closing side is the lower of the two endpoints.
+	fin [2]bool
+
+	// The first data-connection traffic, whose endpoints and observation time
+	// are used for the FTPTransfer.
+	first    NetTraffic
+	lastSeen time.Time
+}
+
+// Creates an FTPTracker that waits up to timeout for data connections. If
+// timeout is not positive, DefaultFTPDataTimeout is used.
+func NewFTPTracker(timeout time.Duration) *FTPTracker {
+	if timeout <= 0 {
+		timeout = DefaultFTPDataTimeout
+	}
+	return &FTPTracker{
+		timeout:   timeout,
+		announced: map[uuid.UUID]*ftpTransfer{},
+		expected:  map[string]*list.Element{},
+		active:    map[uuid.UUID]*list.Element{},
+		order:     list.New(),
+	}
+}
+
+// Run passes through all traffic from in, tagging FTP data connections and
+// adding an FTPTransfer after each one ends. Transfers still open when in is
+// closed are emitted at the end.
+func (c *FTPTracker) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, 100)
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range c.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range c.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe processes a single piece of traffic and returns the traffic that is
+// ready to be emitted as a result, starting with t itself, whose content is
+// replaced with FTPData if it belongs to a data connection.
+func (c *FTPTracker) Observe(t NetTraffic) []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := c.expire(t.ObservationTime)
+
+	switch content := t.Content.(type) {
+	case FtpSmtpRequest:
+		c.observeRequest(t, content)
+		return append(results, t)
+	case FtpSmtpResponse:
+		c.observeResponse(t, content)
+		return append(results, t)
+	}
+
+	elem := c.dataConnection(t)
+	if elem == nil {
+		return append(results, t)
+	}
+	transfer := elem.Value.(*ftpTransfer)
+	transfer.lastSeen = t.ObservationTime
+	c.order.MoveToBack(elem)
+
+	switch content := t.Content.(type) {
+	case DroppedBytes:
+		transfer.TotalBytes += int64(content)
+		t.Content = FTPData{
+			ControlConnectionID: transfer.ControlConnectionID,
+			Command:             transfer.Command,
+			Filename:            transfer.Filename,
+			Passive:             transfer.Passive,
+			Length:              int64(content),
+			TotalBytes:          transfer.TotalBytes,
+		}
+		results = append(results, t)
+	case TCPPacketMetadata:
+		results = append(results, t)
+		if content.FIN {
+			transfer.fin[directionIndex(t)] = true
+		}
+		if content.RST || (transfer.fin[0] && transfer.fin[1]) {
+			results = append(results, c.evict(elem))
+		}
+	default:
+		results = append(results, t)
+	}
+	return results
+}
+
+// Flush returns all transfers whose data connection has been seen, and
+// forgets those still expected.
+func (c *FTPTracker) Flush() []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		if r, ok := c.remove(c.order.Front()); ok {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// Handles a command on a control connection.
+func (c *FTPTracker) observeRequest(t NetTraffic, req FtpSmtpRequest) {
+	switch strings.ToUpper(req.CMD) {
+	case "PORT":
+		if ip, port, ok := parseFTPHostPort(req.Arg); ok {
+			c.announce(t, ip, port, false)
+		}
+	case "EPRT":
+		if ip, port, ok := parseFTPExtendedAddress(req.Arg); ok {
+			if ip == nil {
+				ip = t.SrcIP
+			}
+			c.announce(t, ip, port, false)
+		}
+	case "RETR", "STOR", "STOU", "APPE", "LIST", "NLST", "MLSD":
+		// Commands apply to the most recently announced data connection.
+		if transfer, ok := c.announced[t.ConnectionID]; ok && transfer.Command == "" {
+			transfer.Command = strings.ToUpper(req.CMD)
+			transfer.Filename = req.Arg
+		}
+	}
+}
+
+// Handles a reply on a control connection.
+func (c *FTPTracker) observeResponse(t NetTraffic, resp FtpSmtpResponse) {
+	switch resp.Code {
+	case "227": // Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+		start, end := strings.Index(resp.Arg, "("), strings.LastIndex(resp.Arg, ")")
+		if start < 0 || end < start {
+			return
+		}
+		if ip, port, ok := parseFTPHostPort(resp.Arg[start+1 : end]); ok {
+			c.announce(t, ip, port, true)
+		}
+	case "229": // Entering Extended Passive Mode (|||port|)
+		start, end := strings.Index(resp.Arg, "("), strings.LastIndex(resp.Arg, ")")
+		if start < 0 || end < start {
+			return
+		}
+		if ip, port, ok := parseFTPExtendedAddress(resp.Arg[start+1 : end]); ok {
+			if ip == nil {
+				ip = t.SrcIP
+			}
+			c.announce(t, ip, port, true)
+		}
+	}
+}
+
+// Records that a data connection to ip and port is expected for the control
+// connection that t belongs to.
+func (c *FTPTracker) announce(t NetTraffic, ip net.IP, port int, passive bool) {
+	transfer := &ftpTransfer{
+		FTPTransfer: FTPTransfer{
+			ControlConnectionID: t.ConnectionID,
+			Passive:             passive,
+		},
+		endpoint: endpointKey(ip, port),
+		lastSeen: t.ObservationTime,
+	}
+
+	// A new announcement replaces one that was never used.
+	if elem, ok := c.expected[transfer.endpoint]; ok {
+		c.remove(elem)
+	}
+	if old, ok := c.announced[t.ConnectionID]; ok && old.endpoint != "" {
+		if elem, ok := c.expected[old.endpoint]; ok {
+			c.remove(elem)
+		}
+	}
+
+	c.announced[t.ConnectionID] = transfer
+	c.expected[transfer.endpoint] = c.order.PushBack(transfer)
+}
+
+// Returns the transfer that t belongs to as a data connection, if any.
+func (c *FTPTracker) dataConnection(t NetTraffic) *list.Element {
+	if elem, ok := c.active[t.ConnectionID]; ok {
+		return elem
+	}
+
+	for _, endpoint := range []string{endpointKey(t.DstIP, t.DstPort), endpointKey(t.SrcIP, t.SrcPort)} {
+		elem, ok := c.expected[endpoint]
+		if !ok {
+			continue
+		}
+		transfer := elem.Value.(*ftpTransfer)
+		delete(c.expected, endpoint)
+		transfer.endpoint = ""
+		transfer.DataConnectionID = t.ConnectionID
+		transfer.first = t
+		c.active[t.ConnectionID] = elem
+		return elem
+	}
+	return nil
+}
+
+// Ends transfers that have been idle longer than the timeout as of now.
+func (c *FTPTracker) expire(now time.Time) []NetTraffic {
+	if now.IsZero() {
+		return nil
+	}
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		if now.Sub(front.Value.(*ftpTransfer).lastSeen) < c.timeout {
+			break
+		}
+		if r, ok := c.remove(front); ok {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// Removes a transfer whose data connection has been seen and returns it as an
+// FTPTransfer.
+func (c *FTPTracker) evict(elem *list.Element) NetTraffic {
+	r, _ := c.remove(elem)
+	return r
+}
+
+// Removes a transfer. If its data connection had been seen, returns the
+// resulting FTPTransfer, oriented as the data connection's first traffic.
+func (c *FTPTracker) remove(elem *list.Element) (NetTraffic, bool) {
+	transfer := c.order.Remove(elem).(*ftpTransfer)
+	if c.announced[transfer.ControlConnectionID] == transfer {
+		delete(c.announced, transfer.ControlConnectionID)
+	}
+	if transfer.endpoint != "" {
+		delete(c.expected, transfer.endpoint)
+		return NetTraffic{}, false
+	}
+	delete(c.active, transfer.DataConnectionID)
+
+	result := transfer.first
+	result.FinalPacketTime = transfer.lastSeen
+	result.Payload = nil
+	result.Content = transfer.FTPTransfer
+	return result, true
+}
+
+// Returns 0 or 1 according to which endpoint of a connection sent t, so that
+// both directions of the connection can be told apart.
+func directionIndex(t NetTraffic) int {
+	src, dst := endpointKey(t.SrcIP, t.SrcPort), endpointKey(t.DstIP, t.DstPort)
+	if src < dst {
+		return 0
+	}
+	return 1
+}
+
+// Formats an endpoint for use as a map key.
+func endpointKey(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// Parses the h1,h2,h3,h4,p1,p2 form used by PORT and the reply to PASV.
+func parseFTPHostPort(s string) (net.IP, int, bool) {
+	fields := strings.Split(strings.TrimSpace(s), ",")
+	if len(fields) != 6 {
+		return nil, 0, false
+	}
+
+	var values [6]int
+	for i, f := range fields {
+		v, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || v < 0 || v > 255 {
+			return nil, 0, false
+		}
+		values[i] = v
+	}
+
+	ip := net.IPv4(byte(values[0]), byte(values[1]), byte(values[2]), byte(values[3]))
+	return ip, values[4]<<8 | values[5], true
+}
+
+// Parses the |protocol|address|port| form of RFC 2428, used by EPRT and the
+// reply to EPSV. Returns a nil IP if the address is omitted, as it is for
+// EPSV.
+func parseFTPExtendedAddress(s string) (net.IP, int, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) < 5 {
+		return nil, 0, false
+	}
+
+	// The first character is the delimiter.
+	fields := strings.Split(s[1:], s[:1])
+	if len(fields) != 4 || fields[3] != "" {
+		return nil, 0, false
+	}
+
+	port, err := strconv.Atoi(fields[2])
+	if err != nil || port <= 0 || port > 0xffff {
+		return nil, 0, false
+	}
+
+	var ip net.IP
+	if fields[1] != "" {
+		if ip = net.ParseIP(fields[1]); ip == nil {
+			return nil, 0, false
+		}
+	}
+	return ip, port, true
+}
@@ -0,0 +1,99 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFTPTracker(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	control, passive, active := uuid.New(), uuid.New(), uuid.New()
+
+	c := NewFTPTracker(time.Second)
+
+	traffic := func(conn uuid.UUID, at time.Duration, srcIP net.IP, srcPort int, dstIP net.IP, dstPort int, content ParsedNetworkContent) NetTraffic {
+		return NetTraffic{
+			SrcIP: srcIP, SrcPort: srcPort, DstIP: dstIP, DstPort: dstPort,
+			ConnectionID:    conn,
+			Content:         content,
+			ObservationTime: start.Add(at),
+		}
+	}
+
+	// Passive mode: the client connects to the port in the 227 reply, then
+	// sends RETR.
+	c.Observe(traffic(control, 0, server, 21, client, 40000, FtpSmtpResponse{Code: "227", Arg: "Entering Passive Mode (10,0,0,2,195,80)."}))
+	c.Observe(traffic(passive, 10*time.Millisecond, client, 40001, server, 50000, TCPPacketMetadata{SYN: true}))
+	c.Observe(traffic(control, 20*time.Millisecond, client, 40000, server, 21, FtpSmtpRequest{CMD: "RETR", Arg: "report.pdf"}))
+
+	results := c.Observe(traffic(passive, 30*time.Millisecond, server, 50000, client, 40001, DroppedBytes(1000)))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, FTPData{
+			ControlConnectionID: control,
+			Command:             "RETR",
+			Filename:            "report.pdf",
+			Passive:             true,
+			Length:              1000,
+			TotalBytes:          1000,
+		}, results[0].Content)
+	}
+	c.Observe(traffic(passive, 40*time.Millisecond, server, 50000, client, 40001, DroppedBytes(500)))
+	assert.Len(t, c.Observe(traffic(passive, 50*time.Millisecond, server, 50000, client, 40001, TCPPacketMetadata{FIN: true})), 1)
+
+	results = c.Observe(traffic(passive, 60*time.Millisecond, client, 40001, server, 50000, TCPPacketMetadata{FIN: true}))
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, FTPTransfer{
+			ControlConnectionID: control,
+			DataConnectionID:    passive,
+			Command:             "RETR",
+			Filename:            "report.pdf",
+			Passive:             true,
+			TotalBytes:          1500,
+		}, results[1].Content)
+		assert.True(t, results[1].SrcIP.Equal(client))
+	}
+
+	// Active mode: the server connects to the port from EPRT.
+	c.Observe(traffic(control, time.Second, client, 40000, server, 21, FtpSmtpRequest{CMD: "EPRT", Arg: "|1|10.0.0.1|40002|"}))
+	c.Observe(traffic(control, time.Second, client, 40000, server, 21, FtpSmtpRequest{CMD: "STOR", Arg: "upload.txt"}))
+	results = c.Observe(traffic(active, time.Second, client, 40002, server, 20, DroppedBytes(42)))
+	if assert.Len(t, results, 1) {
+		data := results[0].Content.(FTPData)
+		assert.Equal(t, "STOR", data.Command)
+		assert.False(t, data.Passive)
+	}
+
+	// Unrelated traffic is untouched.
+	results = c.Observe(traffic(uuid.New(), time.Second, client, 40003, server, 80, DroppedBytes(10)))
+	assert.Equal(t, DroppedBytes(10), results[0].Content)
+
+	results = c.Flush()
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, int64(42), results[0].Content.(FTPTransfer).TotalBytes)
+	}
+}
+
+func TestParseFTPAddresses(t *testing.T) {
+	ip, port, ok := parseFTPHostPort("192,168,1,2,4,1")
+	assert.True(t, ok)
+	assert.True(t, ip.Equal(net.IP{192, 168, 1, 2}))
+	assert.Equal(t, 1025, port)
+
+	_, _, ok = parseFTPHostPort("192,168,1,2,4")
+	assert.False(t, ok)
+
+	ip, port, ok = parseFTPExtendedAddress("|||6446|")
+	assert.True(t, ok)
+	assert.Nil(t, ip)
+	assert.Equal(t, 6446, port)
+
+	ip, port, ok = parseFTPExtendedAddress("|2|::1|5282|")
+	assert.True(t, ok)
+	assert.True(t, ip.Equal(net.IPv6loopback))
+	assert.Equal(t, 5282, port)
+}
@@ -3,7 +3,11 @@ package gnet
 import (
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/martian/v3/har"
 	"github.com/mel2oo/go-pcap/memview"
@@ -159,3 +163,151 @@ func convertHARCookies(cs []har.Cookie) []*http.Cookie {
 	}
 	return results
 }
+
+// Converts the request to a HAR request. Relative URLs are made absolute using
+// the Host field and the "http" scheme, since whether the request was carried
+// over TLS is not known here.
+func (r HTTPRequest) ToHAR() *har.Request {
+	h := &har.Request{
+		Method:      r.Method,
+		HTTPVersion: harHTTPVersion(r.ProtoMajor, r.ProtoMinor),
+		Cookies:     toHARCookies(r.Cookies),
+		QueryString: []har.QueryString{},
+		HeadersSize: -1,
+		BodySize:    r.Body.Len(),
+	}
+
+	if r.URL != nil {
+		u := *r.URL
+		if u.Host == "" {
+			u.Host = r.Host
+		}
+		if u.Scheme == "" {
+			u.Scheme = "http"
+		}
+		h.URL = u.String()
+
+		for name, values := range u.Query() {
+			for _, v := range values {
+				h.QueryString = append(h.QueryString, har.QueryString{Name: name, Value: v})
+			}
+		}
+	}
+
+	// FromHAR moves the Host header into the Host field, so put it back.
+	h.Headers = toHARHeaders(r.Header)
+	if r.Host != "" && r.Header.Get("Host") == "" {
+		h.Headers = append([]har.Header{{Name: "Host", Value: r.Host}}, h.Headers...)
+	}
+
+	if r.Body.Len() > 0 {
+		h.PostData = &har.PostData{
+			MimeType: r.Header.Get("Content-Type"),
+			Params:   []har.Param{},
+			Text:     r.Body.String(),
+		}
+	}
+
+	return h
+}
+
+// Converts the response to a HAR response. Bodies that are not valid UTF-8
+// are base64-encoded.
+func (r HTTPResponse) ToHAR() *har.Response {
+	body := r.Body.Bytes()
+	h := &har.Response{
+		Status:      r.StatusCode,
+		StatusText:  http.StatusText(r.StatusCode),
+		HTTPVersion: harHTTPVersion(r.ProtoMajor, r.ProtoMinor),
+		Cookies:     toHARCookies(r.Cookies),
+		Headers:     toHARHeaders(r.Header),
+		Content: &har.Content{
+			Size:     int64(len(body)),
+			MimeType: r.Header.Get("Content-Type"),
+			Text:     body,
+		},
+		RedirectURL: r.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if !utf8.Valid(body) {
+		h.Content.Encoding = "base64"
+	}
+	return h
+}
+
+// Converts the exchange to a HAR entry. Returns an error if the request is
+// missing, since HAR requires every entry to have one.
+func (e HTTPExchange) ToHAR() (*har.Entry, error) {
+	if e.Request == nil {
+		return nil, errors.New("HAR entry requires a request")
+	}
+
+	entry := &har.Entry{
+		ID:              e.Request.GetStreamKey(),
+		StartedDateTime: e.RequestStart,
+		Request:         e.Request.ToHAR(),
+		Cache:           &har.Cache{},
+		Timings: &har.Timings{
+			Send: harDuration(e.RequestStart, e.RequestEnd),
+			Wait: -1,
+		},
+	}
+
+	if e.Response != nil {
+		entry.Response = e.Response.ToHAR()
+		entry.Timings.Wait = e.Latency.Milliseconds()
+		entry.Timings.Receive = harDuration(e.ResponseStart, e.ResponseEnd)
+		entry.Time = harDuration(e.RequestStart, e.ResponseEnd)
+	} else {
+		entry.Time = entry.Timings.Send
+	}
+
+	return entry, nil
+}
+
+func harHTTPVersion(major, minor int) string {
+	return "HTTP/" + strconv.Itoa(major) + "." + strconv.Itoa(minor)
+}
+
+// Returns the time between start and end in milliseconds, or 0 if either is
+// unknown.
+func harDuration(start, end time.Time) int64 {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Milliseconds()
+}
+
+func toHARHeaders(headers http.Header) []har.Header {
+	results := make([]har.Header, 0, len(headers))
+	for name, values := range headers {
+		for _, v := range values {
+			results = append(results, har.Header{Name: name, Value: v})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+func toHARCookies(cs []*http.Cookie) []har.Cookie {
+	results := make([]har.Cookie, 0, len(cs))
+	for _, c := range cs {
+		hc := har.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			Expires:  c.Expires,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires8601 = c.Expires.Format(time.RFC3339)
+		}
+		results = append(results, hc)
+	}
+	return results
+}
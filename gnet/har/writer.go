@@ -0,0 +1,145 @@
+// Package har writes captured HTTP traffic as a HAR (HTTP Archive) file, which
+// can be loaded into browser developer tools and other HTTP tooling.
+//
+// Entries are streamed to the output as they are written, so a large capture
+// does not need to be held in memory.
+package har
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/martian/v3/har"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	harVersion = "1.2"
+
+	DefaultCreatorName    = "go-pcap"
+	DefaultCreatorVersion = "0.1"
+)
+
+// Writer streams HAR entries to an io.Writer. The HAR document is only
+// complete once Close has been called.
+type Writer struct {
+	w       io.Writer
+	creator har.Creator
+
+	started bool
+	entries int
+	closed  bool
+}
+
+// Creates a Writer that writes to w, identifying itself as the default
+// creator.
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterWithCreator(w, DefaultCreatorName, DefaultCreatorVersion)
+}
+
+// Creates a Writer that records the given creator name and version in the HAR
+// log.
+func NewWriterWithCreator(w io.Writer, name, version string) *Writer {
+	return &Writer{
+		w:       w,
+		creator: har.Creator{Name: name, Version: version},
+	}
+}
+
+// Writes everything in the log up to the start of the entries array.
+func (w *Writer) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	creator, err := json.Marshal(w.creator)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal HAR creator")
+	}
+
+	_, err = io.WriteString(w.w, `{"log":{"version":"`+harVersion+`","creator":`+string(creator)+`,"entries":[`)
+	return errors.Wrap(err, "failed to write HAR header")
+}
+
+// Appends an entry to the log.
+func (w *Writer) WriteEntry(e *har.Entry) error {
+	if w.closed {
+		return errors.New("HAR writer is closed")
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal HAR entry")
+	}
+	if w.entries > 0 {
+		b = append([]byte{','}, b...)
+	}
+	if _, err := w.w.Write(b); err != nil {
+		return errors.Wrap(err, "failed to write HAR entry")
+	}
+
+	w.entries++
+	return nil
+}
+
+// Appends an exchange to the log. Exchanges without a request are skipped,
+// since HAR requires every entry to have one.
+func (w *Writer) WriteExchange(e gnet.HTTPExchange) error {
+	if e.Request == nil {
+		return nil
+	}
+
+	entry, err := e.ToHAR()
+	if err != nil {
+		return err
+	}
+	return w.WriteEntry(entry)
+}
+
+// Returns the number of entries written so far.
+func (w *Writer) Entries() int {
+	return w.entries
+}
+
+// Completes the HAR document. Closing does not close the underlying
+// io.Writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.closed = true
+
+	_, err := io.WriteString(w.w, "]}}\n")
+	return errors.Wrap(err, "failed to write HAR trailer")
+}
+
+// Writes every HTTPExchange received from in as a HAR document to w, and
+// releases the buffers of all traffic. Use a gnet.PairCollector to turn
+// parsed requests and responses into exchanges. Returns once in is closed.
+func WriteTraffic(w io.Writer, in <-chan gnet.NetTraffic) error {
+	hw := NewWriter(w)
+
+	var firstErr error
+	for t := range in {
+		if e, ok := t.Content.(gnet.HTTPExchange); ok && firstErr == nil {
+			firstErr = hw.WriteExchange(e)
+		}
+		if t.Content != nil {
+			t.Content.ReleaseBuffers()
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return hw.Close()
+}
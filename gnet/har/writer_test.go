@@ -0,0 +1,79 @@
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/martian/v3/har"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestWriter(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	u, _ := url.Parse("/search?q=pcap")
+
+	exchange := gnet.HTTPExchange{
+		Request: &gnet.HTTPRequest{
+			StreamID:   uuid.New(),
+			Method:     "GET",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			URL:        u,
+			Host:       "example.com",
+			Header:     http.Header{"Accept": {"*/*"}},
+		},
+		Response: &gnet.HTTPResponse{
+			StatusCode: 200,
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       memview.New([]byte("hello")),
+		},
+		RequestStart:  start,
+		RequestEnd:    start,
+		ResponseStart: start.Add(20 * time.Millisecond),
+		ResponseEnd:   start.Add(30 * time.Millisecond),
+		Latency:       20 * time.Millisecond,
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	assert.NoError(t, w.WriteExchange(exchange))
+	assert.NoError(t, w.WriteExchange(exchange))
+	assert.NoError(t, w.WriteExchange(gnet.HTTPExchange{Response: exchange.Response}))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 2, w.Entries())
+
+	var h har.HAR
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &h)) && assert.Len(t, h.Log.Entries, 2) {
+		e := h.Log.Entries[0]
+		assert.Equal(t, "http://example.com/search?q=pcap", e.Request.URL)
+		assert.Equal(t, int64(30), e.Time)
+		assert.Equal(t, int64(20), e.Timings.Wait)
+		assert.Equal(t, []byte("hello"), e.Response.Content.Text)
+
+		var req gnet.HTTPRequest
+		assert.NoError(t, req.FromHAR(e.Request))
+		assert.Equal(t, "example.com", req.Host)
+		assert.Equal(t, "pcap", req.URL.Query().Get("q"))
+	}
+}
+
+func TestEmptyWriter(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, NewWriter(&buf).Close())
+
+	var h har.HAR
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &h)) {
+		assert.Empty(t, h.Log.Entries)
+		assert.Equal(t, DefaultCreatorName, h.Log.Creator.Name)
+	}
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+// An io.Writer for a decoded message body. Keeps up to a limit of the body in
+// a buffer and hands every piece to the chunk handler, if any, so large bodies
+// can be processed without holding on to them.
+type bodySink struct {
+	buf     mempool.Buffer
+	limit   int64 // negative for no limit
+	handler func(gnet.HTTPBodyChunk)
+	logger  gnet.Logger
+
+	// Identifies the message in chunks passed to handler.
+	chunk gnet.HTTPBodyChunk
+
+	written   int64 // total body bytes seen
+	stored    int64 // body bytes kept in buf
+	truncated bool
+
+	// Set if the message ended before the body did, so that written and hash
+	// only cover part of it.
+	incomplete bool
+
+	// Hashes the whole body, if body previews are enabled.
+	hash hash.Hash
+}
+
+func newBodySink(buf mempool.Buffer, opts Options, chunk gnet.HTTPBodyChunk, contentType string) *bodySink {
+	s := &bodySink{
+		buf:     buf,
+		limit:   opts.bodyLimit(contentType),
+		handler: opts.BodyChunkHandler,
+		logger:  opts.Logger,
+		chunk:   chunk,
+	}
+	if opts.BodyPreviewLength >= 0 {
+		s.hash = sha256.New()
+	}
+	return s
+}
+
+func (s *bodySink) Write(p []byte) (int, error) {
+	if s.hash != nil {
+		s.hash.Write(p)
+	}
+	if s.handler != nil && len(p) > 0 {
+		c := s.chunk
+		c.Offset = s.written
+		c.Data = p
+		s.handler(c)
+	}
+	s.written += int64(len(p))
+
+	keep := p
+	if s.limit >= 0 && s.stored+int64(len(keep)) > s.limit {
+		keep = keep[:s.limit-s.stored]
+		s.truncated = true
+	}
+	if len(keep) == 0 {
+		return len(p), nil
+	}
+
+	n, err := s.buf.Write(keep)
+	s.stored += int64(n)
+	if err != nil {
+		if !errors.Is(err, mempool.ErrEmptyPool) {
+			return n, err
+		}
+		// Out of buffer space. Keep consuming the body so that the stream stays
+		// in sync, but stop storing it.
+		s.logger.Warnf("HTTP body on connection %s truncated to %d bytes: buffer pool is empty",
+			s.chunk.StreamID, s.stored)
+		s.limit = s.stored
+		s.truncated = true
+	}
+	return len(p), nil
+}
+
+// Returns the hex-encoded hash of the whole body, or "" if it is not hashed.
+func (s *bodySink) sum() string {
+	if s.hash == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.hash.Sum(nil))
+}
+
+// Signals the end of the body to the chunk handler.
+func (s *bodySink) finish() {
+	if s.handler != nil {
+		c := s.chunk
+		c.Offset = s.written
+		c.Final = true
+		s.handler(c)
+	}
+}
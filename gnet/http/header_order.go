@@ -0,0 +1,32 @@
+package http
+
+import (
+	"strings"
+)
+
+// Returns the header names in a start line and header block, in order and
+// with their case, which net/http discards. Returns nil if the block is
+// incomplete.
+func headerNames(block []byte) []string {
+	lines := strings.Split(string(block), "\n")
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// Skip the request line.
+	var names []string
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			return names
+		}
+		// Continuation of an obsolete folded header.
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if name, _, ok := strings.Cut(line, ":"); ok {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package http
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Most request methods remembered for responses not parsed yet. The oldest
+// are forgotten first.
+const maxPendingMethods = 4096
+
+// Identifies a request and its response, as pairSeq does in HTTPBodyChunk.
+type methodKey struct {
+	connectionID uuid.UUID
+	pairSeq      int
+}
+
+// Remembers the methods of requests whose responses have no body regardless
+// of their headers, so that the response parser on the other side of the
+// connection frames them correctly. Safe for concurrent use.
+type requestMethods struct {
+	mu      sync.Mutex
+	methods map[methodKey]string
+	order   []methodKey // ring of keys, for forgetting the oldest
+	next    int
+}
+
+func newRequestMethods() *requestMethods {
+	return &requestMethods{methods: map[methodKey]string{}}
+}
+
+// Records the method of a request, if it affects how its response is parsed.
+func (m *requestMethods) record(k methodKey, method string) {
+	if method != http.MethodHead {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.order) < maxPendingMethods {
+		m.order = append(m.order, k)
+	} else {
+		delete(m.methods, m.order[m.next])
+		m.order[m.next] = k
+		m.next = (m.next + 1) % maxPendingMethods
+	}
+	m.methods[k] = method
+}
+
+// Returns and forgets the method recorded for k, or "" if none was.
+func (m *requestMethods) take(k methodKey) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	method := m.methods[k]
+	delete(m.methods, k)
+	return method
+}
+
+// Reports whether a response with the given status, to a request with the
+// given method, can have a body. An empty method is assumed to be GET.
+func responseHasBody(method string, status int) bool {
+	switch {
+	case method == http.MethodHead:
+		return false
+	case status >= 100 && status < 200, status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package http
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	// Passed to WithMaxBodyLength to keep bodies of any length.
+	NoBodyLimit int64 = -1
+
+	// Passed to WithMaxLength to parse messages of any length.
+	NoLengthLimit int64 = -1
+
+	DefaultMaxLength int64 = 1024 * 1024
+
+	DefaultMaxHeaderLength int64 = http.DefaultMaxHeaderBytes
+)
+
+type Options struct {
+	// Maximum number of bytes of a message, headers and body included, that
+	// are parsed. A longer message is cut short and marked as Truncated.
+	// Negative for no limit.
+	MaxLength int64
+
+	// Maximum length of the start line and headers of a message, and of the
+	// trailers of a chunked body. Messages with longer headers are not parsed.
+	MaxHeaderLength int64
+
+	// Maximum number of decoded body bytes kept in a parsed request or
+	// response. The rest of the body is still parsed, but discarded, and the
+	// message is marked as Truncated. Negative for no limit.
+	//
+	// Since the memory used by a capped body is bounded, MaxLength is not
+	// enforced once a limit is set.
+	MaxBodyLength int64
+
+	// If not negative, only this many bytes are kept of the bodies with the
+	// content types in BodyPreviewTypes, as with MaxBodyLength, and the size
+	// and hash of every whole body are recorded. MaxLength is not enforced for
+	// the messages with such bodies.
+	BodyPreviewLength int64
+
+	// Media types, or prefixes ending in "/" such as "image/", of the bodies
+	// that BodyPreviewLength applies to. Empty for all bodies.
+	BodyPreviewTypes []string
+
+	// If set, called with each piece of a body as it is decoded, before the
+	// message is complete. Called from Parse.
+	BodyChunkHandler func(gnet.HTTPBodyChunk)
+
+	// Receives diagnostics, such as bodies cut short by an exhausted buffer
+	// pool.
+	Logger gnet.Logger
+}
+
+func NewOptions() Options {
+	return Options{
+		MaxLength:         DefaultMaxLength,
+		MaxHeaderLength:   DefaultMaxHeaderLength,
+		MaxBodyLength:     NoBodyLimit,
+		BodyPreviewLength: NoBodyLimit,
+		Logger:            gnet.NopLogger,
+	}
+}
+
+// Returns the number of body bytes to keep for a message with the given
+// Content-Type, or a negative number for no limit.
+func (o Options) bodyLimit(contentType string) int64 {
+	limit := o.MaxBodyLength
+	if o.BodyPreviewLength < 0 || (limit >= 0 && limit <= o.BodyPreviewLength) {
+		return limit
+	}
+	if len(o.BodyPreviewTypes) == 0 {
+		return o.BodyPreviewLength
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return limit
+	}
+	for _, t := range o.BodyPreviewTypes {
+		t = strings.ToLower(t)
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return o.BodyPreviewLength
+		}
+	}
+	return limit
+}
+
+type Option func(*Options)
+
+// Limits the number of bytes parsed per message. Ignored if the body length
+// is limited, including for the bodies that only a preview is kept of.
+func WithMaxLength(n int64) Option {
+	return func(o *Options) {
+		o.MaxLength = n
+	}
+}
+
+func WithMaxHeaderLength(n int64) Option {
+	return func(o *Options) {
+		o.MaxHeaderLength = n
+	}
+}
+
+// Limits the number of body bytes kept per message. Use 0 together with
+// WithBodyChunkHandler to stream bodies without buffering them.
+func WithMaxBodyLength(n int64) Option {
+	return func(o *Options) {
+		o.MaxBodyLength = n
+	}
+}
+
+// Keeps only the first n bytes of bodies with the given media types, or with
+// any type if none are given, and records the size and SHA-256 hash of all
+// bodies. Types ending in "/", such as "image/", match all their subtypes.
+func WithBodyPreview(n int64, types ...string) Option {
+	return func(o *Options) {
+		o.BodyPreviewLength = n
+		o.BodyPreviewTypes = types
+	}
+}
+
+func WithBodyChunkHandler(f func(gnet.HTTPBodyChunk)) Option {
+	return func(o *Options) {
+		o.BodyChunkHandler = f
+	}
+}
+
+func WithLogger(l gnet.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+func applyOptions(opts []Option) Options {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -2,10 +2,13 @@ package http
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
 
-	"github.com/google/gopacket/reassembly"
 	"github.com/google/uuid"
 	"github.com/mel2oo/go-pcap/gnet"
 	"github.com/mel2oo/go-pcap/mempool"
@@ -13,39 +16,87 @@ import (
 	"github.com/pkg/errors"
 )
 
-var (
-	// Default maximum HTTP length supported.
-	// Can be altered by the CLI as a configuration setting, but doing so after parsing
-	// has started will be a race condition.
-	MaximumHTTPLength int64 = 1024 * 1024
+// Longest chunk size line accepted in a chunked body, as in net/http.
+const maxChunkLineLength = 4096
+
+// What the parser expects next.
+type parserState int
+
+const (
+	// The start line and the header block.
+	stateHeader parserState = iota
+
+	// The rest of a body of known length.
+	stateBody
+
+	// A body that lasts until the connection closes.
+	stateBodyUntilEOF
+
+	// The line starting a chunk, with its size.
+	stateChunkSize
+
+	// The rest of a chunk, and the CRLF that ends it.
+	stateChunkData
+	stateChunkEnd
+
+	// The trailer section after the last chunk.
+	stateTrailer
+
+	stateDone
 )
 
 // Parses a single HTTP request or response.
 //
-// Internally, this uses Go's HTTP parser. Go's parser is a synchronous one; we
-// convert it into an asynchronous one by running it in a goroutine.
+// The parser is an incremental state machine: the start line and headers are
+// buffered until the header block is complete, after which the body is
+// decoded into the body sink as it arrives. Go's HTTP parser is still used for
+// the header block, so that messages are validated and interpreted as by
+// net/http.
 type httpParser struct {
-	// For sending incoming bytes to the parser goroutine.
-	w *io.PipeWriter
+	bidiID  uuid.UUID
+	pairSeq int
+	pool    mempool.BufferPool
+	opts    Options
+
+	// Indicates whether this parser is for a request or a response.
+	isRequest bool
+
+	// Maximum length of HTTP request or response supported; larger requests or
+	// responses may be truncated. Negative for no limit.
+	maxHttpLength int64
+
+	state parserState
+
+	// Input that has not been consumed by the state machine yet.
+	pending memview.MemView
+
+	// Where the next line of the header block or trailer starts in pending, so
+	// that a block arriving in pieces is not rescanned from the start.
+	lineStart int64
 
 	// The total number of bytes consumed from the stream being parsed.
 	totalBytesConsumed int64
 
-	// When anything is written to this channel, it indicates that the parser
-	// goroutine is done. The value written is the resulting error, if any.
-	readClosed chan error
+	// Set once the header block is parsed.
+	req  *http.Request
+	resp *http.Response
+	body mempool.Buffer
+	sink *bodySink
 
-	// When anything is written to this channel, it indicates that the parser
-	// goroutine is done. The value written is the result of the parsing: an HTTP
-	// request or response.
-	resultChan chan gnet.ParsedNetworkContent
+	// Requests also record their header order, for fingerprinting.
+	headerOrder []string
 
-	// Indicates whether this parser is for a request or a response.
-	isRequest bool
+	// Interim responses parsed before the final one.
+	interim []gnet.HTTPInterimResponse
 
-	// Maximum length of HTTP request or response supported; larger requests or
-	// responses may be truncated.
-	maxHttpLength int64
+	trailer http.Header
+
+	// Shared with the parsers for the other direction, so that responses are
+	// parsed according to the method of their request. Nil if unknown.
+	methods *requestMethods
+
+	// Bytes left in the current body of known length or chunk.
+	remaining int64
 }
 
 var _ gnet.TCPParser = (*httpParser)(nil)
@@ -58,211 +109,356 @@ func (p *httpParser) Name() string {
 }
 
 func (p *httpParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
-	var consumedBytes int64
-	defer func() {
-		totalBytesConsumed = p.totalBytesConsumed
-
-		if err == nil {
-			return
-		}
-
-		// Adjust the number of bytes that were read by the reader but were unused.
-		switch e := err.(type) {
-		case httpPipeReaderDone:
-			result = <-p.resultChan
-			unused = input.SubView(consumedBytes-int64(e), input.Len())
-			totalBytesConsumed -= unused.Len()
-			err = nil
-		case httpPipeReaderError:
-			err = e.err
-		default:
-			err = errors.Wrap(err, "encountered unknown HTTP pipe reader error")
-		}
-	}()
-
+	p.pending.Append(input)
 	p.totalBytesConsumed += input.Len()
 
-	// The PipeWriter blocks until the reader is done consuming all the bytes.
-	consumedBytes, err = io.Copy(p.w, input.CreateReader())
-	if err != nil {
-		return
+	err = p.advance()
+
+	// If the HTTP request or response is longer than our maximum length, stop
+	// anyway, as if the connection had closed. This will leave the input stream
+	// in a state where it probably can't find the next header until the
+	// accumulated data in the reassembly buffer is all skipped.
+	tooLong := p.maxHttpLength >= 0 && p.totalBytesConsumed > p.maxHttpLength
+	if err == nil && p.state != stateDone && (isEnd || tooLong) {
+		err = p.end(tooLong)
 	}
 
-	// The reader might close (aka parse complete) after the write returns, so we
-	// need to check. We force an empty write such that:
-	// - If the parse is indeed complete, the reader no longer consumes anything,
-	// 	 so this call will block until the reader closes.
-	// - If the parse is not done yet, the empty write doesn't change things.
-	_, err = p.w.Write([]byte{})
 	if err != nil {
-		return
+		if p.body != nil {
+			p.body.Release()
+			p.body = nil
+		}
+		return nil, memview.MemView{}, p.totalBytesConsumed, err
 	}
-
-	// If the reader has not closed yet, tell it we have no more input. This case
-	// happens if there's no content-length and we're reading until connection
-	// close.
-	//
-	// Also, if the HTTP request or response is longer than our maximum length,
-	// close the pipe anyway. This will leave the input stream in a state where it
-	// probably can't find the next header until the accumulated data in the
-	// reassembly buffer is all skipped.
-	if isEnd || p.totalBytesConsumed > p.maxHttpLength {
-		p.w.Close()
-		err = <-p.readClosed
+	if p.state != stateDone {
+		return nil, memview.MemView{}, p.totalBytesConsumed, nil
 	}
 
-	return
+	unused = p.pending
+	return p.result(), unused, p.totalBytesConsumed - unused.Len(), nil
 }
 
-func newHTTPParser(isRequest bool, bidiID uuid.UUID, seq, ack reassembly.Sequence, pool mempool.BufferPool) *httpParser {
-	// Unfortunately, go's http request parser blocks. So we need to run it in a
-	// separate goroutine. This needs to be addressed as part of
-	// https://app.clubhouse.io/akita-software/story/600
-
-	// The channel on which the parsed HTTP request or response is sent.
-	resultChan := make(chan gnet.ParsedNetworkContent)
-	readClosed := make(chan error, 1)
-	r, w := io.Pipe()
-	go func() {
-		var req *http.Request
-		var resp *http.Response
-		var err error
-		br := bufio.NewReader(r)
-
-		// Create a buffer for the body.
-		//
-		// XXX This is used in a very non-local fashion. Consumers of the body are
-		// responsible for resetting the buffer, but there is no way to guarantee
-		// that this will happen.
-		body := pool.NewBuffer()
-
-		if isRequest {
-			req, err = readSingleHTTPRequest(br, body)
-		} else {
-			resp, err = readSingleHTTPResponse(br, body)
-		}
-		if err != nil {
-			err = httpPipeReaderError{
-				err:         err,
-				unusedBytes: int64(br.Buffered()),
+// Consumes as much of the pending input as possible.
+func (p *httpParser) advance() error {
+	for {
+		switch p.state {
+		case stateHeader:
+			n := p.blockLength()
+			if p.headerTooLong(n) {
+				return errors.New("HTTP header block too long")
+			}
+			if n < 0 {
+				return nil
+			}
+			block := p.consume(n).Bytes()
+			if err := p.parseHeader(block); err != nil {
+				return err
 			}
-			r.CloseWithError(err)
-			readClosed <- err
-			body.Release()
-			return
-		}
 
-		// Close the reader to signal to the pipe writer that result is ready.
-		err = httpPipeReaderDone(br.Buffered())
-		r.CloseWithError(err)
-		readClosed <- err
-
-		var c gnet.ParsedNetworkContent
-		if isRequest {
-			// Because HTTP requires the request to finish before sending a response,
-			// TCP ack number on the first segment of the HTTP request is equal to the
-			// TCP seq number on the first segment of the corresponding HTTP response.
-			// Hence we use it to differntiate differnt pairs of HTTP request and
-			// response on the same TCP stream.
-			c = gnet.FromStdRequest(uuid.UUID(bidiID), int(ack), req, body)
-		} else {
-			// Because HTTP requires the request to finish before sending a response,
-			// TCP ack number on the first segment of the HTTP request is equal to the
-			// TCP seq number on the first segment of the corresponding HTTP response.
-			// Hence we use it to differntiate differnt pairs of HTTP request and
-			// response on the same TCP stream.
-			c = gnet.FromStdResponse(uuid.UUID(bidiID), int(seq), resp, body)
-		}
-		resultChan <- c
-	}()
+		case stateBody:
+			if err := p.writeBody(p.remaining); err != nil {
+				return err
+			}
+			if p.remaining > 0 {
+				return nil
+			}
+			p.finish(false)
+
+		case stateBodyUntilEOF:
+			return p.writeBody(p.pending.Len())
+
+		case stateChunkSize:
+			nl := p.pending.Index(0, []byte("\n"))
+			if nl < 0 {
+				if p.pending.Len() > maxChunkLineLength {
+					return errors.New("HTTP chunk size line too long")
+				}
+				return nil
+			}
+			size, err := parseChunkSize(p.consume(nl + 1).Bytes())
+			if err != nil {
+				return err
+			}
+			if size == 0 {
+				p.state = stateTrailer
+			} else {
+				p.remaining = size
+				p.state = stateChunkData
+			}
 
-	return &httpParser{
-		w:             w,
-		resultChan:    resultChan,
-		readClosed:    readClosed,
-		isRequest:     isRequest,
-		maxHttpLength: MaximumHTTPLength,
+		case stateChunkData:
+			if err := p.writeBody(p.remaining); err != nil {
+				return err
+			}
+			if p.remaining > 0 {
+				return nil
+			}
+			p.state = stateChunkEnd
+
+		case stateChunkEnd:
+			if p.pending.Len() < 2 {
+				return nil
+			}
+			if !bytes.Equal(p.consume(2).Bytes(), []byte("\r\n")) {
+				return errors.New("malformed chunked encoding")
+			}
+			p.state = stateChunkSize
+
+		case stateTrailer:
+			n := p.blockLength()
+			if p.headerTooLong(n) {
+				return errors.New("HTTP trailer too long")
+			}
+			if n < 0 {
+				return nil
+			}
+			if err := p.parseTrailer(p.consume(n).Bytes()); err != nil {
+				return err
+			}
+			p.finish(false)
+
+		case stateDone:
+			return nil
+		}
 	}
 }
 
-// Reads a single HTTP request, only consuming the exact number of bytes that
-// form the request and its body, but there may be unused bytes left in the
-// bufio.Reader's buffer. The request body is written into the given buffer.
-func readSingleHTTPRequest(r *bufio.Reader, body mempool.Buffer) (*http.Request, error) {
-	req, err := http.ReadRequest(r)
-	if err != nil {
-		return nil, err
+// Called when no more input is coming. A body cut short is kept and marked as
+// truncated, and a body lasting until the connection closes is complete,
+// unless it was cut short by the length limit.
+func (p *httpParser) end(tooLong bool) error {
+	switch p.state {
+	case stateHeader:
+		if p.pending.Len() == 0 {
+			return io.EOF
+		}
+		return errors.Wrap(io.ErrUnexpectedEOF, "incomplete HTTP header")
+	case stateBodyUntilEOF:
+		p.finish(tooLong)
+	default:
+		p.finish(true)
 	}
+	return nil
+}
 
-	req.URL.Scheme = "http"
-	req.URL.Host = req.Host
+// Parses the start line and header block, and prepares to read the body.
+func (p *httpParser) parseHeader(block []byte) error {
+	r := bufio.NewReaderSize(bytes.NewReader(block), len(block))
 
-	if req.Body == nil {
-		return req, nil
+	var contentLength int64
+	var transferEncoding []string
+	if p.isRequest {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return err
+		}
+		req.URL.Scheme = "http"
+		req.URL.Host = req.Host
+		p.req = req
+		p.headerOrder = headerNames(block)
+		if p.methods != nil {
+			p.methods.record(methodKey{p.bidiID, p.pairSeq}, req.Method)
+		}
+		contentLength, transferEncoding = req.ContentLength, req.TransferEncoding
+	} else {
+		resp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			return err
+		}
+
+		// Interim responses have no body. Keep them with the final response,
+		// which follows.
+		if resp.StatusCode >= 100 && resp.StatusCode < 200 && resp.StatusCode != http.StatusSwitchingProtocols {
+			p.interim = append(p.interim, gnet.HTTPInterimResponse{
+				StatusCode: resp.StatusCode,
+				Header:     resp.Header,
+			})
+			return nil
+		}
+		p.resp = resp
+		contentLength, transferEncoding = resp.ContentLength, resp.TransferEncoding
+
+		// The method of the request is only known if it was parsed by the
+		// paired request parser. Otherwise, a GET request is assumed, so if this
+		// is actually a response to a HEAD request and the Content-Length
+		// header is present, the bytes after the end of the response will be
+		// treated as a response body.
+		var method string
+		if p.methods != nil {
+			method = p.methods.take(methodKey{p.bidiID, p.pairSeq})
+		}
+		if !responseHasBody(method, resp.StatusCode) {
+			contentLength, transferEncoding = 0, nil
+		}
 	}
 
-	// Read the body to move the reader's position to the end of the body.
-	_, bodyErr := io.Copy(body, req.Body)
-	req.Body.Close()
+	// Create a buffer for the body.
+	//
+	// XXX This is used in a very non-local fashion. Consumers of the body are
+	// responsible for resetting the buffer, but there is no way to guarantee
+	// that this will happen.
+	p.body = p.pool.NewBuffer()
+	var header http.Header
+	if p.isRequest {
+		header = p.req.Header
+	} else {
+		header = p.resp.Header
+	}
+	p.sink = newBodySink(p.body, p.opts, gnet.HTTPBodyChunk{
+		StreamID:  p.bidiID,
+		Seq:       p.pairSeq,
+		IsRequest: p.isRequest,
+	}, header.Get("Content-Type"))
+	// As with MaxBodyLength, a body of which only a preview is kept takes
+	// bounded memory, so it is parsed to its end to count and hash all of it.
+	if p.sink.limit >= 0 {
+		p.maxHttpLength = -1
+	}
 
+	// net/http has already checked the framing headers: a chunked message
+	// reports a negative length, and so does a response without a length,
+	// which lasts until the connection closes.
 	switch {
-	case
-		errors.Is(bodyErr, io.ErrUnexpectedEOF),
-		errors.Is(bodyErr, mempool.ErrEmptyPool):
-
-		// Let the next level try to handle a body that was truncated.
-		bodyErr = nil
+	case len(transferEncoding) > 0 && transferEncoding[0] == "chunked":
+		p.state = stateChunkSize
+	case contentLength > 0:
+		p.remaining = contentLength
+		p.state = stateBody
+	case contentLength < 0:
+		p.state = stateBodyUntilEOF
+	default:
+		p.finish(false)
 	}
-
-	return req, bodyErr
+	return nil
 }
 
-// Reads a single HTTP response, only consuming the exact number of bytes that
-// form the response and its body, but there may be unused bytes left in the
-// bufio.Reader's buffer. The response body is written into the given buffer.
-func readSingleHTTPResponse(r *bufio.Reader, body mempool.Buffer) (*http.Response, error) {
-	// XXX BUG Because a nil http.Request is provided to ReadResponse, the http
-	// library assumes a GET request. If this is actually a response to a HEAD
-	// request and the Content-Length header is present, the library will treat
-	// the bytes after the end of the response as a response body.
-	resp, err := http.ReadResponse(r, nil)
+// Parses the trailer section that ends a chunked body.
+func (p *httpParser) parseTrailer(block []byte) error {
+	if len(bytes.TrimSpace(block)) == 0 {
+		return nil
+	}
+	h, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(block))).ReadMIMEHeader()
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "invalid HTTP trailer")
 	}
+	p.trailer = http.Header(h)
+	return nil
+}
 
-	if resp.Body == nil {
-		return resp, nil
+// Returns the length of the lines at the start of pending up to and including
+// the first empty one, or -1 if there is no empty line yet.
+func (p *httpParser) blockLength() int64 {
+	for {
+		nl := p.pending.Index(p.lineStart, []byte("\n"))
+		if nl < 0 {
+			return -1
+		}
+		if n := nl - p.lineStart; n == 0 || (n == 1 && p.pending.GetByte(p.lineStart) == '\r') {
+			p.lineStart = 0
+			return nl + 1
+		}
+		p.lineStart = nl + 1
 	}
+}
 
-	// Read the body to move the reader's position to the end of the body.
-	_, bodyErr := io.Copy(body, resp.Body)
-	resp.Body.Close()
+// Reports whether a header block or trailer of length n, or -1 if it is still
+// incomplete, exceeds the header length limit.
+func (p *httpParser) headerTooLong(n int64) bool {
+	limit := p.opts.MaxHeaderLength
+	if limit < 0 {
+		return false
+	}
+	if n < 0 {
+		return p.pending.Len() > limit
+	}
+	return n > limit
+}
 
-	switch {
-	case
-		errors.Is(bodyErr, io.ErrUnexpectedEOF),
-		errors.Is(bodyErr, mempool.ErrEmptyPool):
+// Removes the first n bytes from pending and returns them.
+func (p *httpParser) consume(n int64) memview.MemView {
+	v := p.pending.SubView(0, n)
+	p.pending = p.pending.SubView(n, p.pending.Len())
+	return v
+}
 
-		// Let the next level try to handle a body that was truncated.
-		bodyErr = nil
+// Writes up to n pending bytes to the body, counting them off remaining.
+func (p *httpParser) writeBody(n int64) error {
+	if n > p.pending.Len() {
+		n = p.pending.Len()
 	}
-
-	return resp, bodyErr
+	if n == 0 {
+		return nil
+	}
+	data := p.consume(n)
+	p.remaining -= n
+	_, err := data.CreateReader().WriteTo(p.sink)
+	return err
 }
 
-// Indicates the pipe reader has successfully completed parsing. The integer
-// specifies the number of bytes read from the pipe writer but were unused.
-type httpPipeReaderDone int64
+// Completes the message. If truncated, it was cut short before the end of its
+// body.
+func (p *httpParser) finish(truncated bool) {
+	if truncated {
+		p.sink.truncated = true
+		p.sink.incomplete = true
+	}
+	p.sink.finish()
+	p.state = stateDone
+}
 
-func (httpPipeReaderDone) Error() string {
-	return "HTTP pipe reader success"
+func (p *httpParser) result() gnet.ParsedNetworkContent {
+	if p.isRequest {
+		r := gnet.FromStdRequest(p.bidiID, p.pairSeq, p.req, p.body)
+		r.Truncated = p.sink.truncated
+		r.BodyIncomplete = p.sink.incomplete
+		r.HeaderOrder = p.headerOrder
+		r.Trailer = p.trailer
+		r.BodySize = p.sink.written
+		r.BodyHash = p.sink.sum()
+		return r
+	}
+	r := gnet.FromStdResponse(p.bidiID, p.pairSeq, p.resp, p.body)
+	r.Truncated = p.sink.truncated
+	r.BodyIncomplete = p.sink.incomplete
+	r.Trailer = p.trailer
+	r.Interim = p.interim
+	r.BodySize = p.sink.written
+	r.BodyHash = p.sink.sum()
+	return r
 }
 
-type httpPipeReaderError struct {
-	err         error // the actual err
-	unusedBytes int64 // number of bytes read from the pipe writer but were unused
+// Parses the size from the line starting a chunk, ignoring chunk extensions.
+func parseChunkSize(line []byte) (int64, error) {
+	s := strings.TrimRight(string(line), "\r\n")
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	size, err := strconv.ParseUint(s, 16, 63)
+	if err != nil {
+		return 0, errors.Errorf("invalid HTTP chunk size %q", s)
+	}
+	return int64(size), nil
 }
 
-func (e httpPipeReaderError) Error() string {
-	return e.err.Error()
+// pairSeq pairs the message with the message of the other direction that has
+// the same pairSeq, and identifies it in body chunks.
+func newHTTPParser(isRequest bool, bidiID uuid.UUID, pairSeq int, pool mempool.BufferPool, opts Options, methods *requestMethods) *httpParser {
+	maxHttpLength := opts.MaxLength
+	if opts.MaxBodyLength >= 0 {
+		maxHttpLength = -1
+	}
+
+	p := &httpParser{
+		bidiID:        bidiID,
+		pairSeq:       pairSeq,
+		pool:          pool,
+		opts:          opts,
+		isRequest:     isRequest,
+		maxHttpLength: maxHttpLength,
+		methods:       methods,
+	}
+	// Header blocks can arrive a few bytes per packet.
+	p.pending.SetMaxChunks(memview.DefaultMaxChunks)
+	return p
 }
@@ -10,22 +10,40 @@ import (
 
 // Returns a factory for creating HTTP requests whose bodies will be allocated
 // from the given buffer pool.
-func NewHTTPRequestParserFactory(pool mempool.BufferPool) gnet.TCPParserFactory {
+func NewHTTPRequestParserFactory(pool mempool.BufferPool, opts ...Option) gnet.TCPParserFactory {
 	return httpRequestParserFactory{
 		bufferPool: pool,
+		opts:       applyOptions(opts),
 	}
 }
 
 // Returns a factory for creating HTTP responses whose bodies will be allocated
-// from the given buffer pool.
-func NewHTTPResponseParserFactory(pool mempool.BufferPool) gnet.TCPParserFactory {
+// from the given buffer pool. Responses are parsed as responses to GET
+// requests; see NewHTTPParserFactories.
+func NewHTTPResponseParserFactory(pool mempool.BufferPool, opts ...Option) gnet.TCPParserFactory {
 	return httpResponseParserFactory{
 		bufferPool: pool,
+		opts:       applyOptions(opts),
+	}
+}
+
+// Returns factories for HTTP requests and responses that share the methods of
+// the requests they parse, so that responses to HEAD requests, which have no
+// body even when they have a Content-Length, are parsed correctly. The
+// request factory comes first.
+func NewHTTPParserFactories(pool mempool.BufferPool, opts ...Option) []gnet.TCPParserFactory {
+	o := applyOptions(opts)
+	methods := newRequestMethods()
+	return []gnet.TCPParserFactory{
+		httpRequestParserFactory{bufferPool: pool, opts: o, methods: methods},
+		httpResponseParserFactory{bufferPool: pool, opts: o, methods: methods},
 	}
 }
 
 type httpRequestParserFactory struct {
 	bufferPool mempool.BufferPool
+	opts       Options
+	methods    *requestMethods
 }
 
 func (httpRequestParserFactory) Name() string {
@@ -64,12 +82,27 @@ func (httpRequestParserFactory) Accepts(input memview.MemView, isEnd bool) (deci
 	return gnet.Reject, input.Len()
 }
 
+func (f httpRequestParserFactory) WithLogger(l gnet.Logger) gnet.TCPParserFactory {
+	f.opts.Logger = l
+	return f
+}
+
 func (f httpRequestParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
-	return newHTTPParser(true, id, seq, ack, f.bufferPool)
+	return newHTTPParser(true, id, pairSeq(true, seq, ack), f.bufferPool, f.opts, f.methods)
+}
+
+func (f httpRequestParserFactory) CreateExchangeParser(id uuid.UUID, exchange int) gnet.TCPParser {
+	return newHTTPParser(true, id, exchange, f.bufferPool, f.opts, f.methods)
+}
+
+func (httpRequestParserFactory) EndsExchange(gnet.ParsedNetworkContent) bool {
+	return true
 }
 
 type httpResponseParserFactory struct {
 	bufferPool mempool.BufferPool
+	opts       Options
+	methods    *requestMethods
 }
 
 func (httpResponseParserFactory) Name() string {
@@ -101,8 +134,34 @@ func (httpResponseParserFactory) Accepts(input memview.MemView, isEnd bool) (dec
 	return gnet.Reject, input.Len()
 }
 
+func (f httpResponseParserFactory) WithLogger(l gnet.Logger) gnet.TCPParserFactory {
+	f.opts.Logger = l
+	return f
+}
+
 func (f httpResponseParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
-	return newHTTPParser(false, id, seq, ack, f.bufferPool)
+	return newHTTPParser(false, id, pairSeq(false, seq, ack), f.bufferPool, f.opts, f.methods)
+}
+
+func (f httpResponseParserFactory) CreateExchangeParser(id uuid.UUID, exchange int) gnet.TCPParser {
+	return newHTTPParser(false, id, exchange, f.bufferPool, f.opts, f.methods)
+}
+
+// Interim 1xx responses are parsed together with the final response.
+func (httpResponseParserFactory) EndsExchange(gnet.ParsedNetworkContent) bool {
+	return true
+}
+
+// Because HTTP requires the request to finish before sending a response, TCP
+// ack number on the first segment of the HTTP request is equal to the TCP seq
+// number on the first segment of the corresponding HTTP response. Hence it
+// can be used to differentiate pairs of HTTP request and response on the same
+// TCP stream, as long as requests are not pipelined.
+func pairSeq(isRequest bool, seq, ack reassembly.Sequence) int {
+	if isRequest {
+		return int(ack)
+	}
+	return int(seq)
 }
 
 // Checks whether there is a valid HTTP request line as defiend in RFC 2616
@@ -0,0 +1,307 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+const chunkedResponse = "HTTP/1.1 200 OK\r\n" +
+	"Transfer-Encoding: chunked\r\n" +
+	"\r\n" +
+	"5\r\nhello\r\n" +
+	"6\r\n world\r\n" +
+	"0\r\n\r\n"
+
+func parseResponse(t *testing.T, input string, opts ...Option) gnet.HTTPResponse {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	p := NewHTTPResponseParserFactory(pool, opts...).CreateParser(uuid.New(), 0, 0)
+	result, unused, _, err := p.Parse(memview.New([]byte(input)), true)
+	if !assert.NoError(t, err) || !assert.NotNil(t, result) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(0), unused.Len())
+	return result.(gnet.HTTPResponse)
+}
+
+func TestChunkedResponse(t *testing.T) {
+	resp := parseResponse(t, chunkedResponse)
+	assert.Equal(t, "hello world", resp.Body.String())
+	assert.False(t, resp.Truncated)
+}
+
+func TestMaxBodyLength(t *testing.T) {
+	var chunks []gnet.HTTPBodyChunk
+	resp := parseResponse(t, chunkedResponse,
+		WithMaxBodyLength(3),
+		WithBodyChunkHandler(func(c gnet.HTTPBodyChunk) {
+			c.Data = append([]byte(nil), c.Data...)
+			chunks = append(chunks, c)
+		}))
+
+	assert.Equal(t, "hel", resp.Body.String())
+	assert.True(t, resp.Truncated)
+
+	var streamed []byte
+	for _, c := range chunks {
+		assert.Equal(t, int64(len(streamed)), c.Offset)
+		streamed = append(streamed, c.Data...)
+	}
+	assert.Equal(t, "hello world", string(streamed))
+	if assert.NotEmpty(t, chunks) {
+		assert.True(t, chunks[len(chunks)-1].Final)
+	}
+}
+
+func TestRequestHeaderOrder(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	input := "GET / HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"user-agent: test\r\n" +
+		"X-Folded: a\r\n" +
+		" b\r\n" +
+		"Accept: */*\r\n" +
+		"\r\n"
+	p := NewHTTPRequestParserFactory(pool).CreateParser(uuid.New(), 0, 0)
+	result, _, _, err := p.Parse(memview.New([]byte(input)), true)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		assert.Equal(t, []string{"Host", "user-agent", "X-Folded", "Accept"}, result.(gnet.HTTPRequest).HeaderOrder)
+	}
+}
+
+func TestSplitInput(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	next := "GET / HTTP/1.1\r\n"
+	input := chunkedResponse + next
+	p := NewHTTPResponseParserFactory(pool).CreateParser(uuid.New(), 0, 0)
+
+	// Feed the input a byte at a time. The response ends before the input
+	// does, and the rest is returned unused.
+	for i := 0; i < len(input); i++ {
+		result, unused, consumed, err := p.Parse(memview.New([]byte{input[i]}), false)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if result == nil {
+			continue
+		}
+		assert.Equal(t, len(chunkedResponse)-1, i)
+		assert.Equal(t, int64(len(chunkedResponse)), consumed)
+		assert.Equal(t, int64(0), unused.Len())
+		assert.Equal(t, "hello world", result.(gnet.HTTPResponse).Body.String())
+		return
+	}
+	t.Fatal("response was not parsed")
+}
+
+func TestPipelinedRequests(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	first := "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello"
+	second := "GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	p := NewHTTPRequestParserFactory(pool).CreateParser(uuid.New(), 0, 0)
+
+	result, unused, consumed, err := p.Parse(memview.New([]byte(first+second)), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		req := result.(gnet.HTTPRequest)
+		assert.Equal(t, "/a", req.URL.Path)
+		assert.Equal(t, "hello", req.Body.String())
+		assert.Equal(t, int64(len(first)), consumed)
+		assert.Equal(t, second, unused.String())
+	}
+}
+
+func TestTruncatedBody(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p := NewHTTPResponseParserFactory(pool).CreateParser(uuid.New(), 0, 0)
+	result, _, _, err := p.Parse(memview.New([]byte("HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nhello")), true)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		resp := result.(gnet.HTTPResponse)
+		assert.Equal(t, "hello", resp.Body.String())
+		assert.True(t, resp.Truncated)
+		assert.True(t, resp.BodyIncomplete)
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	header := "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n"
+	p := NewHTTPResponseParserFactory(pool, WithMaxLength(int64(len(header)+3))).CreateParser(uuid.New(), 0, 0)
+	result, _, _, err := p.Parse(memview.New([]byte(header+"hello")), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		resp := result.(gnet.HTTPResponse)
+		assert.Equal(t, "hello", resp.Body.String())
+		assert.True(t, resp.Truncated)
+	}
+
+	p = NewHTTPResponseParserFactory(pool, WithMaxHeaderLength(16)).CreateParser(uuid.New(), 0, 0)
+	_, _, _, err = p.Parse(memview.New([]byte(header)), false)
+	assert.Error(t, err)
+}
+
+func TestResponseToHEAD(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fs := NewHTTPParserFactories(pool)
+	id := uuid.New()
+
+	req := "HEAD / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	result, _, _, err := fs[0].CreateParser(id, 1, 100).Parse(memview.New([]byte(req)), false)
+	if !assert.NoError(t, err) || !assert.NotNil(t, result) {
+		return
+	}
+
+	head := "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\n"
+	next := "HTTP/1.1 204 No Content\r\nTransfer-Encoding: chunked\r\n\r\n"
+	result, unused, _, err := fs[1].CreateParser(id, 100, 1).Parse(memview.New([]byte(head+next)), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		assert.Equal(t, int64(0), result.(gnet.HTTPResponse).Body.Len())
+		assert.Equal(t, next, unused.String())
+	}
+
+	// A 204 response has no body, whatever its headers say.
+	result, unused, _, err = fs[1].CreateParser(id, 200, 1).Parse(unused, false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		assert.Equal(t, 204, result.(gnet.HTTPResponse).StatusCode)
+		assert.Equal(t, int64(0), unused.Len())
+	}
+}
+
+func TestExchangeParser(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	f := NewHTTPParserFactories(pool)[1].(gnet.TCPExchangeParserFactory)
+	assert.True(t, f.EndsExchange(gnet.HTTPResponse{StatusCode: 200}))
+
+	result, _, _, err := f.CreateExchangeParser(uuid.New(), 3).Parse(memview.New([]byte("HTTP/1.1 204 No Content\r\n\r\n")), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		assert.Equal(t, 3, result.(gnet.HTTPResponse).Seq)
+	}
+}
+
+func TestTrailer(t *testing.T) {
+	resp := parseResponse(t, "HTTP/1.1 200 OK\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"Trailer: Checksum\r\n"+
+		"\r\n"+
+		"5\r\nhello\r\n"+
+		"0\r\n"+
+		"Checksum: abc\r\n"+
+		"\r\n")
+	assert.Equal(t, "hello", resp.Body.String())
+	assert.Equal(t, "abc", resp.Trailer.Get("Checksum"))
+
+	resp = parseResponse(t, chunkedResponse)
+	assert.Nil(t, resp.Trailer)
+}
+
+func TestInterimResponses(t *testing.T) {
+	resp := parseResponse(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\nLink: </a.css>; rel=preload\r\n\r\n"+
+		"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "ok", resp.Body.String())
+	if assert.Len(t, resp.Interim, 2) {
+		assert.Equal(t, 100, resp.Interim[0].StatusCode)
+		assert.Equal(t, 103, resp.Interim[1].StatusCode)
+		assert.Equal(t, "</a.css>; rel=preload", resp.Interim[1].Header.Get("Link"))
+	}
+}
+
+func TestBodyPreview(t *testing.T) {
+	input := "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-Length: 11\r\n\r\nhello world"
+
+	resp := parseResponse(t, input, WithBodyPreview(5, "image/"))
+	assert.Equal(t, "hello", resp.Body.String())
+	assert.True(t, resp.Truncated)
+	assert.Equal(t, int64(11), resp.BodySize)
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", resp.BodyHash)
+
+	// Other content types are kept whole, but still hashed.
+	resp = parseResponse(t, input, WithBodyPreview(5, "text/html"))
+	assert.Equal(t, "hello world", resp.Body.String())
+	assert.False(t, resp.Truncated)
+	assert.NotEmpty(t, resp.BodyHash)
+
+	resp = parseResponse(t, input)
+	assert.Equal(t, int64(11), resp.BodySize)
+	assert.Empty(t, resp.BodyHash)
+	assert.False(t, resp.BodyIncomplete)
+
+	// A body cut short by the end of the input is only partly hashed.
+	header := "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-Length: 11\r\n\r\n"
+	resp = parseResponse(t, header+"hello", WithBodyPreview(3), WithMaxLength(int64(len(header)+3)))
+	assert.Equal(t, "hel", resp.Body.String())
+	assert.True(t, resp.Truncated)
+	assert.True(t, resp.BodyIncomplete)
+	assert.Equal(t, int64(5), resp.BodySize)
+
+	// Bodies longer than MaxLength are still counted and hashed whole.
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body := strings.Repeat("a", int(2*DefaultMaxLength))
+	header = fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-Length: %d\r\n\r\n", len(body))
+	input = header + body
+	p := NewHTTPResponseParserFactory(pool, WithBodyPreview(5)).CreateParser(uuid.New(), 0, 0)
+	var result gnet.ParsedNetworkContent
+	for len(input) > 0 && result == nil {
+		n := 64 * 1024
+		if n > len(input) {
+			n = len(input)
+		}
+		result, _, _, err = p.Parse(memview.New([]byte(input[:n])), false)
+		if !assert.NoError(t, err) {
+			return
+		}
+		input = input[n:]
+	}
+	if assert.NotNil(t, result) {
+		resp = result.(gnet.HTTPResponse)
+		assert.Equal(t, "aaaaa", resp.Body.String())
+		assert.True(t, resp.Truncated)
+		assert.False(t, resp.BodyIncomplete)
+		assert.Equal(t, int64(len(body)), resp.BodySize)
+		sum := sha256.Sum256([]byte(body))
+		assert.Equal(t, hex.EncodeToString(sum[:]), resp.BodyHash)
+	}
+}
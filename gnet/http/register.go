@@ -0,0 +1,12 @@
+package http
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("http1", func(pool mempool.BufferPool) []gnet.TCPParserFactory {
+		return NewHTTPParserFactories(pool)
+	}, gnet.TextTCPParserPriority)
+}
@@ -0,0 +1,12 @@
+package http2
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("http2", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewHTTP2PrefaceParserFactory()}
+	}, gnet.FramedTCPParserPriority)
+}
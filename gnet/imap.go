@@ -0,0 +1,65 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// Represents an IMAP command sent by a client.
+type IMAPCommand struct {
+	// Identifies the TCP connection to which this command belongs.
+	ConnectionID uuid.UUID
+
+	// The tag the client chose to match the server's completion response.
+	Tag string
+
+	// The command name in upper case, e.g. "LOGIN" or "FETCH". Commands
+	// prefixed with UID are reported as e.g. "UID FETCH".
+	Command string
+
+	// The arguments, with quoted strings unquoted and literals inlined.
+	// Parenthesized lists are kept as a single argument.
+	Args []string
+
+	// Credentials from a LOGIN command.
+	Username string
+	Password string
+}
+
+var _ ParsedNetworkContent = (*IMAPCommand)(nil)
+
+func (IMAPCommand) ReleaseBuffers() {}
+
+// Represents a single response line sent by an IMAP server, including any
+// literals embedded in it.
+type IMAPResponse struct {
+	// Identifies the TCP connection to which this response belongs.
+	ConnectionID uuid.UUID
+
+	// "*" for untagged responses, "+" for continuation requests, otherwise the
+	// tag of the command being completed.
+	Tag string
+
+	// The status of a status response: OK, NO, BAD, PREAUTH or BYE. Empty for
+	// other responses.
+	Status string
+
+	// The type of an untagged data response, e.g. "CAPABILITY", "EXISTS" or
+	// "FETCH".
+	Type string
+
+	// The message sequence number of a FETCH, EXISTS, RECENT or EXPUNGE
+	// response.
+	Number uint32
+
+	// The rest of the line after Status or Type. Literals are replaced by
+	// their {size} marker.
+	Text string
+
+	// The contents of literals, in order, such as the message bodies returned
+	// by FETCH.
+	Literals [][]byte
+}
+
+var _ ParsedNetworkContent = (*IMAPResponse)(nil)
+
+func (IMAPResponse) ReleaseBuffers() {}
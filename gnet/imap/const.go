@@ -0,0 +1,91 @@
+package imap
+
+const (
+	// Maximum length of the first line we look for before rejecting input as
+	// not IMAP.
+	maxStartLineLength = 1024
+
+	// Maximum size of a command or response, including literals, that we
+	// buffer.
+	maxMessageLength = 32 * 1024 * 1024
+
+	// Tags of untagged responses and continuation requests.
+	untaggedTag     = "*"
+	continuationTag = "+"
+)
+
+var (
+	crlf = []byte("\r\n")
+
+	// Commands from RFC 3501 and common extensions.
+	imapCommands = map[string]bool{
+		"CAPABILITY":   true,
+		"NOOP":         true,
+		"LOGOUT":       true,
+		"STARTTLS":     true,
+		"AUTHENTICATE": true,
+		"LOGIN":        true,
+		"SELECT":       true,
+		"EXAMINE":      true,
+		"CREATE":       true,
+		"DELETE":       true,
+		"RENAME":       true,
+		"SUBSCRIBE":    true,
+		"UNSUBSCRIBE":  true,
+		"LIST":         true,
+		"LSUB":         true,
+		"STATUS":       true,
+		"APPEND":       true,
+		"CHECK":        true,
+		"CLOSE":        true,
+		"UNSELECT":     true,
+		"EXPUNGE":      true,
+		"SEARCH":       true,
+		"FETCH":        true,
+		"STORE":        true,
+		"COPY":         true,
+		"MOVE":         true,
+		"UID":          true,
+		"IDLE":         true,
+		"NAMESPACE":    true,
+		"ID":           true,
+		"ENABLE":       true,
+		"GETQUOTA":     true,
+		"GETQUOTAROOT": true,
+	}
+
+	// Status responses, which may be tagged or untagged.
+	statusResponses = map[string]bool{
+		"OK":      true,
+		"NO":      true,
+		"BAD":     true,
+		"PREAUTH": true,
+		"BYE":     true,
+	}
+
+	// Untagged responses that start with their type.
+	untaggedTypes = map[string]bool{
+		"CAPABILITY": true,
+		"LIST":       true,
+		"LSUB":       true,
+		"STATUS":     true,
+		"SEARCH":     true,
+		"ESEARCH":    true,
+		"FLAGS":      true,
+		"ENABLED":    true,
+		"NAMESPACE":  true,
+		"ID":         true,
+		"QUOTA":      true,
+		"QUOTAROOT":  true,
+		"SORT":       true,
+		"THREAD":     true,
+	}
+
+	// Untagged responses that start with a message number, then their type.
+	messageDataTypes = map[string]bool{
+		"EXISTS":  true,
+		"RECENT":  true,
+		"EXPUNGE": true,
+		"FETCH":   true,
+	}
+)
@@ -0,0 +1,137 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Reads a command or response line from the start of input. A line ending in
+// a literal marker such as {42} continues after the literal's bytes, which are
+// returned separately. Returns an end of -1 if input does not yet hold the
+// whole line.
+func readLine(input memview.MemView) (text string, literals [][]byte, end int64, err error) {
+	var b strings.Builder
+	var pos int64
+	for {
+		lineEnd := input.Index(pos, crlf)
+		if lineEnd < 0 {
+			if input.Len() > maxMessageLength {
+				return "", nil, 0, errors.New("IMAP line too long")
+			}
+			return "", nil, -1, nil
+		}
+
+		segment := input.SubView(pos, lineEnd).String()
+		b.WriteString(segment)
+
+		n, ok := literalLength(segment)
+		if !ok {
+			return b.String(), literals, lineEnd + int64(len(crlf)), nil
+		}
+		if n > maxMessageLength {
+			return "", nil, 0, errors.New("IMAP literal too long")
+		}
+
+		start := lineEnd + int64(len(crlf))
+		if input.Len() < start+n {
+			return "", nil, -1, nil
+		}
+		literals = append(literals, input.SubView(start, start+n).Bytes())
+		pos = start + n
+	}
+}
+
+// Returns the length of the literal announced at the end of s, if any. Accepts
+// the {n+} and {n-} forms of RFC 7888 and the ~{n} form of RFC 3516.
+func literalLength(s string) (int64, bool) {
+	if !strings.HasSuffix(s, "}") {
+		return 0, false
+	}
+	open := strings.LastIndexByte(s, '{')
+	if open < 0 {
+		return 0, false
+	}
+
+	digits := strings.TrimRight(s[open+1:len(s)-1], "+-")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Splits a line into arguments. Quoted strings are unquoted, literal markers
+// are replaced by the corresponding literals, and parenthesized lists and
+// bracketed sections are kept together.
+func tokenize(text string, literals [][]byte) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == ' ':
+			i++
+
+		case c == '"':
+			var b strings.Builder
+			i++
+			for i < len(text) && text[i] != '"' {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				b.WriteByte(text[i])
+				i++
+			}
+			tokens = append(tokens, b.String())
+			i++ // closing quote
+
+		case c == '{' || (c == '~' && i+1 < len(text) && text[i+1] == '{'):
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				tokens = append(tokens, text[i:])
+				return tokens
+			}
+			if _, ok := literalLength(text[i : i+end+1]); ok && len(literals) > 0 {
+				tokens = append(tokens, string(literals[0]))
+				literals = literals[1:]
+			} else {
+				tokens = append(tokens, text[i:i+end+1])
+			}
+			i += end + 1
+
+		default:
+			// An atom, or a parenthesized list. Either may contain nested
+			// brackets, as in BODY[HEADER.FIELDS (FROM)].
+			start := i
+			depth := 0
+			inQuote := false
+			for ; i < len(text); i++ {
+				if text[i] == ' ' && depth == 0 && !inQuote {
+					break
+				}
+				switch text[i] {
+				case '"':
+					inQuote = !inQuote
+				case '(', '[':
+					if !inQuote {
+						depth++
+					}
+				case ')', ']':
+					if !inQuote && depth > 0 {
+						depth--
+					}
+				}
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens
+}
+
+// Splits off the first space-separated word of s.
+func nextWord(s string) (word, rest string) {
+	word, rest, _ = strings.Cut(s, " ")
+	return word, rest
+}
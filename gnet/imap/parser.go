@@ -0,0 +1,136 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newIMAPParser(bidiID uuid.UUID, isRequest bool) *imapParser {
+	return &imapParser{
+		connectionID: bidiID,
+		isRequest:    isRequest,
+	}
+}
+
+// Parses a single IMAP command or response line, with any literals it
+// contains.
+type imapParser struct {
+	connectionID uuid.UUID
+	isRequest    bool
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*imapParser)(nil)
+
+func (p *imapParser) Name() string {
+	if p.isRequest {
+		return "IMAP Command Parser"
+	}
+	return "IMAP Response Parser"
+}
+
+func (parser *imapParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete IMAP line")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *imapParser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	text, literals, end, err := readLine(parser.allInput)
+	if err != nil || end < 0 {
+		return nil, 0, err
+	}
+
+	if parser.isRequest {
+		cmd, err := parseCommand(text, literals)
+		if err != nil {
+			return nil, 0, err
+		}
+		cmd.ConnectionID = parser.connectionID
+		return cmd, end, nil
+	}
+
+	resp, err := parseResponse(text, literals)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp.ConnectionID = parser.connectionID
+	return resp, end, nil
+}
+
+func parseCommand(text string, literals [][]byte) (gnet.IMAPCommand, error) {
+	tokens := tokenize(text, literals)
+	if len(tokens) < 2 {
+		return gnet.IMAPCommand{}, errors.New("malformed IMAP command")
+	}
+
+	cmd := gnet.IMAPCommand{
+		Tag:     tokens[0],
+		Command: strings.ToUpper(tokens[1]),
+		Args:    tokens[2:],
+	}
+	if cmd.Command == "UID" && len(cmd.Args) > 0 {
+		cmd.Command += " " + strings.ToUpper(cmd.Args[0])
+		cmd.Args = cmd.Args[1:]
+	}
+	if cmd.Command == "LOGIN" && len(cmd.Args) >= 2 {
+		cmd.Username, cmd.Password = cmd.Args[0], cmd.Args[1]
+	}
+	return cmd, nil
+}
+
+func parseResponse(text string, literals [][]byte) (gnet.IMAPResponse, error) {
+	tag, rest := nextWord(text)
+	resp := gnet.IMAPResponse{
+		Tag:      tag,
+		Literals: literals,
+	}
+
+	if tag == continuationTag {
+		resp.Text = rest
+		return resp, nil
+	}
+
+	word, afterWord := nextWord(rest)
+	if statusResponses[strings.ToUpper(word)] {
+		resp.Status = strings.ToUpper(word)
+		resp.Text = afterWord
+		return resp, nil
+	}
+	if tag != untaggedTag {
+		return resp, errors.New("malformed IMAP response")
+	}
+
+	if n, err := strconv.ParseUint(word, 10, 32); err == nil {
+		resp.Number = uint32(n)
+		word, afterWord = nextWord(afterWord)
+	}
+	resp.Type = strings.ToUpper(word)
+	resp.Text = afterWord
+	return resp, nil
+}
@@ -0,0 +1,118 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing IMAP commands sent by clients.
+func NewIMAPCommandParserFactory() gnet.TCPParserFactory {
+	return &imapParserFactory{isRequest: true}
+}
+
+// Returns a factory for parsing IMAP responses sent by servers.
+func NewIMAPResponseParserFactory() gnet.TCPParserFactory {
+	return &imapParserFactory{isRequest: false}
+}
+
+type imapParserFactory struct {
+	isRequest bool
+}
+
+func (f *imapParserFactory) Name() string {
+	if f.isRequest {
+		return "IMAP Command Parser Factory"
+	}
+	return "IMAP Response Parser Factory"
+}
+
+func (factory *imapParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (factory *imapParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	lineEnd := input.Index(0, crlf)
+	if lineEnd < 0 {
+		if input.Len() > maxStartLineLength {
+			return gnet.Reject, input.Len()
+		}
+		return gnet.NeedMoreData, 0
+	}
+
+	line := input.SubView(0, lineEnd).String()
+	if factory.isRequest && isCommandLine(line) {
+		return gnet.Accept, 0
+	}
+	if !factory.isRequest && isResponseLine(line) {
+		return gnet.Accept, 0
+	}
+	return gnet.Reject, input.Len()
+}
+
+func (factory *imapParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newIMAPParser(id, factory.isRequest)
+}
+
+// Reports whether line starts with a tag and a known command.
+func isCommandLine(line string) bool {
+	tag, rest := nextWord(line)
+	if !isTag(tag) {
+		return false
+	}
+	cmd, _ := nextWord(rest)
+	return imapCommands[strings.ToUpper(cmd)]
+}
+
+// Reports whether line is a continuation request, a status response, or a
+// known untagged response.
+func isResponseLine(line string) bool {
+	tag, rest := nextWord(line)
+	if tag == continuationTag {
+		return true
+	}
+	if tag != untaggedTag && !isTag(tag) {
+		return false
+	}
+
+	word, rest := nextWord(rest)
+	if statusResponses[strings.ToUpper(word)] {
+		return true
+	}
+	if tag != untaggedTag {
+		return false
+	}
+	if untaggedTypes[strings.ToUpper(word)] {
+		return true
+	}
+	if _, err := strconv.ParseUint(word, 10, 32); err == nil {
+		word, _ = nextWord(rest)
+		return messageDataTypes[strings.ToUpper(word)]
+	}
+	return false
+}
+
+// Reports whether s is a valid command tag: a non-empty string of printable
+// characters other than the IMAP specials and +.
+func isTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`(){%*"\+`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+var testConnectionID = uuid.New()
+
+// Parses one line from input with a parser from factory, returning the result
+// and the unused input.
+func parseLine(t *testing.T, factory gnet.TCPParserFactory, input string) (gnet.ParsedNetworkContent, string) {
+	decision, _ := factory.Accepts(memview.New([]byte(input)), false)
+	if !assert.Equal(t, gnet.Accept, decision, input) {
+		return nil, ""
+	}
+
+	p := factory.CreateParser(testConnectionID, 0, 0)
+	result, unused, _, err := p.Parse(memview.New([]byte(input)), false)
+	assert.NoError(t, err)
+	return result, unused.String()
+}
+
+func TestIMAPCommands(t *testing.T) {
+	f := NewIMAPCommandParserFactory()
+
+	result, unused := parseLine(t, f, "a001 LOGIN \"bob\" \"p\\\"w\"\r\na002 SELECT INBOX\r\n")
+	if cmd, ok := result.(gnet.IMAPCommand); assert.True(t, ok) {
+		assert.Equal(t, "a001", cmd.Tag)
+		assert.Equal(t, "LOGIN", cmd.Command)
+		assert.Equal(t, "bob", cmd.Username)
+		assert.Equal(t, `p"w`, cmd.Password)
+	}
+	assert.Equal(t, "a002 SELECT INBOX\r\n", unused)
+
+	result, _ = parseLine(t, f, "a003 uid fetch 1:* (FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)])\r\n")
+	if cmd, ok := result.(gnet.IMAPCommand); assert.True(t, ok) {
+		assert.Equal(t, "UID FETCH", cmd.Command)
+		assert.Equal(t, []string{"1:*", "(FLAGS BODY.PEEK[HEADER.FIELDS (FROM SUBJECT)])"}, cmd.Args)
+	}
+
+	// Credentials may be sent as literals.
+	result, _ = parseLine(t, f, "a004 LOGIN {3}\r\nbob {6}\r\nsecret\r\n")
+	if cmd, ok := result.(gnet.IMAPCommand); assert.True(t, ok) {
+		assert.Equal(t, "bob", cmd.Username)
+		assert.Equal(t, "secret", cmd.Password)
+	}
+
+	decision, _ := f.Accepts(memview.New([]byte("* OK ready\r\n")), false)
+	assert.Equal(t, gnet.Reject, decision)
+}
+
+func TestIMAPResponses(t *testing.T) {
+	f := NewIMAPResponseParserFactory()
+
+	result, _ := parseLine(t, f, "* OK [CAPABILITY IMAP4rev1] ready\r\n")
+	assert.Equal(t, gnet.IMAPResponse{ConnectionID: testConnectionID, Tag: "*", Status: "OK", Text: "[CAPABILITY IMAP4rev1] ready"}, result)
+
+	result, _ = parseLine(t, f, "* 12 EXISTS\r\n")
+	assert.Equal(t, gnet.IMAPResponse{ConnectionID: testConnectionID, Tag: "*", Type: "EXISTS", Number: 12}, result)
+
+	result, _ = parseLine(t, f, "a002 NO [AUTHENTICATIONFAILED] bad password\r\n")
+	assert.Equal(t, gnet.IMAPResponse{ConnectionID: testConnectionID, Tag: "a002", Status: "NO", Text: "[AUTHENTICATIONFAILED] bad password"}, result)
+
+	// A FETCH response whose literal contains a CRLF.
+	input := "* 1 FETCH (UID 7 BODY[] {14}\r\nSubject: x\r\n\r\n)\r\na003 OK done\r\n"
+	decision, _ := f.Accepts(memview.New([]byte(input[:20])), false)
+	assert.Equal(t, gnet.NeedMoreData, decision)
+
+	p := f.CreateParser(uuid.New(), 0, 0)
+	r, _, _, err := p.Parse(memview.New([]byte(input[:40])), false)
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	r, unused, _, err := p.Parse(memview.New([]byte(input[40:])), false)
+	if assert.NoError(t, err) {
+		resp := r.(gnet.IMAPResponse)
+		assert.Equal(t, "FETCH", resp.Type)
+		assert.Equal(t, uint32(1), resp.Number)
+		assert.Equal(t, "(UID 7 BODY[] {14})", resp.Text)
+		assert.Equal(t, [][]byte{[]byte("Subject: x\r\n\r\n")}, resp.Literals)
+		assert.Equal(t, "a003 OK done\r\n", unused.String())
+	}
+}
@@ -0,0 +1,15 @@
+package imap
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("imap", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{
+			NewIMAPCommandParserFactory(),
+			NewIMAPResponseParserFactory(),
+		}
+	}, gnet.TextTCPParserPriority)
+}
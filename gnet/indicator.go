@@ -0,0 +1,53 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// The kind of value an Indicator matches.
+type IndicatorType string
+
+const (
+	// An IP address, or a CIDR prefix.
+	IPIndicator IndicatorType = "ip"
+
+	// A domain name. Its subdomains match too.
+	DomainIndicator IndicatorType = "domain"
+
+	// The JA3 hash of a TLS client hello.
+	JA3Indicator IndicatorType = "ja3"
+
+	// An HTTP URL. The scheme is ignored, and a URL without a query matches
+	// requests for it with any query.
+	URLIndicator IndicatorType = "url"
+)
+
+// A value known to be associated with malicious activity, from a threat
+// intelligence feed.
+type Indicator struct {
+	Type  IndicatorType `json:"type"`
+	Value string        `json:"value"`
+
+	// The set the indicator was loaded from, e.g. the name of its file.
+	Source string `json:"source,omitempty"`
+
+	Description string `json:"description,omitempty"`
+}
+
+// Reports that traffic matched an Indicator. See analysis.IndicatorMatcher.
+type IndicatorMatch struct {
+	ConnectionID uuid.UUID `json:"connection_id"`
+
+	Indicator Indicator `json:"indicator"`
+
+	// Where in the traffic the indicator was found: "src_ip", "dst_ip",
+	// "dns_query", "tls_server_name", "http_host", "ja3" or "url".
+	Field string `json:"field"`
+
+	// The value found, e.g. the name of a subdomain of an indicator domain.
+	Observed string `json:"observed"`
+}
+
+var _ ParsedNetworkContent = IndicatorMatch{}
+
+func (IndicatorMatch) ReleaseBuffers() {}
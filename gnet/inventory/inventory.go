@@ -0,0 +1,480 @@
+// Package inventory builds an inventory of the HTTP API endpoints seen in
+// traffic: for each host and path template, the methods used, the status
+// codes returned and the latency of responses.
+//
+// Path templates are inferred from the paths requested. Segments that look
+// like identifiers, such as numbers, UUIDs and hashes, are replaced by
+// placeholders such as "{id}", and positions where too many distinct
+// segments are seen are taken for parameters, "{param}", as well.
+//
+// The schemas of query parameters and of JSON bodies can be inferred too, to
+// describe the endpoints of a host as an OpenAPI document.
+package inventory
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	DefaultMaxEndpoints   = 10000
+	DefaultMaxLiterals    = 50
+	DefaultLatencySamples = 1000
+
+	DefaultMaxSchemaBodySize = 1 << 20
+)
+
+type Options struct {
+	// The most endpoints tracked. Requests for new endpoints beyond that are
+	// counted in Dropped. 0 for no limit.
+	MaxEndpoints int
+
+	// The number of distinct literal segments seen at the same position of a
+	// path, after the same prefix, above which the position is taken for a
+	// parameter. 0 for no limit.
+	MaxLiterals int
+
+	// The number of latencies kept per endpoint to estimate percentiles from.
+	LatencySamples int
+
+	// Time to wait for the response to a request, or the request of a
+	// response, when pairing them. See gnet.PairCollector.
+	PairTimeout time.Duration
+
+	// Infer the schemas of query parameters and JSON bodies, for OpenAPI.
+	Schemas bool
+
+	// JSON bodies larger than this are not used to infer schemas. 0 for no
+	// limit.
+	MaxSchemaBodySize int64
+}
+
+func NewOptions() Options {
+	return Options{
+		MaxEndpoints:      DefaultMaxEndpoints,
+		MaxLiterals:       DefaultMaxLiterals,
+		LatencySamples:    DefaultLatencySamples,
+		PairTimeout:       gnet.DefaultPairTimeout,
+		Schemas:           true,
+		MaxSchemaBodySize: DefaultMaxSchemaBodySize,
+	}
+}
+
+// An API endpoint: requests to a host for paths matching a template.
+type Endpoint struct {
+	Host         string `json:"host"`
+	PathTemplate string `json:"path_template"`
+
+	// The number of requests, by method.
+	Methods map[string]uint64 `json:"methods"`
+
+	// The number of responses, by status code. Requests whose response was
+	// not seen are not counted.
+	StatusCodes map[int]uint64 `json:"status_codes,omitempty"`
+
+	Requests uint64 `json:"requests"`
+
+	// Nil if no exchange had both a request and a response.
+	Latency *Latency `json:"latency,omitempty"`
+
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Percentiles of the time between the end of requests and the start of their
+// responses, estimated from a sample of them. Durations are in nanoseconds in
+// JSON.
+type Latency struct {
+	Samples int           `json:"samples"`
+	P50     time.Duration `json:"p50"`
+	P90     time.Duration `json:"p90"`
+	P99     time.Duration `json:"p99"`
+	Max     time.Duration `json:"max"`
+}
+
+type endpointStats struct {
+	methods     map[string]uint64
+	statusCodes map[int]uint64
+	requests    uint64
+
+	// A uniform sample of the latencies of the latencyCount exchanges that had
+	// one, and the largest of them.
+	latencies    []time.Duration
+	latencyCount uint64
+	maxLatency   time.Duration
+
+	firstSeen, lastSeen time.Time
+
+	// By method, if schemas are inferred.
+	operations map[string]*operationStats
+}
+
+// What is known of the requests of an endpoint with a method.
+type operationStats struct {
+	requests uint64
+
+	// Query parameters by name.
+	query map[string]*paramStats
+
+	// Schemas of bodies by media type, nil for bodies that are not JSON, and
+	// of responses by status code.
+	requestBodies map[string]*Schema
+	responses     map[int]map[string]*Schema
+}
+
+type paramStats struct {
+	// The number of requests with the parameter.
+	count  uint64
+	schema *Schema
+}
+
+func newEndpointStats() *endpointStats {
+	return &endpointStats{
+		methods:     map[string]uint64{},
+		statusCodes: map[int]uint64{},
+		operations:  map[string]*operationStats{},
+	}
+}
+
+func (o *operationStats) merge(other *operationStats) {
+	o.requests += other.requests
+	for name, p := range other.query {
+		if mine, ok := o.query[name]; ok {
+			mine.count += p.count
+			mine.schema = mergeSchemas(mine.schema, p.schema)
+		} else {
+			o.query[name] = p
+		}
+	}
+	mergeBodies(o.requestBodies, other.requestBodies)
+	for code, bodies := range other.responses {
+		if o.responses[code] == nil {
+			o.responses[code] = map[string]*Schema{}
+		}
+		mergeBodies(o.responses[code], bodies)
+	}
+}
+
+func mergeBodies(dst, src map[string]*Schema) {
+	for mediaType, schema := range src {
+		dst[mediaType] = mergeSchemas(dst[mediaType], schema)
+	}
+}
+
+func (e *endpointStats) seen(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if e.firstSeen.IsZero() || t.Before(e.firstSeen) {
+		e.firstSeen = t
+	}
+	if t.After(e.lastSeen) {
+		e.lastSeen = t
+	}
+}
+
+func (e *endpointStats) merge(other *endpointStats) {
+	for m, n := range other.methods {
+		e.methods[m] += n
+	}
+	for code, n := range other.statusCodes {
+		e.statusCodes[code] += n
+	}
+	e.requests += other.requests
+	e.latencies = append(e.latencies, other.latencies...)
+	e.latencyCount += other.latencyCount
+	if other.maxLatency > e.maxLatency {
+		e.maxLatency = other.maxLatency
+	}
+	e.seen(other.firstSeen)
+	e.seen(other.lastSeen)
+	for method, o := range other.operations {
+		if mine, ok := e.operations[method]; ok {
+			mine.merge(o)
+		} else {
+			e.operations[method] = o
+		}
+	}
+}
+
+// Inventory accumulates API endpoints from HTTP exchanges. HTTP requests and
+// responses are paired into exchanges as they are observed, unless they
+// already were by a gnet.PairCollector.
+//
+// Safe for concurrent use.
+type Inventory struct {
+	opts  Options
+	pairs *gnet.PairCollector
+
+	mu        sync.Mutex
+	hosts     map[string]*node
+	endpoints int
+	dropped   uint64
+	rand      *rand.Rand
+}
+
+func NewInventory(opts Options) *Inventory {
+	return &Inventory{
+		opts:  opts,
+		pairs: gnet.NewPairCollector(opts.PairTimeout),
+		hosts: map[string]*node{},
+		rand:  rand.New(rand.NewSource(1)),
+	}
+}
+
+// Run passes through all traffic from in, observing each. The returned channel
+// is closed once in is closed, after requests and responses still waiting to
+// be paired are counted.
+func (inv *Inventory) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			inv.Observe(t)
+			out <- t
+		}
+		inv.Flush()
+	}()
+	return out
+}
+
+// Observe counts the HTTP exchange in t, if any, or pairs the HTTP request or
+// response in t with its other half, counting the exchange once both are
+// seen or either times out.
+func (inv *Inventory) Observe(t gnet.NetTraffic) {
+	for _, r := range inv.pairs.Observe(t) {
+		inv.observeExchange(r)
+	}
+}
+
+// Flush counts the requests and responses still waiting to be paired.
+func (inv *Inventory) Flush() {
+	for _, r := range inv.pairs.Flush() {
+		inv.observeExchange(r)
+	}
+}
+
+func (inv *Inventory) observeExchange(t gnet.NetTraffic) {
+	e, ok := t.Content.(gnet.HTTPExchange)
+	if !ok || e.Request == nil {
+		// Responses alone do not say which endpoint they came from.
+		return
+	}
+	req := e.Request
+
+	host := req.Host
+	if host == "" && req.URL != nil {
+		host = req.URL.Host
+	}
+	if host == "" && t.DstIP != nil {
+		host = net.JoinHostPort(t.DstIP.String(), strconv.Itoa(t.DstPort))
+	}
+	host = normalizeHost(host)
+	var path string
+	if req.URL != nil {
+		path = req.URL.Path
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	n, ok := inv.hosts[host]
+	if !ok {
+		n = newNode()
+		inv.hosts[host] = n
+	}
+	for _, segment := range segments(path) {
+		var merged int
+		n, merged = n.child(segment, inv.opts.MaxLiterals)
+		inv.endpoints -= merged
+	}
+	if n.endpoint == nil {
+		if inv.opts.MaxEndpoints > 0 && inv.endpoints >= inv.opts.MaxEndpoints {
+			inv.dropped++
+			return
+		}
+		n.endpoint = newEndpointStats()
+		inv.endpoints++
+	}
+
+	stats := n.endpoint
+	method := strings.ToUpper(req.Method)
+	stats.requests++
+	stats.methods[method]++
+	if e.Response != nil {
+		stats.statusCodes[e.Response.StatusCode]++
+		if e.Latency > 0 {
+			inv.sampleLatency(stats, e.Latency)
+		}
+	}
+	stats.seen(t.ObservationTime)
+	if inv.opts.Schemas {
+		inv.observeOperation(stats, method, e)
+	}
+}
+
+func (inv *Inventory) observeOperation(stats *endpointStats, method string, e gnet.HTTPExchange) {
+	o, ok := stats.operations[method]
+	if !ok {
+		o = &operationStats{
+			query:         map[string]*paramStats{},
+			requestBodies: map[string]*Schema{},
+			responses:     map[int]map[string]*Schema{},
+		}
+		stats.operations[method] = o
+	}
+	o.requests++
+
+	req := e.Request
+	if req.URL != nil {
+		for name, values := range req.URL.Query() {
+			p, ok := o.query[name]
+			if !ok {
+				p = &paramStats{}
+				o.query[name] = p
+			}
+			p.count++
+			for _, v := range values {
+				p.schema = mergeSchemas(p.schema, schemaOfValue(v))
+			}
+		}
+	}
+	if mediaType, schema := bodySchema(req.Header, req.Body, req.Truncated, req.BodyDecompressed, inv.opts.MaxSchemaBodySize); mediaType != "" {
+		o.requestBodies[mediaType] = mergeSchemas(o.requestBodies[mediaType], schema)
+	}
+
+	if resp := e.Response; resp != nil {
+		bodies := o.responses[resp.StatusCode]
+		if bodies == nil {
+			bodies = map[string]*Schema{}
+			o.responses[resp.StatusCode] = bodies
+		}
+		if mediaType, schema := bodySchema(resp.Header, resp.Body, resp.Truncated, resp.BodyDecompressed, inv.opts.MaxSchemaBodySize); mediaType != "" {
+			bodies[mediaType] = mergeSchemas(bodies[mediaType], schema)
+		}
+	}
+}
+
+// Keeps a uniform sample of latencies, by reservoir sampling.
+func (inv *Inventory) sampleLatency(stats *endpointStats, latency time.Duration) {
+	stats.latencyCount++
+	if latency > stats.maxLatency {
+		stats.maxLatency = latency
+	}
+	if len(stats.latencies) < inv.opts.LatencySamples {
+		stats.latencies = append(stats.latencies, latency)
+	} else if i := inv.rand.Int63n(int64(stats.latencyCount)); i < int64(len(stats.latencies)) {
+		stats.latencies[i] = latency
+	}
+}
+
+// Returns the number of requests for new endpoints not counted because
+// opts.MaxEndpoints were already tracked.
+func (inv *Inventory) Dropped() uint64 {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.dropped
+}
+
+// Endpoints returns the endpoints seen so far, ordered by host and template.
+func (inv *Inventory) Endpoints() []Endpoint {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	var endpoints []Endpoint
+	for host, root := range inv.hosts {
+		root.walk("", func(template string, stats *endpointStats) {
+			if len(stats.latencies) > inv.opts.LatencySamples && inv.opts.LatencySamples > 0 {
+				// Merged endpoints keep a sample of their samples.
+				inv.rand.Shuffle(len(stats.latencies), func(i, j int) {
+					stats.latencies[i], stats.latencies[j] = stats.latencies[j], stats.latencies[i]
+				})
+				stats.latencies = stats.latencies[:inv.opts.LatencySamples]
+			}
+			endpoints = append(endpoints, stats.export(host, template))
+		})
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Host != endpoints[j].Host {
+			return endpoints[i].Host < endpoints[j].Host
+		}
+		return endpoints[i].PathTemplate < endpoints[j].PathTemplate
+	})
+	return endpoints
+}
+
+func (e *endpointStats) export(host, template string) Endpoint {
+	endpoint := Endpoint{
+		Host:         host,
+		PathTemplate: template,
+		Methods:      make(map[string]uint64, len(e.methods)),
+		Requests:     e.requests,
+		FirstSeen:    e.firstSeen,
+		LastSeen:     e.lastSeen,
+	}
+	for m, n := range e.methods {
+		endpoint.Methods[m] = n
+	}
+	if len(e.statusCodes) > 0 {
+		endpoint.StatusCodes = make(map[int]uint64, len(e.statusCodes))
+		for code, n := range e.statusCodes {
+			endpoint.StatusCodes[code] = n
+		}
+	}
+	if len(e.latencies) > 0 {
+		sorted := append([]time.Duration(nil), e.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		endpoint.Latency = &Latency{
+			Samples: len(sorted),
+			P50:     percentile(sorted, 50),
+			P90:     percentile(sorted, 90),
+			P99:     percentile(sorted, 99),
+			Max:     e.maxLatency,
+		}
+	}
+	return endpoint
+}
+
+// Returns the p-th percentile of sorted, by the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// WriteJSON writes the endpoints seen so far to w as a JSON object, with the
+// endpoints under "endpoints".
+func (inv *Inventory) WriteJSON(w io.Writer) error {
+	doc := struct {
+		Endpoints []Endpoint `json:"endpoints"`
+		Dropped   uint64     `json:"dropped,omitempty"`
+	}{inv.Endpoints(), inv.Dropped()}
+	if doc.Endpoints == nil {
+		doc.Endpoints = []Endpoint{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(doc), "failed to write endpoint inventory")
+}
+
+// Lower-cases host and strips the default HTTP ports.
+func normalizeHost(host string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil && (port == "80" || port == "443") {
+		return h
+	}
+	return host
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var start = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Returns a request and its response, latency apart.
+func exchange(method, host, path string, status int, at, latency time.Duration) []gnet.NetTraffic {
+	stream := uuid.New()
+	req := gnet.HTTPRequest{StreamID: stream, Method: method, Host: host, URL: &url.URL{Path: path}}
+	resp := gnet.HTTPResponse{StreamID: stream, StatusCode: status}
+	return []gnet.NetTraffic{
+		{Content: req, ObservationTime: start.Add(at), FinalPacketTime: start.Add(at)},
+		{Content: resp, ObservationTime: start.Add(at + latency), FinalPacketTime: start.Add(at + latency)},
+	}
+}
+
+func TestInventory(t *testing.T) {
+	inv := NewInventory(NewOptions())
+	for i := 0; i < 100; i++ {
+		for _, tr := range exchange("get", "API.example.com:443", fmt.Sprintf("/users/%d", i), 200, time.Duration(i)*time.Second, time.Duration(i+1)*time.Millisecond) {
+			inv.Observe(tr)
+		}
+	}
+	for _, tr := range exchange("DELETE", "api.example.com", "/users/42", 404, time.Minute, time.Millisecond) {
+		inv.Observe(tr)
+	}
+	for _, tr := range exchange("GET", "api.example.com", "/files/0123456789abcdef0123/", 200, time.Minute, time.Millisecond) {
+		inv.Observe(tr)
+	}
+	// Paired already, and a request whose response was not seen.
+	inv.Observe(gnet.NetTraffic{Content: gnet.HTTPExchange{Request: &gnet.HTTPRequest{Method: "GET", URL: &url.URL{Path: "/"}}}, DstIP: net.IPv4(10, 0, 0, 2), DstPort: 8080})
+	inv.Observe(gnet.NetTraffic{Content: gnet.HTTPRequest{StreamID: uuid.New(), Method: "POST", Host: "api.example.com", URL: &url.URL{Path: "/users/7"}}})
+	inv.Flush()
+
+	endpoints := inv.Endpoints()
+	if !assert.Len(t, endpoints, 3) {
+		return
+	}
+	assert.Equal(t, "10.0.0.2:8080", endpoints[0].Host)
+	assert.Equal(t, "/", endpoints[0].PathTemplate)
+	assert.Nil(t, endpoints[0].StatusCodes)
+
+	assert.Equal(t, "/files/{hash}", endpoints[1].PathTemplate)
+
+	users := endpoints[2]
+	assert.Equal(t, "api.example.com", users.Host)
+	assert.Equal(t, "/users/{id}", users.PathTemplate)
+	assert.Equal(t, uint64(102), users.Requests)
+	assert.Equal(t, map[string]uint64{"GET": 100, "DELETE": 1, "POST": 1}, users.Methods)
+	assert.Equal(t, map[int]uint64{200: 100, 404: 1}, users.StatusCodes)
+	assert.Equal(t, start, users.FirstSeen)
+	assert.Equal(t, start.Add(99*time.Second), users.LastSeen)
+	if assert.NotNil(t, users.Latency) {
+		assert.Equal(t, 101, users.Latency.Samples)
+		assert.Equal(t, 50*time.Millisecond, users.Latency.P50)
+		assert.Equal(t, 90*time.Millisecond, users.Latency.P90)
+		assert.Equal(t, 99*time.Millisecond, users.Latency.P99)
+		assert.Equal(t, 100*time.Millisecond, users.Latency.Max)
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, inv.WriteJSON(&buf))
+	var doc struct {
+		Endpoints []Endpoint `json:"endpoints"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, endpoints, doc.Endpoints)
+}
+
+func TestInventoryCollapse(t *testing.T) {
+	opts := NewOptions()
+	opts.MaxLiterals = 3
+	inv := NewInventory(opts)
+	observe := func(path string) {
+		inv.Observe(gnet.NetTraffic{Content: gnet.HTTPExchange{Request: &gnet.HTTPRequest{Method: "GET", Host: "example.com", URL: &url.URL{Path: path}}}})
+	}
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		observe("/profiles/" + name + "/avatar")
+		observe("/static/app.js")
+	}
+	assert.Len(t, inv.Endpoints(), 4)
+
+	observe("/profiles/dave/avatar")
+	observe("/profiles/erin/posts")
+	endpoints := inv.Endpoints()
+	if assert.Len(t, endpoints, 3) {
+		assert.Equal(t, "/profiles/{param}/avatar", endpoints[0].PathTemplate)
+		assert.Equal(t, uint64(4), endpoints[0].Requests)
+		assert.Equal(t, "/profiles/{param}/posts", endpoints[1].PathTemplate)
+		assert.Equal(t, "/static/app.js", endpoints[2].PathTemplate)
+	}
+}
+
+func TestInventoryMaxEndpoints(t *testing.T) {
+	opts := NewOptions()
+	opts.MaxEndpoints = 2
+	inv := NewInventory(opts)
+	for _, path := range []string{"/a", "/b", "/c", "/a"} {
+		inv.Observe(gnet.NetTraffic{Content: gnet.HTTPExchange{Request: &gnet.HTTPRequest{Method: "GET", Host: "example.com", URL: &url.URL{Path: path}}}})
+	}
+	assert.Len(t, inv.Endpoints(), 2)
+	assert.Equal(t, uint64(1), inv.Dropped())
+}
+
+func TestPathParams(t *testing.T) {
+	for segment, param := range map[string]string{
+		"12345":                                idParam,
+		"3f2504e0-4f89-11d3-9a0c-0305e82c3301": uuidParam,
+		"0123456789ABCDEF":                     hashParam,
+		"eyJhbGciOiJIUzI1NiJ9":                 tokenParam,
+		"v1":                                   "",
+		"users":                                "",
+		"getUserProfileSettings":               "",
+	} {
+		assert.Equal(t, param, paramOf(segment), segment)
+	}
+}
@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const openAPIVersion = "3.0.3"
+
+// An OpenAPI 3 document, with the fields that can be inferred from traffic.
+type OpenAPI struct {
+	OpenAPI string              `json:"openapi"`
+	Info    OpenAPIInfo         `json:"info"`
+	Servers []Server            `json:"servers,omitempty"`
+	Paths   map[string]PathItem `json:"paths"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// The operations of a path, by lower-case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+type RequestBody struct {
+	Content map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Hosts returns the hosts that endpoints were seen on, in order.
+func (inv *Inventory) Hosts() []string {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	hosts := make([]string, 0, len(inv.hosts))
+	for host := range inv.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// OpenAPI describes the endpoints seen on host as an OpenAPI document, with a
+// server at http://host. Query parameters and bodies are only described if the
+// inventory infers schemas. Reports false if no endpoint was seen on host.
+func (inv *Inventory) OpenAPI(host string, info OpenAPIInfo) (*OpenAPI, bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	root, ok := inv.hosts[host]
+	if !ok {
+		return nil, false
+	}
+	doc := &OpenAPI{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Servers: []Server{{URL: "http://" + host}},
+		Paths:   map[string]PathItem{},
+	}
+	root.walk("", func(template string, stats *endpointStats) {
+		path, params := pathParameters(template)
+		item := PathItem{}
+		for method := range stats.methods {
+			op := &Operation{
+				Parameters: append([]Parameter(nil), params...),
+				Responses:  map[string]*Response{},
+			}
+			if o, ok := stats.operations[method]; ok {
+				o.describe(op)
+			} else {
+				for code := range stats.statusCodes {
+					op.Responses[strconv.Itoa(code)] = &Response{Description: statusDescription(code)}
+				}
+			}
+			if len(op.Responses) == 0 {
+				op.Responses["default"] = &Response{Description: "No response was seen"}
+			}
+			item[strings.ToLower(method)] = op
+		}
+		doc.Paths[path] = item
+	})
+	return doc, true
+}
+
+// WriteOpenAPI writes the OpenAPI document describing host to w as JSON.
+func (inv *Inventory) WriteOpenAPI(w io.Writer, host string, info OpenAPIInfo) error {
+	doc, ok := inv.OpenAPI(host, info)
+	if !ok {
+		return errors.Errorf("no endpoints seen on %s", host)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(doc), "failed to write OpenAPI document")
+}
+
+func (o *operationStats) describe(op *Operation) {
+	names := make([]string, 0, len(o.query))
+	for name := range o.query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := o.query[name]
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:     name,
+			In:       "query",
+			Required: p.count == o.requests,
+			Schema:   p.schema,
+		})
+	}
+
+	if len(o.requestBodies) > 0 {
+		op.RequestBody = &RequestBody{Content: mediaTypes(o.requestBodies)}
+	}
+	for code, bodies := range o.responses {
+		r := &Response{Description: statusDescription(code)}
+		if len(bodies) > 0 {
+			r.Content = mediaTypes(bodies)
+		}
+		op.Responses[strconv.Itoa(code)] = r
+	}
+}
+
+func mediaTypes(bodies map[string]*Schema) map[string]MediaType {
+	content := make(map[string]MediaType, len(bodies))
+	for mediaType, schema := range bodies {
+		content[mediaType] = MediaType{Schema: completeSchema(schema)}
+	}
+	return content
+}
+
+func statusDescription(code int) string {
+	if text := http.StatusText(code); text != "" {
+		return text
+	}
+	return "Status " + strconv.Itoa(code)
+}
+
+// Returns a path template with its parameters named uniquely, as OpenAPI
+// requires, and the parameters.
+func pathParameters(template string) (string, []Parameter) {
+	var params []Parameter
+	seen := map[string]int{}
+	parts := strings.Split(template, "/")
+	for i, segment := range parts {
+		if !isParam(segment) {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		seen[name]++
+		if seen[name] > 1 {
+			name += strconv.Itoa(seen[name])
+			parts[i] = "{" + name + "}"
+		}
+		params = append(params, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   paramSchema(segment),
+		})
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func paramSchema(placeholder string) *Schema {
+	switch placeholder {
+	case idParam:
+		return &Schema{Type: "integer"}
+	case uuidParam:
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	return &Schema{Type: "string"}
+}
@@ -0,0 +1,104 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+}
+
+func TestOpenAPI(t *testing.T) {
+	inv := NewInventory(NewOptions())
+	observe := func(method, path, query, reqBody string, status int, respBody string) {
+		e := gnet.HTTPExchange{
+			Request: &gnet.HTTPRequest{
+				Method: method,
+				Host:   "api.example.com",
+				URL:    &url.URL{Path: path, RawQuery: query},
+				Header: jsonHeader(),
+				Body:   memview.New([]byte(reqBody)),
+			},
+			Response: &gnet.HTTPResponse{
+				StatusCode: status,
+				Header:     jsonHeader(),
+				Body:       memview.New([]byte(respBody)),
+			},
+		}
+		inv.Observe(gnet.NetTraffic{Content: e})
+	}
+
+	observe("GET", "/users/1/posts/2", "verbose=true&limit=10", "", 200, `{"id": 2, "title": "a", "tags": ["x"], "score": 1}`)
+	observe("GET", "/users/3/posts/4", "limit=5", "", 200, `{"id": 4, "title": null, "tags": [], "score": 1.5, "extra": {}}`)
+	observe("PUT", "/users/3/posts/4", "", `{"title": "b"}`, 404, `{"error": "not found"}`)
+
+	doc, ok := inv.OpenAPI("api.example.com", OpenAPIInfo{Title: "Example", Version: "1"})
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, []Server{{URL: "http://api.example.com"}}, doc.Servers)
+	item, ok := doc.Paths["/users/{id}/posts/{id2}"]
+	if !assert.True(t, ok) || !assert.Len(t, item, 2) {
+		return
+	}
+
+	get := item["get"]
+	assert.Equal(t, []Parameter{
+		{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+		{Name: "id2", In: "path", Required: true, Schema: &Schema{Type: "integer"}},
+		{Name: "limit", In: "query", Required: true, Schema: &Schema{Type: "integer"}},
+		{Name: "verbose", In: "query", Schema: &Schema{Type: "boolean"}},
+	}, get.Parameters)
+	assert.Nil(t, get.RequestBody)
+	if assert.Contains(t, get.Responses, "200") {
+		ok := get.Responses["200"]
+		assert.Equal(t, "OK", ok.Description)
+		assert.Equal(t, &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"id":    {Type: "integer"},
+				"title": {Type: "string", Nullable: true},
+				"tags":  {Type: "array", Items: &Schema{Type: "string"}},
+				"score": {Type: "number"},
+				"extra": {Type: "object", Properties: map[string]*Schema{}},
+			},
+			Required: []string{"id", "score", "tags", "title"},
+		}, ok.Content["application/json"].Schema)
+	}
+
+	put := item["put"]
+	assert.Len(t, put.Parameters, 2)
+	if assert.NotNil(t, put.RequestBody) {
+		assert.Equal(t, &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{"title": {Type: "string"}},
+			Required:   []string{"title"},
+		}, put.RequestBody.Content["application/json"].Schema)
+	}
+	assert.Equal(t, "Not Found", put.Responses["404"].Description)
+
+	var buf bytes.Buffer
+	assert.NoError(t, inv.WriteOpenAPI(&buf, "api.example.com", OpenAPIInfo{Title: "Example", Version: "1"}))
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Contains(t, decoded["paths"], "/users/{id}/posts/{id2}")
+
+	assert.Equal(t, []string{"api.example.com"}, inv.Hosts())
+	assert.Error(t, inv.WriteOpenAPI(&buf, "other.example.com", OpenAPIInfo{}))
+}
+
+func TestMergeSchemas(t *testing.T) {
+	assert.Equal(t, &Schema{Type: "number"}, mergeSchemas(&Schema{Type: "integer"}, &Schema{Type: "number"}))
+	assert.Equal(t, &Schema{}, mergeSchemas(&Schema{Type: "string"}, &Schema{Type: "object"}))
+	assert.Equal(t, &Schema{Type: "string", Nullable: true}, mergeSchemas(&Schema{Nullable: true}, &Schema{Type: "string"}))
+}
@@ -0,0 +1,199 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// The deepest nesting of JSON objects and arrays described by inferred
+// schemas. Values nested deeper are left undescribed.
+const maxSchemaDepth = 16
+
+// A JSON Schema, in the subset used by OpenAPI 3.0.
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// Returns the schema of a JSON value decoded with UseNumber.
+func schemaOf(v interface{}, depth int) *Schema {
+	if depth > maxSchemaDepth {
+		return &Schema{}
+	}
+	switch v := v.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case string:
+		return &Schema{Type: "string"}
+	case []interface{}:
+		// Items stays nil until an array with items is seen.
+		s := &Schema{Type: "array"}
+		for _, item := range v {
+			s.Items = mergeSchemas(s.Items, schemaOf(item, depth+1))
+		}
+		return s
+	case map[string]interface{}:
+		s := &Schema{Type: "object", Properties: make(map[string]*Schema, len(v))}
+		for name, value := range v {
+			s.Properties[name] = schemaOf(value, depth+1)
+			s.Required = append(s.Required, name)
+		}
+		sort.Strings(s.Required)
+		return s
+	}
+	return &Schema{}
+}
+
+// Returns a schema that both a and b conform to. Either may be nil, for no
+// value seen yet. Properties are only required if both require them, and
+// values of different types are described by an empty schema.
+func mergeSchemas(a, b *Schema) *Schema {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+
+	merged := &Schema{Nullable: a.Nullable || b.Nullable}
+	switch {
+	case a.Type == b.Type:
+		merged.Type = a.Type
+		if a.Format == b.Format {
+			merged.Format = a.Format
+		}
+	case a.Type == "":
+		// Null.
+		if len(a.Properties) == 0 && a.Items == nil && a.Nullable {
+			return withNullable(b, true)
+		}
+		return merged
+	case b.Type == "":
+		if len(b.Properties) == 0 && b.Items == nil && b.Nullable {
+			return withNullable(a, true)
+		}
+		return merged
+	case a.Type == "integer" && b.Type == "number", a.Type == "number" && b.Type == "integer":
+		merged.Type = "number"
+		return merged
+	default:
+		return merged
+	}
+
+	if a.Type == "array" {
+		merged.Items = mergeSchemas(a.Items, b.Items)
+	}
+	if a.Type == "object" {
+		merged.Properties = make(map[string]*Schema, len(a.Properties))
+		for name, p := range a.Properties {
+			merged.Properties[name] = mergeSchemas(p, b.Properties[name])
+		}
+		for name, p := range b.Properties {
+			if _, ok := a.Properties[name]; !ok {
+				merged.Properties[name] = p
+			}
+		}
+		required := make(map[string]bool, len(b.Required))
+		for _, name := range b.Required {
+			required[name] = true
+		}
+		for _, name := range a.Required {
+			if required[name] {
+				merged.Required = append(merged.Required, name)
+			}
+		}
+	}
+	return merged
+}
+
+// Returns a copy of s in which arrays whose items were never seen may hold
+// anything, as OpenAPI requires the items of arrays to be described.
+func completeSchema(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if c.Type == "array" {
+		if c.Items == nil {
+			c.Items = &Schema{}
+		} else {
+			c.Items = completeSchema(c.Items)
+		}
+	}
+	if c.Properties != nil {
+		c.Properties = make(map[string]*Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			c.Properties[name] = completeSchema(p)
+		}
+	}
+	return &c
+}
+
+func withNullable(s *Schema, nullable bool) *Schema {
+	copied := *s
+	copied.Nullable = copied.Nullable || nullable
+	return &copied
+}
+
+// Returns the schema of a query parameter or path segment value.
+func schemaOfValue(v string) *Schema {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return &Schema{Type: "integer"}
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return &Schema{Type: "number"}
+	}
+	if v == "true" || v == "false" {
+		return &Schema{Type: "boolean"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// Returns the media type of an HTTP body and the schema of its content, if it
+// is JSON whose whole body was captured. The media type alone is returned for
+// other bodies.
+func bodySchema(header http.Header, body memview.MemView, truncated, decompressed bool, maxSize int64) (string, *Schema) {
+	if body.Len() == 0 {
+		return "", nil
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/octet-stream"
+	}
+	if !isJSON(mediaType) || truncated || (maxSize > 0 && body.Len() > maxSize) {
+		return mediaType, nil
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" && !decompressed {
+		return mediaType, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body.Bytes()))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return mediaType, nil
+	}
+	return mediaType, schemaOf(v, 0)
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,195 @@
+package inventory
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders for the parameters of path templates.
+const (
+	idParam    = "{id}"
+	uuidParam  = "{uuid}"
+	hashParam  = "{hash}"
+	tokenParam = "{token}"
+
+	// A segment with too many distinct values to be part of the API.
+	genericParam = "{param}"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashPattern = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// Returns the placeholder of the parameter that a segment of a path looks
+// like the value of, or "" if it looks like a literal part of the API.
+func paramOf(segment string) string {
+	switch {
+	case isDigits(segment):
+		return idParam
+	case uuidPattern.MatchString(segment):
+		return uuidParam
+	case hashPattern.MatchString(segment):
+		return hashParam
+	case len(segment) >= 16 && hasLetterAndDigit(segment):
+		return tokenParam
+	}
+	return ""
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hasLetterAndDigit(s string) bool {
+	var letter, digit bool
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			letter = true
+		}
+	}
+	return letter && digit
+}
+
+// Splits a path into its non-empty segments.
+func segments(path string) []string {
+	var result []string
+	for _, s := range strings.Split(path, "/") {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// A node of the tree of path templates of a host. Each child is reached by a
+// literal segment or a parameter placeholder.
+type node struct {
+	children map[string]*node
+
+	// The number of children reached by literal segments.
+	literals int
+
+	// Whether literal segments are all taken as values of genericParam, once
+	// there were too many distinct ones.
+	collapsed bool
+
+	// The endpoint whose template ends at this node, if requests were seen for
+	// it.
+	endpoint *endpointStats
+}
+
+func newNode() *node {
+	return &node{children: map[string]*node{}}
+}
+
+// Returns the child of n for segment, creating it if needed, and the number of
+// endpoints removed by merging children together. Literal segments are
+// collapsed into genericParam once more than maxLiterals distinct ones are
+// seen.
+func (n *node) child(segment string, maxLiterals int) (*node, int) {
+	if p := paramOf(segment); p != "" {
+		segment = p
+	} else if n.collapsed {
+		segment = genericParam
+	}
+	if c, ok := n.children[segment]; ok {
+		return c, 0
+	}
+
+	merged := 0
+	if !isParam(segment) {
+		if maxLiterals > 0 && n.literals >= maxLiterals {
+			merged = n.collapse()
+			segment = genericParam
+			if c, ok := n.children[segment]; ok {
+				return c, merged
+			}
+		} else {
+			n.literals++
+		}
+	}
+	c := newNode()
+	n.children[segment] = c
+	return c, merged
+}
+
+// Merges the children of n reached by literal segments into its genericParam
+// child, and returns the number of endpoints removed.
+func (n *node) collapse() int {
+	param, ok := n.children[genericParam]
+	if !ok {
+		param = newNode()
+		n.children[genericParam] = param
+	}
+	merged := 0
+	for segment, c := range n.children {
+		if isParam(segment) {
+			continue
+		}
+		merged += param.merge(c)
+		delete(n.children, segment)
+	}
+	n.literals = 0
+	n.collapsed = true
+	return merged
+}
+
+// Merges the endpoints of other into n and returns the number of endpoints
+// removed.
+func (n *node) merge(other *node) int {
+	merged := 0
+	if other.endpoint != nil {
+		if n.endpoint == nil {
+			n.endpoint = other.endpoint
+		} else {
+			n.endpoint.merge(other.endpoint)
+			merged++
+		}
+	}
+	for segment, c := range other.children {
+		if n.collapsed && !isParam(segment) {
+			segment = genericParam
+		}
+		if mine, ok := n.children[segment]; ok {
+			merged += mine.merge(c)
+			continue
+		}
+		n.children[segment] = c
+		if !isParam(segment) {
+			n.literals++
+		}
+	}
+	n.collapsed = n.collapsed || other.collapsed
+	return merged
+}
+
+// Calls fn with the template of each endpoint under n, whose template starts
+// with prefix.
+func (n *node) walk(prefix string, fn func(template string, e *endpointStats)) {
+	if n.endpoint != nil {
+		template := prefix
+		if template == "" {
+			template = "/"
+		}
+		fn(template, n.endpoint)
+	}
+	for segment, c := range n.children {
+		c.walk(prefix+"/"+segment, fn)
+	}
+}
@@ -0,0 +1,345 @@
+package gnet
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+var (
+	contentTypesMu sync.RWMutex
+	contentTypes   = map[string]reflect.Type{}
+	contentNames   = map[reflect.Type]string{}
+)
+
+func init() {
+	for _, c := range []ParsedNetworkContent{
+		ARP{},
+		BeaconSuspicion{},
+		CaptureFileBoundary{},
+		ConnectionEvicted{},
+		ConnectionLatency{},
+		DHCPMessage{},
+		DNSRequest{},
+		DroppedBytes(0),
+		EncryptedDNSMetadata{},
+		ExtractedFile{},
+		FTPData{},
+		FTPTransfer{},
+		FtpSmtpRequest{},
+		FtpSmtpResponse{},
+		HTTP2ConnectionPreface{},
+		HTTPExchange{},
+		HTTPRequest{},
+		HTTPResponse{},
+		ICMPv4{},
+		ICMPv6{},
+		IMAPCommand{},
+		IMAPResponse{},
+		IndicatorMatch{},
+		KerberosMessage{},
+		NDP{},
+		POP3Command{},
+		POP3Response{},
+		QUICHandshakeMetadata{},
+		SIPMessage{},
+		SMBOperation{},
+		SMTPMessage{},
+		SecurityFinding{},
+		SyslogMessage{},
+		TCPConnectionMetadata{},
+		TCPPacketMetadata{},
+		TCPQualityMetrics{},
+		TLSCertificate{},
+		TLSClientHello{},
+		TLSHandshakeMetadata{},
+		TLSServerHello{},
+		TelnetData{},
+		TelnetSession{},
+		ThreatAnnotation{},
+		UnknownTraffic{},
+		WebSocketMessage{},
+	} {
+		RegisterContentType(reflect.TypeOf(c).Name(), c)
+	}
+}
+
+// RegisterContentType makes a content type known to the JSON encoding of
+// NetTraffic under the given name, which is written as its "content_type".
+// Content types defined in this package are registered under their type names.
+// Content defined elsewhere must be registered before traffic carrying it can
+// be marshaled. Registering the same name or type twice panics.
+func RegisterContentType(name string, example ParsedNetworkContent) {
+	contentTypesMu.Lock()
+	defer contentTypesMu.Unlock()
+
+	t := reflect.TypeOf(example)
+	if name == "" || t == nil {
+		panic("gnet: invalid content type registration")
+	}
+	if _, exists := contentTypes[name]; exists {
+		panic("gnet: content type registered twice: " + name)
+	}
+	if _, exists := contentNames[t]; exists {
+		panic("gnet: content type registered twice: " + t.String())
+	}
+	contentTypes[name] = t
+	contentNames[t] = name
+}
+
+// RegisteredContentTypes returns the names of all registered content types in
+// sorted order.
+func RegisteredContentTypes() []string {
+	contentTypesMu.RLock()
+	defer contentTypesMu.RUnlock()
+
+	names := make([]string, 0, len(contentTypes))
+	for name := range contentTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The JSON form of NetTraffic. Field names are part of the format and must not
+// change.
+type netTrafficJSON struct {
+	LayerType       string           `json:"layer_type,omitempty"`
+	SrcIP           net.IP           `json:"src_ip,omitempty"`
+	SrcPort         int              `json:"src_port,omitempty"`
+	DstIP           net.IP           `json:"dst_ip,omitempty"`
+	DstPort         int              `json:"dst_port,omitempty"`
+	Payload         []byte           `json:"payload,omitempty"`
+	ConnectionID    *uuid.UUID       `json:"connection_id,omitempty"`
+	Interface       string           `json:"interface,omitempty"`
+	Tunnels         []Tunnel         `json:"tunnels,omitempty"`
+	VLANs           []uint16         `json:"vlans,omitempty"`
+	Enrichment      *Enrichment      `json:"enrichment,omitempty"`
+	Indicators      []IndicatorMatch `json:"indicators,omitempty"`
+	LocalRole       HostRole         `json:"local_role,omitempty"`
+	SampleRate      float64          `json:"sample_rate,omitempty"`
+	ObservationTime time.Time        `json:"observation_time"`
+	FinalPacketTime time.Time        `json:"final_packet_time"`
+	ContentType     string           `json:"content_type,omitempty"`
+	Content         json.RawMessage  `json:"content,omitempty"`
+}
+
+// Marshals t as a JSON object. Its content, if any, is marshaled under
+// "content", and the name its type was registered under is written as
+// "content_type", so that UnmarshalJSON can restore it.
+func (t NetTraffic) MarshalJSON() ([]byte, error) {
+	j := netTrafficJSON{
+		LayerType:       t.LayerType,
+		SrcIP:           t.SrcIP,
+		SrcPort:         t.SrcPort,
+		DstIP:           t.DstIP,
+		DstPort:         t.DstPort,
+		Payload:         t.Payload,
+		Interface:       t.Interface,
+		Tunnels:         t.Tunnels,
+		VLANs:           t.VLANs,
+		Enrichment:      t.Enrichment,
+		Indicators:      t.Indicators,
+		LocalRole:       t.LocalRole,
+		SampleRate:      t.SampleRate,
+		ObservationTime: t.ObservationTime,
+		FinalPacketTime: t.FinalPacketTime,
+	}
+	if t.ConnectionID != uuid.Nil {
+		j.ConnectionID = &t.ConnectionID
+	}
+
+	if t.Content != nil {
+		name, content, err := MarshalContent(t.Content)
+		if err != nil {
+			return nil, err
+		}
+		j.ContentType, j.Content = name, content
+	}
+	return json.Marshal(j)
+}
+
+func (t *NetTraffic) UnmarshalJSON(data []byte) error {
+	var j netTrafficJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*t = NetTraffic{
+		LayerType:       j.LayerType,
+		SrcIP:           j.SrcIP,
+		SrcPort:         j.SrcPort,
+		DstIP:           j.DstIP,
+		DstPort:         j.DstPort,
+		Payload:         j.Payload,
+		Interface:       j.Interface,
+		Tunnels:         j.Tunnels,
+		VLANs:           j.VLANs,
+		Enrichment:      j.Enrichment,
+		Indicators:      j.Indicators,
+		LocalRole:       j.LocalRole,
+		SampleRate:      j.SampleRate,
+		ObservationTime: j.ObservationTime,
+		FinalPacketTime: j.FinalPacketTime,
+	}
+	if j.ConnectionID != nil {
+		t.ConnectionID = *j.ConnectionID
+	}
+
+	if j.ContentType == "" {
+		return nil
+	}
+	content, err := UnmarshalContent(j.ContentType, j.Content)
+	if err != nil {
+		return err
+	}
+	t.Content = content
+	return nil
+}
+
+// Returns the name the type of c was registered under, if it was.
+func ContentTypeName(c ParsedNetworkContent) (string, bool) {
+	contentTypesMu.RLock()
+	defer contentTypesMu.RUnlock()
+	name, ok := contentNames[reflect.TypeOf(c)]
+	return name, ok
+}
+
+// Marshals c as JSON and returns the name its type was registered under.
+func MarshalContent(c ParsedNetworkContent) (string, []byte, error) {
+	name, ok := ContentTypeName(c)
+	if !ok {
+		return "", nil, errors.Errorf("unregistered content type %T", c)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to marshal %s", name)
+	}
+	return name, data, nil
+}
+
+// Unmarshals content of the type registered under name from its JSON form.
+func UnmarshalContent(name string, data []byte) (ParsedNetworkContent, error) {
+	contentTypesMu.RLock()
+	typ, ok := contentTypes[name]
+	contentTypesMu.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown content type %q", name)
+	}
+	content := reflect.New(typ)
+	if err := json.Unmarshal(data, content.Interface()); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal %s", name)
+	}
+	return content.Elem().Interface().(ParsedNetworkContent), nil
+}
+
+// Certificates are marshaled in DER form, which x509 can parse back.
+type tlsCertificateJSON struct {
+	ConnectionID uuid.UUID
+	Certificates [][]byte
+	Chain        []TLSCertificateInfo
+}
+
+func (c TLSCertificate) MarshalJSON() ([]byte, error) {
+	j := tlsCertificateJSON{ConnectionID: c.ConnectionID, Chain: c.Chain}
+	for _, cert := range c.Certificates {
+		j.Certificates = append(j.Certificates, cert.Raw)
+	}
+	return json.Marshal(j)
+}
+
+func (c *TLSCertificate) UnmarshalJSON(data []byte) error {
+	var j tlsCertificateJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*c = TLSCertificate{ConnectionID: j.ConnectionID, Chain: j.Chain}
+	for _, der := range j.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return errors.Wrap(err, "failed to parse certificate")
+		}
+		c.Certificates = append(c.Certificates, cert)
+	}
+	return nil
+}
+
+// Keeps track of which handshake messages were seen, which is unexported.
+type tlsHandshakeMetadataJSON struct {
+	tlsHandshakeMetadataFields
+	ClientHandshakeSeen bool
+	ServerHandshakeSeen bool
+	CertificateSeen     bool
+}
+
+// Has the fields of TLSHandshakeMetadata, but not its JSON methods.
+type tlsHandshakeMetadataFields TLSHandshakeMetadata
+
+func (m TLSHandshakeMetadata) MarshalJSON() ([]byte, error) {
+	return json.Marshal(tlsHandshakeMetadataJSON{
+		tlsHandshakeMetadataFields: tlsHandshakeMetadataFields(m),
+		ClientHandshakeSeen:        m.clientHandshakeSeen,
+		ServerHandshakeSeen:        m.serverHandshakeSeen,
+		CertificateSeen:            m.certificateSeen,
+	})
+}
+
+func (m *TLSHandshakeMetadata) UnmarshalJSON(data []byte) error {
+	var j tlsHandshakeMetadataJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*m = TLSHandshakeMetadata(j.tlsHandshakeMetadataFields)
+	m.clientHandshakeSeen = j.ClientHandshakeSeen
+	m.serverHandshakeSeen = j.ServerHandshakeSeen
+	m.certificateSeen = j.CertificateSeen
+	return nil
+}
+
+// NDJSONWriter writes traffic as newline-delimited JSON, one NetTraffic per
+// line.
+type NDJSONWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	return &NDJSONWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *NDJSONWriter) Write(t NetTraffic) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Wrap(w.enc.Encode(t), "failed to write traffic")
+}
+
+// NDJSONReader reads traffic written by an NDJSONWriter.
+type NDJSONReader struct {
+	dec *json.Decoder
+}
+
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	return &NDJSONReader{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+// Returns the next traffic, or io.EOF once all traffic has been read.
+func (r *NDJSONReader) Read() (NetTraffic, error) {
+	var t NetTraffic
+	if err := r.dec.Decode(&t); err != nil {
+		if err == io.EOF {
+			return t, err
+		}
+		return t, errors.Wrap(err, "failed to read traffic")
+	}
+	return t, nil
+}
@@ -0,0 +1,121 @@
+package gnet
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestJSONRoundTripAllContentTypes(t *testing.T) {
+	for _, name := range RegisteredContentTypes() {
+		contentTypesMu.RLock()
+		typ := contentTypes[name]
+		contentTypesMu.RUnlock()
+
+		in := NetTraffic{
+			LayerType:       "TCP",
+			ConnectionID:    uuid.New(),
+			ObservationTime: time.Unix(1700000000, 0).UTC(),
+			Content:         reflect.Zero(typ).Interface().(ParsedNetworkContent),
+		}
+		b, err := in.MarshalJSON()
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		var out NetTraffic
+		if assert.NoError(t, out.UnmarshalJSON(b), name) {
+			assert.IsType(t, in.Content, out.Content, name)
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	ts := time.Unix(1700000000, 123).UTC()
+	traffic := []NetTraffic{
+		{
+			LayerType: "HTTP",
+			SrcIP:     net.IPv4(10, 0, 0, 1), SrcPort: 40000,
+			DstIP: net.IPv4(10, 0, 0, 2), DstPort: 80,
+			ConnectionID:    uuid.New(),
+			Interface:       "eth0",
+			VLANs:           []uint16{10},
+			ObservationTime: ts,
+			FinalPacketTime: ts,
+			Content: HTTPRequest{
+				Method: "POST", ProtoMajor: 1, ProtoMinor: 1,
+				URL:    &url.URL{Path: "/upload"},
+				Header: http.Header{"Content-Type": {"text/plain"}},
+				Body:   memview.New([]byte("hello")),
+			},
+		},
+		{
+			LayerType:       "DNS",
+			SrcIP:           net.ParseIP("fe80::1"),
+			Payload:         []byte{1, 2, 3},
+			ObservationTime: ts,
+			FinalPacketTime: ts,
+			Content: DNSRequest{ID: 7, Questions: []layers.DNSQuestion{
+				{Name: []byte("example.com"), Type: layers.DNSTypeAAAA, Class: layers.DNSClassIN},
+			}},
+		},
+		{LayerType: "ARP", ObservationTime: ts, FinalPacketTime: ts},
+	}
+
+	var buf bytes.Buffer
+	w := NewNDJSONWriter(&buf)
+	for _, tr := range traffic {
+		assert.NoError(t, w.Write(tr))
+	}
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.Contains(t, buf.String(), `"content_type":"HTTPRequest"`)
+
+	r := NewNDJSONReader(&buf)
+	for _, want := range traffic {
+		got, err := r.Read()
+		if !assert.NoError(t, err) {
+			return
+		}
+		if req, ok := want.Content.(HTTPRequest); ok {
+			gotReq := got.Content.(HTTPRequest)
+			assert.Equal(t, "hello", gotReq.Body.String())
+			assert.NotPanics(t, gotReq.ReleaseBuffers)
+			assert.Equal(t, req.URL, gotReq.URL)
+			// MemViews only compare equal by content.
+			want.Content, got.Content = nil, nil
+		}
+		assert.Equal(t, want, got)
+	}
+	_, err := r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestJSONTLSHandshakeMetadata(t *testing.T) {
+	sni := "example.com"
+	in := TLSHandshakeMetadata{SNIHostname: &sni, clientHandshakeSeen: true, serverHandshakeSeen: true}
+	b, err := NetTraffic{Content: in}.MarshalJSON()
+	assert.NoError(t, err)
+
+	var out NetTraffic
+	if assert.NoError(t, out.UnmarshalJSON(b)) {
+		m := out.Content.(TLSHandshakeMetadata)
+		assert.Equal(t, in, m)
+		assert.True(t, m.HandshakeComplete())
+	}
+}
+
+func TestMarshalUnregisteredContent(t *testing.T) {
+	type custom struct{ TCPPacketMetadata }
+	_, err := NetTraffic{Content: custom{}}.MarshalJSON()
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package gnet
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// Kerberos message types, from RFC 4120 Section 7.5.7.
+type KerberosMessageType int
+
+const (
+	KerberosASReq    KerberosMessageType = 10
+	KerberosASRep    KerberosMessageType = 11
+	KerberosTGSReq   KerberosMessageType = 12
+	KerberosTGSRep   KerberosMessageType = 13
+	KerberosAPReq    KerberosMessageType = 14
+	KerberosAPRep    KerberosMessageType = 15
+	KerberosKRBError KerberosMessageType = 30
+)
+
+func (t KerberosMessageType) String() string {
+	switch t {
+	case KerberosASReq:
+		return "AS-REQ"
+	case KerberosASRep:
+		return "AS-REP"
+	case KerberosTGSReq:
+		return "TGS-REQ"
+	case KerberosTGSRep:
+		return "TGS-REP"
+	case KerberosAPReq:
+		return "AP-REQ"
+	case KerberosAPRep:
+		return "AP-REP"
+	case KerberosKRBError:
+		return "KRB-ERROR"
+	}
+	return "UNKNOWN(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Kerberos encryption types, from RFC 3961 Section 8 and RFC 8429.
+type KerberosEncryptionType int32
+
+const (
+	KerberosDESCBCCRC            KerberosEncryptionType = 1
+	KerberosDESCBCMD5            KerberosEncryptionType = 3
+	KerberosDES3CBCSHA1          KerberosEncryptionType = 16
+	KerberosAES128CTSHMACSHA196  KerberosEncryptionType = 17
+	KerberosAES256CTSHMACSHA196  KerberosEncryptionType = 18
+	KerberosAES128CTSHMACSHA2562 KerberosEncryptionType = 19
+	KerberosAES256CTSHMACSHA3842 KerberosEncryptionType = 20
+	KerberosRC4HMAC              KerberosEncryptionType = 23
+	KerberosRC4HMACExp           KerberosEncryptionType = 24
+)
+
+var kerberosEncryptionTypeNames = map[KerberosEncryptionType]string{
+	KerberosDESCBCCRC:            "des-cbc-crc",
+	KerberosDESCBCMD5:            "des-cbc-md5",
+	KerberosDES3CBCSHA1:          "des3-cbc-sha1",
+	KerberosAES128CTSHMACSHA196:  "aes128-cts-hmac-sha1-96",
+	KerberosAES256CTSHMACSHA196:  "aes256-cts-hmac-sha1-96",
+	KerberosAES128CTSHMACSHA2562: "aes128-cts-hmac-sha256-128",
+	KerberosAES256CTSHMACSHA3842: "aes256-cts-hmac-sha384-192",
+	KerberosRC4HMAC:              "rc4-hmac",
+	KerberosRC4HMACExp:           "rc4-hmac-exp",
+}
+
+func (e KerberosEncryptionType) String() string {
+	if name, ok := kerberosEncryptionTypeNames[e]; ok {
+		return name
+	}
+	return "unknown(" + strconv.Itoa(int(e)) + ")"
+}
+
+// Reports whether the encryption type is considered weak, i.e. DES or RC4.
+// Requests for weak types are a common sign of Kerberoasting.
+func (e KerberosEncryptionType) IsWeak() bool {
+	switch e {
+	case KerberosDESCBCCRC, KerberosDESCBCMD5, KerberosRC4HMAC, KerberosRC4HMACExp:
+		return true
+	}
+	return false
+}
+
+// Represents a Kerberos KDC exchange message or error, carried over UDP or TCP
+// port 88.
+type KerberosMessage struct {
+	// Identifies the TCP connection to which this message belongs. Zero for
+	// messages carried over UDP.
+	ConnectionID uuid.UUID
+
+	MessageType KerberosMessageType
+
+	// The realm of the request, or the client's realm in a reply or error.
+	Realm string
+
+	// Principal names with components joined by "/", without the realm, e.g.
+	// "alice" or "krbtgt/EXAMPLE.COM".
+	ClientPrincipal string
+	ServerPrincipal string
+
+	// For requests, the encryption types the client supports, in order of
+	// preference. For replies, the types of the ticket and of the encrypted
+	// part.
+	EncryptionTypes []KerberosEncryptionType
+
+	// Types of the pre-authentication data in the message. An AS-REQ without
+	// PA-ENC-TIMESTAMP (2) may indicate AS-REP roasting.
+	PreAuthTypes []int
+
+	// The error code of a KRB-ERROR, e.g. 25 for KDC_ERR_PREAUTH_REQUIRED.
+	ErrorCode int
+}
+
+var _ ParsedNetworkContent = (*KerberosMessage)(nil)
+
+func (KerberosMessage) ReleaseBuffers() {}
@@ -0,0 +1,66 @@
+package kerberos
+
+const (
+	// Kerberos over TCP prefixes each message with its length as a 4-byte
+	// big-endian integer (RFC 4120 Section 7.2.2).
+	tcpLengthPrefix_bytes = 4
+
+	// Messages larger than this are not buffered; real KDC messages are a
+	// few KB, or tens of KB with large PACs.
+	maxBufferedLength = 1024 * 1024
+
+	// Conventional port for Kerberos over UDP and TCP.
+	Port = 88
+)
+
+// Context-specific field numbers in the messages we decode, from RFC 4120
+// Section 5.
+const (
+	// KDC-REQ
+	kdcReqMsgType = 2
+	kdcReqPAData  = 3
+	kdcReqBody    = 4
+
+	// KDC-REQ-BODY
+	reqBodyCName = 1
+	reqBodyRealm = 2
+	reqBodySName = 3
+	reqBodyEType = 8
+
+	// KDC-REP
+	kdcRepMsgType = 1
+	kdcRepPAData  = 2
+	kdcRepCRealm  = 3
+	kdcRepCName   = 4
+	kdcRepTicket  = 5
+	kdcRepEncPart = 6
+
+	// AP-REQ
+	apReqMsgType = 1
+	apReqTicket  = 3
+
+	// AP-REP
+	apRepMsgType = 1
+
+	// KRB-ERROR
+	krbErrorMsgType   = 1
+	krbErrorErrorCode = 6
+	krbErrorCRealm    = 7
+	krbErrorCName     = 8
+	krbErrorRealm     = 9
+	krbErrorSName     = 10
+
+	// Ticket
+	ticketRealm   = 1
+	ticketSName   = 2
+	ticketEncPart = 3
+
+	// PrincipalName
+	principalNameString = 1
+
+	// PA-DATA
+	paDataType = 1
+
+	// EncryptedData
+	encryptedDataEType = 0
+)
@@ -0,0 +1,263 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Reports whether data starts like a Kerberos message: an APPLICATION-tagged
+// value with a known message type.
+func IsKerberos(data []byte) bool {
+	if len(data) < 2 {
+		return false
+	}
+	// Application class, constructed, low tag number.
+	if data[0]&0xe0 != 0x60 {
+		return false
+	}
+	switch gnet.KerberosMessageType(data[0] & 0x1f) {
+	case gnet.KerberosASReq, gnet.KerberosASRep, gnet.KerberosTGSReq, gnet.KerberosTGSRep,
+		gnet.KerberosAPReq, gnet.KerberosAPRep, gnet.KerberosKRBError:
+		return true
+	}
+	return false
+}
+
+// Parses a single Kerberos message, such as the payload of a UDP datagram or
+// a TCP record without its length prefix.
+func ParseMessage(data []byte) (gnet.KerberosMessage, error) {
+	var msg gnet.KerberosMessage
+
+	var app asn1.RawValue
+	if _, err := asn1.Unmarshal(data, &app); err != nil {
+		return msg, errors.Wrap(err, "failed to decode Kerberos message")
+	}
+	if app.Class != asn1.ClassApplication {
+		return msg, errors.New("not a Kerberos message")
+	}
+
+	seq, err := fields(app)
+	if err != nil {
+		return msg, err
+	}
+
+	msg.MessageType = gnet.KerberosMessageType(app.Tag)
+	switch msg.MessageType {
+	case gnet.KerberosASReq, gnet.KerberosTGSReq:
+		err = parseKDCReq(&msg, seq)
+	case gnet.KerberosASRep, gnet.KerberosTGSRep:
+		err = parseKDCRep(&msg, seq)
+	case gnet.KerberosAPReq:
+		err = parseAPReq(&msg, seq)
+	case gnet.KerberosAPRep:
+		err = checkMsgType(msg.MessageType, seq[apRepMsgType])
+	case gnet.KerberosKRBError:
+		err = parseKRBError(&msg, seq)
+	default:
+		err = errors.Errorf("unsupported Kerberos message type %d", app.Tag)
+	}
+	return msg, err
+}
+
+func parseKDCReq(msg *gnet.KerberosMessage, seq map[int]asn1.RawValue) error {
+	if err := checkMsgType(msg.MessageType, seq[kdcReqMsgType]); err != nil {
+		return err
+	}
+	msg.PreAuthTypes = paDataTypes(seq[kdcReqPAData])
+
+	body, err := fields(seq[kdcReqBody])
+	if err != nil {
+		return errors.Wrap(err, "failed to decode KDC-REQ-BODY")
+	}
+	msg.Realm = stringValue(body[reqBodyRealm])
+	msg.ClientPrincipal = principalName(body[reqBodyCName])
+	msg.ServerPrincipal = principalName(body[reqBodySName])
+
+	var etypes []int32
+	if v, ok := body[reqBodyEType]; ok {
+		if _, err := asn1.Unmarshal(v.FullBytes, &etypes); err != nil {
+			return errors.Wrap(err, "failed to decode etype list")
+		}
+	}
+	for _, e := range etypes {
+		msg.EncryptionTypes = append(msg.EncryptionTypes, gnet.KerberosEncryptionType(e))
+	}
+	return nil
+}
+
+func parseKDCRep(msg *gnet.KerberosMessage, seq map[int]asn1.RawValue) error {
+	if err := checkMsgType(msg.MessageType, seq[kdcRepMsgType]); err != nil {
+		return err
+	}
+	msg.PreAuthTypes = paDataTypes(seq[kdcRepPAData])
+	msg.Realm = stringValue(seq[kdcRepCRealm])
+	msg.ClientPrincipal = principalName(seq[kdcRepCName])
+
+	parseTicket(msg, seq[kdcRepTicket])
+	if e, ok := encryptionType(seq[kdcRepEncPart]); ok {
+		msg.EncryptionTypes = append(msg.EncryptionTypes, e)
+	}
+	return nil
+}
+
+func parseAPReq(msg *gnet.KerberosMessage, seq map[int]asn1.RawValue) error {
+	if err := checkMsgType(msg.MessageType, seq[apReqMsgType]); err != nil {
+		return err
+	}
+	parseTicket(msg, seq[apReqTicket])
+	return nil
+}
+
+func parseKRBError(msg *gnet.KerberosMessage, seq map[int]asn1.RawValue) error {
+	if err := checkMsgType(msg.MessageType, seq[krbErrorMsgType]); err != nil {
+		return err
+	}
+	msg.ErrorCode = intValue(seq[krbErrorErrorCode])
+	msg.Realm = stringValue(seq[krbErrorCRealm])
+	if msg.Realm == "" {
+		msg.Realm = stringValue(seq[krbErrorRealm])
+	}
+	msg.ClientPrincipal = principalName(seq[krbErrorCName])
+	msg.ServerPrincipal = principalName(seq[krbErrorSName])
+	return nil
+}
+
+// Records the server principal and encryption type of a Ticket. The realm is
+// only taken from the ticket if the message has none of its own.
+func parseTicket(msg *gnet.KerberosMessage, v asn1.RawValue) {
+	if len(v.FullBytes) == 0 {
+		return
+	}
+
+	// Ticket is itself tagged [APPLICATION 1], which fields unwraps.
+	ticket, err := fields(v)
+	if err != nil {
+		return
+	}
+
+	if msg.Realm == "" {
+		msg.Realm = stringValue(ticket[ticketRealm])
+	}
+	msg.ServerPrincipal = principalName(ticket[ticketSName])
+	if e, ok := encryptionType(ticket[ticketEncPart]); ok {
+		msg.EncryptionTypes = append(msg.EncryptionTypes, e)
+	}
+}
+
+// The message type is repeated inside the message; a mismatch means we have
+// misidentified the data.
+func checkMsgType(t gnet.KerberosMessageType, v asn1.RawValue) error {
+	if intValue(v) != int(t) {
+		return errors.Errorf("Kerberos msg-type does not match tag %d", t)
+	}
+	return nil
+}
+
+// Returns the fields of a SEQUENCE whose members have explicit context tags,
+// keyed by tag number. The values are the contents of the tags. v may be the
+// SEQUENCE itself, or a tag or APPLICATION value wrapping it.
+func fields(v asn1.RawValue) (map[int]asn1.RawValue, error) {
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagSequence {
+		var inner asn1.RawValue
+		if _, err := asn1.Unmarshal(v.Bytes, &inner); err != nil {
+			return nil, err
+		}
+		v = inner
+	}
+	if v.Class != asn1.ClassUniversal || v.Tag != asn1.TagSequence {
+		return nil, errors.New("expected SEQUENCE")
+	}
+
+	result := map[int]asn1.RawValue{}
+	for rest := v.Bytes; len(rest) > 0; {
+		var tagged asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &tagged)
+		if err != nil {
+			return nil, err
+		}
+		if tagged.Class != asn1.ClassContextSpecific {
+			continue
+		}
+
+		var inner asn1.RawValue
+		if _, err := asn1.Unmarshal(tagged.Bytes, &inner); err != nil {
+			return nil, err
+		}
+		result[tagged.Tag] = inner
+	}
+	return result, nil
+}
+
+// Returns the value of an INTEGER, or 0 if v is not one.
+func intValue(v asn1.RawValue) int {
+	var i int
+	if _, err := asn1.Unmarshal(v.FullBytes, &i); err != nil {
+		return 0
+	}
+	return i
+}
+
+// Returns the contents of a string value of any string type, including the
+// GeneralString used for Kerberos names.
+func stringValue(v asn1.RawValue) string {
+	if v.Class != asn1.ClassUniversal || v.IsCompound {
+		return ""
+	}
+	return string(v.Bytes)
+}
+
+// Returns the components of a PrincipalName joined by "/".
+func principalName(v asn1.RawValue) string {
+	if len(v.FullBytes) == 0 {
+		return ""
+	}
+	name, err := fields(v)
+	if err != nil {
+		return ""
+	}
+
+	var parts []string
+	for rest := name[principalNameString].Bytes; len(rest) > 0; {
+		var s asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &s); err != nil {
+			break
+		}
+		parts = append(parts, stringValue(s))
+	}
+	return strings.Join(parts, "/")
+}
+
+// Returns the padata-type of each PA-DATA in a SEQUENCE OF PA-DATA.
+func paDataTypes(v asn1.RawValue) []int {
+	var types []int
+	for rest := v.Bytes; len(rest) > 0; {
+		var pa asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &pa); err != nil {
+			break
+		}
+		if f, err := fields(pa); err == nil {
+			types = append(types, intValue(f[paDataType]))
+		}
+	}
+	return types
+}
+
+// Returns the etype of an EncryptedData.
+func encryptionType(v asn1.RawValue) (gnet.KerberosEncryptionType, bool) {
+	if len(v.FullBytes) == 0 {
+		return 0, false
+	}
+	f, err := fields(v)
+	if err != nil {
+		return 0, false
+	}
+	e, ok := f[encryptedDataEType]
+	return gnet.KerberosEncryptionType(intValue(e)), ok
+}
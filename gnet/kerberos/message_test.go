@@ -0,0 +1,101 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+type testPrincipalName struct {
+	NameType   int      `asn1:"explicit,tag:0"`
+	NameString []string `asn1:"generalstring,explicit,tag:1"`
+}
+
+type testPAData struct {
+	Type  int    `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+type testKDCReqBody struct {
+	Options asn1.BitString    `asn1:"explicit,tag:0"`
+	CName   testPrincipalName `asn1:"explicit,tag:1"`
+	Realm   string            `asn1:"generalstring,explicit,tag:2"`
+	SName   testPrincipalName `asn1:"explicit,tag:3"`
+	Nonce   int               `asn1:"explicit,tag:7"`
+	EType   []int             `asn1:"explicit,tag:8"`
+}
+
+type testKDCReq struct {
+	PVNO    int            `asn1:"explicit,tag:1"`
+	MsgType int            `asn1:"explicit,tag:2"`
+	PAData  []testPAData   `asn1:"explicit,tag:3"`
+	ReqBody testKDCReqBody `asn1:"explicit,tag:4"`
+}
+
+func asReq(t *testing.T) []byte {
+	b, err := asn1.MarshalWithParams(testKDCReq{
+		PVNO:    5,
+		MsgType: int(gnet.KerberosASReq),
+		PAData:  []testPAData{{Type: 128, Value: []byte{0x30, 0x00}}},
+		ReqBody: testKDCReqBody{
+			Options: asn1.BitString{Bytes: []byte{0x40, 0x81, 0, 0x10}, BitLength: 32},
+			CName:   testPrincipalName{NameType: 1, NameString: []string{"alice"}},
+			Realm:   "EXAMPLE.COM",
+			SName:   testPrincipalName{NameType: 2, NameString: []string{"krbtgt", "EXAMPLE.COM"}},
+			Nonce:   12345,
+			EType:   []int{18, 17, 23},
+		},
+	}, "application,explicit,tag:10")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return b
+}
+
+func TestParseASReq(t *testing.T) {
+	data := asReq(t)
+	assert.True(t, IsKerberos(data))
+
+	msg, err := ParseMessage(data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, gnet.KerberosASReq, msg.MessageType)
+	assert.Equal(t, "EXAMPLE.COM", msg.Realm)
+	assert.Equal(t, "alice", msg.ClientPrincipal)
+	assert.Equal(t, "krbtgt/EXAMPLE.COM", msg.ServerPrincipal)
+	assert.Equal(t, []gnet.KerberosEncryptionType{
+		gnet.KerberosAES256CTSHMACSHA196,
+		gnet.KerberosAES128CTSHMACSHA196,
+		gnet.KerberosRC4HMAC,
+	}, msg.EncryptionTypes)
+	assert.Equal(t, []int{128}, msg.PreAuthTypes)
+}
+
+func TestParseOverTCP(t *testing.T) {
+	data := asReq(t)
+	input := make([]byte, tcpLengthPrefix_bytes, tcpLengthPrefix_bytes+len(data))
+	binary.BigEndian.PutUint32(input, uint32(len(data)))
+	input = append(input, data...)
+
+	f := NewKerberosParserFactory()
+	decision, _ := f.Accepts(memview.New(input), false)
+	assert.Equal(t, gnet.Accept, decision)
+
+	result, unused, _, err := f.CreateParser(uuid.New(), 0, 0).Parse(memview.New(input), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		assert.Equal(t, "alice", result.(gnet.KerberosMessage).ClientPrincipal)
+		assert.Equal(t, int64(0), unused.Len())
+	}
+}
+
+func TestRejectsGarbage(t *testing.T) {
+	_, err := ParseMessage([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package kerberos
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newKerberosParser(bidiID uuid.UUID) *kerberosParser {
+	return &kerberosParser{
+		connectionID: bidiID,
+	}
+}
+
+// Parses a single length-prefixed Kerberos message from a TCP stream.
+type kerberosParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*kerberosParser)(nil)
+
+func (*kerberosParser) Name() string {
+	return "Kerberos Parser"
+}
+
+func (parser *kerberosParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete Kerberos message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *kerberosParser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	if parser.allInput.Len() < tcpLengthPrefix_bytes {
+		return nil, 0, nil
+	}
+
+	length := int64(parser.allInput.GetUint32(0))
+	if length > maxBufferedLength {
+		return nil, 0, errors.New("Kerberos message too long")
+	}
+	end := tcpLengthPrefix_bytes + length
+	if parser.allInput.Len() < end {
+		return nil, 0, nil
+	}
+
+	msg, err := ParseMessage(parser.allInput.SubView(tcpLengthPrefix_bytes, end).Bytes())
+	if err != nil {
+		return nil, 0, err
+	}
+	msg.ConnectionID = parser.connectionID
+	return msg, end, nil
+}
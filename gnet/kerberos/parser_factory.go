@@ -0,0 +1,52 @@
+package kerberos
+
+import (
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing Kerberos messages over TCP. The same factory
+// handles requests and replies. Kerberos over UDP is handled by ParseMessage.
+func NewKerberosParserFactory() gnet.TCPParserFactory {
+	return &kerberosParserFactory{}
+}
+
+type kerberosParserFactory struct{}
+
+func (*kerberosParserFactory) Name() string {
+	return "Kerberos Parser Factory"
+}
+
+func (factory *kerberosParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*kerberosParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < tcpLengthPrefix_bytes+2 {
+		return gnet.NeedMoreData, 0
+	}
+
+	length := int64(input.GetUint32(0))
+	if length > maxBufferedLength || length < 2 {
+		return gnet.Reject, input.Len()
+	}
+
+	head := input.SubView(tcpLengthPrefix_bytes, tcpLengthPrefix_bytes+2).Bytes()
+	if !IsKerberos(head) {
+		return gnet.Reject, input.Len()
+	}
+	return gnet.Accept, 0
+}
+
+func (*kerberosParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newKerberosParser(id)
+}
@@ -0,0 +1,12 @@
+package kerberos
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("kerberos", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewKerberosParserFactory()}
+	}, gnet.FramedTCPParserPriority)
+}
@@ -0,0 +1,38 @@
+package gnet
+
+// Logger receives diagnostics from capture and parsing, such as parser
+// failures and recovered panics, which are otherwise discarded. The
+// *SugaredLogger of zap and the loggers of logrus satisfy it as is.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// A Logger that discards everything. The default wherever a Logger may be
+// set.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+
+// Implemented by parser factories that report diagnostics. Returns a copy of
+// the factory whose parsers log to l.
+type LoggingTCPParserFactory interface {
+	TCPParserFactory
+	WithLogger(l Logger) TCPParserFactory
+}
+
+// Returns a copy of s in which every factory that supports logging logs to l.
+func (s TCPParserFactorySelector) WithLogger(l Logger) TCPParserFactorySelector {
+	out := make(TCPParserFactorySelector, len(s))
+	for i, f := range s {
+		if lf, ok := f.(LoggingTCPParserFactory); ok {
+			f = lf.WithLogger(l)
+		}
+		out[i] = f
+	}
+	return out
+}
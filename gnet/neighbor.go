@@ -0,0 +1,102 @@
+package gnet
+
+import (
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Represents an ARP request or reply for an IPv4 address.
+type ARP struct {
+	// layers.ARPRequest or layers.ARPReply.
+	Operation uint16
+
+	SenderMAC net.HardwareAddr
+	SenderIP  net.IP
+
+	// Zero in requests.
+	TargetMAC net.HardwareAddr
+	TargetIP  net.IP
+}
+
+var _ ParsedNetworkContent = (*ARP)(nil)
+
+func (ARP) ReleaseBuffers() {}
+
+// Reports whether a announces its sender's own address, as hosts do when
+// they come up or take over an address.
+func (a ARP) IsGratuitous() bool {
+	return a.SenderIP.Equal(a.TargetIP)
+}
+
+func FromARP(l *layers.ARP) ARP {
+	return ARP{
+		Operation: l.Operation,
+		SenderMAC: net.HardwareAddr(l.SourceHwAddress),
+		SenderIP:  net.IP(l.SourceProtAddress),
+		TargetMAC: net.HardwareAddr(l.DstHwAddress),
+		TargetIP:  net.IP(l.DstProtAddress),
+	}
+}
+
+// Represents an IPv6 Neighbor Discovery message, the IPv6 equivalent of ARP.
+// The sender's IP address is the source of the NetTraffic.
+type NDP struct {
+	// layers.ICMPv6TypeNeighborSolicitation, ICMPv6TypeNeighborAdvertisement,
+	// ICMPv6TypeRouterSolicitation or ICMPv6TypeRouterAdvertisement.
+	Type uint8
+
+	// The address being resolved or advertised. Neighbor messages only.
+	TargetIP net.IP
+
+	// Link-layer address of the sender, from the source link-layer address
+	// option of solicitations and router advertisements.
+	SourceMAC net.HardwareAddr
+
+	// Link-layer address of TargetIP, from the target link-layer address
+	// option of neighbor advertisements.
+	TargetMAC net.HardwareAddr
+
+	// Flags of neighbor advertisements.
+	Router    bool
+	Solicited bool
+	Override  bool
+}
+
+var _ ParsedNetworkContent = (*NDP)(nil)
+
+func (NDP) ReleaseBuffers() {}
+
+// Converts a Neighbor Discovery layer. Returns false for other layers.
+func FromNDP(l gopacket.Layer) (NDP, bool) {
+	var m NDP
+	var opts layers.ICMPv6Options
+	switch l := l.(type) {
+	case *layers.ICMPv6NeighborSolicitation:
+		m.Type = layers.ICMPv6TypeNeighborSolicitation
+		m.TargetIP, opts = l.TargetAddress, l.Options
+	case *layers.ICMPv6NeighborAdvertisement:
+		m.Type = layers.ICMPv6TypeNeighborAdvertisement
+		m.TargetIP, opts = l.TargetAddress, l.Options
+		m.Router, m.Solicited, m.Override = l.Router(), l.Solicited(), l.Override()
+	case *layers.ICMPv6RouterSolicitation:
+		m.Type = layers.ICMPv6TypeRouterSolicitation
+		opts = l.Options
+	case *layers.ICMPv6RouterAdvertisement:
+		m.Type = layers.ICMPv6TypeRouterAdvertisement
+		opts = l.Options
+	default:
+		return NDP{}, false
+	}
+
+	for _, o := range opts {
+		switch o.Type {
+		case layers.ICMPv6OptSourceAddress:
+			m.SourceMAC = net.HardwareAddr(o.Data)
+		case layers.ICMPv6OptTargetAddress:
+			m.TargetMAC = net.HardwareAddr(o.Data)
+		}
+	}
+	return m, true
+}
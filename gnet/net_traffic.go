@@ -1,6 +1,7 @@
 package gnet
 
 import (
+	"bytes"
 	"crypto/x509"
 	"net"
 	"net/http"
@@ -33,6 +34,36 @@ type NetTraffic struct {
 	// stream id
 	ConnectionID uuid.UUID
 
+	// Name of the interface the traffic was captured on, when capturing from
+	// several interfaces at once.
+	Interface string
+
+	// Tunnels the traffic was carried in, outermost first, if it was
+	// decapsulated. For TCP, the tunnels of the first packet of the connection.
+	Tunnels []Tunnel
+
+	// IDs of the 802.1Q VLAN tags of the captured frame, outermost first. QinQ
+	// frames have several. For TCP, those of the first packet of the
+	// connection.
+	VLANs []uint16
+
+	// Information about the endpoints from outside the capture, if the
+	// traffic was enriched.
+	Enrichment *Enrichment
+
+	// The threat intelligence indicators the traffic matched, if it was
+	// matched against any.
+	Indicators []IndicatorMatch
+
+	// Whether the capturing host was the client or the server of the traffic.
+	// Empty if neither endpoint is a local address, or the roles are unknown.
+	LocalRole HostRole
+
+	// If the traffic was sampled, the fraction of traffic it was sampled from,
+	// e.g. 0.01 if 1 in 100 flows was kept. Counts derived from sampled
+	// traffic can be scaled by its inverse. 0 if nothing was left out.
+	SampleRate float64
+
 	// The time at which the first packet was observed
 	ObservationTime time.Time
 
@@ -42,6 +73,19 @@ type NetTraffic struct {
 	FinalPacketTime time.Time
 }
 
+// An encapsulation that traffic was carried in.
+type Tunnel struct {
+	// "GRE", "VXLAN", "GENEVE" or "IPIP".
+	Type string
+
+	// Endpoints of the tunnel, from the outer IP header.
+	SrcIP net.IP
+	DstIP net.IP
+
+	// VXLAN or GENEVE network identifier, or GRE key. 0 if there is none.
+	ID uint32
+}
+
 // Interface implemented by all types of data that can be parsed from the
 // network.
 type ParsedNetworkContent interface {
@@ -55,6 +99,57 @@ var _ ParsedNetworkContent = (*DroppedBytes)(nil)
 
 func (DroppedBytes) ReleaseBuffers() {}
 
+// Marks the start of a capture file when several files are read as one
+// stream, as with pcap.MultiFileReader. Packets that follow, up to the next
+// CaptureFileBoundary, were read from the file at Path. Traffic reassembled
+// from streams that span several files may be delivered after later
+// boundaries.
+type CaptureFileBoundary struct {
+	Path string
+}
+
+var _ ParsedNetworkContent = CaptureFileBoundary{}
+
+func (CaptureFileBoundary) ReleaseBuffers() {}
+
+// Reports that a TCP connection or UDP flow was forgotten while still active,
+// to make room for a new one once the most that may be tracked at once was
+// reached. Content its parsers had not completed is lost, and later packets of
+// the connection are not attributed to it.
+type ConnectionEvicted struct {
+	ConnectionID uuid.UUID
+}
+
+var _ ParsedNetworkContent = ConnectionEvicted{}
+
+func (ConnectionEvicted) ReleaseBuffers() {}
+
+// Represents data that no parser accepted, with a guess at its protocol.
+// Produced from DroppedBytes by a classifier such as
+// analysis.ProtocolClassifier.
+type UnknownTraffic struct {
+	// Identifies the TCP connection to which this data belongs.
+	ConnectionID uuid.UUID
+
+	// The number of bytes, as in DroppedBytes.
+	Length int64
+
+	// The most likely protocol, e.g. "SSH" or "MySQL", or "text" or "binary"
+	// if only the nature of the data could be told. Empty if there was
+	// nothing to go on.
+	ProbableProtocol string
+
+	// Confidence in ProbableProtocol, between 0 and 1.
+	Confidence float64
+
+	// What the guess was based on, e.g. "magic bytes" or "port 3306".
+	Reason string
+}
+
+var _ ParsedNetworkContent = (*UnknownTraffic)(nil)
+
+func (UnknownTraffic) ReleaseBuffers() {}
+
 // Represents metadata from an observed TCP packet.
 type TCPPacketMetadata struct {
 	// Whether the SYN flag was set in the observed packet.
@@ -68,6 +163,18 @@ type TCPPacketMetadata struct {
 
 	// Whstring   {}ether the RST flag was set in the observed packet.
 	RST bool
+
+	// Number of bytes of TCP payload in the observed packet.
+	PayloadLength int
+
+	// The fingerprint of the sender's operating system. Only populated for SYN
+	// packets (with or without ACK), whose options reveal the most about the
+	// sender's TCP stack.
+	OS *OSFingerprint
+
+	// The content type of the TLS record the payload starts with, if it looks
+	// like one. 0 otherwise. Records that do not start a packet are not seen.
+	TLSRecordType TLSRecordType
 }
 
 var _ ParsedNetworkContent = (*TCPPacketMetadata)(nil)
@@ -84,12 +191,104 @@ type TCPConnectionMetadata struct {
 
 	// Whether and how the connection was closed.
 	EndState TCPConnectionEndState
+
+	// Fingerprints of the operating systems of the initiator and the responder,
+	// from their SYN and SYN+ACK packets respectively, if those were seen.
+	InitiatorOS *OSFingerprint
+	ResponderOS *OSFingerprint
+
+	// Time between the first and the last packet seen on the connection.
+	Duration time.Duration
+
+	// Traffic in each direction, relative to the source and destination of the
+	// NetTraffic carrying this metadata.
+	SourceToDest TCPDirectionStats
+	DestToSource TCPDirectionStats
+}
+
+// Counts the packets sent in one direction of a TCP connection.
+type TCPDirectionStats struct {
+	Packets int64
+
+	// Bytes of TCP payload, including retransmitted bytes.
+	Bytes int64
+
+	// Segments that repeated sequence numbers already seen.
+	Retransmissions int64
+
+	// Segments that filled a gap left by segments seen earlier.
+	OutOfOrder int64
+}
+
+// Passive fingerprint of the operating system of a host, derived from the
+// characteristics of a TCP SYN or SYN+ACK packet it sent.
+type OSFingerprint struct {
+	// A p0f-style signature: ip version, initial TTL, MSS, window size and
+	// scale, and option layout, separated by colons.
+	Signature string
+
+	// The TTL (or IPv6 hop limit) observed on the packet, and the initial TTL
+	// it was most likely sent with.
+	TTL        uint8
+	InitialTTL uint8
+
+	WindowSize uint16
+
+	// -1 if the window scale option was absent.
+	WindowScale int
+
+	// 0 if the MSS option was absent.
+	MSS uint16
+
+	// The TCP options in the order they appeared, e.g. "mss,sok,ts,nop,ws".
+	Options string
+
+	// The best guess at the operating system (e.g. "Linux", "Windows"), or
+	// empty if nothing matched.
+	OS string
 }
 
 var _ ParsedNetworkContent = (*TCPConnectionMetadata)(nil)
 
 func (TCPConnectionMetadata) ReleaseBuffers() {}
 
+// Network-quality measurements of a TCP connection, accumulated since its
+// first packet. Produced only when enabled, periodically while the connection
+// is active and once more when it completes.
+type TCPQualityMetrics struct {
+	ConnectionID uuid.UUID
+
+	// Time from the initiator's SYN to the responder's SYN+ACK. 0 if either
+	// was not seen.
+	HandshakeRTT time.Duration
+
+	// Measurements in each direction, relative to the source and destination
+	// of the NetTraffic carrying them.
+	SourceToDest TCPQualityStats
+	DestToSource TCPQualityStats
+
+	// Whether the connection has completed, so that no further metrics will
+	// be produced for it.
+	Final bool
+}
+
+// Counts the events indicating loss or congestion in one direction of a TCP
+// connection.
+type TCPQualityStats struct {
+	Retransmissions int64
+	OutOfOrder      int64
+
+	// Pure ACKs repeating the previous acknowledgement and window.
+	DuplicateACKs int64
+
+	// Packets advertising a zero receive window.
+	ZeroWindows int64
+}
+
+var _ ParsedNetworkContent = (*TCPQualityMetrics)(nil)
+
+func (TCPQualityMetrics) ReleaseBuffers() {}
+
 // Identifies which of the two endpoints of a connection initiated that
 // connection.
 type TCPConnectionInitiator int
@@ -104,6 +303,19 @@ const (
 	DestInitiator
 )
 
+// The part a host plays in traffic.
+type HostRole string
+
+const (
+	UnknownHostRole HostRole = ""
+
+	// The host initiated the connection, or sent the request.
+	ClientRole HostRole = "CLIENT"
+
+	// The host accepted the connection, or answered the request.
+	ServerRole HostRole = "SERVER"
+)
+
 // Indicates whether a TCP connection was closed, and if so, how.
 type TCPConnectionEndState string
 
@@ -119,6 +331,10 @@ const (
 )
 
 type DNSRequest struct {
+	// The protocol that carried the message. Empty is equivalent to
+	// DNSProtocol.
+	Protocol NameResolutionProtocol
+
 	// Header fields
 	ID     uint16
 	QR     bool
@@ -162,13 +378,43 @@ type HTTPRequest struct {
 	BodyDecompressed bool // true if the body is already decompressed
 	Cookies          []*http.Cookie
 
+	// Header names in the order they appeared, with their original case. Nil
+	// if the parser does not record it.
+	HeaderOrder []string
+
+	// Fields sent after a chunked body. Nil if there were none.
+	Trailer http.Header
+
+	// The length of the whole decoded body, of which Body may only hold a
+	// prefix. Set by the HTTP/1.x parser.
+	BodySize int64
+
+	// The hex-encoded SHA-256 hash of the whole decoded body, if the parser
+	// was configured to record it.
+	BodyHash string
+
+	// True if Body holds only part of the request body, either because the
+	// body exceeded the parser's limit or because the stream ended early.
+	Truncated bool
+
+	// True if the request was cut short before the end of its body, by the
+	// parser's length limit or the stream ending early, so that BodySize and
+	// BodyHash cover only the part that was seen.
+	BodyIncomplete bool
+
 	// The buffer (if any) that owns the storage backing the request body.
 	buffer mempool.Buffer
 }
 
 var _ ParsedNetworkContent = (*HTTPRequest)(nil)
 
-func (r HTTPRequest) ReleaseBuffers() { r.buffer.Release() }
+// Safe to call on a message without a buffer, such as one unmarshaled from
+// JSON.
+func (r HTTPRequest) ReleaseBuffers() {
+	if r.buffer != nil {
+		r.buffer.Release()
+	}
+}
 
 // Returns a string key that associates this request with its corresponding
 // response.
@@ -189,13 +435,41 @@ type HTTPResponse struct {
 	BodyDecompressed bool // true if the body is already decompressed
 	Cookies          []*http.Cookie
 
+	// Fields sent after a chunked body. Nil if there were none.
+	Trailer http.Header
+
+	// The length of the whole decoded body, of which Body may only hold a
+	// prefix. Set by the HTTP/1.x parser.
+	BodySize int64
+
+	// The hex-encoded SHA-256 hash of the whole decoded body, if the parser
+	// was configured to record it.
+	BodyHash string
+
+	// Informational responses sent before this one, in order, such as
+	// 100 Continue or 103 Early Hints.
+	Interim []HTTPInterimResponse
+
+	// True if Body holds only part of the response body, either because the
+	// body exceeded the parser's limit or because the stream ended early.
+	Truncated bool
+
+	// True if the response was cut short before the end of its body, by the
+	// parser's length limit or the stream ending early, so that BodySize and
+	// BodyHash cover only the part that was seen.
+	BodyIncomplete bool
+
 	// The buffer (if any) that owns the storage backing the request body.
 	buffer mempool.Buffer
 }
 
 var _ ParsedNetworkContent = (*HTTPResponse)(nil)
 
-func (r HTTPResponse) ReleaseBuffers() { r.buffer.Release() }
+func (r HTTPResponse) ReleaseBuffers() {
+	if r.buffer != nil {
+		r.buffer.Release()
+	}
+}
 
 // Returns a string key that associates this response with its corresponding
 // request.
@@ -203,6 +477,32 @@ func (r HTTPResponse) GetStreamKey() string {
 	return r.StreamID.String() + ":" + strconv.Itoa(r.Seq)
 }
 
+// A 1xx response that precedes the final response to a request. 101
+// Switching Protocols is a final response.
+type HTTPInterimResponse struct {
+	StatusCode int
+	Header     http.Header
+}
+
+// A piece of an HTTP message body, delivered while the body is still being
+// parsed. Chunked and other transfer encodings have already been removed.
+type HTTPBodyChunk struct {
+	// Identifies the message the chunk belongs to, as in HTTPRequest and
+	// HTTPResponse.
+	StreamID  uuid.UUID
+	Seq       int
+	IsRequest bool
+
+	// Position of Data within the decoded body.
+	Offset int64
+
+	// The decoded bytes. Only valid for the duration of the callback.
+	Data []byte
+
+	// Set on the last chunk of a body, which carries no data.
+	Final bool
+}
+
 // Represents metadata from an observed TLS 1.2 or 1.3 Client Hello message.
 type TLSClientHello struct {
 	// Identifies the TCP connection to which this message belongs.
@@ -217,6 +517,17 @@ type TLSClientHello struct {
 
 	ServerName    string
 	AlpnProtocols []string
+
+	// Versions from the supported_versions extension, and signature
+	// algorithms from the signature_algorithms extension, in the client's
+	// order. Used for JA4.
+	SupportedVersions   []uint16
+	SignatureAlgorithms []uint16
+
+	// Whether the hello carries an encrypted_client_hello extension. If so,
+	// ServerName and AlpnProtocols are from the outer hello and name the
+	// client-facing server rather than the real destination.
+	ECHPresent bool
 }
 
 var _ ParsedNetworkContent = (*TLSClientHello)(nil)
@@ -232,6 +543,13 @@ type TLSServerHello struct {
 	Version     TLSVersion
 	CipherSuite uint16
 	Extensions  []uint16
+
+	// The version from the supported_versions extension, which TLS 1.3
+	// servers use instead of Version. Zero if the extension is absent.
+	SelectedVersion TLSVersion
+
+	// The protocol from the server's ALPN extension, if any.
+	SelectedProtocol string
 }
 
 var _ ParsedNetworkContent = (*TLSServerHello)(nil)
@@ -242,13 +560,58 @@ func (TLSServerHello) ReleaseBuffers() {}
 type TLSCertificate struct {
 	// Identifies the TCP connection to which this message belongs.
 	ConnectionID uuid.UUID
+
+	// The chain sent by the server, starting with its own certificate.
 	Certificates []*x509.Certificate
+
+	// Validation metadata for each of Certificates.
+	Chain []TLSCertificateInfo
 }
 
 var _ ParsedNetworkContent = (*TLSCertificate)(nil)
 
 func (TLSCertificate) ReleaseBuffers() {}
 
+// Summarizes a certificate in a chain. No trust store is consulted, so this
+// only describes the chain as sent.
+type TLSCertificateInfo struct {
+	Subject string
+	Issuer  string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Whether the certificate is signed by its own key.
+	SelfSigned bool
+
+	// Whether the certificate is signed by the next certificate in the chain.
+	// False for the last certificate.
+	SignedByNext bool
+}
+
+// Describes each certificate in a chain, which starts with the leaf.
+func NewTLSCertificateChain(certs []*x509.Certificate) []TLSCertificateInfo {
+	chain := make([]TLSCertificateInfo, len(certs))
+	for i, c := range certs {
+		chain[i] = TLSCertificateInfo{
+			Subject:    c.Subject.String(),
+			Issuer:     c.Issuer.String(),
+			NotBefore:  c.NotBefore,
+			NotAfter:   c.NotAfter,
+			SelfSigned: bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil,
+		}
+		if i+1 < len(certs) {
+			chain[i].SignedByNext = c.CheckSignatureFrom(certs[i+1]) == nil
+		}
+	}
+	return chain
+}
+
+// Reports whether t falls within the certificate's validity period.
+func (c TLSCertificateInfo) ValidAt(t time.Time) bool {
+	return !t.Before(c.NotBefore) && !t.After(c.NotAfter)
+}
+
 // Metadata from an observed TLS handshake.
 type TLSHandshakeMetadata struct {
 	// Uniquely identifies the underlying TCP connection.
@@ -268,12 +631,21 @@ type TLSHandshakeMetadata struct {
 	// extension, if any.
 	SelectedProtocol *string
 
+	// The cipher suite selected by the server. Only populated if the Server
+	// Hello was seen.
+	CipherSuite uint16
+
 	// The SANs seen in the server's certificate. The server's certificate is
 	// encrypted in TLS 1.3, so this is only populated for TLS 1.2 connections.
 	SubjectAlternativeNames []string
 
+	// Time from the first to the last handshake message observed. Set by
+	// TLSConnectionTracker.
+	Duration time.Duration
+
 	clientHandshakeSeen bool
 	serverHandshakeSeen bool
+	certificateSeen     bool
 }
 
 var _ ParsedNetworkContent = (*TLSHandshakeMetadata)(nil)
@@ -321,6 +693,36 @@ func (tls *TLSHandshakeMetadata) AddServerHello(hello *TLSServerHello) error {
 	// is later changed.
 
 	tls.Version = hello.Version
+	if hello.SelectedVersion != 0 {
+		tls.Version = hello.SelectedVersion
+	}
+	tls.CipherSuite = hello.CipherSuite
+	if hello.SelectedProtocol != "" {
+		protocol := hello.SelectedProtocol
+		tls.SelectedProtocol = &protocol
+	}
+	return nil
+}
+
+func (tls *TLSHandshakeMetadata) AddCertificate(cert *TLSCertificate) error {
+	if tls.ConnectionID != cert.ConnectionID {
+		return errors.Errorf("mismatched connections: %s and %s", tls.ConnectionID.String(), cert.ConnectionID.String())
+	}
+
+	if tls.certificateSeen {
+		return errors.Errorf("multiple server certificates seen for connection %s", tls.ConnectionID.String())
+	}
+	tls.certificateSeen = true
+
+	// The server's own certificate comes first, followed by the chain.
+	if len(cert.Certificates) == 0 {
+		return nil
+	}
+	leaf := cert.Certificates[0]
+	tls.SubjectAlternativeNames = append(tls.SubjectAlternativeNames, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		tls.SubjectAlternativeNames = append(tls.SubjectAlternativeNames, ip.String())
+	}
 	return nil
 }
 
@@ -381,12 +783,59 @@ func (tls *TLSHandshakeMetadata) ApplicationLatencyMeasurable() bool {
 type ICMPv4 struct {
 	TypeCode layers.ICMPv4TypeCode
 	Checksum uint16
-	Id       uint16
-	Seq      uint16
+	// Identifier and sequence number of echo and timestamp messages.
+	Id  uint16
+	Seq uint16
+
+	// Names of the type and code, e.g. "DestinationUnreachable" and "Port".
+	// CodeName is empty for types without codes.
+	TypeName string
+	CodeName string
+
+	// Next-hop MTU of "fragmentation needed" messages, for path MTU discovery.
+	MTU uint16
+
+	// The datagram that caused an error message: destination unreachable,
+	// time exceeded, parameter problem or redirect.
+	Original *ICMPOriginal
 }
 
 func (ICMPv4) ReleaseBuffers() {}
 
+type ICMPv6 struct {
+	TypeCode layers.ICMPv6TypeCode
+	Checksum uint16
+	// Identifier and sequence number of echo messages.
+	Id  uint16
+	Seq uint16
+
+	// Names of the type and code, as in ICMPv4.
+	TypeName string
+	CodeName string
+
+	// MTU of "packet too big" messages, for path MTU discovery.
+	MTU uint32
+
+	// The datagram that caused an error message: destination unreachable,
+	// packet too big, time exceeded or parameter problem.
+	Original *ICMPOriginal
+}
+
+func (ICMPv6) ReleaseBuffers() {}
+
+// The start of the datagram that caused an ICMP error, as quoted in the error.
+// Traceroute tools tell their probes apart by it.
+type ICMPOriginal struct {
+	SrcIP    net.IP
+	DstIP    net.IP
+	Protocol layers.IPProtocol
+	TTL      uint8
+
+	// Ports of TCP, UDP and SCTP datagrams, if quoted. 0 otherwise.
+	SrcPort int
+	DstPort int
+}
+
 // Represents an observed HTTP/2 connection preface; no data from it
 // is stored.
 type HTTP2ConnectionPreface struct {
@@ -394,14 +843,6 @@ type HTTP2ConnectionPreface struct {
 
 func (HTTP2ConnectionPreface) ReleaseBuffers() {}
 
-// Represents an observed QUIC handshake (initial packet).
-// Currently empty because we're only interested in the presence
-// of QUIC traffic, not its payload.
-type QUICHandshakeMetadata struct {
-}
-
-func (QUICHandshakeMetadata) ReleaseBuffers() {}
-
 // FtpSmtpRequest
 type FtpSmtpRequest struct {
 	// stream id
@@ -425,3 +866,44 @@ type FtpSmtpResponse struct {
 var _ ParsedNetworkContent = (*FtpSmtpResponse)(nil)
 
 func (FtpSmtpResponse) ReleaseBuffers() {}
+
+// Represents a mail message sent with the SMTP DATA command.
+type SMTPMessage struct {
+	// stream id
+	ConnectionID uuid.UUID
+
+	// Header fields. Addresses are as they appear in the header, which may
+	// differ from the SMTP envelope.
+	From      string
+	To        []string
+	Cc        []string
+	Subject   string
+	Date      string
+	MessageID string
+
+	// The media type of the message, e.g. multipart/mixed.
+	ContentType string
+
+	// The first text/plain part of the message, decoded.
+	Text string
+
+	Attachments []SMTPAttachment
+
+	// The message as sent, after removing dot-stuffing and the terminating
+	// line.
+	Data []byte
+}
+
+var _ ParsedNetworkContent = (*SMTPMessage)(nil)
+
+func (SMTPMessage) ReleaseBuffers() {}
+
+// Describes a MIME part of an SMTPMessage that is an attachment.
+type SMTPAttachment struct {
+	Filename    string
+	ContentType string
+
+	// Size and hex-encoded SHA-256 of the decoded content.
+	Size   int64
+	SHA256 string
+}
@@ -0,0 +1,232 @@
+package gnet
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Default time to wait for the other half of an HTTP exchange.
+const DefaultPairTimeout = 30 * time.Second
+
+// Represents an HTTP request together with its response. Either side may be
+// nil if the other half was not observed before the PairCollector's timeout.
+type HTTPExchange struct {
+	Request  *HTTPRequest
+	Response *HTTPResponse
+
+	// When the packets carrying the first and last bytes of each message were
+	// captured. Zero for a missing message.
+	RequestStart  time.Time
+	RequestEnd    time.Time
+	ResponseStart time.Time
+	ResponseEnd   time.Time
+
+	// Time between the end of the request and the start of the response, that
+	// is, the server's processing time. Zero if either message is missing.
+	Latency time.Duration
+
+	// Time from the start of the request to the start of the response, and to
+	// the end of the response. Zero if either message is missing.
+	TimeToFirstByte time.Duration
+	Duration        time.Duration
+}
+
+var _ ParsedNetworkContent = (*HTTPExchange)(nil)
+
+func (e HTTPExchange) ReleaseBuffers() {
+	if e.Request != nil {
+		e.Request.ReleaseBuffers()
+	}
+	if e.Response != nil {
+		e.Response.ReleaseBuffers()
+	}
+}
+
+// PairCollector matches HTTPRequests to HTTPResponses by their stream key and
+// combines them into HTTPExchanges. Messages of the same kind with the same
+// key, such as a retransmitted request, wait in the order they arrived, and the
+// oldest is paired first.
+//
+// Timeouts are measured against observation times in the traffic rather than
+// the wall clock, so reading a capture file produces the same pairs regardless
+// of how fast it is read.
+type PairCollector struct {
+	timeout time.Duration
+
+	mu sync.Mutex
+
+	// By stream key, oldest first. All the messages waiting under a key are of
+	// the same kind, since one of the other kind would have been paired.
+	pending map[string][]*list.Element
+	order   *list.List // of *pendingHalf, oldest first
+}
+
+type pendingHalf struct {
+	key       string
+	isRequest bool
+	traffic   NetTraffic
+}
+
+// Creates a PairCollector that gives up waiting for the other half of an
+// exchange after timeout. If timeout is not positive, DefaultPairTimeout is
+// used.
+func NewPairCollector(timeout time.Duration) *PairCollector {
+	if timeout <= 0 {
+		timeout = DefaultPairTimeout
+	}
+	return &PairCollector{
+		timeout: timeout,
+		pending: map[string][]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Run consumes in and returns a channel on which HTTP requests and responses
+// are replaced by HTTPExchanges. Other traffic is passed through unchanged.
+// Unmatched messages are emitted as one-sided exchanges once they time out, or
+// when in is closed. The returned channel is buffered like in.
+func (c *PairCollector) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range c.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range c.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe processes a single piece of traffic and returns the traffic that is
+// ready to be emitted as a result.
+func (c *PairCollector) Observe(t NetTraffic) []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := c.expire(t.ObservationTime)
+
+	var key string
+	var isRequest bool
+	switch content := t.Content.(type) {
+	case HTTPRequest:
+		key, isRequest = content.GetStreamKey(), true
+	case HTTPResponse:
+		key = content.GetStreamKey()
+	default:
+		return append(results, t)
+	}
+
+	waiting := c.pending[key]
+	if len(waiting) == 0 || waiting[0].Value.(*pendingHalf).isRequest == isRequest {
+		half := &pendingHalf{key: key, isRequest: isRequest, traffic: t}
+		c.pending[key] = append(waiting, c.order.PushBack(half))
+		return results
+	}
+
+	other := c.remove(waiting[0]).traffic
+	if isRequest {
+		return append(results, newExchange(t, other))
+	}
+	return append(results, newExchange(other, t))
+}
+
+// Flush returns all unmatched messages as one-sided exchanges.
+func (c *PairCollector) Flush() []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		results = append(results, c.evict(c.order.Front()))
+	}
+	return results
+}
+
+// Evicts messages that have been waiting longer than the timeout as of now.
+func (c *PairCollector) expire(now time.Time) []NetTraffic {
+	if now.IsZero() {
+		return nil
+	}
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		if now.Sub(front.Value.(*pendingHalf).traffic.ObservationTime) < c.timeout {
+			break
+		}
+		results = append(results, c.evict(front))
+	}
+	return results
+}
+
+func (c *PairCollector) evict(elem *list.Element) NetTraffic {
+	half := c.remove(elem)
+	if half.isRequest {
+		return newExchange(half.traffic, NetTraffic{})
+	}
+	return newExchange(NetTraffic{}, half.traffic)
+}
+
+// Removes a waiting message from the order and from the messages waiting
+// under its key.
+func (c *PairCollector) remove(elem *list.Element) *pendingHalf {
+	half := c.order.Remove(elem).(*pendingHalf)
+	waiting := c.pending[half.key]
+	for i, e := range waiting {
+		if e == elem {
+			waiting = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(waiting) == 0 {
+		delete(c.pending, half.key)
+	} else {
+		c.pending[half.key] = waiting
+	}
+	return half
+}
+
+// Combines a request and a response into an exchange. Either may be empty.
+// The endpoints of the result are oriented from client to server.
+func newExchange(req, resp NetTraffic) NetTraffic {
+	var e HTTPExchange
+	result := req
+
+	if r, ok := req.Content.(HTTPRequest); ok {
+		e.Request = &r
+		e.RequestStart = req.ObservationTime
+		e.RequestEnd = req.FinalPacketTime
+	}
+
+	if r, ok := resp.Content.(HTTPResponse); ok {
+		e.Response = &r
+		e.ResponseStart = resp.ObservationTime
+		e.ResponseEnd = resp.FinalPacketTime
+
+		if e.Request == nil {
+			result = resp
+			result.SrcIP, result.DstIP = resp.DstIP, resp.SrcIP
+			result.SrcPort, result.DstPort = resp.DstPort, resp.SrcPort
+		} else {
+			result.FinalPacketTime = resp.FinalPacketTime
+			if !e.RequestEnd.IsZero() && !e.ResponseStart.IsZero() {
+				e.Latency = e.ResponseStart.Sub(e.RequestEnd)
+			}
+			if !e.RequestStart.IsZero() && !e.ResponseStart.IsZero() {
+				e.TimeToFirstByte = e.ResponseStart.Sub(e.RequestStart)
+			}
+			if !e.RequestStart.IsZero() && !e.ResponseEnd.IsZero() {
+				e.Duration = e.ResponseEnd.Sub(e.RequestStart)
+			}
+		}
+	}
+
+	result.Payload = nil
+	result.Content = e
+	return result
+}
@@ -0,0 +1,114 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairCollector(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	stream := uuid.New()
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+
+	c := NewPairCollector(time.Second)
+
+	assert.Empty(t, c.Observe(NetTraffic{
+		SrcIP: client, SrcPort: 40000, DstIP: server, DstPort: 80,
+		Content:         HTTPRequest{StreamID: stream, Seq: 1, Method: "GET"},
+		ObservationTime: start,
+		FinalPacketTime: start.Add(10 * time.Millisecond),
+	}))
+	assert.Empty(t, c.Observe(NetTraffic{
+		SrcIP: client, SrcPort: 40000, DstIP: server, DstPort: 80,
+		Content:         HTTPRequest{StreamID: stream, Seq: 2, Method: "GET"},
+		ObservationTime: start.Add(20 * time.Millisecond),
+		FinalPacketTime: start.Add(20 * time.Millisecond),
+	}))
+
+	results := c.Observe(NetTraffic{
+		SrcIP: server, SrcPort: 80, DstIP: client, DstPort: 40000,
+		Content:         HTTPResponse{StreamID: stream, Seq: 1, StatusCode: 200},
+		ObservationTime: start.Add(60 * time.Millisecond),
+		FinalPacketTime: start.Add(70 * time.Millisecond),
+	})
+	if assert.Len(t, results, 1) {
+		e := results[0].Content.(HTTPExchange)
+		assert.Equal(t, 1, e.Request.Seq)
+		assert.Equal(t, 200, e.Response.StatusCode)
+		assert.Equal(t, start, e.RequestStart)
+		assert.Equal(t, start.Add(10*time.Millisecond), e.RequestEnd)
+		assert.Equal(t, start.Add(60*time.Millisecond), e.ResponseStart)
+		assert.Equal(t, start.Add(70*time.Millisecond), e.ResponseEnd)
+		assert.Equal(t, 50*time.Millisecond, e.Latency)
+		assert.Equal(t, 60*time.Millisecond, e.TimeToFirstByte)
+		assert.Equal(t, 70*time.Millisecond, e.Duration)
+		assert.True(t, results[0].SrcIP.Equal(client))
+	}
+
+	// The second request times out once traffic a second later is observed.
+	results = c.Observe(NetTraffic{ObservationTime: start.Add(2 * time.Second)})
+	if assert.Len(t, results, 2) {
+		e := results[0].Content.(HTTPExchange)
+		assert.Equal(t, 2, e.Request.Seq)
+		assert.Nil(t, e.Response)
+		assert.Zero(t, e.TimeToFirstByte)
+		assert.Nil(t, results[1].Content)
+	}
+
+	assert.Empty(t, c.Flush())
+}
+
+func TestPairCollectorRepeatedKey(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	stream := uuid.New()
+	c := NewPairCollector(time.Second)
+
+	request := func(at time.Duration, method string) NetTraffic {
+		return NetTraffic{
+			Content:         HTTPRequest{StreamID: stream, Seq: 1, Method: method},
+			ObservationTime: start.Add(at),
+			FinalPacketTime: start.Add(at),
+		}
+	}
+	response := func(at time.Duration, status int) NetTraffic {
+		return NetTraffic{
+			Content:         HTTPResponse{StreamID: stream, Seq: 1, StatusCode: status},
+			ObservationTime: start.Add(at),
+			FinalPacketTime: start.Add(at),
+		}
+	}
+
+	// A retransmitted request waits behind the original, which is paired
+	// first.
+	assert.Empty(t, c.Observe(request(0, "GET")))
+	assert.Empty(t, c.Observe(request(10*time.Millisecond, "POST")))
+	results := c.Observe(response(20*time.Millisecond, 200))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, "GET", results[0].Content.(HTTPExchange).Request.Method)
+	}
+	results = c.Observe(response(30*time.Millisecond, 201))
+	if assert.Len(t, results, 1) {
+		e := results[0].Content.(HTTPExchange)
+		assert.Equal(t, "POST", e.Request.Method)
+		assert.Equal(t, 201, e.Response.StatusCode)
+	}
+
+	// Neither of two responses is dropped.
+	assert.Empty(t, c.Observe(response(40*time.Millisecond, 200)))
+	assert.Empty(t, c.Observe(response(50*time.Millisecond, 500)))
+	results = c.Observe(request(60*time.Millisecond, "GET"))
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, 200, results[0].Content.(HTTPExchange).Response.StatusCode)
+	}
+	results = c.Flush()
+	if assert.Len(t, results, 1) {
+		e := results[0].Content.(HTTPExchange)
+		assert.Nil(t, e.Request)
+		assert.Equal(t, 500, e.Response.StatusCode)
+	}
+	assert.Empty(t, c.Flush())
+}
@@ -0,0 +1,709 @@
+// Package pb encodes NetTraffic as protobuf, in the form described by
+// gnet.proto, so that parse results can be sent to services written in other
+// languages.
+//
+// TCP, HTTP and TLS hello content has messages of its own. Other content is
+// sent as an OtherContent message holding its JSON form, so any content type
+// registered with gnet.RegisterContentType can be encoded.
+package pb
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Field numbers of the NetTraffic message.
+const (
+	layerTypeField       protowire.Number = 1
+	srcIPField           protowire.Number = 2
+	srcPortField         protowire.Number = 3
+	dstIPField           protowire.Number = 4
+	dstPortField         protowire.Number = 5
+	payloadField         protowire.Number = 6
+	connectionIDField    protowire.Number = 7
+	interfaceField       protowire.Number = 8
+	tunnelsField         protowire.Number = 9
+	vlansField           protowire.Number = 10
+	observationTimeField protowire.Number = 11
+	finalPacketTimeField protowire.Number = 12
+	enrichmentField      protowire.Number = 13
+	localRoleField       protowire.Number = 14
+	sampleRateField      protowire.Number = 15
+	indicatorsField      protowire.Number = 16
+
+	tcpPacketField      protowire.Number = 20
+	tcpConnectionField  protowire.Number = 21
+	httpRequestField    protowire.Number = 22
+	httpResponseField   protowire.Number = 23
+	tlsClientHelloField protowire.Number = 24
+	tlsServerHelloField protowire.Number = 25
+	otherContentField   protowire.Number = 100
+)
+
+// Marshal encodes t as a NetTraffic message.
+func Marshal(t gnet.NetTraffic) ([]byte, error) {
+	var e encoder
+	e.string(layerTypeField, t.LayerType)
+	e.ip(srcIPField, t.SrcIP)
+	e.uint(srcPortField, uint64(t.SrcPort))
+	e.ip(dstIPField, t.DstIP)
+	e.uint(dstPortField, uint64(t.DstPort))
+	e.bytes(payloadField, t.Payload)
+	e.uuid(connectionIDField, t.ConnectionID)
+	e.string(interfaceField, t.Interface)
+	for _, tun := range t.Tunnels {
+		e.message(tunnelsField, func(e *encoder) {
+			e.string(1, tun.Type)
+			e.ip(2, tun.SrcIP)
+			e.ip(3, tun.DstIP)
+			e.uint(4, uint64(tun.ID))
+		})
+	}
+	vlans := make([]uint64, len(t.VLANs))
+	for i, v := range t.VLANs {
+		vlans[i] = uint64(v)
+	}
+	e.packed(vlansField, vlans)
+	e.timestamp(observationTimeField, t.ObservationTime)
+	e.timestamp(finalPacketTimeField, t.FinalPacketTime)
+	if t.Enrichment != nil {
+		e.message(enrichmentField, func(e *encoder) {
+			encodeEndpointInfo(e, 1, t.Enrichment.Src)
+			encodeEndpointInfo(e, 2, t.Enrichment.Dst)
+		})
+	}
+	e.string(localRoleField, string(t.LocalRole))
+	e.double(sampleRateField, t.SampleRate)
+	for _, m := range t.Indicators {
+		e.message(indicatorsField, func(e *encoder) { encodeIndicatorMatch(e, m) })
+	}
+
+	switch c := t.Content.(type) {
+	case nil:
+	case gnet.TCPPacketMetadata:
+		e.message(tcpPacketField, func(e *encoder) { encodeTCPPacket(e, c) })
+	case gnet.TCPConnectionMetadata:
+		e.message(tcpConnectionField, func(e *encoder) { encodeTCPConnection(e, c) })
+	case gnet.HTTPRequest:
+		e.message(httpRequestField, func(e *encoder) { encodeHTTPRequest(e, c) })
+	case gnet.HTTPResponse:
+		e.message(httpResponseField, func(e *encoder) { encodeHTTPResponse(e, c) })
+	case gnet.TLSClientHello:
+		e.message(tlsClientHelloField, func(e *encoder) { encodeTLSClientHello(e, c) })
+	case gnet.TLSServerHello:
+		e.message(tlsServerHelloField, func(e *encoder) { encodeTLSServerHello(e, c) })
+	default:
+		name, data, err := gnet.MarshalContent(c)
+		if err != nil {
+			return nil, err
+		}
+		e.message(otherContentField, func(e *encoder) {
+			e.string(1, name)
+			e.bytes(2, data)
+		})
+	}
+	return e.b, nil
+}
+
+// Unmarshal decodes a NetTraffic message. Unknown fields are skipped.
+func Unmarshal(b []byte) (gnet.NetTraffic, error) {
+	var t gnet.NetTraffic
+	err := decode(b, func(f field) (err error) {
+		switch f.num {
+		case layerTypeField:
+			t.LayerType = f.string()
+		case srcIPField:
+			t.SrcIP = f.ip()
+		case srcPortField:
+			t.SrcPort = f.int()
+		case dstIPField:
+			t.DstIP = f.ip()
+		case dstPortField:
+			t.DstPort = f.int()
+		case payloadField:
+			t.Payload = f.bytes()
+		case connectionIDField:
+			t.ConnectionID, err = f.uuid()
+		case interfaceField:
+			t.Interface = f.string()
+		case tunnelsField:
+			var tun gnet.Tunnel
+			err = decode(f.b, func(f field) error {
+				switch f.num {
+				case 1:
+					tun.Type = f.string()
+				case 2:
+					tun.SrcIP = f.ip()
+				case 3:
+					tun.DstIP = f.ip()
+				case 4:
+					tun.ID = uint32(f.v)
+				}
+				return nil
+			})
+			t.Tunnels = append(t.Tunnels, tun)
+		case vlansField:
+			var vlans []uint16
+			vlans, err = f.uint16s()
+			t.VLANs = append(t.VLANs, vlans...)
+		case observationTimeField:
+			t.ObservationTime, err = f.timestamp()
+		case finalPacketTimeField:
+			t.FinalPacketTime, err = f.timestamp()
+		case enrichmentField:
+			t.Enrichment, err = decodeEnrichment(f.b)
+		case localRoleField:
+			t.LocalRole = gnet.HostRole(f.string())
+		case sampleRateField:
+			t.SampleRate = f.double()
+		case indicatorsField:
+			var m gnet.IndicatorMatch
+			m, err = decodeIndicatorMatch(f.b)
+			t.Indicators = append(t.Indicators, m)
+		case tcpPacketField:
+			t.Content, err = decodeTCPPacket(f.b)
+		case tcpConnectionField:
+			t.Content, err = decodeTCPConnection(f.b)
+		case httpRequestField:
+			t.Content, err = decodeHTTPRequest(f.b)
+		case httpResponseField:
+			t.Content, err = decodeHTTPResponse(f.b)
+		case tlsClientHelloField:
+			t.Content, err = decodeTLSClientHello(f.b)
+		case tlsServerHelloField:
+			t.Content, err = decodeTLSServerHello(f.b)
+		case otherContentField:
+			t.Content, err = decodeOtherContent(f.b)
+		}
+		return err
+	})
+	if err != nil {
+		return gnet.NetTraffic{}, errors.Wrap(err, "failed to unmarshal traffic")
+	}
+	return t, nil
+}
+
+func encodeEndpointInfo(e *encoder, num protowire.Number, info *gnet.EndpointInfo) {
+	if info == nil {
+		return
+	}
+	e.message(num, func(e *encoder) {
+		e.string(1, info.Country)
+		e.uint(2, uint64(info.ASN))
+		e.string(3, info.ASOrganization)
+		e.strings(4, info.Hostnames)
+		e.strings(5, info.DNSNames)
+	})
+}
+
+func decodeEnrichment(b []byte) (*gnet.Enrichment, error) {
+	var enrichment gnet.Enrichment
+	err := decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			enrichment.Src, err = decodeEndpointInfo(f.b)
+		case 2:
+			enrichment.Dst, err = decodeEndpointInfo(f.b)
+		}
+		return err
+	})
+	return &enrichment, err
+}
+
+func decodeEndpointInfo(b []byte) (*gnet.EndpointInfo, error) {
+	var info gnet.EndpointInfo
+	err := decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			info.Country = f.string()
+		case 2:
+			info.ASN = uint32(f.v)
+		case 3:
+			info.ASOrganization = f.string()
+		case 4:
+			info.Hostnames = append(info.Hostnames, f.string())
+		case 5:
+			info.DNSNames = append(info.DNSNames, f.string())
+		}
+		return nil
+	})
+	return &info, err
+}
+
+func encodeIndicatorMatch(e *encoder, m gnet.IndicatorMatch) {
+	e.uuid(1, m.ConnectionID)
+	e.message(2, func(e *encoder) {
+		e.string(1, string(m.Indicator.Type))
+		e.string(2, m.Indicator.Value)
+		e.string(3, m.Indicator.Source)
+		e.string(4, m.Indicator.Description)
+	})
+	e.string(3, m.Field)
+	e.string(4, m.Observed)
+}
+
+func decodeIndicatorMatch(b []byte) (m gnet.IndicatorMatch, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			m.ConnectionID, err = f.uuid()
+		case 2:
+			err = decode(f.b, func(f field) error {
+				switch f.num {
+				case 1:
+					m.Indicator.Type = gnet.IndicatorType(f.string())
+				case 2:
+					m.Indicator.Value = f.string()
+				case 3:
+					m.Indicator.Source = f.string()
+				case 4:
+					m.Indicator.Description = f.string()
+				}
+				return nil
+			})
+		case 3:
+			m.Field = f.string()
+		case 4:
+			m.Observed = f.string()
+		}
+		return err
+	})
+	return m, err
+}
+
+func encodeTCPPacket(e *encoder, c gnet.TCPPacketMetadata) {
+	e.bool(1, c.SYN)
+	e.bool(2, c.ACK)
+	e.bool(3, c.FIN)
+	e.bool(4, c.RST)
+	e.uint(5, uint64(c.PayloadLength))
+	encodeOSFingerprint(e, 6, c.OS)
+	e.uint(7, uint64(c.TLSRecordType))
+}
+
+func decodeTCPPacket(b []byte) (c gnet.TCPPacketMetadata, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			c.SYN = f.bool()
+		case 2:
+			c.ACK = f.bool()
+		case 3:
+			c.FIN = f.bool()
+		case 4:
+			c.RST = f.bool()
+		case 5:
+			c.PayloadLength = f.int()
+		case 6:
+			c.OS, err = decodeOSFingerprint(f.b)
+		case 7:
+			c.TLSRecordType = gnet.TLSRecordType(f.v)
+		}
+		return err
+	})
+	return c, err
+}
+
+func encodeOSFingerprint(e *encoder, num protowire.Number, os *gnet.OSFingerprint) {
+	if os == nil {
+		return
+	}
+	e.message(num, func(e *encoder) {
+		e.string(1, os.Signature)
+		e.uint(2, uint64(os.TTL))
+		e.uint(3, uint64(os.InitialTTL))
+		e.uint(4, uint64(os.WindowSize))
+		e.sint(5, int64(os.WindowScale))
+		e.uint(6, uint64(os.MSS))
+		e.string(7, os.Options)
+		e.string(8, os.OS)
+	})
+}
+
+func decodeOSFingerprint(b []byte) (*gnet.OSFingerprint, error) {
+	var os gnet.OSFingerprint
+	err := decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			os.Signature = f.string()
+		case 2:
+			os.TTL = uint8(f.v)
+		case 3:
+			os.InitialTTL = uint8(f.v)
+		case 4:
+			os.WindowSize = uint16(f.v)
+		case 5:
+			os.WindowScale = int(protowire.DecodeZigZag(f.v))
+		case 6:
+			os.MSS = uint16(f.v)
+		case 7:
+			os.Options = f.string()
+		case 8:
+			os.OS = f.string()
+		}
+		return nil
+	})
+	return &os, err
+}
+
+func encodeTCPConnection(e *encoder, c gnet.TCPConnectionMetadata) {
+	e.uuid(1, c.ConnectionID)
+	e.int(2, int64(c.Initiator))
+	e.string(3, string(c.EndState))
+	encodeOSFingerprint(e, 4, c.InitiatorOS)
+	encodeOSFingerprint(e, 5, c.ResponderOS)
+	e.duration(6, c.Duration)
+	encodeDirectionStats(e, 7, c.SourceToDest)
+	encodeDirectionStats(e, 8, c.DestToSource)
+}
+
+func decodeTCPConnection(b []byte) (c gnet.TCPConnectionMetadata, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			c.ConnectionID, err = f.uuid()
+		case 2:
+			c.Initiator = gnet.TCPConnectionInitiator(f.int())
+		case 3:
+			c.EndState = gnet.TCPConnectionEndState(f.string())
+		case 4:
+			c.InitiatorOS, err = decodeOSFingerprint(f.b)
+		case 5:
+			c.ResponderOS, err = decodeOSFingerprint(f.b)
+		case 6:
+			c.Duration, err = f.duration()
+		case 7:
+			c.SourceToDest, err = decodeDirectionStats(f.b)
+		case 8:
+			c.DestToSource, err = decodeDirectionStats(f.b)
+		}
+		return err
+	})
+	return c, err
+}
+
+func encodeDirectionStats(e *encoder, num protowire.Number, s gnet.TCPDirectionStats) {
+	if s == (gnet.TCPDirectionStats{}) {
+		return
+	}
+	e.message(num, func(e *encoder) {
+		e.int(1, s.Packets)
+		e.int(2, s.Bytes)
+		e.int(3, s.Retransmissions)
+		e.int(4, s.OutOfOrder)
+	})
+}
+
+func decodeDirectionStats(b []byte) (s gnet.TCPDirectionStats, err error) {
+	err = decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			s.Packets = int64(f.v)
+		case 2:
+			s.Bytes = int64(f.v)
+		case 3:
+			s.Retransmissions = int64(f.v)
+		case 4:
+			s.OutOfOrder = int64(f.v)
+		}
+		return nil
+	})
+	return s, err
+}
+
+// Appends a Header message for each header, sorted by name so that the
+// encoding is deterministic.
+func encodeHeaders(e *encoder, num protowire.Number, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.message(num, func(e *encoder) {
+			e.string(1, name)
+			e.strings(2, h[name])
+		})
+	}
+}
+
+func decodeHeader(b []byte, h *http.Header) error {
+	var name string
+	var values []string
+	err := decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			name = f.string()
+		case 2:
+			values = append(values, f.string())
+		}
+		return nil
+	})
+	if *h == nil {
+		*h = http.Header{}
+	}
+	// Keys are kept as sent, like the parsers keep them.
+	(*h)[name] = append((*h)[name], values...)
+	return err
+}
+
+func encodeHTTPRequest(e *encoder, r gnet.HTTPRequest) {
+	e.uuid(1, r.StreamID)
+	e.int(2, int64(r.Seq))
+	e.string(3, r.Method)
+	e.int(4, int64(r.ProtoMajor))
+	e.int(5, int64(r.ProtoMinor))
+	if r.URL != nil {
+		e.string(6, r.URL.String())
+	}
+	e.string(7, r.Host)
+	encodeHeaders(e, 8, r.Header)
+	e.memView(9, r.Body)
+	e.bool(10, r.BodyDecompressed)
+	e.strings(11, r.HeaderOrder)
+	e.bool(12, r.Truncated)
+	encodeHeaders(e, 13, r.Trailer)
+	e.int(14, r.BodySize)
+	e.string(15, r.BodyHash)
+	e.bool(16, r.BodyIncomplete)
+}
+
+func decodeHTTPRequest(b []byte) (r gnet.HTTPRequest, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			r.StreamID, err = f.uuid()
+		case 2:
+			r.Seq = f.int()
+		case 3:
+			r.Method = f.string()
+		case 4:
+			r.ProtoMajor = f.int()
+		case 5:
+			r.ProtoMinor = f.int()
+		case 6:
+			r.URL, err = url.Parse(f.string())
+		case 7:
+			r.Host = f.string()
+		case 8:
+			err = decodeHeader(f.b, &r.Header)
+		case 9:
+			r.Body = memview.New(f.bytes())
+		case 10:
+			r.BodyDecompressed = f.bool()
+		case 11:
+			r.HeaderOrder = append(r.HeaderOrder, f.string())
+		case 12:
+			r.Truncated = f.bool()
+		case 13:
+			err = decodeHeader(f.b, &r.Trailer)
+		case 14:
+			r.BodySize = int64(f.int())
+		case 15:
+			r.BodyHash = f.string()
+		case 16:
+			r.BodyIncomplete = f.bool()
+		}
+		return err
+	})
+	r.Cookies = (&http.Request{Header: r.Header}).Cookies()
+	return r, err
+}
+
+func encodeHTTPResponse(e *encoder, r gnet.HTTPResponse) {
+	e.uuid(1, r.StreamID)
+	e.int(2, int64(r.Seq))
+	e.int(3, int64(r.StatusCode))
+	e.int(4, int64(r.ProtoMajor))
+	e.int(5, int64(r.ProtoMinor))
+	encodeHeaders(e, 6, r.Header)
+	e.memView(7, r.Body)
+	e.bool(8, r.BodyDecompressed)
+	e.bool(9, r.Truncated)
+	encodeHeaders(e, 10, r.Trailer)
+	for _, i := range r.Interim {
+		e.message(11, func(e *encoder) {
+			e.int(1, int64(i.StatusCode))
+			encodeHeaders(e, 2, i.Header)
+		})
+	}
+	e.int(12, r.BodySize)
+	e.string(13, r.BodyHash)
+	e.bool(14, r.BodyIncomplete)
+}
+
+func decodeHTTPResponse(b []byte) (r gnet.HTTPResponse, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			r.StreamID, err = f.uuid()
+		case 2:
+			r.Seq = f.int()
+		case 3:
+			r.StatusCode = f.int()
+		case 4:
+			r.ProtoMajor = f.int()
+		case 5:
+			r.ProtoMinor = f.int()
+		case 6:
+			err = decodeHeader(f.b, &r.Header)
+		case 7:
+			r.Body = memview.New(f.bytes())
+		case 8:
+			r.BodyDecompressed = f.bool()
+		case 9:
+			r.Truncated = f.bool()
+		case 10:
+			err = decodeHeader(f.b, &r.Trailer)
+		case 11:
+			var i gnet.HTTPInterimResponse
+			i, err = decodeHTTPInterimResponse(f.b)
+			r.Interim = append(r.Interim, i)
+		case 12:
+			r.BodySize = int64(f.int())
+		case 13:
+			r.BodyHash = f.string()
+		case 14:
+			r.BodyIncomplete = f.bool()
+		}
+		return err
+	})
+	r.Cookies = (&http.Response{Header: r.Header}).Cookies()
+	return r, err
+}
+
+func decodeHTTPInterimResponse(b []byte) (r gnet.HTTPInterimResponse, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			r.StatusCode = f.int()
+		case 2:
+			err = decodeHeader(f.b, &r.Header)
+		}
+		return err
+	})
+	return r, err
+}
+
+func uint16s(vs []uint16) []uint64 {
+	out := make([]uint64, len(vs))
+	for i, v := range vs {
+		out[i] = uint64(v)
+	}
+	return out
+}
+
+func encodeTLSClientHello(e *encoder, h gnet.TLSClientHello) {
+	e.uuid(1, h.ConnectionID)
+	e.uint(2, uint64(h.Version))
+	e.packed(3, uint16s(h.CipherSuites))
+	e.packed(4, uint16s(h.Extensions))
+	e.packed(5, uint16s(h.SupportedCurves))
+	points := make([]uint64, len(h.SupportedPoints))
+	for i, p := range h.SupportedPoints {
+		points[i] = uint64(p)
+	}
+	e.packed(6, points)
+	e.string(7, h.ServerName)
+	e.strings(8, h.AlpnProtocols)
+	e.packed(9, uint16s(h.SupportedVersions))
+	e.packed(10, uint16s(h.SignatureAlgorithms))
+	e.bool(11, h.ECHPresent)
+}
+
+func decodeTLSClientHello(b []byte) (h gnet.TLSClientHello, err error) {
+	err = decode(b, func(f field) (err error) {
+		var vs []uint16
+		switch f.num {
+		case 1:
+			h.ConnectionID, err = f.uuid()
+		case 2:
+			h.Version = gnet.TLSVersion(f.v)
+		case 3:
+			vs, err = f.uint16s()
+			h.CipherSuites = append(h.CipherSuites, vs...)
+		case 4:
+			vs, err = f.uint16s()
+			h.Extensions = append(h.Extensions, vs...)
+		case 5:
+			vs, err = f.uint16s()
+			h.SupportedCurves = append(h.SupportedCurves, vs...)
+		case 6:
+			vs, err = f.uint16s()
+			for _, v := range vs {
+				h.SupportedPoints = append(h.SupportedPoints, uint8(v))
+			}
+		case 7:
+			h.ServerName = f.string()
+		case 8:
+			h.AlpnProtocols = append(h.AlpnProtocols, f.string())
+		case 9:
+			vs, err = f.uint16s()
+			h.SupportedVersions = append(h.SupportedVersions, vs...)
+		case 10:
+			vs, err = f.uint16s()
+			h.SignatureAlgorithms = append(h.SignatureAlgorithms, vs...)
+		case 11:
+			h.ECHPresent = f.bool()
+		}
+		return err
+	})
+	return h, err
+}
+
+func encodeTLSServerHello(e *encoder, h gnet.TLSServerHello) {
+	e.uuid(1, h.ConnectionID)
+	e.uint(2, uint64(h.Version))
+	e.uint(3, uint64(h.CipherSuite))
+	e.packed(4, uint16s(h.Extensions))
+	e.uint(5, uint64(h.SelectedVersion))
+	e.string(6, h.SelectedProtocol)
+}
+
+func decodeTLSServerHello(b []byte) (h gnet.TLSServerHello, err error) {
+	err = decode(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			h.ConnectionID, err = f.uuid()
+		case 2:
+			h.Version = gnet.TLSVersion(f.v)
+		case 3:
+			h.CipherSuite = uint16(f.v)
+		case 4:
+			var vs []uint16
+			vs, err = f.uint16s()
+			h.Extensions = append(h.Extensions, vs...)
+		case 5:
+			h.SelectedVersion = gnet.TLSVersion(f.v)
+		case 6:
+			h.SelectedProtocol = f.string()
+		}
+		return err
+	})
+	return h, err
+}
+
+func decodeOtherContent(b []byte) (gnet.ParsedNetworkContent, error) {
+	var name string
+	var data []byte
+	err := decode(b, func(f field) error {
+		switch f.num {
+		case 1:
+			name = f.string()
+		case 2:
+			data = f.b
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gnet.UnmarshalContent(name, data)
+}
@@ -0,0 +1,152 @@
+package pb
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestRoundTrip(t *testing.T) {
+	conn := uuid.New()
+	ts := time.Unix(1700000000, 123456789).UTC()
+	envelope := gnet.NetTraffic{
+		LayerType: "TCP",
+		SrcIP:     net.IPv4(10, 0, 0, 1), SrcPort: 40000,
+		DstIP: net.ParseIP("2001:db8::1"), DstPort: 443,
+		Payload:      []byte{1, 2, 3},
+		ConnectionID: conn,
+		Interface:    "eth0",
+		Tunnels: []gnet.Tunnel{
+			{Type: "VXLAN", SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4(192, 168, 0, 2), ID: 42},
+		},
+		VLANs: []uint16{10, 4094},
+		Enrichment: &gnet.Enrichment{
+			Dst: &gnet.EndpointInfo{Country: "US", ASN: 15169, ASOrganization: "Google LLC", Hostnames: []string{"a.example", "b.example"}, DNSNames: []string{"www.example"}},
+		},
+		Indicators: []gnet.IndicatorMatch{{
+			ConnectionID: conn,
+			Indicator:    gnet.Indicator{Type: gnet.DomainIndicator, Value: "example", Source: "feed.txt", Description: "test"},
+			Field:        "tls_server_name",
+			Observed:     "a.example",
+		}},
+		LocalRole:       gnet.ClientRole,
+		SampleRate:      0.25,
+		ObservationTime: ts,
+		FinalPacketTime: ts.Add(time.Second),
+	}
+
+	contents := []gnet.ParsedNetworkContent{
+		nil,
+		gnet.TCPPacketMetadata{SYN: true, PayloadLength: 12, TLSRecordType: gnet.TLSHandshakeRecord, OS: &gnet.OSFingerprint{
+			Signature: "4:64+0:1460:65535:-1:mss", TTL: 63, InitialTTL: 64,
+			WindowSize: 65535, WindowScale: -1, MSS: 1460, Options: "mss", OS: "Linux",
+		}},
+		gnet.TCPConnectionMetadata{
+			ConnectionID: conn,
+			Initiator:    gnet.DestInitiator,
+			EndState:     gnet.ConnectionReset,
+			Duration:     1500 * time.Millisecond,
+			SourceToDest: gnet.TCPDirectionStats{Packets: 4, Bytes: 300, Retransmissions: 1},
+		},
+		gnet.TLSClientHello{
+			ConnectionID: conn, Version: 0x0303,
+			CipherSuites: []uint16{0x1301, 0xc02f}, Extensions: []uint16{0, 43},
+			SupportedPoints: []uint8{0}, ServerName: "example.com",
+			AlpnProtocols: []string{"h2", "http/1.1"}, ECHPresent: true,
+		},
+		gnet.TLSServerHello{ConnectionID: conn, Version: 0x0303, CipherSuite: 0x1301, SelectedVersion: 0x0304},
+		gnet.DNSRequest{ID: 7, Questions: []layers.DNSQuestion{
+			{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		}},
+	}
+	for _, c := range contents {
+		in := envelope
+		in.Content = c
+		b, err := Marshal(in)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		out, err := Unmarshal(b)
+		if assert.NoError(t, err) {
+			assert.Equal(t, in, out)
+		}
+	}
+}
+
+func TestRoundTripHTTP(t *testing.T) {
+	req := gnet.HTTPRequest{
+		StreamID: uuid.New(), Seq: 3,
+		Method: "POST", ProtoMajor: 1, ProtoMinor: 1,
+		URL:         &url.URL{Path: "/upload", RawQuery: "a=1"},
+		Host:        "example.com",
+		Header:      http.Header{"Cookie": {"session=abc"}, "X-Many": {"1", "2"}},
+		Body:        memview.New([]byte("hello")),
+		HeaderOrder: []string{"Cookie", "x-many"},
+	}
+	b, err := Marshal(gnet.NetTraffic{Content: req})
+	assert.NoError(t, err)
+	out, err := Unmarshal(b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	got := out.Content.(gnet.HTTPRequest)
+	assert.Equal(t, "hello", got.Body.String())
+	assert.Equal(t, req.URL, got.URL)
+	assert.Equal(t, req.Header, got.Header)
+	assert.Equal(t, req.HeaderOrder, got.HeaderOrder)
+	if assert.Len(t, got.Cookies, 1) {
+		assert.Equal(t, "abc", got.Cookies[0].Value)
+	}
+
+	resp := gnet.HTTPResponse{
+		StatusCode:     204,
+		ProtoMajor:     2,
+		Truncated:      true,
+		BodyIncomplete: true,
+		Trailer:        http.Header{"Checksum": {"abc"}},
+		Interim:        []gnet.HTTPInterimResponse{{StatusCode: 103, Header: http.Header{"Link": {"</a.css>"}}}},
+	}
+	b, err = Marshal(gnet.NetTraffic{Content: resp})
+	assert.NoError(t, err)
+	out, err = Unmarshal(b)
+	if assert.NoError(t, err) {
+		got := out.Content.(gnet.HTTPResponse)
+		assert.Equal(t, 204, got.StatusCode)
+		assert.Equal(t, 2, got.ProtoMajor)
+		assert.True(t, got.Truncated)
+		assert.True(t, got.BodyIncomplete)
+		assert.Nil(t, got.Header)
+		assert.Equal(t, resp.Trailer, got.Trailer)
+		assert.Equal(t, resp.Interim, got.Interim)
+	}
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	b, err := Marshal(gnet.NetTraffic{LayerType: "UDP", SrcPort: 53})
+	assert.NoError(t, err)
+	b = protowire.AppendTag(b, 999, protowire.BytesType)
+	b = protowire.AppendString(b, "from a newer schema")
+	b = protowire.AppendTag(b, 998, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 1)
+
+	out, err := Unmarshal(b)
+	assert.NoError(t, err)
+	assert.Equal(t, gnet.NetTraffic{LayerType: "UDP", SrcPort: 53}, out)
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	b, err := Marshal(gnet.NetTraffic{LayerType: "UDP"})
+	assert.NoError(t, err)
+	_, err = Unmarshal(b[:len(b)-1])
+	assert.Error(t, err)
+}
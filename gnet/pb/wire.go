@@ -0,0 +1,274 @@
+package pb
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Appends the fields of a message. Fields with zero values are left out, as
+// proto3 does for scalars.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) uint(num protowire.Number, v uint64) {
+	if v != 0 {
+		e.b = protowire.AppendTag(e.b, num, protowire.VarintType)
+		e.b = protowire.AppendVarint(e.b, v)
+	}
+}
+
+// For int32 and int64 fields.
+func (e *encoder) int(num protowire.Number, v int64) {
+	e.uint(num, uint64(v))
+}
+
+// For sint32 and sint64 fields.
+func (e *encoder) sint(num protowire.Number, v int64) {
+	e.uint(num, protowire.EncodeZigZag(v))
+}
+
+func (e *encoder) bool(num protowire.Number, v bool) {
+	if v {
+		e.uint(num, 1)
+	}
+}
+
+func (e *encoder) double(num protowire.Number, v float64) {
+	if v != 0 {
+		e.b = protowire.AppendTag(e.b, num, protowire.Fixed64Type)
+		e.b = protowire.AppendFixed64(e.b, math.Float64bits(v))
+	}
+}
+
+func (e *encoder) bytes(num protowire.Number, v []byte) {
+	if len(v) > 0 {
+		e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+		e.b = protowire.AppendBytes(e.b, v)
+	}
+}
+
+// Like bytes, appending the data of v without first copying it into a slice.
+func (e *encoder) memView(num protowire.Number, v memview.MemView) {
+	if v.Len() > 0 {
+		e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+		e.b = protowire.AppendVarint(e.b, uint64(v.Len()))
+		v.Chunks(func(buf []byte) bool {
+			e.b = append(e.b, buf...)
+			return true
+		})
+	}
+}
+
+func (e *encoder) string(num protowire.Number, v string) {
+	if v != "" {
+		e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+		e.b = protowire.AppendString(e.b, v)
+	}
+}
+
+func (e *encoder) strings(num protowire.Number, vs []string) {
+	for _, v := range vs {
+		e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+		e.b = protowire.AppendString(e.b, v)
+	}
+}
+
+// Appends a packed repeated field of unsigned integers.
+func (e *encoder) packed(num protowire.Number, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var p []byte
+	for _, v := range vs {
+		p = protowire.AppendVarint(p, v)
+	}
+	e.bytes(num, p)
+}
+
+// Appends a message field. Unlike scalars, it is written even if empty, so
+// that its presence is kept.
+func (e *encoder) message(num protowire.Number, fill func(*encoder)) {
+	var sub encoder
+	fill(&sub)
+	e.b = protowire.AppendTag(e.b, num, protowire.BytesType)
+	e.b = protowire.AppendBytes(e.b, sub.b)
+}
+
+func (e *encoder) ip(num protowire.Number, ip net.IP) {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	e.bytes(num, ip)
+}
+
+func (e *encoder) uuid(num protowire.Number, id uuid.UUID) {
+	if id != uuid.Nil {
+		e.bytes(num, id[:])
+	}
+}
+
+// Appends a google.protobuf.Timestamp, unless t is zero.
+func (e *encoder) timestamp(num protowire.Number, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	e.message(num, func(e *encoder) {
+		e.int(1, t.Unix())
+		e.int(2, int64(t.Nanosecond()))
+	})
+}
+
+// Appends a google.protobuf.Duration, unless d is zero.
+func (e *encoder) duration(num protowire.Number, d time.Duration) {
+	if d == 0 {
+		return
+	}
+	e.message(num, func(e *encoder) {
+		e.int(1, int64(d/time.Second))
+		e.int(2, int64(d%time.Second))
+	})
+}
+
+// A field read from a message. Only one of v and b is set, depending on its
+// wire type.
+type field struct {
+	num protowire.Number
+	typ protowire.Type
+	v   uint64
+	b   []byte
+}
+
+// Calls fn with each field of a message in turn.
+func decode(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.v, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			f.b, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errors.Wrapf(protowire.ParseError(n), "field %d", num)
+		}
+		b = b[n:]
+
+		if err := fn(f); err != nil {
+			return errors.Wrapf(err, "field %d", num)
+		}
+	}
+	return nil
+}
+
+func (f field) int() int {
+	return int(int64(f.v))
+}
+
+func (f field) double() float64 {
+	return math.Float64frombits(f.v)
+}
+
+func (f field) bool() bool {
+	return f.v != 0
+}
+
+func (f field) string() string {
+	return string(f.b)
+}
+
+// Returns a copy of the bytes, which would otherwise alias the input.
+func (f field) bytes() []byte {
+	return append([]byte(nil), f.b...)
+}
+
+func (f field) ip() net.IP {
+	if len(f.b) == net.IPv4len {
+		return net.IPv4(f.b[0], f.b[1], f.b[2], f.b[3])
+	}
+	return f.bytes()
+}
+
+func (f field) uuid() (uuid.UUID, error) {
+	return uuid.FromBytes(f.b)
+}
+
+// Reads one element of a repeated field of unsigned integers, or all of them
+// if the field is packed.
+func (f field) uints() ([]uint64, error) {
+	if f.typ == protowire.VarintType {
+		return []uint64{f.v}, nil
+	}
+	var vs []uint64
+	for b := f.b; len(b) > 0; {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		vs = append(vs, v)
+		b = b[n:]
+	}
+	return vs, nil
+}
+
+func (f field) uint16s() ([]uint16, error) {
+	vs, err := f.uints()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]uint16, len(vs))
+	for i, v := range vs {
+		if v > math.MaxUint16 {
+			return nil, errors.Errorf("value %d out of range", v)
+		}
+		out[i] = uint16(v)
+	}
+	return out, nil
+}
+
+// Reads a google.protobuf.Timestamp.
+func (f field) timestamp() (time.Time, error) {
+	var secs, nanos int64
+	err := decode(f.b, func(f field) error {
+		switch f.num {
+		case 1:
+			secs = int64(f.v)
+		case 2:
+			nanos = int64(f.v)
+		}
+		return nil
+	})
+	return time.Unix(secs, nanos).UTC(), err
+}
+
+// Reads a google.protobuf.Duration.
+func (f field) duration() (time.Duration, error) {
+	var secs, nanos int64
+	err := decode(f.b, func(f field) error {
+		switch f.num {
+		case 1:
+			secs = int64(f.v)
+		case 2:
+			nanos = int64(f.v)
+		}
+		return nil
+	})
+	return time.Duration(secs)*time.Second + time.Duration(nanos), err
+}
@@ -0,0 +1,40 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// Represents a POP3 command sent by a client.
+type POP3Command struct {
+	// Identifies the TCP connection to which this command belongs.
+	ConnectionID uuid.UUID
+
+	// The command name in upper case, e.g. "USER" or "RETR".
+	Command string
+	Args    []string
+}
+
+var _ ParsedNetworkContent = (*POP3Command)(nil)
+
+func (POP3Command) ReleaseBuffers() {}
+
+// Represents a POP3 server response.
+type POP3Response struct {
+	// Identifies the TCP connection to which this response belongs.
+	ConnectionID uuid.UUID
+
+	// Whether the status indicator was +OK rather than -ERR.
+	OK bool
+
+	// The rest of the status line.
+	Text string
+
+	// The lines following the status line of a multi-line response, such as
+	// the message returned by RETR, with dot-stuffing and the terminating line
+	// removed. Nil for single-line responses.
+	Data []byte
+}
+
+var _ ParsedNetworkContent = (*POP3Response)(nil)
+
+func (POP3Response) ReleaseBuffers() {}
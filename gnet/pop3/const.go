@@ -0,0 +1,39 @@
+package pop3
+
+const (
+	// Maximum length of a command or status line. RFC 2449 limits these to
+	// 255 and 512 bytes.
+	maxLineLength = 1024
+
+	// Maximum size of a multi-line response that we buffer.
+	maxMessageLength = 32 * 1024 * 1024
+
+	okIndicator  = "+OK"
+	errIndicator = "-ERR"
+)
+
+var (
+	crlf = []byte("\r\n")
+
+	// Ends a multi-line response: a line holding a single dot.
+	multiLineTerminator = []byte("\r\n.\r\n")
+
+	// Commands from RFC 1939 and its extensions.
+	pop3Commands = map[string]bool{
+		"USER": true,
+		"PASS": true,
+		"APOP": true,
+		"AUTH": true,
+		"STAT": true,
+		"LIST": true,
+		"RETR": true,
+		"DELE": true,
+		"NOOP": true,
+		"RSET": true,
+		"QUIT": true,
+		"TOP":  true,
+		"UIDL": true,
+		"CAPA": true,
+		"STLS": true,
+	}
+)
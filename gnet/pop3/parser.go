@@ -0,0 +1,153 @@
+package pop3
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newPOP3Parser(bidiID uuid.UUID, isRequest bool) *pop3Parser {
+	return &pop3Parser{
+		connectionID: bidiID,
+		isRequest:    isRequest,
+	}
+}
+
+// Parses a single POP3 command or response.
+//
+// Whether a response is multi-line depends on the command it answers, which
+// this parser doesn't see. Instead, a +OK response is taken to be multi-line
+// if more data follows its status line in the input so far and that data
+// isn't another response. Servers send nothing between responses unless
+// asked, so this only misjudges a multi-line response whose status line
+// arrives on its own.
+type pop3Parser struct {
+	connectionID uuid.UUID
+	isRequest    bool
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*pop3Parser)(nil)
+
+func (p *pop3Parser) Name() string {
+	if p.isRequest {
+		return "POP3 Command Parser"
+	}
+	return "POP3 Response Parser"
+}
+
+func (parser *pop3Parser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete POP3 message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *pop3Parser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	lineEnd := parser.allInput.Index(0, crlf)
+	if lineEnd < 0 {
+		if parser.allInput.Len() > maxLineLength {
+			return nil, 0, errors.New("POP3 line too long")
+		}
+		return nil, 0, nil
+	}
+	line := parser.allInput.SubView(0, lineEnd).String()
+	end := lineEnd + int64(len(crlf))
+
+	if parser.isRequest {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil, 0, errors.New("empty POP3 command")
+		}
+		return gnet.POP3Command{
+			ConnectionID: parser.connectionID,
+			Command:      strings.ToUpper(fields[0]),
+			Args:         fields[1:],
+		}, end, nil
+	}
+
+	resp := gnet.POP3Response{
+		ConnectionID: parser.connectionID,
+	}
+	indicator, text, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(indicator) {
+	case okIndicator:
+		resp.OK = true
+	case errIndicator:
+	default:
+		return nil, 0, errors.New("malformed POP3 response")
+	}
+	resp.Text = text
+
+	if !resp.OK || !parser.multiLine(end) {
+		return resp, end, nil
+	}
+
+	// Search from the status line's CRLF, so that an empty response is found.
+	terminator := parser.allInput.Index(lineEnd, multiLineTerminator)
+	if terminator < 0 {
+		if parser.allInput.Len() > maxMessageLength {
+			return nil, 0, errors.New("POP3 response too long")
+		}
+		return nil, 0, nil
+	}
+	resp.Data = unstuffDots(parser.allInput.SubView(end, terminator+int64(len(crlf))).Bytes())
+	return resp, terminator + int64(len(multiLineTerminator)), nil
+}
+
+// Reports whether the data following a status line that ends at end is the
+// body of a multi-line response.
+func (parser *pop3Parser) multiLine(end int64) bool {
+	nextEnd := end + int64(len(errIndicator))
+	if nextEnd > parser.allInput.Len() {
+		nextEnd = parser.allInput.Len()
+	}
+	next := parser.allInput.SubView(end, nextEnd).String()
+	if next == "" {
+		return false
+	}
+	for _, indicator := range []string{okIndicator, errIndicator} {
+		if strings.HasPrefix(indicator, strings.ToUpper(next)) || strings.HasPrefix(strings.ToUpper(next), indicator) {
+			return false
+		}
+	}
+	return true
+}
+
+// Removes the extra dot that POP3 adds to lines starting with a dot. Never
+// returns nil, so that an empty response is told apart from a single-line one.
+func unstuffDots(data []byte) []byte {
+	if len(data) == 0 {
+		return []byte{}
+	}
+	lines := bytes.SplitAfter(data, crlf)
+	for i, line := range lines {
+		if bytes.HasPrefix(line, []byte("..")) {
+			lines[i] = line[1:]
+		}
+	}
+	return bytes.Join(lines, nil)
+}
@@ -0,0 +1,68 @@
+package pop3
+
+import (
+	"strings"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing POP3 commands sent by clients. Many POP3
+// commands are also FTP commands, so when the FTP/SMTP parser is in use, the
+// parser listed first claims them.
+func NewPOP3CommandParserFactory() gnet.TCPParserFactory {
+	return &pop3ParserFactory{isRequest: true}
+}
+
+// Returns a factory for parsing POP3 responses sent by servers.
+func NewPOP3ResponseParserFactory() gnet.TCPParserFactory {
+	return &pop3ParserFactory{isRequest: false}
+}
+
+type pop3ParserFactory struct {
+	isRequest bool
+}
+
+func (f *pop3ParserFactory) Name() string {
+	if f.isRequest {
+		return "POP3 Command Parser Factory"
+	}
+	return "POP3 Response Parser Factory"
+}
+
+func (factory *pop3ParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (factory *pop3ParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	lineEnd := input.Index(0, crlf)
+	if lineEnd < 0 {
+		if input.Len() > maxLineLength {
+			return gnet.Reject, input.Len()
+		}
+		return gnet.NeedMoreData, 0
+	}
+
+	word, _, _ := strings.Cut(input.SubView(0, lineEnd).String(), " ")
+	word = strings.ToUpper(word)
+	if factory.isRequest && pop3Commands[word] {
+		return gnet.Accept, 0
+	}
+	if !factory.isRequest && (word == okIndicator || word == errIndicator) {
+		return gnet.Accept, 0
+	}
+	return gnet.Reject, input.Len()
+}
+
+func (factory *pop3ParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newPOP3Parser(id, factory.isRequest)
+}
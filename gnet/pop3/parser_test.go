@@ -0,0 +1,61 @@
+package pop3
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestPOP3Command(t *testing.T) {
+	f := NewPOP3CommandParserFactory()
+	decision, _ := f.Accepts(memview.New([]byte("retr 1\r\n")), false)
+	assert.Equal(t, gnet.Accept, decision)
+	decision, _ = f.Accepts(memview.New([]byte("+OK\r\n")), false)
+	assert.Equal(t, gnet.Reject, decision)
+
+	id := uuid.New()
+	result, unused, _, err := f.CreateParser(id, 0, 0).Parse(memview.New([]byte("retr 1\r\nQUIT\r\n")), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gnet.POP3Command{ConnectionID: id, Command: "RETR", Args: []string{"1"}}, result)
+		assert.Equal(t, "QUIT\r\n", unused.String())
+	}
+}
+
+func TestPOP3Response(t *testing.T) {
+	f := NewPOP3ResponseParserFactory()
+	id := uuid.New()
+
+	// Single-line responses, pipelined.
+	result, unused, _, err := f.CreateParser(id, 0, 0).Parse(memview.New([]byte("+OK 2 320\r\n-ERR no such message\r\n")), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gnet.POP3Response{ConnectionID: id, OK: true, Text: "2 320"}, result)
+		assert.Equal(t, "-ERR no such message\r\n", unused.String())
+	}
+
+	// A multi-line response split across calls.
+	p := f.CreateParser(id, 0, 0)
+	result, _, _, err = p.Parse(memview.New([]byte("+OK 120 octets\r\nSubject: hi\r\n\r\n")), false)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, unused, _, err = p.Parse(memview.New([]byte("..dotted\r\n.\r\n+OK\r\n")), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gnet.POP3Response{
+			ConnectionID: id,
+			OK:           true,
+			Text:         "120 octets",
+			Data:         []byte("Subject: hi\r\n\r\n.dotted\r\n"),
+		}, result)
+		assert.Equal(t, "+OK\r\n", unused.String())
+	}
+
+	// An empty listing.
+	result, _, _, err = f.CreateParser(id, 0, 0).Parse(memview.New([]byte("+OK\r\n.\r\n")), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{}, result.(gnet.POP3Response).Data)
+	}
+}
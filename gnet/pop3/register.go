@@ -0,0 +1,15 @@
+package pop3
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("pop3", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{
+			NewPOP3CommandParserFactory(),
+			NewPOP3ResponseParserFactory(),
+		}
+	}, gnet.TextTCPParserPriority)
+}
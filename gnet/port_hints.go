@@ -0,0 +1,54 @@
+package gnet
+
+// Factories likely to parse the traffic of a TCP port.
+type PortHint struct {
+	// Tried before the other factories of a selector, in order.
+	Factories []TCPParserFactory
+
+	// If set, only Factories are tried, sparing the Accepts calls of the
+	// others on busy well-known ports.
+	Exclusive bool
+}
+
+// TCPParserFactoryHints maps TCP ports to the factories to try first for
+// connections using them, e.g. a MySQL parser for port 3306.
+type TCPParserFactoryHints map[int]PortHint
+
+// Returns the selector to use for a connection between the given ports: s,
+// with the factories hinted for the destination port, then for the source
+// port, moved to the front. Factories of s with the same name as a hinted one
+// are left out, as are all others but upgrade factories if a hint is
+// exclusive. Returns s itself if neither port has a hint.
+func (h TCPParserFactoryHints) Selector(s TCPParserFactorySelector, srcPort, dstPort int) TCPParserFactorySelector {
+	var hints []PortHint
+	for _, port := range []int{dstPort, srcPort} {
+		if hint, ok := h[port]; ok {
+			hints = append(hints, hint)
+		}
+	}
+	if len(hints) == 0 {
+		return s
+	}
+
+	var result TCPParserFactorySelector
+	hinted := map[string]bool{}
+	exclusive := false
+	for _, hint := range hints {
+		for _, f := range hint.Factories {
+			if !hinted[f.Name()] {
+				hinted[f.Name()] = true
+				result = append(result, f)
+			}
+		}
+		exclusive = exclusive || hint.Exclusive
+	}
+	for _, f := range s {
+		if hinted[f.Name()] {
+			continue
+		}
+		if _, upgrade := f.(TCPUpgradeParserFactory); !exclusive || upgrade {
+			result = append(result, f)
+		}
+	}
+	return result
+}
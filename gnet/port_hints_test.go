@@ -0,0 +1,55 @@
+package gnet
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+type namedFactory string
+
+func (f namedFactory) Name() string { return string(f) }
+
+func (namedFactory) Accepts(input memview.MemView, _ bool) (AcceptDecision, int64) {
+	return Reject, input.Len()
+}
+
+func (namedFactory) CreateParser(uuid.UUID, reassembly.Sequence, reassembly.Sequence) TCPParser {
+	return nil
+}
+
+type upgradeFactory struct{ namedFactory }
+
+func (upgradeFactory) Upgrades(ParsedNetworkContent) bool { return false }
+
+func names(s TCPParserFactorySelector) []string {
+	var result []string
+	for _, f := range s {
+		result = append(result, f.Name())
+	}
+	return result
+}
+
+func TestPortHints(t *testing.T) {
+	s := TCPParserFactorySelector{
+		namedFactory("http"),
+		namedFactory("mysql"),
+		upgradeFactory{"websocket"},
+		namedFactory("redis"),
+	}
+	hints := TCPParserFactoryHints{
+		3306: {Factories: []TCPParserFactory{namedFactory("mysql")}},
+		6379: {Factories: []TCPParserFactory{namedFactory("redis")}, Exclusive: true},
+		8080: {Factories: []TCPParserFactory{namedFactory("http")}},
+	}
+
+	assert.Equal(t, []string{"http", "mysql", "websocket", "redis"}, names(hints.Selector(s, 40000, 80)))
+	assert.Equal(t, []string{"mysql", "http", "websocket", "redis"}, names(hints.Selector(s, 40000, 3306)))
+	assert.Equal(t, []string{"mysql", "http", "websocket", "redis"}, names(hints.Selector(s, 3306, 40000)))
+	assert.Equal(t, []string{"redis", "websocket"}, names(hints.Selector(s, 40000, 6379)))
+	assert.Equal(t, []string{"http", "mysql", "websocket", "redis"}, names(hints.Selector(s, 3306, 8080)))
+}
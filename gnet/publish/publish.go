@@ -0,0 +1,266 @@
+// Package publish streams parsed traffic to message brokers such as Kafka or
+// AMQP. Traffic is encoded as JSON or protobuf, queued and handed to a
+// Publisher in batches. The broker client is not part of this package:
+// wrapping a producer from any client library in a Publisher is enough.
+//
+// When the publisher falls behind and the queue fills up, Send blocks until
+// there is room again, so that a slow broker slows down the capture instead of
+// losing traffic. Sinks can be configured to drop traffic instead.
+package publish
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/pb"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+	DefaultQueueSize     = 10000
+)
+
+// An encoded NetTraffic, ready to be sent to a broker.
+type Message struct {
+	// The connection ID of the traffic, so that brokers that partition by key
+	// keep the messages of a connection in order. Nil for traffic outside TCP
+	// connections.
+	Key []byte
+
+	Value []byte
+
+	// The observation time of the traffic.
+	Time time.Time
+}
+
+// Publisher sends messages to a broker, e.g. by producing them to a Kafka
+// topic or an AMQP exchange. Publish is called from a single goroutine, with
+// messages in the order they were sent. It should return once the messages
+// are delivered, or hand them to a client that buffers them itself.
+type Publisher interface {
+	Publish(msgs []Message) error
+}
+
+// How traffic is encoded in messages.
+type Encoding int
+
+const (
+	// As by gnet.NetTraffic.MarshalJSON.
+	JSON Encoding = iota
+
+	// As by pb.Marshal.
+	Protobuf
+)
+
+type Options struct {
+	Encoding Encoding
+
+	// The most messages passed to a single Publish call.
+	BatchSize int
+
+	// A partial batch is published once its oldest message has waited this
+	// long. 0 to only publish full batches, and whatever is left on Close.
+	FlushInterval time.Duration
+
+	// The number of messages that can be waiting to be published.
+	QueueSize int
+
+	// If set, traffic sent while the queue is full is dropped and counted,
+	// rather than blocking until there is room.
+	DropWhenFull bool
+}
+
+func NewOptions() Options {
+	return Options{
+		Encoding:      JSON,
+		BatchSize:     DefaultBatchSize,
+		FlushInterval: DefaultFlushInterval,
+		QueueSize:     DefaultQueueSize,
+	}
+}
+
+// Sink publishes traffic in batches from a background goroutine. It must be
+// closed to publish the last batch.
+//
+// Safe for concurrent use.
+type Sink struct {
+	opts      Options
+	publisher Publisher
+	queue     chan Message
+	done      chan struct{}
+
+	// Held for reading while sending to queue, and for writing to close it.
+	queueMu sync.RWMutex
+	closed  bool
+
+	mu      sync.Mutex
+	dropped int64
+	// The first error from encoding or publishing traffic.
+	err error
+}
+
+func NewSink(p Publisher, opts Options) *Sink {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1
+	}
+	if opts.QueueSize < 0 {
+		opts.QueueSize = 0
+	}
+	s := &Sink{
+		opts:      opts,
+		publisher: p,
+		queue:     make(chan Message, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	go s.publish()
+	return s
+}
+
+// Queues t to be published. Blocks while the queue is full, unless the sink
+// drops traffic instead.
+func (s *Sink) Send(t gnet.NetTraffic) error {
+	m, err := s.encode(t)
+	if err != nil {
+		s.setErr(err)
+		return err
+	}
+
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.closed {
+		return errors.New("sink is closed")
+	}
+	if !s.opts.DropWhenFull {
+		s.queue <- m
+		return nil
+	}
+	select {
+	case s.queue <- m:
+	default:
+		s.mu.Lock()
+		s.dropped++
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Run passes through all traffic from in, sending each to the sink. Traffic
+// is only passed on once it has been queued, so a full queue holds up the
+// pipeline. Errors are reported by Err. The sink is not closed.
+func (s *Sink) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			s.Send(t)
+			out <- t
+		}
+	}()
+	return out
+}
+
+// Publishes the traffic still queued and stops the sink. Returns the first
+// error encountered by the sink.
+func (s *Sink) Close() error {
+	s.queueMu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.queueMu.Unlock()
+
+	<-s.done
+	return s.Err()
+}
+
+// Returns the first error encountered while encoding or publishing traffic.
+func (s *Sink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Returns the number of traffic dropped because the queue was full.
+func (s *Sink) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Sink) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+func (s *Sink) encode(t gnet.NetTraffic) (Message, error) {
+	m := Message{Time: t.ObservationTime}
+	if s.opts.Encoding == Protobuf {
+		value, err := pb.Marshal(t)
+		if err != nil {
+			return m, errors.Wrap(err, "failed to encode traffic")
+		}
+		m.Value = value
+	} else {
+		value, err := t.MarshalJSON()
+		if err != nil {
+			return m, errors.Wrap(err, "failed to encode traffic")
+		}
+		m.Value = value
+	}
+	if t.ConnectionID != uuid.Nil {
+		m.Key = []byte(t.ConnectionID.String())
+	}
+	return m, nil
+}
+
+// Reads the queue until it is closed, publishing full batches as they fill
+// and partial ones once they are old enough.
+func (s *Sink) publish() {
+	defer close(s.done)
+
+	batch := make([]Message, 0, s.opts.BatchSize)
+	var timer *time.Timer
+	var expired <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.publisher.Publish(batch); err != nil {
+			s.setErr(errors.Wrap(err, "failed to publish traffic"))
+		}
+		// The publisher may keep the slice, so it is not reused.
+		batch = make([]Message, 0, s.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case m, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) >= s.opts.BatchSize {
+				flush()
+			} else if len(batch) == 1 && s.opts.FlushInterval > 0 {
+				timer = time.NewTimer(s.opts.FlushInterval)
+				expired = timer.C
+			}
+		case <-expired:
+			timer, expired = nil, nil
+			flush()
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package publish
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/pb"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]Message
+	// If set, Publish waits for it to be closed.
+	block chan struct{}
+	err   error
+}
+
+func (r *recorder) Publish(msgs []Message) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, msgs)
+	return r.err
+}
+
+func (r *recorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var sizes []int
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestBatching(t *testing.T) {
+	r := &recorder{}
+	opts := NewOptions()
+	opts.BatchSize = 3
+	opts.FlushInterval = 0
+	s := NewSink(r, opts)
+	for i := 0; i < 7; i++ {
+		assert.NoError(t, s.Send(gnet.NetTraffic{SrcPort: i}))
+	}
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []int{3, 3, 1}, r.sizes())
+	assert.Error(t, s.Send(gnet.NetTraffic{}))
+}
+
+func TestFlushInterval(t *testing.T) {
+	r := &recorder{}
+	opts := NewOptions()
+	opts.FlushInterval = 10 * time.Millisecond
+	s := NewSink(r, opts)
+	defer s.Close()
+
+	assert.NoError(t, s.Send(gnet.NetTraffic{}))
+	assert.Eventually(t, func() bool { return len(r.sizes()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestDropWhenFull(t *testing.T) {
+	r := &recorder{block: make(chan struct{})}
+	opts := NewOptions()
+	opts.BatchSize = 1
+	opts.QueueSize = 1
+	opts.DropWhenFull = true
+	s := NewSink(r, opts)
+
+	// One message is held by the blocked publisher and one fills the queue.
+	assert.NoError(t, s.Send(gnet.NetTraffic{}))
+	assert.Eventually(t, func() bool { return len(s.queue) == 0 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Send(gnet.NetTraffic{}))
+	assert.NoError(t, s.Send(gnet.NetTraffic{}))
+	assert.Equal(t, int64(1), s.Dropped())
+
+	close(r.block)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, []int{1, 1}, r.sizes())
+}
+
+func TestBackpressure(t *testing.T) {
+	r := &recorder{block: make(chan struct{})}
+	opts := NewOptions()
+	opts.BatchSize = 1
+	opts.QueueSize = 1
+	s := NewSink(r, opts)
+
+	in := make(chan gnet.NetTraffic, 3)
+	for i := 0; i < 3; i++ {
+		in <- gnet.NetTraffic{}
+	}
+	close(in)
+	out := s.Run(in)
+
+	// The blocked publisher holds one message and the queue another, so the
+	// third can't be passed on yet.
+	<-out
+	<-out
+	select {
+	case <-out:
+		t.Fatal("traffic passed on while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(r.block)
+	_, ok := <-out
+	assert.True(t, ok)
+	assert.NoError(t, s.Close())
+	assert.Equal(t, 0, int(s.Dropped()))
+}
+
+func TestEncoding(t *testing.T) {
+	conn := uuid.New()
+	in := gnet.NetTraffic{
+		LayerType:       "TCP",
+		ConnectionID:    conn,
+		ObservationTime: time.Unix(1700000000, 0).UTC(),
+		Content:         gnet.TCPPacketMetadata{SYN: true},
+	}
+
+	for _, enc := range []Encoding{JSON, Protobuf} {
+		r := &recorder{}
+		opts := NewOptions()
+		opts.Encoding = enc
+		s := NewSink(r, opts)
+		assert.NoError(t, s.Send(in))
+		assert.NoError(t, s.Send(gnet.NetTraffic{LayerType: "UDP"}))
+		assert.NoError(t, s.Close())
+		if !assert.Equal(t, []int{2}, r.sizes()) {
+			continue
+		}
+
+		m := r.batches[0][0]
+		assert.Equal(t, []byte(conn.String()), m.Key)
+		assert.Equal(t, in.ObservationTime, m.Time)
+		assert.Nil(t, r.batches[0][1].Key)
+
+		var out gnet.NetTraffic
+		var err error
+		if enc == JSON {
+			err = out.UnmarshalJSON(m.Value)
+		} else {
+			out, err = pb.Unmarshal(m.Value)
+		}
+		if assert.NoError(t, err) {
+			assert.Equal(t, in, out)
+		}
+	}
+}
+
+func TestPublishError(t *testing.T) {
+	r := &recorder{err: errors.New("broker unavailable")}
+	s := NewSink(r, NewOptions())
+	assert.NoError(t, s.Send(gnet.NetTraffic{}))
+	assert.Error(t, s.Close())
+	assert.Error(t, s.Err())
+}
@@ -0,0 +1,51 @@
+package gnet
+
+import (
+	"fmt"
+)
+
+// QUIC version numbers.
+type QUICVersion uint32
+
+const (
+	QUICVersion1       QUICVersion = 0x00000001 // RFC 9000
+	QUICVersion2       QUICVersion = 0x6b3343cf // RFC 9369
+	QUICVersionDraft29 QUICVersion = 0xff00001d
+)
+
+func (v QUICVersion) String() string {
+	switch v {
+	case QUICVersion1:
+		return "v1"
+	case QUICVersion2:
+		return "v2"
+	case QUICVersionDraft29:
+		return "draft-29"
+	}
+	return fmt.Sprintf("0x%08x", uint32(v))
+}
+
+// Represents an observed QUIC handshake (Initial packet).
+//
+// Initial packets are encrypted with keys derived from the client's
+// destination connection ID, so the Client Hello they carry can be recovered
+// from the capture alone.
+type QUICHandshakeMetadata struct {
+	Version QUICVersion
+
+	DestinationConnectionID []byte
+	SourceConnectionID      []byte
+
+	// Taken from the Client Hello. Empty for server Initial packets, which are
+	// protected with keys derived from a connection ID that is not in the
+	// packet, and for Client Hellos that span several datagrams.
+	ServerName    string
+	AlpnProtocols []string
+
+	// The decrypted Client Hello, or nil if it was not recovered.
+	ClientHello *TLSClientHello
+}
+
+var _ ParsedNetworkContent = (*QUICHandshakeMetadata)(nil)
+
+func (QUICHandshakeMetadata) ReleaseBuffers() {}
@@ -0,0 +1,95 @@
+package quic
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	// Bits of the first byte of a packet.
+	headerFormLong = 0x80
+	fixedBit       = 0x40
+
+	// Bits of the first byte that are covered by header protection in a long
+	// header packet.
+	longHeaderProtectedBits = 0x0f
+
+	// Header protection samples 16 bytes, starting 4 bytes after the start of
+	// the packet number field (RFC 9001 Section 5.4.2).
+	sampleOffset_bytes = 4
+	sampleLength_bytes = 16
+
+	maxConnectionIDLength_bytes = 20
+
+	// Shortest long header: first byte, version, and both connection ID
+	// lengths.
+	minLongHeaderLength_bytes = 7
+)
+
+// Long header packet types. Version 2 renumbers them (RFC 9369 Section 3.2).
+const (
+	packetTypeInitial = iota
+	packetType0RTT
+	packetTypeHandshake
+	packetTypeRetry
+)
+
+// Frame types that may appear in an Initial packet (RFC 9000 Section 12.4).
+const (
+	framePadding         = 0x00
+	framePing            = 0x01
+	frameACK             = 0x02
+	frameACKECN          = 0x03
+	frameCrypto          = 0x06
+	frameConnectionClose = 0x1c
+)
+
+// TLS handshake message type of a Client Hello, and the length of the
+// handshake message header.
+const (
+	handshakeTypeClientHello    = 0x01
+	handshakeHeaderLength_bytes = 4
+)
+
+// Parameters for deriving Initial packet protection keys.
+type versionParameters struct {
+	salt []byte
+
+	keyLabel string
+	ivLabel  string
+	hpLabel  string
+}
+
+var versions = map[gnet.QUICVersion]versionParameters{
+	// RFC 9001 Section 5.2.
+	gnet.QUICVersion1: {
+		salt: []byte{
+			0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+			0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+		},
+		keyLabel: "quic key",
+		ivLabel:  "quic iv",
+		hpLabel:  "quic hp",
+	},
+
+	// RFC 9369 Section 3.3.
+	gnet.QUICVersion2: {
+		salt: []byte{
+			0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+			0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+		},
+		keyLabel: "quicv2 key",
+		ivLabel:  "quicv2 iv",
+		hpLabel:  "quicv2 hp",
+	},
+
+	// draft-ietf-quic-tls-29 Section 5.2.
+	gnet.QUICVersionDraft29: {
+		salt: []byte{
+			0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97,
+			0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99,
+		},
+		keyLabel: "quic key",
+		ivLabel:  "quic iv",
+		hpLabel:  "quic hp",
+	},
+}
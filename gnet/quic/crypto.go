@@ -0,0 +1,104 @@
+package quic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	aes128KeyLength_bytes = 16
+	gcmNonceLength_bytes  = 12
+)
+
+// Keys protecting the Initial packets sent by one endpoint.
+type initialKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// Derives the keys that protect the client's Initial packets from the
+// destination connection ID of its first Initial packet (RFC 9001 Section
+// 5.2).
+func newClientInitialKeys(params versionParameters, dcid []byte) (*initialKeys, error) {
+	initialSecret := hkdfExtract(params.salt, dcid)
+	secret := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, params.keyLabel, aes128KeyLength_bytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create packet protection cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create packet protection cipher")
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(secret, params.hpLabel, aes128KeyLength_bytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create header protection cipher")
+	}
+
+	return &initialKeys{
+		aead: aead,
+		iv:   hkdfExpandLabel(secret, params.ivLabel, gcmNonceLength_bytes),
+		hp:   hp,
+	}, nil
+}
+
+// Returns the header protection mask for the given sample.
+func (k *initialKeys) mask(sample []byte) []byte {
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+	return mask
+}
+
+// Decrypts the payload of a packet with the given packet number, whose
+// unprotected header is used as associated data.
+func (k *initialKeys) open(header, payload []byte, packetNumber uint64) ([]byte, error) {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	var pn [8]byte
+	binary.BigEndian.PutUint64(pn[:], packetNumber)
+	for i := range pn {
+		nonce[len(nonce)-len(pn)+i] ^= pn[i]
+	}
+
+	plaintext, err := k.aead.Open(nil, nonce, payload, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt packet")
+	}
+	return plaintext, nil
+}
+
+// HKDF-Extract from RFC 5869, with SHA-256.
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// HKDF-Expand-Label from RFC 8446 Section 7.1, with SHA-256 and an empty
+// context.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 4+len(fullLabel))
+	info = append(info, byte(length>>8), byte(length), byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+
+	// HKDF-Expand from RFC 5869.
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
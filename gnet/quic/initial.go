@@ -0,0 +1,318 @@
+package quic
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/tls"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Reports whether data starts with a long header Initial packet of a QUIC
+// version whose Initial packets can be decrypted.
+func IsInitial(data []byte) bool {
+	if len(data) < minLongHeaderLength_bytes {
+		return false
+	}
+	if data[0]&(headerFormLong|fixedBit) != headerFormLong|fixedBit {
+		return false
+	}
+	version := gnet.QUICVersion(binary.BigEndian.Uint32(data[1:5]))
+	if _, ok := versions[version]; !ok {
+		return false
+	}
+	return packetType(version, data[0]) == packetTypeInitial
+}
+
+// Parses a UDP datagram that starts with an Initial packet. Packets coalesced
+// into the same datagram are also decrypted, and the Client Hello is recovered
+// from the CRYPTO frames they carry if it is complete.
+//
+// Only the header fields of the result are populated when the Initial packets
+// cannot be decrypted, as is the case for those sent by the server.
+func ParseInitial(datagram []byte) (gnet.QUICHandshakeMetadata, error) {
+	var meta gnet.QUICHandshakeMetadata
+	var stream cryptoStream
+
+	for rest := datagram; len(rest) > 0; {
+		hdr, err := parseLongHeader(rest)
+		if err != nil {
+			if meta.Version == 0 {
+				return meta, err
+			}
+			// The remainder is padding or a short header packet.
+			break
+		}
+
+		if meta.Version == 0 {
+			meta.Version = hdr.version
+			meta.DestinationConnectionID = append([]byte(nil), hdr.dcid...)
+			meta.SourceConnectionID = append([]byte(nil), hdr.scid...)
+		}
+
+		if hdr.packetType == packetTypeInitial {
+			if frames, err := decryptInitial(rest[:hdr.length], hdr); err == nil {
+				stream.frames = append(stream.frames, frames...)
+			}
+		}
+		rest = rest[hdr.length:]
+	}
+
+	if hello, err := stream.clientHello(); err == nil && hello != nil {
+		meta.ClientHello = hello
+		meta.ServerName = hello.ServerName
+		meta.AlpnProtocols = hello.AlpnProtocols
+	}
+	return meta, nil
+}
+
+type longHeader struct {
+	version    gnet.QUICVersion
+	packetType int
+	dcid       []byte
+	scid       []byte
+
+	// Offset of the packet number, and the length of the whole packet.
+	pnOffset int
+	length   int
+}
+
+func parseLongHeader(data []byte) (*longHeader, error) {
+	if len(data) < minLongHeaderLength_bytes || data[0]&headerFormLong == 0 {
+		return nil, errors.New("not a long header packet")
+	}
+
+	hdr := &longHeader{
+		version: gnet.QUICVersion(binary.BigEndian.Uint32(data[1:5])),
+	}
+	if _, ok := versions[hdr.version]; !ok {
+		return nil, errors.Errorf("unsupported QUIC version %s", hdr.version)
+	}
+	hdr.packetType = packetType(hdr.version, data[0])
+
+	pos := 5
+	var err error
+	if hdr.dcid, pos, err = readConnectionID(data, pos); err != nil {
+		return nil, err
+	}
+	if hdr.scid, pos, err = readConnectionID(data, pos); err != nil {
+		return nil, err
+	}
+
+	// Retry packets have no length field and extend to the end of the datagram.
+	if hdr.packetType == packetTypeRetry {
+		hdr.length = len(data)
+		return hdr, nil
+	}
+
+	if hdr.packetType == packetTypeInitial {
+		var tokenLength uint64
+		if tokenLength, pos, err = readVarint(data, pos); err != nil {
+			return nil, err
+		}
+		if tokenLength > uint64(len(data)-pos) {
+			return nil, errors.New("truncated token")
+		}
+		pos += int(tokenLength)
+	}
+
+	var length uint64
+	if length, pos, err = readVarint(data, pos); err != nil {
+		return nil, err
+	}
+	if length > uint64(len(data)-pos) {
+		return nil, errors.New("truncated packet")
+	}
+	hdr.pnOffset = pos
+	hdr.length = pos + int(length)
+	return hdr, nil
+}
+
+// Removes header protection from a client Initial packet and decrypts its
+// payload, returning the CRYPTO frames it contains.
+func decryptInitial(packet []byte, hdr *longHeader) ([]cryptoFrame, error) {
+	if len(packet) < hdr.pnOffset+sampleOffset_bytes+sampleLength_bytes {
+		return nil, errors.New("packet too short to sample")
+	}
+
+	keys, err := newClientInitialKeys(versions[hdr.version], hdr.dcid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work on a copy, since removing header protection modifies the packet.
+	p := append([]byte(nil), packet...)
+	sample := p[hdr.pnOffset+sampleOffset_bytes : hdr.pnOffset+sampleOffset_bytes+sampleLength_bytes]
+	mask := keys.mask(sample)
+
+	p[0] ^= mask[0] & longHeaderProtectedBits
+	pnLength := int(p[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLength; i++ {
+		p[hdr.pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(p[hdr.pnOffset+i])
+	}
+
+	// Initial packet numbers are small enough that the truncated packet number
+	// is the full packet number.
+	headerEnd := hdr.pnOffset + pnLength
+	plaintext, err := keys.open(p[:headerEnd], p[headerEnd:], pn)
+	if err != nil {
+		return nil, err
+	}
+	return parseFrames(plaintext)
+}
+
+type cryptoFrame struct {
+	offset uint64
+	data   []byte
+}
+
+// Extracts the CRYPTO frames from a decrypted Initial packet payload.
+func parseFrames(payload []byte) ([]cryptoFrame, error) {
+	var frames []cryptoFrame
+	for pos := 0; pos < len(payload); {
+		frameType, next, err := readVarint(payload, pos)
+		if err != nil {
+			return frames, err
+		}
+		pos = next
+
+		switch frameType {
+		case framePadding, framePing:
+
+		case frameACK, frameACKECN:
+			// Largest acknowledged, delay, range count and first range.
+			var fields [4]uint64
+			for i := range fields {
+				if fields[i], pos, err = readVarint(payload, pos); err != nil {
+					return frames, err
+				}
+			}
+			// Each additional range is a gap and a length.
+			skip := fields[2] * 2
+			if frameType == frameACKECN {
+				skip += 3
+			}
+			for i := uint64(0); i < skip; i++ {
+				if _, pos, err = readVarint(payload, pos); err != nil {
+					return frames, err
+				}
+			}
+
+		case frameCrypto:
+			var offset, length uint64
+			if offset, pos, err = readVarint(payload, pos); err != nil {
+				return frames, err
+			}
+			if length, pos, err = readVarint(payload, pos); err != nil {
+				return frames, err
+			}
+			if length > uint64(len(payload)-pos) {
+				return frames, errors.New("truncated CRYPTO frame")
+			}
+			frames = append(frames, cryptoFrame{offset: offset, data: payload[pos : pos+int(length)]})
+			pos += int(length)
+
+		case frameConnectionClose:
+			// Error code, frame type and reason phrase length.
+			var reasonLength uint64
+			for i := 0; i < 3; i++ {
+				if reasonLength, pos, err = readVarint(payload, pos); err != nil {
+					return frames, err
+				}
+			}
+			if reasonLength > uint64(len(payload)-pos) {
+				return frames, errors.New("truncated CONNECTION_CLOSE frame")
+			}
+			pos += int(reasonLength)
+
+		default:
+			return frames, errors.Errorf("unexpected frame type 0x%x in Initial packet", frameType)
+		}
+	}
+	return frames, nil
+}
+
+// CRYPTO frames carrying the start of the client's handshake, possibly out of
+// order.
+type cryptoStream struct {
+	frames []cryptoFrame
+}
+
+// Returns the Client Hello at the start of the stream, or nil if it is
+// incomplete.
+func (s *cryptoStream) clientHello() (*gnet.TLSClientHello, error) {
+	sort.Slice(s.frames, func(i, j int) bool {
+		return s.frames[i].offset < s.frames[j].offset
+	})
+
+	// Assemble the contiguous prefix of the stream.
+	var buf []byte
+	for _, f := range s.frames {
+		if f.offset > uint64(len(buf)) {
+			break
+		}
+		if end := f.offset + uint64(len(f.data)); end > uint64(len(buf)) {
+			buf = append(buf, f.data[uint64(len(buf))-f.offset:]...)
+		}
+	}
+
+	if len(buf) < handshakeHeaderLength_bytes {
+		return nil, nil
+	}
+	if buf[0] != handshakeTypeClientHello {
+		return nil, errors.New("CRYPTO stream does not start with a Client Hello")
+	}
+	length := int(buf[1])<<16 | int(buf[2])<<8 | int(buf[3])
+	if len(buf) < handshakeHeaderLength_bytes+length {
+		return nil, nil
+	}
+
+	hello, err := tls.ParseClientHello(memview.New(buf[:handshakeHeaderLength_bytes+length]))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse Client Hello")
+	}
+	return &hello, nil
+}
+
+// Returns the long header packet type, numbered as in version 1.
+func packetType(version gnet.QUICVersion, firstByte byte) int {
+	t := int(firstByte>>4) & 0x03
+	if version == gnet.QUICVersion2 {
+		// Version 2 numbers Retry, Initial, 0-RTT and Handshake from zero.
+		return (t + packetTypeRetry) % 4
+	}
+	return t
+}
+
+func readConnectionID(data []byte, pos int) ([]byte, int, error) {
+	if pos >= len(data) {
+		return nil, pos, errors.New("truncated connection ID")
+	}
+	n := int(data[pos])
+	pos++
+	if n > maxConnectionIDLength_bytes || n > len(data)-pos {
+		return nil, pos, errors.New("invalid connection ID length")
+	}
+	return data[pos : pos+n], pos + n, nil
+}
+
+// Reads a variable-length integer (RFC 9000 Section 16).
+func readVarint(data []byte, pos int) (uint64, int, error) {
+	if pos >= len(data) {
+		return 0, pos, errors.New("truncated variable-length integer")
+	}
+	n := 1 << (data[pos] >> 6)
+	if n > len(data)-pos {
+		return 0, pos, errors.New("truncated variable-length integer")
+	}
+	v := uint64(data[pos] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64(data[pos+i])
+	}
+	return v, pos + n, nil
+}
@@ -0,0 +1,196 @@
+package quic
+
+import (
+	stdtls "crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Test vectors from RFC 9001 Appendix A.
+var rfcDCID = unhex("8394c8f03e515708")
+
+func TestClientInitialKeys(t *testing.T) {
+	initialSecret := hkdfExtract(versions[gnet.QUICVersion1].salt, rfcDCID)
+	secret := hkdfExpandLabel(initialSecret, "client in", 32)
+	assert.Equal(t, "c00cf151ca5be075ed0ebfb5c80323c42d6b7db67881289af4008f1f6c357aea", hex.EncodeToString(secret))
+	assert.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(hkdfExpandLabel(secret, "quic key", 16)))
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(hkdfExpandLabel(secret, "quic iv", 12)))
+	assert.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(hkdfExpandLabel(secret, "quic hp", 16)))
+
+	keys, err := newClientInitialKeys(versions[gnet.QUICVersion1], rfcDCID)
+	if assert.NoError(t, err) {
+		mask := keys.mask(unhex("d1b1c98dd7689fb8ec11d242b123dc9b"))
+		assert.Equal(t, "437b9aec36", hex.EncodeToString(mask[:5]))
+	}
+}
+
+// Returns the Client Hello handshake message that crypto/tls sends for the
+// given configuration.
+func clientHello(t *testing.T, config *stdtls.Config) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		stdtls.Client(client, config).Handshake()
+		client.Close()
+	}()
+
+	header := make([]byte, 5)
+	_, err := io.ReadFull(server, header)
+	assert.NoError(t, err)
+	body := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	_, err = io.ReadFull(server, body)
+	assert.NoError(t, err)
+	return body
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	default:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendCrypto(b []byte, offset int, data []byte) []byte {
+	b = append(b, frameCrypto)
+	b = appendVarint(b, uint64(offset))
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// Builds a protected client Initial packet, padded to at least 1200 bytes.
+func protectInitial(t *testing.T, version gnet.QUICVersion, dcid, scid []byte, pn uint32, payload []byte) []byte {
+	params := versions[version]
+	keys, err := newClientInitialKeys(params, dcid)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	const pnLength = 4
+	for len(payload) < 1200 {
+		payload = append(payload, framePadding)
+	}
+
+	initialType := byte(packetTypeInitial)
+	if version == gnet.QUICVersion2 {
+		initialType = 1
+	}
+	hdr := []byte{headerFormLong | fixedBit | initialType<<4 | (pnLength - 1)}
+	hdr = appendUint32(hdr, uint32(version))
+	hdr = append(hdr, byte(len(dcid)))
+	hdr = append(hdr, dcid...)
+	hdr = append(hdr, byte(len(scid)))
+	hdr = append(hdr, scid...)
+	hdr = appendVarint(hdr, 0) // token
+	hdr = appendVarint(hdr, uint64(pnLength+len(payload)+keys.aead.Overhead()))
+	pnOffset := len(hdr)
+	hdr = appendUint32(hdr, pn)
+
+	nonce := append([]byte(nil), keys.iv...)
+	for i := 0; i < 4; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	packet := keys.aead.Seal(hdr, nonce, payload, hdr)
+
+	mask := keys.mask(packet[pnOffset+sampleOffset_bytes : pnOffset+sampleOffset_bytes+sampleLength_bytes])
+	packet[0] ^= mask[0] & longHeaderProtectedBits
+	for i := 0; i < pnLength; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+var (
+	testDCID = unhex("0011223344556677")
+	testSCID = unhex("a1a2a3a4")
+)
+
+func TestParseInitial(t *testing.T) {
+	hello := clientHello(t, &stdtls.Config{
+		ServerName: "www.example.com",
+		NextProtos: []string{"h3"},
+		MinVersion: stdtls.VersionTLS13,
+	})
+
+	for _, version := range []gnet.QUICVersion{gnet.QUICVersion1, gnet.QUICVersion2, gnet.QUICVersionDraft29} {
+		// Send the Client Hello in two CRYPTO frames, in reverse order, with a
+		// PING between them.
+		split := len(hello) / 2
+		var payload []byte
+		payload = appendCrypto(payload, split, hello[split:])
+		payload = append(payload, framePing)
+		payload = appendCrypto(payload, 0, hello[:split])
+
+		packet := protectInitial(t, version, testDCID, testSCID, 0, payload)
+		assert.True(t, IsInitial(packet), version.String())
+
+		meta, err := ParseInitial(packet)
+		if assert.NoError(t, err, version.String()) {
+			assert.Equal(t, version, meta.Version)
+			assert.Equal(t, testDCID, meta.DestinationConnectionID)
+			assert.Equal(t, testSCID, meta.SourceConnectionID)
+			assert.Equal(t, "www.example.com", meta.ServerName)
+			assert.Equal(t, []string{"h3"}, meta.AlpnProtocols)
+			assert.NotNil(t, meta.ClientHello)
+		}
+	}
+}
+
+func TestParseInitialIncompleteClientHello(t *testing.T) {
+	hello := clientHello(t, &stdtls.Config{ServerName: "www.example.com"})
+	packet := protectInitial(t, gnet.QUICVersion1, testDCID, testSCID, 0, appendCrypto(nil, 0, hello[:100]))
+
+	meta, err := ParseInitial(packet)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gnet.QUICVersion1, meta.Version)
+		assert.Empty(t, meta.ServerName)
+		assert.Nil(t, meta.ClientHello)
+	}
+}
+
+func TestParseInitialUndecryptable(t *testing.T) {
+	hello := clientHello(t, &stdtls.Config{ServerName: "www.example.com"})
+	packet := protectInitial(t, gnet.QUICVersion1, testDCID, testSCID, 0, appendCrypto(nil, 0, hello))
+
+	// Corrupt the authentication tag.
+	packet[len(packet)-1] ^= 0xff
+
+	meta, err := ParseInitial(packet)
+	if assert.NoError(t, err) {
+		assert.Equal(t, testDCID, meta.DestinationConnectionID)
+		assert.Empty(t, meta.ServerName)
+	}
+}
+
+func TestIsInitial(t *testing.T) {
+	assert.False(t, IsInitial(nil))
+	// Short header.
+	assert.False(t, IsInitial(unhex("4000000001080011223344556677")))
+	// Handshake packet.
+	assert.False(t, IsInitial(unhex("e000000001080011223344556677")))
+	// Unknown version.
+	assert.False(t, IsInitial(unhex("c0deadbeef080011223344556677")))
+	assert.True(t, IsInitial(unhex("c000000001080011223344556677")))
+}
@@ -0,0 +1,220 @@
+package gnet
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+// TCPParserFactoryConstructor creates the TCPParserFactories registered under
+// a single name. Some protocols need more than one factory (e.g. one for each
+// direction of an HTTP/1.x connection), so a constructor may return several.
+// The buffer pool is used by parsers that hold on to message bodies; other
+// parsers may ignore it.
+type TCPParserFactoryConstructor func(pool mempool.BufferPool) []TCPParserFactory
+
+// TCPParserRegistry holds parser factory constructors by name, each with a
+// priority that orders the parsers it selects, so that callers can choose the
+// protocols to parse declaratively.
+//
+// Safe for concurrent use.
+type TCPParserRegistry struct {
+	mu      sync.RWMutex
+	entries map[string]registryEntry
+
+	// Names of the enabled parsers, or nil if all are.
+	enabled map[string]bool
+}
+
+// Priorities of the built-in parsers. Parsers that recognize their protocol
+// by a binary header or magic bytes are tried before those of text protocols,
+// and parsers that accept what all others reject are tried last.
+const (
+	FramedTCPParserPriority   = 20
+	TextTCPParserPriority     = 10
+	DefaultTCPParserPriority  = 0
+	FallbackTCPParserPriority = -10
+)
+
+type registryEntry struct {
+	constructor TCPParserFactoryConstructor
+	priority    int
+}
+
+// DefaultTCPParserRegistry is the registry that the built-in parsers register
+// with from their packages' init functions. Import gnet/all to fill it with
+// all of them; the pcap package does so.
+var DefaultTCPParserRegistry = NewTCPParserRegistry()
+
+func NewTCPParserRegistry() *TCPParserRegistry {
+	return &TCPParserRegistry{entries: map[string]registryEntry{}}
+}
+
+// Register makes a parser factory available by name. Parsers with a higher
+// priority are tried first, and those with equal priorities in order of name.
+// Registering the same name twice panics.
+func (r *TCPParserRegistry) Register(name string, c TCPParserFactoryConstructor, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name = normalizeParserName(name)
+	if name == "" || c == nil {
+		panic("gnet: invalid TCP parser factory registration")
+	}
+	if _, exists := r.entries[name]; exists {
+		panic("gnet: TCP parser factory registered twice: " + name)
+	}
+	r.entries[name] = registryEntry{constructor: c, priority: priority}
+}
+
+// EnableOnly restricts the parsers that Selector and Enabled return to those
+// named, leaving the rest registered. Parsers registered later are not
+// enabled. With no names, all parsers are enabled again. Returns an error,
+// leaving the enabled parsers unchanged, if any name is unknown.
+func (r *TCPParserRegistry) EnableOnly(names ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(names) == 0 {
+		r.enabled = nil
+		return nil
+	}
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		n := normalizeParserName(name)
+		if _, ok := r.entries[n]; !ok {
+			return errors.Errorf("unknown TCP parser %q", name)
+		}
+		enabled[n] = true
+	}
+	r.enabled = enabled
+	return nil
+}
+
+// Names returns the names of all registered parsers in sorted order.
+func (r *TCPParserRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled returns the names of the enabled parsers in the order they are
+// tried.
+func (r *TCPParserRegistry) Enabled() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.enabledNames()
+}
+
+// Selector builds a selector from the enabled parsers, in order of priority.
+func (r *TCPParserRegistry) Selector(pool mempool.BufferPool) TCPParserFactorySelector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var selector TCPParserFactorySelector
+	for _, name := range r.enabledNames() {
+		selector = append(selector, r.entries[name].constructor(pool)...)
+	}
+	return selector
+}
+
+// SelectorFromNames builds a selector from registered parser names, whether or
+// not they are enabled. The order of names is preserved, since earlier parsers
+// are tried first. Returns an error if any name is unknown.
+func (r *TCPParserRegistry) SelectorFromNames(pool mempool.BufferPool, names ...string) (TCPParserFactorySelector, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var selector TCPParserFactorySelector
+	for _, name := range names {
+		e, ok := r.entries[normalizeParserName(name)]
+		if !ok {
+			return nil, errors.Errorf("unknown TCP parser %q", name)
+		}
+		selector = append(selector, e.constructor(pool)...)
+	}
+	return selector, nil
+}
+
+func (r *TCPParserRegistry) enabledNames() []string {
+	var names []string
+	for name := range r.entries {
+		if r.enabled == nil || r.enabled[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := r.entries[names[i]].priority, r.entries[names[j]].priority
+		if pi != pj {
+			return pi > pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// RegisterTCPParserFactory registers a parser factory by name with the default
+// registry, with DefaultTCPParserPriority, so that it can be selected from a list of names
+// (e.g. from the command line or a config file). It is meant to be called from
+// the init function of the package implementing the parser. Registering the
+// same name twice panics.
+func RegisterTCPParserFactory(name string, c TCPParserFactoryConstructor) {
+	DefaultTCPParserRegistry.Register(name, c, DefaultTCPParserPriority)
+}
+
+// RegisteredTCPParserFactories returns the names of all parser factories in
+// the default registry in sorted order.
+func RegisteredTCPParserFactories() []string {
+	return DefaultTCPParserRegistry.Names()
+}
+
+// NewTCPParserFactorySelectorFromNames is like
+// DefaultTCPParserRegistry.SelectorFromNames.
+func NewTCPParserFactorySelectorFromNames(pool mempool.BufferPool, names ...string) (TCPParserFactorySelector, error) {
+	return DefaultTCPParserRegistry.SelectorFromNames(pool, names...)
+}
+
+// ReadParserNames reads a list of parser names, one per line. Blank lines and
+// lines starting with '#' are ignored.
+func ReadParserNames(r io.Reader) ([]string, error) {
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read parser names")
+	}
+	return names, nil
+}
+
+// ReadParserNamesFile is like ReadParserNames, but reads from a file.
+func ReadParserNamesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open parser config")
+	}
+	defer f.Close()
+	return ReadParserNames(f)
+}
+
+func normalizeParserName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,90 @@
+package gnet
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func constructor(names ...string) TCPParserFactoryConstructor {
+	return func(mempool.BufferPool) []TCPParserFactory {
+		var factories []TCPParserFactory
+		for _, name := range names {
+			factories = append(factories, namedFactory(name))
+		}
+		return factories
+	}
+}
+
+func TestTCPParserRegistry(t *testing.T) {
+	r := NewTCPParserRegistry()
+	r.Register("telnet", constructor("telnet"), FallbackTCPParserPriority)
+	r.Register("HTTP1", constructor("http request", "http response"), TextTCPParserPriority)
+	r.Register("tls", constructor("tls"), FramedTCPParserPriority)
+	r.Register("imap", constructor("imap"), TextTCPParserPriority)
+
+	assert.Equal(t, []string{"http1", "imap", "telnet", "tls"}, r.Names())
+	assert.Equal(t, []string{"tls", "http1", "imap", "telnet"}, r.Enabled())
+	assert.Equal(t, []string{"tls", "http request", "http response", "imap", "telnet"}, names(r.Selector(nil)))
+	assert.Panics(t, func() { r.Register("tls", constructor("tls"), 0) })
+
+	assert.NoError(t, r.EnableOnly("imap", "Http1"))
+	assert.Equal(t, []string{"http request", "http response", "imap"}, names(r.Selector(nil)))
+	assert.Error(t, r.EnableOnly("http1", "smtp"))
+	assert.Equal(t, []string{"http1", "imap"}, r.Enabled())
+
+	// Parsers selected by name are used in that order, even if disabled.
+	s, err := r.SelectorFromNames(nil, "telnet", "tls")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"telnet", "tls"}, names(s))
+	}
+	_, err = r.SelectorFromNames(nil, "smtp")
+	assert.Error(t, err)
+
+	assert.NoError(t, r.EnableOnly())
+	assert.Len(t, r.Enabled(), 4)
+}
+
+func TestRegisterTCPParserFactory(t *testing.T) {
+	// Register with a registry of the test's own, so that it can be run again.
+	defaultRegistry := DefaultTCPParserRegistry
+	DefaultTCPParserRegistry = NewTCPParserRegistry()
+	t.Cleanup(func() { DefaultTCPParserRegistry = defaultRegistry })
+
+	RegisterTCPParserFactory("test-b", constructor("b1", "b2"))
+	RegisterTCPParserFactory(" Test-A ", constructor("a"))
+	assert.Panics(t, func() { RegisterTCPParserFactory("TEST-A", constructor("a")) })
+	assert.Panics(t, func() { RegisterTCPParserFactory(" ", constructor("a")) })
+	assert.Panics(t, func() { RegisterTCPParserFactory("test-c", nil) })
+
+	assert.Equal(t, []string{"test-a", "test-b"}, RegisteredTCPParserFactories())
+
+	// Factories are selected in the order of the names.
+	s, err := NewTCPParserFactorySelectorFromNames(nil, "test-b", "TEST-A")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"b1", "b2", "a"}, names(s))
+	}
+	s, err = NewTCPParserFactorySelectorFromNames(nil, "test-a", "test-b")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"a", "b1", "b2"}, names(s))
+	}
+
+	_, err = NewTCPParserFactorySelectorFromNames(nil, "test-a", "no-such-parser")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no-such-parser")
+	}
+}
+
+func TestReadParserNames(t *testing.T) {
+	parsed, err := ReadParserNames(strings.NewReader("# parsers\nhttp1\n\n  tls  \n# smb\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"http1", "tls"}, parsed)
+	}
+
+	_, err = ReadParserNamesFile(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
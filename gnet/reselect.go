@@ -0,0 +1,51 @@
+package gnet
+
+import (
+	"net/http"
+	"strings"
+)
+
+// How the parser for the data following a parser's result or failure on a
+// flow is chosen.
+type Reselection int
+
+const (
+	// Select from all factories, as at the start of the flow.
+	ReselectAny Reselection = iota
+
+	// Try the factory of the last parser alone, falling back on selecting
+	// from all factories only if it rejects the data. This spares the Accepts
+	// calls of the other factories on long-lived connections.
+	PinFactory
+)
+
+// ReselectionPolicy decides how the next parser of a flow is chosen, given the
+// factory of the last parser and its result, or the error it failed with.
+type ReselectionPolicy func(last TCPParserFactory, result ParsedNetworkContent, err error) Reselection
+
+// PinUntilUpgrade pins flows to the factory of their last successful parser,
+// except after a result that switches the connection to another protocol:
+// STARTTLS in IMAP, STLS in POP3, an HTTP CONNECT request or a 101 Switching
+// Protocols response. Failures are followed by selecting from all factories.
+func PinUntilUpgrade(_ TCPParserFactory, result ParsedNetworkContent, err error) Reselection {
+	if err != nil || result == nil || SwitchesProtocol(result) {
+		return ReselectAny
+	}
+	return PinFactory
+}
+
+// Reports whether c ends the use of its protocol on the connection, which
+// carries another protocol, typically TLS, from then on.
+func SwitchesProtocol(c ParsedNetworkContent) bool {
+	switch c := c.(type) {
+	case IMAPCommand:
+		return strings.EqualFold(c.Command, "STARTTLS")
+	case POP3Command:
+		return strings.EqualFold(c.Command, "STLS")
+	case HTTPRequest:
+		return c.Method == http.MethodConnect
+	case HTTPResponse:
+		return c.StatusCode == http.StatusSwitchingProtocols
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package gnet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinUntilUpgrade(t *testing.T) {
+	f := namedFactory("imap")
+	assert.Equal(t, PinFactory, PinUntilUpgrade(f, IMAPCommand{Command: "LOGIN"}, nil))
+	assert.Equal(t, ReselectAny, PinUntilUpgrade(f, IMAPCommand{Command: "STARTTLS"}, nil))
+	assert.Equal(t, ReselectAny, PinUntilUpgrade(f, POP3Command{Command: "STLS"}, nil))
+	assert.Equal(t, ReselectAny, PinUntilUpgrade(f, HTTPRequest{Method: "CONNECT"}, nil))
+	assert.Equal(t, PinFactory, PinUntilUpgrade(f, HTTPResponse{StatusCode: 200}, nil))
+	assert.Equal(t, ReselectAny, PinUntilUpgrade(f, HTTPResponse{StatusCode: 101}, nil))
+	assert.Equal(t, ReselectAny, PinUntilUpgrade(f, nil, errors.New("malformed")))
+}
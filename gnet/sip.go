@@ -0,0 +1,85 @@
+package gnet
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// Represents a SIP request or response, carried over UDP or TCP.
+type SIPMessage struct {
+	// Identifies the TCP connection to which this message belongs. Zero for
+	// messages carried over UDP.
+	ConnectionID uuid.UUID
+
+	IsRequest bool
+
+	// The request method, e.g. "INVITE". For responses, the method from the
+	// CSeq header, i.e. the method of the request being answered.
+	Method string
+
+	// Request-URI of a request.
+	RequestURI string
+
+	// Status code and reason phrase of a response.
+	StatusCode int
+	Reason     string
+
+	// Values of the dialog-identifying headers. From and To include the
+	// display name and parameters, e.g. `"Bob" <sip:bob@example.com>;tag=1`.
+	From   string
+	To     string
+	CallID string
+	CSeq   uint32
+
+	// All headers, with compact forms (e.g. "i" for Call-ID) expanded.
+	Header http.Header
+
+	// The session description in the body, if the body is SDP.
+	SDP *SDPSession
+}
+
+var _ ParsedNetworkContent = (*SIPMessage)(nil)
+
+func (SIPMessage) ReleaseBuffers() {}
+
+// The parts of an SDP session description (RFC 4566) needed to locate the
+// negotiated media streams.
+type SDPSession struct {
+	// The o= line.
+	Origin string
+
+	// The s= line.
+	SessionName string
+
+	// The session-level c= address. Individual media may override it.
+	ConnectionAddress net.IP
+
+	Media []SDPMedia
+}
+
+// A single m= section of an SDP session description.
+type SDPMedia struct {
+	// e.g. "audio" or "video".
+	Type string
+
+	// The port on which the sender of the description expects to receive the
+	// media; for RTP/AVP the RTP port, with RTCP on Port+1 unless an rtcp
+	// attribute says otherwise.
+	Port int
+
+	// e.g. "RTP/AVP".
+	Protocol string
+
+	// Media formats, which are RTP payload types for RTP.
+	Formats []string
+
+	// Address to which media should be sent: the media-level c= address, or
+	// the session-level one if the media has none.
+	ConnectionAddress net.IP
+
+	// Payload type mappings from a=rtpmap attributes, e.g. "0" ->
+	// "PCMU/8000".
+	RTPMap map[string]string
+}
@@ -0,0 +1,55 @@
+package sip
+
+const (
+	sipVersion = "SIP/2.0"
+
+	// Maximum length of the start line we look for before rejecting input as
+	// not SIP.
+	maxStartLineLength = 1024
+
+	// Minimum amount of input needed to recognize a SIP start line: the
+	// shortest method plus a space, or the version plus a space.
+	minStartLineLength = len(sipVersion) + 1
+
+	// Maximum size of a SIP message over TCP that we buffer.
+	maxMessageLength = 64 * 1024
+)
+
+var (
+	// Methods from RFC 3261 and its extensions.
+	sipMethods = []string{
+		"INVITE",
+		"ACK",
+		"BYE",
+		"CANCEL",
+		"REGISTER",
+		"OPTIONS",
+		"PRACK",
+		"SUBSCRIBE",
+		"NOTIFY",
+		"PUBLISH",
+		"INFO",
+		"REFER",
+		"MESSAGE",
+		"UPDATE",
+	}
+
+	// Compact header forms from RFC 3261 Section 7.3.3 and extensions.
+	compactHeaders = map[string]string{
+		"a": "Accept-Contact",
+		"b": "Referred-By",
+		"c": "Content-Type",
+		"e": "Content-Encoding",
+		"f": "From",
+		"i": "Call-ID",
+		"k": "Supported",
+		"l": "Content-Length",
+		"m": "Contact",
+		"o": "Event",
+		"r": "Refer-To",
+		"s": "Subject",
+		"t": "To",
+		"u": "Allow-Events",
+		"v": "Via",
+	}
+)
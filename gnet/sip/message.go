@@ -0,0 +1,189 @@
+package sip
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Reports whether data starts with a SIP request or status line. Only the
+// first line is examined.
+func IsSIP(data []byte) bool {
+	line := data
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	} else if len(line) > maxStartLineLength {
+		return false
+	}
+	return isStartLine(strings.TrimRight(string(line), "\r"))
+}
+
+func isStartLine(line string) bool {
+	if strings.HasPrefix(line, sipVersion+" ") {
+		code := strings.TrimPrefix(line, sipVersion+" ")
+		return len(code) >= 3 && isDigits(code[:3])
+	}
+
+	parts := strings.Split(line, " ")
+	return len(parts) == 3 && parts[2] == sipVersion && isMethod(parts[0])
+}
+
+func isMethod(m string) bool {
+	for _, method := range sipMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// Parses a complete SIP message, such as the payload of a UDP datagram.
+func ParseMessage(data []byte) (gnet.SIPMessage, error) {
+	head, body := data, []byte(nil)
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		head, body = data[:i], data[i+4:]
+	} else if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		head, body = data[:i], data[i+2:]
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+	msg := gnet.SIPMessage{
+		Header: make(http.Header),
+	}
+
+	start := lines[0]
+	if !isStartLine(start) {
+		return msg, errors.New("invalid SIP start line")
+	}
+	if strings.HasPrefix(start, sipVersion+" ") {
+		rest := strings.TrimPrefix(start, sipVersion+" ")
+		msg.StatusCode, _ = strconv.Atoi(rest[:3])
+		msg.Reason = strings.TrimSpace(rest[3:])
+	} else {
+		parts := strings.Split(start, " ")
+		msg.IsRequest = true
+		msg.Method = parts[0]
+		msg.RequestURI = parts[1]
+	}
+
+	for _, line := range lines[1:] {
+		// Continuation lines are folded into the previous header.
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if long, ok := compactHeaders[strings.ToLower(name)]; ok {
+			name = long
+		}
+		msg.Header.Add(name, strings.TrimSpace(value))
+	}
+
+	msg.From = msg.Header.Get("From")
+	msg.To = msg.Header.Get("To")
+	msg.CallID = msg.Header.Get("Call-ID")
+	if cseq := strings.Fields(msg.Header.Get("CSeq")); len(cseq) == 2 {
+		n, _ := strconv.ParseUint(cseq[0], 10, 32)
+		msg.CSeq = uint32(n)
+		if !msg.IsRequest {
+			msg.Method = cseq[1]
+		}
+	}
+
+	if n, err := strconv.Atoi(msg.Header.Get("Content-Length")); err == nil && n >= 0 && n < len(body) {
+		body = body[:n]
+	}
+	contentType := strings.ToLower(msg.Header.Get("Content-Type"))
+	if len(body) > 0 && strings.HasPrefix(contentType, "application/sdp") {
+		msg.SDP = ParseSDP(body)
+	}
+
+	return msg, nil
+}
+
+// Parses the parts of an SDP session description that describe media
+// streams. Unknown lines are ignored.
+func ParseSDP(data []byte) *gnet.SDPSession {
+	sdp := &gnet.SDPSession{}
+	var media *gnet.SDPMedia
+
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		value := line[2:]
+
+		switch line[0] {
+		case 'o':
+			sdp.Origin = value
+		case 's':
+			sdp.SessionName = value
+		case 'c':
+			addr := parseConnectionAddress(value)
+			if media != nil {
+				media.ConnectionAddress = addr
+			} else {
+				sdp.ConnectionAddress = addr
+			}
+		case 'm':
+			fields := strings.Fields(value)
+			if len(fields) < 3 {
+				media = nil
+				continue
+			}
+			// The port may be followed by a number of ports, e.g. "49170/2".
+			port, _ := strconv.Atoi(strings.SplitN(fields[1], "/", 2)[0])
+			sdp.Media = append(sdp.Media, gnet.SDPMedia{
+				Type:     fields[0],
+				Port:     port,
+				Protocol: fields[2],
+				Formats:  fields[3:],
+				RTPMap:   map[string]string{},
+			})
+			media = &sdp.Media[len(sdp.Media)-1]
+		case 'a':
+			if media == nil || !strings.HasPrefix(value, "rtpmap:") {
+				continue
+			}
+			pt, encoding, ok := strings.Cut(strings.TrimPrefix(value, "rtpmap:"), " ")
+			if ok {
+				media.RTPMap[pt] = encoding
+			}
+		}
+	}
+
+	for i := range sdp.Media {
+		if sdp.Media[i].ConnectionAddress == nil {
+			sdp.Media[i].ConnectionAddress = sdp.ConnectionAddress
+		}
+	}
+	return sdp
+}
+
+// Parses the address from a c= value such as "IN IP4 192.0.2.1" or
+// "IN IP4 233.252.0.1/127".
+func parseConnectionAddress(value string) net.IP {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return nil
+	}
+	return net.ParseIP(strings.SplitN(fields[2], "/", 2)[0])
+}
@@ -0,0 +1,79 @@
+package sip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+const invite = "INVITE sip:bob@biloxi.example.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP pc33.atlanta.example.com;branch=z9hG4bK776asdhds\r\n" +
+	"f: Alice <sip:alice@atlanta.example.com>;tag=1928301774\r\n" +
+	"To: Bob <sip:bob@biloxi.example.com>\r\n" +
+	"i: a84b4c76e66710@pc33.atlanta.example.com\r\n" +
+	"CSeq: 314159 INVITE\r\n" +
+	"Content-Type: application/sdp\r\n" +
+	"Content-Length: 129\r\n" +
+	"\r\n" +
+	"v=0\r\n" +
+	"o=alice 2890844526 2890844526 IN IP4 pc33\r\n" +
+	"s=-\r\n" +
+	"c=IN IP4 192.0.2.101\r\n" +
+	"t=0 0\r\n" +
+	"m=audio 49172 RTP/AVP 0\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n"
+
+func TestParseInvite(t *testing.T) {
+	msg, err := ParseMessage([]byte(invite))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.True(t, msg.IsRequest)
+	assert.Equal(t, "INVITE", msg.Method)
+	assert.Equal(t, "sip:bob@biloxi.example.com", msg.RequestURI)
+	assert.Equal(t, "Alice <sip:alice@atlanta.example.com>;tag=1928301774", msg.From)
+	assert.Equal(t, "a84b4c76e66710@pc33.atlanta.example.com", msg.CallID)
+	assert.Equal(t, uint32(314159), msg.CSeq)
+
+	if assert.NotNil(t, msg.SDP) && assert.Len(t, msg.SDP.Media, 1) {
+		m := msg.SDP.Media[0]
+		assert.Equal(t, "audio", m.Type)
+		assert.Equal(t, 49172, m.Port)
+		assert.True(t, m.ConnectionAddress.Equal(net.ParseIP("192.0.2.101")))
+		assert.Equal(t, "PCMU/8000", m.RTPMap["0"])
+	}
+}
+
+func TestParseResponseOverTCP(t *testing.T) {
+	input := "SIP/2.0 180 Ringing\r\n" +
+		"CSeq: 314159 INVITE\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n" +
+		"SIP/2.0"
+
+	f := NewSIPParserFactory()
+	decision, _ := f.Accepts(memview.New([]byte(input)), false)
+	assert.Equal(t, gnet.Accept, decision)
+
+	result, unused, _, err := f.CreateParser(uuid.New(), 0, 0).Parse(memview.New([]byte(input)), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		msg := result.(gnet.SIPMessage)
+		assert.False(t, msg.IsRequest)
+		assert.Equal(t, 180, msg.StatusCode)
+		assert.Equal(t, "Ringing", msg.Reason)
+		assert.Equal(t, "INVITE", msg.Method)
+		assert.Equal(t, "SIP/2.0", unused.String())
+	}
+}
+
+func TestIsSIP(t *testing.T) {
+	assert.True(t, IsSIP([]byte("REGISTER sip:registrar.example.com SIP/2.0\r\n")))
+	assert.False(t, IsSIP([]byte("GET / HTTP/1.1\r\n")))
+	assert.False(t, IsSIP([]byte("SIP/2.0 OK\r\n")))
+}
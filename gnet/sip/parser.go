@@ -0,0 +1,98 @@
+package sip
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newSIPParser(bidiID uuid.UUID) *sipParser {
+	return &sipParser{
+		connectionID: bidiID,
+	}
+}
+
+// Parses a single SIP message from a TCP stream. Over TCP, the end of the body
+// is given by the Content-Length header, which is mandatory.
+type sipParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*sipParser)(nil)
+
+func (*sipParser) Name() string {
+	return "SIP Parser"
+}
+
+func (parser *sipParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete SIP message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *sipParser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	headEnd := parser.allInput.Index(0, []byte("\r\n\r\n"))
+	if headEnd < 0 {
+		if parser.allInput.Len() > maxMessageLength {
+			return nil, 0, errors.New("SIP headers too long")
+		}
+		return nil, 0, nil
+	}
+	bodyStart := headEnd + 4
+
+	contentLength := int64(0)
+	for _, line := range strings.Split(parser.allInput.SubView(0, headEnd).String(), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "content-length" || name == "l" {
+			n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil || n < 0 {
+				return nil, 0, errors.New("invalid SIP Content-Length")
+			}
+			contentLength = n
+		}
+	}
+
+	end := bodyStart + contentLength
+	if end > maxMessageLength {
+		return nil, 0, errors.New("SIP message too long")
+	}
+	if parser.allInput.Len() < end {
+		return nil, 0, nil
+	}
+
+	msg, err := ParseMessage(parser.allInput.SubView(0, end).Bytes())
+	if err != nil {
+		return nil, 0, err
+	}
+	msg.ConnectionID = parser.connectionID
+	return msg, end, nil
+}
@@ -0,0 +1,54 @@
+package sip
+
+import (
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing SIP messages over TCP. The same factory
+// handles requests and responses. SIP over UDP is handled by ParseMessage.
+func NewSIPParserFactory() gnet.TCPParserFactory {
+	return &sipParserFactory{}
+}
+
+type sipParserFactory struct{}
+
+func (*sipParserFactory) Name() string {
+	return "SIP Parser Factory"
+}
+
+func (factory *sipParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*sipParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < int64(minStartLineLength) {
+		return gnet.NeedMoreData, 0
+	}
+
+	end := input.Index(0, []byte("\n"))
+	if end < 0 {
+		if input.Len() > maxStartLineLength {
+			return gnet.Reject, input.Len()
+		}
+		return gnet.NeedMoreData, 0
+	}
+
+	if IsSIP(input.SubView(0, end+1).Bytes()) {
+		return gnet.Accept, 0
+	}
+	return gnet.Reject, input.Len()
+}
+
+func (*sipParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newSIPParser(id)
+}
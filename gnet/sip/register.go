@@ -0,0 +1,12 @@
+package sip
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("sip", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewSIPParserFactory()}
+	}, gnet.TextTCPParserPriority)
+}
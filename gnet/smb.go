@@ -0,0 +1,58 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// Represents a single SMB command or its response, as seen on an SMB
+// connection over TCP.
+type SMBOperation struct {
+	// Identifies the TCP connection to which this message belongs.
+	ConnectionID uuid.UUID
+
+	// 1 for SMB1/CIFS, 2 for SMB2 and SMB3, which share a header format.
+	Version int
+
+	// Raw command code and its name, e.g. "TREE_CONNECT".
+	Command     uint16
+	CommandName string
+
+	IsResponse bool
+
+	// NT status code of a response; 0 on success.
+	Status uint32
+
+	// Identifiers from the message header. For SMB1, MessageID is the MID,
+	// SessionID the UID and TreeID the TID.
+	MessageID uint64
+	SessionID uint64
+	TreeID    uint32
+
+	// Dialects offered in a negotiate request, or the dialect selected by the
+	// server in a negotiate response.
+	Dialects []string
+
+	// UNC path of the share in a tree connect request, e.g. `\\server\share`.
+	Share string
+
+	// Path of the file or directory, relative to the share, in a create
+	// request.
+	Path string
+
+	// Handle of the file, from a create response or a read or write request.
+	// 16 bytes for SMB2, 2 bytes for SMB1.
+	FileID []byte
+
+	// Position and length of the data in a read or write request, or the
+	// number of bytes transferred in a read or write response.
+	Offset uint64
+	Length uint32
+
+	// Set for SMB3 messages wrapped in a transform header. Only Version and
+	// SessionID are available for these.
+	Encrypted bool
+}
+
+var _ ParsedNetworkContent = (*SMBOperation)(nil)
+
+func (SMBOperation) ReleaseBuffers() {}
@@ -0,0 +1,119 @@
+package smb
+
+const (
+	// NetBIOS session service header preceding every SMB message on port 445
+	// (direct hosting) and 139. The first byte is the message type, which is 0
+	// for session messages, followed by a 24-bit big-endian length.
+	netbiosHeaderLength_bytes = 4
+	netbiosSessionMessage     = 0x00
+
+	// Length of the protocol ID at the start of every SMB header.
+	protocolIDLength_bytes = 4
+
+	smb1HeaderLength_bytes      = 32
+	smb2HeaderLength_bytes      = 64
+	transformHeaderLength_bytes = 52
+
+	// Only this much of each message is decoded; names and paths are near the
+	// front, and the rest is usually file data.
+	maxDecodedLength_bytes = 4096
+)
+
+var (
+	smb1ProtocolID      = []byte{0xff, 'S', 'M', 'B'}
+	smb2ProtocolID      = []byte{0xfe, 'S', 'M', 'B'}
+	transformProtocolID = []byte{0xfd, 'S', 'M', 'B'}
+)
+
+// SMB2 command codes, from MS-SMB2 Section 2.2.1.
+const (
+	smb2Negotiate      uint16 = 0x00
+	smb2SessionSetup   uint16 = 0x01
+	smb2Logoff         uint16 = 0x02
+	smb2TreeConnect    uint16 = 0x03
+	smb2TreeDisconnect uint16 = 0x04
+	smb2Create         uint16 = 0x05
+	smb2Close          uint16 = 0x06
+	smb2Flush          uint16 = 0x07
+	smb2Read           uint16 = 0x08
+	smb2Write          uint16 = 0x09
+	smb2Lock           uint16 = 0x0a
+	smb2Ioctl          uint16 = 0x0b
+	smb2Cancel         uint16 = 0x0c
+	smb2Echo           uint16 = 0x0d
+	smb2QueryDirectory uint16 = 0x0e
+	smb2ChangeNotify   uint16 = 0x0f
+	smb2QueryInfo      uint16 = 0x10
+	smb2SetInfo        uint16 = 0x11
+	smb2OplockBreak    uint16 = 0x12
+)
+
+var smb2CommandNames = map[uint16]string{
+	smb2Negotiate:      "NEGOTIATE",
+	smb2SessionSetup:   "SESSION_SETUP",
+	smb2Logoff:         "LOGOFF",
+	smb2TreeConnect:    "TREE_CONNECT",
+	smb2TreeDisconnect: "TREE_DISCONNECT",
+	smb2Create:         "CREATE",
+	smb2Close:          "CLOSE",
+	smb2Flush:          "FLUSH",
+	smb2Read:           "READ",
+	smb2Write:          "WRITE",
+	smb2Lock:           "LOCK",
+	smb2Ioctl:          "IOCTL",
+	smb2Cancel:         "CANCEL",
+	smb2Echo:           "ECHO",
+	smb2QueryDirectory: "QUERY_DIRECTORY",
+	smb2ChangeNotify:   "CHANGE_NOTIFY",
+	smb2QueryInfo:      "QUERY_INFO",
+	smb2SetInfo:        "SET_INFO",
+	smb2OplockBreak:    "OPLOCK_BREAK",
+}
+
+// SMB2 header flag set on responses.
+const smb2FlagsServerToRedir = 0x00000001
+
+var smb2Dialects = map[uint16]string{
+	0x0202: "2.0.2",
+	0x0210: "2.1",
+	0x02ff: "2.???",
+	0x0300: "3.0",
+	0x0302: "3.0.2",
+	0x0311: "3.1.1",
+}
+
+// SMB1 command codes, from MS-CIFS Section 2.2.2.1. Only the commands that are
+// decoded or commonly seen are named.
+const (
+	smb1Close           uint16 = 0x04
+	smb1Trans2          uint16 = 0x32
+	smb1ReadAndX        uint16 = 0x2e
+	smb1WriteAndX       uint16 = 0x2f
+	smb1TreeDisconnect  uint16 = 0x71
+	smb1Negotiate       uint16 = 0x72
+	smb1SessionSetupAnd uint16 = 0x73
+	smb1LogoffAndX      uint16 = 0x74
+	smb1TreeConnectAndX uint16 = 0x75
+	smb1NTCreateAndX    uint16 = 0xa2
+)
+
+var smb1CommandNames = map[uint16]string{
+	smb1Close:           "CLOSE",
+	smb1Trans2:          "TRANSACTION2",
+	smb1ReadAndX:        "READ_ANDX",
+	smb1WriteAndX:       "WRITE_ANDX",
+	smb1TreeDisconnect:  "TREE_DISCONNECT",
+	smb1Negotiate:       "NEGOTIATE",
+	smb1SessionSetupAnd: "SESSION_SETUP_ANDX",
+	smb1LogoffAndX:      "LOGOFF_ANDX",
+	smb1TreeConnectAndX: "TREE_CONNECT_ANDX",
+	smb1NTCreateAndX:    "NT_CREATE_ANDX",
+}
+
+const (
+	// SMB1 header flag set on responses.
+	smb1FlagsReply = 0x80
+
+	// SMB1 Flags2 bit indicating that strings are UTF-16.
+	smb1Flags2Unicode = 0x8000
+)
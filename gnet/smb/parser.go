@@ -0,0 +1,316 @@
+package smb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newSMBParser(bidiID uuid.UUID) *smbParser {
+	return &smbParser{
+		connectionID: bidiID,
+	}
+}
+
+type smbParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*smbParser)(nil)
+
+func (*smbParser) Name() string {
+	return "SMB Parser"
+}
+
+func (parser *smbParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete SMB message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *smbParser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	// Wait until we have the whole NetBIOS session message.
+	if parser.allInput.Len() < netbiosHeaderLength_bytes {
+		return nil, 0, nil
+	}
+	end := netbiosHeaderLength_bytes + netbiosLength(parser.allInput)
+	if parser.allInput.Len() < end {
+		return nil, 0, nil
+	}
+
+	decodeEnd := end
+	if decodeEnd-netbiosHeaderLength_bytes > maxDecodedLength_bytes {
+		decodeEnd = netbiosHeaderLength_bytes + maxDecodedLength_bytes
+	}
+	msg := parser.allInput.SubView(netbiosHeaderLength_bytes, decodeEnd).Bytes()
+
+	op := gnet.SMBOperation{
+		ConnectionID: parser.connectionID,
+	}
+
+	switch {
+	case bytes.HasPrefix(msg, smb2ProtocolID):
+		err = decodeSMB2(msg, &op)
+	case bytes.HasPrefix(msg, smb1ProtocolID):
+		err = decodeSMB1(msg, &op)
+	case bytes.HasPrefix(msg, transformProtocolID):
+		err = decodeTransform(msg, &op)
+	default:
+		err = errors.New("unknown SMB protocol ID")
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return op, end, nil
+}
+
+// Decodes an SMB2 message. Only the first command of a compounded message is
+// decoded.
+func decodeSMB2(msg []byte, op *gnet.SMBOperation) error {
+	if len(msg) < smb2HeaderLength_bytes {
+		return errors.New("SMB2 header too short")
+	}
+
+	op.Version = 2
+	op.Status = binary.LittleEndian.Uint32(msg[8:])
+	op.Command = binary.LittleEndian.Uint16(msg[12:])
+	op.CommandName = smb2CommandNames[op.Command]
+	op.IsResponse = binary.LittleEndian.Uint32(msg[16:])&smb2FlagsServerToRedir != 0
+	op.MessageID = binary.LittleEndian.Uint64(msg[24:])
+	op.TreeID = binary.LittleEndian.Uint32(msg[36:])
+	op.SessionID = binary.LittleEndian.Uint64(msg[40:])
+
+	// Error responses have a generic body.
+	if op.IsResponse && op.Status != 0 {
+		return nil
+	}
+
+	body := msg[smb2HeaderLength_bytes:]
+	switch {
+	case op.Command == smb2Negotiate && !op.IsResponse:
+		if len(body) < 36 {
+			break
+		}
+		count := int(binary.LittleEndian.Uint16(body[2:]))
+		for i := 0; i < count && 36+2*i+2 <= len(body); i++ {
+			op.Dialects = append(op.Dialects, smb2DialectName(binary.LittleEndian.Uint16(body[36+2*i:])))
+		}
+
+	case op.Command == smb2Negotiate && op.IsResponse:
+		if len(body) < 6 {
+			break
+		}
+		op.Dialects = []string{smb2DialectName(binary.LittleEndian.Uint16(body[4:]))}
+
+	case op.Command == smb2TreeConnect && !op.IsResponse:
+		if len(body) < 8 {
+			break
+		}
+		op.Share = utf16String(msg, int(binary.LittleEndian.Uint16(body[4:])), int(binary.LittleEndian.Uint16(body[6:])))
+
+	case op.Command == smb2Create && !op.IsResponse:
+		if len(body) < 48 {
+			break
+		}
+		op.Path = utf16String(msg, int(binary.LittleEndian.Uint16(body[44:])), int(binary.LittleEndian.Uint16(body[46:])))
+
+	case op.Command == smb2Create && op.IsResponse:
+		if len(body) < 80 {
+			break
+		}
+		op.FileID = append([]byte(nil), body[64:80]...)
+
+	case op.Command == smb2Read && !op.IsResponse, op.Command == smb2Write && !op.IsResponse:
+		if len(body) < 32 {
+			break
+		}
+		op.Length = binary.LittleEndian.Uint32(body[4:])
+		op.Offset = binary.LittleEndian.Uint64(body[8:])
+		op.FileID = append([]byte(nil), body[16:32]...)
+
+	case op.Command == smb2Read && op.IsResponse, op.Command == smb2Write && op.IsResponse:
+		if len(body) < 8 {
+			break
+		}
+		op.Length = binary.LittleEndian.Uint32(body[4:])
+	}
+
+	return nil
+}
+
+// Decodes an SMB1 message. AndX chains are not followed.
+func decodeSMB1(msg []byte, op *gnet.SMBOperation) error {
+	if len(msg) < smb1HeaderLength_bytes+1 {
+		return errors.New("SMB1 header too short")
+	}
+
+	op.Version = 1
+	op.Command = uint16(msg[4])
+	op.CommandName = smb1CommandNames[op.Command]
+	op.Status = binary.LittleEndian.Uint32(msg[5:])
+	op.IsResponse = msg[9]&smb1FlagsReply != 0
+	unicode := binary.LittleEndian.Uint16(msg[10:])&smb1Flags2Unicode != 0
+	op.TreeID = uint32(binary.LittleEndian.Uint16(msg[24:]))
+	op.SessionID = uint64(binary.LittleEndian.Uint16(msg[28:]))
+	op.MessageID = uint64(binary.LittleEndian.Uint16(msg[30:]))
+
+	if op.IsResponse && op.Status != 0 {
+		return nil
+	}
+
+	// The header is followed by a count of 16-bit parameter words, the
+	// parameters, a 16-bit byte count and the data bytes.
+	wordCount := int(msg[smb1HeaderLength_bytes])
+	paramsStart := smb1HeaderLength_bytes + 1
+	params := msg[paramsStart:]
+	if len(params) < 2*wordCount {
+		return nil
+	}
+	params = params[:2*wordCount]
+	dataStart := paramsStart + 2*wordCount + 2
+	if dataStart > len(msg) {
+		return nil
+	}
+	data := msg[dataStart:]
+
+	switch {
+	case op.Command == smb1Negotiate && !op.IsResponse:
+		// Each dialect is a buffer format byte (0x02) followed by a
+		// null-terminated string.
+		for len(data) > 1 && data[0] == 0x02 {
+			n := bytes.IndexByte(data[1:], 0)
+			if n < 0 {
+				break
+			}
+			op.Dialects = append(op.Dialects, string(data[1:1+n]))
+			data = data[2+n:]
+		}
+
+	case op.Command == smb1TreeConnectAndX && !op.IsResponse:
+		if wordCount < 4 {
+			break
+		}
+		passwordLength := int(binary.LittleEndian.Uint16(params[6:]))
+		op.Share = smb1String(msg, dataStart+passwordLength, unicode)
+
+	case op.Command == smb1NTCreateAndX && !op.IsResponse:
+		if wordCount < 24 {
+			break
+		}
+		op.Path = smb1String(msg, dataStart, unicode)
+
+	case op.Command == smb1NTCreateAndX && op.IsResponse:
+		if wordCount < 4 {
+			break
+		}
+		op.FileID = append([]byte(nil), params[5:7]...)
+
+	case op.Command == smb1ReadAndX && !op.IsResponse:
+		if wordCount < 10 {
+			break
+		}
+		op.FileID = append([]byte(nil), params[4:6]...)
+		op.Offset = uint64(binary.LittleEndian.Uint32(params[6:]))
+		op.Length = uint32(binary.LittleEndian.Uint16(params[10:]))
+		if wordCount >= 12 {
+			op.Offset |= uint64(binary.LittleEndian.Uint32(params[20:])) << 32
+		}
+
+	case op.Command == smb1WriteAndX && !op.IsResponse:
+		if wordCount < 12 {
+			break
+		}
+		op.FileID = append([]byte(nil), params[4:6]...)
+		op.Offset = uint64(binary.LittleEndian.Uint32(params[6:]))
+		op.Length = uint32(binary.LittleEndian.Uint16(params[18:]))<<16 | uint32(binary.LittleEndian.Uint16(params[20:]))
+		if wordCount >= 14 {
+			op.Offset |= uint64(binary.LittleEndian.Uint32(params[24:])) << 32
+		}
+	}
+
+	return nil
+}
+
+// Decodes the SMB3 transform header that wraps an encrypted message.
+func decodeTransform(msg []byte, op *gnet.SMBOperation) error {
+	if len(msg) < transformHeaderLength_bytes {
+		return errors.New("SMB3 transform header too short")
+	}
+
+	op.Version = 2
+	op.Encrypted = true
+	op.SessionID = binary.LittleEndian.Uint64(msg[44:])
+	return nil
+}
+
+func smb2DialectName(d uint16) string {
+	if name, ok := smb2Dialects[d]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Decodes the UTF-16LE string of the given length at offset in msg. Returns
+// an empty string if it is out of bounds.
+func utf16String(msg []byte, offset, length int) string {
+	if offset < 0 || length < 0 || offset+length > len(msg) {
+		return ""
+	}
+
+	units := make([]uint16, length/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(msg[offset+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// Decodes a null-terminated SMB1 string at offset in msg. Unicode strings are
+// aligned to an even offset from the start of the header.
+func smb1String(msg []byte, offset int, unicode bool) string {
+	if !unicode {
+		if offset >= len(msg) {
+			return ""
+		}
+		s := msg[offset:]
+		if n := bytes.IndexByte(s, 0); n >= 0 {
+			s = s[:n]
+		}
+		return string(s)
+	}
+
+	if offset%2 != 0 {
+		offset++
+	}
+	end := offset
+	for end+1 < len(msg) && (msg[end] != 0 || msg[end+1] != 0) {
+		end += 2
+	}
+	return utf16String(msg, offset, end-offset)
+}
@@ -0,0 +1,72 @@
+package smb
+
+import (
+	"bytes"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing SMB1, SMB2 and SMB3 messages carried in
+// NetBIOS session messages, as used on TCP ports 139 and 445. The same factory
+// handles both directions of a connection.
+func NewSMBParserFactory() gnet.TCPParserFactory {
+	return &smbParserFactory{}
+}
+
+type smbParserFactory struct{}
+
+func (*smbParserFactory) Name() string {
+	return "SMB Parser Factory"
+}
+
+func (factory *smbParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*smbParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < netbiosHeaderLength_bytes+protocolIDLength_bytes {
+		return gnet.NeedMoreData, 0
+	}
+
+	if input.GetByte(0) != netbiosSessionMessage {
+		return gnet.Reject, input.Len()
+	}
+
+	id := input.SubView(netbiosHeaderLength_bytes, netbiosHeaderLength_bytes+protocolIDLength_bytes).Bytes()
+	var minLength int64
+	switch {
+	case bytes.Equal(id, smb1ProtocolID):
+		minLength = smb1HeaderLength_bytes
+	case bytes.Equal(id, smb2ProtocolID):
+		minLength = smb2HeaderLength_bytes
+	case bytes.Equal(id, transformProtocolID):
+		minLength = transformHeaderLength_bytes
+	default:
+		return gnet.Reject, input.Len()
+	}
+
+	if netbiosLength(input) < minLength {
+		return gnet.Reject, input.Len()
+	}
+	return gnet.Accept, 0
+}
+
+func (*smbParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newSMBParser(id)
+}
+
+// Returns the length of the NetBIOS session message at the start of input,
+// excluding the NetBIOS header.
+func netbiosLength(input memview.MemView) int64 {
+	return int64(input.GetUint24(1))
+}
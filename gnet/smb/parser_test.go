@@ -0,0 +1,91 @@
+package smb
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func utf16le(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+func netbios(msg []byte) []byte {
+	return append([]byte{0, byte(len(msg) >> 16), byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+func smb2Request(command uint16, body []byte) []byte {
+	hdr := make([]byte, smb2HeaderLength_bytes)
+	copy(hdr, smb2ProtocolID)
+	binary.LittleEndian.PutUint16(hdr[4:], smb2HeaderLength_bytes)
+	binary.LittleEndian.PutUint16(hdr[12:], command)
+	binary.LittleEndian.PutUint64(hdr[24:], 7)
+	binary.LittleEndian.PutUint32(hdr[36:], 1)
+	return netbios(append(hdr, body...))
+}
+
+func parse(t *testing.T, input []byte) gnet.SMBOperation {
+	f := NewSMBParserFactory()
+	decision, _ := f.Accepts(memview.New(input), false)
+	assert.Equal(t, gnet.Accept, decision)
+
+	result, unused, _, err := f.CreateParser(uuid.New(), 0, 0).Parse(memview.New(input), false)
+	if !assert.NoError(t, err) || !assert.NotNil(t, result) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(0), unused.Len())
+	return result.(gnet.SMBOperation)
+}
+
+func TestSMB2TreeConnect(t *testing.T) {
+	path := utf16le(`\\fileserver\C$`)
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:], 9)
+	binary.LittleEndian.PutUint16(body[4:], smb2HeaderLength_bytes+8)
+	binary.LittleEndian.PutUint16(body[6:], uint16(len(path)))
+
+	op := parse(t, smb2Request(smb2TreeConnect, append(body, path...)))
+	assert.Equal(t, 2, op.Version)
+	assert.Equal(t, "TREE_CONNECT", op.CommandName)
+	assert.Equal(t, uint64(7), op.MessageID)
+	assert.Equal(t, `\\fileserver\C$`, op.Share)
+}
+
+func TestSMB2Create(t *testing.T) {
+	name := utf16le(`Windows\System32\evil.exe`)
+	body := make([]byte, 56)
+	binary.LittleEndian.PutUint16(body[0:], 57)
+	binary.LittleEndian.PutUint16(body[44:], smb2HeaderLength_bytes+56)
+	binary.LittleEndian.PutUint16(body[46:], uint16(len(name)))
+
+	op := parse(t, smb2Request(smb2Create, append(body, name...)))
+	assert.Equal(t, "CREATE", op.CommandName)
+	assert.Equal(t, uint32(1), op.TreeID)
+	assert.Equal(t, `Windows\System32\evil.exe`, op.Path)
+}
+
+func TestSMB1Negotiate(t *testing.T) {
+	msg := make([]byte, smb1HeaderLength_bytes)
+	copy(msg, smb1ProtocolID)
+	msg[4] = byte(smb1Negotiate)
+
+	dialects := []byte("\x02PC NETWORK PROGRAM 1.0\x00\x02NT LM 0.12\x00")
+	msg = append(msg, 0) // no parameter words
+	msg = append(msg, byte(len(dialects)), byte(len(dialects)>>8))
+	msg = append(msg, dialects...)
+
+	op := parse(t, netbios(msg))
+	assert.Equal(t, 1, op.Version)
+	assert.Equal(t, "NEGOTIATE", op.CommandName)
+	assert.Equal(t, []string{"PC NETWORK PROGRAM 1.0", "NT LM 0.12"}, op.Dialects)
+}
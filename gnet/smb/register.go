@@ -0,0 +1,12 @@
+package smb
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("smb", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewSMBParserFactory()}
+	}, gnet.FramedTCPParserPriority)
+}
@@ -39,6 +39,7 @@ func (r HTTPRequest) ToStdRequest() *http.Request {
 		Header:        r.Header,
 		ContentLength: int64(r.Body.Len()),
 		Body:          io.NopCloser(r.Body.CreateReader()),
+		Trailer:       r.Trailer,
 	}
 
 	// Add any cookies in r.Cookies not already in r.Header.
@@ -80,6 +81,7 @@ func (r HTTPResponse) ToStdResponse() *http.Response {
 		Header:        r.Header,
 		ContentLength: int64(r.Body.Len()),
 		Body:          io.NopCloser(r.Body.CreateReader()),
+		Trailer:       r.Trailer,
 	}
 
 	// Add any cookies in r.Cookies not already in r.Header.
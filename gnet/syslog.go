@@ -0,0 +1,68 @@
+package gnet
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Represents a syslog message in either the BSD format (RFC 3164) or the
+// IETF format (RFC 5424), carried over UDP or TCP.
+type SyslogMessage struct {
+	// Identifies the TCP connection to which this message belongs. Zero for
+	// messages carried over UDP.
+	ConnectionID uuid.UUID
+
+	// 0 for RFC 3164 messages, otherwise the version from the RFC 5424
+	// header (currently always 1).
+	Version int
+
+	// Decoded from the PRI part: PRI = Facility*8 + Severity.
+	Facility int
+	Severity int
+
+	// RFC 3164 timestamps carry no year or time zone, so for those messages
+	// Timestamp is in UTC with year 0. Zero if absent or unparseable.
+	Timestamp time.Time
+
+	Hostname string
+	AppName  string
+	ProcID   string
+
+	// RFC 5424 only.
+	MsgID          string
+	StructuredData string
+
+	// The free-form message text.
+	Message string
+}
+
+var _ ParsedNetworkContent = (*SyslogMessage)(nil)
+
+func (SyslogMessage) ReleaseBuffers() {}
+
+var syslogSeverityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+var syslogFacilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Returns the conventional name of the severity, e.g. "err".
+func (m SyslogMessage) SeverityName() string {
+	if m.Severity < 0 || m.Severity >= len(syslogSeverityNames) {
+		return "unknown"
+	}
+	return syslogSeverityNames[m.Severity]
+}
+
+// Returns the conventional name of the facility, e.g. "auth" or "local0".
+func (m SyslogMessage) FacilityName() string {
+	if m.Facility < 0 || m.Facility >= len(syslogFacilityNames) {
+		return "unknown"
+	}
+	return syslogFacilityNames[m.Facility]
+}
@@ -0,0 +1,25 @@
+package syslog
+
+const (
+	// Largest valid PRI value: facility 23 (local7), severity 7 (debug).
+	maxPRI = 191
+
+	// Length of an RFC 3164 timestamp, e.g. "Oct 11 22:14:15".
+	bsdTimestampLength = 15
+
+	// Maximum length of a message over TCP that we buffer.
+	maxMessageLength = 64 * 1024
+
+	// Maximum number of digits in the length prefix of an octet-counted
+	// message (RFC 6587 Section 3.4.1).
+	maxOctetCountDigits = 5
+
+	// Amount of input needed to tell whether a TCP stream carries syslog.
+	minAcceptLength = 8
+
+	// Conventional syslog ports: 514 for UDP, 601 for TCP.
+	UDPPort = 514
+)
+
+// The UTF-8 byte order mark that may start an RFC 5424 message.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
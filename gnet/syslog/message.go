@@ -0,0 +1,187 @@
+package syslog
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Reports whether data starts with a valid syslog PRI part, e.g. "<34>".
+func IsSyslog(data []byte) bool {
+	_, n := parsePRI(data)
+	return n > 0
+}
+
+// Parses the PRI part at the start of data. Returns the number of bytes it
+// occupies, or 0 if it is invalid.
+func parsePRI(data []byte) (pri int, n int) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, 0
+	}
+	for i := 1; i < len(data) && i <= 4; i++ {
+		c := data[i]
+		switch {
+		case c == '>' && i > 1:
+			if pri > maxPRI {
+				return 0, 0
+			}
+			return pri, i + 1
+		case '0' <= c && c <= '9':
+			// Leading zeros are not allowed, except for PRI 0 itself.
+			if i == 2 && data[1] == '0' {
+				return 0, 0
+			}
+			pri = pri*10 + int(c-'0')
+		default:
+			return 0, 0
+		}
+	}
+	return 0, 0
+}
+
+// Parses a single syslog message, such as the payload of a UDP datagram.
+// Messages that have a valid PRI part but are otherwise malformed are
+// returned with the remainder as Message, as RFC 3164 requires of relays.
+func ParseMessage(data []byte) (gnet.SyslogMessage, error) {
+	var msg gnet.SyslogMessage
+
+	pri, n := parsePRI(data)
+	if n == 0 {
+		return msg, errors.New("invalid syslog PRI")
+	}
+	msg.Facility = pri / 8
+	msg.Severity = pri % 8
+
+	rest := string(bytes.TrimRight(data[n:], "\r\n\x00"))
+	if version, ok := parseVersion(rest); ok {
+		msg.Version = version
+		parseIETF(&msg, rest)
+	} else {
+		parseBSD(&msg, rest)
+	}
+	return msg, nil
+}
+
+// Recognizes the VERSION field that starts the RFC 5424 header.
+func parseVersion(s string) (int, bool) {
+	sp := strings.IndexByte(s, ' ')
+	if sp < 1 || sp > 2 || s[0] == '0' {
+		return 0, false
+	}
+	v, err := strconv.Atoi(s[:sp])
+	return v, err == nil
+}
+
+// Returns "" for the NILVALUE "-".
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// Parses the part of an RFC 5424 message after PRI:
+//
+//	VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP
+//	STRUCTURED-DATA [SP MSG]
+func parseIETF(msg *gnet.SyslogMessage, s string) {
+	fields := strings.SplitN(s, " ", 7)
+	if len(fields) < 7 {
+		msg.Message = s
+		return
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, fields[1]); err == nil {
+		msg.Timestamp = t
+	}
+	msg.Hostname = nilValue(fields[2])
+	msg.AppName = nilValue(fields[3])
+	msg.ProcID = nilValue(fields[4])
+	msg.MsgID = nilValue(fields[5])
+
+	sd, text := splitStructuredData(fields[6])
+	msg.StructuredData = nilValue(sd)
+	msg.Message = strings.TrimPrefix(text, string(utf8BOM))
+}
+
+// Splits STRUCTURED-DATA from the message that follows it.
+func splitStructuredData(s string) (sd, text string) {
+	if strings.HasPrefix(s, "-") {
+		return "-", strings.TrimPrefix(s[1:], " ")
+	}
+
+	// One or more SD-ELEMENTs, each in brackets. Parameter values are quoted
+	// and may contain escaped '"', '\' and ']'.
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		inQuotes := false
+		for i++; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && inQuotes {
+				i++
+				continue
+			}
+			if c == '"' {
+				inQuotes = !inQuotes
+			} else if c == ']' && !inQuotes {
+				i++
+				break
+			}
+		}
+	}
+	return s[:i], strings.TrimPrefix(s[i:], " ")
+}
+
+// Parses the part of an RFC 3164 message after PRI:
+//
+//	TIMESTAMP SP HOSTNAME SP TAG[PID]: MSG
+//
+// Many senders omit the hostname, so a token ending in ':' right after the
+// timestamp is taken to be the tag.
+func parseBSD(msg *gnet.SyslogMessage, s string) {
+	if len(s) <= bsdTimestampLength || s[bsdTimestampLength] != ' ' {
+		msg.Message = s
+		return
+	}
+	t, err := time.Parse(time.Stamp, s[:bsdTimestampLength])
+	if err != nil {
+		msg.Message = s
+		return
+	}
+	msg.Timestamp = t
+	s = s[bsdTimestampLength+1:]
+
+	if host, rest, ok := strings.Cut(s, " "); ok && !isTag(host) {
+		msg.Hostname = host
+		s = rest
+	}
+
+	// The tag is at most 32 alphanumeric characters, optionally followed by a
+	// bracketed process ID, and ends at the first other character.
+	end := strings.IndexAny(s, ":[ ")
+	if end <= 0 || end > 32 {
+		msg.Message = s
+		return
+	}
+	msg.AppName = s[:end]
+	s = s[end:]
+
+	if strings.HasPrefix(s, "[") {
+		if closing := strings.IndexByte(s, ']'); closing > 0 {
+			msg.ProcID = s[1:closing]
+			s = s[closing+1:]
+		}
+	}
+	s = strings.TrimPrefix(s, ":")
+	msg.Message = strings.TrimPrefix(s, " ")
+}
+
+// Reports whether token looks like a tag rather than a hostname.
+func isTag(token string) bool {
+	return strings.HasSuffix(token, ":") || strings.Contains(token, "[")
+}
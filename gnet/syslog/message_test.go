@@ -0,0 +1,81 @@
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestParseBSD(t *testing.T) {
+	msg, err := ParseMessage([]byte("<34>Oct 11 22:14:15 mymachine su[2301]: 'su root' failed for lonvick on /dev/pts/8\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 0, msg.Version)
+	assert.Equal(t, "auth", msg.FacilityName())
+	assert.Equal(t, "crit", msg.SeverityName())
+	assert.Equal(t, time.October, msg.Timestamp.Month())
+	assert.Equal(t, "mymachine", msg.Hostname)
+	assert.Equal(t, "su", msg.AppName)
+	assert.Equal(t, "2301", msg.ProcID)
+	assert.Equal(t, "'su root' failed for lonvick on /dev/pts/8", msg.Message)
+}
+
+func TestParseBSDWithoutHostname(t *testing.T) {
+	msg, err := ParseMessage([]byte("<13>Feb  5 17:32:18 sshd: Accepted publickey"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", msg.Hostname)
+		assert.Equal(t, "sshd", msg.AppName)
+		assert.Equal(t, "Accepted publickey", msg.Message)
+	}
+}
+
+func TestParseIETF(t *testing.T) {
+	msg, err := ParseMessage([]byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"] ` + "\xef\xbb\xbfAn application event log entry"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 1, msg.Version)
+	assert.Equal(t, 20, msg.Facility)
+	assert.Equal(t, 5, msg.Severity)
+	assert.Equal(t, 2003, msg.Timestamp.Year())
+	assert.Equal(t, "mymachine.example.com", msg.Hostname)
+	assert.Equal(t, "evntslog", msg.AppName)
+	assert.Equal(t, "", msg.ProcID)
+	assert.Equal(t, "ID47", msg.MsgID)
+	assert.Equal(t, `[exampleSDID@32473 iut="3" eventSource="App\]lication"]`, msg.StructuredData)
+	assert.Equal(t, "An application event log entry", msg.Message)
+}
+
+func TestOctetCountedTCP(t *testing.T) {
+	first := "<14>1 - host app - - - hello"
+	input := "28 " + first + "11 <14>Jan  1"
+
+	f := NewSyslogParserFactory()
+	decision, _ := f.Accepts(memview.New([]byte(input)), false)
+	assert.Equal(t, gnet.Accept, decision)
+
+	result, unused, consumed, err := f.CreateParser(uuid.New(), 0, 0).Parse(memview.New([]byte(input)), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		msg := result.(gnet.SyslogMessage)
+		assert.Equal(t, "host", msg.Hostname)
+		assert.Equal(t, "hello", msg.Message)
+		assert.Equal(t, int64(3+len(first)), consumed)
+		assert.Equal(t, "11 <14>Jan  1", unused.String())
+	}
+}
+
+func TestIsSyslog(t *testing.T) {
+	assert.True(t, IsSyslog([]byte("<0>msg")))
+	assert.True(t, IsSyslog([]byte("<191>msg")))
+	assert.False(t, IsSyslog([]byte("<192>msg")))
+	assert.False(t, IsSyslog([]byte("<012>msg")))
+	assert.False(t, IsSyslog([]byte("<html>")))
+}
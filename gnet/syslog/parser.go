@@ -0,0 +1,99 @@
+package syslog
+
+import (
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newSyslogParser(bidiID uuid.UUID) *syslogParser {
+	return &syslogParser{
+		connectionID: bidiID,
+	}
+}
+
+// Parses a single syslog message from a TCP stream.
+type syslogParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*syslogParser)(nil)
+
+func (*syslogParser) Name() string {
+	return "Syslog Parser"
+}
+
+func (parser *syslogParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse(isEnd)
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete syslog message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+func (parser *syslogParser) parse(isEnd bool) (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	in := parser.allInput
+
+	var start, end int64
+	headEnd := int64(maxOctetCountDigits + 1)
+	if headEnd > in.Len() {
+		headEnd = in.Len()
+	}
+	head := in.SubView(0, headEnd).Bytes()
+	if n, ok := octetCountPrefix(head); ok {
+		// Octet counting: the message length precedes the message.
+		length, err := strconv.ParseInt(string(head[:n-1]), 10, 64)
+		if err != nil || length > maxMessageLength {
+			return nil, 0, errors.New("invalid syslog frame length")
+		}
+		start, end = int64(n), int64(n)+length
+		if in.Len() < end {
+			return nil, 0, nil
+		}
+		numBytesConsumed = end
+	} else {
+		// Non-transparent framing: each message ends with a newline, or with the
+		// end of the connection.
+		end = in.Index(0, []byte("\n"))
+		switch {
+		case end >= 0:
+			numBytesConsumed = end + 1
+		case isEnd:
+			end = in.Len()
+			numBytesConsumed = end
+		case in.Len() > maxMessageLength:
+			return nil, 0, errors.New("syslog message too long")
+		default:
+			return nil, 0, nil
+		}
+	}
+
+	msg, err := ParseMessage(in.SubView(start, end).Bytes())
+	if err != nil {
+		return nil, 0, err
+	}
+	msg.ConnectionID = parser.connectionID
+	return msg, numBytesConsumed, nil
+}
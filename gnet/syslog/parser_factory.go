@@ -0,0 +1,74 @@
+package syslog
+
+import (
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing syslog messages over TCP, framed either by
+// octet counting or by newlines (RFC 6587). Syslog over UDP is handled by
+// ParseMessage.
+func NewSyslogParserFactory() gnet.TCPParserFactory {
+	return &syslogParserFactory{}
+}
+
+type syslogParserFactory struct{}
+
+func (*syslogParserFactory) Name() string {
+	return "Syslog Parser Factory"
+}
+
+func (factory *syslogParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*syslogParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < minAcceptLength {
+		return gnet.NeedMoreData, 0
+	}
+
+	n := input.Len()
+	if n > maxOctetCountDigits+1+minAcceptLength {
+		n = maxOctetCountDigits + 1 + minAcceptLength
+	}
+	prefix := input.SubView(0, n).Bytes()
+
+	// Skip the length of an octet-counted frame.
+	if start, ok := octetCountPrefix(prefix); ok {
+		prefix = prefix[start:]
+	}
+
+	if _, n := parsePRI(prefix); n > 0 {
+		return gnet.Accept, 0
+	}
+	return gnet.Reject, input.Len()
+}
+
+func (*syslogParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newSyslogParser(id)
+}
+
+// Recognizes the "MSG-LEN SP" prefix of an octet-counted frame. Returns the
+// length of the prefix.
+func octetCountPrefix(data []byte) (int, bool) {
+	for i, c := range data {
+		switch {
+		case c == ' ' && i > 0:
+			return i + 1, true
+		case '0' <= c && c <= '9' && i < maxOctetCountDigits && !(i == 0 && c == '0'):
+			continue
+		default:
+			return 0, false
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,12 @@
+package syslog
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("syslog", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewSyslogParserFactory()}
+	}, gnet.TextTCPParserPriority)
+}
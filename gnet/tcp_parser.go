@@ -86,6 +86,40 @@ type TCPParser interface {
 	Parse(input memview.MemView, isEnd bool) (result ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error)
 }
 
+// TCPUpgradeParserFactory is implemented by factories for protocols that a
+// connection switches to after a handshake in another protocol, such as
+// WebSocket after an HTTP/1.1 Upgrade. Because such protocols usually have no
+// recognizable preamble, these factories are skipped by Select. Instead, once
+// Upgrades returns true for a result parsed from either direction of a
+// connection, all further data on that connection is handed to the factory.
+type TCPUpgradeParserFactory interface {
+	TCPParserFactory
+
+	// Reports whether c completes a handshake that switches the connection to
+	// the protocol parsed by this factory.
+	Upgrades(c ParsedNetworkContent) bool
+}
+
+// TCPExchangeParserFactory is implemented by factories for request-response
+// protocols in which responses are sent in the order of their requests, such
+// as HTTP/1.1 with keep-alive or pipelining. TCP seq/ack numbers only pair a
+// request with its response when each request waits for the previous
+// response, so instead each direction of a connection counts the exchanges it
+// has parsed with the factory, and the parsers are created with that count.
+// The Nth request on a connection is then paired with the Nth response.
+type TCPExchangeParserFactory interface {
+	TCPParserFactory
+
+	// Like CreateParser, for the message of the exchange with the given
+	// zero-based index on the connection.
+	CreateExchangeParser(id uuid.UUID, exchange int) TCPParser
+
+	// Reports whether c is the last message of its exchange in its direction,
+	// so that the next message belongs to the next exchange. Interim messages,
+	// such as HTTP 1xx responses, do not end their exchange.
+	EndsExchange(c ParsedNetworkContent) bool
+}
+
 // TCPParserSelector helps to select a TCPParserFactory from a list of
 // factories.
 type TCPParserFactorySelector []TCPParserFactory
@@ -108,6 +142,10 @@ func (s TCPParserFactorySelector) Select(input memview.MemView, isEnd bool) (f T
 	allReject := true
 
 	for _, f := range s {
+		if _, ok := f.(TCPUpgradeParserFactory); ok {
+			continue
+		}
+
 		decision, df := f.Accepts(input, isEnd)
 		switch decision {
 		case Accept:
@@ -128,3 +166,14 @@ func (s TCPParserFactorySelector) Select(input memview.MemView, isEnd bool) (f T
 	// discardFront must be >= 0 because there is at least one NeedMoreData.
 	return nil, NeedMoreData, discardFront
 }
+
+// SelectUpgrade returns the factory for the protocol that c switches the
+// connection to, or nil if c does not complete an upgrade handshake.
+func (s TCPParserFactorySelector) SelectUpgrade(c ParsedNetworkContent) TCPParserFactory {
+	for _, f := range s {
+		if u, ok := f.(TCPUpgradeParserFactory); ok && u.Upgrades(c) {
+			return u
+		}
+	}
+	return nil
+}
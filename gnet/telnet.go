@@ -0,0 +1,70 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+)
+
+// A Telnet command from RFC 854, e.g. 251 for WILL.
+type TelnetCommand uint8
+
+const (
+	TelnetSE   TelnetCommand = 240
+	TelnetNOP  TelnetCommand = 241
+	TelnetGA   TelnetCommand = 249
+	TelnetSB   TelnetCommand = 250
+	TelnetWILL TelnetCommand = 251
+	TelnetWONT TelnetCommand = 252
+	TelnetDO   TelnetCommand = 253
+	TelnetDONT TelnetCommand = 254
+	TelnetIAC  TelnetCommand = 255
+)
+
+// A command sent in one direction of a Telnet connection. Option is zero for
+// commands that don't take one.
+type TelnetNegotiation struct {
+	Command TelnetCommand
+	Option  uint8
+}
+
+// Represents data sent in one direction of a Telnet connection, with the
+// commands embedded in it separated out.
+type TelnetData struct {
+	// Identifies the TCP connection to which this data belongs.
+	ConnectionID uuid.UUID
+
+	// The data with commands removed and escaped 0xff bytes restored.
+	Text []byte
+
+	Commands []TelnetNegotiation
+
+	// The terminal type reported by the client, if this data contained a
+	// TERMINAL-TYPE IS subnegotiation.
+	TerminalType string
+}
+
+var _ ParsedNetworkContent = (*TelnetData)(nil)
+
+func (TelnetData) ReleaseBuffers() {}
+
+// Summarizes a Telnet connection, as reconstructed by a TelnetTracker.
+type TelnetSession struct {
+	ConnectionID uuid.UUID
+
+	// The terminal type reported by the client, if any.
+	TerminalType string
+
+	// The credentials the client entered at login prompts, in order. Failed
+	// attempts are included.
+	Logins []TelnetLogin
+}
+
+var _ ParsedNetworkContent = (*TelnetSession)(nil)
+
+func (TelnetSession) ReleaseBuffers() {}
+
+// Credentials entered in response to a login prompt. Either field is empty if
+// its prompt was not seen.
+type TelnetLogin struct {
+	Username string
+	Password string
+}
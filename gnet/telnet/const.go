@@ -0,0 +1,19 @@
+package telnet
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+const (
+	iac = byte(gnet.TelnetIAC)
+	sb  = byte(gnet.TelnetSB)
+	se  = byte(gnet.TelnetSE)
+
+	// The TERMINAL-TYPE option of RFC 1091, and its IS subcommand.
+	terminalTypeOption = 24
+	terminalTypeIs     = 0
+
+	// Maximum length of a subnegotiation that we buffer while waiting for its
+	// end.
+	maxSubnegotiationLength = 4096
+)
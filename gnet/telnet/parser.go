@@ -0,0 +1,133 @@
+package telnet
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newTelnetParser(bidiID uuid.UUID) *telnetParser {
+	return &telnetParser{
+		connectionID: bidiID,
+	}
+}
+
+// Parses the data available in one direction of a Telnet connection into a
+// TelnetData. A command split across calls is held back until it is complete.
+type telnetParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*telnetParser)(nil)
+
+func (*telnetParser) Name() string {
+	return "Telnet Parser"
+}
+
+func (parser *telnetParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+	totalBytesConsumed = parser.allInput.Len()
+
+	data, consumed, err := parseData(parser.allInput.Bytes())
+	if err != nil {
+		return nil, memview.MemView{}, totalBytesConsumed, err
+	}
+	if isEnd {
+		// An incomplete command at the end of the connection is dropped.
+		consumed = int(parser.allInput.Len())
+	}
+	if consumed == 0 {
+		return nil, memview.MemView{}, totalBytesConsumed, nil
+	}
+
+	data.ConnectionID = parser.connectionID
+	unused = parser.allInput.SubView(int64(consumed), parser.allInput.Len())
+	return data, unused, totalBytesConsumed - unused.Len(), nil
+}
+
+// Separates the commands in b from its data. Returns the number of bytes of b
+// that were used, which is short of len(b) if b ends with an incomplete
+// command.
+func parseData(b []byte) (data gnet.TelnetData, consumed int, err error) {
+	text := make([]byte, 0, len(b))
+	i := 0
+loop:
+	for i < len(b) {
+		if b[i] != iac {
+			text = append(text, b[i])
+			i++
+			continue
+		}
+		if i+1 >= len(b) {
+			break loop
+		}
+
+		switch cmd := gnet.TelnetCommand(b[i+1]); cmd {
+		case gnet.TelnetIAC:
+			// An escaped 0xff data byte.
+			text = append(text, iac)
+			i += 2
+
+		case gnet.TelnetWILL, gnet.TelnetWONT, gnet.TelnetDO, gnet.TelnetDONT:
+			if i+2 >= len(b) {
+				break loop
+			}
+			data.Commands = append(data.Commands, gnet.TelnetNegotiation{Command: cmd, Option: b[i+2]})
+			i += 3
+
+		case gnet.TelnetSB:
+			end := subnegotiationEnd(b, i+2)
+			if end < 0 {
+				if len(b)-i > maxSubnegotiationLength {
+					return data, 0, errors.New("Telnet subnegotiation too long")
+				}
+				break loop
+			}
+			if i+2 < end {
+				data.Commands = append(data.Commands, gnet.TelnetNegotiation{Command: cmd, Option: b[i+2]})
+				if params := unescape(b[i+3 : end]); b[i+2] == terminalTypeOption && len(params) > 0 && params[0] == terminalTypeIs {
+					data.TerminalType = string(params[1:])
+				}
+			}
+			i = end + 2
+
+		default:
+			data.Commands = append(data.Commands, gnet.TelnetNegotiation{Command: cmd})
+			i += 2
+		}
+	}
+	data.Text = text
+	return data, i, nil
+}
+
+// Returns the index of the IAC SE that ends the subnegotiation whose
+// parameters start at start, or -1 if it is not in b.
+func subnegotiationEnd(b []byte, start int) int {
+	for i := start; i+1 < len(b); i++ {
+		if b[i] != iac {
+			continue
+		}
+		if b[i+1] == se {
+			return i
+		}
+		// Skip the second byte of an escaped 0xff.
+		i++
+	}
+	return -1
+}
+
+// Restores escaped 0xff bytes in subnegotiation parameters.
+func unescape(b []byte) []byte {
+	result := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		result = append(result, b[i])
+		if b[i] == iac && i+1 < len(b) && b[i+1] == iac {
+			i++
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package telnet
+
+import (
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory that recognizes the start of a Telnet connection by its
+// option negotiation.
+func NewTelnetParserFactory() gnet.TCPParserFactory {
+	return &telnetParserFactory{}
+}
+
+// Returns a factory for the rest of a Telnet connection, once its option
+// negotiation has been parsed. Typed characters and output have no
+// recognizable structure, so all further data on the connection is parsed as
+// Telnet.
+func NewTelnetSessionParserFactory() gnet.TCPParserFactory {
+	return &telnetSessionParserFactory{}
+}
+
+type telnetParserFactory struct{}
+
+func (*telnetParserFactory) Name() string {
+	return "Telnet Parser Factory"
+}
+
+func (factory *telnetParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*telnetParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < 2 {
+		return gnet.NeedMoreData, 0
+	}
+	if input.GetByte(0) != iac {
+		return gnet.Reject, input.Len()
+	}
+
+	switch gnet.TelnetCommand(input.GetByte(1)) {
+	case gnet.TelnetWILL, gnet.TelnetWONT, gnet.TelnetDO, gnet.TelnetDONT, gnet.TelnetSB:
+		return gnet.Accept, 0
+	}
+	return gnet.Reject, input.Len()
+}
+
+func (*telnetParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newTelnetParser(id)
+}
+
+type telnetSessionParserFactory struct{}
+
+var _ gnet.TCPUpgradeParserFactory = (*telnetSessionParserFactory)(nil)
+
+func (*telnetSessionParserFactory) Name() string {
+	return "Telnet Session Parser Factory"
+}
+
+func (*telnetSessionParserFactory) Upgrades(c gnet.ParsedNetworkContent) bool {
+	_, ok := c.(gnet.TelnetData)
+	return ok
+}
+
+func (*telnetSessionParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() == 0 {
+		if isEnd {
+			return gnet.Reject, 0
+		}
+		return gnet.NeedMoreData, 0
+	}
+	return gnet.Accept, 0
+}
+
+func (*telnetSessionParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newTelnetParser(id)
+}
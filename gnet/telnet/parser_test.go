@@ -0,0 +1,48 @@
+package telnet
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestTelnetParser(t *testing.T) {
+	input := []byte{
+		0xff, 0xfd, 0x18, // DO TERMINAL-TYPE
+		0xff, 0xfa, 0x18, 0x00, 'x', 't', 'e', 'r', 'm', 0xff, 0xf0, // SB TERMINAL-TYPE IS xterm SE
+		'a', 0xff, 0xff, 'b', // escaped 0xff
+		0xff, 0xfb, // WILL, split before its option
+	}
+
+	f := NewTelnetParserFactory()
+	decision, _ := f.Accepts(memview.New(input), false)
+	assert.Equal(t, gnet.Accept, decision)
+	decision, _ = f.Accepts(memview.New([]byte("login: ")), false)
+	assert.Equal(t, gnet.Reject, decision)
+
+	id := uuid.New()
+	result, unused, consumed, err := f.CreateParser(id, 0, 0).Parse(memview.New(input), false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, gnet.TelnetData{
+			ConnectionID: id,
+			Text:         []byte{'a', 0xff, 'b'},
+			Commands: []gnet.TelnetNegotiation{
+				{Command: gnet.TelnetDO, Option: 0x18},
+				{Command: gnet.TelnetSB, Option: 0x18},
+			},
+			TerminalType: "xterm",
+		}, result)
+		assert.Equal(t, []byte{0xff, 0xfb}, unused.Bytes())
+		assert.Equal(t, int64(len(input)-2), consumed)
+	}
+
+	// Once Telnet has been seen, the session factory takes any data.
+	session := NewTelnetSessionParserFactory().(gnet.TCPUpgradeParserFactory)
+	assert.True(t, session.Upgrades(result))
+	decision, _ = session.Accepts(memview.New([]byte("r")), false)
+	assert.Equal(t, gnet.Accept, decision)
+}
@@ -0,0 +1,15 @@
+package telnet
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("telnet", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{
+			NewTelnetParserFactory(),
+			NewTelnetSessionParserFactory(),
+		}
+	}, gnet.FallbackTCPParserPriority)
+}
@@ -0,0 +1,288 @@
+package gnet
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default time a Telnet connection may be idle before its session is emitted.
+const DefaultTelnetSessionTimeout = 5 * time.Minute
+
+// The well-known Telnet server port.
+const telnetPort = 23
+
+// Login prompts, matched against the end of the server's output.
+var (
+	telnetUsernamePrompts = []string{"login:", "username:", "user name:", "user:"}
+	telnetPasswordPrompts = []string{"password:", "passcode:"}
+)
+
+// Keep at most this much of the server's output for matching prompts.
+const maxTelnetPromptLength = 64
+
+// TelnetTracker reconstructs the login exchange of Telnet connections from
+// TelnetData. Lines the client types in response to username and password
+// prompts are recorded as TelnetLogins, and a TelnetSession is emitted once the
+// connection closes, goes idle for the timeout, or on Flush. As with
+// PairCollector, timeouts are measured against observation times in the
+// traffic.
+//
+// The server is the side using port 23 or, failing that, the first side to
+// send a login prompt.
+type TelnetTracker struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*list.Element
+	order    *list.List // of *telnetSession, least recently active first
+}
+
+type telnetSession struct {
+	TelnetSession
+
+	// The endpoint of the server, or empty if not known yet.
+	server string
+
+	// The end of the server's output since the last prompt.
+	serverOutput string
+
+	// The prompt awaiting a line from the client.
+	awaiting telnetField
+
+	// What the client has typed since the end of its last line.
+	line []byte
+
+	// Whether each side has closed the connection, indexed as by
+	// directionIndex.
+	fin [2]bool
+
+	first    NetTraffic
+	lastSeen time.Time
+}
+
+type telnetField int
+
+const (
+	telnetNoField telnetField = iota
+	telnetUsernameField
+	telnetPasswordField
+)
+
+// Creates a TelnetTracker that emits sessions after they have been idle for
+// timeout. If timeout is not positive, DefaultTelnetSessionTimeout is used.
+func NewTelnetTracker(timeout time.Duration) *TelnetTracker {
+	if timeout <= 0 {
+		timeout = DefaultTelnetSessionTimeout
+	}
+	return &TelnetTracker{
+		timeout:  timeout,
+		sessions: map[uuid.UUID]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Run passes through all traffic from in, adding a TelnetSession after each
+// Telnet connection ends. Sessions still open when in is closed are emitted at
+// the end.
+func (c *TelnetTracker) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, 100)
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range c.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range c.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe processes a single piece of traffic and returns the traffic that is
+// ready to be emitted as a result, starting with t itself.
+func (c *TelnetTracker) Observe(t NetTraffic) []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := append(c.expire(t.ObservationTime), t)
+
+	switch content := t.Content.(type) {
+	case TelnetData:
+		elem, ok := c.sessions[t.ConnectionID]
+		if !ok {
+			elem = c.order.PushBack(&telnetSession{
+				TelnetSession: TelnetSession{ConnectionID: t.ConnectionID},
+				first:         t,
+			})
+			c.sessions[t.ConnectionID] = elem
+		}
+		s := elem.Value.(*telnetSession)
+		s.lastSeen = t.ObservationTime
+		c.order.MoveToBack(elem)
+		s.observe(t, content)
+
+	case TCPPacketMetadata:
+		elem, ok := c.sessions[t.ConnectionID]
+		if !ok {
+			return results
+		}
+		s := elem.Value.(*telnetSession)
+		if content.FIN {
+			s.fin[directionIndex(t)] = true
+		}
+		if content.RST || (s.fin[0] && s.fin[1]) {
+			results = append(results, c.evict(elem))
+		}
+	}
+	return results
+}
+
+// Flush returns the sessions of all open connections.
+func (c *TelnetTracker) Flush() []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		results = append(results, c.evict(c.order.Front()))
+	}
+	return results
+}
+
+// Ends sessions that have been idle longer than the timeout as of now.
+func (c *TelnetTracker) expire(now time.Time) []NetTraffic {
+	if now.IsZero() {
+		return nil
+	}
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		if now.Sub(front.Value.(*telnetSession).lastSeen) < c.timeout {
+			break
+		}
+		results = append(results, c.evict(front))
+	}
+	return results
+}
+
+// Removes a session and returns it as traffic oriented from client to server,
+// if the server is known.
+func (c *TelnetTracker) evict(elem *list.Element) NetTraffic {
+	s := c.order.Remove(elem).(*telnetSession)
+	delete(c.sessions, s.ConnectionID)
+
+	result := s.first
+	if s.server != "" && s.server == endpointKey(result.SrcIP, result.SrcPort) {
+		result.SrcIP, result.DstIP = result.DstIP, result.SrcIP
+		result.SrcPort, result.DstPort = result.DstPort, result.SrcPort
+	}
+	result.FinalPacketTime = s.lastSeen
+	result.Payload = nil
+	result.Content = s.TelnetSession
+	return result
+}
+
+func (s *telnetSession) observe(t NetTraffic, data TelnetData) {
+	if data.TerminalType != "" {
+		s.TerminalType = data.TerminalType
+	}
+
+	src := endpointKey(t.SrcIP, t.SrcPort)
+	if s.server == "" {
+		switch {
+		case t.SrcPort == telnetPort:
+			s.server = src
+		case t.DstPort == telnetPort:
+			s.server = endpointKey(t.DstIP, t.DstPort)
+		}
+	}
+
+	if s.server == src {
+		s.observeServer(data.Text)
+		return
+	}
+	if s.server == "" {
+		// Until a prompt identifies the server, either side may be it.
+		if s.observeServer(data.Text) {
+			s.server = src
+		}
+		return
+	}
+	s.observeClient(data.Text)
+}
+
+// Watches the server's output for login prompts, and reports whether one was
+// found.
+func (s *telnetSession) observeServer(text []byte) bool {
+	s.serverOutput += string(text)
+	if len(s.serverOutput) > maxTelnetPromptLength {
+		s.serverOutput = s.serverOutput[len(s.serverOutput)-maxTelnetPromptLength:]
+	}
+
+	output := strings.ToLower(strings.TrimRight(s.serverOutput, " \t"))
+	for _, prompt := range telnetUsernamePrompts {
+		if strings.HasSuffix(output, prompt) {
+			s.prompt(telnetUsernameField)
+			return true
+		}
+	}
+	for _, prompt := range telnetPasswordPrompts {
+		if strings.HasSuffix(output, prompt) {
+			s.prompt(telnetPasswordField)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *telnetSession) prompt(f telnetField) {
+	s.awaiting = f
+	s.serverOutput = ""
+	s.line = s.line[:0]
+}
+
+// Collects the client's keystrokes into lines, and records the lines that
+// answer prompts.
+func (s *telnetSession) observeClient(text []byte) {
+	for _, b := range text {
+		switch b {
+		case '\r', '\n':
+			s.endLine()
+		case 0x08, 0x7f: // backspace, delete
+			if len(s.line) > 0 {
+				s.line = s.line[:len(s.line)-1]
+			}
+		default:
+			if b >= ' ' {
+				s.line = append(s.line, b)
+			}
+		}
+	}
+}
+
+func (s *telnetSession) endLine() {
+	line := string(s.line)
+	s.line = s.line[:0]
+
+	switch s.awaiting {
+	case telnetUsernameField:
+		s.Logins = append(s.Logins, TelnetLogin{Username: line})
+	case telnetPasswordField:
+		if n := len(s.Logins); n > 0 && s.Logins[n-1].Password == "" {
+			s.Logins[n-1].Password = line
+		} else {
+			s.Logins = append(s.Logins, TelnetLogin{Password: line})
+		}
+	default:
+		// Either not a response to a prompt, or the second half of a CR LF.
+		return
+	}
+	s.awaiting = telnetNoField
+}
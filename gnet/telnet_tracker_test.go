@@ -0,0 +1,70 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelnetTracker(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	conn := uuid.New()
+
+	c := NewTelnetTracker(time.Minute)
+
+	at := time.Duration(0)
+	send := func(fromClient bool, content ParsedNetworkContent) []NetTraffic {
+		at += 10 * time.Millisecond
+		t := NetTraffic{
+			SrcIP: server, SrcPort: 23, DstIP: client, DstPort: 40000,
+			ConnectionID:    conn,
+			Content:         content,
+			ObservationTime: start.Add(at),
+		}
+		if fromClient {
+			t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+			t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+		}
+		return c.Observe(t)
+	}
+	text := func(s string) TelnetData { return TelnetData{ConnectionID: conn, Text: []byte(s)} }
+
+	send(true, TelnetData{ConnectionID: conn, TerminalType: "xterm"})
+	send(false, text("Ubuntu 22.04\r\nhost log"))
+	send(false, text("in: "))
+
+	// The client types character by character, with a correction, and the
+	// server echoes.
+	for _, s := range []string{"r", "x", "\x7f", "oot", "\r\n"} {
+		send(true, text(s))
+		send(false, text(s))
+	}
+	send(false, text("Password: "))
+	send(true, text("hunter2\r\n"))
+	send(false, text("\r\nLogin incorrect\r\nhost login: "))
+	send(true, text("admin\r\n"))
+	send(false, text("admin\r\nPassword: "))
+	send(true, text("secret\r\n"))
+	send(false, text("$ "))
+	send(true, text("ls\r\n"))
+
+	assert.Len(t, send(false, TCPPacketMetadata{FIN: true}), 1)
+	results := send(true, TCPPacketMetadata{FIN: true})
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, TelnetSession{
+			ConnectionID: conn,
+			TerminalType: "xterm",
+			Logins: []TelnetLogin{
+				{Username: "root", Password: "hunter2"},
+				{Username: "admin", Password: "secret"},
+			},
+		}, results[1].Content)
+		assert.True(t, results[1].SrcIP.Equal(client))
+		assert.Equal(t, 23, results[1].DstPort)
+	}
+	assert.Empty(t, c.Flush())
+}
@@ -1,9 +1,42 @@
 package gnet
 
-const TLSV1_2 TLSVersion = 0x0303
+const (
+	TLSV1_2 TLSVersion = 0x0303
+	TLSV1_3 TLSVersion = 0x0304
+)
 
 type TLSVersion uint16
 
+// Content types of TLS records.
+type TLSRecordType uint8
+
+const (
+	TLSChangeCipherSpecRecord TLSRecordType = 20
+	TLSAlertRecord            TLSRecordType = 21
+	TLSHandshakeRecord        TLSRecordType = 22
+	TLSApplicationDataRecord  TLSRecordType = 23
+)
+
+// Returns the content type of the TLS record that payload starts with, or 0 if
+// it does not start with the header of one.
+func TLSRecordTypeOf(payload []byte) TLSRecordType {
+	if len(payload) < 5 || payload[1] != 0x03 || payload[2] > 0x04 {
+		return 0
+	}
+	switch t := TLSRecordType(payload[0]); t {
+	case TLSChangeCipherSpecRecord, TLSAlertRecord, TLSHandshakeRecord, TLSApplicationDataRecord:
+		return t
+	}
+	return 0
+}
+
+// Reports whether v is a GREASE value reserved by RFC 8701. Clients add these
+// at random to cipher suites, extensions, groups and versions to keep servers
+// tolerant of unknown values, so they are ignored when fingerprinting.
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
 func (v TLSVersion) String() string {
 	switch v {
 	case 0x0300:
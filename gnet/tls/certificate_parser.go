@@ -9,15 +9,17 @@ import (
 	"github.com/mel2oo/go-pcap/memview"
 )
 
-func newTLSCertificateParser(bidiID uuid.UUID) *tlsCertificateParser {
+func newTLSCertificateParser(bidiID uuid.UUID, logger gnet.Logger) *tlsCertificateParser {
 	return &tlsCertificateParser{
 		connectionID: bidiID,
+		logger:       logger,
 	}
 }
 
 type tlsCertificateParser struct {
 	connectionID uuid.UUID
 	allInput     memview.MemView
+	logger       gnet.Logger
 }
 
 var _ gnet.TCPParser = (*tlsCertificateParser)(nil)
@@ -31,7 +33,7 @@ func (parser *tlsCertificateParser) Parse(input memview.MemView, isEnd bool) (re
 	// It's an error if we're at the end and we don't yet have a result.
 	if isEnd && result == nil && err == nil {
 		// We never got the full TLS record. This is an error.
-		err = errors.New("incomplete TLS record for Client Hello")
+		err = errors.New("incomplete TLS record for Certificate")
 	}
 
 	totalBytesConsumed = parser.allInput.Len()
@@ -53,54 +55,88 @@ func (parser *tlsCertificateParser) parse(input memview.MemView) (result gnet.Pa
 	// Add the incoming bytes to our buffer.
 	parser.allInput.Append(input)
 
-	// handshake(1)
-	// 	version(2)
-	// 	length(2)
-	// Handshake Type: Certificate(11) (1)
-	// 	Length (3)
-	// 	Certificates Length(3)
-	if parser.allInput.Len() < 12 {
-		return nil, 0, nil
-	}
-	// The last two bytes of the record header give the total length of the
-	// handshake message that appears after the record header.
-	handshakeMsgLen_bytes := parser.allInput.GetUint16(tlsRecordHeaderLength_bytes - 2)
-	handshakeMsgEndPos := int64(tlsRecordHeaderLength_bytes + handshakeMsgLen_bytes)
-	// Wait until we have the full handshake record.
-	if parser.allInput.Len() < handshakeMsgEndPos {
-		return nil, 0, nil
+	// A Certificate message can be larger than a TLS record, so gather the
+	// contents of consecutive handshake records until it is complete.
+	var handshake memview.MemView
+	var pos int64
+	for {
+		// Wait until we have the next record header.
+		if parser.allInput.Len() < pos+tlsRecordHeaderLength_bytes {
+			return nil, 0, nil
+		}
+		if parser.allInput.GetByte(pos) != handshakeRecordType {
+			return nil, 0, errors.New("Certificate message interrupted by a non-handshake record")
+		}
+
+		// The last two bytes of the record header give the length of the
+		// record's contents.
+		recordEndPos := pos + tlsRecordHeaderLength_bytes + int64(parser.allInput.GetUint16(pos+tlsRecordHeaderLength_bytes-2))
+
+		// Wait until we have the full record.
+		if parser.allInput.Len() < recordEndPos {
+			return nil, 0, nil
+		}
+		handshake.Append(parser.allInput.SubView(pos+tlsRecordHeaderLength_bytes, recordEndPos))
+		pos = recordEndPos
+
+		if handshake.Len() < handshakeHeaderLength_bytes {
+			continue
+		}
+		msgLen := int64(handshake.GetUint24(1))
+		if msgLen > maxCertificateMessageLength_bytes {
+			return nil, 0, errors.New("Certificate message too long")
+		}
+		if handshake.Len() >= handshakeHeaderLength_bytes+msgLen {
+			// Any messages following the Certificate in the last record are
+			// consumed with it.
+			cert, err := parseCertificateMessage(handshake.SubView(handshakeHeaderLength_bytes, handshakeHeaderLength_bytes+msgLen), parser.logger)
+			if err != nil {
+				return nil, 0, err
+			}
+			cert.ConnectionID = parser.connectionID
+			return cert, pos, nil
+		}
 	}
-	// Get a Memview of the handshake record and a corresponding reader.
-	// buf -> Handshake Certificate
-	buf := parser.allInput.SubView(tlsRecordHeaderLength_bytes, handshakeMsgEndPos)
-	var offset int64 = 1 + 3
-	certLen := buf.GetUint24(offset)
-	offset += 3
-	// buf -> Certificates
-	buf = buf.SubView(offset, int64(certLen)+offset)
+}
+
+// Parses the body of a TLS 1.2 Certificate message: a list of DER-encoded
+// certificates, each preceded by its 3-byte length. Certificates that can't
+// be parsed are skipped.
+func parseCertificateMessage(buf memview.MemView, logger gnet.Logger) (gnet.TLSCertificate, error) {
 	cert := gnet.TLSCertificate{
-		ConnectionID: parser.connectionID,
 		Certificates: make([]*x509.Certificate, 0),
 	}
-	// frist certificates
-	certLen = buf.GetUint24(0)
-	offset = 3
-	buf1 := buf.SubView(offset, int64(certLen)+offset)
-	c, err := x509.ParseCertificate(buf1.Bytes())
-	if err != nil {
-		return nil, handshakeMsgEndPos, err
+
+	if buf.Len() < certificateLengthLength_bytes {
+		return cert, errors.New("malformed Certificate message")
 	}
-	cert.Certificates = append(cert.Certificates, c)
-	// second certificates
-	offset += int64(certLen)
-	certLen = buf.GetUint24(offset)
-	offset += 3
-	buf1 = buf.SubView(offset, int64(certLen)+offset)
-	c, err = x509.ParseCertificate(buf1.Bytes())
-	if err != nil {
-		return nil, handshakeMsgEndPos, err
+	listLen := int64(buf.GetUint24(0))
+	list := buf.SubView(certificateLengthLength_bytes, certificateLengthLength_bytes+listLen)
+	if list.Len() != listLen {
+		return cert, errors.New("truncated certificate list")
+	}
+
+	for offset := int64(0); offset < list.Len(); {
+		if list.Len()-offset < certificateLengthLength_bytes {
+			return cert, errors.New("truncated certificate list")
+		}
+		certLen := int64(list.GetUint24(offset))
+		offset += certificateLengthLength_bytes
+
+		der := list.SubView(offset, offset+certLen)
+		if der.Len() != certLen {
+			return cert, errors.New("truncated certificate")
+		}
+		offset += certLen
+
+		c, err := x509.ParseCertificate(der.Bytes())
+		if err != nil {
+			logger.Debugf("skipping certificate that failed to parse: %v", err)
+			continue
+		}
+		cert.Certificates = append(cert.Certificates, c)
 	}
-	cert.Certificates = append(cert.Certificates, c)
 
-	return cert, handshakeMsgEndPos, nil
+	cert.Chain = gnet.NewTLSCertificateChain(cert.Certificates)
+	return cert, nil
 }
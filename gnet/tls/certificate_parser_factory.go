@@ -7,11 +7,13 @@ import (
 	"github.com/mel2oo/go-pcap/memview"
 )
 
-func NewTLSCertificateParserFactory() gnet.TCPParserFactory {
-	return &tlsCertificateParserFactory{}
+func NewTLSCertificateParserFactory(opts ...Option) gnet.TCPParserFactory {
+	return &tlsCertificateParserFactory{opts: applyOptions(opts)}
 }
 
-type tlsCertificateParserFactory struct{}
+type tlsCertificateParserFactory struct {
+	opts Options
+}
 
 func (*tlsCertificateParserFactory) Name() string {
 	return "TLS Certificate Parser Factory"
@@ -66,6 +68,10 @@ func (*tlsCertificateParserFactory) accepts(input memview.MemView) (decision gne
 	return gnet.Accept, 0
 }
 
+func (factory *tlsCertificateParserFactory) WithLogger(l gnet.Logger) gnet.TCPParserFactory {
+	return &tlsCertificateParserFactory{opts: Options{Logger: l}}
+}
+
 func (factory *tlsCertificateParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
-	return newTLSCertificateParser(id)
+	return newTLSCertificateParser(id, factory.opts.Logger)
 }
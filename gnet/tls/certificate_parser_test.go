@@ -1,10 +1,22 @@
 package tls
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"fmt"
+	"math/big"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestXxx(t *testing.T) {
@@ -32,3 +44,136 @@ func MD5(s []byte) string {
 	h.Write(s)
 	return hex.EncodeToString(h.Sum(nil))
 }
+
+// Builds a root -> intermediate -> leaf chain and returns it leaf first.
+func newTestChain(t *testing.T) [][]byte {
+	now := time.Now()
+	newCert := func(name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(now.UnixNano()),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  parent == nil || name != "leaf",
+			BasicConstraintsValid: true,
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, key, der
+	}
+
+	root, rootKey, rootDER := newCert("root", nil, nil)
+	inter, interKey, interDER := newCert("intermediate", root, rootKey)
+	_, _, leafDER := newCert("leaf", inter, interKey)
+	return [][]byte{leafDER, interDER, rootDER}
+}
+
+func appendUint24(b []byte, v int) []byte {
+	return append(b, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func TestCertificateChainAcrossRecords(t *testing.T) {
+	chain := newTestChain(t)
+
+	var list []byte
+	for _, der := range chain {
+		list = appendUint24(list, len(der))
+		list = append(list, der...)
+	}
+	body := appendUint24(nil, len(list))
+	body = append(body, list...)
+	msg := appendUint24([]byte{0x0b}, len(body))
+	msg = append(msg, body...)
+
+	// Split the message across three handshake records.
+	var stream []byte
+	for i, split := 0, len(msg)/3; i < len(msg); i += split {
+		end := i + split
+		if end > len(msg) {
+			end = len(msg)
+		}
+		stream = append(stream, 0x16, 0x03, 0x03, byte((end-i)>>8), byte(end-i))
+		stream = append(stream, msg[i:end]...)
+	}
+	// Trailing bytes belong to the next parser.
+	stream = append(stream, 0x17, 0x03, 0x03)
+
+	p := newTLSCertificateParser(uuid.New(), gnet.NopLogger)
+	var result gnet.ParsedNetworkContent
+	var unused memview.MemView
+	for i := 0; i < len(stream) && result == nil; i += 100 {
+		end := i + 100
+		if end > len(stream) {
+			end = len(stream)
+		}
+		var err error
+		result, unused, _, err = p.Parse(memview.New(stream[i:end]), false)
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+
+	cert, ok := result.(gnet.TLSCertificate)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, int64(3), unused.Len())
+	if assert.Len(t, cert.Certificates, 3) && assert.Len(t, cert.Chain, 3) {
+		assert.Equal(t, "CN=leaf", cert.Chain[0].Subject)
+		assert.Equal(t, "CN=intermediate", cert.Chain[0].Issuer)
+		assert.True(t, cert.Chain[0].SignedByNext)
+		assert.True(t, cert.Chain[1].SignedByNext)
+		assert.False(t, cert.Chain[0].SelfSigned)
+		assert.True(t, cert.Chain[2].SelfSigned)
+		assert.False(t, cert.Chain[2].SignedByNext)
+		assert.True(t, cert.Chain[0].ValidAt(time.Now()))
+		assert.False(t, cert.Chain[0].ValidAt(time.Now().Add(2*time.Hour)))
+	}
+}
+
+// Records the messages logged to it.
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func TestCertificateSkipsAreLogged(t *testing.T) {
+	chain := newTestChain(t)
+	garbage := []byte{0x30, 0x03, 0x01, 0x02, 0x03}
+
+	var list []byte
+	for _, der := range [][]byte{chain[0], garbage} {
+		list = appendUint24(list, len(der))
+		list = append(list, der...)
+	}
+	body := appendUint24(nil, len(list))
+	body = append(body, list...)
+
+	logger := &recordingLogger{}
+	cert, err := parseCertificateMessage(memview.New(body), logger)
+	assert.NoError(t, err)
+	assert.Len(t, cert.Certificates, 1)
+	if assert.Len(t, logger.messages, 1) {
+		assert.Contains(t, logger.messages[0], "skipping certificate")
+	}
+}
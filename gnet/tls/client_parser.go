@@ -9,15 +9,17 @@ import (
 	"github.com/mel2oo/go-pcap/memview"
 )
 
-func newTLSClientHelloParser(bidiID uuid.UUID) *tlsClientHelloParser {
+func newTLSClientHelloParser(bidiID uuid.UUID, logger gnet.Logger) *tlsClientHelloParser {
 	return &tlsClientHelloParser{
 		connectionID: bidiID,
+		logger:       logger,
 	}
 }
 
 type tlsClientHelloParser struct {
 	connectionID uuid.UUID
 	allInput     memview.MemView
+	logger       gnet.Logger
 }
 
 var _ gnet.TCPParser = (*tlsClientHelloParser)(nil)
@@ -68,60 +70,76 @@ func (parser *tlsClientHelloParser) parse(input memview.MemView) (result gnet.Pa
 		return nil, 0, nil
 	}
 
-	// Get a Memview of the handshake record and a corresponding reader.
+	// Get a Memview of the handshake record.
 	buf := parser.allInput.SubView(tlsRecordHeaderLength_bytes, handshakeMsgEndPos)
+	hello, err := parseClientHello(buf, parser.logger)
+	if err != nil {
+		return nil, 0, err
+	}
+	hello.ConnectionID = parser.connectionID
+
+	return hello, handshakeMsgEndPos, nil
+}
+
+// Parses a Client Hello handshake message, starting at the handshake header.
+// The ConnectionID of the result is left unset.
+func ParseClientHello(buf memview.MemView) (hello gnet.TLSClientHello, err error) {
+	return parseClientHello(buf, gnet.NopLogger)
+}
+
+func parseClientHello(buf memview.MemView, logger gnet.Logger) (hello gnet.TLSClientHello, err error) {
 	reader := buf.CreateReader()
+	parser := &tlsClientHelloParser{}
 
-	hello := gnet.TLSClientHello{
-		ConnectionID: parser.connectionID,
-	}
 	// seak handshake header
 	_, err = reader.Seek(handshakeHeaderLength_bytes, io.SeekCurrent)
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 
 	// read version
 	v, err := reader.ReadUint16()
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 	hello.Version = gnet.TLSVersion(v)
 
 	// seek random
 	_, err = reader.Seek(clientRandomLength_bytes, io.SeekCurrent)
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 	// seek session
 	err = reader.ReadByteAndSeek()
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 	// read cipher suites
 	suites, err := reader.ReadUint16()
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 	for i := uint16(0); i < suites/2; i++ {
 		s, err := reader.ReadUint16()
 		if err != nil {
-			return nil, 0, err
+			return hello, err
+		}
+		if !gnet.IsGREASE(s) {
+			hello.CipherSuites = append(hello.CipherSuites, s)
 		}
-		hello.CipherSuites = append(hello.CipherSuites, s)
 	}
 
 	// seek compression methods
 	err = reader.ReadByteAndSeek()
 	if err != nil {
-		return nil, 0, err
+		return hello, err
 	}
 
 	// Now at the extensions. Isolate this section in the reader. The first two
 	// bytes gives the length of the extensions in bytes.
 	_, reader, err = reader.ReadUint16AndTruncate()
 	if err != nil {
-		return nil, 0, errors.New("malformed TLS message")
+		return hello, errors.New("malformed TLS message")
 	}
 
 	var extensionType tlsExtensionID
@@ -133,25 +151,27 @@ func (parser *tlsClientHelloParser) parse(input memview.MemView) (result gnet.Pa
 				// Out of extensions.
 				break
 			} else if err != nil {
-				return nil, 0, err
+				return hello, err
 			}
 			extensionType = tlsExtensionID(val)
 		}
 
-		// append extensions
-		hello.Extensions = append(hello.Extensions, uint16(extensionType))
+		// append extensions, leaving out GREASE so fingerprints are stable
+		if !gnet.IsGREASE(uint16(extensionType)) {
+			hello.Extensions = append(hello.Extensions, uint16(extensionType))
+		}
 
 		// The following two bytes give the extension's content length in bytes.
 		// Isolate the extension in its own reader.
 		extensionContentLength_bytes, extensionReader, err := reader.ReadUint16AndTruncate()
 		if err != nil {
-			return nil, 0, err
+			return hello, err
 		}
 
 		// Seek the main reader past the extension.
 		_, err = reader.Seek(int64(extensionContentLength_bytes), io.SeekCurrent)
 		if err != nil {
-			return nil, 0, err
+			return hello, err
 		}
 		switch extensionType {
 		// ServerName
@@ -159,6 +179,8 @@ func (parser *tlsClientHelloParser) parse(input memview.MemView) (result gnet.Pa
 			serverName, err := parser.parseServerNameExtension(extensionReader)
 			if err == nil {
 				hello.ServerName = serverName
+			} else {
+				logger.Debugf("ignoring malformed TLS server name extension: %v", err)
 			}
 		case alpnExtensionID:
 			hello.AlpnProtocols = parser.parseALPNExtension(extensionReader)
@@ -167,10 +189,16 @@ func (parser *tlsClientHelloParser) parse(input memview.MemView) (result gnet.Pa
 			hello.SupportedCurves = parser.parseSupportedCurves(extensionReader)
 		case supportedPointsExtensionID:
 			hello.SupportedPoints = parser.parseSupportedPoints(extensionReader)
+		case signatureAlgorithmsExtensionID:
+			hello.SignatureAlgorithms = parser.parseSignatureAlgorithms(extensionReader)
+		case supportedVersionsTLSExtensionID:
+			hello.SupportedVersions = parser.parseSupportedVersions(extensionReader)
+		case echExtensionID:
+			hello.ECHPresent = true
 		}
 	}
 
-	return hello, handshakeMsgEndPos, nil
+	return hello, nil
 }
 
 func (*tlsClientHelloParser) parseSupportedCurves(reader *memview.MemViewReader) []uint16 {
@@ -185,7 +213,46 @@ func (*tlsClientHelloParser) parseSupportedCurves(reader *memview.MemViewReader)
 		if err != nil {
 			return groups
 		}
-		groups = append(groups, g)
+		if !gnet.IsGREASE(g) {
+			groups = append(groups, g)
+		}
+	}
+}
+
+func (*tlsClientHelloParser) parseSignatureAlgorithms(reader *memview.MemViewReader) []uint16 {
+	_, reader, err := reader.ReadUint16AndTruncate()
+	if err != nil {
+		return nil
+	}
+
+	algorithms := make([]uint16, 0)
+	for {
+		a, err := reader.ReadUint16()
+		if err != nil {
+			return algorithms
+		}
+		if !gnet.IsGREASE(a) {
+			algorithms = append(algorithms, a)
+		}
+	}
+}
+
+// Unlike most lists, the client's supported versions have a one-byte length.
+func (*tlsClientHelloParser) parseSupportedVersions(reader *memview.MemViewReader) []uint16 {
+	_, reader, err := reader.ReadByteAndTruncate()
+	if err != nil {
+		return nil
+	}
+
+	versions := make([]uint16, 0)
+	for {
+		v, err := reader.ReadUint16()
+		if err != nil {
+			return versions
+		}
+		if !gnet.IsGREASE(v) {
+			versions = append(versions, v)
+		}
 	}
 }
 
@@ -8,11 +8,13 @@ import (
 )
 
 // Returns a parser factory for the client half of a TLS connection.
-func NewTLSClientParserFactory() gnet.TCPParserFactory {
-	return &tlsClientParserFactory{}
+func NewTLSClientParserFactory(opts ...Option) gnet.TCPParserFactory {
+	return &tlsClientParserFactory{opts: applyOptions(opts)}
 }
 
-type tlsClientParserFactory struct{}
+type tlsClientParserFactory struct {
+	opts Options
+}
 
 func (*tlsClientParserFactory) Name() string {
 	return "TLS Client Parser Factory"
@@ -73,6 +75,10 @@ func (*tlsClientParserFactory) accepts(input memview.MemView) (decision gnet.Acc
 	return gnet.Accept, 0
 }
 
+func (factory *tlsClientParserFactory) WithLogger(l gnet.Logger) gnet.TCPParserFactory {
+	return &tlsClientParserFactory{opts: Options{Logger: l}}
+}
+
 func (factory *tlsClientParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
-	return newTLSClientHelloParser(id)
+	return newTLSClientHelloParser(id, factory.opts.Logger)
 }
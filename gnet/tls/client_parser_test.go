@@ -0,0 +1,78 @@
+package tls
+
+import (
+	stdtls "crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestParseClientHello(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		stdtls.Client(client, &stdtls.Config{
+			ServerName: "example.com",
+			NextProtos: []string{"h2", "http/1.1"},
+		}).Handshake()
+		client.Close()
+	}()
+
+	header := make([]byte, tlsRecordHeaderLength_bytes)
+	_, err := io.ReadFull(server, header)
+	assert.NoError(t, err)
+	body := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	_, err = io.ReadFull(server, body)
+	assert.NoError(t, err)
+
+	hello, err := ParseClientHello(memview.New(body))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.com", hello.ServerName)
+		assert.Equal(t, []string{"h2", "http/1.1"}, hello.AlpnProtocols)
+		assert.Contains(t, hello.SupportedVersions, uint16(stdtls.VersionTLS13))
+		assert.NotEmpty(t, hello.SignatureAlgorithms)
+		assert.NotEmpty(t, hello.CipherSuites)
+	}
+}
+
+func TestParseClientHelloGREASEAndECH(t *testing.T) {
+	u16 := func(b []byte, v uint16) []byte { return append(b, byte(v>>8), byte(v)) }
+	extension := func(b []byte, id uint16, body []byte) []byte {
+		b = u16(b, id)
+		b = u16(b, uint16(len(body)))
+		return append(b, body...)
+	}
+
+	var extensions []byte
+	extensions = extension(extensions, 0x1a1a, nil)
+	extensions = extension(extensions, uint16(supportedCurvesExtensionID), []byte{0, 4, 0x2a, 0x2a, 0, 0x1d})
+	extensions = extension(extensions, uint16(supportedVersionsTLSExtensionID), []byte{4, 0x3a, 0x3a, 3, 4})
+	extensions = extension(extensions, uint16(echExtensionID), []byte{0})
+
+	body := u16(nil, 0x0303)
+	body = append(body, make([]byte, clientRandomLength_bytes)...)
+	body = append(body, 0)    // session ID
+	body = u16(body, 4)       // cipher suites
+	body = u16(body, 0x0a0a)  // GREASE
+	body = u16(body, 0x1301)  // TLS_AES_128_GCM_SHA256
+	body = append(body, 1, 0) // compression methods
+	body = u16(body, uint16(len(extensions)))
+	body = append(body, extensions...)
+
+	msg := []byte{0x01, 0, byte(len(body) >> 8), byte(len(body))}
+	msg = append(msg, body...)
+
+	hello, err := ParseClientHello(memview.New(msg))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []uint16{0x1301}, hello.CipherSuites)
+		assert.Equal(t, []uint16{uint16(supportedCurvesExtensionID), uint16(supportedVersionsTLSExtensionID), uint16(echExtensionID)}, hello.Extensions)
+		assert.Equal(t, []uint16{0x1d}, hello.SupportedCurves)
+		assert.Equal(t, []uint16{0x0304}, hello.SupportedVersions)
+		assert.True(t, hello.ECHPresent)
+	}
+}
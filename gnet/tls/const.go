@@ -47,6 +47,16 @@ const (
 	clientVersionLength_bytes   = 2
 	clientRandomLength_bytes    = 32
 
+	// Content type of handshake records.
+	handshakeRecordType = 0x16
+
+	// Each certificate, and the list of them, is preceded by a 3-byte length.
+	certificateLengthLength_bytes = 3
+
+	// Certificate messages larger than this are rejected rather than
+	// buffered. Real chains are a few KB.
+	maxCertificateMessageLength_bytes = 1024 * 1024
+
 	serverVersionLength_bytes           = 2
 	serverRandomLength_bytes            = 32
 	serverCiphersuiteLength_bytes       = 2
@@ -60,8 +70,10 @@ const (
 	serverNameExtensionID           tlsExtensionID = 0
 	supportedCurvesExtensionID      tlsExtensionID = 10
 	supportedPointsExtensionID      tlsExtensionID = 11
+	signatureAlgorithmsExtensionID  tlsExtensionID = 13
 	alpnExtensionID                 tlsExtensionID = 16
 	supportedVersionsTLSExtensionID tlsExtensionID = 0x00_2b
+	echExtensionID                  tlsExtensionID = 0xfe_0d
 )
 
 type sniType byte
@@ -0,0 +1,31 @@
+package tls
+
+import "github.com/mel2oo/go-pcap/gnet"
+
+type Options struct {
+	// Receives diagnostics, such as malformed extensions and certificates that
+	// are skipped.
+	Logger gnet.Logger
+}
+
+func NewOptions() Options {
+	return Options{
+		Logger: gnet.NopLogger,
+	}
+}
+
+type Option func(*Options)
+
+func WithLogger(l gnet.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+func applyOptions(opts []Option) Options {
+	o := NewOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,16 @@
+package tls
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("tls", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{
+			NewTLSClientParserFactory(),
+			NewTLSServerParserFactory(),
+			NewTLSCertificateParserFactory(),
+		}
+	}, gnet.FramedTCPParserPriority)
+}
@@ -134,11 +134,34 @@ func (parser *tlsServerHelloParser) parse(input memview.MemView) (result gnet.Pa
 		}
 		// append extensions
 		hello.Extensions = append(hello.Extensions, uint16(extensionType))
-		// seek extension
-		reader.ReadUint16AndSeek()
+
+		// The following two bytes give the extension's content length in bytes.
+		// Isolate the extension in its own reader.
+		extensionContentLength_bytes, extensionReader, err := reader.ReadUint16AndTruncate()
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// Seek the main reader past the extension.
+		_, err = reader.Seek(int64(extensionContentLength_bytes), io.SeekCurrent)
 		if err != nil {
 			return nil, 0, err
 		}
+
+		switch extensionType {
+		case supportedVersionsTLSExtensionID:
+			// The server selects a single version.
+			if v, err := extensionReader.ReadUint16(); err == nil {
+				hello.SelectedVersion = gnet.TLSVersion(v)
+			}
+		case alpnExtensionID:
+			// The server selects a single protocol from the client's list.
+			if _, listReader, err := extensionReader.ReadUint16AndTruncate(); err == nil {
+				if protocol, err := listReader.ReadString_byte(); err == nil {
+					hello.SelectedProtocol = protocol
+				}
+			}
+		}
 	}
 
 	return hello, handshakeMsgEndPos, nil
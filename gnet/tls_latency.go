@@ -0,0 +1,275 @@
+package gnet
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default time to wait for the first application data of a TLS connection.
+const DefaultTLSLatencyTimeout = 30 * time.Second
+
+// The most packets starting with records of interest kept per direction of a
+// connection, enough to get past the end of the handshake.
+const maxLatencyPackets = 8
+
+// Represents latencies of a TLS connection, measured from the time its Client
+// Hello was seen. See TLSLatencyTracker.
+type ConnectionLatency struct {
+	ConnectionID uuid.UUID
+
+	// Time from the first to the last handshake message observed, as in
+	// TLSHandshakeMetadata.
+	Handshake time.Duration
+
+	// Time from the Client Hello to the first application data record sent by
+	// the client, and by the server. 0 if none was seen.
+	ClientApplicationData time.Duration
+	ServerApplicationData time.Duration
+}
+
+var _ ParsedNetworkContent = ConnectionLatency{}
+
+func (ConnectionLatency) ReleaseBuffers() {}
+
+// TLSLatencyTracker measures the latency of TLS connections whose
+// TLSHandshakeMetadata reports that it can be measured, and adds a NetTraffic
+// carrying their ConnectionLatency to the traffic. It must see the output of a
+// TLSConnectionTracker, and the TCPPacketMetadata of each packet, which tell
+// the type of the TLS record that the packet starts with.
+//
+// Packets are taken to carry application data if they start with an
+// application data record, except in TLS 1.3, where handshake messages are
+// also carried in such records: there, the client's application data follows
+// its Finished message, and the server's follows the client's Finished.
+//
+// A latency is emitted once application data was seen in both directions, or
+// when the connection is closed, times out, or on Flush. As with
+// TLSConnectionTracker, timeouts are measured against observation times in
+// the traffic.
+type TLSLatencyTracker struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*list.Element
+	order   *list.List // of *pendingLatency, oldest first
+}
+
+type pendingLatency struct {
+	// The Client Hello, whose endpoints and observation time are used for the
+	// result.
+	hello NetTraffic
+
+	// Nil until the handshake is complete.
+	metadata *TLSHandshakeMetadata
+
+	// Packets sent by the client and the server after the Client Hello that
+	// start with change cipher spec or application data records.
+	client, server []recordPacket
+
+	end time.Time
+}
+
+type recordPacket struct {
+	time       time.Time
+	recordType TLSRecordType
+}
+
+// Creates a TLSLatencyTracker that gives up waiting for application data after
+// timeout. If timeout is not positive, DefaultTLSLatencyTimeout is used.
+func NewTLSLatencyTracker(timeout time.Duration) *TLSLatencyTracker {
+	if timeout <= 0 {
+		timeout = DefaultTLSLatencyTimeout
+	}
+	return &TLSLatencyTracker{
+		timeout: timeout,
+		pending: map[uuid.UUID]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Run passes through all traffic from in, adding a NetTraffic carrying a
+// ConnectionLatency once the latency of each measurable connection is known.
+// Connections still pending are emitted when in is closed.
+func (c *TLSLatencyTracker) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, 100)
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range c.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range c.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe processes a single piece of traffic and returns the traffic that is
+// ready to be emitted as a result, starting with t itself.
+func (c *TLSLatencyTracker) Observe(t NetTraffic) []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := append(c.expire(t.ObservationTime), t)
+
+	switch content := t.Content.(type) {
+	case TLSClientHello:
+		if _, ok := c.pending[t.ConnectionID]; !ok {
+			c.pending[t.ConnectionID] = c.order.PushBack(&pendingLatency{hello: t, end: t.ObservationTime})
+		}
+		return results
+	case TLSHandshakeMetadata:
+		elem, ok := c.pending[t.ConnectionID]
+		if !ok {
+			return results
+		}
+		if !content.ApplicationLatencyMeasurable() {
+			c.remove(elem)
+			return results
+		}
+		elem.Value.(*pendingLatency).metadata = &content
+	case TCPPacketMetadata:
+		elem, ok := c.pending[t.ConnectionID]
+		if !ok {
+			return results
+		}
+		if content.FIN || content.RST {
+			return append(results, c.evict(elem)...)
+		}
+		p := elem.Value.(*pendingLatency)
+		if !t.ObservationTime.Before(p.hello.ObservationTime) {
+			p.observe(t, content.TLSRecordType)
+		}
+	case TCPConnectionMetadata:
+		if elem, ok := c.pending[t.ConnectionID]; ok {
+			return append(results, c.evict(elem)...)
+		}
+		return results
+	default:
+		return results
+	}
+
+	elem := c.pending[t.ConnectionID]
+	p := elem.Value.(*pendingLatency)
+	if l := p.latency(); p.metadata != nil && l.ClientApplicationData > 0 && l.ServerApplicationData > 0 {
+		return append(results, c.evict(elem)...)
+	}
+	return results
+}
+
+// Flush returns the latencies of all pending measurable connections.
+func (c *TLSLatencyTracker) Flush() []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		results = append(results, c.evict(c.order.Front())...)
+	}
+	return results
+}
+
+// Evicts connections that have been pending longer than the timeout as of
+// now.
+func (c *TLSLatencyTracker) expire(now time.Time) []NetTraffic {
+	if now.IsZero() {
+		return nil
+	}
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		if now.Sub(front.Value.(*pendingLatency).hello.ObservationTime) < c.timeout {
+			break
+		}
+		results = append(results, c.evict(front)...)
+	}
+	return results
+}
+
+func (c *TLSLatencyTracker) remove(elem *list.Element) *pendingLatency {
+	p := c.order.Remove(elem).(*pendingLatency)
+	delete(c.pending, p.hello.ConnectionID)
+	return p
+}
+
+// Removes a pending connection and returns its latency, oriented from client
+// to server, if its handshake completed and was measurable.
+func (c *TLSLatencyTracker) evict(elem *list.Element) []NetTraffic {
+	p := c.remove(elem)
+	if p.metadata == nil {
+		return nil
+	}
+
+	result := p.hello
+	result.FinalPacketTime = p.end
+	result.Payload = nil
+	result.Content = p.latency()
+	return []NetTraffic{result}
+}
+
+func (p *pendingLatency) observe(t NetTraffic, recordType TLSRecordType) {
+	if recordType != TLSChangeCipherSpecRecord && recordType != TLSApplicationDataRecord {
+		return
+	}
+	packet := recordPacket{time: t.ObservationTime, recordType: recordType}
+	if t.SrcPort == p.hello.SrcPort && t.SrcIP.Equal(p.hello.SrcIP) {
+		if len(p.client) < maxLatencyPackets {
+			p.client = append(p.client, packet)
+		}
+	} else if len(p.server) < maxLatencyPackets {
+		p.server = append(p.server, packet)
+	}
+	if t.ObservationTime.After(p.end) {
+		p.end = t.ObservationTime
+	}
+}
+
+// Returns the latency of the connection, as far as it is known.
+func (p *pendingLatency) latency() ConnectionLatency {
+	l := ConnectionLatency{ConnectionID: p.hello.ConnectionID}
+	start := p.hello.ObservationTime
+	if p.metadata != nil {
+		l.Handshake = p.metadata.Duration
+	}
+
+	if p.metadata == nil || p.metadata.Version != TLSV1_3 {
+		if t, ok := firstApplicationData(p.client, time.Time{}); ok {
+			l.ClientApplicationData = t.Sub(start)
+		}
+		if t, ok := firstApplicationData(p.server, time.Time{}); ok {
+			l.ServerApplicationData = t.Sub(start)
+		}
+		return l
+	}
+
+	// The client's Finished message comes in its first packet starting with
+	// either record type, after its change cipher spec if it sends one.
+	if len(p.client) == 0 {
+		return l
+	}
+	finished := p.client[0].time
+	if t, ok := firstApplicationData(p.client[1:], time.Time{}); ok {
+		l.ClientApplicationData = t.Sub(start)
+	}
+	if t, ok := firstApplicationData(p.server, finished); ok {
+		l.ServerApplicationData = t.Sub(start)
+	}
+	return l
+}
+
+// Returns the time of the first of packets sent after since that starts with
+// an application data record.
+func firstApplicationData(packets []recordPacket, since time.Time) (time.Time, bool) {
+	for _, p := range packets {
+		if p.recordType == TLSApplicationDataRecord && p.time.After(since) {
+			return p.time, true
+		}
+	}
+	return time.Time{}, false
+}
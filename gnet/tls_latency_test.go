@@ -0,0 +1,101 @@
+package gnet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSRecordTypeOf(t *testing.T) {
+	assert.Equal(t, TLSApplicationDataRecord, TLSRecordTypeOf([]byte{23, 3, 3, 0, 32}))
+	assert.Equal(t, TLSHandshakeRecord, TLSRecordTypeOf([]byte{22, 3, 1, 2, 0, 1}))
+	assert.Equal(t, TLSRecordType(0), TLSRecordTypeOf([]byte("GET / HTTP/1.1\r\n")))
+	assert.Equal(t, TLSRecordType(0), TLSRecordTypeOf([]byte{23, 3, 3}))
+}
+
+func TestTLSLatencyTracker(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+
+	handshakes := NewTLSConnectionTracker(time.Second)
+	c := NewTLSLatencyTracker(time.Minute)
+	var latencies []ConnectionLatency
+	observe := func(t NetTraffic) {
+		for _, r := range handshakes.Observe(t) {
+			for _, l := range c.Observe(r) {
+				if latency, ok := l.Content.(ConnectionLatency); ok {
+					latencies = append(latencies, latency)
+				}
+			}
+		}
+	}
+
+	toServer := func(conn uuid.UUID, at time.Duration, content ParsedNetworkContent) NetTraffic {
+		return NetTraffic{
+			SrcIP: client, SrcPort: 40000, DstIP: server, DstPort: 443,
+			ConnectionID:    conn,
+			Content:         content,
+			ObservationTime: start.Add(at),
+			FinalPacketTime: start.Add(at),
+		}
+	}
+	toClient := func(conn uuid.UUID, at time.Duration, content ParsedNetworkContent) NetTraffic {
+		t := toServer(conn, at, content)
+		t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+		t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+		return t
+	}
+	packet := func(recordType TLSRecordType) TCPPacketMetadata {
+		return TCPPacketMetadata{ACK: true, PayloadLength: 100, TLSRecordType: recordType}
+	}
+
+	tls12 := uuid.New()
+	observe(toServer(tls12, 0, TLSClientHello{ConnectionID: tls12, AlpnProtocols: []string{"http/1.1"}}))
+	observe(toClient(tls12, 30*time.Millisecond, TLSServerHello{ConnectionID: tls12, Version: TLSV1_2}))
+	observe(toClient(tls12, 40*time.Millisecond, TLSCertificate{ConnectionID: tls12}))
+	observe(toServer(tls12, 50*time.Millisecond, packet(TLSChangeCipherSpecRecord)))
+	observe(toClient(tls12, 60*time.Millisecond, packet(TLSChangeCipherSpecRecord)))
+	observe(toServer(tls12, 70*time.Millisecond, packet(TLSApplicationDataRecord)))
+	assert.Empty(t, latencies)
+	observe(toClient(tls12, 100*time.Millisecond, packet(TLSApplicationDataRecord)))
+	assert.Equal(t, []ConnectionLatency{{
+		ConnectionID:          tls12,
+		Handshake:             40 * time.Millisecond,
+		ClientApplicationData: 70 * time.Millisecond,
+		ServerApplicationData: 100 * time.Millisecond,
+	}}, latencies)
+
+	// In TLS 1.3, the server's encrypted handshake messages and the client's
+	// Finished message are not application data.
+	latencies = nil
+	tls13 := uuid.New()
+	observe(toServer(tls13, 0, TLSClientHello{ConnectionID: tls13, AlpnProtocols: []string{"http/1.1"}}))
+	observe(toClient(tls13, 20*time.Millisecond, TLSServerHello{ConnectionID: tls13, Version: TLSV1_2, SelectedVersion: TLSV1_3}))
+	observe(toClient(tls13, 20*time.Millisecond, packet(TLSHandshakeRecord)))
+	observe(toClient(tls13, 25*time.Millisecond, packet(TLSApplicationDataRecord)))
+	observe(toServer(tls13, 40*time.Millisecond, packet(TLSChangeCipherSpecRecord)))
+	observe(toServer(tls13, 45*time.Millisecond, packet(TLSApplicationDataRecord)))
+	observe(toClient(tls13, 80*time.Millisecond, packet(TLSApplicationDataRecord)))
+	assert.Equal(t, []ConnectionLatency{{
+		ConnectionID:          tls13,
+		Handshake:             20 * time.Millisecond,
+		ClientApplicationData: 45 * time.Millisecond,
+		ServerApplicationData: 80 * time.Millisecond,
+	}}, latencies)
+
+	// Connections that are not measurable are dropped, and those that close
+	// early report what was seen.
+	latencies = nil
+	h2, closed := uuid.New(), uuid.New()
+	observe(toServer(h2, 0, TLSClientHello{ConnectionID: h2, AlpnProtocols: []string{"h2"}}))
+	observe(toClient(h2, 20*time.Millisecond, TLSServerHello{ConnectionID: h2, Version: TLSV1_2, SelectedVersion: TLSV1_3}))
+	observe(toServer(closed, 0, TLSClientHello{ConnectionID: closed, AlpnProtocols: []string{"http/1.1"}}))
+	observe(toClient(closed, 20*time.Millisecond, TLSServerHello{ConnectionID: closed, Version: TLSV1_2, SelectedVersion: TLSV1_3}))
+	observe(toServer(closed, 30*time.Millisecond, packet(TLSApplicationDataRecord)))
+	observe(toServer(closed, 40*time.Millisecond, TCPPacketMetadata{FIN: true}))
+	assert.Equal(t, []ConnectionLatency{{ConnectionID: closed, Handshake: 20 * time.Millisecond}}, latencies)
+	assert.Empty(t, c.Flush())
+}
@@ -0,0 +1,184 @@
+package gnet
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default time to wait for the rest of a TLS handshake.
+const DefaultTLSHandshakeTimeout = 10 * time.Second
+
+// TLSConnectionTracker assembles the Client Hello, Server Hello and
+// Certificate messages of each connection into a single TLSHandshakeMetadata.
+//
+// A handshake is emitted once both Hellos have been seen and, for versions
+// before TLS 1.3, the server's certificate. Handshakes that never get that
+// far, such as resumed TLS 1.2 sessions, are emitted when their connection is
+// closed, when they time out, or on Flush. As with PairCollector, timeouts are
+// measured against observation times in the traffic.
+type TLSConnectionTracker struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*list.Element
+	order   *list.List // of *pendingHandshake, oldest first
+}
+
+type pendingHandshake struct {
+	metadata TLSHandshakeMetadata
+
+	// The first message seen, whose endpoints and observation time are used
+	// for the result.
+	first NetTraffic
+
+	// Whether first was sent by the client.
+	firstFromClient bool
+
+	end time.Time
+}
+
+// Creates a TLSConnectionTracker that gives up waiting for the rest of a
+// handshake after timeout. If timeout is not positive,
+// DefaultTLSHandshakeTimeout is used.
+func NewTLSConnectionTracker(timeout time.Duration) *TLSConnectionTracker {
+	if timeout <= 0 {
+		timeout = DefaultTLSHandshakeTimeout
+	}
+	return &TLSConnectionTracker{
+		timeout: timeout,
+		pending: map[uuid.UUID]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Run passes through all traffic from in, adding a NetTraffic carrying a
+// TLSHandshakeMetadata after the message that completes each handshake.
+// Incomplete handshakes are emitted once they time out, or when in is closed.
+func (c *TLSConnectionTracker) Run(in <-chan NetTraffic) <-chan NetTraffic {
+	out := make(chan NetTraffic, 100)
+	go func() {
+		defer close(out)
+		for t := range in {
+			for _, r := range c.Observe(t) {
+				out <- r
+			}
+		}
+		for _, r := range c.Flush() {
+			out <- r
+		}
+	}()
+	return out
+}
+
+// Observe processes a single piece of traffic and returns the traffic that is
+// ready to be emitted as a result, starting with t itself.
+func (c *TLSConnectionTracker) Observe(t NetTraffic) []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := append(c.expire(t.ObservationTime), t)
+
+	var err error
+	switch content := t.Content.(type) {
+	case TLSClientHello:
+		err = c.handshake(t, true).metadata.AddClientHello(&content)
+	case TLSServerHello:
+		err = c.handshake(t, false).metadata.AddServerHello(&content)
+	case TLSCertificate:
+		err = c.handshake(t, false).metadata.AddCertificate(&content)
+	case TCPPacketMetadata:
+		if content.FIN || content.RST {
+			if elem, ok := c.pending[t.ConnectionID]; ok {
+				results = append(results, c.evict(elem))
+			}
+		}
+		return results
+	default:
+		return results
+	}
+	if err != nil {
+		// A repeated message; keep the first.
+		return results
+	}
+
+	elem := c.pending[t.ConnectionID]
+	h := elem.Value.(*pendingHandshake)
+	if !t.FinalPacketTime.IsZero() && t.FinalPacketTime.After(h.end) {
+		h.end = t.FinalPacketTime
+	} else if t.ObservationTime.After(h.end) {
+		h.end = t.ObservationTime
+	}
+
+	m := &h.metadata
+	if m.HandshakeComplete() && (m.Version == TLSV1_3 || m.certificateSeen) {
+		results = append(results, c.evict(elem))
+	}
+	return results
+}
+
+// Flush returns all incomplete handshakes.
+func (c *TLSConnectionTracker) Flush() []NetTraffic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		results = append(results, c.evict(c.order.Front()))
+	}
+	return results
+}
+
+// Returns the pending handshake for t's connection, creating it if needed.
+func (c *TLSConnectionTracker) handshake(t NetTraffic, fromClient bool) *pendingHandshake {
+	if elem, ok := c.pending[t.ConnectionID]; ok {
+		return elem.Value.(*pendingHandshake)
+	}
+
+	h := &pendingHandshake{
+		metadata:        TLSHandshakeMetadata{ConnectionID: t.ConnectionID},
+		first:           t,
+		firstFromClient: fromClient,
+		end:             t.ObservationTime,
+	}
+	c.pending[t.ConnectionID] = c.order.PushBack(h)
+	return h
+}
+
+// Evicts handshakes that have been pending longer than the timeout as of now.
+func (c *TLSConnectionTracker) expire(now time.Time) []NetTraffic {
+	if now.IsZero() {
+		return nil
+	}
+
+	var results []NetTraffic
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		if now.Sub(front.Value.(*pendingHandshake).first.ObservationTime) < c.timeout {
+			break
+		}
+		results = append(results, c.evict(front))
+	}
+	return results
+}
+
+// Removes a pending handshake and returns it as traffic oriented from client
+// to server.
+func (c *TLSConnectionTracker) evict(elem *list.Element) NetTraffic {
+	h := c.order.Remove(elem).(*pendingHandshake)
+	delete(c.pending, h.metadata.ConnectionID)
+
+	h.metadata.Duration = h.end.Sub(h.first.ObservationTime)
+
+	result := h.first
+	if !h.firstFromClient {
+		result.SrcIP, result.DstIP = h.first.DstIP, h.first.SrcIP
+		result.SrcPort, result.DstPort = h.first.DstPort, h.first.SrcPort
+	}
+	result.FinalPacketTime = h.end
+	result.Payload = nil
+	result.Content = h.metadata
+	return result
+}
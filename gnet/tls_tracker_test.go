@@ -0,0 +1,114 @@
+package gnet
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLSConnectionTracker(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, server := net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}
+	tls12, tls13 := uuid.New(), uuid.New()
+
+	c := NewTLSConnectionTracker(time.Second)
+
+	toServer := func(conn uuid.UUID, at time.Duration, content ParsedNetworkContent) NetTraffic {
+		return NetTraffic{
+			SrcIP: client, SrcPort: 40000, DstIP: server, DstPort: 443,
+			ConnectionID:    conn,
+			Content:         content,
+			ObservationTime: start.Add(at),
+			FinalPacketTime: start.Add(at),
+		}
+	}
+	toClient := func(conn uuid.UUID, at time.Duration, content ParsedNetworkContent) NetTraffic {
+		t := toServer(conn, at, content)
+		t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+		t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+		return t
+	}
+
+	// TLS 1.2 waits for the certificate.
+	assert.Len(t, c.Observe(toServer(tls12, 0, TLSClientHello{
+		ConnectionID:  tls12,
+		ServerName:    "example.com",
+		AlpnProtocols: []string{"h2", "http/1.1"},
+	})), 1)
+	assert.Len(t, c.Observe(toClient(tls12, 30*time.Millisecond, TLSServerHello{
+		ConnectionID:     tls12,
+		Version:          TLSV1_2,
+		CipherSuite:      0xc02f,
+		SelectedProtocol: "h2",
+	})), 1)
+	results := c.Observe(toClient(tls12, 40*time.Millisecond, TLSCertificate{
+		ConnectionID: tls12,
+		Certificates: []*x509.Certificate{{
+			DNSNames:    []string{"example.com", "www.example.com"},
+			IPAddresses: []net.IP{server},
+		}},
+	}))
+	if assert.Len(t, results, 2) {
+		m := results[1].Content.(TLSHandshakeMetadata)
+		assert.Equal(t, TLSV1_2, m.Version)
+		assert.Equal(t, "example.com", *m.SNIHostname)
+		assert.Equal(t, []string{"h2", "http/1.1"}, m.SupportedProtocols)
+		assert.Equal(t, "h2", *m.SelectedProtocol)
+		assert.Equal(t, uint16(0xc02f), m.CipherSuite)
+		assert.Equal(t, []string{"example.com", "www.example.com", "10.0.0.2"}, m.SubjectAlternativeNames)
+		assert.Equal(t, 40*time.Millisecond, m.Duration)
+		assert.True(t, results[1].SrcIP.Equal(client))
+	}
+
+	// TLS 1.3 is complete after the Server Hello.
+	c.Observe(toServer(tls13, 0, TLSClientHello{ConnectionID: tls13}))
+	results = c.Observe(toClient(tls13, 20*time.Millisecond, TLSServerHello{
+		ConnectionID:    tls13,
+		Version:         TLSV1_2,
+		SelectedVersion: TLSV1_3,
+		CipherSuite:     0x1301,
+	}))
+	if assert.Len(t, results, 2) {
+		m := results[1].Content.(TLSHandshakeMetadata)
+		assert.Equal(t, TLSV1_3, m.Version)
+		assert.Equal(t, 20*time.Millisecond, m.Duration)
+	}
+}
+
+func TestTLSConnectionTrackerIncomplete(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	closed, timedOut := uuid.New(), uuid.New()
+
+	c := NewTLSConnectionTracker(time.Second)
+	c.Observe(NetTraffic{
+		ConnectionID:    closed,
+		Content:         TLSClientHello{ConnectionID: closed},
+		ObservationTime: start,
+	})
+	c.Observe(NetTraffic{
+		ConnectionID:    timedOut,
+		Content:         TLSServerHello{ConnectionID: timedOut},
+		ObservationTime: start,
+	})
+
+	results := c.Observe(NetTraffic{
+		ConnectionID:    closed,
+		Content:         TCPPacketMetadata{FIN: true},
+		ObservationTime: start.Add(time.Millisecond),
+	})
+	if assert.Len(t, results, 2) {
+		m := results[1].Content.(TLSHandshakeMetadata)
+		assert.Equal(t, closed, m.ConnectionID)
+		assert.False(t, m.HandshakeComplete())
+	}
+
+	results = c.Observe(NetTraffic{ObservationTime: start.Add(2 * time.Second)})
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, timedOut, results[0].Content.(TLSHandshakeMetadata).ConnectionID)
+	}
+	assert.Empty(t, c.Flush())
+}
@@ -0,0 +1,265 @@
+package tlsdecrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+
+	"github.com/pkg/errors"
+)
+
+// Parameters of a supported cipher suite. Only AES suites are supported;
+// ChaCha20-Poly1305 is not in the standard library.
+type cipherSuite struct {
+	keyLength int
+
+	// The hash of the PRF in TLS 1.2, or of HKDF in TLS 1.3.
+	hash func() hash.Hash
+
+	// TLS 1.2 suites use either AES-GCM or AES-CBC with an HMAC of this
+	// length.
+	gcm       bool
+	macLength int
+
+	tls13 bool
+}
+
+var cipherSuites = map[uint16]cipherSuite{
+	// TLS 1.3
+	0x1301: {keyLength: 16, hash: sha256.New, tls13: true},    // TLS_AES_128_GCM_SHA256
+	0x1302: {keyLength: 32, hash: sha512.New384, tls13: true}, // TLS_AES_256_GCM_SHA384
+
+	// TLS 1.2 AES-GCM
+	0x009c: {keyLength: 16, hash: sha256.New, gcm: true},    // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009d: {keyLength: 32, hash: sha512.New384, gcm: true}, // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0x009e: {keyLength: 16, hash: sha256.New, gcm: true},    // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009f: {keyLength: 32, hash: sha512.New384, gcm: true}, // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	0xc02b: {keyLength: 16, hash: sha256.New, gcm: true},    // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xc02c: {keyLength: 32, hash: sha512.New384, gcm: true}, // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xc02f: {keyLength: 16, hash: sha256.New, gcm: true},    // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xc030: {keyLength: 32, hash: sha512.New384, gcm: true}, // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+
+	// TLS 1.2 AES-CBC
+	0x002f: {keyLength: 16, hash: sha256.New, macLength: sha1.Size},         // TLS_RSA_WITH_AES_128_CBC_SHA
+	0x0035: {keyLength: 32, hash: sha256.New, macLength: sha1.Size},         // TLS_RSA_WITH_AES_256_CBC_SHA
+	0x003c: {keyLength: 16, hash: sha256.New, macLength: sha256.Size},       // TLS_RSA_WITH_AES_128_CBC_SHA256
+	0x003d: {keyLength: 32, hash: sha256.New, macLength: sha256.Size},       // TLS_RSA_WITH_AES_256_CBC_SHA256
+	0xc009: {keyLength: 16, hash: sha256.New, macLength: sha1.Size},         // TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA
+	0xc00a: {keyLength: 32, hash: sha256.New, macLength: sha1.Size},         // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA
+	0xc013: {keyLength: 16, hash: sha256.New, macLength: sha1.Size},         // TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA
+	0xc014: {keyLength: 32, hash: sha256.New, macLength: sha1.Size},         // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA
+	0xc023: {keyLength: 16, hash: sha256.New, macLength: sha256.Size},       // TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256
+	0xc024: {keyLength: 32, hash: sha512.New384, macLength: sha512.Size384}, // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384
+	0xc027: {keyLength: 16, hash: sha256.New, macLength: sha256.Size},       // TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256
+	0xc028: {keyLength: 32, hash: sha512.New384, macLength: sha512.Size384}, // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384
+}
+
+const (
+	// The implicit part of the nonce in TLS 1.2 AES-GCM, and the explicit part
+	// carried at the start of each record.
+	gcmFixedIVLength_bytes    = 4
+	gcmExplicitIVLength_bytes = 8
+
+	tls13IVLength_bytes = 12
+)
+
+// Decrypts the records sent in one direction of a connection.
+type recordCipher interface {
+	// Decrypts the fragment of the record with the given sequence number and
+	// header, returning its content type and plaintext.
+	open(seq uint64, header, fragment []byte) (contentType byte, plaintext []byte, err error)
+}
+
+// Derives the client and server record ciphers for a TLS 1.2 connection
+// (RFC 5246 Section 6.3).
+func newTLS12Ciphers(suite cipherSuite, masterSecret, clientRandom, serverRandom []byte) (client, server recordCipher, err error) {
+	ivLength := 0
+	if suite.gcm {
+		ivLength = gcmFixedIVLength_bytes
+	}
+	seed := append(append([]byte(nil), serverRandom...), clientRandom...)
+	keyBlock := prf12(suite.hash, masterSecret, "key expansion", seed, 2*(suite.macLength+suite.keyLength+ivLength))
+
+	// The MAC keys come first, and are not needed to decrypt.
+	keyBlock = keyBlock[2*suite.macLength:]
+	clientKey, keyBlock := keyBlock[:suite.keyLength], keyBlock[suite.keyLength:]
+	serverKey, keyBlock := keyBlock[:suite.keyLength], keyBlock[suite.keyLength:]
+	clientIV, serverIV := keyBlock[:ivLength], keyBlock[ivLength:]
+
+	if suite.gcm {
+		if client, err = newTLS12GCM(clientKey, clientIV); err != nil {
+			return nil, nil, err
+		}
+		server, err = newTLS12GCM(serverKey, serverIV)
+		return client, server, err
+	}
+
+	if client, err = newTLS12CBC(clientKey, suite.macLength); err != nil {
+		return nil, nil, err
+	}
+	server, err = newTLS12CBC(serverKey, suite.macLength)
+	return client, server, err
+}
+
+type tls12GCM struct {
+	aead    cipher.AEAD
+	fixedIV []byte
+}
+
+func newTLS12GCM(key, fixedIV []byte) (*tls12GCM, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls12GCM{aead: aead, fixedIV: fixedIV}, nil
+}
+
+func (c *tls12GCM) open(seq uint64, header, fragment []byte) (byte, []byte, error) {
+	if len(fragment) < gcmExplicitIVLength_bytes+c.aead.Overhead() {
+		return 0, nil, errors.New("record too short")
+	}
+	nonce := append(append([]byte(nil), c.fixedIV...), fragment[:gcmExplicitIVLength_bytes]...)
+	ciphertext := fragment[gcmExplicitIVLength_bytes:]
+
+	// Sequence number, type, version and plaintext length.
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, seq)
+	copy(ad[8:], header[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(ciphertext)-c.aead.Overhead()))
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to decrypt record")
+	}
+	return header[0], plaintext, nil
+}
+
+// AES-CBC with MAC-then-encrypt. The MAC is removed but not verified.
+type tls12CBC struct {
+	block     cipher.Block
+	macLength int
+}
+
+func newTLS12CBC(key []byte, macLength int) (*tls12CBC, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create record cipher")
+	}
+	return &tls12CBC{block: block, macLength: macLength}, nil
+}
+
+func (c *tls12CBC) open(_ uint64, header, fragment []byte) (byte, []byte, error) {
+	// Each record starts with an explicit IV.
+	if len(fragment)%aes.BlockSize != 0 || len(fragment) < 2*aes.BlockSize {
+		return 0, nil, errors.New("malformed CBC record")
+	}
+	plaintext := make([]byte, len(fragment)-aes.BlockSize)
+	cipher.NewCBCDecrypter(c.block, fragment[:aes.BlockSize]).CryptBlocks(plaintext, fragment[aes.BlockSize:])
+
+	padding := int(plaintext[len(plaintext)-1]) + 1
+	if padding+c.macLength > len(plaintext) {
+		return 0, nil, errors.New("invalid CBC padding")
+	}
+	return header[0], plaintext[:len(plaintext)-padding-c.macLength], nil
+}
+
+// Record protection from RFC 8446 Section 5.2.
+type tls13AEAD struct {
+	aead cipher.AEAD
+	iv   []byte
+}
+
+// Derives the record cipher for a TLS 1.3 traffic secret (RFC 8446 Section
+// 7.3).
+func newTLS13Cipher(suite cipherSuite, secret []byte) (*tls13AEAD, error) {
+	aead, err := newGCM(hkdfExpandLabel(suite.hash, secret, "key", suite.keyLength))
+	if err != nil {
+		return nil, err
+	}
+	return &tls13AEAD{
+		aead: aead,
+		iv:   hkdfExpandLabel(suite.hash, secret, "iv", tls13IVLength_bytes),
+	}, nil
+}
+
+func (c *tls13AEAD) open(seq uint64, header, fragment []byte) (byte, []byte, error) {
+	nonce := append([]byte(nil), c.iv...)
+	var seqBytes [8]byte
+	binary.BigEndian.PutUint64(seqBytes[:], seq)
+	for i, b := range seqBytes {
+		nonce[len(nonce)-len(seqBytes)+i] ^= b
+	}
+
+	plaintext, err := c.aead.Open(nil, nonce, fragment, header)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "failed to decrypt record")
+	}
+
+	// The real content type follows the content, which may be padded with
+	// zeros.
+	i := len(plaintext) - 1
+	for i >= 0 && plaintext[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return 0, nil, errors.New("record has no content type")
+	}
+	return plaintext[i], plaintext[:i], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create record cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create record cipher")
+	}
+	return aead, nil
+}
+
+// The TLS 1.2 PRF from RFC 5246 Section 5.
+func prf12(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	labelAndSeed := append([]byte(label), seed...)
+
+	out := make([]byte, 0, length)
+	a := labelAndSeed
+	for len(out) < length {
+		mac := hmac.New(h, secret)
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac = hmac.New(h, secret)
+		mac.Write(a)
+		mac.Write(labelAndSeed)
+		out = mac.Sum(out)
+	}
+	return out[:length]
+}
+
+// HKDF-Expand-Label from RFC 8446 Section 7.1, with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 4+len(fullLabel))
+	info = append(info, byte(length>>8), byte(length), byte(len(fullLabel)))
+	info = append(info, fullLabel...)
+	info = append(info, 0)
+
+	// HKDF-Expand from RFC 5869.
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(h, secret)
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
@@ -0,0 +1,116 @@
+package tlsdecrypt
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Labels of the NSS key log lines used for decryption. See
+// https://firefox-source-docs.mozilla.org/security/nss/legacy/key_log_format/
+const (
+	// The TLS 1.2 master secret.
+	clientRandomLabel = "CLIENT_RANDOM"
+
+	// TLS 1.3 traffic secrets.
+	clientHandshakeLabel   = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	serverHandshakeLabel   = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	clientApplicationLabel = "CLIENT_TRAFFIC_SECRET_0"
+	serverApplicationLabel = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// Length of the random value in Client and Server Hellos, which key log
+// lines are indexed by.
+const randomLength_bytes = 32
+
+// KeyLog holds TLS secrets in the NSS key log format written by browsers and
+// TLS libraries when the SSLKEYLOGFILE environment variable is set.
+//
+// Safe for concurrent use, so that secrets can be added while a live capture
+// is being decrypted.
+type KeyLog struct {
+	mu      sync.RWMutex
+	secrets map[string][]byte
+}
+
+func NewKeyLog() *KeyLog {
+	return &KeyLog{
+		secrets: map[string][]byte{},
+	}
+}
+
+// Reads a key log from a file.
+func LoadKeyLogFile(path string) (*KeyLog, error) {
+	k := NewKeyLog()
+	if err := k.LoadFile(path); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Adds the secrets in a key log file.
+func (k *KeyLog) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open key log %s", path)
+	}
+	defer f.Close()
+
+	if err := k.Load(f); err != nil {
+		return errors.Wrapf(err, "failed to read key log %s", path)
+	}
+	return nil
+}
+
+// Adds the secrets read from r. Comments, blank lines, malformed lines and
+// lines with labels that are not used for decryption are skipped.
+func (k *KeyLog) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		clientRandom, err := hex.DecodeString(fields[1])
+		if err != nil || len(clientRandom) != randomLength_bytes {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+		k.Add(fields[0], clientRandom, secret)
+	}
+	return scanner.Err()
+}
+
+// Adds a secret for the connection with the given client random.
+func (k *KeyLog) Add(label string, clientRandom, secret []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.secrets[keyLogKey(label, clientRandom)] = append([]byte(nil), secret...)
+}
+
+// Returns the secret with the given label for the connection with the given
+// client random, or nil if it is not known.
+func (k *KeyLog) Secret(label string, clientRandom []byte) []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.secrets[keyLogKey(label, clientRandom)]
+}
+
+// Returns the number of secrets held.
+func (k *KeyLog) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.secrets)
+}
+
+func keyLogKey(label string, clientRandom []byte) string {
+	return label + " " + string(clientRandom)
+}
@@ -0,0 +1,351 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TLS record content types.
+const (
+	recordChangeCipherSpec = 20
+	recordHandshake        = 22
+	recordApplicationData  = 23
+)
+
+// TLS handshake message types.
+const (
+	handshakeClientHello = 1
+	handshakeServerHello = 2
+	handshakeFinished    = 20
+	handshakeKeyUpdate   = 24
+)
+
+const (
+	recordHeaderLength_bytes    = 5
+	handshakeHeaderLength_bytes = 4
+
+	// Largest valid record fragment: 2^14 bytes of plaintext plus the
+	// expansion allowed by RFC 5246 Section 6.2.3.
+	maxRecordLength_bytes = 1<<14 + 2048
+
+	tls13Version = 0x0304
+
+	supportedVersionsExtensionID = 43
+)
+
+// The random value of a Server Hello that is actually a HelloRetryRequest
+// (RFC 8446 Section 4.1.3).
+var helloRetryRequestRandom = func() []byte {
+	sum := sha256.Sum256([]byte("HelloRetryRequest"))
+	return sum[:]
+}()
+
+// Labels of the TLS 1.3 traffic secrets each endpoint uses, in order.
+var (
+	clientStages = []string{clientHandshakeLabel, clientApplicationLabel}
+	serverStages = []string{serverHandshakeLabel, serverApplicationLabel}
+)
+
+// Session decrypts both directions of a TLS 1.2 or 1.3 connection using
+// secrets from a KeyLog. The handshake must be observed from the start, so
+// that the client random identifying the secrets and the negotiated cipher
+// suite are known.
+type Session struct {
+	keys *KeyLog
+
+	mu sync.Mutex
+
+	a, b   *Flow
+	client *Flow
+
+	clientRandom []byte
+	serverRandom []byte
+	suite        *cipherSuite
+	tls13        bool
+
+	// TLS 1.2 record ciphers, derived once both Hellos have been seen.
+	clientCipher12, serverCipher12 recordCipher
+}
+
+func NewSession(keys *KeyLog) *Session {
+	s := &Session{keys: keys}
+	s.a = &Flow{session: s}
+	s.b = &Flow{session: s}
+	return s
+}
+
+// Returns the two directions of the connection. Which one is the client is
+// learned from the Client Hello.
+func (s *Session) Flows() (*Flow, *Flow) {
+	return s.a, s.b
+}
+
+// Flow decrypts the records sent in one direction of a connection.
+type Flow struct {
+	session *Session
+
+	// Bytes of incomplete records.
+	buf []byte
+
+	// Set once the data is found not to be TLS, or a gap in it is reported.
+	failed bool
+
+	// Current record cipher, and the sequence number of the next record.
+	cipher recordCipher
+	seq    uint64
+
+	// Whether a TLS 1.2 ChangeCipherSpec has been sent.
+	changedCipherSpec bool
+
+	// Number of TLS 1.3 traffic secrets tried, and the current one.
+	stage  int
+	secret []byte
+}
+
+// Consumes the next bytes sent in this direction and returns the decrypted
+// application data they complete. Records are skipped if their keys are not
+// in the key log.
+//
+// An error is returned if the data is not TLS, after which no more data is
+// decrypted.
+func (f *Flow) Decrypt(data []byte) ([]byte, error) {
+	s := f.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f.failed {
+		return nil, nil
+	}
+	f.buf = append(f.buf, data...)
+
+	var plaintext []byte
+	for len(f.buf) >= recordHeaderLength_bytes {
+		header := f.buf[:recordHeaderLength_bytes]
+		length := int(binary.BigEndian.Uint16(header[3:]))
+		if header[0] < recordChangeCipherSpec || header[0] > recordApplicationData ||
+			header[1] != 3 || length > maxRecordLength_bytes {
+			f.Fail()
+			return plaintext, errors.New("not a TLS record")
+		}
+		if len(f.buf) < recordHeaderLength_bytes+length {
+			break
+		}
+
+		fragment := f.buf[recordHeaderLength_bytes : recordHeaderLength_bytes+length]
+		plaintext = append(plaintext, f.record(header, fragment)...)
+		f.buf = f.buf[recordHeaderLength_bytes+length:]
+	}
+
+	// Don't hold on to the storage of consumed records.
+	f.buf = append([]byte(nil), f.buf...)
+	return plaintext, nil
+}
+
+// Stops decrypting this direction, e.g. because data was lost.
+func (f *Flow) Fail() {
+	f.failed = true
+	f.buf = nil
+}
+
+// Handles a complete record, returning any application data it contains.
+func (f *Flow) record(header, fragment []byte) []byte {
+	s := f.session
+	switch {
+	case s.tls13 && header[0] == recordApplicationData:
+		return f.open13(header, fragment)
+
+	case !s.tls13 && header[0] == recordChangeCipherSpec:
+		f.changedCipherSpec = true
+		f.cipher = s.tls12Cipher(f)
+		f.seq = 0
+
+	case f.changedCipherSpec:
+		// The other direction's Hello may have been delivered late.
+		if f.cipher == nil {
+			if f.cipher = s.tls12Cipher(f); f.cipher == nil {
+				f.seq++
+				return nil
+			}
+		}
+		contentType, plaintext, err := f.cipher.open(f.seq, header, fragment)
+		f.seq++
+		if err == nil && contentType == recordApplicationData {
+			return plaintext
+		}
+
+	case header[0] == recordHandshake:
+		f.handshake(fragment)
+	}
+	return nil
+}
+
+// Extracts the randoms and the negotiated parameters from cleartext Hellos.
+func (f *Flow) handshake(fragment []byte) {
+	s := f.session
+	for len(fragment) >= handshakeHeaderLength_bytes {
+		msgType := fragment[0]
+		length := int(fragment[1])<<16 | int(fragment[2])<<8 | int(fragment[3])
+		msg := fragment[handshakeHeaderLength_bytes:]
+		if length < len(msg) {
+			msg = msg[:length]
+		}
+		fragment = fragment[handshakeHeaderLength_bytes+len(msg):]
+
+		// Version, then random.
+		if len(msg) < 2+randomLength_bytes {
+			continue
+		}
+		random := msg[2 : 2+randomLength_bytes]
+
+		switch msgType {
+		case handshakeClientHello:
+			s.client = f
+			s.clientRandom = append([]byte(nil), random...)
+		case handshakeServerHello:
+			if !bytes.Equal(random, helloRetryRequestRandom) {
+				s.serverHello(msg)
+			}
+		}
+	}
+}
+
+func (s *Session) serverHello(msg []byte) {
+	s.serverRandom = append([]byte(nil), msg[2:2+randomLength_bytes]...)
+
+	// Session ID, cipher suite, compression method and extensions.
+	pos := 2 + randomLength_bytes
+	if pos >= len(msg) {
+		return
+	}
+	pos += 1 + int(msg[pos])
+	if pos+3 > len(msg) {
+		return
+	}
+	if suite, ok := cipherSuites[binary.BigEndian.Uint16(msg[pos:])]; ok {
+		s.suite = &suite
+	}
+	pos += 3
+
+	if pos+2 > len(msg) {
+		return
+	}
+	pos += 2
+	for pos+4 <= len(msg) {
+		extType := binary.BigEndian.Uint16(msg[pos:])
+		extLength := int(binary.BigEndian.Uint16(msg[pos+2:]))
+		pos += 4
+		if pos+extLength > len(msg) {
+			return
+		}
+		if extType == supportedVersionsExtensionID && extLength == 2 {
+			s.tls13 = binary.BigEndian.Uint16(msg[pos:]) == tls13Version
+		}
+		pos += extLength
+	}
+}
+
+// Returns the TLS 1.2 record cipher for f, or nil if it can't be derived.
+func (s *Session) tls12Cipher(f *Flow) recordCipher {
+	if s.clientCipher12 == nil {
+		if s.suite == nil || s.suite.tls13 || s.clientRandom == nil || s.serverRandom == nil {
+			return nil
+		}
+		masterSecret := s.keys.Secret(clientRandomLabel, s.clientRandom)
+		if masterSecret == nil {
+			return nil
+		}
+		client, server, err := newTLS12Ciphers(*s.suite, masterSecret, s.clientRandom, s.serverRandom)
+		if err != nil {
+			return nil
+		}
+		s.clientCipher12, s.serverCipher12 = client, server
+	}
+
+	if f == s.client {
+		return s.clientCipher12
+	}
+	return s.serverCipher12
+}
+
+// Decrypts a TLS 1.3 record. The current keys are tried first, then those of
+// each later stage of the handshake, since the Finished message that marks
+// the transition might not have been decrypted.
+func (f *Flow) open13(header, fragment []byte) []byte {
+	for {
+		if f.cipher != nil {
+			contentType, plaintext, err := f.cipher.open(f.seq, header, fragment)
+			if err == nil {
+				f.seq++
+				return f.inner13(contentType, plaintext)
+			}
+		}
+		if !f.nextStage() {
+			return nil
+		}
+	}
+}
+
+// Handles the decrypted content of a TLS 1.3 record.
+func (f *Flow) inner13(contentType byte, plaintext []byte) []byte {
+	if contentType == recordApplicationData {
+		return plaintext
+	}
+	if contentType != recordHandshake {
+		return nil
+	}
+
+	for len(plaintext) >= handshakeHeaderLength_bytes {
+		length := int(plaintext[1])<<16 | int(plaintext[2])<<8 | int(plaintext[3])
+		switch plaintext[0] {
+		case handshakeFinished:
+			// Switch from handshake to application traffic keys.
+			if f.stage == 1 {
+				f.nextStage()
+			}
+		case handshakeKeyUpdate:
+			if f.secret != nil {
+				f.setSecret(hkdfExpandLabel(f.session.suite.hash, f.secret, "traffic upd", f.session.suite.hash().Size()))
+			}
+		}
+		if handshakeHeaderLength_bytes+length > len(plaintext) {
+			break
+		}
+		plaintext = plaintext[handshakeHeaderLength_bytes+length:]
+	}
+	return nil
+}
+
+// Switches to the next TLS 1.3 traffic secret that is in the key log.
+func (f *Flow) nextStage() bool {
+	s := f.session
+	if s.suite == nil || s.clientRandom == nil {
+		return false
+	}
+
+	stages := serverStages
+	if f == s.client {
+		stages = clientStages
+	}
+	for f.stage < len(stages) {
+		secret := s.keys.Secret(stages[f.stage], s.clientRandom)
+		f.stage++
+		if secret != nil {
+			f.setSecret(secret)
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Flow) setSecret(secret []byte) {
+	f.secret = secret
+	f.seq = 0
+	f.cipher = nil
+	if c, err := newTLS13Cipher(*f.session.suite, secret); err == nil {
+		f.cipher = c
+	}
+}
@@ -0,0 +1,161 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// Records the bytes written to a connection.
+type recordingConn struct {
+	net.Conn
+
+	mu      sync.Mutex
+	written *bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	c.written.Write(b)
+	c.mu.Unlock()
+	return c.Conn.Write(b)
+}
+
+// Runs a TLS connection in which the client sends request and the server
+// replies with response. Returns the bytes sent by each side and the key log.
+func capture(t *testing.T, clientConfig *tls.Config, request, response string) (clientBytes, serverBytes []byte, keyLog string) {
+	var keyLogBuf, clientBuf, serverBuf bytes.Buffer
+	clientConfig.KeyLogWriter = &keyLogBuf
+	clientConfig.InsecureSkipVerify = true
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t)},
+		CipherSuites: clientConfig.CipherSuites,
+		MaxVersion:   clientConfig.MaxVersion,
+	}
+
+	c, s := net.Pipe()
+	client := tls.Client(&recordingConn{Conn: c, written: &clientBuf}, clientConfig)
+	server := tls.Server(&recordingConn{Conn: s, written: &serverBuf}, serverConfig)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, len(request))
+		if _, err := io.ReadFull(server, buf); err != nil {
+			t.Error(err)
+			return
+		}
+		server.Write([]byte(response))
+		server.Close()
+	}()
+
+	_, err := client.Write([]byte(request))
+	assert.NoError(t, err)
+	io.Copy(io.Discard, client)
+	client.Close()
+	<-done
+
+	return clientBuf.Bytes(), serverBuf.Bytes(), keyLogBuf.String()
+}
+
+func TestDecrypt(t *testing.T) {
+	const request = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	const response = "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"
+
+	tests := []struct {
+		name   string
+		config *tls.Config
+	}{
+		{"TLS 1.3", &tls.Config{}},
+		{"TLS 1.2 AES-128-GCM", &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}}},
+		{"TLS 1.2 AES-256-GCM", &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}}},
+		{"TLS 1.2 AES-128-CBC", &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA}}},
+	}
+
+	for _, tc := range tests {
+		clientBytes, serverBytes, keyLog := capture(t, tc.config, request, response)
+
+		keys := NewKeyLog()
+		assert.NoError(t, keys.Load(strings.NewReader("# comment\n"+keyLog)), tc.name)
+
+		session := NewSession(keys)
+		a, b := session.Flows()
+
+		// Feed the data in small pieces, alternating between directions so that
+		// each side sees the other's Hello first.
+		var gotRequest, gotResponse []byte
+		for len(clientBytes) > 0 || len(serverBytes) > 0 {
+			n := 7
+			if n > len(clientBytes) {
+				n = len(clientBytes)
+			}
+			p, err := a.Decrypt(clientBytes[:n])
+			assert.NoError(t, err, tc.name)
+			gotRequest = append(gotRequest, p...)
+			clientBytes = clientBytes[n:]
+
+			n = 7
+			if n > len(serverBytes) {
+				n = len(serverBytes)
+			}
+			p, err = b.Decrypt(serverBytes[:n])
+			assert.NoError(t, err, tc.name)
+			gotResponse = append(gotResponse, p...)
+			serverBytes = serverBytes[n:]
+		}
+
+		assert.Equal(t, request, string(gotRequest), tc.name)
+		assert.Equal(t, response, string(gotResponse), tc.name)
+	}
+}
+
+func TestDecryptWithoutKeys(t *testing.T) {
+	clientBytes, _, _ := capture(t, &tls.Config{}, "hello", "world")
+
+	a, _ := NewSession(NewKeyLog()).Flows()
+	p, err := a.Decrypt(clientBytes)
+	assert.NoError(t, err)
+	assert.Empty(t, p)
+}
+
+func TestDecryptNotTLS(t *testing.T) {
+	a, _ := NewSession(NewKeyLog()).Flows()
+	_, err := a.Decrypt([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.Error(t, err)
+
+	p, err := a.Decrypt([]byte{recordApplicationData, 3, 3, 0, 1, 0})
+	assert.NoError(t, err)
+	assert.Empty(t, p)
+}
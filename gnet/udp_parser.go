@@ -0,0 +1,33 @@
+package gnet
+
+import "github.com/google/uuid"
+
+// UDPParserFactory creates parsers for protocols whose messages span several
+// UDP datagrams, or whose datagrams can only be interpreted with what came
+// before them.
+type UDPParserFactory interface {
+	Name() string
+
+	// Reports whether payload, the first datagram of a flow, sent from
+	// srcPort to dstPort, starts a flow of this protocol.
+	Accepts(payload []byte, srcPort, dstPort int) bool
+
+	// Creates a parser for the flow with the given ID, which is also the
+	// ConnectionID of its traffic.
+	CreateUDPParser(id uuid.UUID) UDPParser
+}
+
+// UDPParser parses the datagrams of a UDP flow, in both directions, in the
+// order they were captured. The client is the sender of the first datagram.
+// Unlike TCPParser, it is used for the whole flow.
+type UDPParser interface {
+	Name() string
+
+	// Parses the next datagram, sent in direction dir, copying any part of it
+	// to keep. Returns the content it completes, or nil if more datagrams are
+	// needed. isEnd is true, with a nil payload, once the flow has been idle
+	// for long enough to be forgotten.
+	//
+	// An error ends the use of the parser for the flow.
+	Parse(dir FlowDirection, payload []byte, isEnd bool) (ParsedNetworkContent, error)
+}
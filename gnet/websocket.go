@@ -0,0 +1,81 @@
+package gnet
+
+import (
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// WebSocket frame opcodes, from RFC 6455 Section 5.2.
+type WebSocketOpcode uint8
+
+const (
+	WebSocketContinuation WebSocketOpcode = 0x0
+	WebSocketText         WebSocketOpcode = 0x1
+	WebSocketBinary       WebSocketOpcode = 0x2
+	WebSocketClose        WebSocketOpcode = 0x8
+	WebSocketPing         WebSocketOpcode = 0x9
+	WebSocketPong         WebSocketOpcode = 0xa
+)
+
+func (o WebSocketOpcode) String() string {
+	switch o {
+	case WebSocketContinuation:
+		return "continuation"
+	case WebSocketText:
+		return "text"
+	case WebSocketBinary:
+		return "binary"
+	case WebSocketClose:
+		return "close"
+	case WebSocketPing:
+		return "ping"
+	case WebSocketPong:
+		return "pong"
+	}
+	return "unknown"
+}
+
+// Indicates which endpoint sent a WebSocket message.
+type WebSocketDirection int
+
+const (
+	UnknownWebSocketDirection WebSocketDirection = iota
+	WebSocketClientToServer
+	WebSocketServerToClient
+)
+
+// Represents a WebSocket message, reassembled from one or more frames.
+type WebSocketMessage struct {
+	// Identifies the TCP connection to which this message belongs.
+	ConnectionID uuid.UUID
+
+	// Inferred from the mask bit: clients must mask every frame they send, and
+	// servers must not.
+	Direction WebSocketDirection
+
+	// The opcode of the first frame of the message.
+	Opcode WebSocketOpcode
+
+	// Number of frames the message was split into.
+	Fragments int
+
+	// Whether RSV1 was set on the first frame, which indicates a compressed
+	// payload when the permessage-deflate extension was negotiated.
+	Compressed bool
+
+	// The unmasked payload. The payload is not decompressed.
+	Payload memview.MemView
+
+	// Whether Payload was cut short because the message exceeded the parser's
+	// maximum length.
+	Truncated bool
+
+	// The status code and reason from a close frame, if present.
+	CloseCode   int
+	CloseReason string
+}
+
+var _ ParsedNetworkContent = (*WebSocketMessage)(nil)
+
+func (WebSocketMessage) ReleaseBuffers() {}
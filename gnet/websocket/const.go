@@ -0,0 +1,30 @@
+package websocket
+
+const (
+	// Two bytes: FIN, RSV1-3 and opcode; then the mask bit and payload length.
+	minFrameHeaderLength_bytes = 2
+
+	// Length of the masking key that follows the header when the mask bit is
+	// set.
+	maskingKeyLength_bytes = 4
+
+	finBit     = 0x80
+	rsv1Bit    = 0x40
+	rsv2Bit    = 0x20
+	rsv3Bit    = 0x10
+	opcodeMask = 0x0f
+
+	maskBit           = 0x80
+	payloadLengthMask = 0x7f
+
+	// Payload length values indicating that the real length follows in the
+	// next 2 or 8 bytes.
+	payloadLength16 = 126
+	payloadLength64 = 127
+)
+
+var (
+	// Maximum payload length stored for a single message; the rest of the
+	// message is consumed but dropped.
+	MaximumMessageLength int64 = 1024 * 1024
+)
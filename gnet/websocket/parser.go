@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func newWebSocketParser(bidiID uuid.UUID) *webSocketParser {
+	return &webSocketParser{
+		connectionID: bidiID,
+	}
+}
+
+type webSocketParser struct {
+	connectionID uuid.UUID
+	allInput     memview.MemView
+}
+
+var _ gnet.TCPParser = (*webSocketParser)(nil)
+
+func (*webSocketParser) Name() string {
+	return "WebSocket Parser"
+}
+
+func (parser *webSocketParser) Parse(input memview.MemView, isEnd bool) (result gnet.ParsedNetworkContent, unused memview.MemView, totalBytesConsumed int64, err error) {
+	// Add the incoming bytes to our buffer.
+	parser.allInput.Append(input)
+
+	result, numBytesConsumed, err := parser.parse()
+	// It's an error if we're at the end and we don't yet have a result.
+	if isEnd && result == nil && err == nil {
+		err = errors.New("incomplete WebSocket message")
+	}
+
+	totalBytesConsumed = parser.allInput.Len()
+
+	if err != nil {
+		return result, memview.MemView{}, totalBytesConsumed, err
+	}
+
+	if result != nil {
+		unused = parser.allInput.SubView(numBytesConsumed, parser.allInput.Len())
+		totalBytesConsumed -= unused.Len()
+		return result, unused, totalBytesConsumed, nil
+	}
+
+	return nil, memview.MemView{}, totalBytesConsumed, nil
+}
+
+// A single frame, as laid out in RFC 6455 Section 5.2.
+type frame struct {
+	fin        bool
+	rsv1       bool
+	opcode     gnet.WebSocketOpcode
+	masked     bool
+	maskingKey [maskingKeyLength_bytes]byte
+
+	// Position of the payload in the parser's input.
+	payloadStart int64
+	payloadEnd   int64
+}
+
+// Parses the frame starting at offset in the input. Returns nil if the input
+// does not yet contain the whole frame.
+func (parser *webSocketParser) parseFrame(offset int64) (*frame, error) {
+	in := parser.allInput
+	pos := offset
+
+	if in.Len()-pos < minFrameHeaderLength_bytes {
+		return nil, nil
+	}
+
+	b0 := in.GetByte(pos)
+	b1 := in.GetByte(pos + 1)
+	pos += minFrameHeaderLength_bytes
+
+	f := &frame{
+		fin:    b0&finBit != 0,
+		rsv1:   b0&rsv1Bit != 0,
+		opcode: gnet.WebSocketOpcode(b0 & opcodeMask),
+		masked: b1&maskBit != 0,
+	}
+
+	payloadLen := int64(b1 & payloadLengthMask)
+	switch payloadLen {
+	case payloadLength16:
+		if in.Len()-pos < 2 {
+			return nil, nil
+		}
+		payloadLen = int64(in.GetUint16(pos))
+		pos += 2
+	case payloadLength64:
+		if in.Len()-pos < 8 {
+			return nil, nil
+		}
+		hi, lo := in.GetUint32(pos), in.GetUint32(pos+4)
+		// The most significant bit must be 0.
+		if hi&0x80000000 != 0 {
+			return nil, errors.New("invalid WebSocket payload length")
+		}
+		payloadLen = int64(hi)<<32 | int64(lo)
+		pos += 8
+	}
+
+	if f.masked {
+		if in.Len()-pos < maskingKeyLength_bytes {
+			return nil, nil
+		}
+		for i := range f.maskingKey {
+			f.maskingKey[i] = in.GetByte(pos + int64(i))
+		}
+		pos += maskingKeyLength_bytes
+	}
+
+	if in.Len()-pos < payloadLen {
+		return nil, nil
+	}
+
+	f.payloadStart = pos
+	f.payloadEnd = pos + payloadLen
+	return f, nil
+}
+
+// Returns the unmasked payload of f, limited to at most limit bytes.
+func (parser *webSocketParser) payload(f *frame, limit int64) []byte {
+	end := f.payloadEnd
+	if end-f.payloadStart > limit {
+		end = f.payloadStart + limit
+	}
+
+	buf := parser.allInput.SubView(f.payloadStart, end).Bytes()
+	if f.masked {
+		for i := range buf {
+			buf[i] ^= f.maskingKey[i%maskingKeyLength_bytes]
+		}
+	}
+	return buf
+}
+
+// Attempts to parse a complete message from the input. Returns nil if more
+// data is needed.
+func (parser *webSocketParser) parse() (result gnet.ParsedNetworkContent, numBytesConsumed int64, err error) {
+	first, err := parser.parseFrame(0)
+	if err != nil || first == nil {
+		return nil, 0, err
+	}
+
+	msg := gnet.WebSocketMessage{
+		ConnectionID: parser.connectionID,
+		Direction:    gnet.WebSocketServerToClient,
+		Opcode:       first.opcode,
+		Compressed:   first.rsv1,
+	}
+	if first.masked {
+		msg.Direction = gnet.WebSocketClientToServer
+	}
+
+	if first.opcode == gnet.WebSocketContinuation {
+		return nil, 0, errors.New("WebSocket message starts with a continuation frame")
+	}
+
+	var payload []byte
+	appendPayload := func(f *frame) {
+		remaining := MaximumMessageLength - int64(len(payload))
+		if f.payloadEnd-f.payloadStart > remaining {
+			msg.Truncated = true
+		}
+		if remaining > 0 {
+			payload = append(payload, parser.payload(f, remaining)...)
+		}
+		msg.Fragments++
+	}
+
+	appendPayload(first)
+	pos := first.payloadEnd
+
+	// Control frames are never fragmented. Data frames continue until a frame
+	// with FIN set. Control frames may be interleaved with the continuation
+	// frames of a data message; they are consumed here but not reported.
+	if first.opcode < gnet.WebSocketClose {
+		for fin := first.fin; !fin; {
+			f, err := parser.parseFrame(pos)
+			if err != nil || f == nil {
+				return nil, 0, err
+			}
+			pos = f.payloadEnd
+
+			if f.opcode >= gnet.WebSocketClose {
+				continue
+			}
+			if f.opcode != gnet.WebSocketContinuation {
+				return nil, 0, errors.Errorf("expected WebSocket continuation frame, got %s", f.opcode)
+			}
+			appendPayload(f)
+			fin = f.fin
+		}
+	}
+
+	// A close frame's body may start with a status code and a UTF-8 reason.
+	if first.opcode == gnet.WebSocketClose && len(payload) >= 2 {
+		msg.CloseCode = int(payload[0])<<8 | int(payload[1])
+		msg.CloseReason = string(payload[2:])
+	}
+
+	msg.Payload = memview.New(payload)
+	return msg, pos, nil
+}
@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Returns a factory for parsing WebSocket messages. The factory is only used
+// after an HTTP/1.1 Upgrade handshake has been observed on the connection, so
+// an HTTP/1.x response parser must also be in use.
+func NewWebSocketParserFactory() gnet.TCPParserFactory {
+	return &webSocketParserFactory{}
+}
+
+type webSocketParserFactory struct{}
+
+var _ gnet.TCPUpgradeParserFactory = (*webSocketParserFactory)(nil)
+
+func (*webSocketParserFactory) Name() string {
+	return "WebSocket Parser Factory"
+}
+
+// A connection switches to WebSocket once the server answers an Upgrade
+// request with 101 Switching Protocols.
+func (*webSocketParserFactory) Upgrades(c gnet.ParsedNetworkContent) bool {
+	resp, ok := c.(gnet.HTTPResponse)
+	if !ok || resp.StatusCode != http.StatusSwitchingProtocols {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(resp.Header.Get("Upgrade")), "websocket")
+}
+
+func (factory *webSocketParserFactory) Accepts(input memview.MemView, isEnd bool) (decision gnet.AcceptDecision, discardFront int64) {
+	decision, discardFront = factory.accepts(input)
+
+	if decision == gnet.NeedMoreData && isEnd {
+		decision = gnet.Reject
+		discardFront = input.Len()
+	}
+
+	return decision, discardFront
+}
+
+func (*webSocketParserFactory) accepts(input memview.MemView) (decision gnet.AcceptDecision, discardFront int64) {
+	if input.Len() < minFrameHeaderLength_bytes {
+		return gnet.NeedMoreData, 0
+	}
+
+	// RSV2 and RSV3 are not used by any registered extension. RSV1 is used by
+	// permessage-deflate.
+	b0 := input.GetByte(0)
+	if b0&(rsv2Bit|rsv3Bit) != 0 {
+		return gnet.Reject, input.Len()
+	}
+
+	switch gnet.WebSocketOpcode(b0 & opcodeMask) {
+	case gnet.WebSocketText, gnet.WebSocketBinary,
+		gnet.WebSocketClose, gnet.WebSocketPing, gnet.WebSocketPong:
+		return gnet.Accept, 0
+	}
+
+	// A message can't start with a continuation frame or a reserved opcode.
+	return gnet.Reject, input.Len()
+}
+
+func (*webSocketParserFactory) CreateParser(id uuid.UUID, seq, ack reassembly.Sequence) gnet.TCPParser {
+	return newWebSocketParser(id)
+}
@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func maskedFrame(b0 byte, payload string) []byte {
+	key := []byte{1, 2, 3, 4}
+	frame := []byte{b0, maskBit | byte(len(payload))}
+	frame = append(frame, key...)
+	for i := 0; i < len(payload); i++ {
+		frame = append(frame, payload[i]^key[i%4])
+	}
+	return frame
+}
+
+func TestFragmentedMessage(t *testing.T) {
+	var input []byte
+	input = append(input, maskedFrame(byte(gnet.WebSocketText), "Hel")...)
+	input = append(input, maskedFrame(finBit|byte(gnet.WebSocketPing), "")...)
+	input = append(input, maskedFrame(finBit|byte(gnet.WebSocketContinuation), "lo")...)
+	input = append(input, 0x81) // start of the next frame
+
+	p := newWebSocketParser(uuid.New())
+	result, unused, consumed, err := p.Parse(memview.New(input[:5]), false)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+
+	result, unused, consumed, err = p.Parse(memview.New(input[5:]), false)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		msg := result.(gnet.WebSocketMessage)
+		assert.Equal(t, gnet.WebSocketText, msg.Opcode)
+		assert.Equal(t, gnet.WebSocketClientToServer, msg.Direction)
+		assert.Equal(t, 2, msg.Fragments)
+		assert.Equal(t, "Hello", msg.Payload.String())
+		assert.Equal(t, int64(1), unused.Len())
+		assert.Equal(t, int64(len(input)-1), consumed)
+	}
+}
+
+func TestCloseFrame(t *testing.T) {
+	input := []byte{finBit | byte(gnet.WebSocketClose), 6, 0x03, 0xe8, 'b', 'y', 'e', '!'}
+
+	p := newWebSocketParser(uuid.New())
+	result, _, _, err := p.Parse(memview.New(input), true)
+	if assert.NoError(t, err) && assert.NotNil(t, result) {
+		msg := result.(gnet.WebSocketMessage)
+		assert.Equal(t, gnet.WebSocketServerToClient, msg.Direction)
+		assert.Equal(t, 1000, msg.CloseCode)
+		assert.Equal(t, "bye!", msg.CloseReason)
+	}
+}
+
+func TestUpgrades(t *testing.T) {
+	f := NewWebSocketParserFactory().(gnet.TCPUpgradeParserFactory)
+
+	resp := gnet.HTTPResponse{StatusCode: 101, Header: map[string][]string{"Upgrade": {"WebSocket"}}}
+	assert.True(t, f.Upgrades(resp))
+
+	resp.StatusCode = 200
+	assert.False(t, f.Upgrades(resp))
+}
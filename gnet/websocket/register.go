@@ -0,0 +1,12 @@
+package websocket
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func init() {
+	gnet.DefaultTCPParserRegistry.Register("websocket", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{NewWebSocketParserFactory()}
+	}, gnet.TextTCPParserPriority)
+}
@@ -0,0 +1,218 @@
+package zeek
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Format of the logs written by a Writer.
+type Format int
+
+const (
+	// Tab-separated values with Zeek's header, as written by default.
+	TSV Format = iota
+
+	// One JSON object per line, as written with LogAscii::use_json.
+	JSON
+)
+
+// Placeholders in TSV logs.
+const (
+	unsetField   = "-"
+	emptyField   = "(empty)"
+	setSeparator = ","
+)
+
+// Values of the Zeek types used in the logs. nil values are unset.
+type (
+	// A Zeek time, written as seconds since the epoch.
+	zeekTime time.Time
+
+	// A Zeek interval, written as seconds.
+	interval time.Duration
+
+	// A Zeek vector of strings.
+	vector []string
+
+	// A Zeek vector of intervals.
+	intervals []time.Duration
+)
+
+// The columns of a log and their Zeek types.
+type schema struct {
+	path   string
+	fields []string
+	types  []string
+}
+
+// A log being written.
+type logFile struct {
+	schema schema
+	format Format
+	w      *bufio.Writer
+	c      io.Closer
+}
+
+func newLogFile(s schema, format Format, wc io.WriteCloser, opened time.Time) (*logFile, error) {
+	l := &logFile{schema: s, format: format, w: bufio.NewWriter(wc), c: wc}
+	if format == TSV {
+		header := []string{
+			`#separator \x09`,
+			"#set_separator\t" + setSeparator,
+			"#empty_field\t" + emptyField,
+			"#unset_field\t" + unsetField,
+			"#path\t" + s.path,
+			"#open\t" + opened.UTC().Format("2006-01-02-15-04-05"),
+			"#fields\t" + strings.Join(s.fields, "\t"),
+			"#types\t" + strings.Join(s.types, "\t"),
+		}
+		if _, err := l.w.WriteString(strings.Join(header, "\n") + "\n"); err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s.log header", s.path)
+		}
+	}
+	return l, nil
+}
+
+// Writes a line with a value for each field of the schema.
+func (l *logFile) write(values ...interface{}) error {
+	var line string
+	if l.format == JSON {
+		var b strings.Builder
+		b.WriteByte('{')
+		first := true
+		for i, v := range values {
+			if v == nil {
+				// Unset fields are left out of JSON logs.
+				continue
+			}
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			name, _ := json.Marshal(l.schema.fields[i])
+			value, err := json.Marshal(jsonValue(v))
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal %s", l.schema.fields[i])
+			}
+			b.Write(name)
+			b.WriteByte(':')
+			b.Write(value)
+		}
+		b.WriteByte('}')
+		line = b.String()
+	} else {
+		cols := make([]string, len(values))
+		for i, v := range values {
+			cols[i] = tsvValue(v)
+		}
+		line = strings.Join(cols, "\t")
+	}
+
+	if _, err := l.w.WriteString(line + "\n"); err != nil {
+		return errors.Wrapf(err, "failed to write to %s.log", l.schema.path)
+	}
+	return nil
+}
+
+func (l *logFile) close(closed time.Time) error {
+	var err error
+	if l.format == TSV {
+		_, err = l.w.WriteString("#close\t" + closed.UTC().Format("2006-01-02-15-04-05") + "\n")
+	}
+	if ferr := l.w.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := l.c.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrapf(err, "failed to close %s.log", l.schema.path)
+}
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func tsvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return unsetField
+	case zeekTime:
+		return strconv.FormatFloat(seconds(time.Time(v)), 'f', 6, 64)
+	case interval:
+		return strconv.FormatFloat(time.Duration(v).Seconds(), 'f', 6, 64)
+	case vector:
+		if len(v) == 0 {
+			return emptyField
+		}
+		escaped := make([]string, len(v))
+		for i, s := range v {
+			escaped[i] = strings.ReplaceAll(escape(s), setSeparator, `\x2c`)
+		}
+		return strings.Join(escaped, setSeparator)
+	case intervals:
+		if len(v) == 0 {
+			return emptyField
+		}
+		strs := make([]string, len(v))
+		for i, d := range v {
+			strs[i] = tsvValue(interval(d))
+		}
+		return strings.Join(strs, setSeparator)
+	case string:
+		if v == "" {
+			return emptyField
+		}
+		return escape(v)
+	case net.IP:
+		return v.String()
+	case bool:
+		if v {
+			return "T"
+		}
+		return "F"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Escapes the characters that would break the TSV layout, like Zeek does.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\\' || r < 0x20 || r == 0x7f {
+			fmt.Fprintf(&b, `\x%02x`, r)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case zeekTime:
+		return seconds(time.Time(v))
+	case interval:
+		return time.Duration(v).Seconds()
+	case vector:
+		return []string(v)
+	case intervals:
+		secs := make([]float64, len(v))
+		for i, d := range v {
+			secs[i] = d.Seconds()
+		}
+		return secs
+	case net.IP:
+		return v.String()
+	default:
+		return v
+	}
+}
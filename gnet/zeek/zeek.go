@@ -0,0 +1,445 @@
+// Package zeek writes parsed traffic as Zeek logs, in Zeek's TSV or JSON
+// format, so that it can be ingested by pipelines built for Zeek:
+//
+//   - conn.log, from gnet.TCPConnectionMetadata
+//   - http.log, from gnet.HTTPExchange, as produced by gnet.PairCollector
+//   - dns.log, from gnet.DNSRequest queries and responses
+//   - tls.log, from gnet.TLSClientHello and gnet.TLSServerHello (Zeek calls
+//     this log ssl.log)
+//
+// Connection UIDs are the ConnectionIDs of the traffic, so the logs of one
+// connection can be joined like Zeek's. UDP traffic has no connection ID, and
+// its uid is unset.
+package zeek
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var (
+	connSchema = schema{
+		path: "conn",
+		fields: []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p",
+			"proto", "service", "duration", "orig_bytes", "resp_bytes", "conn_state",
+			"orig_pkts", "resp_pkts"},
+		types: []string{"time", "string", "addr", "port", "addr", "port",
+			"enum", "string", "interval", "count", "count", "string",
+			"count", "count"},
+	}
+	httpSchema = schema{
+		path: "http",
+		fields: []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p",
+			"trans_depth", "method", "host", "uri", "referrer", "version", "user_agent",
+			"request_body_len", "response_body_len", "status_code", "status_msg"},
+		types: []string{"time", "string", "addr", "port", "addr", "port",
+			"count", "string", "string", "string", "string", "string", "string",
+			"count", "count", "count", "string"},
+	}
+	dnsSchema = schema{
+		path: "dns",
+		fields: []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p",
+			"proto", "trans_id", "rtt", "query", "qtype_name", "rcode_name",
+			"AA", "TC", "RD", "RA", "answers", "TTLs"},
+		types: []string{"time", "string", "addr", "port", "addr", "port",
+			"enum", "count", "interval", "string", "string", "string",
+			"bool", "bool", "bool", "bool", "vector[string]", "vector[interval]"},
+	}
+	tlsSchema = schema{
+		path: "tls",
+		fields: []string{"ts", "uid", "id.orig_h", "id.orig_p", "id.resp_h", "id.resp_p",
+			"version", "cipher", "server_name", "next_protocol", "established"},
+		types: []string{"time", "string", "addr", "port", "addr", "port",
+			"string", "string", "string", "string", "bool"},
+	}
+)
+
+// Writer writes traffic to Zeek logs in a directory. Each log file is created
+// when its first line is written. Logs are only complete once Close has been
+// called.
+//
+// Safe for concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	dir    string
+	format Format
+	logs   map[string]*logFile
+	err    error
+
+	// Services seen on each TCP connection, for conn.log.
+	services map[uuid.UUID]string
+
+	// DNS queries awaiting their response, and TLS client hellos awaiting
+	// their server hello.
+	dnsQueries   map[dnsKey]gnet.NetTraffic
+	clientHellos map[uuid.UUID]gnet.NetTraffic
+}
+
+type dnsKey struct {
+	client, server string
+	id             uint16
+}
+
+func NewWriter(dir string, format Format) *Writer {
+	return &Writer{
+		dir:          dir,
+		format:       format,
+		logs:         map[string]*logFile{},
+		services:     map[uuid.UUID]string{},
+		dnsQueries:   map[dnsKey]gnet.NetTraffic{},
+		clientHellos: map[uuid.UUID]gnet.NetTraffic{},
+	}
+}
+
+// Logs t if it is one of the supported contents. Other traffic is ignored.
+func (w *Writer) Write(t gnet.NetTraffic) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch c := t.Content.(type) {
+	case gnet.TCPConnectionMetadata:
+		return w.writeConn(t, c)
+
+	case gnet.HTTPExchange:
+		w.addService(t.ConnectionID, "http")
+		return w.writeHTTP(t, c)
+
+	case gnet.DNSRequest:
+		w.addService(t.ConnectionID, "dns")
+		key := dnsKey{endpoint(t.SrcIP, t.SrcPort), endpoint(t.DstIP, t.DstPort), c.ID}
+		if !c.QR {
+			if old, ok := w.dnsQueries[key]; ok {
+				// Retransmitted or reused ID; log the old one unanswered.
+				if err := w.writeDNS(old, gnet.NetTraffic{}); err != nil {
+					return err
+				}
+			}
+			w.dnsQueries[key] = t
+			return nil
+		}
+		key.client, key.server = key.server, key.client
+		query, ok := w.dnsQueries[key]
+		delete(w.dnsQueries, key)
+		if !ok {
+			return w.writeDNS(gnet.NetTraffic{}, t)
+		}
+		return w.writeDNS(query, t)
+
+	case gnet.TLSClientHello:
+		w.addService(t.ConnectionID, "ssl")
+		w.clientHellos[t.ConnectionID] = t
+		return nil
+
+	case gnet.TLSServerHello:
+		w.addService(t.ConnectionID, "ssl")
+		hello, ok := w.clientHellos[t.ConnectionID]
+		delete(w.clientHellos, t.ConnectionID)
+		if !ok {
+			return w.writeTLS(gnet.NetTraffic{}, t)
+		}
+		return w.writeTLS(hello, t)
+	}
+	return nil
+}
+
+// Run passes through all traffic from in, logging each. Logging errors are
+// reported by Err. The logs are not closed.
+func (w *Writer) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			if err := w.Write(t); err != nil {
+				w.mu.Lock()
+				if w.err == nil {
+					w.err = err
+				}
+				w.mu.Unlock()
+			}
+			out <- t
+		}
+	}()
+	return out
+}
+
+// Returns the first error encountered while logging traffic from Run.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Logs the DNS queries and TLS hellos still awaiting a response, then closes
+// all logs.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	keep := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	for k, q := range w.dnsQueries {
+		keep(w.writeDNS(q, gnet.NetTraffic{}))
+		delete(w.dnsQueries, k)
+	}
+	for id, h := range w.clientHellos {
+		keep(w.writeTLS(h, gnet.NetTraffic{}))
+		delete(w.clientHellos, id)
+	}
+
+	now := time.Now()
+	for path, l := range w.logs {
+		keep(l.close(now))
+		delete(w.logs, path)
+	}
+	return err
+}
+
+func (w *Writer) log(s schema, values ...interface{}) error {
+	l, ok := w.logs[s.path]
+	if !ok {
+		f, err := os.Create(filepath.Join(w.dir, s.path+".log"))
+		if err != nil {
+			return errors.Wrapf(err, "failed to create %s.log", s.path)
+		}
+		if l, err = newLogFile(s, w.format, f, time.Now()); err != nil {
+			f.Close()
+			return err
+		}
+		w.logs[s.path] = l
+	}
+	return l.write(values...)
+}
+
+func (w *Writer) addService(id uuid.UUID, service string) {
+	if id != uuid.Nil {
+		w.services[id] = service
+	}
+}
+
+func (w *Writer) writeConn(t gnet.NetTraffic, c gnet.TCPConnectionMetadata) error {
+	service := w.services[t.ConnectionID]
+	delete(w.services, t.ConnectionID)
+
+	// The originator is the initiator, or the source if that is unknown.
+	origIP, origPort, respIP, respPort := t.SrcIP, t.SrcPort, t.DstIP, t.DstPort
+	orig, resp := c.SourceToDest, c.DestToSource
+	if c.Initiator == gnet.DestInitiator {
+		origIP, origPort, respIP, respPort = respIP, respPort, origIP, origPort
+		orig, resp = resp, orig
+	}
+
+	return w.log(connSchema,
+		zeekTime(t.ObservationTime), uid(t.ConnectionID),
+		addr(origIP), origPort, addr(respIP), respPort,
+		"tcp", unsetIfEmpty(service), interval(c.Duration),
+		orig.Bytes, resp.Bytes, connState(c),
+		orig.Packets, resp.Packets)
+}
+
+// Approximates Zeek's conn_state. Resets are reported as RSTO, since which
+// side sent the reset is not tracked.
+func connState(c gnet.TCPConnectionMetadata) string {
+	switch {
+	case c.Initiator == gnet.UnknownTCPConnectionInitiator:
+		return "OTH"
+	case c.EndState == gnet.ConnectionReset:
+		return "RSTO"
+	case c.EndState == gnet.ConnectionClosed:
+		return "SF"
+	}
+	return "S1"
+}
+
+func (w *Writer) writeHTTP(t gnet.NetTraffic, e gnet.HTTPExchange) error {
+	ts := e.RequestStart
+	if ts.IsZero() {
+		ts = e.ResponseStart
+	}
+
+	var method, host, uri, referrer, version, userAgent, requestLen interface{}
+	var depth interface{}
+	if r := e.Request; r != nil {
+		depth = r.Seq + 1
+		method, host = r.Method, unsetIfEmpty(r.Host)
+		if r.URL != nil {
+			uri = r.URL.RequestURI()
+		}
+		referrer = unsetIfEmpty(r.Header.Get("Referer"))
+		userAgent = unsetIfEmpty(r.Header.Get("User-Agent"))
+		version = fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)
+		requestLen = r.Body.Len()
+	}
+
+	var status, statusMsg, responseLen interface{}
+	if r := e.Response; r != nil {
+		if depth == nil {
+			depth = r.Seq + 1
+			version = fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)
+		}
+		status = r.StatusCode
+		statusMsg = unsetIfEmpty(strings.ToUpper(http.StatusText(r.StatusCode)))
+		responseLen = r.Body.Len()
+	}
+
+	return w.log(httpSchema,
+		zeekTime(ts), uid(t.ConnectionID),
+		addr(t.SrcIP), t.SrcPort, addr(t.DstIP), t.DstPort,
+		depth, method, host, uri, referrer, version, userAgent,
+		requestLen, responseLen, status, statusMsg)
+}
+
+// Logs a DNS query with its response. Either may be missing.
+func (w *Writer) writeDNS(query, response gnet.NetTraffic) error {
+	t, msg := query, query.Content
+	if msg == nil {
+		// Orient the response from client to server.
+		t, msg = response, response.Content
+		t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+		t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+	}
+	m := msg.(gnet.DNSRequest)
+
+	proto := "udp"
+	if t.ConnectionID != uuid.Nil {
+		proto = "tcp"
+	}
+
+	var q, qtype interface{}
+	if len(m.Questions) > 0 {
+		q, qtype = string(m.Questions[0].Name), m.Questions[0].Type.String()
+	}
+
+	var rtt, rcode, ra, answers, ttls interface{}
+	if r, ok := response.Content.(gnet.DNSRequest); ok {
+		if query.Content != nil {
+			rtt = interval(response.ObservationTime.Sub(query.ObservationTime))
+		}
+		rcode = rcodeName(r.ResponseCode)
+		ra = r.RA
+		var names vector
+		var durations intervals
+		for _, a := range r.Answers {
+			names = append(names, answerString(a))
+			durations = append(durations, time.Duration(a.TTL)*time.Second)
+		}
+		answers, ttls = names, durations
+		m.AA, m.TC = r.AA, r.TC
+	}
+
+	return w.log(dnsSchema,
+		zeekTime(t.ObservationTime), uid(t.ConnectionID),
+		addr(t.SrcIP), t.SrcPort, addr(t.DstIP), t.DstPort,
+		proto, m.ID, rtt, q, qtype, rcode,
+		m.AA, m.TC, m.RD, ra, answers, ttls)
+}
+
+// Names of response codes as Zeek spells them.
+var rcodeNames = map[layers.DNSResponseCode]string{
+	layers.DNSResponseCodeNoErr:    "NOERROR",
+	layers.DNSResponseCodeFormErr:  "FORMERR",
+	layers.DNSResponseCodeServFail: "SERVFAIL",
+	layers.DNSResponseCodeNXDomain: "NXDOMAIN",
+	layers.DNSResponseCodeNotImp:   "NOTIMP",
+	layers.DNSResponseCodeRefused:  "REFUSED",
+}
+
+func rcodeName(c layers.DNSResponseCode) string {
+	if name, ok := rcodeNames[c]; ok {
+		return name
+	}
+	return strings.ToUpper(strings.ReplaceAll(c.String(), " ", ""))
+}
+
+func answerString(a layers.DNSResourceRecord) string {
+	switch a.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return a.IP.String()
+	case layers.DNSTypeCNAME:
+		return string(a.CNAME)
+	case layers.DNSTypeNS:
+		return string(a.NS)
+	case layers.DNSTypePTR:
+		return string(a.PTR)
+	case layers.DNSTypeMX:
+		return string(a.MX.Name)
+	case layers.DNSTypeTXT:
+		var txts []string
+		for _, t := range a.TXTs {
+			txts = append(txts, string(t))
+		}
+		return "TXT " + strings.Join(txts, " ")
+	}
+	return a.Type.String()
+}
+
+// Logs a TLS handshake from its client and server hellos. Either may be
+// missing.
+func (w *Writer) writeTLS(client, server gnet.NetTraffic) error {
+	t := client
+	if t.Content == nil {
+		t = server
+		t.SrcIP, t.DstIP = t.DstIP, t.SrcIP
+		t.SrcPort, t.DstPort = t.DstPort, t.SrcPort
+	}
+
+	var version, cipher, serverName, nextProtocol interface{}
+	if c, ok := client.Content.(gnet.TLSClientHello); ok {
+		serverName = unsetIfEmpty(c.ServerName)
+	}
+	s, established := server.Content.(gnet.TLSServerHello)
+	if established {
+		v := s.Version
+		if s.SelectedVersion != 0 {
+			v = s.SelectedVersion
+		}
+		version = v.String()
+		cipher = fmt.Sprintf("0x%04x", s.CipherSuite)
+		nextProtocol = unsetIfEmpty(s.SelectedProtocol)
+	}
+
+	return w.log(tlsSchema,
+		zeekTime(t.ObservationTime), uid(t.ConnectionID),
+		addr(t.SrcIP), t.SrcPort, addr(t.DstIP), t.DstPort,
+		version, cipher, serverName, nextProtocol, established)
+}
+
+func uid(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id.String()
+}
+
+func addr(ip net.IP) interface{} {
+	if ip == nil {
+		return nil
+	}
+	return ip
+}
+
+func unsetIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func endpoint(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
@@ -0,0 +1,148 @@
+package zeek
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var (
+	clientIP = net.IPv4(10, 0, 0, 1)
+	serverIP = net.IPv4(10, 0, 0, 2)
+	start    = time.Unix(1700000000, 500000000)
+)
+
+func writeTraffic(t *testing.T, w *Writer) {
+	conn := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	traffic := []gnet.NetTraffic{
+		{
+			SrcIP: serverIP, SrcPort: 80, DstIP: clientIP, DstPort: 40000,
+			ConnectionID: conn, ObservationTime: start,
+			Content: gnet.HTTPExchange{
+				Request: &gnet.HTTPRequest{
+					Method: "GET", ProtoMajor: 1, ProtoMinor: 1, Host: "example.com",
+					URL:    &url.URL{Path: "/index.html", RawQuery: "q=1"},
+					Header: http.Header{"User-Agent": {"curl/8.0"}},
+				},
+				Response:     &gnet.HTTPResponse{StatusCode: 404, ProtoMajor: 1, ProtoMinor: 1},
+				RequestStart: start,
+			},
+		},
+		{
+			SrcIP: serverIP, SrcPort: 80, DstIP: clientIP, DstPort: 40000,
+			ConnectionID: conn, ObservationTime: start,
+			Content: gnet.TCPConnectionMetadata{
+				ConnectionID: conn,
+				Initiator:    gnet.DestInitiator,
+				EndState:     gnet.ConnectionClosed,
+				Duration:     1500 * time.Millisecond,
+				SourceToDest: gnet.TCPDirectionStats{Packets: 4, Bytes: 300},
+				DestToSource: gnet.TCPDirectionStats{Packets: 5, Bytes: 100},
+			},
+		},
+		{
+			SrcIP: clientIP, SrcPort: 5000, DstIP: serverIP, DstPort: 53,
+			ObservationTime: start,
+			Content: gnet.DNSRequest{ID: 7, RD: true, Questions: []layers.DNSQuestion{
+				{Name: []byte("example.com"), Type: layers.DNSTypeA},
+			}},
+		},
+		{
+			SrcIP: serverIP, SrcPort: 53, DstIP: clientIP, DstPort: 5000,
+			ObservationTime: start.Add(20 * time.Millisecond),
+			Content: gnet.DNSRequest{ID: 7, QR: true, RD: true, RA: true, Answers: []layers.DNSResourceRecord{
+				{Type: layers.DNSTypeA, IP: net.IPv4(93, 184, 216, 34), TTL: 300},
+			}},
+		},
+		{
+			SrcIP: clientIP, SrcPort: 40001, DstIP: serverIP, DstPort: 443,
+			ConnectionID: uuid.New(), ObservationTime: start,
+			Content: gnet.TLSClientHello{ServerName: "example.com"},
+		},
+	}
+	for _, tr := range traffic {
+		assert.NoError(t, w.Write(tr))
+	}
+	assert.NoError(t, w.Close())
+}
+
+// Returns the data lines of a TSV log, split into fields.
+func readTSV(t *testing.T, path string) [][]string {
+	b, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows
+}
+
+func TestWriteTSV(t *testing.T) {
+	dir := t.TempDir()
+	writeTraffic(t, NewWriter(dir, TSV))
+
+	b, err := os.ReadFile(filepath.Join(dir, "conn.log"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(b), "#separator \\x09\n"))
+	assert.Contains(t, string(b), "#path\tconn\n")
+	assert.Contains(t, string(b), "\n#close\t")
+
+	assert.Equal(t, [][]string{{
+		"1700000000.500000", "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"10.0.0.1", "40000", "10.0.0.2", "80",
+		"tcp", "http", "1.500000", "100", "300", "SF", "5", "4",
+	}}, readTSV(t, filepath.Join(dir, "conn.log")))
+
+	assert.Equal(t, [][]string{{
+		"1700000000.500000", "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		"10.0.0.2", "80", "10.0.0.1", "40000",
+		"1", "GET", "example.com", "/index.html?q=1", "-", "1.1", "curl/8.0",
+		"0", "0", "404", "NOT FOUND",
+	}}, readTSV(t, filepath.Join(dir, "http.log")))
+
+	assert.Equal(t, [][]string{{
+		"1700000000.500000", "-",
+		"10.0.0.1", "5000", "10.0.0.2", "53",
+		"udp", "7", "0.020000", "example.com", "A", "NOERROR",
+		"F", "F", "T", "T", "93.184.216.34", "300.000000",
+	}}, readTSV(t, filepath.Join(dir, "dns.log")))
+
+	tls := readTSV(t, filepath.Join(dir, "tls.log"))
+	if assert.Len(t, tls, 1) {
+		assert.Equal(t, []string{"-", "-", "example.com", "-", "F"}, tls[0][6:])
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTraffic(t, NewWriter(dir, JSON))
+
+	b, err := os.ReadFile(filepath.Join(dir, "dns.log"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &entry))
+	assert.Equal(t, 1700000000.5, entry["ts"])
+	assert.Equal(t, "10.0.0.1", entry["id.orig_h"])
+	assert.Equal(t, []interface{}{"93.184.216.34"}, entry["answers"])
+	assert.Equal(t, []interface{}{300.0}, entry["TTLs"])
+	// Unset fields are left out.
+	assert.NotContains(t, entry, "uid")
+}
@@ -54,10 +54,32 @@ type Buffer interface {
 	// storage, and r doesn't immediately report its EOF, ReadFrom will try to
 	// obtain additional storage from the pool before reading the EOF from r.
 	io.ReaderFrom
+
+	// Read(p) reads the next len(p) bytes from the buffer, or until the
+	// buffer is drained. Chunks that have been read entirely are returned to
+	// the pool.
+	//
+	// Returns the number of bytes read, and EOF if the buffer has no data and
+	// len(p) > 0.
+	io.Reader
+
+	// WriteTo(w) writes the unread portion of the buffer to w, one chunk at a
+	// time, returning chunks to the pool as they are written.
+	//
+	// Returns the number of bytes written and any error encountered during
+	// the write.
+	io.WriterTo
+
+	// Discards all but the first n unread bytes from the buffer, returning
+	// storage no longer needed to the pool. Panics if n is negative or greater
+	// than Len().
+	Truncate(n int)
 }
 
 var ErrEmptyPool = errors.New("mempool.Buffer: pool is empty")
 var errNegativeRead = errors.New("mempool.Buffer: reader returned negative count from Read")
+var errInvalidWrite = errors.New("mempool.Buffer: writer returned invalid count from Write")
+var errTruncateOutOfRange = errors.New("mempool.Buffer: truncation out of range")
 
 type buffer struct {
 	pool bufferPool
@@ -77,9 +99,6 @@ type buffer struct {
 	//   - readOffset == 0 when len(chunks) == 0.
 	//   - readOffset < pool.chunkSize_bytes when len(chunks) > 0.
 	//   - readOffset < writeOffset when len(chunks) == 1.
-	//
-	// XXX Currently not meaningfully used, since we read via Bytes(). This is
-	// here in case we want to implement io.Reader in the future.
 	readOffset int
 
 	// Contents of the buffer end at chunks[len(chunks)-1][writeOffset]
@@ -178,7 +197,7 @@ func (buf *buffer) Release() {
 	// Check representation invariants for the buffer's chunks.
 	buf.repOk()
 
-	buf.pool.release(buf.chunks)
+	buf.pool.releaseChunks(buf, 0)
 	buf.chunks = nil
 	buf.readOffset = 0
 
@@ -225,6 +244,9 @@ func (buf *buffer) grow(n int) (chunkIdx, offset, availableBytes int) {
 		}
 		buf.chunks = append(buf.chunks, chunk)
 	}
+	if chunksObtained > 0 {
+		buf.pool.bufferGrew(buf)
+	}
 
 	if offset == buf.pool.chunkSize_bytes {
 		chunkIdx++
@@ -280,7 +302,7 @@ func (buf *buffer) ReadFrom(r io.Reader) (totalBytesCopied int64, err error) {
 		// Re-establish invariant: if we have an unused chunk, release it back to
 		// the pool.
 		if buf.writeOffset == 0 {
-			buf.pool.release([][]byte{buf.chunks[numChunks-1]})
+			buf.pool.releaseChunks(buf, numChunks-1)
 			buf.chunks = buf.chunks[:numChunks-1]
 			buf.writeOffset = buf.pool.chunkSize_bytes
 		}
@@ -312,3 +334,85 @@ func (buf *buffer) ReadFrom(r io.Reader) (totalBytesCopied int64, err error) {
 		}
 	}
 }
+
+// Returns the unread bytes in the first chunk.
+func (buf *buffer) head() []byte {
+	end := buf.pool.chunkSize_bytes
+	if len(buf.chunks) == 1 {
+		end = buf.writeOffset
+	}
+	return buf.chunks[0][buf.readOffset:end]
+}
+
+// Discards the first n unread bytes, returning chunks that are emptied to the
+// pool.
+func (buf *buffer) consume(n int) {
+	if n >= buf.Len() {
+		buf.Release()
+		return
+	}
+	buf.readOffset += n
+	if emptied := buf.readOffset / buf.pool.chunkSize_bytes; emptied > 0 {
+		buf.pool.releaseHead(buf, emptied)
+		buf.chunks = buf.chunks[emptied:]
+		buf.readOffset %= buf.pool.chunkSize_bytes
+	}
+}
+
+func (buf *buffer) Read(p []byte) (n int, err error) {
+	defer buf.repOk()
+
+	if len(buf.chunks) == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	for n < len(p) && len(buf.chunks) > 0 {
+		copied := copy(p[n:], buf.head())
+		n += copied
+		buf.consume(copied)
+	}
+	return n, nil
+}
+
+func (buf *buffer) WriteTo(w io.Writer) (totalBytesWritten int64, err error) {
+	defer buf.repOk()
+
+	for len(buf.chunks) > 0 {
+		head := buf.head()
+		bytesWritten, err := w.Write(head)
+		if bytesWritten < 0 || bytesWritten > len(head) {
+			panic(errInvalidWrite)
+		}
+		totalBytesWritten += int64(bytesWritten)
+		buf.consume(bytesWritten)
+		if err != nil {
+			return totalBytesWritten, err
+		}
+		if bytesWritten < len(head) {
+			return totalBytesWritten, io.ErrShortWrite
+		}
+	}
+	return totalBytesWritten, nil
+}
+
+func (buf *buffer) Truncate(n int) {
+	defer buf.repOk()
+
+	if n < 0 || n > buf.Len() {
+		panic(errTruncateOutOfRange)
+	}
+	if n == 0 {
+		buf.Release()
+		return
+	}
+
+	end := buf.readOffset + n
+	keep := (end + buf.pool.chunkSize_bytes - 1) / buf.pool.chunkSize_bytes
+	if keep < len(buf.chunks) {
+		buf.pool.releaseChunks(buf, keep)
+		buf.chunks = buf.chunks[:keep]
+	}
+	buf.writeOffset = end - (keep-1)*buf.pool.chunkSize_bytes
+}
@@ -2,6 +2,8 @@ package mempool
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
 // A factory of variable-sized buffers whose backing storage is drawn from a
@@ -10,11 +12,69 @@ import (
 type BufferPool interface {
 	// Returns a new empty buffer
 	NewBuffer() Buffer
+
+	// Returns a snapshot of the pool's usage.
+	Stats() PoolStats
+
+	// Calls f whenever the fraction of chunks in use rises to threshold or
+	// above, or falls back below it. f is called from the goroutine whose
+	// allocation or release crossed the threshold, and must not block. Replaces
+	// any callback set before; a nil f removes it.
+	OnUtilization(threshold float64, f func(PoolStats))
+
+	// Starts reporting buffers that hold chunks for too long, as configured
+	// by opts, until stop is called.
+	DetectLeaks(opts LeakOptions) (stop func())
+
+	// Changes the size of the pool to up to maxPoolSize_bytes of chunks.
+	// Growing allocates the new chunks at once. When shrinking, free chunks
+	// are dropped at once, and chunks held by buffers as they are released,
+	// until the pool is down to size.
+	Resize(maxPoolSize_bytes int64) error
+}
+
+// The usage of a BufferPool.
+type PoolStats struct {
+	// The size of each chunk, in bytes.
+	ChunkSize int
+
+	// The number of chunks in the pool, and how many are not held by any
+	// buffer.
+	TotalChunks int
+	FreeChunks  int
+
+	// The most chunks held by buffers at once.
+	HighWaterChunks int
+
+	// The most chunks held by a single buffer.
+	LargestBufferChunks int
+
+	// The number of times a buffer needed a chunk while the pool was empty,
+	// i.e. how often ErrEmptyPool was returned.
+	FailedAllocations uint64
+
+	// The number of chunks allocated from the heap because the pool was
+	// empty, in total and currently held. See WithHeapOverflow.
+	OverflowAllocations uint64
+	OverflowChunks      int
+}
+
+// Returns the fraction of chunks held by buffers, between 0 and 1.
+func (s PoolStats) Utilization() float64 {
+	if s.TotalChunks == 0 {
+		return 0
+	}
+	return float64(s.TotalChunks-s.FreeChunks) / float64(s.TotalChunks)
 }
 
 // Creates a new buffer pool. Up to maxPoolSize_bytes of buffer chunks will be
 // pooled. Each buffer chunk will have size chunkSize_bytes.
-func MakeBufferPool(maxPoolSize_bytes int64, chunkSize_bytes int64) (BufferPool, error) {
+func MakeBufferPool(maxPoolSize_bytes int64, chunkSize_bytes int64, opt ...Option) (BufferPool, error) {
+	opts := NewOptions()
+	for _, o := range opt {
+		o(&opts)
+	}
+
 	if chunkSize_bytes < 1 {
 		return nil, fmt.Errorf("invalid chunkSize_bytes %d", chunkSize_bytes)
 	}
@@ -22,24 +82,72 @@ func MakeBufferPool(maxPoolSize_bytes int64, chunkSize_bytes int64) (BufferPool,
 		return nil, fmt.Errorf("invalid maxPoolSize_bytes %d", maxPoolSize_bytes)
 	}
 
-	numChunks := maxPoolSize_bytes / chunkSize_bytes
-	chunks := make(chan []byte, numChunks)
-	for count := 0; count < int(numChunks); count++ {
-		chunks <- make([]byte, chunkSize_bytes)
-	}
-
-	return bufferPool{
-		chunks:          chunks,
+	pool := bufferPool{
+		chunks:          &chunkStore{},
 		chunkSize_bytes: int(chunkSize_bytes),
-	}, nil
+		stats:           &poolCounters{},
+	}
+	pool.chunks.resize(int(maxPoolSize_bytes/chunkSize_bytes), pool.chunkSize_bytes)
+	if n := opts.MaxOverflowBytes / chunkSize_bytes; n > 0 {
+		pool.overflow = &heapOverflow{
+			maxChunks: n,
+			chunks:    map[*byte]struct{}{},
+		}
+	}
+	return pool, nil
 }
 
 type bufferPool struct {
 	// Stores all available chunks.
-	chunks chan []byte
+	chunks *chunkStore
 
 	// The size of each chunk, in bytes.
 	chunkSize_bytes int
+
+	// Shared by all copies of the pool.
+	stats *poolCounters
+
+	// Nil unless chunks may be allocated from the heap when the pool is empty.
+	overflow *heapOverflow
+}
+
+// Chunks allocated from the heap.
+type heapOverflow struct {
+	maxChunks int64
+
+	// Updated atomically.
+	inUse       int64
+	allocations uint64
+
+	mu sync.Mutex
+	// The chunks in use, by their first byte.
+	chunks map[*byte]struct{}
+}
+
+// The chunks of a pool.
+type chunkStore struct {
+	mu   sync.Mutex
+	free [][]byte
+
+	// The number of chunks of the pool, free or held by buffers, and the
+	// number there should be. They differ after the pool shrinks, until
+	// enough chunks are released.
+	total, target int
+}
+
+// Updated atomically.
+type poolCounters struct {
+	highWater           int64
+	largestBuffer       int64
+	failedAllocations   uint64
+	aboveThreshold      int32
+	utilizationCallback atomic.Value // of *utilizationCallback
+	leaks               atomic.Value // of *leakTracker
+}
+
+type utilizationCallback struct {
+	threshold float64
+	f         func(PoolStats)
 }
 
 var _ BufferPool = (*bufferPool)(nil)
@@ -48,29 +156,193 @@ func (pool bufferPool) NewBuffer() Buffer {
 	return newBuffer(pool)
 }
 
+func (pool bufferPool) Stats() PoolStats {
+	free, total := pool.chunks.counts()
+	s := PoolStats{
+		ChunkSize:           pool.chunkSize_bytes,
+		TotalChunks:         total,
+		FreeChunks:          free,
+		HighWaterChunks:     int(atomic.LoadInt64(&pool.stats.highWater)),
+		LargestBufferChunks: int(atomic.LoadInt64(&pool.stats.largestBuffer)),
+		FailedAllocations:   atomic.LoadUint64(&pool.stats.failedAllocations),
+	}
+	if pool.overflow != nil {
+		s.OverflowAllocations = atomic.LoadUint64(&pool.overflow.allocations)
+		s.OverflowChunks = int(atomic.LoadInt64(&pool.overflow.inUse))
+	}
+	return s
+}
+
+func (pool bufferPool) OnUtilization(threshold float64, f func(PoolStats)) {
+	var cb *utilizationCallback
+	if f != nil {
+		cb = &utilizationCallback{threshold: threshold, f: f}
+	}
+	atomic.StoreInt32(&pool.stats.aboveThreshold, 0)
+	pool.stats.utilizationCallback.Store(cb)
+	pool.checkUtilization(pool.chunks.counts())
+}
+
+func (pool bufferPool) Resize(maxPoolSize_bytes int64) error {
+	if maxPoolSize_bytes < int64(pool.chunkSize_bytes) {
+		return fmt.Errorf("invalid maxPoolSize_bytes %d", maxPoolSize_bytes)
+	}
+	pool.checkUtilization(pool.chunks.resize(int(maxPoolSize_bytes/int64(pool.chunkSize_bytes)), pool.chunkSize_bytes))
+	return nil
+}
+
 // Obtains a chunk from the pool. Returns nil if the pool is empty.
 func (pool bufferPool) getChunk() []byte {
-	select {
-	case result := <-pool.chunks:
-		for i := range result {
-			result[i] = 0
+	result, free, total := pool.chunks.get()
+	if result == nil {
+		if chunk := pool.overflow.get(pool.chunkSize_bytes); chunk != nil {
+			return chunk
 		}
-		return result
-	default:
+		atomic.AddUint64(&pool.stats.failedAllocations, 1)
+		return nil
+	}
+	for i := range result {
+		result[i] = 0
+	}
+	raiseTo(&pool.stats.highWater, int64(total-free))
+	pool.checkUtilization(free, total)
+	return result
+}
+
+// Takes a free chunk, if there is one, and returns it with the counts that
+// result.
+func (s *chunkStore) get() (chunk []byte, free, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.free); n > 0 {
+		chunk = s.free[n-1]
+		s.free[n-1] = nil
+		s.free = s.free[:n-1]
+	}
+	return chunk, len(s.free), s.total
+}
+
+// Takes back a chunk, or drops it if there are more than the target. Returns
+// the resulting counts.
+func (s *chunkStore) put(chunk []byte) (free, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.total > s.target {
+		s.total--
+	} else if len(s.free) < s.total {
+		s.free = append(s.free, chunk)
+	}
+	return len(s.free), s.total
+}
+
+// Replaces n chunks that will never be returned. Returns the resulting counts.
+func (s *chunkStore) replace(n, size int) (free, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ; n > 0; n-- {
+		if s.total > s.target {
+			s.total--
+		} else if len(s.free) < s.total {
+			s.free = append(s.free, make([]byte, size))
+		}
+	}
+	return len(s.free), s.total
+}
+
+// Sets the target number of chunks, allocating or dropping free chunks to
+// reach it. Returns the resulting counts.
+func (s *chunkStore) resize(target, size int) (free, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.target = target
+	for s.total < s.target {
+		s.free = append(s.free, make([]byte, size))
+		s.total++
+	}
+	for s.total > s.target && len(s.free) > 0 {
+		s.free[len(s.free)-1] = nil
+		s.free = s.free[:len(s.free)-1]
+		s.total--
+	}
+	return len(s.free), s.total
+}
+
+func (s *chunkStore) counts() (free, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.free), s.total
+}
+
+// Allocates a chunk from the heap, unless o is nil or at its limit.
+func (o *heapOverflow) get(size int) []byte {
+	if o == nil {
+		return nil
+	}
+	if atomic.AddInt64(&o.inUse, 1) > o.maxChunks {
+		atomic.AddInt64(&o.inUse, -1)
 		return nil
 	}
+	atomic.AddUint64(&o.allocations, 1)
+	chunk := make([]byte, size)
+	o.mu.Lock()
+	o.chunks[&chunk[0]] = struct{}{}
+	o.mu.Unlock()
+	return chunk
+}
+
+// Forgets chunk if it was allocated from the heap, and reports whether it was.
+func (o *heapOverflow) put(chunk []byte) bool {
+	if o == nil || atomic.LoadInt64(&o.inUse) == 0 || len(chunk) == 0 {
+		return false
+	}
+	o.mu.Lock()
+	_, ok := o.chunks[&chunk[0]]
+	delete(o.chunks, &chunk[0])
+	o.mu.Unlock()
+	if ok {
+		atomic.AddInt64(&o.inUse, -1)
+	}
+	return ok
+}
+
+// Records that buf obtained more chunks.
+func (pool bufferPool) bufferGrew(buf *buffer) {
+	raiseTo(&pool.stats.largestBuffer, int64(len(buf.chunks)))
+	pool.trackChunks(buf, len(buf.chunks))
+}
+
+// Calls the utilization callback if the counts of chunks put the pool on the
+// other side of its threshold from the last call.
+func (pool bufferPool) checkUtilization(free, total int) {
+	cb, _ := pool.stats.utilizationCallback.Load().(*utilizationCallback)
+	if cb == nil || total == 0 {
+		return
+	}
+	var above int32
+	if float64(total-free)/float64(total) >= cb.threshold {
+		above = 1
+	}
+	if atomic.CompareAndSwapInt32(&pool.stats.aboveThreshold, 1-above, above) {
+		cb.f(pool.Stats())
+	}
+}
+
+// Sets *v to n if n is larger.
+func raiseTo(v *int64, n int64) {
+	for {
+		old := atomic.LoadInt64(v)
+		if n <= old || atomic.CompareAndSwapInt64(v, old, n) {
+			return
+		}
+	}
 }
 
 // Releases the given chunks back to the pool.
 func (pool bufferPool) release(chunks [][]byte) {
-	// Avoid blocking, in case we somehow end up releasing more chunks than were
-	// initially allocated for the pool.
 	for _, chunk := range chunks {
-		select {
-		case pool.chunks <- chunk:
+		if pool.overflow.put(chunk) {
 			continue
-		default:
-			return
 		}
+		pool.checkUtilization(pool.chunks.put(chunk))
 	}
 }
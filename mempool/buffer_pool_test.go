@@ -2,8 +2,10 @@ package mempool
 
 import (
 	"bytes"
+	"io"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/mel2oo/go-pcap/memview"
@@ -389,3 +391,159 @@ var readWriteTests = []testCase{
 		},
 	},
 }
+
+func TestPoolStats(t *testing.T) {
+	pool, err := MakeBufferPool(4*16, 16)
+	assert.NoError(t, err)
+
+	var crossings []PoolStats
+	pool.OnUtilization(0.5, func(s PoolStats) {
+		crossings = append(crossings, s)
+	})
+
+	a, b := pool.NewBuffer(), pool.NewBuffer()
+	_, err = a.Write(make([]byte, 40))
+	assert.NoError(t, err)
+	assert.Equal(t, PoolStats{ChunkSize: 16, TotalChunks: 4, FreeChunks: 1, HighWaterChunks: 3, LargestBufferChunks: 3}, pool.Stats())
+
+	_, err = b.Write(make([]byte, 20))
+	assert.Equal(t, ErrEmptyPool, err)
+	stats := pool.Stats()
+	assert.Equal(t, 0, stats.FreeChunks)
+	assert.Equal(t, 4, stats.HighWaterChunks)
+	assert.Equal(t, uint64(1), stats.FailedAllocations)
+	assert.Equal(t, 1.0, stats.Utilization())
+
+	a.Release()
+	b.Release()
+	assert.Equal(t, 4, pool.Stats().FreeChunks)
+	assert.Equal(t, 4, pool.Stats().HighWaterChunks)
+
+	// Crossed upwards at the second chunk, and back down when a released its
+	// chunks.
+	if assert.Len(t, crossings, 2) {
+		assert.Equal(t, 2, crossings[0].TotalChunks-crossings[0].FreeChunks)
+		assert.Less(t, crossings[1].Utilization(), 0.5)
+	}
+}
+
+func TestDetectLeaks(t *testing.T) {
+	p, err := MakeBufferPool(4*16, 16)
+	assert.NoError(t, err)
+	pool := p.(bufferPool)
+
+	leaks := make(chan Leak, 1)
+	stop := pool.DetectLeaks(LeakOptions{MaxAge: time.Hour, Reclaim: true, Report: func(l Leak) { leaks <- l }})
+	defer stop()
+
+	leaked, released := pool.NewBuffer(), pool.NewBuffer()
+	_, err = leaked.Write(make([]byte, 20))
+	assert.NoError(t, err)
+	_, err = released.Write(make([]byte, 10))
+	assert.NoError(t, err)
+	released.Release()
+	assert.Equal(t, 2, pool.Stats().FreeChunks)
+
+	pool.checkLeaks(pool.leakTracker(), time.Now().Add(2*time.Hour))
+	select {
+	case l := <-leaks:
+		assert.Equal(t, 2, l.Chunks)
+		assert.Contains(t, l.Stack, "TestDetectLeaks")
+	case <-time.After(time.Second):
+		t.Fatal("leak not reported")
+	}
+
+	// The leaked chunks were replaced, and are not returned again.
+	assert.Equal(t, 4, pool.Stats().FreeChunks)
+	leaked.Release()
+	assert.Equal(t, 4, pool.Stats().FreeChunks)
+}
+
+func TestHeapOverflow(t *testing.T) {
+	pool, err := MakeBufferPool(2*16, 16, WithHeapOverflow(2*16))
+	assert.NoError(t, err)
+
+	a, b := pool.NewBuffer(), pool.NewBuffer()
+	n, err := a.Write(make([]byte, 64))
+	assert.NoError(t, err)
+	assert.Equal(t, 64, n)
+
+	// The pool and the overflow allowance are both used up.
+	_, err = b.Write([]byte{1})
+	assert.Equal(t, ErrEmptyPool, err)
+
+	stats := pool.Stats()
+	assert.Equal(t, 0, stats.FreeChunks)
+	assert.Equal(t, 2, stats.OverflowChunks)
+	assert.Equal(t, uint64(2), stats.OverflowAllocations)
+	assert.Equal(t, uint64(1), stats.FailedAllocations)
+
+	// Heap chunks are not added to the pool.
+	a.Release()
+	stats = pool.Stats()
+	assert.Equal(t, 2, stats.FreeChunks)
+	assert.Equal(t, 0, stats.OverflowChunks)
+}
+
+func TestReadWriteToTruncate(t *testing.T) {
+	CheckInvariants = true
+	pool, err := MakeBufferPool(8*4, 4)
+	assert.NoError(t, err)
+
+	data := []byte("0123456789abcdefghij")
+	buf := pool.NewBuffer()
+	_, err = buf.Write(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pool.Stats().FreeChunks)
+
+	// Reading returns emptied chunks to the pool.
+	p := make([]byte, 6)
+	n, err := buf.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "012345", string(p[:n]))
+	assert.Equal(t, 4, pool.Stats().FreeChunks)
+	assert.Equal(t, "6789abcdefghij", buf.Bytes().String())
+
+	buf.Truncate(7)
+	assert.Equal(t, "6789abc", buf.Bytes().String())
+	assert.Equal(t, 5, pool.Stats().FreeChunks)
+
+	// Writes continue after the truncated end.
+	_, err = buf.Write([]byte("XYZ"))
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	written, err := buf.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), written)
+	assert.Equal(t, "6789abcXYZ", out.String())
+	assert.Equal(t, 0, buf.Len())
+	assert.Equal(t, 8, pool.Stats().FreeChunks)
+
+	n, err = buf.Read(p)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, io.EOF, err)
+
+	assert.Panics(t, func() { buf.Truncate(1) })
+}
+
+func TestResize(t *testing.T) {
+	pool, err := MakeBufferPool(4*16, 16)
+	assert.NoError(t, err)
+	assert.Error(t, pool.Resize(15))
+
+	buf := pool.NewBuffer()
+	_, err = buf.Write(make([]byte, 48))
+	assert.NoError(t, err)
+
+	assert.NoError(t, pool.Resize(8*16))
+	assert.Equal(t, 8, pool.Stats().TotalChunks)
+	assert.Equal(t, 5, pool.Stats().FreeChunks)
+
+	// Chunks held by the buffer are dropped when it releases them.
+	assert.NoError(t, pool.Resize(2*16))
+	assert.Equal(t, 3, pool.Stats().TotalChunks)
+	assert.Equal(t, 0, pool.Stats().FreeChunks)
+	buf.Release()
+	assert.Equal(t, PoolStats{ChunkSize: 16, TotalChunks: 2, FreeChunks: 2, HighWaterChunks: 3, LargestBufferChunks: 3}, pool.Stats())
+}
@@ -0,0 +1,205 @@
+package mempool
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default age past which a buffer holding chunks is reported as leaked.
+const DefaultLeakAge = 10 * time.Minute
+
+// Settings of BufferPool.DetectLeaks.
+type LeakOptions struct {
+	// Buffers still holding chunks this long after obtaining their first are
+	// leaks. DefaultLeakAge if not positive.
+	MaxAge time.Duration
+
+	// Called once for each leaked buffer, from a goroutine of its own.
+	Report func(Leak)
+
+	// Whether to replace the chunks of leaked buffers in the pool. The leaked
+	// buffers keep their chunks, which are dropped rather than returned if
+	// they are released after all.
+	Reclaim bool
+}
+
+// A buffer that held chunks for longer than LeakOptions.MaxAge.
+type Leak struct {
+	Age    time.Duration
+	Chunks int
+
+	// Where the buffer obtained its first chunk.
+	Stack string
+}
+
+type leakTracker struct {
+	opts LeakOptions
+	stop chan struct{}
+
+	mu   sync.Mutex
+	live map[*buffer]*allocation
+}
+
+type allocation struct {
+	since time.Time
+	stack []uintptr
+
+	// The number of chunks held by the buffer, and how many of those, from
+	// the first, were replaced in the pool.
+	chunks    int
+	reclaimed int
+
+	reported bool
+}
+
+// Starts tracking which buffers hold chunks, and checking every half MaxAge
+// for leaks until stop is called. Meant for debugging: tracking records a
+// stack trace for every buffer that obtains chunks.
+func (pool bufferPool) DetectLeaks(opts LeakOptions) (stop func()) {
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultLeakAge
+	}
+	t := &leakTracker{
+		opts: opts,
+		stop: make(chan struct{}),
+		live: map[*buffer]*allocation{},
+	}
+	pool.stats.leaks.Store(t)
+
+	go func() {
+		ticker := time.NewTicker(opts.MaxAge / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				pool.checkLeaks(t, now)
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(t.stop)
+			pool.stats.leaks.Store((*leakTracker)(nil))
+		})
+	}
+}
+
+func (pool bufferPool) leakTracker() *leakTracker {
+	t, _ := pool.stats.leaks.Load().(*leakTracker)
+	return t
+}
+
+// Records that buf holds n chunks.
+func (pool bufferPool) trackChunks(buf *buffer, n int) {
+	t := pool.leakTracker()
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.live[buf]
+	if !ok {
+		// Skips runtime.Callers, this function, bufferGrew, grow and the
+		// buffer method.
+		pcs := make([]uintptr, 32)
+		a = &allocation{since: time.Now(), stack: pcs[:runtime.Callers(5, pcs)]}
+		t.live[buf] = a
+	}
+	a.chunks = n
+}
+
+// Returns the chunks of buf from index from onwards to the pool, except those
+// that were reclaimed.
+func (pool bufferPool) releaseChunks(buf *buffer, from int) {
+	if t := pool.leakTracker(); t != nil {
+		t.mu.Lock()
+		if a, ok := t.live[buf]; ok {
+			skip := a.reclaimed
+			if from == 0 {
+				delete(t.live, buf)
+			} else {
+				a.chunks = from
+				if a.reclaimed > from {
+					a.reclaimed = from
+				}
+			}
+			if skip > from {
+				from = skip
+			}
+		}
+		t.mu.Unlock()
+	}
+	pool.release(buf.chunks[from:])
+}
+
+// Returns the first n chunks of buf to the pool, except those that were
+// reclaimed.
+func (pool bufferPool) releaseHead(buf *buffer, n int) {
+	head := buf.chunks[:n]
+	if t := pool.leakTracker(); t != nil {
+		t.mu.Lock()
+		if a, ok := t.live[buf]; ok {
+			skip := a.reclaimed
+			if skip > n {
+				skip = n
+			}
+			a.reclaimed -= skip
+			a.chunks -= n
+			head = head[skip:]
+		}
+		t.mu.Unlock()
+	}
+	pool.release(head)
+}
+
+// Reports buffers that have held chunks for longer than MaxAge at now, and
+// replaces their chunks if reclaiming.
+func (pool bufferPool) checkLeaks(t *leakTracker, now time.Time) {
+	var leaks []Leak
+	replace := 0
+
+	t.mu.Lock()
+	for _, a := range t.live {
+		age := now.Sub(a.since)
+		if age < t.opts.MaxAge {
+			continue
+		}
+		if !a.reported {
+			a.reported = true
+			leaks = append(leaks, Leak{Age: age, Chunks: a.chunks, Stack: formatStack(a.stack)})
+		}
+		if t.opts.Reclaim && a.chunks > a.reclaimed {
+			replace += a.chunks - a.reclaimed
+			a.reclaimed = a.chunks
+		}
+	}
+	t.mu.Unlock()
+
+	if replace > 0 {
+		pool.checkUtilization(pool.chunks.replace(replace, pool.chunkSize_bytes))
+	}
+	if t.opts.Report != nil {
+		for _, l := range leaks {
+			go t.opts.Report(l)
+		}
+	}
+}
+
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			return b.String()
+		}
+	}
+}
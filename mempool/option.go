@@ -0,0 +1,22 @@
+package mempool
+
+type Options struct {
+	// Up to this many bytes of chunks may be allocated from the heap while
+	// the pool is empty, instead of failing with ErrEmptyPool. Such chunks are
+	// left to the garbage collector when released. 0 to disable.
+	MaxOverflowBytes int64
+}
+
+func NewOptions() Options {
+	return Options{}
+}
+
+type Option func(*Options)
+
+// Lets buffers obtain up to maxBytes of chunks from the heap when the pool is
+// exhausted, so that short bursts do not truncate their contents.
+func WithHeapOverflow(maxBytes int64) Option {
+	return func(o *Options) {
+		o.MaxOverflowBytes = maxBytes
+	}
+}
@@ -0,0 +1,126 @@
+package memview
+
+import "io"
+
+// Default size of the slices a MemViewBuilder copies data into.
+const DefaultBuilderChunkSize = 4096
+
+// MemViewBuilder accumulates written data into a MemView. Data is copied into
+// slices of a fixed size, which are filled before new ones are allocated, so
+// that many small writes produce few slices. For slices drawn from a
+// mempool.BufferPool, use a mempool.Buffer instead.
+//
+// The zero value is an empty builder ready to use, with
+// DefaultBuilderChunkSize slices.
+type MemViewBuilder struct {
+	chunkSize int
+	mv        MemView
+
+	// The unused capacity at the end of the last slice in mv.
+	free []byte
+}
+
+var (
+	_ io.Writer       = (*MemViewBuilder)(nil)
+	_ io.ByteWriter   = (*MemViewBuilder)(nil)
+	_ io.StringWriter = (*MemViewBuilder)(nil)
+	_ io.ReaderFrom   = (*MemViewBuilder)(nil)
+)
+
+// Creates a builder that copies data into slices of chunkSize bytes, or
+// DefaultBuilderChunkSize if chunkSize is not positive.
+func NewMemViewBuilder(chunkSize int) *MemViewBuilder {
+	return &MemViewBuilder{chunkSize: chunkSize}
+}
+
+// Returns the data written so far. Later writes do not modify the returned
+// MemView.
+func (b *MemViewBuilder) MemView() MemView {
+	return b.mv.DeepCopy()
+}
+
+func (b *MemViewBuilder) Len() int64 {
+	return b.mv.Len()
+}
+
+// Discards the data written so far. MemViews returned earlier stay valid.
+func (b *MemViewBuilder) Reset() {
+	b.mv = MemView{}
+	b.free = nil
+}
+
+// Write copies p to the end of the MemView. It always succeeds.
+func (b *MemViewBuilder) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if len(b.free) == 0 {
+			b.grow()
+		}
+		n := copy(b.free, p)
+		b.extend(n)
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (b *MemViewBuilder) WriteString(s string) (int, error) {
+	written := len(s)
+	for len(s) > 0 {
+		if len(b.free) == 0 {
+			b.grow()
+		}
+		n := copy(b.free, s)
+		b.extend(n)
+		s = s[n:]
+	}
+	return written, nil
+}
+
+func (b *MemViewBuilder) WriteByte(c byte) error {
+	if len(b.free) == 0 {
+		b.grow()
+	}
+	b.free[0] = c
+	b.extend(1)
+	return nil
+}
+
+// ReadFrom reads from r until EOF directly into the builder's slices.
+func (b *MemViewBuilder) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		if len(b.free) == 0 {
+			b.grow()
+		}
+		n, err := r.Read(b.free)
+		b.extend(n)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
+}
+
+// Adds an empty slice with chunkSize bytes of capacity to the end of mv.
+func (b *MemViewBuilder) grow() {
+	size := b.chunkSize
+	if size <= 0 {
+		size = DefaultBuilderChunkSize
+	}
+	chunk := make([]byte, 0, size)
+	b.mv.buf = append(b.mv.buf, chunk)
+	b.free = chunk[:size]
+}
+
+// Extends the last slice of mv over the next n bytes of free.
+func (b *MemViewBuilder) extend(n int) {
+	if n == 0 {
+		return
+	}
+	last := len(b.mv.buf) - 1
+	b.mv.buf[last] = b.mv.buf[last][:len(b.mv.buf[last])+n]
+	b.mv.length += int64(n)
+	b.free = b.free[n:]
+}
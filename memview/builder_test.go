@@ -0,0 +1,42 @@
+package memview
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemViewBuilder(t *testing.T) {
+	b := NewMemViewBuilder(4)
+	b.WriteString("hello")
+	b.WriteByte(' ')
+	snapshot := b.MemView()
+
+	b.Write([]byte("prince"))
+	n, err := b.ReadFrom(strings.NewReader(" is a good boy"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(14), n)
+
+	mv := b.MemView()
+	assert.Equal(t, "hello prince is a good boy", mv.String())
+	assert.Equal(t, int64(26), b.Len())
+	assert.Equal(t, int64(16), mv.Index(0, []byte("a good")))
+	for _, buf := range mv.buf {
+		assert.LessOrEqual(t, len(buf), 4)
+	}
+
+	assert.Equal(t, "hello ", snapshot.String())
+
+	b.Reset()
+	b.WriteString("bye")
+	assert.Equal(t, "bye", b.MemView().String())
+	assert.Equal(t, "hello prince is a good boy", mv.String())
+}
+
+func TestMemViewBuilderZeroValue(t *testing.T) {
+	var b MemViewBuilder
+	b.Write(make([]byte, DefaultBuilderChunkSize+1))
+	assert.Len(t, b.MemView().buf, 2)
+	assert.Equal(t, int64(DefaultBuilderChunkSize+1), b.Len())
+}
@@ -2,8 +2,14 @@ package memview
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"hash/crc32"
 	"io"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -24,8 +30,16 @@ import (
 type MemView struct {
 	buf    [][]byte
 	length int64
+
+	// If positive, Append compacts the MemView once it has more slices than
+	// this. See SetMaxChunks.
+	maxChunks int
 }
 
+// A chunk limit for MemViews that accumulate many small slices, such as one
+// per packet of a long-lived flow.
+const DefaultMaxChunks = 256
+
 // The new MemView does NOT make a copy of data, so the caller MUST ensure that
 // the underlying memory of data remains valid and unmodified after this call
 // returns.
@@ -47,6 +61,25 @@ func Empty() MemView {
 func (dst *MemView) Append(src MemView) {
 	dst.buf = append(dst.buf, src.buf...)
 	dst.length += src.length
+	if dst.maxChunks > 0 && len(dst.buf) > dst.maxChunks {
+		dst.Compact()
+	}
+}
+
+// Makes Append compact mv whenever it references more than n slices, which
+// keeps Index, SubView and the like from slowing down as data trickles in. The
+// limit is kept by SubViews and copies of mv. 0 disables compaction.
+func (mv *MemView) SetMaxChunks(n int) {
+	mv.maxChunks = n
+}
+
+// Copies the data referenced by mv into a single slice, so that mv no longer
+// references the slices it did.
+func (mv *MemView) Compact() {
+	if len(mv.buf) <= 1 {
+		return
+	}
+	mv.buf = [][]byte{mv.Bytes()}
 }
 
 // Creates a MemView that is completely independent from the current one.
@@ -54,8 +87,9 @@ func (mv MemView) DeepCopy() MemView {
 	newBuf := make([][]byte, len(mv.buf))
 	copy(newBuf, mv.buf)
 	return MemView{
-		buf:    newBuf,
-		length: mv.length,
+		buf:       newBuf,
+		length:    mv.length,
+		maxChunks: mv.maxChunks,
 	}
 }
 
@@ -159,7 +193,7 @@ func (mv MemView) GetUint32(offset int64) uint32 {
 // range is invalid.
 func (mv MemView) SubView(start, end int64) MemView {
 	if start >= end {
-		return MemView{}
+		return MemView{maxChunks: mv.maxChunks}
 	}
 
 	startBuf := -1
@@ -182,14 +216,15 @@ func (mv MemView) SubView(start, end int64) MemView {
 	}
 
 	if startBuf == -1 || endBuf == -1 {
-		return MemView{}
+		return MemView{maxChunks: mv.maxChunks}
 	}
 
 	newBuf := make([][]byte, endBuf+1-startBuf)
 	copy(newBuf, mv.buf[startBuf:endBuf+1])
 	newMS := MemView{
-		buf:    newBuf,
-		length: end - start,
+		buf:       newBuf,
+		length:    end - start,
+		maxChunks: mv.maxChunks,
 	}
 	if len(newMS.buf) == 1 {
 		newMS.buf[0] = newMS.buf[0][startOffset:endOffset]
@@ -225,79 +260,329 @@ func (mv MemView) Index(start int64, sep []byte) int64 {
 		return start
 	}
 
-	// Iteratively search for the target, keeping in mind that the target may be
-	// spread over multiple slices in mv.buf.
-	//
-	// TODO: this only works correctly for search strings that do not have a repeated
-	// prefix. To work correctly, we would have to back up to the point at which
-	// the needle *could* have started after an incomplete match.
-	//
-	// However, we only use this method to search for strings without a repeated prefix:
-	// GET, POST, DELETE, HEAD, PUT, PATCH, CONNECT, OPTIONS, TRACE, HTTP/1.1 and HTTP/1.0
-	needle := sep
-	needleIndex := 0
+	// Search each slice in mv.buf in turn. A match spread over several slices
+	// starts in the last len(sep)-1 bytes searched before the slice it ends
+	// in, and ends in that slice's first len(sep)-1 bytes, so those are
+	// searched together first.
+	var tail, window []byte
 	for b := startBuf; b < len(mv.buf); b++ {
+		haystack := mv.buf[b][startOffset:]
+		startOffset = 0
+
+		if len(tail) > 0 {
+			head := haystack
+			if len(head) > len(sep)-1 {
+				head = head[:len(sep)-1]
+			}
+			window = append(append(window[:0], tail...), head...)
+			if i := bytes.Index(window, sep); i >= 0 && i < len(tail) {
+				return currIndex - int64(len(tail)) + int64(i)
+			}
+		}
+
+		if i := bytes.Index(haystack, sep); i >= 0 {
+			return currIndex + int64(i)
+		}
+
+		if len(haystack) >= len(sep)-1 {
+			tail = append(tail[:0], haystack[len(haystack)-(len(sep)-1):]...)
+		} else {
+			tail = append(tail, haystack...)
+			if len(tail) > len(sep)-1 {
+				tail = append(tail[:0], tail[len(tail)-(len(sep)-1):]...)
+			}
+		}
+		currIndex += int64(len(haystack))
+	}
+
+	return -1
+}
+
+// LastIndex returns the index of the last instance of sep in mv, or -1 if sep
+// is not present in mv.
+func (mv MemView) LastIndex(sep []byte) int64 {
+	if len(sep) == 0 {
+		return mv.length
+	}
+
+	// Like Index, but from the end: a match spread over several slices ends in
+	// the first len(sep)-1 bytes searched after the slice it starts in. Such a
+	// match starts after any match within that slice.
+	var head, window []byte
+	end := mv.length
+	for b := len(mv.buf) - 1; b >= 0; b-- {
 		haystack := mv.buf[b]
-		// Check remainder of needle if overlap from last buffer
-		var i int = 0
-		for i = startOffset; i < len(haystack) && needleIndex > 0; i++ {
-			if haystack[i] == needle[needleIndex] {
-				needleIndex += 1
-				if needleIndex == len(needle) {
-					// Found, figure out start index.
-					// At the start of the 'i' loop, it points to currentIndex, so we
-					// need to add i and subtract startOffset.  Then move back to the
-					// first character in the needle
-					return currIndex + int64(i-startOffset) - int64(len(needle)-1)
-				}
-			} else {
-				needleIndex = 0
+		end -= int64(len(haystack))
+
+		if len(head) > 0 {
+			tail := haystack
+			if len(tail) > len(sep)-1 {
+				tail = tail[len(tail)-(len(sep)-1):]
+			}
+			window = append(append(window[:0], tail...), head...)
+			if i := bytes.LastIndex(window, sep); i >= 0 && i < len(tail) {
+				return end + int64(len(haystack)-len(tail)+i)
 			}
 		}
 
-		// Did we reach the end of the buffer already?
-		if i < len(haystack) {
-			// If not, efficient check of remaining portion of haystack
-			found := bytes.Index(haystack[i:], needle)
-			if found != -1 {
-				return currIndex + int64(found)
+		if i := bytes.LastIndex(haystack, sep); i >= 0 {
+			return end + int64(i)
+		}
+
+		if len(haystack) >= len(sep)-1 {
+			head = append(head[:0], haystack[:len(sep)-1]...)
+		} else {
+			head = append(append([]byte(nil), haystack...), head...)
+			if len(head) > len(sep)-1 {
+				head = head[:len(sep)-1]
 			}
+		}
+	}
+	return -1
+}
 
-			// Check the end of the haystack for the start of the needle
-			// (but not the whole thing, or we would have found it in the call above.)
-			needleStart := len(haystack) - len(needle) + 1
-			if i < needleStart {
-				i = needleStart
+// IndexAny returns the index of the first instance of any of seps in mv after
+// start index, and the position in seps of the one found, or -1 and -1 if none
+// is present. Of needles found at the same index, the first in seps is
+// returned. All needles are searched for in a single pass over mv.
+func (mv MemView) IndexAny(start int64, seps ...[]byte) (index int64, which int) {
+	var first [256]bool
+	for i, sep := range seps {
+		if len(sep) == 0 {
+			if index := mv.Index(start, nil); index >= 0 {
+				return index, i
 			}
-			for ; i < len(haystack); i++ {
-				if haystack[i] == needle[needleIndex] {
-					needleIndex += 1
-				} else {
-					needleIndex = 0
-				}
+			return -1, -1
+		}
+		first[sep[0]] = true
+	}
+
+	which = -1
+	index = mv.scan(start, func(b, i int) bool {
+		if !first[mv.buf[b][i]] {
+			return false
+		}
+		for j, sep := range seps {
+			if mv.equalAt(b, i, sep, false) {
+				which = j
+				return true
 			}
 		}
+		return false
+	})
+	return index, which
+}
 
-		// Searched all of buffer
-		currIndex += int64(len(haystack) - startOffset)
-		startOffset = 0
+// IndexFold is like Index, but treats ASCII letters as equal regardless of
+// case.
+func (mv MemView) IndexFold(start int64, sep []byte) int64 {
+	if len(sep) == 0 {
+		return mv.Index(start, sep)
 	}
+	lower, upper := toLowerASCII(sep[0]), toUpperASCII(sep[0])
+	return mv.scan(start, func(b, i int) bool {
+		c := mv.buf[b][i]
+		return (c == lower || c == upper) && mv.equalAt(b, i, sep, true)
+	})
+}
 
+// Calls f with the slice and offset of each byte from start onwards, until f
+// returns true. Returns the index of the byte for which it did, or -1.
+func (mv MemView) scan(start int64, f func(b, i int) bool) int64 {
+	if start < 0 {
+		start = 0
+	}
+	var index int64
+	for b, buf := range mv.buf {
+		if index+int64(len(buf)) <= start {
+			index += int64(len(buf))
+			continue
+		}
+		from := 0
+		if index < start {
+			from = int(start - index)
+		}
+		for i := from; i < len(buf); i++ {
+			if f(b, i) {
+				return index + int64(i)
+			}
+		}
+		index += int64(len(buf))
+	}
 	return -1
 }
 
+// Reports whether sep occurs at offset i of slice b, possibly continuing into
+// the slices after it.
+func (mv MemView) equalAt(b, i int, sep []byte, fold bool) bool {
+	for len(sep) > 0 {
+		if b >= len(mv.buf) {
+			return false
+		}
+		buf := mv.buf[b][i:]
+		n := len(buf)
+		if n > len(sep) {
+			n = len(sep)
+		}
+		if fold {
+			if !equalFoldASCII(buf[:n], sep[:n]) {
+				return false
+			}
+		} else if !bytes.Equal(buf[:n], sep[:n]) {
+			return false
+		}
+		sep = sep[n:]
+		b, i = b+1, 0
+	}
+	return true
+}
+
+func equalFoldASCII(a, b []byte) bool {
+	for i := range a {
+		if toLowerASCII(a[i]) != toLowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func toUpperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - ('a' - 'A')
+	}
+	return c
+}
+
+// ReadAt copies the len(p) bytes starting at index off into p, implementing
+// io.ReaderAt. Returns io.EOF if fewer bytes are available.
+func (mv MemView) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("MemView.ReadAt: negative offset")
+	}
+	var index int64
+	for _, buf := range mv.buf {
+		if n == len(p) {
+			break
+		}
+		if index+int64(len(buf)) <= off {
+			index += int64(len(buf))
+			continue
+		}
+		from := 0
+		if index < off {
+			from = int(off - index)
+		}
+		n += copy(p[n:], buf[from:])
+		index += int64(len(buf))
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Writes the data referenced by mv to h, slice by slice, and returns the
+// resulting sum appended to b. Nothing is copied along the way.
+func (mv MemView) Sum(h hash.Hash, b []byte) []byte {
+	mv.Chunks(func(buf []byte) bool {
+		h.Write(buf)
+		return true
+	})
+	return h.Sum(b)
+}
+
+func (mv MemView) SHA256() (sum [sha256.Size]byte) {
+	mv.Sum(sha256.New(), sum[:0])
+	return sum
+}
+
+func (mv MemView) MD5() (sum [md5.Size]byte) {
+	mv.Sum(md5.New(), sum[:0])
+	return sum
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Returns the CRC-32 checksum of the data using the Castagnoli polynomial, as
+// used by iSCSI, SCTP and ext4.
+func (mv MemView) CRC32C() uint32 {
+	var crc uint32
+	mv.Chunks(func(buf []byte) bool {
+		crc = crc32.Update(crc, castagnoliTable, buf)
+		return true
+	})
+	return crc
+}
+
+// Calls yield with each non-empty slice of the data referenced by mv, in order,
+// until it returns false. The slices are not copies: yield must not modify
+// them, or keep them longer than the underlying memory remains valid.
+func (mv MemView) Chunks(yield func([]byte) bool) {
+	for _, buf := range mv.buf {
+		if len(buf) > 0 && !yield(buf) {
+			return
+		}
+	}
+}
+
+// WriteTo writes the data referenced by mv to w slice by slice, without
+// copying it, implementing io.WriterTo.
+func (mv MemView) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var err error
+	mv.Chunks(func(buf []byte) bool {
+		var n int
+		n, err = w.Write(buf)
+		written += int64(n)
+		return err == nil
+	})
+	return written, err
+}
+
 // Returns a string of all the data referenced by this MemView. Note that is
-// creates a COPY of the underlying data.
+// creates a COPY of the underlying data; prefer Chunks or WriteTo in hot paths.
 func (mv MemView) String() string {
-	var buf bytes.Buffer
-	io.Copy(&buf, mv.CreateReader())
-	return buf.String()
+	var b strings.Builder
+	b.Grow(int(mv.length))
+	mv.Chunks(func(buf []byte) bool {
+		b.Write(buf)
+		return true
+	})
+	return b.String()
 }
 
+// Returns a copy of all the data referenced by this MemView.
 func (mv MemView) Bytes() []byte {
-	var buf bytes.Buffer
-	io.Copy(&buf, mv.CreateReader())
-	return buf.Bytes()
+	if mv.length == 0 {
+		return nil
+	}
+	b := make([]byte, 0, mv.length)
+	mv.Chunks(func(buf []byte) bool {
+		b = append(b, buf...)
+		return true
+	})
+	return b
+}
+
+// Marshals the data like a []byte, as a base64 string.
+func (mv MemView) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mv.Bytes())
+}
+
+func (mv *MemView) UnmarshalJSON(data []byte) error {
+	var b []byte
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	*mv = New(b)
+	return nil
 }
 
 type MemViewReader struct {
@@ -314,6 +599,7 @@ type MemViewReader struct {
 }
 
 var _ io.ReadSeeker = (*MemViewReader)(nil)
+var _ io.ReaderAt = (*MemViewReader)(nil)
 
 func (r *MemViewReader) ReadByte() (byte, error) {
 	if r.rIndex >= len(r.mv.buf) {
@@ -561,6 +847,42 @@ func (r *MemViewReader) Seek(offset int64, whence int) (absoluteOffset int64, er
 	}
 }
 
+// ReadAt reads from the view at the given offset from its start, as
+// MemView.ReadAt does, without moving the reader.
+func (r *MemViewReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.mv.ReadAt(p, off)
+}
+
+// Returns a reader over the unread portion of the view as it is now, for
+// random access. Unlike a MemViewReader, it has no position, so it may be
+// used from several goroutines at once, and later changes to the view do not
+// affect it. The underlying data must not be modified.
+func (r *MemViewReader) Snapshot() *SnapshotReader {
+	return &SnapshotReader{mv: r.mv.SubView(r.gOffset, r.mv.length)}
+}
+
+// An immutable view of data, for concurrent random access. See
+// MemViewReader.Snapshot.
+type SnapshotReader struct {
+	mv MemView
+}
+
+var _ io.ReaderAt = (*SnapshotReader)(nil)
+
+func (s *SnapshotReader) ReadAt(p []byte, off int64) (int, error) {
+	return s.mv.ReadAt(p, off)
+}
+
+func (s *SnapshotReader) Size() int64 {
+	return s.mv.length
+}
+
+// Returns a reader of n bytes starting at off, with the usual Read and Seek.
+// Each goroutine should use a section of its own.
+func (s *SnapshotReader) Section(off, n int64) *io.SectionReader {
+	return io.NewSectionReader(s, off, n)
+}
+
 // Returns a copy of this MemViewReader, except the underlying MemView is a
 // subview from the current position to the given relative offset. Returns an
 // error if the offset is negative or is past the end of the current MemView.
@@ -576,15 +898,7 @@ func (r *MemViewReader) Truncate(offset int64) (*MemViewReader, error) {
 
 // Make MemView more efficient as a source in io.Copy.
 func (r *MemViewReader) WriteTo(dst io.Writer) (int64, error) {
-	var bytesWritten int64
-	for _, b := range r.mv.buf {
-		n, err := dst.Write(b)
-		bytesWritten += int64(n)
-		if err != nil {
-			return bytesWritten, err
-		}
-	}
-	return bytesWritten, nil
+	return r.mv.WriteTo(dst)
 }
 
 func (left MemView) Equal(right MemView) bool {
@@ -2,15 +2,20 @@ package memview
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
 )
 
 var errWriterErr = fmt.Errorf("errWriter: you've requested an error")
@@ -731,15 +736,27 @@ func TestIndex(t *testing.T) {
 			start:    int64(len("<pattern> abc <pattern>") + 100),
 			expected: -1,
 		},
-		/*
-			{
-				name:     "partial match",
-				input:    "xxxxxyy",
-				pattern:  "xxxyy",
-				start:    0,
-				expected: 2,
-			},
-		*/
+		{
+			name:     "partial match",
+			input:    "xxxxxyy",
+			pattern:  "xxxyy",
+			start:    0,
+			expected: 2,
+		},
+		{
+			name:     "partial match with repeated needle",
+			input:    "abaabababbabab",
+			pattern:  "ababb",
+			start:    1,
+			expected: 5,
+		},
+		{
+			name:     "overlapping matches",
+			input:    "--a--a--a",
+			pattern:  "--a--",
+			start:    1,
+			expected: 3,
+		},
 	}
 
 	for _, c := range testCases {
@@ -773,6 +790,112 @@ func TestIndex(t *testing.T) {
 	}
 }
 
+// Calls f with input split into four MemViews in every possible way.
+func forEachSplit(input string, f func(MemView)) {
+	for i := 0; i <= len(input); i++ {
+		for j := i; j <= len(input); j++ {
+			for k := j; k <= len(input); k++ {
+				var mv MemView
+				mv.Append(New([]byte(input[:i])))
+				mv.Append(New([]byte(input[i:j])))
+				mv.Append(New([]byte(input[j:k])))
+				mv.Append(New([]byte(input[k:])))
+				f(mv)
+			}
+		}
+	}
+}
+
+func TestLastIndex(t *testing.T) {
+	input := "abaabababbababb"
+	for _, pattern := range []string{"ababb", "ab", "b", "aa", "abaab", "x", "abaabababbababbx"} {
+		forEachSplit(input, func(mv MemView) {
+			assert.Equal(t, int64(strings.LastIndex(input, pattern)), mv.LastIndex([]byte(pattern)), pattern)
+		})
+	}
+}
+
+func TestIndexFold(t *testing.T) {
+	input := "Content-TYPE: x\r\ncontent-type: y"
+	for _, c := range []struct {
+		pattern  string
+		start    int64
+		expected int64
+	}{
+		{"content-type", 0, 0},
+		{"CONTENT-type", 1, 17},
+		{"type:", 0, 8},
+		{"content-types", 0, -1},
+	} {
+		forEachSplit(input, func(mv MemView) {
+			assert.Equal(t, c.expected, mv.IndexFold(c.start, []byte(c.pattern)), c.pattern)
+		})
+	}
+}
+
+func TestIndexAny(t *testing.T) {
+	input := "xxPUTxPOSTxGET"
+	needles := [][]byte{[]byte("GET"), []byte("POST"), []byte("PUT"), []byte("PU")}
+	for _, c := range []struct {
+		start int64
+		index int64
+		which int
+	}{
+		{0, 2, 2},
+		{3, 6, 1},
+		{7, 11, 0},
+		{12, -1, -1},
+	} {
+		forEachSplit(input, func(mv MemView) {
+			index, which := mv.IndexAny(c.start, needles...)
+			assert.Equal(t, c.index, index)
+			assert.Equal(t, c.which, which)
+		})
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	input := "0123456789"
+	forEachSplit(input, func(mv MemView) {
+		r := mv.CreateReader()
+		_, err := r.Seek(2, io.SeekStart)
+		assert.NoError(t, err)
+
+		p := make([]byte, 4)
+		n, err := r.ReadAt(p, 5)
+		assert.NoError(t, err)
+		assert.Equal(t, "5678", string(p[:n]))
+
+		n, err = r.ReadAt(p, 8)
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, "89", string(p[:n]))
+
+		_, err = r.ReadAt(p, -1)
+		assert.Error(t, err)
+
+		// The reader has not moved.
+		b, err := r.ReadByte()
+		assert.NoError(t, err)
+		assert.Equal(t, byte('2'), b)
+
+		snapshot := r.Snapshot()
+		mv.Append(New([]byte("abc")))
+		assert.Equal(t, int64(7), snapshot.Size())
+		section, err := io.ReadAll(snapshot.Section(5, 10))
+		assert.NoError(t, err)
+		assert.Equal(t, "89", string(section))
+	})
+}
+
+func TestHashes(t *testing.T) {
+	input := "The quick brown fox"
+	forEachSplit(input, func(mv MemView) {
+		assert.Equal(t, sha256.Sum256([]byte(input)), mv.SHA256())
+		assert.Equal(t, md5.Sum([]byte(input)), mv.MD5())
+		assert.Equal(t, crc32.Checksum([]byte(input), crc32.MakeTable(crc32.Castagnoli)), mv.CRC32C())
+	})
+}
+
 func BenchmarkIndexSmall(b *testing.B) {
 	letterBytes := []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz")
 	bytes1 := make([]byte, 1400)
@@ -815,3 +938,62 @@ func BenchmarkIndexLarge(b *testing.B) {
 		view.Index(0, []byte("OPTION"))
 	}
 }
+
+func TestChunks(t *testing.T) {
+	var mv MemView
+	mv.Append(New([]byte("hello")))
+	mv.Append(New(nil))
+	mv.Append(New([]byte(" prince!")))
+
+	var chunks []string
+	mv.Chunks(func(b []byte) bool {
+		chunks = append(chunks, string(b))
+		return true
+	})
+	assert.Equal(t, []string{"hello", " prince!"}, chunks)
+
+	chunks = nil
+	mv.SubView(3, 9).Chunks(func(b []byte) bool {
+		chunks = append(chunks, string(b))
+		return false
+	})
+	assert.Equal(t, []string{"lo"}, chunks)
+
+	var buf bytes.Buffer
+	n, err := mv.SubView(3, 9).WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Equal(t, "lo pri", buf.String())
+
+	assert.Equal(t, "hello prince!", mv.String())
+	assert.Equal(t, []byte("hello prince!"), mv.Bytes())
+	assert.Nil(t, Empty().Bytes())
+}
+
+func TestCompact(t *testing.T) {
+	var mv MemView
+	mv.SetMaxChunks(3)
+	for _, s := range []string{"he", "ll", "o ", "pr"} {
+		mv.Append(New([]byte(s)))
+	}
+	assert.Len(t, mv.buf, 1)
+	assert.Equal(t, "hello pr", mv.String())
+
+	sub := mv.SubView(1, 8)
+	for _, s := range []string{"in", "ce"} {
+		sub.Append(New([]byte(s)))
+	}
+	assert.Len(t, sub.buf, 3)
+	sub.Append(New([]byte("!")))
+	assert.Len(t, sub.buf, 1)
+	assert.Equal(t, "ello prince!", sub.String())
+
+	var unlimited MemView
+	for i := 0; i < 10; i++ {
+		unlimited.Append(New([]byte{'x'}))
+	}
+	assert.Len(t, unlimited.buf, 10)
+	unlimited.Compact()
+	assert.Len(t, unlimited.buf, 1)
+	assert.Equal(t, int64(10), unlimited.Len())
+}
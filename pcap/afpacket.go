@@ -0,0 +1,33 @@
+package pcap
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Defaults of the AF_PACKET ring, the same as gopacket/afpacket's.
+const (
+	DefaultAFPacketBlockSize    = 128 * afpacketFrameSize
+	DefaultAFPacketNumBlocks    = 128
+	DefaultAFPacketBlockTimeout = 64 * time.Millisecond
+)
+
+// Size of the frames that blocks of the ring are divided into.
+const afpacketFrameSize = 4096
+
+// Checks the ring settings, which the kernel would otherwise only reject once
+// the socket is opened.
+func (r *AFPacketReader) validate() error {
+	pageSize := os.Getpagesize()
+	switch {
+	case r.BlockSize <= 0 || r.BlockSize%pageSize != 0 || r.BlockSize%afpacketFrameSize != 0:
+		return fmt.Errorf("AF_PACKET block size %d is not a multiple of the page size %d and frame size %d",
+			r.BlockSize, pageSize, afpacketFrameSize)
+	case r.NumBlocks < 1:
+		return fmt.Errorf("AF_PACKET ring needs at least 1 block, not %d", r.NumBlocks)
+	case r.BlockTimeout < time.Millisecond:
+		return fmt.Errorf("AF_PACKET block timeout %v is shorter than 1ms", r.BlockTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+//go:build linux && cgo
+
+package pcap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Read packets from a device through an AF_PACKET (TPACKET_V3) memory-mapped
+// ring. The kernel hands over blocks of packets at a time instead of one per
+// system call, so fewer packets are dropped under load than with libpcap.
+// Linux only.
+type AFPacketReader struct {
+	// Device to capture from. Empty or "any" for all devices.
+	DeviceName string
+	BPFilter   string
+
+	// Size in bytes of each block of the ring, and number of blocks. The ring
+	// takes BlockSize * NumBlocks bytes of memory.
+	BlockSize int
+	NumBlocks int
+
+	// How long the kernel waits for a block to fill before handing over the
+	// packets in it.
+	BlockTimeout time.Duration
+
+	stats handleStats
+
+	mu     sync.Mutex
+	handle *afpacket.TPacket
+}
+
+func NewAFPacketReader(devicename, bpfilter string) *AFPacketReader {
+	return &AFPacketReader{
+		DeviceName:   devicename,
+		BPFilter:     bpfilter,
+		BlockSize:    DefaultAFPacketBlockSize,
+		NumBlocks:    DefaultAFPacketNumBlocks,
+		BlockTimeout: DefaultAFPacketBlockTimeout,
+	}
+}
+
+func (r *AFPacketReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+
+	opts := []interface{}{
+		afpacket.OptFrameSize(afpacketFrameSize),
+		afpacket.OptBlockSize(r.BlockSize),
+		afpacket.OptNumBlocks(r.NumBlocks),
+		afpacket.OptBlockTimeout(r.BlockTimeout),
+		afpacket.OptPollTimeout(capturePollTimeout),
+		afpacket.SocketRaw,
+		afpacket.TPacketVersion3,
+	}
+	if len(r.DeviceName) > 0 && r.DeviceName != "any" {
+		opts = append(opts, afpacket.OptInterface(r.DeviceName))
+	}
+
+	handle, err := afpacket.NewTPacket(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(r.BPFilter) > 0 {
+		if err := setAFPacketBPF(handle, r.BPFilter); err != nil {
+			handle.Close()
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	r.handle = handle
+	r.mu.Unlock()
+
+	r.stats.open(func() (CaptureStats, error) {
+		_, st, err := handle.SocketStats()
+		if err != nil {
+			return CaptureStats{}, err
+		}
+		return CaptureStats{
+			PacketsReceived:        uint64(st.Packets()),
+			PacketsDroppedByKernel: uint64(st.Drops()),
+		}, nil
+	})
+
+	packetSource := gopacket.NewPacketSource(handle, layers.LayerTypeEthernet)
+	out := make(chan gopacket.Packet, 10)
+	go func() {
+		defer handle.Close()
+		defer r.stats.close()
+		defer func() {
+			r.mu.Lock()
+			r.handle = nil
+			r.mu.Unlock()
+		}()
+		defer close(out)
+
+		for {
+			// Polling times out regularly so that cancellation is noticed even
+			// when no packets arrive.
+			pkt, err := packetSource.NextPacket()
+			if err == afpacket.ErrTimeout {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			} else if err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- pkt:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Statistics of the socket, as reported by the kernel. AF_PACKET does not
+// report drops by the interface.
+func (r *AFPacketReader) Stats() CaptureStats {
+	return r.stats.get()
+}
+
+// Replaces the filter, also on the capture in progress, if any.
+func (r *AFPacketReader) SetBPFFilter(expr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.handle != nil {
+		if err := setAFPacketBPF(r.handle, expr); err != nil {
+			return err
+		}
+	}
+	r.BPFilter = expr
+	return nil
+}
+
+// Compiles filter with libpcap and attaches it to the socket.
+func setAFPacketBPF(handle *afpacket.TPacket, filter string) error {
+	raw, err := compileBPF(layers.LinkTypeEthernet, filter)
+	if err != nil {
+		return fmt.Errorf("failed to compile BPF filter %q: %w", filter, err)
+	}
+	return handle.SetBPF(raw)
+}
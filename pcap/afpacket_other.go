@@ -0,0 +1,39 @@
+//go:build !linux || !cgo
+
+package pcap
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// AF_PACKET capture is only available on Linux, with cgo. Elsewhere Capture
+// always fails.
+type AFPacketReader struct {
+	DeviceName   string
+	BPFilter     string
+	BlockSize    int
+	NumBlocks    int
+	BlockTimeout time.Duration
+}
+
+func NewAFPacketReader(devicename, bpfilter string) *AFPacketReader {
+	return &AFPacketReader{
+		DeviceName:   devicename,
+		BPFilter:     bpfilter,
+		BlockSize:    DefaultAFPacketBlockSize,
+		NumBlocks:    DefaultAFPacketNumBlocks,
+		BlockTimeout: DefaultAFPacketBlockTimeout,
+	}
+}
+
+func (r *AFPacketReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	return nil, errors.New("AF_PACKET capture is only supported on Linux, with cgo")
+}
+
+func (r *AFPacketReader) Stats() CaptureStats {
+	return CaptureStats{}
+}
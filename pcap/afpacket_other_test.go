@@ -0,0 +1,17 @@
+//go:build !linux || !cgo
+
+package pcap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAFPacketUnsupported(t *testing.T) {
+	out, err := NewAFPacketReader("eth0", "").Capture(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, out)
+	assert.Equal(t, CaptureStats{}, NewAFPacketReader("eth0", "").Stats())
+}
@@ -0,0 +1,61 @@
+package pcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAFPacketReaderDefaults(t *testing.T) {
+	r := NewAFPacketReader("eth0", "tcp")
+	assert.Equal(t, "eth0", r.DeviceName)
+	assert.Equal(t, "tcp", r.BPFilter)
+	assert.Equal(t, DefaultAFPacketBlockSize, r.BlockSize)
+	assert.Equal(t, DefaultAFPacketNumBlocks, r.NumBlocks)
+	assert.Equal(t, DefaultAFPacketBlockTimeout, r.BlockTimeout)
+	assert.NoError(t, r.validate())
+}
+
+func TestAFPacketReaderValidate(t *testing.T) {
+	for name, update := range map[string]func(*AFPacketReader){
+		"zero block size":        func(r *AFPacketReader) { r.BlockSize = 0 },
+		"unaligned block size":   func(r *AFPacketReader) { r.BlockSize = 1000 },
+		"no blocks":              func(r *AFPacketReader) { r.NumBlocks = 0 },
+		"short block timeout":    func(r *AFPacketReader) { r.BlockTimeout = time.Microsecond },
+		"negative block timeout": func(r *AFPacketReader) { r.BlockTimeout = -time.Millisecond },
+	} {
+		r := NewAFPacketReader("eth0", "")
+		update(r)
+		assert.Error(t, r.validate(), name)
+	}
+}
+
+func TestAFPacketOption(t *testing.T) {
+	p, err := NewTrafficParser(WithReadName("eth0", true), WithAFPacket())
+	if assert.NoError(t, err) && assert.IsType(t, &AFPacketReader{}, p.reader) {
+		r := p.reader.(*AFPacketReader)
+		assert.Equal(t, "eth0", r.DeviceName)
+		assert.Equal(t, DefaultAFPacketBlockSize, r.BlockSize)
+		assert.Equal(t, DefaultAFPacketNumBlocks, r.NumBlocks)
+		assert.Equal(t, DefaultAFPacketBlockTimeout, r.BlockTimeout)
+	}
+
+	p, err = NewTrafficParser(WithReadName("eth0", true), WithAFPacket(),
+		WithAFPacketRing(2*DefaultAFPacketBlockSize, 4), WithCaptureTimeout(10*time.Millisecond))
+	if assert.NoError(t, err) && assert.IsType(t, &AFPacketReader{}, p.reader) {
+		r := p.reader.(*AFPacketReader)
+		assert.Equal(t, 2*DefaultAFPacketBlockSize, r.BlockSize)
+		assert.Equal(t, 4, r.NumBlocks)
+		assert.Equal(t, 10*time.Millisecond, r.BlockTimeout)
+	}
+
+	_, err = NewTrafficParser(WithReadName("eth0", true), WithAFPacket(), WithAFPacketRing(1000, 4))
+	assert.Error(t, err)
+
+	// Without the option, live capture goes through libpcap.
+	p, err = NewTrafficParser(WithReadName("eth0", true))
+	if assert.NoError(t, err) {
+		assert.IsType(t, &DeviceReader{}, p.reader)
+	}
+}
@@ -0,0 +1,212 @@
+package pcap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+)
+
+// Number of packets that can be waiting for each assembly worker.
+const assemblyQueueSize = 1000
+
+// Reassembles TCP packets. Implemented by reassembly.Assembler.
+type packetAssembler interface {
+	AssembleWithContext(netFlow gopacket.Flow, t *layers.TCP, ac reassembly.AssemblerContext)
+}
+
+// The assemblers of a capture, with the operations Parse needs on all of them.
+// Not safe for concurrent use.
+type assemblerGroup interface {
+	packetAssembler
+
+	// Flushes and closes streams as reassembly.Assembler.FlushWithOptions
+	// does, and returns the totals over all assemblers.
+	flush(opts reassembly.FlushOptions) (flushed, closed int)
+
+	// Abandons parsers that have timed out at packet time t.
+	expireParsers(t time.Time)
+
+	// Flushes and closes all streams. The group cannot be used afterwards.
+	flushAll()
+}
+
+// Assemblers by InterfaceIndex. Unless reassembling per interface, all packets
+// go to the assembler at index 0.
+type assemblerSet struct {
+	newAssembler func() *reassembly.Assembler
+	perInterface bool
+	assemblers   map[int]*reassembly.Assembler
+
+	// The streams of the assemblers, if their number is limited. Evicted
+	// streams are closed after each packet.
+	lru *streamLRU
+
+	// Creates the streams of the assemblers.
+	factory *tcpStreamFactory
+}
+
+func newAssemblerSet(newAssembler func() *reassembly.Assembler, perInterface bool) *assemblerSet {
+	return &assemblerSet{
+		newAssembler: newAssembler,
+		perInterface: perInterface,
+		assemblers:   map[int]*reassembly.Assembler{0: newAssembler()},
+	}
+}
+
+func (s *assemblerSet) AssembleWithContext(netFlow gopacket.Flow, t *layers.TCP, ac reassembly.AssemblerContext) {
+	s.assemble(netFlow, t, ac)
+	// Streams are evicted while the assembler creates a new one, when it
+	// cannot yet close them.
+	for _, evicted := range s.lru.takeEvicted() {
+		evicted.closeEvicted(s.assemble)
+	}
+}
+
+func (s *assemblerSet) assemble(netFlow gopacket.Flow, t *layers.TCP, ac reassembly.AssemblerContext) {
+	index := 0
+	if s.perInterface {
+		index = ac.GetCaptureInfo().InterfaceIndex
+	}
+	a, ok := s.assemblers[index]
+	if !ok {
+		a = s.newAssembler()
+		s.assemblers[index] = a
+	}
+	a.AssembleWithContext(netFlow, t, ac)
+}
+
+func (s *assemblerSet) flush(opts reassembly.FlushOptions) (flushed, closed int) {
+	for _, a := range s.assemblers {
+		f, c := a.FlushWithOptions(opts)
+		flushed += f
+		closed += c
+	}
+	return flushed, closed
+}
+
+func (s *assemblerSet) expireParsers(t time.Time) {
+	if s.factory != nil {
+		s.factory.expireParsers(t)
+	}
+}
+
+func (s *assemblerSet) flushAll() {
+	for _, a := range s.assemblers {
+		a.FlushAll()
+	}
+}
+
+// Spreads reassembly over workers, each with its own assemblers. Packets are
+// assigned to a worker by a hash of their addresses and ports that is the same
+// in both directions, so each connection is reassembled by a single worker, in
+// the order its packets were captured.
+type shardedAssembler struct {
+	workers []*assemblyWorker
+	panics  *panicReporter
+}
+
+type assemblyWorker struct {
+	set  *assemblerSet
+	jobs chan assemblyJob
+	done chan struct{}
+}
+
+// A packet to reassemble, or an operation to run on the worker's assemblers.
+type assemblyJob struct {
+	netFlow gopacket.Flow
+	tcp     *layers.TCP
+	ac      reassembly.AssemblerContext
+
+	op func(*assemblerSet)
+}
+
+// Starts a worker for each of sets.
+func newShardedAssembler(sets []*assemblerSet, panics *panicReporter) *shardedAssembler {
+	s := &shardedAssembler{panics: panics}
+	for _, set := range sets {
+		w := &assemblyWorker{
+			set:  set,
+			jobs: make(chan assemblyJob, assemblyQueueSize),
+			done: make(chan struct{}),
+		}
+		s.workers = append(s.workers, w)
+		go s.run(w)
+	}
+	return s
+}
+
+func (s *shardedAssembler) run(w *assemblyWorker) {
+	defer close(w.done)
+	for job := range w.jobs {
+		if job.op != nil {
+			job.op(w.set)
+		} else {
+			s.assemble(w.set, job)
+		}
+	}
+}
+
+// Like PacketToNetTraffic, a panic while reassembling a packet is reported
+// rather than crashing the program.
+func (s *shardedAssembler) assemble(set *assemblerSet, job assemblyJob) {
+	defer func() {
+		if err := recover(); err != nil {
+			s.panics.report("", uuid.Nil, err)
+		}
+	}()
+	set.AssembleWithContext(job.netFlow, job.tcp, job.ac)
+}
+
+func (s *shardedAssembler) AssembleWithContext(netFlow gopacket.Flow, t *layers.TCP, ac reassembly.AssemblerContext) {
+	// Both hashes are symmetric, so the two directions of a connection agree.
+	h := netFlow.FastHash() ^ t.TransportFlow().FastHash()
+	w := s.workers[h%uint64(len(s.workers))]
+	w.jobs <- assemblyJob{netFlow: netFlow, tcp: t, ac: ac}
+}
+
+// Runs op on every worker once it has reassembled the packets queued before,
+// and waits for all of them.
+func (s *shardedAssembler) broadcast(op func(*assemblerSet)) {
+	var wg sync.WaitGroup
+	wg.Add(len(s.workers))
+	for _, w := range s.workers {
+		w.jobs <- assemblyJob{op: func(set *assemblerSet) {
+			defer wg.Done()
+			op(set)
+		}}
+	}
+	wg.Wait()
+}
+
+func (s *shardedAssembler) flush(opts reassembly.FlushOptions) (flushed, closed int) {
+	var mu sync.Mutex
+	s.broadcast(func(set *assemblerSet) {
+		f, c := set.flush(opts)
+		mu.Lock()
+		flushed += f
+		closed += c
+		mu.Unlock()
+	})
+	return flushed, closed
+}
+
+func (s *shardedAssembler) expireParsers(t time.Time) {
+	s.broadcast(func(set *assemblerSet) {
+		set.expireParsers(t)
+	})
+}
+
+// Flushes all workers in parallel, then stops them.
+func (s *shardedAssembler) flushAll() {
+	for _, w := range s.workers {
+		w.jobs <- assemblyJob{op: (*assemblerSet).flushAll}
+		close(w.jobs)
+	}
+	for _, w := range s.workers {
+		<-w.done
+	}
+}
@@ -0,0 +1,150 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/http2"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func TestShardedAssembly(t *testing.T) {
+	const conns, segments = 16, 5
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	start := time.Unix(1700000000, 0)
+
+	// The packets of all connections, interleaved.
+	var packets []gopacket.Packet
+	for i := 0; i < conns; i++ {
+		packets = append(packets, CreateTCPSYN(client, server, 40000+i, 80, 100))
+	}
+	for i := 0; i < conns; i++ {
+		packets = append(packets, CreateTCPSYNAndACK(server, client, 80, 40000+i, 500))
+	}
+	for seg := 1; seg <= segments; seg++ {
+		for i := 0; i < conns; i++ {
+			seq := uint32(101 + (seg-1)*seg/2)
+			packets = append(packets, CreatePacketWithSeq(client, server, 40000+i, 80, make([]byte, seg), seq))
+		}
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = start.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	opts := NewOptions()
+	opts.AssemblyWorkers = 4
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Payload lengths of the client's packets, by client port.
+	payloads := map[int][]int{}
+	completed := map[int]bool{}
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case gnet.TCPPacketMetadata:
+			if tr.DstPort == 80 && !c.SYN {
+				payloads[tr.SrcPort] = append(payloads[tr.SrcPort], c.PayloadLength)
+			}
+		case gnet.TCPConnectionMetadata:
+			completed[tr.SrcPort] = true
+		}
+	}
+
+	assert.Len(t, completed, conns)
+	assert.Len(t, payloads, conns)
+	for port, lengths := range payloads {
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, lengths, "port %d", port)
+	}
+}
+
+func TestSelectFactoriesPerWorker(t *testing.T) {
+	opts := NewOptions()
+	opts.Parsers = []string{"http2"}
+	opts.AssemblyWorkers = 3
+	factories, err := selectFactories(&opts)
+	if assert.NoError(t, err) {
+		assert.Len(t, factories, 3)
+		assert.Nil(t, opts.BufferPool)
+	}
+
+	opts.AssemblyWorkers = 0
+	factories, err = selectFactories(&opts)
+	if assert.NoError(t, err) {
+		assert.Len(t, factories, 1)
+		assert.NotNil(t, opts.BufferPool)
+	}
+}
+
+func TestSelectFactoriesFromRegistry(t *testing.T) {
+	r := gnet.NewTCPParserRegistry()
+	r.Register("low", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{http2.NewHTTP2PrefaceParserFactory()}
+	}, 0)
+	r.Register("high", func(mempool.BufferPool) []gnet.TCPParserFactory {
+		return []gnet.TCPParserFactory{http2.NewHTTP2PrefaceParserFactory(), http2.NewHTTP2PrefaceParserFactory()}
+	}, 1)
+
+	opts := NewOptions()
+	WithParserRegistry(r)(&opts)
+	factories, err := selectFactories(&opts)
+	if assert.NoError(t, err) && assert.Len(t, factories, 1) {
+		assert.Len(t, factories[0], 3)
+	}
+
+	assert.NoError(t, r.EnableOnly("low"))
+	factories, err = selectFactories(&opts)
+	if assert.NoError(t, err) && assert.Len(t, factories, 1) {
+		assert.Len(t, factories[0], 1)
+	}
+
+	// Names are resolved against the registry, not the default one.
+	opts.Parsers = []string{"tls"}
+	_, err = selectFactories(&opts)
+	assert.Error(t, err)
+}
+
+func TestSelectFactoriesFromDefaultRegistry(t *testing.T) {
+	assert.Contains(t, gnet.DefaultTCPParserRegistry.Names(), "http1")
+
+	opts := NewOptions()
+	factories, err := selectFactories(&opts)
+	if assert.NoError(t, err) && assert.Len(t, factories, 1) {
+		assert.Len(t, factories[0], len(gnet.DefaultTCPParserRegistry.Selector(opts.BufferPool)))
+	}
+
+	t.Cleanup(func() { gnet.DefaultTCPParserRegistry.EnableOnly() })
+	assert.NoError(t, gnet.DefaultTCPParserRegistry.EnableOnly("http2"))
+	factories, err = selectFactories(&opts)
+	if assert.NoError(t, err) && assert.Len(t, factories, 1) {
+		assert.Len(t, factories[0], 1)
+	}
+}
+
+func TestResolvePortHints(t *testing.T) {
+	opts := NewOptions()
+	WithPortHint(443, true, "tls")(&opts)
+	hints, err := resolvePortHints(&opts)
+	if assert.NoError(t, err) {
+		assert.True(t, hints[443].Exclusive)
+		assert.NotEmpty(t, hints[443].Factories)
+		assert.NotNil(t, opts.BufferPool)
+	}
+
+	WithPortHint(3306, false, "no such parser")(&opts)
+	_, err = resolvePortHints(&opts)
+	assert.Error(t, err)
+}
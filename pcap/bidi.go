@@ -0,0 +1,46 @@
+package pcap
+
+import (
+	"time"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// The parser shared by both flows of a tcpStream once a
+// gnet.TCPBidiParserFactory accepts the data of either.
+type bidiParser struct {
+	// Nil until a factory accepts, and after the parser fails.
+	parser gnet.TCPBidiParser
+
+	// The flows of the stream, by the direction of their data.
+	flows [2]*tcpFlow
+}
+
+// Hands both flows over to p from packet time t. Parsers the flows were
+// running are dropped, along with the data they consumed.
+func (b *bidiParser) start(p gnet.TCPBidiParser, t time.Time) {
+	b.parser = p
+	for _, f := range b.flows {
+		if f.currentParser != nil {
+			f.dropParser(t)
+		}
+		f.unusedAcceptBuf.Clear()
+	}
+}
+
+// Parses data sent in f's direction at packet time t with the shared parser,
+// and emits the results from the flows of their direction.
+func (f *tcpFlow) parseBidi(t time.Time, input memview.MemView, isEnd bool) {
+	b := f.bidi
+	results, err := f.panics.parseBidi(b.parser, f.bidiID, f.dir, input, isEnd)
+	for _, r := range results {
+		from := b.flows[r.Dir]
+		from.outChan <- from.toPNT(t, t, r.Content, nil)
+	}
+	if err != nil {
+		f.logger.Debugf("%s failed on connection %s: %v", b.parser.Name(), f.bidiID, err)
+		f.handleUnparseable(t, input.Bytes())
+		b.parser = nil
+	}
+}
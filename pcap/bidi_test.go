@@ -0,0 +1,100 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Pairs lines sent by the client with the lines the server answers them with.
+type lineExchangeFactory struct{}
+
+func (lineExchangeFactory) Name() string { return "Line Exchange Parser Factory" }
+
+func (lineExchangeFactory) Accepts(input memview.MemView, _ bool) (gnet.AcceptDecision, int64) {
+	if input.Len() == 0 {
+		return gnet.NeedMoreData, 0
+	}
+	return gnet.Accept, 0
+}
+
+func (lineExchangeFactory) CreateParser(uuid.UUID, reassembly.Sequence, reassembly.Sequence) gnet.TCPParser {
+	return nil
+}
+
+func (lineExchangeFactory) CreateBidiParser(uuid.UUID) gnet.TCPBidiParser {
+	return &lineExchangeParser{}
+}
+
+type lineExchangeParser struct {
+	requests []string
+}
+
+type lineExchange struct {
+	Request, Response string
+}
+
+func (lineExchange) ReleaseBuffers() {}
+
+func (*lineExchangeParser) Name() string { return "Line Exchange Parser" }
+
+func (p *lineExchangeParser) Parse(dir gnet.FlowDirection, input memview.MemView, _ bool) ([]gnet.BidiResult, error) {
+	var results []gnet.BidiResult
+	for _, line := range strings.Fields(input.String()) {
+		if dir == gnet.ClientToServer {
+			p.requests = append(p.requests, line)
+		} else if len(p.requests) > 0 {
+			results = append(results, gnet.BidiResult{
+				Dir:     dir,
+				Content: lineExchange{Request: p.requests[0], Response: line},
+			})
+			p.requests = p.requests[1:]
+		}
+	}
+	return results, nil
+}
+
+func TestBidiParser(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 7, 100),
+		CreateTCPSYNAndACK(server, client, 7, 40000, 500),
+		CreatePacketWithSeq(client, server, 40000, 7, []byte("ping1\nping2\n"), 101),
+		CreatePacketWithSeq(server, client, 7, 40000, []byte("pong1\n"), 501),
+		CreatePacketWithSeq(server, client, 7, 40000, []byte("pong2\n"), 507),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(), lineExchangeFactory{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var exchanges []lineExchange
+	for tr := range out {
+		if e, ok := tr.Content.(lineExchange); ok {
+			exchanges = append(exchanges, e)
+			assert.Equal(t, 7, tr.SrcPort)
+			assert.Equal(t, 40000, tr.DstPort)
+		}
+	}
+	assert.Equal(t, []lineExchange{{"ping1", "pong1"}, {"ping2", "pong2"}}, exchanges)
+}
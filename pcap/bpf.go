@@ -0,0 +1,69 @@
+package pcap
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Checks that expr compiles to a BPF program for packets of the given link
+// type, so that a bad filter can be reported before capture starts.
+func ValidateBPF(expr string, linkType layers.LinkType) error {
+	if _, err := compileBPF(linkType, expr); err != nil {
+		return fmt.Errorf("invalid BPF filter %q: %w", expr, err)
+	}
+	return nil
+}
+
+// Implemented by readers whose filter can be replaced during capture.
+type bpfSetter interface {
+	SetBPFFilter(expr string) error
+}
+
+// Replaces the BPF filter of the capture, including one in progress, without
+// reopening the device. The filter is compiled before it is installed, so an
+// invalid filter leaves the current one in place.
+func (p *TrafficParser) SetBPFFilter(expr string) error {
+	s, ok := p.reader.(bpfSetter)
+	if !ok {
+		return fmt.Errorf("%T does not support changing the BPF filter", p.reader)
+	}
+	return s.SetBPFFilter(expr)
+}
+
+// An open libpcap handle, shared between the capture goroutine and callers
+// that change its filter.
+type liveHandle struct {
+	mu     sync.Mutex
+	handle captureHandle
+}
+
+func (h *liveHandle) set(handle captureHandle) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handle = handle
+}
+
+// Checks expr against the link type of the open handle, if any.
+func (h *liveHandle) validate(expr string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handle == nil {
+		return nil
+	}
+	return ValidateBPF(expr, h.handle.LinkType())
+}
+
+// Installs expr on the open handle, if any.
+func (h *liveHandle) setBPFFilter(expr string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.handle == nil {
+		return nil
+	}
+	if err := h.handle.SetBPFFilter(expr); err != nil {
+		return fmt.Errorf("invalid BPF filter %q: %w", expr, err)
+	}
+	return nil
+}
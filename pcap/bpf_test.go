@@ -0,0 +1,35 @@
+package pcap
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestValidateBPF(t *testing.T) {
+	if !haveLibpcap {
+		t.Skip("BPF filters are compiled by libpcap")
+	}
+	assert.NoError(t, ValidateBPF("tcp port 80", layers.LinkTypeEthernet))
+	assert.NoError(t, ValidateBPF("", layers.LinkTypeEthernet))
+	assert.Error(t, ValidateBPF("tcp port", layers.LinkTypeEthernet))
+	assert.Error(t, ValidateBPF("ether host 01:02:03:04:05:06", layers.LinkTypeRaw))
+}
+
+func TestSetBPFFilterUnsupported(t *testing.T) {
+	p := &TrafficParser{
+		reader:   fakeMultiReader{},
+		outchan:  make(chan gnet.NetTraffic),
+		counters: &parserCounters{},
+	}
+	assert.Error(t, p.SetBPFFilter("tcp"))
+
+	// Before capture starts, the filter is only recorded.
+	r := NewDeviceReader("eth0", "")
+	p.reader = r
+	assert.NoError(t, p.SetBPFFilter("tcp"))
+	assert.Equal(t, "tcp", r.BPFilter)
+}
@@ -0,0 +1,87 @@
+//go:build (cgo || windows) && !nolibpcap
+
+package pcap
+
+import (
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// Files are read, devices captured from and BPF filters compiled with
+// libpcap. Build with the nolibpcap tag, or without cgo, to only read files
+// through pcapgo instead.
+
+const haveLibpcap = true
+
+const blockForever = pcap.BlockForever
+
+type libpcapHandle struct {
+	*pcap.Handle
+}
+
+func (h libpcapHandle) captureStats() (CaptureStats, error) {
+	st, err := h.Handle.Stats()
+	if err != nil {
+		return CaptureStats{}, err
+	}
+	return CaptureStats{
+		PacketsReceived:           uint64(st.PacketsReceived),
+		PacketsDroppedByKernel:    uint64(st.PacketsDropped),
+		PacketsDroppedByInterface: uint64(st.PacketsIfDropped),
+	}, nil
+}
+
+func openOffline(path string) (captureHandle, error) {
+	handle, err := pcap.OpenOffline(path)
+	if err != nil {
+		return nil, err
+	}
+	return libpcapHandle{handle}, nil
+}
+
+// Reports whether err is a read that timed out without a packet.
+func isReadTimeout(err error) bool {
+	return err == pcap.NextErrorTimeoutExpired
+}
+
+func openLive(device string, snaplen int32, promisc bool, timeout time.Duration) (captureHandle, error) {
+	handle, err := pcap.OpenLive(device, snaplen, promisc, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return libpcapHandle{handle}, nil
+}
+
+func findAllDevs() ([]string, error) {
+	devs, err := pcap.FindAllDevs()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(devs))
+	for _, dev := range devs {
+		names = append(names, dev.Name)
+	}
+	return names, nil
+}
+
+// Compiles expr to a BPF program for packets of the given link type.
+func compileBPF(linkType layers.LinkType, expr string) ([]bpf.RawInstruction, error) {
+	insns, err := pcap.CompileBPFFilter(linkType, DefaultSnapLen, expr)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]bpf.RawInstruction, len(insns))
+	for i, insn := range insns {
+		raw[i] = bpf.RawInstruction{
+			Op: insn.Code,
+			Jt: insn.Jt,
+			Jf: insn.Jf,
+			K:  insn.K,
+		}
+	}
+	return raw, nil
+}
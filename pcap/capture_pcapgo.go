@@ -0,0 +1,74 @@
+//go:build (!cgo && !windows) || nolibpcap
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// Without libpcap, files are read with pcapgo, which supports pcap and pcapng
+// but not BPF filters. Live capture is unavailable, except through
+// AFPacketReader on Linux, without filters.
+
+const haveLibpcap = false
+
+// The same as libpcap's.
+const blockForever = -10 * time.Millisecond
+
+var errNoLibpcap = errors.New("built without libpcap")
+
+type pcapgoHandle struct {
+	captureStream
+	file *os.File
+}
+
+func (h pcapgoHandle) SetBPFFilter(expr string) error {
+	if len(expr) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cannot filter with %q: %w", expr, errNoLibpcap)
+}
+
+func (h pcapgoHandle) captureStats() (CaptureStats, error) {
+	return CaptureStats{}, errNoLibpcap
+}
+
+func (h pcapgoHandle) Close() {
+	h.file.Close()
+}
+
+func openOffline(path string) (captureHandle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newCaptureStream(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pcapgoHandle{captureStream: s, file: f}, nil
+}
+
+func openLive(device string, snaplen int32, promisc bool, timeout time.Duration) (captureHandle, error) {
+	return nil, fmt.Errorf("cannot capture from %s: %w", device, errNoLibpcap)
+}
+
+// Files never time out.
+func isReadTimeout(err error) bool {
+	return false
+}
+
+func findAllDevs() ([]string, error) {
+	return nil, fmt.Errorf("cannot list devices: %w", errNoLibpcap)
+}
+
+func compileBPF(linkType layers.LinkType, expr string) ([]bpf.RawInstruction, error) {
+	return nil, fmt.Errorf("cannot compile BPF filters: %w", errNoLibpcap)
+}
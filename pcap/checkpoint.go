@@ -0,0 +1,106 @@
+package pcap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// The progress of a TrafficParser through the files it reads, from which a
+// later run can resume with WithResume instead of reading them again from the
+// start. See WithCheckpoints.
+//
+// Only the position in the files is restored. Connections in progress at the
+// checkpoint, which it counts, are parsed from where the resumed run picks
+// them up, and those whose start was missed may not be parsed at all.
+type Checkpoint struct {
+	// The file being read, and the number of packets read from it after BPF
+	// filtering.
+	File    string `json:"file"`
+	Packets uint64 `json:"packets"`
+
+	// Timestamp of the last packet read.
+	PacketTime time.Time `json:"packet_time"`
+
+	// TCP connections being reassembled, and UDP flows being tracked.
+	TCPConnections uint64 `json:"tcp_connections"`
+	UDPFlows       int    `json:"udp_flows"`
+
+	// When the checkpoint was taken.
+	Time time.Time `json:"time"`
+}
+
+// Writes cp to path as JSON, replacing the file at once, so that a crash
+// leaves either the previous checkpoint or this one.
+func WriteCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Reads a checkpoint written by WriteCheckpoint.
+func ReadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cp, err
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// Tracks the position of the parser in the files it reads.
+type fileProgress struct {
+	file       string
+	packets    uint64
+	packetTime time.Time
+}
+
+func (f *fileProgress) observe(packet gopacket.Packet) {
+	if b, ok := fileBoundaryOf(packet); ok {
+		f.file, f.packets = b.path, b.skipped
+	}
+	f.packets++
+	f.packetTime = packet.Metadata().Timestamp
+}
+
+// Hands the current checkpoint to the function set with WithCheckpoints, if
+// any.
+func (p *TrafficParser) checkpoint() {
+	if p.opts.Checkpoint == nil {
+		return
+	}
+	p.opts.Checkpoint(Checkpoint{
+		File:           p.progress.file,
+		Packets:        p.progress.packets,
+		PacketTime:     p.progress.packetTime,
+		TCPConnections: atomic.LoadUint64(&p.counters.tcpConnectionsOpen),
+		UDPFlows:       p.udpFlows.active(),
+		Time:           time.Now(),
+	})
+}
@@ -0,0 +1,110 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp := Checkpoint{
+		File:       "a.pcap",
+		Packets:    42,
+		PacketTime: time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		UDPFlows:   3,
+		Time:       time.Date(2021, 1, 2, 3, 5, 0, 0, time.UTC),
+	}
+	assert.NoError(t, WriteCheckpoint(path, cp))
+	cp.Packets++
+	assert.NoError(t, WriteCheckpoint(path, cp))
+
+	read, err := ReadCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, cp, read)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files left behind")
+}
+
+func TestCheckpointProgress(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i := 0; i < 5; i++ {
+		p := CreateUDPPacket(client, server, 40000+i, 9999, []byte("x"))
+		switch i {
+		case 0:
+			p.Metadata().AncillaryData = []interface{}{fileBoundary{path: "a.pcap"}}
+		case 2:
+			p.Metadata().AncillaryData = []interface{}{fileBoundary{path: "b.pcap", skipped: 7}}
+		}
+		packets = append(packets, p)
+	}
+
+	var checkpoints []Checkpoint
+	opts := NewOptions()
+	WithCheckpoints(time.Hour, func(cp Checkpoint) { checkpoints = append(checkpoints, cp) })(&opts)
+	parseAll(t, opts, packets)
+
+	if assert.Len(t, checkpoints, 1) {
+		assert.Equal(t, "b.pcap", checkpoints[0].File)
+		assert.Equal(t, uint64(10), checkpoints[0].Packets)
+		assert.Equal(t, uint64(0), checkpoints[0].TCPConnections)
+	}
+}
+
+// Needs to read files, which the libpcap stub used in some environments
+// cannot.
+func TestResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "udp.pcap")
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	w := pcapgo.NewWriter(f)
+	assert.NoError(t, w.WriteFileHeader(DefaultSnapLen, layers.LinkTypeEthernet))
+	for i := 0; i < 10; i++ {
+		p := CreateUDPPacket(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000+i, 9999, []byte("x"))
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(int64(i), 0), CaptureLength: len(p.Data()), Length: len(p.Data())}
+		assert.NoError(t, w.WritePacket(ci, p.Data()))
+	}
+	assert.NoError(t, f.Close())
+
+	parse := func(opts ...Option) []int {
+		p, err := NewTrafficParser(append(opts, WithReadName(path, false))...)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		out, err := p.Parse(context.Background())
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		var ports []int
+		for tr := range out {
+			if tr.DstPort == 9999 {
+				ports = append(ports, tr.SrcPort)
+			}
+		}
+		return ports
+	}
+
+	var last Checkpoint
+	assert.Len(t, parse(WithCheckpoints(time.Hour, func(cp Checkpoint) { last = cp })), 10)
+	assert.Equal(t, path, last.File)
+	assert.Equal(t, uint64(10), last.Packets)
+	assert.True(t, last.PacketTime.Equal(time.Unix(9, 0)), last.PacketTime)
+
+	assert.Equal(t, []int{40006, 40007, 40008, 40009}, parse(WithResume(Checkpoint{File: path, Packets: 6})))
+
+	_, err = NewTrafficParser(WithReadName(path, false), WithResume(Checkpoint{File: "other.pcap"}))
+	assert.Error(t, err)
+}
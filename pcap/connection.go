@@ -0,0 +1,162 @@
+package pcap
+
+import (
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Maximum number of sequence gaps remembered per direction. Segments filling
+// older gaps are counted as retransmissions.
+const maxSequenceGaps = 16
+
+// A range of sequence numbers, end exclusive.
+type sequenceRange struct {
+	start, end reassembly.Sequence
+}
+
+// Accumulates the TCPConnectionMetadata of a connection as its packets are
+// accepted.
+type connectionTracker struct {
+	first, last time.Time
+
+	// The direction of the first packet, which becomes the source of the
+	// connection metadata.
+	sourceDir reassembly.TCPFlowDirection
+	srcPort   layers.TCPPort
+	dstPort   layers.TCPPort
+
+	initiator gnet.TCPConnectionInitiator
+	finSeen   bool
+	rstSeen   bool
+
+	// Indexed by whether packets flow from source to destination (0) or back
+	// (1).
+	dirs [2]directionTracker
+}
+
+type directionTracker struct {
+	stats gnet.TCPDirectionStats
+
+	started bool
+	// The sequence number following the highest one seen.
+	next reassembly.Sequence
+	// Ranges skipped over by segments that arrived early.
+	gaps []sequenceRange
+}
+
+func (t *connectionTracker) observe(tcp *layers.TCP, dir reassembly.TCPFlowDirection, ts time.Time) {
+	if t.first.IsZero() {
+		t.first = ts
+		t.sourceDir = dir
+		t.srcPort, t.dstPort = tcp.SrcPort, tcp.DstPort
+	}
+	if ts.After(t.last) {
+		t.last = ts
+	}
+
+	fromSource := dir == t.sourceDir
+	if tcp.SYN && t.initiator == gnet.UnknownTCPConnectionInitiator {
+		// The initiator sends the SYN; the responder answers with SYN+ACK.
+		if fromSource != tcp.ACK {
+			t.initiator = gnet.SourceInitiator
+		} else {
+			t.initiator = gnet.DestInitiator
+		}
+	}
+	t.finSeen = t.finSeen || tcp.FIN
+	t.rstSeen = t.rstSeen || tcp.RST
+
+	if fromSource {
+		t.dirs[0].observe(tcp)
+	} else {
+		t.dirs[1].observe(tcp)
+	}
+}
+
+func (t *connectionTracker) metadata(id uuid.UUID) gnet.TCPConnectionMetadata {
+	m := gnet.TCPConnectionMetadata{
+		ConnectionID: id,
+		Initiator:    t.initiator,
+		EndState:     gnet.ConnectionOpen,
+		Duration:     t.last.Sub(t.first),
+		SourceToDest: t.dirs[0].stats,
+		DestToSource: t.dirs[1].stats,
+	}
+	if t.rstSeen {
+		m.EndState = gnet.ConnectionReset
+	} else if t.finSeen {
+		m.EndState = gnet.ConnectionClosed
+	}
+	return m
+}
+
+func (d *directionTracker) observe(tcp *layers.TCP) {
+	d.stats.Packets++
+	d.stats.Bytes += int64(len(tcp.Payload))
+
+	// SYN and FIN each occupy a sequence number.
+	length := len(tcp.Payload)
+	if tcp.SYN {
+		length++
+	}
+	if tcp.FIN {
+		length++
+	}
+	if length == 0 {
+		return
+	}
+
+	seq := reassembly.Sequence(tcp.Seq)
+	end := seq.Add(length)
+	if !d.started {
+		d.started = true
+		d.next = end
+		return
+	}
+
+	switch diff := d.next.Difference(seq); {
+	case diff > 0:
+		// Segments in between were lost or are still to come.
+		if len(d.gaps) < maxSequenceGaps {
+			d.gaps = append(d.gaps, sequenceRange{d.next, seq})
+		}
+		d.next = end
+	case diff == 0:
+		d.next = end
+	default:
+		if d.fillGap(seq, end) {
+			d.stats.OutOfOrder++
+		} else {
+			d.stats.Retransmissions++
+		}
+		if d.next.Difference(end) > 0 {
+			d.next = end
+		}
+	}
+}
+
+// Removes the range [start, end) from the recorded gaps. Reports whether it
+// overlapped any of them.
+func (d *directionTracker) fillGap(start, end reassembly.Sequence) bool {
+	for i, g := range d.gaps {
+		if start.Difference(g.end) <= 0 || g.start.Difference(end) <= 0 {
+			continue
+		}
+
+		var rest []sequenceRange
+		if g.start.Difference(start) > 0 {
+			rest = append(rest, sequenceRange{g.start, start})
+		}
+		if end.Difference(g.end) > 0 {
+			rest = append(rest, sequenceRange{end, g.end})
+		}
+		d.gaps = append(d.gaps[:i], append(rest, d.gaps[i+1:]...)...)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestConnectionTracker(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var tr connectionTracker
+	for i, seg := range []struct {
+		dir     reassembly.TCPFlowDirection
+		tcp     layers.TCP
+		payload int
+	}{
+		// The first packet seen is the SYN+ACK, so the destination initiated.
+		{reassembly.TCPDirServerToClient, layers.TCP{SYN: true, ACK: true, Seq: 500}, 0},
+		{reassembly.TCPDirClientToServer, layers.TCP{ACK: true, Seq: 101}, 10},
+		{reassembly.TCPDirClientToServer, layers.TCP{ACK: true, Seq: 121}, 10},
+		{reassembly.TCPDirClientToServer, layers.TCP{ACK: true, Seq: 111}, 10}, // fills the gap
+		{reassembly.TCPDirClientToServer, layers.TCP{ACK: true, Seq: 111}, 10}, // again
+		{reassembly.TCPDirServerToClient, layers.TCP{ACK: true, FIN: true, Seq: 501}, 5},
+	} {
+		seg.tcp.Payload = make([]byte, seg.payload)
+		tr.observe(&seg.tcp, seg.dir, start.Add(time.Duration(i)*time.Second))
+	}
+
+	m := tr.metadata(uuid.Nil)
+	assert.Equal(t, gnet.DestInitiator, m.Initiator)
+	assert.Equal(t, gnet.ConnectionClosed, m.EndState)
+	assert.Equal(t, 5*time.Second, m.Duration)
+	assert.Equal(t, gnet.TCPDirectionStats{Packets: 2, Bytes: 5}, m.SourceToDest)
+	assert.Equal(t, gnet.TCPDirectionStats{
+		Packets: 4, Bytes: 40, Retransmissions: 1, OutOfOrder: 1,
+	}, m.DestToSource)
+}
+
+func TestParseConnectionMetadata(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	start := time.Unix(1700000000, 0)
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreateTCPSYNAndACK(server, client, 80, 40000, 500),
+		CreatePacketWithSeq(client, server, 40000, 80, []byte("ping"), 101),
+		CreatePacketWithSeq(client, server, 40000, 80, []byte("ping"), 101),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = start.Add(time.Duration(i) * time.Second)
+	}
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var found []gnet.TCPConnectionMetadata
+	var synOS, synAckOS *gnet.OSFingerprint
+	for c := range out {
+		if m, ok := c.Content.(gnet.TCPPacketMetadata); ok && m.SYN && m.ACK {
+			// Packets are oriented in their own direction.
+			assert.True(t, server.Equal(c.SrcIP))
+			assert.Equal(t, 80, c.SrcPort)
+			synAckOS = m.OS
+		} else if ok && m.SYN {
+			synOS = m.OS
+		}
+		if m, ok := c.Content.(gnet.TCPConnectionMetadata); ok {
+			found = append(found, m)
+			assert.True(t, client.Equal(c.SrcIP))
+			assert.Equal(t, 40000, c.SrcPort)
+			assert.Equal(t, 80, c.DstPort)
+			assert.Equal(t, c.ConnectionID, m.ConnectionID)
+		}
+	}
+	if assert.Len(t, found, 1) {
+		m := found[0]
+		assert.Equal(t, gnet.SourceInitiator, m.Initiator)
+		assert.Equal(t, gnet.ConnectionOpen, m.EndState)
+		assert.Equal(t, 3*time.Second, m.Duration)
+		assert.Equal(t, int64(3), m.SourceToDest.Packets)
+		assert.Equal(t, int64(8), m.SourceToDest.Bytes)
+		assert.Equal(t, int64(1), m.SourceToDest.Retransmissions)
+		assert.Equal(t, int64(1), m.DestToSource.Packets)
+		// The guesses from the SYN and SYN+ACK are carried by the connection.
+		if assert.NotNil(t, m.InitiatorOS) && assert.NotNil(t, synOS) {
+			assert.Equal(t, *synOS, *m.InitiatorOS)
+		}
+		if assert.NotNil(t, m.ResponderOS) && assert.NotNil(t, synAckOS) {
+			assert.Equal(t, *synAckOS, *m.ResponderOS)
+		}
+	}
+}
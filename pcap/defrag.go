@@ -0,0 +1,187 @@
+package pcap
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/ip4defrag"
+	"github.com/google/gopacket/layers"
+)
+
+// How long the fragments of an incomplete datagram are kept, as in Linux.
+const fragmentTimeout = 30 * time.Second
+
+// The largest datagram reassembled, and the most fragments kept for one
+// datagram, as in ip4defrag.
+const (
+	maxDatagramSize       = 65535
+	maxFragmentsPerPacket = ip4defrag.IPv4MaximumFragmentListLen
+)
+
+// Reassembles fragmented IPv4 and IPv6 datagrams before they are handed to the
+// transport layer. Not safe for concurrent use.
+type defragmenter struct {
+	v4 *ip4defrag.IPv4Defragmenter
+	v6 map[ipv6FragmentKey]*ipv6Fragments
+
+	counters *parserCounters
+}
+
+func newDefragmenter(counters *parserCounters) *defragmenter {
+	return &defragmenter{
+		v4:       ip4defrag.NewIPv4Defragmenter(),
+		v6:       map[ipv6FragmentKey]*ipv6Fragments{},
+		counters: counters,
+	}
+}
+
+// Returns packet if it is not a fragment, a new packet holding the whole
+// datagram if packet is its last missing fragment, or nil otherwise.
+func (d *defragmenter) defrag(packet gopacket.Packet) gopacket.Packet {
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		if ip.Flags&layers.IPv4MoreFragments == 0 && ip.FragOffset == 0 {
+			return packet
+		}
+		atomic.AddUint64(&d.counters.fragments, 1)
+
+		whole, err := d.v4.DefragIPv4(ip)
+		if err != nil || whole == nil {
+			return nil
+		}
+		return d.reassembled(packet, whole, gopacket.Payload(whole.Payload))
+
+	case *layers.IPv6:
+		frag, ok := packet.Layer(layers.LayerTypeIPv6Fragment).(*layers.IPv6Fragment)
+		if !ok {
+			return packet
+		}
+		atomic.AddUint64(&d.counters.fragments, 1)
+
+		payload := d.defragIPv6(ip, frag)
+		if payload == nil {
+			return nil
+		}
+		// Extension headers before the fragment header are dropped.
+		whole := &layers.IPv6{
+			Version:      ip.Version,
+			TrafficClass: ip.TrafficClass,
+			FlowLabel:    ip.FlowLabel,
+			NextHeader:   frag.NextHeader,
+			HopLimit:     ip.HopLimit,
+			SrcIP:        ip.SrcIP,
+			DstIP:        ip.DstIP,
+		}
+		return d.reassembled(packet, whole, gopacket.Payload(payload))
+	}
+	return packet
+}
+
+// Decodes a datagram from its reassembled network layer and payload, with the
+// metadata of its last fragment.
+func (d *defragmenter) reassembled(last gopacket.Packet, ip gopacket.SerializableLayer, payload gopacket.Payload) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip, payload); err != nil {
+		return nil
+	}
+	atomic.AddUint64(&d.counters.fragmentsReassembled, 1)
+
+	packet := gopacket.NewPacket(buf.Bytes(), ip.LayerType(), gopacket.Default)
+	if md := last.Metadata(); md != nil {
+		*packet.Metadata() = *md
+		packet.Metadata().CaptureLength = len(buf.Bytes())
+		packet.Metadata().Length = len(buf.Bytes())
+	}
+	return packet
+}
+
+// Forgets incomplete datagrams without fragments since t.
+func (d *defragmenter) discardOlderThan(t time.Time) {
+	discarded := d.v4.DiscardOlderThan(t)
+	for k, f := range d.v6 {
+		if f.lastSeen.Before(t) {
+			delete(d.v6, k)
+			discarded++
+		}
+	}
+	atomic.AddUint64(&d.counters.fragmentsTimedOut, uint64(discarded))
+}
+
+type ipv6FragmentKey struct {
+	flow gopacket.Flow
+	id   uint32
+}
+
+type ipv6Fragment struct {
+	offset int
+	data   []byte
+}
+
+// The fragments received of an IPv6 datagram.
+type ipv6Fragments struct {
+	fragments []ipv6Fragment
+	// Length of the datagram, known once its last fragment is received.
+	length   int
+	lastSeen time.Time
+}
+
+// Adds frag to the fragments of its datagram. Returns the payload of the
+// datagram once all of it has been received, or nil.
+func (d *defragmenter) defragIPv6(ip *layers.IPv6, frag *layers.IPv6Fragment) []byte {
+	key := ipv6FragmentKey{flow: ip.NetworkFlow(), id: frag.Identification}
+	offset := int(frag.FragmentOffset) * 8
+	data := frag.LayerPayload()
+	if offset+len(data) > maxDatagramSize {
+		delete(d.v6, key)
+		return nil
+	}
+
+	f, ok := d.v6[key]
+	if !ok {
+		f = &ipv6Fragments{}
+		d.v6[key] = f
+	}
+	if len(f.fragments) >= maxFragmentsPerPacket {
+		delete(d.v6, key)
+		return nil
+	}
+	f.fragments = append(f.fragments, ipv6Fragment{offset: offset, data: append([]byte(nil), data...)})
+	f.lastSeen = time.Now()
+	if !frag.MoreFragments {
+		f.length = offset + len(data)
+	}
+
+	payload := f.assemble()
+	if payload != nil {
+		delete(d.v6, key)
+	}
+	return payload
+}
+
+// Returns the payload of the datagram if there are no holes in it. Where
+// fragments overlap, the data of the earliest is used.
+func (f *ipv6Fragments) assemble() []byte {
+	if f.length == 0 {
+		return nil
+	}
+	sort.SliceStable(f.fragments, func(i, j int) bool {
+		return f.fragments[i].offset < f.fragments[j].offset
+	})
+
+	payload := make([]byte, 0, f.length)
+	for _, frag := range f.fragments {
+		if frag.offset > len(payload) {
+			return nil
+		}
+		if end := frag.offset + len(frag.data); end > len(payload) {
+			payload = append(payload, frag.data[len(payload)-frag.offset:]...)
+		}
+	}
+	if len(payload) < f.length {
+		return nil
+	}
+	return payload[:f.length]
+}
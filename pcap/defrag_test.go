@@ -0,0 +1,113 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	fragClient = net.ParseIP("fd00::1")
+	fragServer = net.ParseIP("fd00::2")
+)
+
+// Returns a UDP datagram from port 40000 to port 53 with the given payload,
+// serialized without an IP header.
+func udpDatagram(t *testing.T, payload []byte) []byte {
+	udp := &layers.UDP{SrcPort: 40000, DstPort: 53}
+	buf := gopacket.NewSerializeBuffer()
+	if !assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+		udp, gopacket.Payload(payload))) {
+		t.FailNow()
+	}
+	return buf.Bytes()
+}
+
+func fragmentIPv4(data []byte, offset int, more bool) gopacket.Packet {
+	ip := &layers.IPv4{
+		Version:    4,
+		TTL:        64,
+		Id:         7,
+		Protocol:   layers.IPProtocolUDP,
+		SrcIP:      net.IPv4(10, 0, 0, 1),
+		DstIP:      net.IPv4(10, 0, 0, 2),
+		FragOffset: uint16(offset / 8),
+	}
+	if more {
+		ip.Flags = layers.IPv4MoreFragments
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		ip, gopacket.Payload(data))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+}
+
+func fragmentIPv6(data []byte, offset int, more bool) gopacket.Packet {
+	// gopacket cannot serialize fragment headers.
+	header := make([]byte, 8)
+	header[0] = byte(layers.IPProtocolUDP)
+	fo := uint16(offset/8) << 3
+	if more {
+		fo |= 1
+	}
+	binary.BigEndian.PutUint16(header[2:], fo)
+	binary.BigEndian.PutUint32(header[4:], 7)
+
+	ip := &layers.IPv6{
+		Version:    6,
+		HopLimit:   64,
+		NextHeader: layers.IPProtocolIPv6Fragment,
+		SrcIP:      fragClient,
+		DstIP:      fragServer,
+	}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+		ip, gopacket.Payload(append(header, data...)))
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv6, gopacket.Default)
+}
+
+func TestDefragment(t *testing.T) {
+	payload := make([]byte, 100)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	datagram := udpDatagram(t, payload)
+
+	for name, fragment := range map[string]func([]byte, int, bool) gopacket.Packet{
+		"ipv4": fragmentIPv4,
+		"ipv6": fragmentIPv6,
+	} {
+		counters := &parserCounters{}
+		d := newDefragmenter(counters)
+
+		// Out of order.
+		assert.Nil(t, d.defrag(fragment(datagram[48:], 48, false)), name)
+		assert.Nil(t, d.defrag(fragment(datagram[:24], 0, true)), name)
+		whole := d.defrag(fragment(datagram[24:48], 24, true))
+		if assert.NotNil(t, whole, name) {
+			udp, ok := whole.Layer(layers.LayerTypeUDP).(*layers.UDP)
+			if assert.True(t, ok, name) {
+				assert.Equal(t, layers.UDPPort(53), udp.DstPort, name)
+				assert.Equal(t, payload, udp.Payload, name)
+			}
+		}
+
+		// Unfragmented packets pass through.
+		p := CreateUDPPacket(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 53, payload)
+		assert.Equal(t, p, d.defrag(p), name)
+
+		// Incomplete datagrams time out.
+		assert.Nil(t, d.defrag(fragment(datagram[:56], 0, true)), name)
+		d.discardOlderThan(time.Now().Add(time.Second))
+
+		st := counters.stats()
+		assert.Equal(t, uint64(4), st.FragmentsSeen, name)
+		assert.Equal(t, uint64(1), st.FragmentsReassembled, name)
+		assert.Equal(t, uint64(1), st.FragmentsTimedOut, name)
+	}
+}
@@ -0,0 +1,17 @@
+package pcap
+
+import (
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Passes through all traffic from in, enriched by e.
+func enrich(e gnet.Enricher, in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			out <- gnet.Enrich(e, t)
+		}
+	}()
+	return out
+}
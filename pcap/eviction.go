@@ -0,0 +1,140 @@
+package pcap
+
+import (
+	"container/list"
+	"encoding/binary"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+)
+
+// Tracks the streams of a tcpStreamFactory in order of their latest packet,
+// and evicts the least recently active once there are more than max. Used
+// only from the goroutine reassembling the factory's streams.
+type streamLRU struct {
+	max int
+
+	// Of *tcpStream, least recently active first.
+	order *list.List
+
+	// Streams evicted since the last call to takeEvicted, which the
+	// assembler still holds.
+	evicted []*tcpStream
+}
+
+// Returns nil, which tracks nothing, if max is not positive.
+func newStreamLRU(max int) *streamLRU {
+	if max <= 0 {
+		return nil
+	}
+	return &streamLRU{max: max, order: list.New()}
+}
+
+// Adds s as the most recently active stream, evicting the least recently
+// active ones beyond max.
+func (l *streamLRU) add(s *tcpStream) {
+	if l == nil {
+		return
+	}
+	s.lru = l
+	s.elem = l.order.PushBack(s)
+	for l.order.Len() > l.max {
+		victim := l.order.Front().Value.(*tcpStream)
+		l.remove(victim)
+		victim.evict()
+		l.evicted = append(l.evicted, victim)
+	}
+}
+
+// Returns the streams evicted since the last call, which must then be closed
+// in the assembler so that it forgets their connections.
+func (l *streamLRU) takeEvicted() []*tcpStream {
+	if l == nil || len(l.evicted) == 0 {
+		return nil
+	}
+	evicted := l.evicted
+	l.evicted = nil
+	return evicted
+}
+
+// Marks s as the most recently active stream.
+func (l *streamLRU) touch(s *tcpStream) {
+	if l == nil || s.elem == nil {
+		return
+	}
+	l.order.MoveToBack(s.elem)
+}
+
+// Stops tracking s, once it completes or is evicted.
+func (l *streamLRU) remove(s *tcpStream) {
+	if l == nil || s.elem == nil {
+		return
+	}
+	l.order.Remove(s.elem)
+	s.elem = nil
+}
+
+// Returns the number of TCP connections each assembly worker may track, so
+// that all workers together track at most opts.MaxTCPConnections. 0 for no
+// limit.
+func tcpConnectionShare(opts Options) int {
+	if opts.MaxTCPConnections <= 0 {
+		return 0
+	}
+	workers := opts.AssemblyWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	share := opts.MaxTCPConnections / workers
+	if share < 1 {
+		share = 1
+	}
+	return share
+}
+
+// Closes both directions of the evicted stream c with a RST passed to
+// assemble, so that the assembler forgets the connection and a new one with
+// the same addresses and ports gets a new stream. The RSTs are at sequence
+// numbers the assembler has already reached, so they are never queued as out
+// of order.
+func (c *tcpStream) closeEvicted(assemble func(gopacket.Flow, *layers.TCP, reassembly.AssemblerContext)) {
+	c.closing = true
+	defer func() { c.closing = false }()
+
+	ac := &assemblerCtxWithSeq{
+		ci: gopacket.CaptureInfo{Timestamp: c.tracker.last, InterfaceIndex: c.ifaceIndex},
+	}
+	netFlow, tcpFlow := c.netFlow, c.tcpFlow
+	for _, dir := range []reassembly.TCPFlowDirection{reassembly.TCPDirClientToServer, reassembly.TCPDirServerToClient} {
+		// The assembler removes the connection once both directions are
+		// closed, after which another RST would create a new stream.
+		if c.completed {
+			return
+		}
+		if dir == reassembly.TCPDirServerToClient {
+			netFlow, tcpFlow = netFlow.Reverse(), tcpFlow.Reverse()
+		}
+		assemble(netFlow, rstSegment(tcpFlow, c.closeSeq[dir]), ac)
+	}
+}
+
+// Returns a RST segment along tcpFlow at seq.
+func rstSegment(tcpFlow gopacket.Flow, seq reassembly.Sequence) *layers.TCP {
+	src, dst := tcpFlow.Endpoints()
+	rst := &layers.TCP{
+		SrcPort: layers.TCPPort(binary.BigEndian.Uint16(src.Raw())),
+		DstPort: layers.TCPPort(binary.BigEndian.Uint16(dst.Raw())),
+		Seq:     uint32(seq),
+		RST:     true,
+	}
+
+	// Decoding sets the ports of TransportFlow, by which the assembler finds
+	// the connection.
+	buf := gopacket.NewSerializeBuffer()
+	decoded := &layers.TCP{}
+	if err := rst.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err == nil {
+		decoded.DecodeFromBytes(buf.Bytes(), gopacket.NilDecodeFeedback)
+	}
+	return decoded
+}
@@ -0,0 +1,167 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	ghttp "github.com/mel2oo/go-pcap/gnet/http"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func TestTCPConnectionEviction(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreateTCPSYN(client, server, 40001, 80, 100),
+		CreatePacketWithSeq(client, server, 40000, 80, []byte("a"), 101),
+		// Evicts the connection from 40001, the least recently active.
+		CreateTCPSYN(client, server, 40002, 80, 100),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	opts := NewOptions()
+	WithConnectionLimits(2, 0)(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	ids := map[int]uuid.UUID{}
+	var evicted []uuid.UUID
+	packetCount, connCount := 0, 0
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case gnet.TCPPacketMetadata:
+			packetCount++
+			ids[tr.SrcPort] = tr.ConnectionID
+		case gnet.TCPConnectionMetadata:
+			connCount++
+		case gnet.ConnectionEvicted:
+			evicted = append(evicted, c.ConnectionID)
+			assert.Equal(t, 40001, tr.SrcPort)
+		}
+	}
+
+	assert.Equal(t, []uuid.UUID{ids[40001]}, evicted)
+	assert.Equal(t, 4, packetCount)
+	assert.Equal(t, 3, connCount)
+	assert.Equal(t, uint64(1), p.Stats().TCPConnectionsEvicted)
+}
+
+func TestTCPConnectionReuseAfterEviction(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	req := []byte("GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreatePacketWithSeq(client, server, 40000, 80, []byte("partial"), 101),
+		// Evicts the connection from 40000.
+		CreateTCPSYN(client, server, 40001, 80, 100),
+		// A new connection from 40000, with another initial sequence number.
+		CreateTCPSYN(client, server, 40000, 80, 5000),
+		CreatePacketWithSeq(client, server, 40000, 80, req, 5001),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	opts := NewOptions()
+	WithConnectionLimits(1, 0)(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(), ghttp.NewHTTPRequestParserFactory(pool))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var connIDs []uuid.UUID
+	var paths []string
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case gnet.TCPPacketMetadata:
+			if c.SYN && tr.SrcPort == 40000 {
+				connIDs = append(connIDs, tr.ConnectionID)
+			}
+		case gnet.HTTPRequest:
+			paths = append(paths, c.URL.Path)
+		}
+		tr.Content.ReleaseBuffers()
+	}
+
+	if assert.Len(t, connIDs, 2) {
+		assert.NotEqual(t, connIDs[0], connIDs[1])
+	}
+	assert.Equal(t, []string{"/a"}, paths)
+	assert.Equal(t, uint64(2), p.Stats().TCPConnectionsEvicted)
+}
+
+func TestUDPFlowEviction(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateUDPPacket(client, server, 40000, 9999, []byte("count")),
+		CreateUDPPacket(client, server, 40001, 9999, []byte("count")),
+		CreateUDPPacket(client, server, 40000, 9999, []byte("a")),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Second)
+	}
+
+	opts := NewOptions()
+	WithUDPFlows(time.Minute, countingUDPFactory{})(&opts)
+	WithConnectionLimits(0, 1)(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var ids, evicted []uuid.UUID
+	var counts []udpCounts
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case udpCounts:
+			counts = append(counts, c)
+		case gnet.ConnectionEvicted:
+			evicted = append(evicted, c.ConnectionID)
+		default:
+			ids = append(ids, tr.ConnectionID)
+		}
+	}
+
+	// Each datagram evicts the flow of the one before it.
+	if assert.Len(t, ids, 3) && assert.Len(t, evicted, 2) {
+		assert.Equal(t, ids[0], evicted[0])
+		assert.Equal(t, ids[1], evicted[1])
+		assert.NotEqual(t, ids[0], ids[2])
+	}
+	// The counts of the evicted flows are still reported.
+	assert.Equal(t, []udpCounts{{1, 0}, {1, 0}}, counts)
+	assert.Equal(t, uint64(2), p.Stats().UDPFlowsEvicted)
+}
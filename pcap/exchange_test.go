@@ -0,0 +1,74 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	ghttp "github.com/mel2oo/go-pcap/gnet/http"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+// A response that fails to parse must not shift the pairing of the later
+// exchanges on its connection.
+func TestExchangesResyncAfterUnparseableResponse(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	reqA := []byte("GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	reqB := []byte("GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	badResp := []byte("HTTP/1.1 200 OK\r\nContent-Length: abc\r\n\r\n")
+	resp := []byte("HTTP/1.1 204 No Content\r\n\r\n")
+
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreateTCPSYNAndACK(server, client, 80, 40000, 500),
+		CreatePacketWithSeq(client, server, 40000, 80, reqA, 101),
+		CreatePacketWithSeq(server, client, 80, 40000, badResp, 501),
+		CreatePacketWithSeq(client, server, 40000, 80, reqB, 101+uint32(len(reqA))),
+		CreatePacketWithSeq(server, client, 80, 40000, resp, 501+uint32(len(badResp))),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(),
+		ghttp.NewHTTPRequestParserFactory(pool), ghttp.NewHTTPResponseParserFactory(pool))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	requests := map[string]int{}
+	responses := map[int]int{}
+	dropped := false
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case gnet.HTTPRequest:
+			requests[c.URL.Path] = c.Seq
+		case gnet.HTTPResponse:
+			responses[c.StatusCode] = c.Seq
+		case gnet.DroppedBytes:
+			dropped = true
+		}
+		tr.Content.ReleaseBuffers()
+	}
+
+	assert.True(t, dropped)
+	if assert.Len(t, requests, 2) && assert.Len(t, responses, 1) {
+		assert.Equal(t, requests["/b"], responses[204])
+		assert.NotEqual(t, requests["/a"], responses[204])
+	}
+}
@@ -0,0 +1,28 @@
+package pcap
+
+import (
+	"sync/atomic"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/filter"
+)
+
+// Passes through the traffic from in that f keeps, releasing the buffers of
+// the rest.
+func (p *TrafficParser) filter(f filter.Filter, in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			if f(t) {
+				out <- t
+				continue
+			}
+			atomic.AddUint64(&p.counters.trafficFiltered, 1)
+			if t.Content != nil {
+				t.Content.ReleaseBuffers()
+			}
+		}
+	}()
+	return out
+}
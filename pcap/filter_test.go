@@ -0,0 +1,36 @@
+package pcap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet/filter"
+)
+
+func TestFilter(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateUDPPacket(client, server, 40000, 53, []byte("a")),
+		CreateUDPPacket(client, server, 40001, 123, []byte("b")),
+		CreateUDPPacket(server, client, 53, 40000, []byte("c")),
+	}
+
+	opts := NewOptions()
+	WithFilter(filter.MustCompile("port 53"))(&opts)
+	traffic, stats := parseAll(t, opts, packets)
+
+	var payloads []string
+	for _, tr := range traffic {
+		payloads = append(payloads, string(tr.Payload))
+	}
+	assert.Equal(t, []string{"a", "c"}, payloads)
+	assert.Equal(t, uint64(1), stats.TrafficFiltered)
+}
+
+func TestInvalidFilterExpr(t *testing.T) {
+	_, err := NewTrafficParser(WithReadName("capture.pcap", false), WithFilterExpr("port"))
+	assert.Error(t, err)
+}
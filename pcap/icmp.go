@@ -0,0 +1,129 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func icmpv4Content(l *layers.ICMPv4) gnet.ICMPv4 {
+	c := gnet.ICMPv4{
+		TypeCode: l.TypeCode,
+		Checksum: l.Checksum,
+		Id:       l.Id,
+		Seq:      l.Seq,
+	}
+	c.TypeName, c.CodeName = splitTypeCode(l.TypeCode.String())
+
+	switch l.TypeCode.Type() {
+	case layers.ICMPv4TypeDestinationUnreachable:
+		if l.TypeCode.Code() == layers.ICMPv4CodeFragmentationNeeded {
+			// The MTU is where the sequence number of echo messages is.
+			c.MTU = l.Seq
+		}
+		c.Id, c.Seq = 0, 0
+		c.Original = icmpOriginal(l.LayerPayload(), layers.LayerTypeIPv4)
+	case layers.ICMPv4TypeTimeExceeded, layers.ICMPv4TypeParameterProblem, layers.ICMPv4TypeRedirect:
+		c.Id, c.Seq = 0, 0
+		c.Original = icmpOriginal(l.LayerPayload(), layers.LayerTypeIPv4)
+	}
+	return c
+}
+
+func icmpv6Content(packet gopacket.Packet, l *layers.ICMPv6) gnet.ICMPv6 {
+	c := gnet.ICMPv6{
+		TypeCode: l.TypeCode,
+		Checksum: l.Checksum,
+	}
+	c.TypeName, c.CodeName = splitTypeCode(l.TypeCode.String())
+
+	// Error messages have 4 bytes of type-specific data before the original
+	// datagram.
+	payload := l.LayerPayload()
+	switch l.TypeCode.Type() {
+	case layers.ICMPv6TypeEchoRequest, layers.ICMPv6TypeEchoReply:
+		if echo, ok := packet.Layer(layers.LayerTypeICMPv6Echo).(*layers.ICMPv6Echo); ok {
+			c.Id, c.Seq = echo.Identifier, echo.SeqNumber
+		}
+	case layers.ICMPv6TypePacketTooBig:
+		if len(payload) >= 4 {
+			c.MTU = binary.BigEndian.Uint32(payload)
+			c.Original = icmpOriginal(payload[4:], layers.LayerTypeIPv6)
+		}
+	case layers.ICMPv6TypeDestinationUnreachable, layers.ICMPv6TypeTimeExceeded, layers.ICMPv6TypeParameterProblem:
+		if len(payload) >= 4 {
+			c.Original = icmpOriginal(payload[4:], layers.LayerTypeIPv6)
+		}
+	}
+	return c
+}
+
+// Returns the Neighbor Discovery message carried by packet, if any.
+func ndpContent(packet gopacket.Packet) (gnet.NDP, bool) {
+	for _, l := range packet.Layers() {
+		if m, ok := gnet.FromNDP(l); ok {
+			return m, true
+		}
+	}
+	return gnet.NDP{}, false
+}
+
+// Splits the name of an ICMP type and code, as formatted by gopacket, e.g.
+// "DestinationUnreachable(Port)". Unknown codes are left out.
+func splitTypeCode(s string) (string, string) {
+	i := strings.IndexByte(s, '(')
+	if i < 0 || !strings.HasSuffix(s, ")") {
+		return s, ""
+	}
+	code := s[i+1 : len(s)-1]
+	if strings.HasPrefix(code, "Code:") {
+		code = ""
+	}
+	return s[:i], code
+}
+
+// Parses the IP header, and the ports if present, of the datagram quoted in an
+// ICMP error. Errors quote at least the IP header and 8 bytes of payload.
+// Returns nil if data is too short.
+func icmpOriginal(data []byte, ipType gopacket.LayerType) *gnet.ICMPOriginal {
+	var o gnet.ICMPOriginal
+	var rest []byte
+	if ipType == layers.LayerTypeIPv4 {
+		if len(data) < 20 {
+			return nil
+		}
+		ihl := int(data[0]&0x0f) * 4
+		if ihl < 20 || len(data) < ihl {
+			return nil
+		}
+		o.TTL = data[8]
+		o.Protocol = layers.IPProtocol(data[9])
+		o.SrcIP = net.IP(append([]byte(nil), data[12:16]...))
+		o.DstIP = net.IP(append([]byte(nil), data[16:20]...))
+		rest = data[ihl:]
+	} else {
+		if len(data) < 40 {
+			return nil
+		}
+		// Extension headers are not followed.
+		o.Protocol = layers.IPProtocol(data[6])
+		o.TTL = data[7]
+		o.SrcIP = net.IP(append([]byte(nil), data[8:24]...))
+		o.DstIP = net.IP(append([]byte(nil), data[24:40]...))
+		rest = data[40:]
+	}
+
+	switch o.Protocol {
+	case layers.IPProtocolTCP, layers.IPProtocolUDP, layers.IPProtocolSCTP:
+		if len(rest) >= 4 {
+			o.SrcPort = int(binary.BigEndian.Uint16(rest[0:2]))
+			o.DstPort = int(binary.BigEndian.Uint16(rest[2:4]))
+		}
+	}
+	return &o
+}
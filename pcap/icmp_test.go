@@ -0,0 +1,103 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func serializeICMP(t *testing.T, ip gopacket.SerializableLayer, ls ...gopacket.SerializableLayer) gopacket.Packet {
+	buf := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+		append([]gopacket.SerializableLayer{ip}, ls...)...)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return gopacket.NewPacket(buf.Bytes(), ip.LayerType(), gopacket.Default)
+}
+
+func TestICMPv4(t *testing.T) {
+	router, client, server := net.IPv4(10, 0, 0, 254), net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+
+	// A traceroute probe whose TTL ran out, quoted in full.
+	probe := serializeICMP(t,
+		&layers.IPv4{Version: 4, TTL: 1, Protocol: layers.IPProtocolUDP, SrcIP: client, DstIP: server},
+		&layers.UDP{SrcPort: 40000, DstPort: 33434}, gopacket.Payload("probe"))
+	p := serializeICMP(t,
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: router, DstIP: client},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimeExceeded, layers.ICMPv4CodeTTLExceeded)},
+		gopacket.Payload(probe.Data()))
+
+	c := icmpv4Content(p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4))
+	assert.Equal(t, "TimeExceeded", c.TypeName)
+	assert.Equal(t, "TTLExceeded", c.CodeName)
+	if assert.NotNil(t, c.Original) {
+		assert.True(t, client.Equal(c.Original.SrcIP))
+		assert.True(t, server.Equal(c.Original.DstIP))
+		assert.Equal(t, layers.IPProtocolUDP, c.Original.Protocol)
+		assert.Equal(t, uint8(1), c.Original.TTL)
+		assert.Equal(t, 40000, c.Original.SrcPort)
+		assert.Equal(t, 33434, c.Original.DstPort)
+	}
+
+	// Path MTU discovery.
+	p = serializeICMP(t,
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: router, DstIP: client},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeDestinationUnreachable, layers.ICMPv4CodeFragmentationNeeded), Seq: 1400},
+		gopacket.Payload(probe.Data()[:28]))
+	c = icmpv4Content(p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4))
+	assert.Equal(t, "DestinationUnreachable", c.TypeName)
+	assert.Equal(t, uint16(1400), c.MTU)
+	assert.Equal(t, uint16(0), c.Seq)
+	assert.NotNil(t, c.Original)
+
+	p = serializeICMP(t,
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: client, DstIP: server},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 7, Seq: 3})
+	c = icmpv4Content(p.Layer(layers.LayerTypeICMPv4).(*layers.ICMPv4))
+	assert.Equal(t, gnet.ICMPv4{
+		TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0),
+		Id:       7,
+		Seq:      3,
+		TypeName: "EchoRequest",
+	}, c)
+}
+
+func TestICMPv6(t *testing.T) {
+	router, client, server := net.ParseIP("fd00::fe"), net.ParseIP("fd00::1"), net.ParseIP("fd00::2")
+
+	big := serializeICMP(t,
+		&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolTCP, SrcIP: client, DstIP: server},
+		&layers.TCP{SrcPort: 40000, DstPort: 443}, gopacket.Payload(make([]byte, 1500)))
+	mtu := make([]byte, 4)
+	binary.BigEndian.PutUint32(mtu, 1280)
+	p := serializeICMP(t,
+		&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: router, DstIP: client},
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypePacketTooBig, 0)},
+		gopacket.Payload(append(mtu, big.Data()[:1232]...)))
+
+	c := icmpv6Content(p, p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6))
+	assert.Equal(t, "PacketTooBig", c.TypeName)
+	assert.Equal(t, uint32(1280), c.MTU)
+	if assert.NotNil(t, c.Original) {
+		assert.True(t, server.Equal(c.Original.DstIP))
+		assert.Equal(t, layers.IPProtocolTCP, c.Original.Protocol)
+		assert.Equal(t, 443, c.Original.DstPort)
+	}
+
+	p = serializeICMP(t,
+		&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolICMPv6, SrcIP: client, DstIP: server},
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)},
+		&layers.ICMPv6Echo{Identifier: 7, SeqNumber: 3})
+	c = icmpv6Content(p, p.Layer(layers.LayerTypeICMPv6).(*layers.ICMPv6))
+	assert.Equal(t, "EchoRequest", c.TypeName)
+	assert.Equal(t, uint16(7), c.Id)
+	assert.Equal(t, uint16(3), c.Seq)
+	assert.Nil(t, c.Original)
+}
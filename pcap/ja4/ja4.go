@@ -0,0 +1,250 @@
+package ja4
+
+// https://github.com/FoxIO-LLC/ja4
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// The transport a TLS handshake was carried over, which is the first
+// character of JA4 and JA4S fingerprints.
+type Transport byte
+
+const (
+	TCP  Transport = 't'
+	QUIC Transport = 'q'
+	DTLS Transport = 'd'
+)
+
+const (
+	serverNameExtension = 0x0000
+	alpnExtension       = 0x0010
+
+	// Hash of an empty list.
+	emptyHash = "000000000000"
+)
+
+// GetJa4Hash returns the raw JA4 fingerprint of a Client Hello, with lists in
+// sorted order, and the fingerprint itself.
+func GetJa4Hash(clientHello gnet.TLSClientHello, transport Transport) (string, string) {
+	ciphers := hexList(withoutGREASE(clientHello.CipherSuites), true)
+	extensions := withoutGREASE(clientHello.Extensions)
+	algorithms := hexList(withoutGREASE(clientHello.SignatureAlgorithms), false)
+
+	version := uint16(clientHello.Version)
+	for _, v := range withoutGREASE(clientHello.SupportedVersions) {
+		if v > version {
+			version = v
+		}
+	}
+
+	sni := "i"
+	if clientHello.ServerName != "" {
+		sni = "d"
+	}
+
+	alpn := ""
+	if len(clientHello.AlpnProtocols) > 0 {
+		alpn = clientHello.AlpnProtocols[0]
+	}
+
+	a := fmt.Sprintf("%c%s%s%s%s%s", transport, versionString(version), sni,
+		count(len(ciphers)), count(len(extensions)), alpnString(alpn))
+
+	// The SNI and ALPN extensions are already represented in a.
+	var hashed []uint16
+	for _, e := range extensions {
+		if e != serverNameExtension && e != alpnExtension {
+			hashed = append(hashed, e)
+		}
+	}
+	extensionsAndAlgorithms := strings.Join(hexList(hashed, true), ",")
+	if len(algorithms) > 0 {
+		extensionsAndAlgorithms += "_" + strings.Join(algorithms, ",")
+	}
+
+	raw := a + "_" + strings.Join(ciphers, ",") + "_" + extensionsAndAlgorithms
+
+	c := emptyHash
+	if len(hashed) > 0 {
+		c = truncatedHash(extensionsAndAlgorithms)
+	}
+	return raw, a + "_" + hashOf(ciphers) + "_" + c
+}
+
+// GetJa4SHash returns the raw JA4S fingerprint of a Server Hello and the
+// fingerprint itself.
+func GetJa4SHash(serverHello gnet.TLSServerHello, transport Transport) (string, string) {
+	extensions := hexList(withoutGREASE(serverHello.Extensions), false)
+
+	version := serverHello.Version
+	if serverHello.SelectedVersion != 0 {
+		version = serverHello.SelectedVersion
+	}
+
+	a := fmt.Sprintf("%c%s%s%s", transport, versionString(uint16(version)),
+		count(len(extensions)), alpnString(serverHello.SelectedProtocol))
+	b := fmt.Sprintf("%04x", serverHello.CipherSuite)
+
+	raw := a + "_" + b + "_" + strings.Join(extensions, ",")
+	return raw, a + "_" + b + "_" + hashOf(extensions)
+}
+
+// GetJa4HHash returns the raw JA4H fingerprint of an HTTP request and the
+// fingerprint itself.
+//
+// The fingerprint depends on the order of the request's headers. If the
+// parser did not record it, the headers are taken in sorted order, and the
+// result will not match fingerprints computed elsewhere.
+func GetJa4HHash(req gnet.HTTPRequest) (string, string) {
+	names := req.HeaderOrder
+	if names == nil {
+		for name := range req.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	cookie, referer := "n", "n"
+	var headers []string
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "cookie":
+			cookie = "c"
+		case "referer":
+			referer = "r"
+		default:
+			headers = append(headers, name)
+		}
+	}
+
+	method := strings.ToLower(req.Method)
+	if len(method) > 2 {
+		method = method[:2]
+	}
+
+	language := strings.ToLower(strings.ReplaceAll(req.Header.Get("Accept-Language"), "-", ""))
+	if i := strings.IndexByte(language, ','); i >= 0 {
+		language = language[:i]
+	}
+	if len(language) > 4 {
+		language = language[:4]
+	}
+	language += strings.Repeat("0", 4-len(language))
+
+	a := fmt.Sprintf("%s%d%d%s%s%s%s", method, req.ProtoMajor, req.ProtoMinor,
+		cookie, referer, count(len(headers)), language)
+
+	var cookieNames, cookieFields []string
+	for _, c := range req.Cookies {
+		cookieNames = append(cookieNames, c.Name)
+		cookieFields = append(cookieFields, c.Name+"="+c.Value)
+	}
+	sort.Strings(cookieNames)
+	sort.Strings(cookieFields)
+
+	raw := strings.Join([]string{
+		a,
+		strings.Join(headers, ","),
+		strings.Join(cookieNames, ","),
+		strings.Join(cookieFields, ","),
+	}, "_")
+	fingerprint := strings.Join([]string{
+		a,
+		hashOf(headers),
+		hashOf(cookieNames),
+		hashOf(cookieFields),
+	}, "_")
+	return raw, fingerprint
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	var result []uint16
+	for _, v := range values {
+		if !gnet.IsGREASE(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// Formats values as 4-digit hex strings, optionally sorted.
+func hexList(values []uint16, sorted bool) []string {
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = fmt.Sprintf("%04x", v)
+	}
+	if sorted {
+		sort.Strings(result)
+	}
+	return result
+}
+
+func versionString(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	}
+	return "00"
+}
+
+// Formats a count as two digits, capped at 99.
+func count(n int) string {
+	if n > 99 {
+		n = 99
+	}
+	return fmt.Sprintf("%02d", n)
+}
+
+// The first and last characters of an ALPN value, or of its hex encoding if
+// either is not alphanumeric.
+func alpnString(alpn string) string {
+	if alpn == "" {
+		return "00"
+	}
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		h := hex.EncodeToString([]byte(alpn))
+		return h[:1] + h[len(h)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+func isAlphanumeric(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func hashOf(values []string) string {
+	if len(values) == 0 {
+		return emptyHash
+	}
+	return truncatedHash(strings.Join(values, ","))
+}
+
+// The first 12 hex characters of the SHA-256 of s.
+func truncatedHash(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])[:12]
+}
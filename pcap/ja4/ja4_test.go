@@ -0,0 +1,90 @@
+package ja4
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestJa4(t *testing.T) {
+	// A Chrome Client Hello, from the JA4 documentation, with GREASE values
+	// added.
+	hello := gnet.TLSClientHello{
+		Version: gnet.TLSV1_2,
+		CipherSuites: []uint16{
+			0x2a2a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030,
+			0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+		},
+		Extensions: []uint16{
+			0x8a8a, 0x0000, 0x0017, 0xff01, 0x000a, 0x000b, 0x0023, 0x0010,
+			0x0005, 0x000d, 0x0012, 0x0033, 0x002d, 0x002b, 0x001b, 0x0015,
+			0x4469, 0xbaba,
+		},
+		SignatureAlgorithms: []uint16{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+		SupportedVersions:   []uint16{0x7a7a, 0x0304, 0x0303},
+		ServerName:          "example.com",
+		AlpnProtocols:       []string{"h2", "http/1.1"},
+	}
+
+	raw, fingerprint := GetJa4Hash(hello, TCP)
+	assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", fingerprint)
+	assert.Equal(t, "t13d1516h2_002f,0035,009c,009d,1301,1302,1303,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_"+
+		"0005,000a,000b,000d,0012,0015,0017,001b,0023,002b,002d,0033,4469,ff01_"+
+		"0403,0804,0401,0503,0805,0501,0806,0601", raw)
+
+	hello.ServerName = ""
+	hello.AlpnProtocols = nil
+	_, fingerprint = GetJa4Hash(hello, QUIC)
+	assert.Equal(t, "q13i151600", fingerprint[:10])
+}
+
+func TestJa4S(t *testing.T) {
+	raw, fingerprint := GetJa4SHash(gnet.TLSServerHello{
+		Version:          gnet.TLSV1_2,
+		SelectedVersion:  gnet.TLSV1_3,
+		CipherSuite:      0x1301,
+		Extensions:       []uint16{0x002b, 0x0033, 0x0010},
+		SelectedProtocol: "h2",
+	}, TCP)
+	assert.Equal(t, "t1303h2_1301_002b,0033,0010", raw)
+	assert.Equal(t, "t1303h2_1301_"+truncatedHash("002b,0033,0010"), fingerprint)
+}
+
+func TestJa4H(t *testing.T) {
+	req := gnet.HTTPRequest{
+		Method:     "GET",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Host":            {"example.com"},
+			"Accept-Language": {"en-US,en;q=0.9"},
+			"Cookie":          {"b=2; a=1"},
+			"User-Agent":      {"test"},
+		},
+		HeaderOrder: []string{"Host", "User-Agent", "Cookie", "Accept-Language"},
+		Cookies:     []*http.Cookie{{Name: "b", Value: "2"}, {Name: "a", Value: "1"}},
+	}
+
+	raw, fingerprint := GetJa4HHash(req)
+	assert.Equal(t, "ge11cn03enus_Host,User-Agent,Accept-Language_a,b_a=1,b=2", raw)
+	assert.Equal(t, "ge11cn03enus_"+truncatedHash("Host,User-Agent,Accept-Language")+"_"+
+		truncatedHash("a,b")+"_"+truncatedHash("a=1,b=2"), fingerprint)
+
+	req.Cookies = nil
+	req.HeaderOrder = nil
+	delete(req.Header, "Cookie")
+	delete(req.Header, "Accept-Language")
+	_, fingerprint = GetJa4HHash(req)
+	assert.Equal(t, "ge11nn020000", fingerprint[:12])
+	assert.Equal(t, "000000000000_000000000000", fingerprint[len(fingerprint)-25:])
+}
+
+func TestAlpnString(t *testing.T) {
+	assert.Equal(t, "00", alpnString(""))
+	assert.Equal(t, "h1", alpnString("http/1.1"))
+	assert.Equal(t, "hh", alpnString("h"))
+	assert.Equal(t, "ab", alpnString("\xab"))
+}
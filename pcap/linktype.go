@@ -0,0 +1,108 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Link type of the Linux cooked capture v2 header, written by libpcap 1.10 and
+// later when capturing on the "any" device.
+const linkTypeLinuxSLL2 = 276
+
+// layers.LinkType is 8 bits wide in the version of gopacket we use, so readers
+// report the SLL2 link type truncated to 20, which is otherwise unassigned.
+// gopacket cannot decode it by link type.
+const LinkTypeLinuxSLL2 = layers.LinkType(linkTypeLinuxSLL2 & 0xff)
+
+// LayerTypeLinuxSLL2 is the layer type of LinuxSLL2.
+var LayerTypeLinuxSLL2 = gopacket.RegisterLayerType(1100, gopacket.LayerTypeMetadata{
+	Name:    "LinuxSLL2",
+	Decoder: gopacket.DecodeFunc(decodeLinuxSLL2),
+})
+
+// Length of the Linux cooked capture v2 header.
+const linuxSLL2HeaderLen = 20
+
+// Linux cooked capture v2 header. Unlike v1, it records the interface each
+// packet was captured on.
+type LinuxSLL2 struct {
+	layers.BaseLayer
+	EthernetType   layers.EthernetType
+	InterfaceIndex uint32
+	AddrType       uint16
+	PacketType     layers.LinuxSLLPacketType
+	Addr           net.HardwareAddr
+}
+
+func (sll *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+func (sll *LinuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < linuxSLL2HeaderLen {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	sll.EthernetType = layers.EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	sll.InterfaceIndex = binary.BigEndian.Uint32(data[4:8])
+	sll.AddrType = binary.BigEndian.Uint16(data[8:10])
+	sll.PacketType = layers.LinuxSLLPacketType(data[10])
+	addrLen := int(data[11])
+	if addrLen > 8 {
+		addrLen = 8
+	}
+	sll.Addr = net.HardwareAddr(data[12 : 12+addrLen])
+	sll.BaseLayer = layers.BaseLayer{Contents: data[:linuxSLL2HeaderLen], Payload: data[linuxSLL2HeaderLen:]}
+	return nil
+}
+
+func (sll *LinuxSLL2) CanDecode() gopacket.LayerClass {
+	return LayerTypeLinuxSLL2
+}
+
+func (sll *LinuxSLL2) NextLayerType() gopacket.LayerType {
+	return sll.EthernetType.LayerType()
+}
+
+// The header only holds the source address.
+func (sll *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, sll.Addr, nil)
+}
+
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	sll := &LinuxSLL2{}
+	if err := sll.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(sll)
+	p.SetLinkLayer(sll)
+	return p.NextDecoder(sll.EthernetType)
+}
+
+// Returns the decoder for packets of the given link type, including link
+// types gopacket does not know.
+func decoderFor(linkType layers.LinkType) gopacket.Decoder {
+	if linkType == LinkTypeLinuxSLL2 {
+		return LayerTypeLinuxSLL2
+	}
+	return linkType
+}
+
+// Length of the Linux cooked capture v1 header.
+const linuxSLLHeaderLen = 16
+
+// Converts a packet with a Linux cooked capture v2 header to one with a v1
+// header, which can be written to capture files. The interface index is lost.
+func linuxSLL2ToSLL(data []byte) []byte {
+	if len(data) < linuxSLL2HeaderLen {
+		return data
+	}
+	out := make([]byte, linuxSLLHeaderLen, linuxSLLHeaderLen+len(data)-linuxSLL2HeaderLen)
+	out[1] = data[10]            // packet type
+	copy(out[2:4], data[8:10])   // ARPHRD type
+	out[5] = data[11]            // address length
+	copy(out[6:14], data[12:20]) // address
+	copy(out[14:16], data[0:2])  // protocol
+	return append(out, data[linuxSLL2HeaderLen:]...)
+}
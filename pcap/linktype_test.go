@@ -0,0 +1,109 @@
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkTypes(t *testing.T) {
+	frame := CreateTCPSYN(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 80, 1)
+	ip := frame.LinkLayer().LayerPayload()
+
+	sll := make([]byte, 16)
+	binary.BigEndian.PutUint16(sll[0:], uint16(layers.LinuxSLLPacketTypeHost))
+	binary.BigEndian.PutUint16(sll[2:], 1) // ARPHRD_ETHER
+	binary.BigEndian.PutUint16(sll[4:], 6)
+	copy(sll[6:], []byte{1, 2, 3, 4, 5, 6})
+	binary.BigEndian.PutUint16(sll[14:], uint16(layers.EthernetTypeIPv4))
+
+	sll2 := make([]byte, linuxSLL2HeaderLen)
+	binary.BigEndian.PutUint16(sll2[0:], uint16(layers.EthernetTypeIPv4))
+	binary.BigEndian.PutUint32(sll2[4:], 3)
+	binary.BigEndian.PutUint16(sll2[8:], 1) // ARPHRD_ETHER
+	sll2[10] = byte(layers.LinuxSLLPacketTypeHost)
+	sll2[11] = 6
+	copy(sll2[12:], []byte{1, 2, 3, 4, 5, 6})
+
+	// NULL has the address family in host byte order, LOOP in network order.
+	null := make([]byte, 4)
+	binary.LittleEndian.PutUint32(null, uint32(layers.ProtocolFamilyIPv4))
+	loop := make([]byte, 4)
+	binary.BigEndian.PutUint32(loop, uint32(layers.ProtocolFamilyIPv4))
+
+	for _, tc := range []struct {
+		linkType layers.LinkType
+		header   []byte
+		first    gopacket.LayerType
+	}{
+		{layers.LinkTypeLinuxSLL, sll, layers.LayerTypeLinuxSLL},
+		{LinkTypeLinuxSLL2, sll2, LayerTypeLinuxSLL2},
+		{layers.LinkTypeNull, null, layers.LayerTypeLoopback},
+		{layers.LinkTypeLoop, loop, layers.LayerTypeLoopback},
+	} {
+		name := tc.first.String()
+		data := append(append([]byte(nil), tc.header...), ip...)
+
+		var buf bytes.Buffer
+		w := pcapgo.NewWriter(&buf)
+		assert.NoError(t, w.WriteFileHeader(DefaultSnapLen, tc.linkType))
+		if tc.linkType == LinkTypeLinuxSLL2 {
+			// As written by libpcap, untruncated.
+			binary.LittleEndian.PutUint32(buf.Bytes()[20:], linkTypeLinuxSLL2)
+		}
+		assert.NoError(t, w.WritePacket(gopacket.CaptureInfo{
+			Timestamp: time.Unix(1700000000, 0), CaptureLength: len(data), Length: len(data),
+		}, data))
+
+		out, err := NewStreamReader(&buf, "").Capture(context.Background())
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		p, ok := <-out
+		if !assert.True(t, ok, name) {
+			continue
+		}
+		assert.Equal(t, tc.first, p.Layers()[0].LayerType(), name)
+		assert.Nil(t, p.ErrorLayer(), name)
+		if tcp, ok := p.TransportLayer().(*layers.TCP); assert.True(t, ok, name) {
+			assert.Equal(t, layers.TCPPort(80), tcp.DstPort, name)
+		}
+	}
+}
+
+func TestLinuxSLL2(t *testing.T) {
+	sll2 := make([]byte, linuxSLL2HeaderLen)
+	binary.BigEndian.PutUint16(sll2[0:], uint16(layers.EthernetTypeIPv6))
+	binary.BigEndian.PutUint32(sll2[4:], 3)
+	sll2[10] = byte(layers.LinuxSLLPacketTypeOutgoing)
+	sll2[11] = 6
+	copy(sll2[12:], []byte{1, 2, 3, 4, 5, 6})
+
+	var l LinuxSLL2
+	assert.NoError(t, l.DecodeFromBytes(sll2, gopacket.NilDecodeFeedback))
+	assert.Equal(t, layers.EthernetTypeIPv6, l.EthernetType)
+	assert.Equal(t, uint32(3), l.InterfaceIndex)
+	assert.Equal(t, layers.LinuxSLLPacketTypeOutgoing, l.PacketType)
+	assert.Equal(t, net.HardwareAddr{1, 2, 3, 4, 5, 6}, l.Addr)
+	assert.Equal(t, layers.LayerTypeIPv6, l.NextLayerType())
+
+	assert.Error(t, l.DecodeFromBytes(sll2[:10], gopacket.NilDecodeFeedback))
+
+	// Converted to SLL for capture files.
+	data := append(sll2, 0x60)
+	p := gopacket.NewPacket(linuxSLL2ToSLL(data), layers.LayerTypeLinuxSLL, gopacket.Default)
+	if sll, ok := p.LinkLayer().(*layers.LinuxSLL); assert.True(t, ok) {
+		assert.Equal(t, layers.EthernetTypeIPv6, sll.EthernetType)
+		assert.Equal(t, layers.LinuxSLLPacketTypeOutgoing, sll.PacketType)
+		assert.Equal(t, net.HardwareAddr{1, 2, 3, 4, 5, 6}, sll.Addr)
+		assert.Equal(t, []byte{0x60}, sll.LayerPayload())
+	}
+}
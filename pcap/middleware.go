@@ -0,0 +1,45 @@
+package pcap
+
+import "github.com/mel2oo/go-pcap/gnet"
+
+// Middleware transforms traffic on its way out of Parse, e.g. to redact or
+// count it. It returns the traffic to pass on, and false to drop it instead.
+type Middleware func(t gnet.NetTraffic) (gnet.NetTraffic, bool)
+
+// Use adds m to the middleware run on the traffic returned by Parse, after
+// the middleware added before it and after the parser's own filtering and
+// enrichment. Middleware runs on a single goroutine, so it sees traffic in
+// order and needs no locking, but slow middleware holds up the consumer. Must
+// not be called once Parse has been.
+func (p *TrafficParser) Use(m Middleware) {
+	p.middleware = append(p.middleware, m)
+}
+
+// Passes traffic from in through the middleware, releasing the buffers of
+// traffic it drops.
+func (p *TrafficParser) runMiddleware(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			if t, keep := p.applyMiddleware(t); keep {
+				out <- t
+			} else if t.Content != nil {
+				t.Content.ReleaseBuffers()
+			}
+		}
+	}()
+	return out
+}
+
+// Runs t through the middleware in order, stopping at the first that drops
+// it.
+func (p *TrafficParser) applyMiddleware(t gnet.NetTraffic) (gnet.NetTraffic, bool) {
+	for _, m := range p.middleware {
+		var keep bool
+		if t, keep = m(t); !keep {
+			return t, false
+		}
+	}
+	return t, true
+}
@@ -0,0 +1,51 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestMiddleware(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateUDPPacket(client, server, 40000, 53, []byte("a")),
+		CreateUDPPacket(client, server, 40001, 123, []byte("b")),
+		CreateUDPPacket(client, server, 40002, 53, []byte("c")),
+	}
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	var seen []string
+	p.Use(func(t gnet.NetTraffic) (gnet.NetTraffic, bool) {
+		seen = append(seen, string(t.Payload))
+		return t, t.DstPort == 53
+	})
+	p.Use(func(t gnet.NetTraffic) (gnet.NetTraffic, bool) {
+		t.Payload = nil
+		t.Interface = "redacted"
+		return t, true
+	})
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var ports []int
+	for tr := range out {
+		ports = append(ports, tr.SrcPort)
+		assert.Nil(t, tr.Payload)
+		assert.Equal(t, "redacted", tr.Interface)
+	}
+	assert.Equal(t, []int{40000, 40002}, ports)
+	assert.Equal(t, []string{"a", "b", "c"}, seen)
+}
@@ -0,0 +1,289 @@
+package pcap
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// How often a MultiFileReader looks for new files when watching.
+const DefaultWatchInterval = time.Second
+
+// Extensions of the files read from a directory.
+var captureFileExtensions = map[string]bool{
+	".pcap":   true,
+	".pcapng": true,
+	".cap":    true,
+}
+
+// Read packets from several pcap or pcapng files as one stream. The files are
+// read one after the other, in the order of the timestamp of their first
+// packet, so files written by rotation, such as with WithCaptureFile, are
+// read in the order they were captured.
+//
+// The first packet of each file carries a boundary in its AncillaryData,
+// which TrafficParser reports as gnet.CaptureFileBoundary traffic.
+type MultiFileReader struct {
+	// A glob pattern, or a directory whose .pcap, .pcapng and .cap files are
+	// read.
+	Pattern  string
+	BPFilter string
+
+	// As in FileReader, across all files.
+	ReplaySpeed float64
+
+	// Keep looking for new files every WatchInterval once all files have been
+	// read, until capture is cancelled. Files should be moved into place once
+	// complete, as a file is read only once.
+	Watch         bool
+	WatchInterval time.Duration
+
+	// If set, reading starts at Resume.File, after the packets read from it
+	// before. See WithResume.
+	Resume *Checkpoint
+
+	// Packets read from files already read. Accessed atomically.
+	received uint64
+
+	mu      sync.Mutex
+	current *FileReader
+}
+
+func NewMultiFileReader(pattern, bpfilter string) *MultiFileReader {
+	return &MultiFileReader{
+		Pattern:       pattern,
+		BPFilter:      bpfilter,
+		WatchInterval: DefaultWatchInterval,
+	}
+}
+
+// Marks the first packet of a capture file, or the first after those skipped
+// when resuming.
+type fileBoundary struct {
+	path    string
+	skipped uint64
+}
+
+// Returns the boundary of the file packet starts, if it is the first packet of
+// a file read by a MultiFileReader.
+func fileBoundaryOf(packet gopacket.Packet) (fileBoundary, bool) {
+	md := packet.Metadata()
+	if md == nil {
+		return fileBoundary{}, false
+	}
+	for _, d := range md.AncillaryData {
+		if b, ok := d.(fileBoundary); ok {
+			return b, true
+		}
+	}
+	return fileBoundary{}, false
+}
+
+func (m *MultiFileReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	seen := map[string]bool{}
+	files, err := listCaptureFiles(m.Pattern, seen)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && !m.Watch {
+		return nil, fmt.Errorf("no capture files match %s", m.Pattern)
+	}
+	var skip uint64
+	if m.Resume != nil {
+		i := indexOf(files, m.Resume.File)
+		if i < 0 {
+			return nil, fmt.Errorf("cannot resume from %s: no such file matches %s", m.Resume.File, m.Pattern)
+		}
+		files, skip = files[i:], m.Resume.Packets
+	}
+	atomic.StoreUint64(&m.received, 0)
+
+	var pacer *replayPacer
+	if m.ReplaySpeed > 0 {
+		pacer = newReplayPacer(m.ReplaySpeed)
+	}
+
+	out := make(chan gopacket.Packet, 10)
+	go func() {
+		defer close(out)
+
+		interval := m.WatchInterval
+		if interval <= 0 {
+			interval = DefaultWatchInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for _, path := range files {
+				if !m.readFile(ctx, path, skip, pacer, out) {
+					return
+				}
+				skip = 0
+			}
+			if !m.Watch {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Files that cannot be listed now may be readable at the next
+			// attempt.
+			files, _ = listCaptureFiles(m.Pattern, seen)
+		}
+	}()
+
+	return out, nil
+}
+
+// Sends the packets of the file at path to out, after the first skip. Returns
+// false if capture was cancelled. Files that cannot be opened are skipped.
+func (m *MultiFileReader) readFile(ctx context.Context, path string, skip uint64, pacer *replayPacer, out chan<- gopacket.Packet) bool {
+	m.mu.Lock()
+	r := NewFileReader(path, m.BPFilter)
+	r.Skip = skip
+	r.pacer = pacer
+	in, err := r.Capture(ctx)
+	if err != nil {
+		m.mu.Unlock()
+		return ctx.Err() == nil
+	}
+	m.current = r
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		atomic.AddUint64(&m.received, r.Stats().PacketsReceived)
+		m.current = nil
+	}()
+
+	first := true
+	for packet := range in {
+		if md := packet.Metadata(); first && md != nil {
+			md.AncillaryData = append(md.AncillaryData, fileBoundary{path: path, skipped: skip})
+			first = false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case out <- packet:
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// Files have no kernel or interface drops, so only packets read are counted.
+func (m *MultiFileReader) Stats() CaptureStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := CaptureStats{PacketsReceived: atomic.LoadUint64(&m.received)}
+	if m.current != nil {
+		st = st.add(m.current.Stats())
+	}
+	return st
+}
+
+// Replaces the filter, also for the rest of the file being read.
+func (m *MultiFileReader) SetBPFFilter(expr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != nil {
+		if err := m.current.SetBPFFilter(expr); err != nil {
+			return err
+		}
+	}
+	m.BPFilter = expr
+	return nil
+}
+
+// Returns the capture files matching pattern that are not in seen, in the
+// order of their first packet, and adds them to seen. Empty files are left
+// out of seen, in case they are still being written.
+func listCaptureFiles(pattern string, seen map[string]bool) ([]string, error) {
+	var paths []string
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if !e.IsDir() && captureFileExtensions[filepath.Ext(e.Name())] {
+				paths = append(paths, filepath.Join(pattern, e.Name()))
+			}
+		}
+	} else {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture file pattern %q: %w", pattern, err)
+		}
+		paths = matches
+	}
+
+	type file struct {
+		path  string
+		first time.Time
+	}
+	var files []file
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		first, err := firstTimestamp(path)
+		if err != nil {
+			continue
+		}
+		seen[path] = true
+		files = append(files, file{path, first})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].first.Equal(files[j].first) {
+			return files[i].first.Before(files[j].first)
+		}
+		return files[i].path < files[j].path
+	})
+
+	result := make([]string, 0, len(files))
+	for _, f := range files {
+		result = append(result, f.path)
+	}
+	return result, nil
+}
+
+// Returns the timestamp of the first packet of a pcap or pcapng file.
+func firstTimestamp(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+
+	r, err := newCaptureStream(f)
+	if err != nil {
+		return time.Time{}, err
+	}
+	_, ci, err := r.ReadPacketData()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no packets in %s", path)
+	}
+	return ci.Timestamp, nil
+}
+
+func indexOf(paths []string, path string) int {
+	for i, p := range paths {
+		if p == path {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,94 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Writes a file with one packet captured at ts, in pcapng format if ng is set.
+func writeCaptureFile(t *testing.T, path string, ts time.Time, ng bool) {
+	f, err := os.Create(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+
+	p := CreateTCPSYN(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000, 80, 1)
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(p.Data()), Length: len(p.Data())}
+	if ng {
+		w, err := pcapgo.NewNgWriter(f, layers.LinkTypeEthernet)
+		assert.NoError(t, err)
+		assert.NoError(t, w.WritePacket(ci, p.Data()))
+		assert.NoError(t, w.Flush())
+		return
+	}
+	w := pcapgo.NewWriter(f)
+	assert.NoError(t, w.WriteFileHeader(DefaultSnapLen, layers.LinkTypeEthernet))
+	assert.NoError(t, w.WritePacket(ci, p.Data()))
+}
+
+func TestListCaptureFiles(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Unix(1700000000, 0)
+	writeCaptureFile(t, filepath.Join(dir, "a.pcapng"), start.Add(time.Hour), true)
+	writeCaptureFile(t, filepath.Join(dir, "b.pcap"), start, false)
+	writeCaptureFile(t, filepath.Join(dir, "c.txt"), start, false)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "d.pcap"), nil, 0o644))
+
+	seen := map[string]bool{}
+	files, err := listCaptureFiles(dir, seen)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "b.pcap"), filepath.Join(dir, "a.pcapng")}, files)
+
+	// Files already read are not listed again.
+	writeCaptureFile(t, filepath.Join(dir, "e.pcap"), start, false)
+	files, err = listCaptureFiles(dir, seen)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "e.pcap")}, files)
+
+	files, err = listCaptureFiles(filepath.Join(dir, "*.txt"), map[string]bool{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "c.txt")}, files)
+}
+
+func TestParseFileBoundaries(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i, path := range []string{"a.pcap", "", "b.pcap"} {
+		p := CreateTCPSYN(client, server, 40000+i, 80, 1)
+		if path != "" {
+			p.Metadata().AncillaryData = []interface{}{fileBoundary{path: path}}
+		}
+		packets = append(packets, p)
+	}
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var boundaries []string
+	for c := range out {
+		if b, ok := c.Content.(gnet.CaptureFileBoundary); ok {
+			boundaries = append(boundaries, b.Path)
+		}
+	}
+	assert.Equal(t, []string{"a.pcap", "b.pcap"}, boundaries)
+}
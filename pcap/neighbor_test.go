@@ -0,0 +1,81 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestParseNeighborDiscovery(t *testing.T) {
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	serialize := func(ls ...gopacket.SerializableLayer) gopacket.Packet {
+		buf := gopacket.NewSerializeBuffer()
+		if !assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...)) {
+			t.FailNow()
+		}
+		return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	}
+
+	arp := serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeARP},
+		&layers.ARP{
+			AddrType:          layers.LinkTypeEthernet,
+			Protocol:          layers.EthernetTypeIPv4,
+			HwAddressSize:     6,
+			ProtAddressSize:   4,
+			Operation:         layers.ARPRequest,
+			SourceHwAddress:   mac,
+			SourceProtAddress: net.IPv4(10, 0, 0, 1).To4(),
+			DstHwAddress:      make([]byte, 6),
+			DstProtAddress:    net.IPv4(10, 0, 0, 2).To4(),
+		})
+
+	src, target := net.ParseIP("fe80::1"), net.ParseIP("fe80::2")
+	na := serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: layers.EthernetBroadcast, EthernetType: layers.EthernetTypeIPv6},
+		&layers.IPv6{Version: 6, HopLimit: 255, NextHeader: layers.IPProtocolICMPv6, SrcIP: src, DstIP: target},
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0)},
+		&layers.ICMPv6NeighborAdvertisement{
+			Flags:         0x60, // solicited, override
+			TargetAddress: src,
+			Options:       layers.ICMPv6Options{{Type: layers.ICMPv6OptTargetAddress, Data: mac}},
+		})
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: []gopacket.Packet{arp, na}},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var contents []gnet.ParsedNetworkContent
+	for c := range out {
+		contents = append(contents, c.Content)
+	}
+	assert.Equal(t, []gnet.ParsedNetworkContent{
+		gnet.ARP{
+			Operation: layers.ARPRequest,
+			SenderMAC: mac,
+			SenderIP:  net.IPv4(10, 0, 0, 1).To4(),
+			TargetMAC: make(net.HardwareAddr, 6),
+			TargetIP:  net.IPv4(10, 0, 0, 2).To4(),
+		},
+		gnet.NDP{
+			Type:      layers.ICMPv6TypeNeighborAdvertisement,
+			TargetIP:  src,
+			TargetMAC: mac,
+			Solicited: true,
+			Override:  true,
+		},
+	}, contents)
+}
@@ -1,11 +1,46 @@
 package pcap
 
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/filter"
+	"github.com/mel2oo/go-pcap/gnet/tlsdecrypt"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
 const (
 	DefaultStreamFlushTimeout int64 = 10
 	DefaultStreamCloseTimeout int64 = 90
 
 	DefaultMaxBufferedPagesTotal         int = 100000
 	DefaultMaxBufferedPagesPerConnection int = 4000
+
+	// Buffer pool used for message bodies when parsers are selected by name
+	// and no pool was supplied with WithBufferPool.
+	DefaultBufferPoolSize  int64 = 16 * 1024 * 1024
+	DefaultBufferChunkSize int64 = 4 * 1024
+
+	DefaultOutputBufferSize int = 100
+)
+
+// What the parser does with traffic when its output channel is full.
+type OverflowPolicy int
+
+const (
+	// Wait for the consumer. A slow consumer stalls reassembly and, once the
+	// capture backend's buffers fill up, causes packets to be dropped.
+	OverflowBlock OverflowPolicy = iota
+
+	// Discard the traffic, counted in Stats.TrafficDropped.
+	OverflowDrop
+
+	// Discard the traffic as with OverflowDrop, and once the consumer catches
+	// up, deliver a gnet.DroppedBytes for each flow that lost traffic, with
+	// the number of bytes of payload and bodies discarded.
+	OverflowSummarize
 )
 
 type Options struct {
@@ -16,6 +51,49 @@ type Options struct {
 	// bpf filter
 	BPFilter string
 
+	// Settings of live capture through libpcap: the maximum number of bytes
+	// captured per packet, whether to put devices in promiscuous mode, and how
+	// long libpcap may buffer packets before delivering them.
+	SnapLen        int32
+	Promiscuous    bool
+	CaptureTimeout time.Duration
+
+	// Stream to read a capture from, instead of ReadName. See StreamReader.
+	ReadStream io.Reader
+
+	// Capture files to read as one stream, instead of ReadName: a glob pattern
+	// or a directory. See MultiFileReader.
+	ReadFiles string
+	// Keep reading new files matching ReadFiles as they appear, checking
+	// every WatchInterval.
+	WatchFiles    bool
+	WatchInterval time.Duration
+
+	// Live devices to capture from at once, instead of ReadName. Traffic is
+	// labeled with the name of the device it was captured on.
+	Interfaces []string
+	// Capture from every device that can be opened.
+	AllInterfaces bool
+	// Capture live from ReadName through an AF_PACKET ring instead of libpcap.
+	// Linux only. See AFPacketReader.
+	AFPacket bool
+	// Block size and number of blocks of the AF_PACKET ring. 0 for the
+	// defaults. Its block timeout is CaptureTimeout, if positive.
+	AFPacketBlockSize int
+	AFPacketNumBlocks int
+
+	// Reassemble TCP separately for each device, so that a connection seen on
+	// two devices yields two streams. By default, packets from all devices
+	// share one assembler.
+	PerInterfaceAssembly bool
+
+	// Reassemble TCP on this many goroutines, each with its own assemblers.
+	// Connections are assigned to workers by a hash of their addresses and
+	// ports, so the traffic of each connection stays in order, but traffic
+	// from different connections may be delivered out of capture order. 0 or
+	// 1 to reassemble on the capture goroutine.
+	AssemblyWorkers int
+
 	// The maximum time we will wait before flushing a connection and delivering
 	// the data even if there is a gap in the collected sequence.
 	// Default 10 seconds.
@@ -42,14 +120,136 @@ type Options struct {
 	// TODO: Would be interesting to know the TCP window sizes we see in practice
 	// and adjust that way.
 	MaxBufferedPagesPerConnection int
+
+	// The most TCP connections and UDP flows tracked at once. Beyond them, the
+	// least recently active is evicted for each new one. 0 for no limit on
+	// TCP connections, and DefaultMaxUDPFlows for UDP flows.
+	MaxTCPConnections int
+	MaxUDPFlows       int
+
+	// Names of registered parser factories to use when Parse is called without
+	// explicit factories. See gnet.RegisterTCPParserFactory.
+	Parsers []string
+
+	// Registry that parser names are resolved against, instead of
+	// gnet.DefaultTCPParserRegistry, which holds all the built-in parsers. If
+	// no names are given, the registry's enabled parsers are used.
+	ParserRegistry *gnet.TCPParserRegistry
+
+	// File listing parser names, one per line. Appended to Parsers.
+	ParserConfigFile string
+
+	// Registered parsers to try first for TCP connections by port, whether
+	// or not they are in Parsers. See WithPortHint.
+	PortHints map[int]PortHint
+
+	// If positive, UDP datagrams are grouped into flows that end after this
+	// long without datagrams, and flows accepted by one of UDPParsers are
+	// parsed statefully. See WithUDPFlows.
+	UDPFlowTimeout time.Duration
+	UDPParsers     []gnet.UDPParserFactory
+
+	// Decides whether a TCP flow is pinned to the factory of its last parser.
+	// Nil to select from all factories for each message.
+	ReselectionPolicy gnet.ReselectionPolicy
+
+	// Pool for message bodies of parsers selected by name.
+	BufferPool mempool.BufferPool
+
+	// If set, TLS connections whose secrets are in the key log are decrypted,
+	// and the plaintext is parsed with the same parsers as cleartext traffic.
+	TLSKeyLog *tlsdecrypt.KeyLog
+
+	// Key log file, in the format written by SSLKEYLOGFILE. Its secrets are
+	// added to TLSKeyLog.
+	TLSKeyLogFile string
+
+	// If set, captured packets are also written to rotating pcap files named
+	// after this path. See writer.RotatingWriter.
+	CaptureFile string
+
+	// Size and age at which capture files are rotated. 0 for no limit.
+	CaptureFileSize     int64
+	CaptureFileInterval time.Duration
+
+	// Compress rotated capture files with gzip.
+	CaptureFileCompress bool
+
+	// If set, only traffic tagged with one of these VLAN IDs, at any level of
+	// QinQ stacking, is parsed.
+	VLANs []uint16
+
+	// Report gnet.TCPQualityMetrics for each TCP connection when it completes,
+	// and every TCPQualityInterval of packet time while it is active if
+	// positive.
+	TCPQualityMetrics  bool
+	TCPQualityInterval time.Duration
+
+	// If positive, a parser still without a result after this much packet
+	// time is abandoned, and the data it consumed reported as dropped.
+	ParserTimeout time.Duration
+
+	// Fractions of flows, by a hash of their addresses and ports, and of
+	// packets to parse. Rates outside of (0, 1) parse everything.
+	FlowSampleRate   float64
+	PacketSampleRate float64
+
+	// If positive, packets read from a file are delivered at the pace they
+	// were captured at, sped up by this factor.
+	ReplaySpeed float64
+
+	// Capture stops once this many packets, or bytes of packet data, have been
+	// processed. 0 for no limit.
+	MaxPackets uint64
+	MaxBytes   uint64
+
+	// If set, Checkpoint is called every CheckpointInterval while reading
+	// files, and once more when capture ends.
+	CheckpointInterval time.Duration
+	Checkpoint         func(Checkpoint)
+	// Where reading files starts instead of their beginning, if set.
+	Resume *Checkpoint
+
+	// Receives diagnostics from capture and parsing. Also passed to parsers
+	// that support logging. Discards everything by default.
+	Logger gnet.Logger
+
+	// If set, called with each panic recovered while handling a packet, in
+	// addition to logging it. Called from the goroutine that handled the
+	// packet, so it should return quickly.
+	PanicHandler func(ParserPanic)
+
+	// Capacity of the channel returned by Parse, and what to do with traffic
+	// while it is full.
+	OutputBufferSize int
+	OverflowPolicy   OverflowPolicy
+
+	// If set, only traffic it keeps is returned by Parse. FilterExpr, if set,
+	// is compiled with filter.Compile and combined with Filter by
+	// NewTrafficParser.
+	Filter     filter.Filter
+	FilterExpr string
+
+	// If set, annotates traffic returned by Parse with information about its
+	// endpoints.
+	Enricher gnet.Enricher
+
+	// Addresses of the capturing host, used to set the LocalRole of traffic.
+	// Live captures default to the addresses of all interfaces of the host.
+	LocalAddrs []net.IP
 }
 
 func NewOptions() Options {
 	return Options{
+		SnapLen:                       DefaultSnapLen,
+		Promiscuous:                   true,
+		CaptureTimeout:                DefaultCaptureTimeout,
 		StreamFlushTimeout:            DefaultStreamFlushTimeout,
 		StreamCloseTimeout:            DefaultStreamCloseTimeout,
 		MaxBufferedPagesTotal:         DefaultMaxBufferedPagesTotal,
 		MaxBufferedPagesPerConnection: DefaultMaxBufferedPagesPerConnection,
+		Logger:                        gnet.NopLogger,
+		OutputBufferSize:              DefaultOutputBufferSize,
 	}
 }
 
@@ -62,12 +262,204 @@ func WithReadName(name string, live bool) Option {
 	}
 }
 
+// Reads a capture in pcap or pcapng format from r, such as an HTTP response
+// body, without touching the disk. WithReadName("-", false) reads from
+// standard input.
+func WithReadStream(r io.Reader) Option {
+	return func(o *Options) {
+		o.ReadStream = r
+	}
+}
+
+// Reads the capture files matching pattern, a glob or a directory, in the
+// order they were captured, as one stream. The start of each file is reported
+// as gnet.CaptureFileBoundary traffic.
+func WithReadFiles(pattern string) Option {
+	return func(o *Options) {
+		o.ReadFiles = pattern
+	}
+}
+
+// Keeps reading files matching the pattern given to WithReadFiles as they
+// appear, checking every interval, until capture is cancelled.
+func WithWatchFiles(interval time.Duration) Option {
+	return func(o *Options) {
+		o.WatchFiles = true
+		o.WatchInterval = interval
+	}
+}
+
+// Captures live from all the given devices at once.
+func WithInterfaces(names ...string) Option {
+	return func(o *Options) {
+		o.Live = true
+		o.Interfaces = append(o.Interfaces, names...)
+	}
+}
+
+// Captures live from every device that can be opened. Unlike the libpcap
+// "any" device, traffic is labeled with the device it was captured on.
+func WithAllInterfaces() Option {
+	return func(o *Options) {
+		o.Live = true
+		o.AllInterfaces = true
+	}
+}
+
+// Captures live through an AF_PACKET ring instead of libpcap. Linux only.
+func WithAFPacket() Option {
+	return func(o *Options) {
+		o.AFPacket = true
+	}
+}
+
+// Sets the geometry of the AF_PACKET ring: numBlocks blocks of blockSize
+// bytes each. blockSize must be a multiple of the page size.
+func WithAFPacketRing(blockSize, numBlocks int) Option {
+	return func(o *Options) {
+		o.AFPacketBlockSize = blockSize
+		o.AFPacketNumBlocks = numBlocks
+	}
+}
+
+// Reassembles TCP separately for each device captured from.
+func WithPerInterfaceAssembly() Option {
+	return func(o *Options) {
+		o.PerInterfaceAssembly = true
+	}
+}
+
+// Reassembles TCP on n workers. See Options.AssemblyWorkers.
+func WithAssemblyWorkers(n int) Option {
+	return func(o *Options) {
+		o.AssemblyWorkers = n
+	}
+}
+
 func WithBPF(filter string) Option {
 	return func(o *Options) {
 		o.BPFilter = filter
 	}
 }
 
+// Only parses traffic tagged with one of the given 802.1Q VLAN IDs, at any
+// level of QinQ stacking. Untagged traffic is ignored.
+func WithVLANs(ids ...uint16) Option {
+	return func(o *Options) {
+		o.VLANs = append(o.VLANs, ids...)
+	}
+}
+
+// Replays a capture file with its original timing, sped up by speedFactor:
+// 1 for real time, 10 for ten times faster. This simulates live capture for
+// consumers that depend on timing. Ignored for live capture.
+func WithReplayTiming(speedFactor float64) Option {
+	return func(o *Options) {
+		o.ReplaySpeed = speedFactor
+	}
+}
+
+// Reports gnet.TCPQualityMetrics for each TCP connection: handshake RTT,
+// retransmissions, duplicate ACKs and zero windows. Metrics are reported when
+// the connection completes, and also every interval of packet time while it is
+// active if interval is positive.
+func WithTCPQualityMetrics(interval time.Duration) Option {
+	return func(o *Options) {
+		o.TCPQualityMetrics = true
+		o.TCPQualityInterval = interval
+	}
+}
+
+// Abandons parsers that have not produced a result within d of packet time
+// since the data they started parsing, reporting the data they consumed as
+// gnet.DroppedBytes. This bounds how long a malformed or adversarial stream
+// can hold on to a parser and the data it buffers. Flows that stop receiving
+// data are checked each time streams are flushed.
+func WithParserTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.ParserTimeout = d
+	}
+}
+
+// Parses only a fraction rate of flows, chosen by a hash of their addresses
+// and ports, so that very busy links can be monitored within a budget. The
+// choice is the same for both directions of a flow and from one capture to the
+// next. Parsed traffic has its SampleRate set.
+func WithFlowSampling(rate float64) Option {
+	return func(o *Options) {
+		o.FlowSampleRate = rate
+	}
+}
+
+// Parses only a fraction rate of packets, evenly spaced, e.g. every tenth for
+// 0.1. TCP streams are left with gaps, so this mostly suits content parsed
+// from single packets, such as gnet.TCPPacketMetadata and DNS; use
+// WithFlowSampling to parse application protocols. Combines with flow
+// sampling. Parsed traffic has its SampleRate set.
+func WithPacketSampling(rate float64) Option {
+	return func(o *Options) {
+		o.PacketSampleRate = rate
+	}
+}
+
+// Stops capture after n packets, flushing the connections in progress and
+// closing the output channel.
+func WithMaxPackets(n uint64) Option {
+	return func(o *Options) {
+		o.MaxPackets = n
+	}
+}
+
+// Calls fn with the progress of the parser through the files it reads every
+// interval, so that a later run can resume from the last one with WithResume.
+// See WriteCheckpoint.
+func WithCheckpoints(interval time.Duration, fn func(Checkpoint)) Option {
+	return func(o *Options) {
+		o.CheckpointInterval = interval
+		o.Checkpoint = fn
+	}
+}
+
+// Starts reading the file, or files, at cp, as taken by a previous run with
+// WithCheckpoints. Only offline files can be resumed.
+func WithResume(cp Checkpoint) Option {
+	return func(o *Options) {
+		o.Resume = &cp
+	}
+}
+
+// Stops capture once n bytes of packet data have been processed, flushing the
+// connections in progress and closing the output channel.
+func WithMaxBytes(n uint64) Option {
+	return func(o *Options) {
+		o.MaxBytes = n
+	}
+}
+
+// Captures at most n bytes of each packet. Defaults to DefaultSnapLen.
+func WithSnapLen(n int32) Option {
+	return func(o *Options) {
+		o.SnapLen = n
+	}
+}
+
+// Sets whether devices are put in promiscuous mode. Defaults to true.
+func WithPromiscuous(promiscuous bool) Option {
+	return func(o *Options) {
+		o.Promiscuous = promiscuous
+	}
+}
+
+// Lets libpcap buffer packets for up to t before delivering them, trading
+// latency for fewer wakeups. t is capped at 100ms, so that cancelling capture
+// takes effect promptly even on idle devices. With WithAFPacket, t is instead
+// the block timeout of the ring, and is not capped.
+func WithCaptureTimeout(t time.Duration) Option {
+	return func(o *Options) {
+		o.CaptureTimeout = t
+	}
+}
+
 func WithStreamFlushTimeout(t int64) Option {
 	return func(o *Options) {
 		o.StreamFlushTimeout = t
@@ -91,3 +483,208 @@ func WithPerPagesBlock(n int) Option {
 		o.MaxBufferedPagesPerConnection = n * DefaultMaxBufferedPagesPerConnection
 	}
 }
+
+// Selects parsers by their registered names (e.g. "http1", "tls"). Only used
+// when Parse is called without explicit factories.
+func WithParsers(names ...string) Option {
+	return func(o *Options) {
+		o.Parsers = append(o.Parsers, names...)
+	}
+}
+
+// Resolves parser names against r, and uses the parsers enabled in r, in order
+// of priority, when no names are given and Parse is called without explicit
+// factories.
+func WithParserRegistry(r *gnet.TCPParserRegistry) Option {
+	return func(o *Options) {
+		o.ParserRegistry = r
+	}
+}
+
+// Reads the names of the parsers to use from a file, one per line.
+func WithParserConfigFile(path string) Option {
+	return func(o *Options) {
+		o.ParserConfigFile = path
+	}
+}
+
+// Parsers to try first for TCP connections on a port, by registered name.
+type PortHint struct {
+	Parsers []string
+
+	// Whether to only try Parsers on the port.
+	Exclusive bool
+}
+
+// Tries the named parsers (e.g. "tls" for 443) first for TCP connections with
+// port as either endpoint. If exclusive, no other parser is tried, which saves
+// work on busy well-known ports at the cost of missing other protocols there.
+// Connections with hints for both ports try those of the destination of their
+// first packet first.
+func WithPortHint(port int, exclusive bool, parsers ...string) Option {
+	return func(o *Options) {
+		if o.PortHints == nil {
+			o.PortHints = map[int]PortHint{}
+		}
+		o.PortHints[port] = PortHint{Parsers: parsers, Exclusive: exclusive}
+	}
+}
+
+// Bounds the TCP connections and UDP flows tracked at once, so that a flood of
+// new connections, such as a SYN flood, cannot exhaust memory during long live
+// captures. Once a limit is reached, the connection or flow with the oldest
+// latest packet is evicted for each new one, and reported as a
+// gnet.ConnectionEvicted. With several assembly workers, each tracks an equal
+// share of the TCP connections. A limit that is not positive is left as is.
+func WithConnectionLimits(tcp, udp int) Option {
+	return func(o *Options) {
+		if tcp > 0 {
+			o.MaxTCPConnections = tcp
+		}
+		if udp > 0 {
+			o.MaxUDPFlows = udp
+		}
+	}
+}
+
+// Groups UDP datagrams into flows by their addresses and ports, giving the
+// datagrams of each flow the same ConnectionID. A flow ends once it has had no
+// datagrams for idleTimeout of packet time, DefaultUDPFlowTimeout if not
+// positive. Flows whose first datagram is accepted by one of factories are
+// parsed by its parser, whose results become the Content of the datagrams
+// that complete them.
+func WithUDPFlows(idleTimeout time.Duration, factories ...gnet.UDPParserFactory) Option {
+	return func(o *Options) {
+		if idleTimeout <= 0 {
+			idleTimeout = DefaultUDPFlowTimeout
+		}
+		o.UDPFlowTimeout = idleTimeout
+		o.UDPParsers = append(o.UDPParsers, factories...)
+	}
+}
+
+// Sets how the parser for the data following each parser's result or failure
+// on a TCP flow is chosen, e.g. gnet.PinUntilUpgrade. Data after a protocol
+// upgrade recognized by the factories, such as to WebSocket, is still parsed
+// by the factory of the new protocol.
+func WithReselectionPolicy(policy gnet.ReselectionPolicy) Option {
+	return func(o *Options) {
+		o.ReselectionPolicy = policy
+	}
+}
+
+func WithBufferPool(pool mempool.BufferPool) Option {
+	return func(o *Options) {
+		o.BufferPool = pool
+	}
+}
+
+// Decrypts TLS connections with the secrets in keyLog, which may be added to
+// while parsing.
+func WithTLSKeyLog(keyLog *tlsdecrypt.KeyLog) Option {
+	return func(o *Options) {
+		o.TLSKeyLog = keyLog
+	}
+}
+
+// Decrypts TLS connections with the secrets in a key log file, such as one
+// written by a browser with SSLKEYLOGFILE set.
+func WithTLSKeyLogFile(path string) Option {
+	return func(o *Options) {
+		o.TLSKeyLogFile = path
+	}
+}
+
+// Writes captured packets to pcap files named after path, in addition to
+// parsing them.
+func WithCaptureFile(path string) Option {
+	return func(o *Options) {
+		o.CaptureFile = path
+	}
+}
+
+// Starts a new capture file once the current one holds size bytes or spans
+// interval, like tcpdump -C and -G. A zero value disables that limit.
+func WithCaptureFileRotation(size int64, interval time.Duration) Option {
+	return func(o *Options) {
+		o.CaptureFileSize = size
+		o.CaptureFileInterval = interval
+	}
+}
+
+// Compresses rotated capture files with gzip.
+func WithCaptureFileCompression() Option {
+	return func(o *Options) {
+		o.CaptureFileCompress = true
+	}
+}
+
+// Calls f with each panic recovered while handling a packet, such as a parser
+// crashing on malformed input. The connection is still processed: a parser
+// that panics is treated as having failed.
+func WithPanicHandler(f func(ParserPanic)) Option {
+	return func(o *Options) {
+		o.PanicHandler = f
+	}
+}
+
+// Routes diagnostics from capture and parsing to l, such as a zap
+// SugaredLogger or a logrus Logger. Parsers passed to Parse or selected by name
+// that support logging log to l as well.
+func WithLogger(l gnet.Logger) Option {
+	return func(o *Options) {
+		if l == nil {
+			l = gnet.NopLogger
+		}
+		o.Logger = l
+	}
+}
+
+// Sets the capacity of the channel returned by Parse.
+func WithOutputBufferSize(n int) Option {
+	return func(o *Options) {
+		o.OutputBufferSize = n
+	}
+}
+
+// Sets what the parser does with traffic while the consumer falls behind.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(o *Options) {
+		o.OverflowPolicy = policy
+	}
+}
+
+// Returns only the traffic f keeps from Parse. Unlike a BPF filter, f sees
+// parsed traffic, so it can select by protocol or HTTP status, but the packets
+// it rejects are still parsed. Discarded traffic is counted in
+// Stats.TrafficFiltered, and is not subject to the overflow policy.
+func WithFilter(f filter.Filter) Option {
+	return func(o *Options) {
+		o.Filter = f
+	}
+}
+
+// Like WithFilter, with a filter expression such as "proto http and status >=
+// 500". See filter.Compile. NewTrafficParser fails if expr is invalid.
+func WithFilterExpr(expr string) Option {
+	return func(o *Options) {
+		o.FilterExpr = expr
+	}
+}
+
+// Sets the Enrichment of traffic from the information e has about its source
+// and destination addresses. Lookups happen after the overflow policy is
+// applied, so a slow enricher counts as a slow consumer.
+func WithEnricher(e gnet.Enricher) Option {
+	return func(o *Options) {
+		o.Enricher = e
+	}
+}
+
+// Sets the addresses of the capturing host. Traffic to or from one of them is
+// tagged with the role the host played in it.
+func WithLocalAddrs(ips ...net.IP) Option {
+	return func(o *Options) {
+		o.LocalAddrs = ips
+	}
+}
@@ -0,0 +1,127 @@
+package osfp
+
+// Passive OS fingerprinting from TCP SYN and SYN+ACK packets, in the style of
+// p0f (https://lcamtuf.coredump.cx/p0f3/).
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Fingerprint computes the OS fingerprint of the host that sent tcp, given the
+// TTL (or IPv6 hop limit) observed on the packet carrying it.
+func Fingerprint(ipVersion int, ttl uint8, tcp *layers.TCP) gnet.OSFingerprint {
+	fp := gnet.OSFingerprint{
+		TTL:         ttl,
+		InitialTTL:  initialTTL(ttl),
+		WindowSize:  tcp.Window,
+		WindowScale: -1,
+	}
+
+	layout := make([]string, 0, len(tcp.Options))
+	for _, opt := range tcp.Options {
+		switch opt.OptionType {
+		case layers.TCPOptionKindEndList:
+			layout = append(layout, "eol")
+		case layers.TCPOptionKindNop:
+			layout = append(layout, "nop")
+		case layers.TCPOptionKindMSS:
+			layout = append(layout, "mss")
+			if len(opt.OptionData) == 2 {
+				fp.MSS = uint16(opt.OptionData[0])<<8 | uint16(opt.OptionData[1])
+			}
+		case layers.TCPOptionKindWindowScale:
+			layout = append(layout, "ws")
+			if len(opt.OptionData) == 1 {
+				fp.WindowScale = int(opt.OptionData[0])
+			}
+		case layers.TCPOptionKindSACKPermitted:
+			layout = append(layout, "sok")
+		case layers.TCPOptionKindSACK:
+			layout = append(layout, "sack")
+		case layers.TCPOptionKindTimestamps:
+			layout = append(layout, "ts")
+		default:
+			layout = append(layout, "?"+strconv.Itoa(int(opt.OptionType)))
+		}
+	}
+	fp.Options = strings.Join(layout, ",")
+
+	scale := "*"
+	if fp.WindowScale >= 0 {
+		scale = strconv.Itoa(fp.WindowScale)
+	}
+	fp.Signature = strings.Join([]string{
+		strconv.Itoa(ipVersion),
+		strconv.Itoa(int(fp.InitialTTL)),
+		strconv.Itoa(int(fp.MSS)),
+		strconv.Itoa(int(fp.WindowSize)) + "," + scale,
+		fp.Options,
+	}, ":")
+
+	fp.OS = guess(fp, tcp.ACK)
+	return fp
+}
+
+// Rounds the observed TTL up to the nearest common initial TTL. Packets lose
+// one unit of TTL per hop, and hosts rarely sit more than a few dozen hops
+// apart.
+func initialTTL(ttl uint8) uint8 {
+	for _, initial := range []uint8{32, 64, 128} {
+		if ttl <= initial {
+			return initial
+		}
+	}
+	return 255
+}
+
+type signature struct {
+	os         string
+	initialTTL uint8
+	layout     string
+
+	// Whether the signature describes a SYN+ACK rather than a SYN.
+	synAck bool
+}
+
+// Sorted with more specific signatures first.
+var signatures = []signature{
+	{os: "Linux", initialTTL: 64, layout: "mss,sok,ts,nop,ws"},
+	{os: "Linux", initialTTL: 64, layout: "mss,nop,nop,sok,nop,ws"},
+	{os: "Linux", initialTTL: 64, layout: "mss,sok,ts,nop,ws", synAck: true},
+	{os: "Linux", initialTTL: 64, layout: "mss,nop,nop,sok,nop,ws", synAck: true},
+	{os: "Windows", initialTTL: 128, layout: "mss,nop,ws,nop,nop,sok"},
+	{os: "Windows", initialTTL: 128, layout: "mss,nop,ws,nop,nop,ts,nop,nop,sok"},
+	{os: "Windows", initialTTL: 128, layout: "mss,nop,ws,sok,ts", synAck: true},
+	{os: "Windows", initialTTL: 128, layout: "mss,nop,ws,nop,nop,sok", synAck: true},
+	{os: "Mac OS X / iOS", initialTTL: 64, layout: "mss,nop,ws,nop,nop,ts,sok,eol"},
+	{os: "Mac OS X / iOS", initialTTL: 64, layout: "mss,nop,ws,nop,nop,ts,sok,eol", synAck: true},
+	{os: "FreeBSD", initialTTL: 64, layout: "mss,nop,ws,sok,ts"},
+	{os: "FreeBSD", initialTTL: 64, layout: "mss,nop,ws,sok,ts", synAck: true},
+	{os: "OpenBSD", initialTTL: 64, layout: "mss,nop,nop,sok,nop,ws,nop,nop,ts"},
+	{os: "Solaris", initialTTL: 255, layout: "nop,nop,ts,mss,nop,ws,nop,nop,sok"},
+}
+
+func guess(fp gnet.OSFingerprint, synAck bool) string {
+	for _, s := range signatures {
+		if s.synAck == synAck && s.initialTTL == fp.InitialTTL && s.layout == fp.Options {
+			return s.os
+		}
+	}
+
+	// Fall back to the initial TTL, which on its own only separates broad
+	// families.
+	switch fp.InitialTTL {
+	case 64:
+		return "Unix-like"
+	case 128:
+		return "Windows"
+	case 255:
+		return "Network device"
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+package osfp
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+func option(kind layers.TCPOptionKind, data ...byte) layers.TCPOption {
+	return layers.TCPOption{OptionType: kind, OptionData: data}
+}
+
+var (
+	mss   = option(layers.TCPOptionKindMSS, 0x05, 0xb4)
+	nop   = option(layers.TCPOptionKindNop)
+	ws    = option(layers.TCPOptionKindWindowScale, 7)
+	sok   = option(layers.TCPOptionKindSACKPermitted)
+	ts    = option(layers.TCPOptionKindTimestamps, make([]byte, 8)...)
+	eol   = option(layers.TCPOptionKindEndList)
+	other = option(layers.TCPOptionKind(30))
+)
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       uint8
+		synAck    bool
+		options   []layers.TCPOption
+		os        string
+		signature string
+	}{
+		{
+			name:      "linux syn",
+			ttl:       52,
+			options:   []layers.TCPOption{mss, sok, ts, nop, ws},
+			os:        "Linux",
+			signature: "4:64:1460:64240,7:mss,sok,ts,nop,ws",
+		},
+		{
+			name:    "linux syn+ack",
+			ttl:     64,
+			synAck:  true,
+			options: []layers.TCPOption{mss, nop, nop, sok, nop, ws},
+			os:      "Linux",
+		},
+		{
+			name:      "windows syn",
+			ttl:       120,
+			options:   []layers.TCPOption{mss, nop, ws, nop, nop, sok},
+			os:        "Windows",
+			signature: "4:128:1460:64240,7:mss,nop,ws,nop,nop,sok",
+		},
+		{
+			name:    "windows syn+ack",
+			ttl:     113,
+			synAck:  true,
+			options: []layers.TCPOption{mss, nop, ws, sok, ts},
+			os:      "Windows",
+		},
+		{
+			name:    "mac syn",
+			ttl:     60,
+			options: []layers.TCPOption{mss, nop, ws, nop, nop, ts, sok, eol},
+			os:      "Mac OS X / iOS",
+		},
+		{
+			// A SYN signature does not match a SYN+ACK.
+			name:    "openbsd syn layout on syn+ack falls back",
+			ttl:     64,
+			synAck:  true,
+			options: []layers.TCPOption{mss, nop, nop, sok, nop, ws, nop, nop, ts},
+			os:      "Unix-like",
+		},
+		{
+			name:      "unknown options fall back to ttl",
+			ttl:       100,
+			options:   []layers.TCPOption{mss, other},
+			os:        "Windows",
+			signature: "4:128:1460:64240,*:mss,?30",
+		},
+		{
+			name:    "network device",
+			ttl:     250,
+			options: []layers.TCPOption{mss},
+			os:      "Network device",
+		},
+		{
+			name: "no guess",
+			ttl:  30,
+			os:   "",
+		},
+	}
+
+	for _, tc := range tests {
+		fp := Fingerprint(4, tc.ttl, &layers.TCP{
+			SYN:     true,
+			ACK:     tc.synAck,
+			Window:  64240,
+			Options: tc.options,
+		})
+		assert.Equal(t, tc.os, fp.OS, tc.name)
+		assert.Equal(t, tc.ttl, fp.TTL, tc.name)
+		if tc.signature != "" {
+			assert.Equal(t, tc.signature, fp.Signature, tc.name)
+		}
+	}
+}
+
+func TestInitialTTL(t *testing.T) {
+	for ttl, initial := range map[uint8]uint8{
+		1:   32,
+		32:  32,
+		33:  64,
+		52:  64,
+		64:  64,
+		120: 128,
+		128: 128,
+		129: 255,
+		255: 255,
+	} {
+		assert.Equal(t, initial, initialTTL(ttl), "ttl %d", ttl)
+	}
+}
+
+func TestFingerprintOptions(t *testing.T) {
+	fp := Fingerprint(6, 64, &layers.TCP{SYN: true, Options: []layers.TCPOption{mss, ws}})
+	assert.Equal(t, uint16(1460), fp.MSS)
+	assert.Equal(t, 7, fp.WindowScale)
+	assert.Equal(t, "mss,ws", fp.Options)
+
+	fp = Fingerprint(4, 64, &layers.TCP{SYN: true})
+	assert.Equal(t, -1, fp.WindowScale)
+	assert.Equal(t, "4:64:0:0,*:", fp.Signature)
+}
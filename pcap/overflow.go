@@ -0,0 +1,105 @@
+package pcap
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// The most flows with DroppedBytes summaries waiting to be delivered. Traffic
+// dropped from further flows is only counted.
+const maxOverflowSummaries = 1024
+
+// Identifies the flow a summary of dropped traffic is for.
+type overflowKey struct {
+	connectionID     uuid.UUID
+	srcIP, dstIP     string
+	srcPort, dstPort int
+	iface            string
+}
+
+// Passes traffic from in to out, applying the overflow policy whenever out is
+// full. Closes out once in is closed.
+func (p *TrafficParser) forward(in <-chan gnet.NetTraffic, out chan<- gnet.NetTraffic) {
+	defer close(out)
+
+	// Summaries in the order their flows first lost traffic.
+	var keys []overflowKey
+	summaries := map[overflowKey]*gnet.NetTraffic{}
+
+	for t := range in {
+		// Summaries go first, so that they precede the later traffic of their
+		// flows.
+		for len(keys) > 0 {
+			select {
+			case out <- *summaries[keys[0]]:
+				delete(summaries, keys[0])
+				keys = keys[1:]
+				continue
+			default:
+			}
+			break
+		}
+
+		select {
+		case out <- t:
+			continue
+		default:
+		}
+
+		atomic.AddUint64(&p.counters.trafficDropped, 1)
+		if p.opts.OverflowPolicy == OverflowSummarize {
+			k := overflowKey{t.ConnectionID, string(t.SrcIP.To16()), string(t.DstIP.To16()), t.SrcPort, t.DstPort, t.Interface}
+			if s, ok := summaries[k]; ok {
+				s.Content = s.Content.(gnet.DroppedBytes) + droppedSize(t)
+				s.FinalPacketTime = finalPacketTime(t)
+			} else if len(keys) < maxOverflowSummaries {
+				keys = append(keys, k)
+				summaries[k] = &gnet.NetTraffic{
+					LayerType:       t.LayerType,
+					SrcIP:           t.SrcIP,
+					SrcPort:         t.SrcPort,
+					DstIP:           t.DstIP,
+					DstPort:         t.DstPort,
+					ConnectionID:    t.ConnectionID,
+					Interface:       t.Interface,
+					Tunnels:         t.Tunnels,
+					VLANs:           t.VLANs,
+					ObservationTime: t.ObservationTime,
+					FinalPacketTime: finalPacketTime(t),
+					Content:         droppedSize(t),
+				}
+			}
+		}
+		if t.Content != nil {
+			t.Content.ReleaseBuffers()
+		}
+	}
+
+	for _, k := range keys {
+		out <- *summaries[k]
+	}
+}
+
+// The bytes of payload or message body lost by dropping t.
+func droppedSize(t gnet.NetTraffic) gnet.DroppedBytes {
+	switch c := t.Content.(type) {
+	case gnet.DroppedBytes:
+		return c
+	case gnet.HTTPRequest:
+		return gnet.DroppedBytes(c.Body.Len())
+	case gnet.HTTPResponse:
+		return gnet.DroppedBytes(c.Body.Len())
+	}
+	return gnet.DroppedBytes(len(t.Payload))
+}
+
+func finalPacketTime(t gnet.NetTraffic) time.Time {
+	if t.FinalPacketTime.IsZero() {
+		return t.ObservationTime
+	}
+	return t.FinalPacketTime
+}
@@ -0,0 +1,79 @@
+package pcap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Forwards traffic to an output channel that holds one item and is only read
+// once all but the first traffic has been dropped.
+func forwardAll(policy OverflowPolicy, traffic []gnet.NetTraffic) ([]gnet.NetTraffic, Stats) {
+	opts := NewOptions()
+	opts.OverflowPolicy = policy
+	p := &TrafficParser{opts: opts, counters: &parserCounters{}}
+
+	in := make(chan gnet.NetTraffic, len(traffic))
+	for _, t := range traffic {
+		in <- t
+	}
+	close(in)
+	out := make(chan gnet.NetTraffic, 1)
+	done := make(chan struct{})
+	go func() {
+		p.forward(in, out)
+		close(done)
+	}()
+
+	for p.counters.stats().TrafficDropped < uint64(len(traffic)-1) {
+		time.Sleep(time.Millisecond)
+	}
+	var got []gnet.NetTraffic
+	for t := range out {
+		got = append(got, t)
+	}
+	<-done
+	return got, p.counters.stats()
+}
+
+func TestOverflow(t *testing.T) {
+	conn := uuid.New()
+	start := time.Unix(1700000000, 0)
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	traffic := []gnet.NetTraffic{
+		{LayerType: "UDP", SrcIP: client, DstIP: server, SrcPort: 5000, DstPort: 53,
+			Payload: make([]byte, 10), ObservationTime: start},
+		{LayerType: "UDP", SrcIP: client, DstIP: server, SrcPort: 5000, DstPort: 53,
+			Payload: make([]byte, 20), ObservationTime: start.Add(time.Second)},
+		{LayerType: "HTTP", SrcIP: client, DstIP: server, SrcPort: 40000, DstPort: 80, ConnectionID: conn,
+			Content: gnet.HTTPRequest{Body: memview.New(make([]byte, 100))}, ObservationTime: start},
+		{LayerType: "HTTP", SrcIP: client, DstIP: server, SrcPort: 40000, DstPort: 80, ConnectionID: conn,
+			Content: gnet.DroppedBytes(5), ObservationTime: start.Add(time.Second)},
+		{LayerType: "UDP", SrcIP: client, DstIP: server, SrcPort: 5000, DstPort: 53,
+			Payload: make([]byte, 30), ObservationTime: start.Add(2 * time.Second)},
+	}
+
+	got, st := forwardAll(OverflowDrop, traffic)
+	assert.Equal(t, uint64(4), st.TrafficDropped)
+	assert.Equal(t, traffic[:1], got)
+
+	got, st = forwardAll(OverflowSummarize, traffic)
+	assert.Equal(t, uint64(4), st.TrafficDropped)
+	if assert.Len(t, got, 3) {
+		assert.Equal(t, traffic[0], got[0])
+
+		assert.Equal(t, gnet.DroppedBytes(50), got[1].Content)
+		assert.Equal(t, 53, got[1].DstPort)
+		assert.Equal(t, start.Add(time.Second), got[1].ObservationTime)
+		assert.Equal(t, start.Add(2*time.Second), got[1].FinalPacketTime)
+
+		assert.Equal(t, gnet.DroppedBytes(105), got[2].Content)
+		assert.Equal(t, conn, got[2].ConnectionID)
+	}
+}
@@ -90,3 +90,26 @@ func CreateUDPPacket(src, dst net.IP, srcPort, dstPort int, payload []byte) gopa
 	)
 	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
 }
+
+// Returns the link type that packet was decoded from, judging by its first
+// layer. Defaults to Ethernet.
+func linkTypeOf(packet gopacket.Packet) layers.LinkType {
+	ls := packet.Layers()
+	if len(ls) == 0 {
+		return layers.LinkTypeEthernet
+	}
+	switch ls[0].LayerType() {
+	case layers.LayerTypeLinuxSLL, LayerTypeLinuxSLL2:
+		// SLL2 packets are written with an SLL header.
+		return layers.LinkTypeLinuxSLL
+	case layers.LayerTypeLoopback:
+		return layers.LinkTypeNull
+	case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+		return layers.LinkTypeRaw
+	case layers.LayerTypeDot11:
+		return layers.LinkTypeIEEE802_11
+	case layers.LayerTypeRadioTap:
+		return layers.LinkTypeIEEE80211Radio
+	}
+	return layers.LinkTypeEthernet
+}
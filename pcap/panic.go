@@ -0,0 +1,90 @@
+package pcap
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// A panic recovered while handling a packet, such as one raised by a parser on
+// malformed input.
+type ParserPanic struct {
+	// Name of the parser that panicked, and the connection it was parsing.
+	// Empty and uuid.Nil if the panic was raised elsewhere, e.g. while
+	// decoding the packet.
+	Parser       string
+	ConnectionID uuid.UUID
+
+	// The value passed to panic.
+	Value interface{}
+
+	Stack string
+}
+
+func (p ParserPanic) Error() string {
+	if p.Parser == "" {
+		return fmt.Sprintf("panic while handling packet: %v", p.Value)
+	}
+	return fmt.Sprintf("%s panicked on connection %s: %v", p.Parser, p.ConnectionID, p.Value)
+}
+
+// Logs, counts and hands recovered panics to Options.PanicHandler. A nil
+// reporter only turns them into errors.
+type panicReporter struct {
+	counters *parserCounters
+	logger   gnet.Logger
+	handler  func(ParserPanic)
+}
+
+func (p *TrafficParser) panicReporter() *panicReporter {
+	return &panicReporter{
+		counters: p.counters,
+		logger:   p.opts.Logger,
+		handler:  p.opts.PanicHandler,
+	}
+}
+
+// Reports v, a value just recovered from a panic.
+func (r *panicReporter) report(parser string, id uuid.UUID, v interface{}) ParserPanic {
+	pp := ParserPanic{
+		Parser:       parser,
+		ConnectionID: id,
+		Value:        v,
+		Stack:        string(debug.Stack()),
+	}
+	if r == nil {
+		return pp
+	}
+	atomic.AddUint64(&r.counters.panics, 1)
+	r.logger.Warnf("recovered from %v\n%s", pp, pp.Stack)
+	if r.handler != nil {
+		r.handler(pp)
+	}
+	return pp
+}
+
+// Like parse, for bidirectional parsers.
+func (r *panicReporter) parseBidi(parser gnet.TCPBidiParser, id uuid.UUID, dir gnet.FlowDirection, input memview.MemView, isEnd bool) (results []gnet.BidiResult, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			results, err = nil, r.report(parser.Name(), id, v)
+		}
+	}()
+	return parser.Parse(dir, input, isEnd)
+}
+
+// Calls parser.Parse, turning a panic into an error.
+func (r *panicReporter) parse(parser gnet.TCPParser, id uuid.UUID, input memview.MemView, isEnd bool) (pnc gnet.ParsedNetworkContent, unused memview.MemView, n int64, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			pnc, unused, n = nil, memview.MemView{}, input.Len()
+			err = r.report(parser.Name(), id, v)
+		}
+	}()
+	return parser.Parse(input, isEnd)
+}
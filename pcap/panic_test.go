@@ -0,0 +1,81 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Accepts everything, with parsers that panic.
+type panickingParserFactory struct{}
+
+func (panickingParserFactory) Name() string { return "Panicking Parser Factory" }
+
+func (panickingParserFactory) Accepts(memview.MemView, bool) (gnet.AcceptDecision, int64) {
+	return gnet.Accept, 0
+}
+
+func (panickingParserFactory) CreateParser(uuid.UUID, reassembly.Sequence, reassembly.Sequence) gnet.TCPParser {
+	return panickingParser{}
+}
+
+type panickingParser struct{}
+
+func (panickingParser) Name() string { return "Panicking Parser" }
+
+func (panickingParser) Parse(memview.MemView, bool) (gnet.ParsedNetworkContent, memview.MemView, int64, error) {
+	panic("malformed input")
+}
+
+func TestParserPanic(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreatePacketWithSeq(client, server, 40000, 80, []byte("boom"), 101),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	var panics []ParserPanic
+	opts := NewOptions()
+	WithPanicHandler(func(pp ParserPanic) { panics = append(panics, pp) })(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(), panickingParserFactory{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var dropped gnet.DroppedBytes
+	var connectionID uuid.UUID
+	for tr := range out {
+		if d, ok := tr.Content.(gnet.DroppedBytes); ok {
+			dropped += d
+			connectionID = tr.ConnectionID
+		}
+	}
+
+	assert.Equal(t, gnet.DroppedBytes(4), dropped)
+	if assert.Len(t, panics, 1) {
+		assert.Equal(t, "Panicking Parser", panics[0].Parser)
+		assert.Equal(t, connectionID, panics[0].ConnectionID)
+		assert.Equal(t, "malformed input", panics[0].Value)
+		assert.Contains(t, panics[0].Stack, "panickingParser.Parse")
+		assert.Contains(t, panics[0].Error(), "Panicking Parser panicked")
+	}
+	assert.Equal(t, uint64(1), p.Stats().Panics)
+}
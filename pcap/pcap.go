@@ -3,18 +3,78 @@ package pcap
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
 	"github.com/mel2oo/go-pcap/gnet"
+	_ "github.com/mel2oo/go-pcap/gnet/all"
+	"github.com/mel2oo/go-pcap/gnet/filter"
+	"github.com/mel2oo/go-pcap/gnet/kerberos"
+	"github.com/mel2oo/go-pcap/gnet/quic"
+	"github.com/mel2oo/go-pcap/gnet/sip"
+	"github.com/mel2oo/go-pcap/gnet/syslog"
+	"github.com/mel2oo/go-pcap/gnet/tlsdecrypt"
+	"github.com/mel2oo/go-pcap/mempool"
+	"github.com/mel2oo/go-pcap/pcap/writer"
 )
 
 type TrafficParser struct {
 	opts    Options
 	reader  PcapReader
 	outchan chan gnet.NetTraffic
+
+	// Parsers selected by name through the options, used when Parse is called
+	// without explicit factories. One for each assembly worker, unless they
+	// share a buffer pool supplied with WithBufferPool.
+	factories []gnet.TCPParserFactorySelector
+
+	// Non-nil while packets are written to capture files.
+	captureFile *writer.RotatingWriter
+
+	// Names of the devices captured from, by InterfaceIndex, when capturing
+	// from several.
+	interfaces []string
+
+	counters *parserCounters
+
+	// Resolved from Options.PortHints.
+	portHints gnet.TCPParserFactoryHints
+
+	// Groups UDP datagrams into flows during Parse, if enabled.
+	udpFlows *udpFlowTable
+
+	// Reassembles fragmented datagrams during Parse.
+	defragmenter *defragmenter
+
+	// Selects the packets parsed during Parse, if sampling.
+	sampler *sampler
+
+	// Run on the traffic returned by Parse. See Use.
+	middleware []Middleware
+
+	// Position in the files read, for checkpoints. Updated during Parse.
+	progress fileProgress
+
+	// Set by Parse for Close: stop cancels capture, abandon is closed when
+	// Close stops waiting, and closed once the output of Parse is.
+	stop        context.CancelFunc
+	abandon     chan struct{}
+	closed      chan struct{}
+	abandonOnce sync.Once
+}
+
+// Implemented by readers that capture from several interfaces, such as
+// MultiDeviceReader.
+type interfaceLister interface {
+	Interfaces() []string
 }
 
 func NewTrafficParser(opt ...Option) (*TrafficParser, error) {
@@ -23,58 +83,330 @@ func NewTrafficParser(opt ...Option) (*TrafficParser, error) {
 		o(&opts)
 	}
 
-	if len(opts.ReadName) == 0 {
+	multi := len(opts.Interfaces) > 0 || opts.AllInterfaces
+	if len(opts.ReadName) == 0 && len(opts.ReadFiles) == 0 && opts.ReadStream == nil && !multi {
 		return nil, errors.New("please set reader name")
 	}
 
+	// Like tcpdump -r -.
+	if !opts.Live && opts.ReadName == "-" && opts.ReadStream == nil {
+		opts.ReadStream = os.Stdin
+	}
+
 	var reader PcapReader
-	if !opts.Live {
-		reader = NewFileReader(opts.ReadName, opts.BPFilter)
+	var progress fileProgress
+	files := opts.ReadStream == nil && (len(opts.ReadFiles) > 0 || !opts.Live && !multi)
+	if (opts.Checkpoint != nil || opts.Resume != nil) && !files {
+		return nil, errors.New("checkpoints are only supported when reading files")
+	}
+	if opts.ReadStream != nil {
+		r := NewStreamReader(opts.ReadStream, opts.BPFilter)
+		r.ReplaySpeed = opts.ReplaySpeed
+		reader = r
+	} else if len(opts.ReadFiles) > 0 {
+		r := NewMultiFileReader(opts.ReadFiles, opts.BPFilter)
+		r.ReplaySpeed = opts.ReplaySpeed
+		r.Watch = opts.WatchFiles
+		r.Resume = opts.Resume
+		if opts.WatchInterval > 0 {
+			r.WatchInterval = opts.WatchInterval
+		}
+		reader = r
+	} else if multi {
+		r := NewMultiDeviceReader(opts.Interfaces, opts.BPFilter)
+		r.SnapLen, r.Promiscuous, r.Timeout = opts.SnapLen, opts.Promiscuous, opts.CaptureTimeout
+		reader = r
+	} else if !opts.Live {
+		r := NewFileReader(opts.ReadName, opts.BPFilter)
+		r.ReplaySpeed = opts.ReplaySpeed
+		if opts.Resume != nil {
+			if opts.Resume.File != opts.ReadName {
+				return nil, fmt.Errorf("cannot resume reading %s from a checkpoint of %s", opts.ReadName, opts.Resume.File)
+			}
+			r.Skip = opts.Resume.Packets
+		}
+		progress = fileProgress{file: opts.ReadName, packets: r.Skip}
+		reader = r
+	} else if opts.AFPacket {
+		r := NewAFPacketReader(opts.ReadName, opts.BPFilter)
+		if opts.AFPacketBlockSize > 0 {
+			r.BlockSize = opts.AFPacketBlockSize
+		}
+		if opts.AFPacketNumBlocks > 0 {
+			r.NumBlocks = opts.AFPacketNumBlocks
+		}
+		if opts.CaptureTimeout > 0 {
+			r.BlockTimeout = opts.CaptureTimeout
+		}
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		reader = r
 	} else {
-		reader = NewDeviceReader(opts.ReadName, opts.BPFilter)
+		r := NewDeviceReader(opts.ReadName, opts.BPFilter)
+		r.SnapLen, r.Promiscuous, r.Timeout = opts.SnapLen, opts.Promiscuous, opts.CaptureTimeout
+		reader = r
+	}
+
+	if opts.OutputBufferSize < 0 {
+		opts.OutputBufferSize = 0
+	}
+
+	if len(opts.LocalAddrs) == 0 && (opts.Live || multi) {
+		addrs, err := InterfaceAddrs()
+		if err != nil {
+			opts.Logger.Warnf("local host roles will be unknown: %v", err)
+		}
+		opts.LocalAddrs = addrs
+	}
+
+	factories, err := selectFactories(&opts)
+	if err != nil {
+		return nil, err
+	}
+	portHints, err := resolvePortHints(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.FilterExpr) > 0 {
+		f, err := filter.Compile(opts.FilterExpr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", opts.FilterExpr, err)
+		}
+		if opts.Filter != nil {
+			f = filter.And(opts.Filter, f)
+		}
+		opts.Filter = f
+	}
+
+	if len(opts.TLSKeyLogFile) > 0 {
+		if opts.TLSKeyLog == nil {
+			opts.TLSKeyLog = tlsdecrypt.NewKeyLog()
+		}
+		if err := opts.TLSKeyLog.LoadFile(opts.TLSKeyLogFile); err != nil {
+			return nil, err
+		}
 	}
 
 	return &TrafficParser{
-		opts:    opts,
-		reader:  reader,
-		outchan: make(chan gnet.NetTraffic, 100),
+		opts:      opts,
+		reader:    reader,
+		outchan:   make(chan gnet.NetTraffic, opts.OutputBufferSize),
+		factories: factories,
+		counters:  &parserCounters{},
+		portHints: portHints,
+		progress:  progress,
 	}, nil
 }
 
+// Resolves the parser names in opts against the parser registry, or uses the
+// parsers enabled in it if no names are given. Unless a buffer pool was
+// supplied, each assembly worker gets parsers drawing from its own slice of the
+// default pool, so that workers do not contend for buffers.
+func selectFactories(opts *Options) ([]gnet.TCPParserFactorySelector, error) {
+	names := opts.Parsers
+	if len(opts.ParserConfigFile) > 0 {
+		fromFile, err := gnet.ReadParserNamesFile(opts.ParserConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, fromFile...)
+	}
+	registry := parserRegistry(opts)
+	newSelector := func(pool mempool.BufferPool) (gnet.TCPParserFactorySelector, error) {
+		if len(names) == 0 {
+			return registry.Selector(pool), nil
+		}
+		return registry.SelectorFromNames(pool, names...)
+	}
+
+	if opts.BufferPool == nil && opts.AssemblyWorkers > 1 {
+		poolSize := DefaultBufferPoolSize / int64(opts.AssemblyWorkers)
+		if poolSize < DefaultBufferChunkSize {
+			poolSize = DefaultBufferChunkSize
+		}
+		selectors := make([]gnet.TCPParserFactorySelector, opts.AssemblyWorkers)
+		for i := range selectors {
+			pool, err := mempool.MakeBufferPool(poolSize, DefaultBufferChunkSize)
+			if err != nil {
+				return nil, err
+			}
+			if selectors[i], err = newSelector(pool); err != nil {
+				return nil, err
+			}
+		}
+		return selectors, nil
+	}
+
+	if opts.BufferPool == nil {
+		pool, err := mempool.MakeBufferPool(DefaultBufferPoolSize, DefaultBufferChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		opts.BufferPool = pool
+	}
+	selector, err := newSelector(opts.BufferPool)
+	if err != nil {
+		return nil, err
+	}
+	return []gnet.TCPParserFactorySelector{selector}, nil
+}
+
+func parserRegistry(opts *Options) *gnet.TCPParserRegistry {
+	if opts.ParserRegistry != nil {
+		return opts.ParserRegistry
+	}
+	return gnet.DefaultTCPParserRegistry
+}
+
+// Creates the parsers named in opts.PortHints from the parser registry.
+// They draw from opts.BufferPool, which is created if needed.
+func resolvePortHints(opts *Options) (gnet.TCPParserFactoryHints, error) {
+	if len(opts.PortHints) == 0 {
+		return nil, nil
+	}
+	if opts.BufferPool == nil {
+		pool, err := mempool.MakeBufferPool(DefaultBufferPoolSize, DefaultBufferChunkSize)
+		if err != nil {
+			return nil, err
+		}
+		opts.BufferPool = pool
+	}
+
+	hints := make(gnet.TCPParserFactoryHints, len(opts.PortHints))
+	for port, hint := range opts.PortHints {
+		factories, err := parserRegistry(opts).SelectorFromNames(opts.BufferPool, hint.Parsers...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hint for port %d: %w", port, err)
+		}
+		hints[port] = gnet.PortHint{Factories: factories, Exclusive: hint.Exclusive}
+	}
+	return hints, nil
+}
+
 // Parses network traffic from an interface.
 // This function will attempt to parse the traffic with the highest level of
 // protocol details as possible. For instance, it will try to piece together
 // HTTP request and response pairs.
 // The order of parsers matters: earlier parsers will get tried first. Once a
-// parser has been accepted, no other parser will be used.
+// parser has been accepted, no other parser will be used. If no parsers are
+// given, the ones selected by name with WithParsers or WithParserConfigFile, or
+// else those enabled in the parser registry, are used.
+// The returned channel is closed once capture ends and the traffic in progress
+// has been flushed; use Close to end a live capture.
 func (p *TrafficParser) Parse(ctx context.Context,
 	fs ...gnet.TCPParserFactory) (<-chan gnet.NetTraffic, error) {
+	factories := p.factories
+	if len(fs) > 0 {
+		factories = []gnet.TCPParserFactorySelector{fs}
+	}
+	// The parsers of the assembly worker at index i.
+	factoriesFor := func(i int) gnet.TCPParserFactorySelector {
+		if len(factories) == 0 {
+			return nil
+		}
+		selector := factories[i%len(factories)]
+		if p.opts.Logger != gnet.NopLogger {
+			selector = selector.WithLogger(p.opts.Logger)
+		}
+		return selector
+	}
+
+	// Capture is cancelled early once a limit set with WithMaxPackets or
+	// WithMaxBytes is reached.
+	ctx, cancel := context.WithCancel(ctx)
+
 	// Read in packets, pass to assembler
 	packets, err := p.reader.Capture(ctx)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
+	if l, ok := p.reader.(interfaceLister); ok {
+		p.interfaces = l.Interfaces()
+	}
+
 	// Set up assembly
-	streamFactory := newTCPStreamFactory(p.outchan, gnet.TCPParserFactorySelector(fs))
-	streamPool := reassembly.NewStreamPool(streamFactory)
-	assembler := reassembly.NewAssembler(streamPool)
+	newStreamFactory := func(fs gnet.TCPParserFactorySelector) *tcpStreamFactory {
+		streamFactory := newTCPStreamFactory(p.outchan, fs)
+		streamFactory.keyLog = p.opts.TLSKeyLog
+		streamFactory.quality = p.opts.TCPQualityMetrics
+		streamFactory.qualityInterval = p.opts.TCPQualityInterval
+		streamFactory.parserTimeout = p.opts.ParserTimeout
+		streamFactory.panics = p.panicReporter()
+		streamFactory.portHints = p.portHints
+		streamFactory.reselection = p.opts.ReselectionPolicy
+		streamFactory.lru = newStreamLRU(tcpConnectionShare(p.opts))
+		streamFactory.interfaces = p.interfaces
+		streamFactory.counters = p.counters
+		streamFactory.logger = p.opts.Logger
+		return streamFactory
+	}
+	newAssembler := func(streamFactory *tcpStreamFactory) *reassembly.Assembler {
+		streamPool := reassembly.NewStreamPool(streamFactory)
+		assembler := reassembly.NewAssembler(streamPool)
+
+		// Override the assembler configuration. (This is the documented way to change them.)
+		// Give this particular assembler a fraction of the total pages; there doesn't seem to be a way
+		// to set an aggregate limit without major work.
+		assembler.AssemblerOptions.MaxBufferedPagesTotal = p.opts.MaxBufferedPagesTotal
+		assembler.AssemblerOptions.MaxBufferedPagesPerConnection = p.opts.MaxBufferedPagesPerConnection
+		return assembler
+	}
 
-	// Override the assembler configuration. (This is the documented way to change them.)
-	// Give this particular assembler a fraction of the total pages; there doesn't seem to be a way
-	// to set an aggregate limit without major work.
-	assembler.AssemblerOptions.MaxBufferedPagesTotal = p.opts.MaxBufferedPagesTotal
-	assembler.AssemblerOptions.MaxBufferedPagesPerConnection = p.opts.MaxBufferedPagesPerConnection
+	newAssemblerSet := func(worker int) *assemblerSet {
+		streamFactory := newStreamFactory(factoriesFor(worker))
+		set := newAssemblerSet(func() *reassembly.Assembler {
+			return newAssembler(streamFactory)
+		}, p.opts.PerInterfaceAssembly)
+		set.lru = streamFactory.lru
+		set.factory = streamFactory
+		return set
+	}
+	var assemblers assemblerGroup
+	if p.opts.AssemblyWorkers > 1 {
+		sets := make([]*assemblerSet, p.opts.AssemblyWorkers)
+		for i := range sets {
+			sets[i] = newAssemblerSet(i)
+		}
+		assemblers = newShardedAssembler(sets, p.panicReporter())
+	} else {
+		assemblers = newAssemblerSet(0)
+	}
+
+	p.defragmenter = newDefragmenter(p.counters)
+	p.sampler = newSampler(p.opts)
+	if p.opts.UDPFlowTimeout > 0 {
+		p.udpFlows = newUDPFlowTable(p.opts.UDPFlowTimeout, p.opts.MaxUDPFlows, p.opts.UDPParsers, p.counters, p.opts.Logger)
+	}
 
 	streamFlushTimeout := time.Duration(p.opts.StreamFlushTimeout) * time.Second
 	streamCloseTimeout := time.Duration(p.opts.StreamCloseTimeout) * time.Second
 
+	captureStart := time.Now()
+
+	// The timestamp of the latest packet, and when it was read. Parser
+	// timeouts are in packet time, which advances with the wall clock while
+	// no packets arrive.
+	var lastPacketTime, lastPacketRead time.Time
+	p.opts.Logger.Debugf("capture started")
+
 	go func() {
 		ticker := time.NewTicker(streamFlushTimeout / 4)
 		defer ticker.Stop()
 
+		var checkpoints <-chan time.Time
+		if p.opts.Checkpoint != nil && p.opts.CheckpointInterval > 0 {
+			t := time.NewTicker(p.opts.CheckpointInterval)
+			defer t.Stop()
+			checkpoints = t.C
+		}
+
 		// Signal caller that we're done on exit
 		defer close(p.outchan)
+		defer p.closeCaptureFile()
+		defer cancel()
 
 		for {
 			select {
@@ -90,12 +422,41 @@ func (p *TrafficParser) Parse(ctx context.Context,
 					// This is not safe to call in a defer, because it will be called on abnormal
 					// exit from FlushCloseOlderThan (like a parser segfault) but assembler might
 					// not be in a safe state to call (like holding a mutex.)
-					assembler.FlushAll()
+					assemblers.flushAll()
+					p.udpFlows.endAll(p.outchan)
+					p.checkpoint()
 
 					return
 				}
 
-				p.PacketToNetTraffic(assembler, packet)
+				if atomic.AddUint64(&p.counters.packets, 1) == 1 {
+					p.opts.Logger.Debugf("first packet received %v after capture started", time.Since(captureStart))
+				}
+				atomic.AddUint64(&p.counters.bytes, uint64(len(packet.Data())))
+				if p.opts.Checkpoint != nil {
+					p.progress.observe(packet)
+				}
+
+				if b, ok := fileBoundaryOf(packet); ok {
+					p.outchan <- gnet.NetTraffic{
+						LayerType:       "CaptureFile",
+						Content:         gnet.CaptureFileBoundary{Path: b.path},
+						ObservationTime: packet.Metadata().Timestamp,
+						FinalPacketTime: packet.Metadata().Timestamp,
+					}
+				}
+
+				lastPacketTime, lastPacketRead = packet.Metadata().Timestamp, time.Now()
+				p.writeCaptureFile(packet)
+				p.packetToNetTraffic(assemblers, packet)
+
+				if p.limitReached() {
+					p.opts.Logger.Debugf("capture limit reached, stopping")
+					assemblers.flushAll()
+					p.udpFlows.endAll(p.outchan)
+					p.checkpoint()
+					return
+				}
 			case <-ticker.C:
 				// The assembler stops reassembly for streams older than streamFlushTimeout.
 				// This means the corresponding tcpFlow readers will return EOF.
@@ -115,28 +476,123 @@ func (p *TrafficParser) Parse(ctx context.Context,
 				now := time.Now()
 				streamFlushThreshold := now.Add(-streamFlushTimeout)
 				streamCloseThreshold := now.Add(-streamCloseTimeout)
-				flushed, closed := assembler.FlushWithOptions(
+				flushed, closed := assemblers.flush(
 					reassembly.FlushOptions{
 						T:  streamFlushThreshold,
 						TC: streamCloseThreshold,
 					})
-
-				if flushed != 0 || closed != 0 {
-					continue
+				atomic.AddUint64(&p.counters.streamsFlushed, uint64(flushed))
+				atomic.AddUint64(&p.counters.streamsClosed, uint64(closed))
+				if p.opts.ParserTimeout > 0 && !lastPacketTime.IsZero() {
+					assemblers.expireParsers(lastPacketTime.Add(time.Since(lastPacketRead)))
 				}
+				p.defragmenter.discardOlderThan(now.Add(-fragmentTimeout))
+				p.udpFlows.expire(p.outchan)
+			case <-checkpoints:
+				p.checkpoint()
 			}
 		}
 	}()
 
-	return p.outchan, nil
+	var out <-chan gnet.NetTraffic = p.outchan
+	if p.opts.Filter != nil {
+		out = p.filter(p.opts.Filter, out)
+	}
+	if p.opts.OverflowPolicy != OverflowBlock {
+		forwarded := make(chan gnet.NetTraffic, cap(p.outchan))
+		go p.forward(out, forwarded)
+		out = forwarded
+	}
+	if p.sampler != nil {
+		out = markSampled(p.sampler.rate(), out)
+	}
+	if len(p.opts.LocalAddrs) > 0 {
+		out = newRoleTagger(p.opts.LocalAddrs).run(out)
+	}
+	if p.opts.Enricher != nil {
+		out = enrich(p.opts.Enricher, out)
+	}
+	if len(p.middleware) > 0 {
+		out = p.runMiddleware(out)
+	}
+	p.stop = cancel
+	p.abandon = make(chan struct{})
+	p.closed = make(chan struct{})
+	return p.drain(out), nil
+}
+
+// Returns the addresses of the capturing host: those set with WithLocalAddrs,
+// or for live captures, those of its interfaces.
+func (p *TrafficParser) LocalAddrs() []net.IP {
+	return p.opts.LocalAddrs
+}
+
+// Reports whether the packet or byte limit of the capture has been reached.
+func (p *TrafficParser) limitReached() bool {
+	if p.opts.MaxPackets > 0 && atomic.LoadUint64(&p.counters.packets) >= p.opts.MaxPackets {
+		return true
+	}
+	return p.opts.MaxBytes > 0 && atomic.LoadUint64(&p.counters.bytes) >= p.opts.MaxBytes
+}
+
+// Statistics of the capture and of parsing so far. Safe to call while parsing.
+func (p *TrafficParser) Stats() Stats {
+	st := p.counters.stats()
+	st.CaptureStats = p.reader.Stats()
+	return st
+}
+
+// Writes packet to the capture files, if enabled. The files are created with
+// the link type of the first packet.
+func (p *TrafficParser) writeCaptureFile(packet gopacket.Packet) {
+	if len(p.opts.CaptureFile) == 0 {
+		return
+	}
+	if p.captureFile == nil {
+		p.captureFile = writer.NewRotatingWriter(p.opts.CaptureFile, linkTypeOf(packet),
+			writer.RotatingOptions{
+				MaxSize:  p.opts.CaptureFileSize,
+				Interval: p.opts.CaptureFileInterval,
+				Compress: p.opts.CaptureFileCompress,
+			})
+	}
+
+	// Capture files cannot have the SLL2 link type, see LinkTypeLinuxSLL2.
+	var err error
+	if _, ok := packet.LinkLayer().(*LinuxSLL2); ok {
+		ci := packet.Metadata().CaptureInfo
+		data := linuxSLL2ToSLL(packet.Data())
+		ci.CaptureLength -= len(packet.Data()) - len(data)
+		ci.Length -= len(packet.Data()) - len(data)
+		err = p.captureFile.WriteData(ci, data)
+	} else {
+		err = p.captureFile.WritePacket(packet)
+	}
+
+	// Failing to save a packet does not stop parsing.
+	if err != nil {
+		p.opts.Logger.Warnf("failed to write packet to capture file: %v", err)
+	}
+}
+
+func (p *TrafficParser) closeCaptureFile() {
+	if p.captureFile != nil {
+		p.captureFile.Close()
+		p.captureFile = nil
+	}
 }
 
 func (p *TrafficParser) PacketToNetTraffic(assembler *reassembly.Assembler, packet gopacket.Packet) {
+	p.packetToNetTraffic(assembler, packet)
+}
+
+func (p *TrafficParser) packetToNetTraffic(assembler packetAssembler, packet gopacket.Packet) {
 	defer func() {
 		// If we panic during packet handling, do not crash the program. Instead log the error and backtrace.
 		// We can perform selective error-handling based on the type of the object passed to panic(),
 		// but we can't choose not to recover from certain errors; we would have to re-panic.
 		if err := recover(); err != nil {
+			p.panicReporter().report("", uuid.Nil, err)
 			return
 		}
 	}()
@@ -151,16 +607,70 @@ func (p *TrafficParser) PacketToNetTraffic(assembler *reassembly.Assembler, pack
 
 	traffic := &gnet.NetTraffic{
 		ObservationTime: observationTime,
+		Interface:       interfaceName(p.interfaces, interfaceIndex(packet)),
+	}
+
+	traffic.VLANs = vlanIDs(packet)
+	if !p.vlanSelected(traffic.VLANs) {
+		return
+	}
+
+	// ARP has no network layer.
+	if l, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		if l.Protocol == layers.EthernetTypeIPv4 && p.sampled(packet) {
+			arp := gnet.FromARP(l)
+			traffic.LayerType = l.LayerType().String()
+			traffic.SrcIP, traffic.DstIP = arp.SenderIP, arp.TargetIP
+			traffic.Content = arp
+			p.outchan <- *traffic
+		}
+		return
 	}
 
 	if packet.NetworkLayer() == nil {
 		return
 	}
 
-	ParseNetTraffic(assembler, packet, traffic, p.outchan)
+	if packet, traffic.Tunnels = p.unwrap(packet); packet == nil {
+		return
+	}
+	if !p.sampled(packet) {
+		return
+	}
+
+	parseNetTraffic(assembler, p.udpFlows, packet, traffic, p.outchan)
+}
+
+// Reports whether packet is kept by sampling, counting it if not.
+func (p *TrafficParser) sampled(packet gopacket.Packet) bool {
+	if p.sampler.keep(packet) {
+		return true
+	}
+	atomic.AddUint64(&p.counters.packetsSampledOut, 1)
+	return false
+}
+
+func interfaceIndex(packet gopacket.Packet) int {
+	if md := packet.Metadata(); md != nil {
+		return md.InterfaceIndex
+	}
+	return 0
+}
+
+// Returns the name of the interface at index, or "" if unknown.
+func interfaceName(interfaces []string, index int) string {
+	if index < 0 || index >= len(interfaces) {
+		return ""
+	}
+	return interfaces[index]
 }
 
 func ParseNetTraffic(assembler *reassembly.Assembler, packet gopacket.Packet,
+	traffic *gnet.NetTraffic, outchan chan gnet.NetTraffic) {
+	parseNetTraffic(assembler, nil, packet, traffic, outchan)
+}
+
+func parseNetTraffic(assembler packetAssembler, udpFlows *udpFlowTable, packet gopacket.Packet,
 	traffic *gnet.NetTraffic, outchan chan gnet.NetTraffic) {
 	switch layer := packet.NetworkLayer().(type) {
 	case *layers.IPv4:
@@ -171,18 +681,21 @@ func ParseNetTraffic(assembler *reassembly.Assembler, packet gopacket.Packet,
 		traffic.DstIP = layer.DstIP
 	}
 
-	TransLayerToTraffic(assembler, packet, traffic, outchan)
+	transLayerToTraffic(assembler, udpFlows, packet, traffic, outchan)
 }
 
 func TransLayerToTraffic(assembler *reassembly.Assembler, packet gopacket.Packet,
+	traffic *gnet.NetTraffic, outchan chan gnet.NetTraffic) {
+	transLayerToTraffic(assembler, nil, packet, traffic, outchan)
+}
+
+func transLayerToTraffic(assembler packetAssembler, udpFlows *udpFlowTable, packet gopacket.Packet,
 	traffic *gnet.NetTraffic, outchan chan gnet.NetTraffic) {
 	switch layer := packet.TransportLayer().(type) {
 	case *layers.TCP:
-		assembler.AssembleWithContext(
-			packet.NetworkLayer().NetworkFlow(),
-			layer,
-			contextFromTCPPacket(packet, layer),
-		)
+		ctx := contextFromTCPPacket(packet, layer)
+		ctx.tunnels, ctx.vlans = traffic.Tunnels, traffic.VLANs
+		assembler.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), layer, ctx)
 		return
 
 	case *layers.UDP:
@@ -190,23 +703,23 @@ func TransLayerToTraffic(assembler *reassembly.Assembler, packet gopacket.Packet
 		traffic.Payload = layer.LayerPayload()
 
 		UdpLayerToTraffic(packet, traffic)
+		udpFlows.observe(traffic, outchan)
 
 	default:
 		traffic.Payload = packet.NetworkLayer().LayerPayload()
 
 		if icmplayer := packet.Layer(layers.LayerTypeICMPv4); icmplayer != nil {
 			traffic.LayerType = layers.LayerTypeICMPv4.String()
-			icmp, ok := icmplayer.(*layers.ICMPv4)
-			if ok {
-				traffic.Content = gnet.ICMPv4{
-					TypeCode: icmp.TypeCode,
-					Checksum: icmp.Checksum,
-					Id:       icmp.Id,
-					Seq:      icmp.Seq,
-				}
+			if icmp, ok := icmplayer.(*layers.ICMPv4); ok {
+				traffic.Content = icmpv4Content(icmp)
 			}
-		} else if packet.Layer(layers.LayerTypeICMPv6) != nil {
+		} else if icmplayer := packet.Layer(layers.LayerTypeICMPv6); icmplayer != nil {
 			traffic.LayerType = layers.LayerTypeICMPv6.String()
+			if ndp, ok := ndpContent(packet); ok {
+				traffic.Content = ndp
+			} else if icmp, ok := icmplayer.(*layers.ICMPv6); ok {
+				traffic.Content = icmpv6Content(packet, icmp)
+			}
 		}
 	}
 
@@ -217,30 +730,79 @@ func UdpLayerToTraffic(packet gopacket.Packet, traffic *gnet.NetTraffic) {
 	traffic.SrcPort = int(packet.TransportLayer().(*layers.UDP).SrcPort)
 	traffic.DstPort = int(packet.TransportLayer().(*layers.UDP).DstPort)
 
+	// DHCP layers are decoded by gopacket, but are not application layers.
+	if l, ok := packet.Layer(layers.LayerTypeDHCPv4).(*layers.DHCPv4); ok {
+		traffic.LayerType = l.LayerType().String()
+		traffic.Content = gnet.FromDHCPv4(l)
+		return
+	}
+	if l, ok := packet.Layer(layers.LayerTypeDHCPv6).(*layers.DHCPv6); ok {
+		traffic.LayerType = l.LayerType().String()
+		traffic.Content = gnet.FromDHCPv6(l)
+		return
+	}
+
 	switch l := packet.ApplicationLayer().(type) {
 	case *layers.DNS:
 		traffic.LayerType = l.LayerType().String()
-		traffic.Content = gnet.DNSRequest{
-			ID:     l.ID,
-			QR:     l.QR,
-			OpCode: l.OpCode,
+		traffic.Content = gnet.FromDNS(l, gnet.DNSProtocol)
+	default:
+		switch {
+		case isNameResolutionPort(traffic, mdnsPort):
+			decodeNameResolution(traffic, gnet.MDNSProtocol)
+		case isNameResolutionPort(traffic, llmnrPort):
+			decodeNameResolution(traffic, gnet.LLMNRProtocol)
+		case isNameResolutionPort(traffic, nbnsPort):
+			decodeNameResolution(traffic, gnet.NBNSProtocol)
+
+		// QUIC runs on arbitrary ports, but its long header is distinctive.
+		case quic.IsInitial(traffic.Payload):
+			if meta, err := quic.ParseInitial(traffic.Payload); err == nil {
+				traffic.LayerType = "QUIC"
+				traffic.Content = meta
+			}
 
-			AA: l.AA,
-			TC: l.TC,
-			RD: l.RD,
-			RA: l.RA,
-			Z:  l.Z,
+		// gopacket only decodes SIP on the well-known ports, so recognize it by
+		// content instead.
+		case sip.IsSIP(traffic.Payload):
+			if msg, err := sip.ParseMessage(traffic.Payload); err == nil {
+				traffic.LayerType = layers.LayerTypeSIP.String()
+				traffic.Content = msg
+			}
 
-			ResponseCode: l.ResponseCode,
-			QDCount:      l.QDCount,
-			ANCount:      l.ANCount,
-			NSCount:      l.NSCount,
-			ARCount:      l.ARCount,
+		case (traffic.SrcPort == kerberos.Port || traffic.DstPort == kerberos.Port) && kerberos.IsKerberos(traffic.Payload):
+			if msg, err := kerberos.ParseMessage(traffic.Payload); err == nil {
+				traffic.LayerType = "Kerberos"
+				traffic.Content = msg
+			}
 
-			Questions:   l.Questions,
-			Answers:     l.Answers,
-			Authorities: l.Authorities,
-			Additionals: l.Additionals,
+		// A PRI part alone is too weak a signal, so also require the port.
+		case traffic.DstPort == syslog.UDPPort && syslog.IsSyslog(traffic.Payload):
+			if msg, err := syslog.ParseMessage(traffic.Payload); err == nil {
+				traffic.LayerType = "Syslog"
+				traffic.Content = msg
+			}
 		}
 	}
 }
+
+// Well-known ports of protocols that share the DNS message format, which
+// gopacket only decodes on port 53.
+const (
+	mdnsPort  = 5353
+	llmnrPort = 5355
+	nbnsPort  = 137
+)
+
+func isNameResolutionPort(traffic *gnet.NetTraffic, port int) bool {
+	return traffic.SrcPort == port || traffic.DstPort == port
+}
+
+func decodeNameResolution(traffic *gnet.NetTraffic, protocol gnet.NameResolutionProtocol) {
+	var dns layers.DNS
+	if err := dns.DecodeFromBytes(traffic.Payload, gopacket.NilDecodeFeedback); err != nil {
+		return
+	}
+	traffic.LayerType = string(protocol)
+	traffic.Content = gnet.FromDNS(&dns, protocol)
+}
@@ -1,10 +1,14 @@
 package pcap
 
 import (
+	"sync/atomic"
+	"time"
+
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/reassembly"
 	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/tlsdecrypt"
 )
 
 // Internal implementation of reassembly.AssemblerContext that include TCP
@@ -12,14 +16,29 @@ import (
 type assemblerCtxWithSeq struct {
 	ci       gopacket.CaptureInfo
 	seq, ack reassembly.Sequence
+
+	// IP version and TTL (or hop limit) of the packet, for OS fingerprinting.
+	ipVersion int
+	ttl       uint8
+
+	// Tunnels the packet was decapsulated from, and its VLAN IDs.
+	tunnels []gnet.Tunnel
+	vlans   []uint16
 }
 
 func contextFromTCPPacket(p gopacket.Packet, t *layers.TCP) *assemblerCtxWithSeq {
-	return &assemblerCtxWithSeq{
+	ctx := &assemblerCtxWithSeq{
 		ci:  p.Metadata().CaptureInfo,
 		seq: reassembly.Sequence(t.Seq),
 		ack: reassembly.Sequence(t.Ack),
 	}
+	switch ip := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		ctx.ipVersion, ctx.ttl = 4, ip.TTL
+	case *layers.IPv6:
+		ctx.ipVersion, ctx.ttl = 6, ip.HopLimit
+	}
+	return ctx
 }
 
 func (ctx *assemblerCtxWithSeq) GetCaptureInfo() gopacket.CaptureInfo {
@@ -30,17 +49,89 @@ func (ctx *assemblerCtxWithSeq) GetCaptureInfo() gopacket.CaptureInfo {
 type tcpStreamFactory struct {
 	fs      gnet.TCPParserFactorySelector
 	outChan chan<- gnet.NetTraffic
+
+	// If non-nil, TLS connections are decrypted with secrets from this key log.
+	keyLog *tlsdecrypt.KeyLog
+
+	// Whether to report TCPQualityMetrics, and how often.
+	quality         bool
+	qualityInterval time.Duration
+
+	// How long a parser may go without a result. 0 for no limit.
+	parserTimeout time.Duration
+
+	// Streams not yet finished, if parserTimeout is set, so that parsers of
+	// stalled streams can be abandoned.
+	timeouts map[*tcpStream]struct{}
+
+	panics *panicReporter
+
+	portHints   gnet.TCPParserFactoryHints
+	reselection gnet.ReselectionPolicy
+
+	// Nil unless the number of streams is limited.
+	lru *streamLRU
+
+	// Names of the interfaces captured from, by InterfaceIndex.
+	interfaces []string
+
+	counters *parserCounters
+	logger   gnet.Logger
 }
 
 func newTCPStreamFactory(outChan chan<- gnet.NetTraffic,
 	fs gnet.TCPParserFactorySelector) *tcpStreamFactory {
 	return &tcpStreamFactory{
-		fs:      fs,
-		outChan: outChan,
+		fs:       fs,
+		outChan:  outChan,
+		counters: &parserCounters{},
+		logger:   gnet.NopLogger,
 	}
 }
 
 func (fact *tcpStreamFactory) New(netFlow, tcpFlow gopacket.Flow, _ *layers.TCP,
-	_ reassembly.AssemblerContext) reassembly.Stream {
-	return newTCPStream(netFlow, fact.outChan, fact.fs)
+	ac reassembly.AssemblerContext) reassembly.Stream {
+	s := newTCPStream(netFlow, fact.outChan, fact.fs)
+	s.tcpFlow = tcpFlow
+	s.counters = fact.counters
+	s.logger = fact.logger
+	s.parserTimeout = fact.parserTimeout
+	s.panics = fact.panics
+	s.portHints = fact.portHints
+	s.reselection = fact.reselection
+	if ac != nil {
+		s.ifaceIndex = ac.GetCaptureInfo().InterfaceIndex
+		s.iface = interfaceName(fact.interfaces, s.ifaceIndex)
+	}
+	if ctx, ok := ac.(*assemblerCtxWithSeq); ok {
+		s.tunnels, s.vlans = ctx.tunnels, ctx.vlans
+	}
+	if fact.quality {
+		s.quality = newQualityTracker(fact.qualityInterval)
+	}
+	if fact.keyLog != nil {
+		s.tlsSession = tlsdecrypt.NewSession(fact.keyLog)
+	}
+	if fact.parserTimeout > 0 {
+		if fact.timeouts == nil {
+			fact.timeouts = map[*tcpStream]struct{}{}
+		}
+		fact.timeouts[s] = struct{}{}
+		s.timeouts = fact.timeouts
+	}
+	if fact.lru != nil {
+		s.closeSeq = map[reassembly.TCPFlowDirection]reassembly.Sequence{}
+	}
+	fact.lru.add(s)
+	atomic.AddUint64(&fact.counters.tcpConnectionsOpen, 1)
+	return s
+}
+
+// Abandons the parsers that have gone longer than parserTimeout without a
+// result at packet time t. Flows are otherwise only checked when they receive
+// data, which a stalled flow never does.
+func (fact *tcpStreamFactory) expireParsers(t time.Time) {
+	for s := range fact.timeouts {
+		s.expireParsers(t)
+	}
 }
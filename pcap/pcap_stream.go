@@ -1,6 +1,7 @@
 package pcap
 
 import (
+	"container/list"
 	"encoding/binary"
 	"net"
 	"sync/atomic"
@@ -11,23 +12,11 @@ import (
 	"github.com/google/gopacket/reassembly"
 	"github.com/google/uuid"
 	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/tlsdecrypt"
 	"github.com/mel2oo/go-pcap/memview"
+	"github.com/mel2oo/go-pcap/pcap/osfp"
 )
 
-// These error counters don't seem to have a comfortable home, can we somehow get them back up to the
-// normal packet counter?  They can't go in tcpFlow because that's ephemeral.
-
-// Nunmber of times we got a nil assembler context; this can happen when the payload
-// resides in a page other than the first in the reassembly buffer.
-var CountNilAssemblerContext uint64
-
-// or when we flush old data?
-var CountNilAssemblerContextAfterParse uint64
-
-// Number of times we got an assembler context of the wrong type; this probably shouldn't
-// happen at all.
-var CountBadAssemblerContextType uint64
-
 // tcpFlow represents a uni-directional flow of TCP segments along with a
 // bidirectional ID that identifies the tcpFlow in the opposite direction.
 // Writes come from TCP assembler via tcpStream, while reads come from users
@@ -41,14 +30,64 @@ type tcpFlow struct {
 
 	outChan chan<- gnet.NetTraffic
 
+	// Name of the interface the connection was first seen on, if known.
+	iface string
+	// Tunnels and VLAN IDs of the first packet of the connection.
+	tunnels []gnet.Tunnel
+	vlans   []uint16
+
+	// Shared by all streams of a TrafficParser.
+	counters *parserCounters
+	logger   gnet.Logger
+
+	// How long currentParser may go without a result, in packet time, before
+	// it is abandoned. 0 for no limit.
+	parserTimeout time.Duration
+
+	// Reports parsers that panic.
+	panics *panicReporter
+
 	factorySelector gnet.TCPParserFactorySelector
 
+	// Non-nil once the connection has switched protocols (e.g. to WebSocket).
+	// All further data is parsed by this factory instead of factorySelector.
+	upgradeFactory gnet.TCPParserFactory
+
+	// Invoked with each result parsed from this flow. Set by tcpStream.
+	onResult func(gnet.ParsedNetworkContent)
+
+	// Non-nil if TLS on this connection is being decrypted, in which case the
+	// plaintext is parsed by plaintext.
+	tls       *tlsdecrypt.Flow
+	plaintext *streamParser
+
 	// Non-nil if there is an active parser for this flow.
 	currentParser gnet.TCPParser
 
+	// The factory that created currentParser.
+	currentFactory gnet.TCPParserFactory
+
+	// The number of request-response exchanges parsed from this flow.
+	exchanges int
+
+	// Decides whether to pin the flow to the factory of its last parser. Nil
+	// to always select from all factories.
+	reselection gnet.ReselectionPolicy
+
+	// The factory tried alone for the next data, if pinned.
+	pinned gnet.TCPParserFactory
+
+	// The direction of this flow's data, and the parser shared with the flow
+	// in the opposite direction once a bidirectional factory accepts.
+	dir  gnet.FlowDirection
+	bidi *bidiParser
+
 	// Context for the FIRST packet that currentParser is processing.
 	currentParserCtx *assemblerCtxWithSeq
 
+	// The number of bytes currentParser has consumed so far.
+	currentParserBytes int64
+
 	// Data that was left unused when determining parser, awaiting for more data.
 	// This is a hack to flush data when the flow terminates before a parser has
 	// been selected since reassembled does not get invoked on stream end even if
@@ -65,6 +104,7 @@ func newTCPFlow(bidiID uuid.UUID, nf, tf gopacket.Flow,
 		bidiID:          bidiID,
 		outChan:         outChan,
 		factorySelector: fs,
+		logger:          gnet.NopLogger,
 	}
 }
 
@@ -76,9 +116,37 @@ func (f *tcpFlow) handleUnparseable(t time.Time, data []byte) {
 
 // Handles reassmbled TCP flow data.
 func (f *tcpFlow) reassembled(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	if f.tls != nil {
+		f.decrypt(sg, ac)
+	}
 	f.reassembledWithIgnore(0, sg, ac)
 }
 
+// Decrypts the data in sg that has not been seen before, and parses the
+// resulting plaintext.
+func (f *tcpFlow) decrypt(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
+	_, _, isEnd, skip := sg.Info()
+	if skip > 0 {
+		// Bytes were lost, so TLS records can no longer be delimited.
+		f.tls.Fail()
+		f.tls = nil
+		return
+	}
+
+	// Bytes kept by an earlier call with KeepFrom are delivered again.
+	bytesAvailable, saved := sg.Lengths()
+	plaintext, err := f.tls.Decrypt(sg.Fetch(bytesAvailable)[saved:])
+	if err != nil {
+		f.tls = nil
+	}
+
+	t := time.Now()
+	if ac != nil {
+		t = ac.GetCaptureInfo().Timestamp
+	}
+	f.plaintext.feed(memview.New(plaintext), t, isEnd)
+}
+
 // Ignore leading bytes from sg.
 func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGather,
 	ac reassembly.AssemblerContext) {
@@ -87,11 +155,21 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 	// Fetch returns a copy of the packet data.
 	pktData := memview.New(sg.Fetch(bytesAvailable)[ignoreCount:])
 
+	if f.bidi != nil && f.bidi.parser != nil {
+		f.parseBidi(sg.CaptureInfo(ignoreCount).Timestamp, pktData, isEnd)
+		return
+	}
+
+	if f.currentParser != nil && ac != nil && f.parserExpired(ac.GetCaptureInfo().Timestamp) {
+		f.abandonParser(ac.GetCaptureInfo().Timestamp)
+	}
+
 	if f.currentParser == nil {
 		// Try to create a new parser.
-		fact, decision, discardFront := f.factorySelector.Select(pktData, isEnd)
+		fact, decision, discardFront := f.selectFactory(pktData, isEnd)
 		if discardFront > 0 {
 			f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, pktData.Bytes())
+			f.dropped(nil)
 			pktData = pktData.SubView(discardFront, pktData.Len())
 		}
 
@@ -102,11 +180,19 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 			f.unusedAcceptBuf = pktData
 			return
 		case gnet.Reject:
+			f.logger.Debugf("no parser accepted data on connection %s", f.bidiID)
 			f.unusedAcceptBuf.Clear()
 			return
 		case gnet.Accept:
 			f.unusedAcceptBuf.Clear()
 
+			if bf, ok := fact.(gnet.TCPBidiParserFactory); ok && f.bidi != nil {
+				t := sg.CaptureInfo(ignoreCount).Timestamp
+				f.bidi.start(bf.CreateBidiParser(f.bidiID), t)
+				f.parseBidi(t, pktData, isEnd)
+				return
+			}
+
 			acForFirstByte := sg.AssemblerContext(ignoreCount + int(discardFront))
 			ctx, ok := acForFirstByte.(*assemblerCtxWithSeq)
 			if !ok {
@@ -116,28 +202,35 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 				// that we don't yet understand.
 				// So, track the error count but don't spam the log.
 				if acForFirstByte == nil {
-					atomic.AddUint64(&CountNilAssemblerContext, 1)
+					atomic.AddUint64(&f.counters.nilAssemblerContext, 1)
 				} else {
-					atomic.AddUint64(&CountBadAssemblerContextType, 1)
+					atomic.AddUint64(&f.counters.badAssemblerContextType, 1)
 				}
+				f.logger.Debugf("no usable assembler context for %s on connection %s", fact.Name(), f.bidiID)
 				f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, pktData.Bytes())
 				return
 			}
-			f.currentParser = fact.CreateParser(f.bidiID, ctx.seq, ctx.ack)
+			f.currentParser = createParser(fact, f.bidiID, ctx.seq, ctx.ack, f.exchanges)
+			f.currentFactory = fact
 			f.currentParserCtx = ctx
+			f.currentParserBytes = 0
 		default:
 			f.handleUnparseable(sg.CaptureInfo(ignoreCount).Timestamp, pktData.Bytes())
 			return
 		}
 	}
 
-	pnc, unused, _, err := f.currentParser.Parse(pktData, isEnd)
+	f.currentParserBytes += pktData.Len()
+	pnc, unused, _, err := f.panics.parse(f.currentParser, f.bidiID, pktData, isEnd)
 	if err != nil {
 		// Parser failed, return all the bytes passed to the parser so at least we
 		// can still perform leak detection on the raw bytes.
+		f.logger.Debugf("%s failed on connection %s: %v", f.currentParser.Name(), f.bidiID, err)
 		t := f.currentParserCtx.GetCaptureInfo().Timestamp
 		f.handleUnparseable(t, pktData.Bytes())
+		f.dropped(f.currentFactory)
 
+		f.reselect(nil, err)
 		f.currentParser = nil
 		f.currentParserCtx = nil
 	} else if pnc != nil {
@@ -151,11 +244,18 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 			// appear when we have called FlushCloseOlderThan, it would
 			// probably be misleading.
 			// TODO: what else can we log here to help identify what's going on?
-			atomic.AddUint64(&CountNilAssemblerContextAfterParse, 1)
+			atomic.AddUint64(&f.counters.nilAssemblerContextAfterParse, 1)
 			parseEnd = parseStart
 		}
 		f.outChan <- f.toPNT(parseStart, parseEnd, pnc, pktData.Bytes())
+		if f.onResult != nil {
+			f.onResult(pnc)
+		}
+		if endsExchange(f.currentFactory, pnc) {
+			f.exchanges++
+		}
 
+		f.reselect(pnc, nil)
 		f.currentParser = nil
 		f.currentParserCtx = nil
 
@@ -180,11 +280,89 @@ func (f *tcpFlow) reassembledWithIgnore(ignoreCount int, sg reassembly.ScatterGa
 	// }
 }
 
+// Reports whether currentParser has gone longer than parserTimeout without a
+// result at packet time t.
+func (f *tcpFlow) parserExpired(t time.Time) bool {
+	if f.parserTimeout <= 0 || f.currentParserCtx == nil {
+		return false
+	}
+	return t.Sub(f.currentParserCtx.GetCaptureInfo().Timestamp) > f.parserTimeout
+}
+
+// Gives up on currentParser at packet time t, reporting the data it consumed
+// as dropped. Parsing resumes with the next data.
+func (f *tcpFlow) abandonParser(t time.Time) {
+	atomic.AddUint64(&f.counters.parsersTimedOut, 1)
+	f.logger.Debugf("%s timed out on connection %s", f.currentParser.Name(), f.bidiID)
+	f.dropParser(t)
+}
+
+// Discards currentParser at packet time t, reporting the data it consumed as
+// dropped.
+func (f *tcpFlow) dropParser(t time.Time) {
+	// Ending the input makes the parser give up what it holds, such as
+	// pooled buffers for a body, which are released with any result.
+	pnc, _, _, _ := f.panics.parse(f.currentParser, f.bidiID, memview.MemView{}, true)
+	if pnc != nil {
+		pnc.ReleaseBuffers()
+	}
+
+	start := f.currentParserCtx.GetCaptureInfo().Timestamp
+	if f.currentParserBytes > 0 {
+		f.outChan <- f.toPNT(start, t, gnet.DroppedBytes(f.currentParserBytes), nil)
+	}
+	f.dropped(f.currentFactory)
+	f.currentParser = nil
+	f.currentParserCtx = nil
+	f.currentParserBytes = 0
+	f.pinned = nil
+}
+
+// Keeps the exchange count in step with the flow in the opposite direction
+// once data is dropped, counting a message begun by a parser of fact, if not
+// nil.
+func (f *tcpFlow) dropped(fact gnet.TCPParserFactory) {
+	peer := 0
+	if f.bidi != nil && f.bidi.flows[f.dir.Reverse()] != nil {
+		peer = f.bidi.flows[f.dir.Reverse()].exchanges
+	}
+	f.exchanges = resyncExchanges(f.dir, f.exchanges, peer, fact)
+}
+
+// Applies the reselection policy once currentParser has produced result or
+// failed with err.
+func (f *tcpFlow) reselect(result gnet.ParsedNetworkContent, err error) {
+	f.pinned = nil
+	if f.reselection != nil && f.reselection(f.currentFactory, result, err) == gnet.PinFactory {
+		f.pinned = f.currentFactory
+	}
+}
+
+func (f *tcpFlow) selectFactory(input memview.MemView, isEnd bool) (gnet.TCPParserFactory, gnet.AcceptDecision, int64) {
+	if f.pinned != nil && f.upgradeFactory == nil {
+		decision, discardFront := f.pinned.Accepts(input, isEnd)
+		switch decision {
+		case gnet.Accept:
+			return f.pinned, decision, discardFront
+		case gnet.NeedMoreData:
+			return nil, decision, discardFront
+		}
+		f.pinned = nil
+	}
+	return selectFactory(f.factorySelector, f.upgradeFactory, input, isEnd)
+}
+
 // Marks this flow as finished.
 func (f *tcpFlow) reassemblyComplete() {
-	if f.currentParser != nil {
+	if f.plaintext != nil {
+		f.plaintext.feed(memview.MemView{}, time.Now(), true)
+	}
+
+	if f.bidi != nil && f.bidi.parser != nil {
+		f.parseBidi(time.Now(), memview.MemView{}, true)
+	} else if f.currentParser != nil {
 		// We were in the middle of parsing something, give up.
-		pnc, unused, _, err := f.currentParser.Parse(memview.New(nil), true)
+		pnc, unused, _, err := f.panics.parse(f.currentParser, f.bidiID, memview.New(nil), true)
 		t := f.currentParserCtx.GetCaptureInfo().Timestamp
 		if err != nil {
 			f.handleUnparseable(t, unused.Bytes())
@@ -205,6 +383,13 @@ func (f *tcpFlow) reassemblyComplete() {
 	}
 }
 
+// Emits content parsed from the decrypted plaintext of this flow.
+func (f *tcpFlow) emitDecrypted(start, end time.Time, c gnet.ParsedNetworkContent, payload []byte) {
+	t := f.toPNT(start, end, c, payload)
+	t.LayerType = "TLS"
+	f.outChan <- t
+}
+
 func (f *tcpFlow) toPNT(firstPacketTime time.Time, lastPacketTime time.Time,
 	c gnet.ParsedNetworkContent, payload []byte) gnet.NetTraffic {
 	if firstPacketTime.IsZero() {
@@ -228,6 +413,9 @@ func (f *tcpFlow) toPNT(firstPacketTime time.Time, lastPacketTime time.Time,
 		Payload:         payload,
 		Content:         c,
 		ConnectionID:    f.bidiID,
+		Interface:       f.iface,
+		Tunnels:         f.tunnels,
+		VLANs:           f.vlans,
 		ObservationTime: firstPacketTime,
 		FinalPacketTime: lastPacketTime,
 	}
@@ -239,14 +427,76 @@ func (f *tcpFlow) toPNT(firstPacketTime time.Time, lastPacketTime time.Time,
 type tcpStream struct {
 	bidiID uuid.UUID // constant
 
-	// Network layer flow.
+	// Network and transport layer flows of the first packet.
 	netFlow gopacket.Flow
+	tcpFlow gopacket.Flow
+
+	// InterfaceIndex of the first packet, which selects its assembler when
+	// reassembling per interface.
+	ifaceIndex int
 
 	// flows is populated upon seeing the first packet.
 	flows map[reassembly.TCPFlowDirection]*tcpFlow
 
 	factorySelector gnet.TCPParserFactorySelector
 	outChan         chan<- gnet.NetTraffic
+
+	// Factories to try first by port. Not applied to decrypted TLS, which is
+	// parsed with factorySelector as is.
+	portHints gnet.TCPParserFactoryHints
+
+	reselection gnet.ReselectionPolicy
+
+	// Name of the interface the connection was first seen on, if known.
+	iface string
+	// Tunnels and VLAN IDs of the first packet of the connection.
+	tunnels []gnet.Tunnel
+	vlans   []uint16
+
+	// Shared by all streams of a TrafficParser.
+	counters *parserCounters
+	logger   gnet.Logger
+
+	// How long a parser may go without a result. 0 for no limit.
+	parserTimeout time.Duration
+
+	// The streams of the factory whose parsers may time out, which the
+	// stream leaves once finished. Nil for no limit.
+	timeouts map[*tcpStream]struct{}
+
+	// Reports parsers that panic.
+	panics *panicReporter
+
+	// Non-nil if TLS on this connection should be decrypted.
+	tlsSession *tlsdecrypt.Session
+
+	// OS fingerprints from the SYN and SYN+ACK packets, if seen.
+	initiatorOS *gnet.OSFingerprint
+	responderOS *gnet.OSFingerprint
+
+	// Summarizes the connection once reassembly completes.
+	tracker connectionTracker
+
+	// Non-nil if TCPQualityMetrics should be reported.
+	quality *qualityTracker
+
+	// The LRU the stream is tracked in, if the number of streams is limited,
+	// and its element there until it completes or is evicted.
+	lru  *streamLRU
+	elem *list.Element
+
+	// Set once the stream is evicted, after which its packets are ignored.
+	evicted bool
+
+	// Sequence numbers the assembler has reached in each direction, at which
+	// an evicted stream is closed. Only tracked if lru is non-nil.
+	closeSeq map[reassembly.TCPFlowDirection]reassembly.Sequence
+
+	// Set while an evicted stream is being closed in the assembler.
+	closing bool
+
+	// Set once the assembler has completed the stream and forgotten it.
+	completed bool
 }
 
 func newTCPStream(netFlow gopacket.Flow,
@@ -254,14 +504,30 @@ func newTCPStream(netFlow gopacket.Flow,
 	return &tcpStream{
 		bidiID:          uuid.New(),
 		netFlow:         netFlow,
+		counters:        &parserCounters{},
+		logger:          gnet.NopLogger,
 		factorySelector: fs,
 		outChan:         outChan,
 	}
 }
 
-func (c *tcpStream) Accept(tcp *layers.TCP, _ gopacket.CaptureInfo,
-	dir reassembly.TCPFlowDirection, _ reassembly.Sequence,
+func (c *tcpStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo,
+	dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence,
 	start *bool, ac reassembly.AssemblerContext) bool {
+	if c.evicted {
+		// Only the packets that close the stream are reassembled.
+		*start = c.closing
+		return c.closing
+	}
+	if c.lru != nil {
+		c.lru.touch(c)
+		if nextSeq < 0 {
+			// Invalid until the first packet in this direction.
+			nextSeq = reassembly.Sequence(tcp.Seq)
+		}
+		c.closeSeq[dir] = nextSeq
+	}
+
 	// We always force the TCP stream to start because we cannot guarantee that we
 	// will ever observe the SYN packet. For example, we could be looking at an
 	// existing connection that is actively reused by HTTP traffic. Without the
@@ -280,33 +546,90 @@ func (c *tcpStream) Accept(tcp *layers.TCP, _ gopacket.CaptureInfo,
 			layers.NewTCPPortEndpoint(tcp.SrcPort),
 			layers.NewTCPPortEndpoint(tcp.DstPort),
 		)
-		s1 := newTCPFlow(c.bidiID, c.netFlow, tf, c.outChan, c.factorySelector)
-		s2 := newTCPFlow(c.bidiID, c.netFlow.Reverse(), tf.Reverse(), c.outChan, c.factorySelector)
+		fs := c.factorySelector
+		if c.portHints != nil {
+			fs = c.portHints.Selector(fs, int(tcp.SrcPort), int(tcp.DstPort))
+		}
+		s1 := newTCPFlow(c.bidiID, c.netFlow, tf, c.outChan, fs)
+		s2 := newTCPFlow(c.bidiID, c.netFlow.Reverse(), tf.Reverse(), c.outChan, fs)
+		s1.onResult = c.checkUpgrade
+		s2.onResult = c.checkUpgrade
+		// The client sends the SYN, which is the only packet seen before a
+		// SYN+ACK.
+		bidi := &bidiParser{}
+		if tcp.SYN && tcp.ACK {
+			s1.dir, s2.dir = gnet.ServerToClient, gnet.ClientToServer
+		} else {
+			s1.dir, s2.dir = gnet.ClientToServer, gnet.ServerToClient
+		}
+		bidi.flows[s1.dir], bidi.flows[s2.dir] = s1, s2
+		s1.bidi, s2.bidi = bidi, bidi
+		for _, f := range []*tcpFlow{s1, s2} {
+			f.iface, f.tunnels, f.vlans = c.iface, c.tunnels, c.vlans
+			f.counters, f.logger = c.counters, c.logger
+			f.parserTimeout, f.panics = c.parserTimeout, c.panics
+			f.reselection = c.reselection
+		}
+		if c.tlsSession != nil {
+			tls1, tls2 := c.tlsSession.Flows()
+			c.enableDecryption(s1, tls1)
+			c.enableDecryption(s2, tls2)
+			s1.plaintext.peer, s2.plaintext.peer = s2.plaintext, s1.plaintext
+		}
 		c.flows = map[reassembly.TCPFlowDirection]*tcpFlow{
 			dir:           s1,
 			dir.Reverse(): s2,
 		}
 	}
 
+	c.tracker.observe(tcp, dir, ci.Timestamp)
+	if c.quality != nil {
+		c.quality.observe(tcp, dir == c.tracker.sourceDir, ci.Timestamp)
+	}
+
+	metadata := gnet.TCPPacketMetadata{
+		SYN: tcp.SYN,
+		ACK: tcp.ACK,
+		FIN: tcp.FIN,
+		RST: tcp.RST,
+
+		PayloadLength: len(tcp.Payload),
+		TLSRecordType: gnet.TLSRecordTypeOf(tcp.Payload),
+	}
+	if ctx, ok := ac.(*assemblerCtxWithSeq); ok && tcp.SYN {
+		fp := osfp.Fingerprint(ctx.ipVersion, ctx.ttl, tcp)
+		metadata.OS = &fp
+		if tcp.ACK {
+			c.responderOS = &fp
+		} else {
+			c.initiatorOS = &fp
+		}
+	}
+
 	// Output some metadata for the current packet.
 	srcE, dstE := c.netFlow.Endpoints()
+	if dir != c.tracker.sourceDir {
+		srcE, dstE = dstE, srcE
+	}
 
 	c.outChan <- gnet.NetTraffic{
-		LayerType:    "TCP",
-		SrcIP:        net.IP(srcE.Raw()),
-		SrcPort:      int(tcp.SrcPort),
-		DstIP:        net.IP(dstE.Raw()),
-		DstPort:      int(tcp.DstPort),
-		ConnectionID: c.bidiID,
-		Content: gnet.TCPPacketMetadata{
-			SYN: tcp.SYN,
-			ACK: tcp.ACK,
-			FIN: tcp.FIN,
-			RST: tcp.RST,
-		},
+		LayerType:       "TCP",
+		SrcIP:           net.IP(srcE.Raw()),
+		SrcPort:         int(tcp.SrcPort),
+		DstIP:           net.IP(dstE.Raw()),
+		DstPort:         int(tcp.DstPort),
+		ConnectionID:    c.bidiID,
+		Interface:       c.iface,
+		Tunnels:         c.tunnels,
+		VLANs:           c.vlans,
+		Content:         metadata,
 		ObservationTime: ac.GetCaptureInfo().Timestamp,
 	}
 
+	if c.quality != nil && c.quality.due(ci.Timestamp) {
+		c.outChan <- c.connectionTraffic(c.quality.metrics(c.bidiID, &c.tracker, false))
+	}
+
 	// Accept everything, even if the packet might violate the TCP state machine
 	// and get rejected by the client or server's TCP stack. We do this because we
 	// are interested in detecting all dataflows, not just ones from valid TCP
@@ -316,9 +639,46 @@ func (c *tcpStream) Accept(tcp *layers.TCP, _ gopacket.CaptureInfo,
 	return true
 }
 
+// Switches both flows to a new protocol if r completes an upgrade handshake.
+func (c *tcpStream) checkUpgrade(r gnet.ParsedNetworkContent) {
+	fact := c.factorySelector.SelectUpgrade(r)
+	if fact == nil {
+		return
+	}
+	for _, f := range c.flows {
+		f.upgradeFactory = fact
+	}
+}
+
+// Parses the plaintext recovered by decrypting f with t.
+func (c *tcpStream) enableDecryption(f *tcpFlow, t *tlsdecrypt.Flow) {
+	f.tls = t
+	f.plaintext = &streamParser{
+		bidiID:          c.bidiID,
+		factorySelector: c.factorySelector,
+		emit:            f.emitDecrypted,
+		dir:             f.dir,
+		panics:          c.panics,
+		onResult:        c.checkDecryptedUpgrade,
+	}
+}
+
+// Like checkUpgrade, but for the protocols carried inside TLS.
+func (c *tcpStream) checkDecryptedUpgrade(r gnet.ParsedNetworkContent) {
+	fact := c.factorySelector.SelectUpgrade(r)
+	if fact == nil {
+		return
+	}
+	for _, f := range c.flows {
+		if f.plaintext != nil {
+			f.plaintext.upgradeFactory = fact
+		}
+	}
+}
+
 // Handles reassmbled TCP stream data.
 func (c *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.AssemblerContext) {
-	if c.flows == nil {
+	if c.flows == nil || c.evicted {
 		return
 	}
 	dir, _, _, _ := sg.Info()
@@ -326,10 +686,73 @@ func (c *tcpStream) ReassembledSG(sg reassembly.ScatterGather, ac reassembly.Ass
 }
 
 func (c *tcpStream) ReassemblyComplete(_ reassembly.AssemblerContext) bool {
-	for _, s := range c.flows {
-		s.reassemblyComplete()
+	if !c.evicted {
+		c.lru.remove(c)
+		c.finish()
 	}
+	c.completed = true
 
 	// Remove connection from the pool
 	return true
 }
+
+// Ends the parsing of both flows and outputs what is known of the connection.
+func (c *tcpStream) finish() {
+	atomic.AddUint64(&c.counters.tcpConnectionsOpen, ^uint64(0))
+	delete(c.timeouts, c)
+	for _, s := range c.flows {
+		s.reassemblyComplete()
+	}
+	if c.flows != nil {
+		c.emitConnectionMetadata()
+		if c.quality != nil {
+			c.outChan <- c.connectionTraffic(c.quality.metrics(c.bidiID, &c.tracker, true))
+		}
+	}
+}
+
+// Finishes the connection early to make room for a newer one. Its packets are
+// ignored until closeEvicted removes it from the assembler.
+func (c *tcpStream) evict() {
+	atomic.AddUint64(&c.counters.tcpConnectionsEvicted, 1)
+	c.logger.Debugf("evicted connection %s", c.bidiID)
+	c.evicted = true
+	c.finish()
+	c.outChan <- c.connectionTraffic(gnet.ConnectionEvicted{ConnectionID: c.bidiID})
+}
+
+// Abandons the parsers of both flows that have gone longer than the parser
+// timeout without a result at packet time t, even if their flows are stalled.
+func (c *tcpStream) expireParsers(t time.Time) {
+	for _, f := range c.flows {
+		if f.currentParser != nil && f.parserExpired(t) {
+			f.abandonParser(t)
+		}
+	}
+}
+
+// Outputs the summary of the connection.
+func (c *tcpStream) emitConnectionMetadata() {
+	m := c.tracker.metadata(c.bidiID)
+	m.InitiatorOS, m.ResponderOS = c.initiatorOS, c.responderOS
+	c.outChan <- c.connectionTraffic(m)
+}
+
+// Wraps content about the whole connection, oriented like its first packet.
+func (c *tcpStream) connectionTraffic(content gnet.ParsedNetworkContent) gnet.NetTraffic {
+	srcE, dstE := c.netFlow.Endpoints()
+	return gnet.NetTraffic{
+		LayerType:       "TCP",
+		SrcIP:           net.IP(srcE.Raw()),
+		SrcPort:         int(c.tracker.srcPort),
+		DstIP:           net.IP(dstE.Raw()),
+		DstPort:         int(c.tracker.dstPort),
+		ConnectionID:    c.bidiID,
+		Interface:       c.iface,
+		Tunnels:         c.tunnels,
+		VLANs:           c.vlans,
+		Content:         content,
+		ObservationTime: c.tracker.first,
+		FinalPacketTime: c.tracker.last,
+	}
+}
@@ -0,0 +1,98 @@
+package pcap
+
+import (
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Accumulates the TCPQualityMetrics of a connection. Retransmissions and
+// out-of-order segments are counted by the connectionTracker of the stream.
+type qualityTracker struct {
+	// How often metrics are reported while the connection is active, in
+	// packet time. 0 to report only when the connection completes.
+	interval   time.Duration
+	lastReport time.Time
+
+	synTime       time.Time
+	synFromSource bool
+	rtt           time.Duration
+
+	// Indexed like connectionTracker.dirs.
+	dirs [2]qualityDirection
+}
+
+type qualityDirection struct {
+	stats gnet.TCPQualityStats
+
+	// The acknowledgement and window of the last ACK sent.
+	ackSeen    bool
+	lastAck    uint32
+	lastWindow uint16
+}
+
+func newQualityTracker(interval time.Duration) *qualityTracker {
+	return &qualityTracker{interval: interval}
+}
+
+func (q *qualityTracker) observe(tcp *layers.TCP, fromSource bool, ts time.Time) {
+	if q.lastReport.IsZero() {
+		q.lastReport = ts
+	}
+
+	if tcp.SYN && !tcp.ACK && q.synTime.IsZero() {
+		q.synTime, q.synFromSource = ts, fromSource
+	} else if tcp.SYN && tcp.ACK && q.rtt == 0 && !q.synTime.IsZero() && fromSource != q.synFromSource {
+		q.rtt = ts.Sub(q.synTime)
+	}
+
+	d := &q.dirs[1]
+	if fromSource {
+		d = &q.dirs[0]
+	}
+	if tcp.RST {
+		return
+	}
+	if tcp.Window == 0 && !tcp.SYN {
+		d.stats.ZeroWindows++
+	}
+	if !tcp.ACK {
+		return
+	}
+
+	// Repeated ACKs of a zero window are window probes, not duplicates.
+	pure := len(tcp.Payload) == 0 && !tcp.SYN && !tcp.FIN
+	if pure && d.ackSeen && tcp.Ack == d.lastAck && tcp.Window == d.lastWindow && tcp.Window != 0 {
+		d.stats.DuplicateACKs++
+	}
+	d.ackSeen = true
+	d.lastAck, d.lastWindow = tcp.Ack, tcp.Window
+}
+
+// Reports whether periodic metrics are due at ts, and if so, restarts the
+// period.
+func (q *qualityTracker) due(ts time.Time) bool {
+	if q.interval <= 0 || ts.Sub(q.lastReport) < q.interval {
+		return false
+	}
+	q.lastReport = ts
+	return true
+}
+
+func (q *qualityTracker) metrics(id uuid.UUID, conn *connectionTracker, final bool) gnet.TCPQualityMetrics {
+	m := gnet.TCPQualityMetrics{
+		ConnectionID: id,
+		HandshakeRTT: q.rtt,
+		SourceToDest: q.dirs[0].stats,
+		DestToSource: q.dirs[1].stats,
+		Final:        final,
+	}
+	m.SourceToDest.Retransmissions = conn.dirs[0].stats.Retransmissions
+	m.SourceToDest.OutOfOrder = conn.dirs[0].stats.OutOfOrder
+	m.DestToSource.Retransmissions = conn.dirs[1].stats.Retransmissions
+	m.DestToSource.OutOfOrder = conn.dirs[1].stats.OutOfOrder
+	return m
+}
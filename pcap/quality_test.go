@@ -0,0 +1,82 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestParseTCPQualityMetrics(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	start := time.Unix(1700000000, 0)
+
+	segment := func(fromClient bool, tcp layers.TCP, payload string, offset time.Duration) gopacket.Packet {
+		src, dst, srcPort, dstPort := client, server, 40000, 80
+		if !fromClient {
+			src, dst, srcPort, dstPort = server, client, 80, 40000
+		}
+		eth, ip, l := createPacketLayers(src, dst, srcPort, dstPort, tcp.Seq)
+		tcp.SrcPort, tcp.DstPort = l.SrcPort, l.DstPort
+		tcp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+			eth, ip, &tcp, gopacket.Payload(payload))
+		assert.NoError(t, err)
+		p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+		p.Metadata().Timestamp = start.Add(offset)
+		return p
+	}
+	ms := time.Millisecond
+	packets := []gopacket.Packet{
+		segment(true, layers.TCP{SYN: true, Seq: 100, Window: 1000}, "", 0),
+		segment(false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101, Window: 1000}, "", 40*ms),
+		segment(true, layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, "", 80*ms),
+		segment(true, layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, "hello", 3000*ms),
+		segment(true, layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, "hello", 3100*ms),
+		segment(false, layers.TCP{ACK: true, Seq: 501, Ack: 106, Window: 1000}, "", 3200*ms),
+		segment(false, layers.TCP{ACK: true, Seq: 501, Ack: 106, Window: 1000}, "", 3300*ms),
+		segment(false, layers.TCP{ACK: true, Seq: 501, Ack: 106, Window: 0}, "", 3400*ms),
+	}
+
+	opts := NewOptions()
+	WithTCPQualityMetrics(2 * time.Second)(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var metrics []gnet.TCPQualityMetrics
+	for c := range out {
+		if m, ok := c.Content.(gnet.TCPQualityMetrics); ok {
+			metrics = append(metrics, m)
+			assert.True(t, client.Equal(c.SrcIP))
+		}
+	}
+	if !assert.Len(t, metrics, 2) {
+		return
+	}
+
+	// Reported once 2 seconds have passed, and when the connection completes.
+	assert.False(t, metrics[0].Final)
+	assert.Equal(t, 40*ms, metrics[0].HandshakeRTT)
+	assert.Equal(t, int64(0), metrics[0].SourceToDest.Retransmissions)
+
+	final := metrics[1]
+	assert.True(t, final.Final)
+	assert.Equal(t, 40*ms, final.HandshakeRTT)
+	assert.Equal(t, gnet.TCPQualityStats{Retransmissions: 1}, final.SourceToDest)
+	assert.Equal(t, gnet.TCPQualityStats{DuplicateACKs: 1, ZeroWindows: 1}, final.DestToSource)
+}
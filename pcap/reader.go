@@ -2,25 +2,66 @@ package pcap
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/gopacket"
-	_ "github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/layers"
 )
 
 const (
 	// The same default as tcpdump.
-	defaultSnapLen = 262144
+	DefaultSnapLen = 262144
+
+	// Let libpcap buffer packets for as long as readers allow, which is
+	// capturePollTimeout.
+	DefaultCaptureTimeout = blockForever
+
+	// How long live readers wait for packets before checking whether capture
+	// was cancelled.
+	capturePollTimeout = 100 * time.Millisecond
 )
 
 type PcapReader interface {
 	Capture(ctx context.Context) (<-chan gopacket.Packet, error)
+
+	// Statistics of the current or last capture.
+	Stats() CaptureStats
+}
+
+// An open file or device, from libpcap or, in builds without it, pcapgo.
+type captureHandle interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+	SetBPFFilter(expr string) error
+	captureStats() (CaptureStats, error)
+	Close()
 }
 
 // Read packet from pcap file.
 type FileReader struct {
 	PcapFile string
 	BPFilter string
+
+	// If positive, packets are delivered at the pace they were captured at,
+	// sped up by this factor: 1 for real time, 10 for ten times faster. By
+	// default, packets are delivered as fast as they can be read.
+	ReplaySpeed float64
+
+	// Packets skipped at the start of the file without being decoded, as when
+	// resuming from a Checkpoint.
+	Skip uint64
+
+	// Paces packets across several files, if set. See MultiFileReader.
+	pacer *replayPacer
+
+	// Packets read from the file. Accessed atomically.
+	received uint64
+
+	handle liveHandle
 }
 
 func NewFileReader(pcapfile, bpfilter string) *FileReader {
@@ -30,11 +71,13 @@ func NewFileReader(pcapfile, bpfilter string) *FileReader {
 	}
 }
 
-func (f FileReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
-	handle, err := pcap.OpenOffline(f.PcapFile)
+func (f *FileReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	handle, err := openOffline(f.PcapFile)
 	if err != nil {
 		return nil, err
 	}
+	atomic.StoreUint64(&f.received, 0)
+	f.handle.set(handle)
 
 	if len(f.BPFilter) > 0 {
 		if err := handle.SetBPFFilter(f.BPFilter); err != nil {
@@ -47,9 +90,31 @@ func (f FileReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error)
 
 	go func() {
 		defer handle.Close()
+		defer f.handle.set(nil)
 		defer close(out)
-		packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-		for packet := range packetSource.Packets() {
+		pacer := f.pacer
+		if pacer == nil && f.ReplaySpeed > 0 {
+			pacer = newReplayPacer(f.ReplaySpeed)
+		}
+
+		for i := uint64(0); i < f.Skip && ctx.Err() == nil; i++ {
+			if _, _, err := handle.ReadPacketData(); err != nil {
+				return
+			}
+		}
+
+		// Unlike with PacketSource.Packets, no goroutine is left reading from
+		// the handle once it is closed.
+		packetSource := gopacket.NewPacketSource(handle, decoderFor(handle.LinkType()))
+		for ctx.Err() == nil {
+			packet, err := packetSource.NextPacket()
+			if err != nil {
+				return
+			}
+			atomic.AddUint64(&f.received, 1)
+			if pacer != nil && !pacer.wait(ctx, packet.Metadata().Timestamp) {
+				return
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -61,21 +126,50 @@ func (f FileReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error)
 	return out, nil
 }
 
+// Replaces the filter, also for the rest of a file being read.
+func (f *FileReader) SetBPFFilter(expr string) error {
+	if err := f.handle.setBPFFilter(expr); err != nil {
+		return err
+	}
+	f.BPFilter = expr
+	return nil
+}
+
+// Files have no kernel or interface drops, so only packets read are counted.
+func (f *FileReader) Stats() CaptureStats {
+	return CaptureStats{PacketsReceived: atomic.LoadUint64(&f.received)}
+}
+
 // Read packet from real device.
 type DeviceReader struct {
 	DeviceName string
 	BPFilter   string
+
+	// Maximum number of bytes captured per packet.
+	SnapLen int32
+	// Put the device in promiscuous mode.
+	Promiscuous bool
+	// How long libpcap buffers packets before delivering them, at most
+	// capturePollTimeout, so that cancellation is noticed even when no packets
+	// arrive.
+	Timeout time.Duration
+
+	stats  handleStats
+	handle liveHandle
 }
 
 func NewDeviceReader(devicename, bpfilter string) *DeviceReader {
 	return &DeviceReader{
-		DeviceName: devicename,
-		BPFilter:   bpfilter,
+		DeviceName:  devicename,
+		BPFilter:    bpfilter,
+		SnapLen:     DefaultSnapLen,
+		Promiscuous: true,
+		Timeout:     DefaultCaptureTimeout,
 	}
 }
 
-func (d DeviceReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
-	handle, err := pcap.OpenLive(d.DeviceName, defaultSnapLen, true, pcap.BlockForever)
+func (d *DeviceReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	handle, err := openLive(d.DeviceName, d.SnapLen, d.Promiscuous, pollTimeout(d.Timeout))
 	if err != nil {
 		return nil, err
 	}
@@ -87,32 +181,183 @@ func (d DeviceReader) Capture(ctx context.Context) (<-chan gopacket.Packet, erro
 		}
 	}
 
-	// Creating the packet source takes some time - do it here so the caller can
-	// be confident that pakcets are being watched after this function returns.
-	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	packetChan := packetSource.Packets()
+	d.handle.set(handle)
+	d.stats.open(handle.captureStats)
 
-	// Tune the packet channel buffer
+	packetSource := gopacket.NewPacketSource(handle, decoderFor(handle.LinkType()))
 	out := make(chan gopacket.Packet, 10)
 	go func() {
-		// Closing the handle can take a long time, so we close wrappedChan first to
-		// allow the packet consumer to advance with its processing logic while we
-		// wait for the handle to close in this goroutine.
+		// Closing the handle can take a long time, so out is closed first to
+		// let the consumer finish its processing in the meantime.
 		defer handle.Close()
+		defer d.stats.close()
+		defer d.handle.set(nil)
 		defer close(out)
 
 		for {
+			// Reads time out regularly so that cancellation is noticed even
+			// when no packets arrive.
+			pkt, err := packetSource.NextPacket()
+			if isReadTimeout(err) {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			} else if err != nil {
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				return
-			case pkt, ok := <-packetChan:
-				if !ok {
-					return
-				}
-				out <- pkt
+			case out <- pkt:
 			}
 		}
 	}()
 
 	return out, nil
 }
+
+// Returns the libpcap timeout for a capture timeout of t, so that reads return
+// at least every capturePollTimeout.
+func pollTimeout(t time.Duration) time.Duration {
+	if t <= 0 || t > capturePollTimeout {
+		return capturePollTimeout
+	}
+	return t
+}
+
+// Replaces the filter, also on the capture in progress, if any.
+func (d *DeviceReader) SetBPFFilter(expr string) error {
+	if err := d.handle.setBPFFilter(expr); err != nil {
+		return err
+	}
+	d.BPFilter = expr
+	return nil
+}
+
+// Statistics of the live capture, as reported by libpcap.
+func (d *DeviceReader) Stats() CaptureStats {
+	return d.stats.get()
+}
+
+// Read packets from several devices at once. The InterfaceIndex in the
+// CaptureInfo of each packet is the index of its device in Interfaces.
+type MultiDeviceReader struct {
+	// Devices to capture from. If empty, every device that can be opened is
+	// used.
+	DeviceNames []string
+	BPFilter    string
+
+	// Capture settings of every device, as in DeviceReader.
+	SnapLen     int32
+	Promiscuous bool
+	Timeout     time.Duration
+
+	// Devices being captured from, and their readers, set by Capture.
+	interfaces []string
+	readers    []*DeviceReader
+}
+
+func NewMultiDeviceReader(devicenames []string, bpfilter string) *MultiDeviceReader {
+	return &MultiDeviceReader{
+		DeviceNames: devicenames,
+		BPFilter:    bpfilter,
+		SnapLen:     DefaultSnapLen,
+		Promiscuous: true,
+		Timeout:     DefaultCaptureTimeout,
+	}
+}
+
+func (d *MultiDeviceReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	names := d.DeviceNames
+	all := len(names) == 0
+	if all {
+		var err error
+		if names, err = findAllDevs(); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var ins []<-chan gopacket.Packet
+	d.interfaces, d.readers = nil, nil
+	for _, name := range names {
+		r := NewDeviceReader(name, d.BPFilter)
+		r.SnapLen, r.Promiscuous, r.Timeout = d.SnapLen, d.Promiscuous, d.Timeout
+		in, err := r.Capture(ctx)
+		if err != nil {
+			// Some devices, such as USB or Bluetooth monitors, cannot carry
+			// IP traffic or be opened without privileges. Skip them.
+			if all {
+				continue
+			}
+			cancel()
+			return nil, fmt.Errorf("failed to capture from %s: %w", name, err)
+		}
+		d.interfaces = append(d.interfaces, name)
+		d.readers = append(d.readers, r)
+		ins = append(ins, in)
+	}
+	if len(ins) == 0 {
+		cancel()
+		return nil, errors.New("no device could be opened for capture")
+	}
+
+	out := make(chan gopacket.Packet, 10*len(ins))
+	var wg sync.WaitGroup
+	for i, in := range ins {
+		wg.Add(1)
+		go func(index int, in <-chan gopacket.Packet) {
+			defer wg.Done()
+			for pkt := range in {
+				if md := pkt.Metadata(); md != nil {
+					md.InterfaceIndex = index
+				}
+				select {
+				case <-ctx.Done():
+				case out <- pkt:
+				}
+			}
+		}(i, in)
+	}
+	go func() {
+		defer cancel()
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
+}
+
+// Names of the devices being captured from, in order of InterfaceIndex. Only
+// valid once Capture has returned.
+func (d *MultiDeviceReader) Interfaces() []string {
+	return d.interfaces
+}
+
+// Sum of the statistics of all devices. Only valid once Capture has returned.
+func (d *MultiDeviceReader) Stats() CaptureStats {
+	var st CaptureStats
+	for _, r := range d.readers {
+		st = st.add(r.Stats())
+	}
+	return st
+}
+
+// Replaces the filter on every device. The filter is first checked against
+// the link type of each device, so that it is installed on all or none.
+func (d *MultiDeviceReader) SetBPFFilter(expr string) error {
+	for _, r := range d.readers {
+		if err := r.handle.validate(expr); err != nil {
+			return fmt.Errorf("%s: %w", r.DeviceName, err)
+		}
+	}
+	for _, r := range d.readers {
+		if err := r.SetBPFFilter(expr); err != nil {
+			return fmt.Errorf("%s: %w", r.DeviceName, err)
+		}
+	}
+	d.BPFilter = expr
+	return nil
+}
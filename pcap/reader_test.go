@@ -0,0 +1,184 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Replays packets as if captured from the named interfaces.
+type fakeMultiReader struct {
+	names   []string
+	packets []gopacket.Packet
+}
+
+func (r fakeMultiReader) Capture(context.Context) (<-chan gopacket.Packet, error) {
+	out := make(chan gopacket.Packet, len(r.packets))
+	for _, p := range r.packets {
+		out <- p
+	}
+	close(out)
+	return out, nil
+}
+
+func (r fakeMultiReader) Interfaces() []string {
+	return r.names
+}
+
+func (r fakeMultiReader) Stats() CaptureStats {
+	return CaptureStats{PacketsReceived: uint64(len(r.packets))}
+}
+
+func parseInterfaces(t *testing.T, opts Options) []gnet.NetTraffic {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i := 0; i < 2; i++ {
+		// The same connection, seen on both interfaces.
+		p := CreateTCPSYN(client, server, 40000, 80, 1)
+		p.Metadata().Timestamp = time.Unix(1700000000, 0)
+		p.Metadata().InterfaceIndex = i
+		packets = append(packets, p)
+	}
+
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{names: []string{"eth0", "eth1"}, packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var metadata []gnet.NetTraffic
+	for c := range out {
+		if _, ok := c.Content.(gnet.TCPPacketMetadata); ok {
+			metadata = append(metadata, c)
+		}
+	}
+
+	st := p.Stats()
+	assert.Equal(t, uint64(2), st.PacketsReceived)
+	assert.Equal(t, uint64(2), st.PacketsProcessed)
+	assert.Equal(t, uint64(2*len(packets[0].Data())), st.BytesProcessed)
+	return metadata
+}
+
+func TestParseInterfaces(t *testing.T) {
+	metadata := parseInterfaces(t, NewOptions())
+	if assert.Len(t, metadata, 2) {
+		// Both packets belong to the stream created on the first interface.
+		assert.Equal(t, metadata[0].ConnectionID, metadata[1].ConnectionID)
+		assert.Equal(t, "eth0", metadata[0].Interface)
+		assert.Equal(t, "eth0", metadata[1].Interface)
+	}
+
+	opts := NewOptions()
+	opts.PerInterfaceAssembly = true
+	metadata = parseInterfaces(t, opts)
+	if assert.Len(t, metadata, 2) {
+		assert.NotEqual(t, metadata[0].ConnectionID, metadata[1].ConnectionID)
+		assert.NotEqual(t, uuid.Nil, metadata[1].ConnectionID)
+		assert.Equal(t, "eth0", metadata[0].Interface)
+		assert.Equal(t, "eth1", metadata[1].Interface)
+	}
+}
+
+func TestLiveCaptureOptions(t *testing.T) {
+	p, err := NewTrafficParser(
+		WithReadName("eth0", true),
+		WithSnapLen(128),
+		WithPromiscuous(false),
+		WithCaptureTimeout(time.Second),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if r, ok := p.reader.(*DeviceReader); assert.True(t, ok) {
+		assert.Equal(t, int32(128), r.SnapLen)
+		assert.False(t, r.Promiscuous)
+		assert.Equal(t, time.Second, r.Timeout)
+	}
+
+	p, err = NewTrafficParser(WithInterfaces("eth0", "eth1"), WithPromiscuous(false))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if r, ok := p.reader.(*MultiDeviceReader); assert.True(t, ok) {
+		assert.Equal(t, []string{"eth0", "eth1"}, r.DeviceNames)
+		assert.Equal(t, int32(DefaultSnapLen), r.SnapLen)
+		assert.False(t, r.Promiscuous)
+	}
+}
+
+func TestCaptureLimits(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i := 0; i < 5; i++ {
+		packets = append(packets, CreateTCPSYN(client, server, 40000+i, 80, 1))
+	}
+	size := uint64(len(packets[0].Data()))
+
+	for _, tc := range []struct {
+		name string
+		opt  Option
+		want uint64
+	}{
+		{"packets", WithMaxPackets(2), 2},
+		{"bytes", WithMaxBytes(3*size - 1), 3},
+	} {
+		opts := NewOptions()
+		tc.opt(&opts)
+		p := &TrafficParser{
+			opts:     opts,
+			reader:   fakeMultiReader{packets: packets},
+			outchan:  make(chan gnet.NetTraffic, 100),
+			counters: &parserCounters{},
+		}
+		out, err := p.Parse(context.Background())
+		if !assert.NoError(t, err) {
+			return
+		}
+		for range out {
+		}
+		assert.Equal(t, tc.want, p.Stats().PacketsProcessed, tc.name)
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	assert.Equal(t, capturePollTimeout, pollTimeout(DefaultCaptureTimeout))
+	assert.Equal(t, capturePollTimeout, pollTimeout(time.Second))
+	assert.Equal(t, 10*time.Millisecond, pollTimeout(10*time.Millisecond))
+}
+
+func TestFileReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewFileReader("../testdata/simple_http_two_with_noise.pcap", "")
+	out, err := r.Capture(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	<-out
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range out {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("capture did not stop once cancelled")
+	}
+}
@@ -0,0 +1,53 @@
+package pcap
+
+import (
+	"context"
+	"time"
+)
+
+// Paces the delivery of packets read from a file so that they are spaced as
+// they were when captured, sped up or slowed down by a factor.
+type replayPacer struct {
+	speed float64
+
+	// Capture time of the first packet, and the time it was delivered.
+	first   time.Time
+	started time.Time
+}
+
+func newReplayPacer(speed float64) *replayPacer {
+	return &replayPacer{speed: speed}
+}
+
+// Returns how long to wait at now before delivering a packet captured at t.
+func (r *replayPacer) delay(t, now time.Time) time.Duration {
+	if r.started.IsZero() {
+		r.first, r.started = t, now
+		return 0
+	}
+
+	// Packets out of timestamp order are delivered immediately.
+	due := r.started.Add(time.Duration(float64(t.Sub(r.first)) / r.speed))
+	if d := due.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Waits until a packet captured at t is due. Returns false if ctx is done
+// first.
+func (r *replayPacer) wait(ctx context.Context, t time.Time) bool {
+	d := r.delay(t, time.Now())
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,35 @@
+package pcap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayPacer(t *testing.T) {
+	captured := time.Unix(1700000000, 0)
+	now := time.Unix(1800000000, 0)
+
+	p := newReplayPacer(2)
+	assert.Equal(t, time.Duration(0), p.delay(captured, now))
+
+	// 10s later in the capture is 5s later at twice the speed.
+	assert.Equal(t, 5*time.Second, p.delay(captured.Add(10*time.Second), now))
+	assert.Equal(t, 3*time.Second, p.delay(captured.Add(10*time.Second), now.Add(2*time.Second)))
+
+	// Late and out-of-order packets are not delayed.
+	assert.Equal(t, time.Duration(0), p.delay(captured.Add(10*time.Second), now.Add(6*time.Second)))
+	assert.Equal(t, time.Duration(0), p.delay(captured.Add(-time.Second), now))
+}
+
+func TestReplayPacerCancel(t *testing.T) {
+	captured := time.Unix(1700000000, 0)
+	p := newReplayPacer(1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.True(t, p.wait(ctx, captured))
+	cancel()
+	assert.False(t, p.wait(ctx, captured.Add(time.Hour)))
+}
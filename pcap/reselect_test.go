@@ -0,0 +1,85 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	ghttp "github.com/mel2oo/go-pcap/gnet/http"
+	"github.com/mel2oo/go-pcap/mempool"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// Rejects everything, counting the calls to Accepts.
+type rejectingParserFactory struct {
+	calls *int
+}
+
+func (rejectingParserFactory) Name() string { return "Rejecting Parser Factory" }
+
+func (f rejectingParserFactory) Accepts(input memview.MemView, _ bool) (gnet.AcceptDecision, int64) {
+	*f.calls++
+	return gnet.Reject, input.Len()
+}
+
+func (rejectingParserFactory) CreateParser(uuid.UUID, reassembly.Sequence, reassembly.Sequence) gnet.TCPParser {
+	return nil
+}
+
+func TestReselectionPolicy(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	seq := uint32(101)
+	packets = append(packets, CreateTCPSYN(client, server, 40000, 80, 100))
+	for _, path := range []string{"/a", "/b", "/c"} {
+		req := []byte("GET " + path + " HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		packets = append(packets, CreatePacketWithSeq(client, server, 40000, 80, req, seq))
+		seq += uint32(len(req))
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = time.Unix(1700000000, 0).Add(time.Duration(i) * time.Millisecond)
+	}
+
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	run := func(policy gnet.ReselectionPolicy) (requests, calls int) {
+		opts := NewOptions()
+		opts.ReselectionPolicy = policy
+		p := &TrafficParser{
+			opts:     opts,
+			reader:   fakeMultiReader{packets: packets},
+			outchan:  make(chan gnet.NetTraffic, 100),
+			counters: &parserCounters{},
+		}
+		out, err := p.Parse(context.Background(),
+			rejectingParserFactory{calls: &calls}, ghttp.NewHTTPRequestParserFactory(pool))
+		if !assert.NoError(t, err) {
+			return 0, 0
+		}
+		for tr := range out {
+			if _, ok := tr.Content.(gnet.HTTPRequest); ok {
+				requests++
+			}
+			tr.Content.ReleaseBuffers()
+		}
+		return requests, calls
+	}
+
+	// Selection also runs for the empty segment of the SYN.
+	requests, calls := run(nil)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 4, calls)
+
+	requests, calls = run(gnet.PinUntilUpgrade)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, 2, calls)
+}
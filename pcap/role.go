@@ -0,0 +1,184 @@
+package pcap
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// The most connections whose client is remembered from their SYN. The oldest
+// are forgotten first.
+const maxRoleConnections = 65536
+
+// Ports from this one up are assumed to be ephemeral, i.e. chosen by a client,
+// when the other endpoint uses a lower one.
+const ephemeralPortStart = 32768
+
+// Returns the addresses of the named network interfaces, or of all interfaces
+// of the host if no names are given.
+func InterfaceAddrs(names ...string) ([]net.IP, error) {
+	var ifaces []net.Interface
+	if len(names) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+		}
+		ifaces = all
+	} else {
+		for _, name := range names {
+			iface, err := net.InterfaceByName(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find network interface %s: %w", name, err)
+			}
+			ifaces = append(ifaces, *iface)
+		}
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get addresses of %s: %w", iface.Name, err)
+		}
+		for _, addr := range addrs {
+			switch a := addr.(type) {
+			case *net.IPNet:
+				ips = append(ips, a.IP)
+			case *net.IPAddr:
+				ips = append(ips, a.IP)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// Sets the LocalRole of traffic with one local endpoint. The client of a TCP
+// connection is the sender of its SYN, or the receiver of its SYN+ACK. Other
+// traffic, and connections whose handshake was missed, fall back on ports: a
+// port below 1024, or failing that below ephemeralPortStart, is taken to be
+// the server's.
+//
+// Not safe for concurrent use.
+type roleTagger struct {
+	local map[string]bool
+
+	// The client endpoint of connections whose handshake was seen.
+	clients map[uuid.UUID]endpoint
+	// Keys of clients, oldest first.
+	order []uuid.UUID
+}
+
+type endpoint struct {
+	ip   string
+	port int
+}
+
+func newRoleTagger(local []net.IP) *roleTagger {
+	r := &roleTagger{
+		local:   make(map[string]bool, len(local)),
+		clients: map[uuid.UUID]endpoint{},
+	}
+	for _, ip := range local {
+		r.local[string(ip.To16())] = true
+	}
+	return r
+}
+
+// Passes through all traffic from in, with its LocalRole set.
+func (r *roleTagger) run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			r.tag(&t)
+			out <- t
+		}
+	}()
+	return out
+}
+
+func (r *roleTagger) tag(t *gnet.NetTraffic) {
+	srcIsClient, known := r.sourceIsClient(t)
+
+	srcLocal, dstLocal := r.isLocal(t.SrcIP), r.isLocal(t.DstIP)
+	if !known || srcLocal == dstLocal {
+		return
+	}
+	if srcLocal == srcIsClient {
+		t.LocalRole = gnet.ClientRole
+	} else {
+		t.LocalRole = gnet.ServerRole
+	}
+}
+
+func (r *roleTagger) isLocal(ip net.IP) bool {
+	return ip != nil && r.local[string(ip.To16())]
+}
+
+// Reports whether the source of t is the client, and whether that is known.
+func (r *roleTagger) sourceIsClient(t *gnet.NetTraffic) (srcIsClient, known bool) {
+	src := endpoint{string(t.SrcIP.To16()), t.SrcPort}
+	dst := endpoint{string(t.DstIP.To16()), t.DstPort}
+
+	if t.ConnectionID != uuid.Nil {
+		switch c := t.Content.(type) {
+		case gnet.TCPPacketMetadata:
+			if c.SYN {
+				if c.ACK {
+					r.remember(t.ConnectionID, dst)
+				} else {
+					r.remember(t.ConnectionID, src)
+				}
+			}
+		case gnet.TCPConnectionMetadata:
+			// The last traffic of the connection.
+			r.forget(t.ConnectionID)
+			switch c.Initiator {
+			case gnet.SourceInitiator:
+				return true, true
+			case gnet.DestInitiator:
+				return false, true
+			}
+		}
+		if client, ok := r.clients[t.ConnectionID]; ok {
+			return client == src, true
+		}
+	}
+	return portSourceIsClient(t.SrcPort, t.DstPort)
+}
+
+func portSourceIsClient(srcPort, dstPort int) (srcIsClient, known bool) {
+	if srcPort == 0 || dstPort == 0 || srcPort == dstPort {
+		return false, false
+	}
+	for _, limit := range []int{1024, ephemeralPortStart} {
+		if srcPort < limit && dstPort >= limit {
+			return false, true
+		}
+		if dstPort < limit && srcPort >= limit {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+func (r *roleTagger) remember(id uuid.UUID, client endpoint) {
+	if _, ok := r.clients[id]; ok {
+		return
+	}
+	if len(r.order) >= maxRoleConnections {
+		delete(r.clients, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.clients[id] = client
+	r.order = append(r.order, id)
+}
+
+// Forgets a connection. Its key stays in order until it is evicted, where
+// deleting it again does nothing.
+func (r *roleTagger) forget(id uuid.UUID) {
+	delete(r.clients, id)
+}
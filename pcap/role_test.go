@@ -0,0 +1,41 @@
+package pcap
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+func TestRoleTagger(t *testing.T) {
+	local := net.IPv4(10, 0, 0, 1)
+	remote := net.IPv4(192, 0, 2, 1)
+	r := newRoleTagger([]net.IP{local})
+
+	tag := func(src net.IP, srcPort int, dst net.IP, dstPort int, id uuid.UUID, c gnet.ParsedNetworkContent) gnet.HostRole {
+		traffic := gnet.NetTraffic{SrcIP: src, SrcPort: srcPort, DstIP: dst, DstPort: dstPort, ConnectionID: id, Content: c}
+		r.tag(&traffic)
+		return traffic.LocalRole
+	}
+
+	// A remote client connecting to a high port on the local host: the SYN
+	// decides, whatever the ports suggest.
+	conn := uuid.New()
+	assert.Equal(t, gnet.ServerRole, tag(remote, 40000, local, 8080, conn, gnet.TCPPacketMetadata{SYN: true}))
+	assert.Equal(t, gnet.ServerRole, tag(local, 8080, remote, 40000, conn, gnet.TCPPacketMetadata{SYN: true, ACK: true}))
+	assert.Equal(t, gnet.ServerRole, tag(local, 8080, remote, 40000, conn, gnet.HTTPResponse{}))
+	assert.Equal(t, gnet.ServerRole, tag(remote, 40000, local, 8080, conn, gnet.TCPConnectionMetadata{Initiator: gnet.SourceInitiator}))
+
+	// Without a handshake, ports decide.
+	assert.Equal(t, gnet.ClientRole, tag(local, 51000, remote, 443, uuid.New(), gnet.HTTPRequest{}))
+	assert.Equal(t, gnet.ClientRole, tag(remote, 53, local, 40000, uuid.Nil, gnet.DNSRequest{}))
+	assert.Equal(t, gnet.ServerRole, tag(remote, 50000, local, 8080, uuid.Nil, nil))
+	assert.Equal(t, gnet.UnknownHostRole, tag(remote, 40000, local, 40001, uuid.Nil, nil))
+
+	// Neither or both endpoints local.
+	assert.Equal(t, gnet.UnknownHostRole, tag(remote, 51000, net.IPv4(192, 0, 2, 2), 443, uuid.Nil, nil))
+	assert.Equal(t, gnet.UnknownHostRole, tag(local, 51000, local, 443, uuid.Nil, nil))
+}
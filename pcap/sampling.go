@@ -0,0 +1,110 @@
+package pcap
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Fixed-point scale of sampling rates, so that decisions do not depend on
+// floating-point rounding.
+const sampleScale = 1 << 32
+
+// Decides which packets are parsed when sampling traffic. See
+// WithFlowSampling and WithPacketSampling. Not safe for concurrent use.
+type sampler struct {
+	flowRate, packetRate float64
+
+	// Flows are kept if the top 32 bits of their hash are below flowLimit.
+	flowLimit uint64
+
+	// Each packet adds packetStep to credit, and is kept if that brings
+	// credit to sampleScale, which it then gives up.
+	packetStep uint64
+	credit     uint64
+}
+
+// Returns nil, which keeps everything, unless opts set a rate below 1.
+func newSampler(opts Options) *sampler {
+	flowRate, packetRate := sampleRate(opts.FlowSampleRate), sampleRate(opts.PacketSampleRate)
+	if flowRate == 1 && packetRate == 1 {
+		return nil
+	}
+	s := &sampler{
+		flowRate:   flowRate,
+		packetRate: packetRate,
+		flowLimit:  uint64(flowRate * sampleScale),
+		packetStep: uint64(packetRate * sampleScale),
+	}
+	// The first packet is kept.
+	s.credit = sampleScale - s.packetStep
+	return s
+}
+
+// Rates outside of (0, 1) disable sampling.
+func sampleRate(r float64) float64 {
+	if r <= 0 || r >= 1 {
+		return 1
+	}
+	return r
+}
+
+// The fraction of traffic kept.
+func (s *sampler) rate() float64 {
+	return s.flowRate * s.packetRate
+}
+
+// Reports whether to parse packet.
+func (s *sampler) keep(packet gopacket.Packet) bool {
+	if s == nil {
+		return true
+	}
+	if s.flowRate < 1 && flowHash(packet)>>32 >= s.flowLimit {
+		return false
+	}
+	if s.packetRate < 1 {
+		s.credit += s.packetStep
+		if s.credit < sampleScale {
+			return false
+		}
+		s.credit -= sampleScale
+	}
+	return true
+}
+
+// Hashes the addresses and ports of packet, the same in both directions and
+// from one capture to the next, so that every packet of a flow gets the same
+// sampling decision.
+func flowHash(packet gopacket.Packet) uint64 {
+	var h uint64
+	if net := packet.NetworkLayer(); net != nil {
+		h = net.NetworkFlow().FastHash()
+	} else if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+		h = gopacket.NewFlow(layers.EndpointIPv4, arp.SourceProtAddress, arp.DstProtAddress).FastHash()
+	}
+	if t := packet.TransportLayer(); t != nil {
+		h ^= t.TransportFlow().FastHash()
+	}
+
+	// FNV, which FastHash uses, mixes its top bits poorly for short inputs.
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
+
+// Passes through all traffic from in, with its SampleRate set to rate.
+func markSampled(rate float64, in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			if _, boundary := t.Content.(gnet.CaptureFileBoundary); !boundary {
+				t.SampleRate = rate
+			}
+			out <- t
+		}
+	}()
+	return out
+}
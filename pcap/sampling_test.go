@@ -0,0 +1,87 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Parses packets with opts, returning the traffic and the parser's stats.
+func parseAll(t *testing.T, opts Options, packets []gopacket.Packet) ([]gnet.NetTraffic, Stats) {
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 1000),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return nil, Stats{}
+	}
+	var traffic []gnet.NetTraffic
+	for tr := range out {
+		traffic = append(traffic, tr)
+	}
+	return traffic, p.Stats()
+}
+
+func TestPacketSampling(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i := 0; i < 10; i++ {
+		packets = append(packets, CreateUDPPacket(client, server, 40000+i, 9999, []byte("x")))
+	}
+
+	opts := NewOptions()
+	WithPacketSampling(0.5)(&opts)
+	traffic, stats := parseAll(t, opts, packets)
+
+	var ports []int
+	for _, tr := range traffic {
+		ports = append(ports, tr.SrcPort)
+		assert.Equal(t, 0.5, tr.SampleRate)
+	}
+	assert.Equal(t, []int{40000, 40002, 40004, 40006, 40008}, ports)
+	assert.Equal(t, uint64(5), stats.PacketsSampledOut)
+}
+
+func TestFlowSampling(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	const flows = 200
+	var packets []gopacket.Packet
+	for i := 0; i < flows; i++ {
+		port := 40000 + i
+		packets = append(packets,
+			CreateUDPPacket(client, server, port, 9999, []byte("x")),
+			CreateUDPPacket(server, client, 9999, port, []byte("y")))
+	}
+
+	opts := NewOptions()
+	WithFlowSampling(0.5)(&opts)
+	sample := func() map[int]int {
+		traffic, stats := parseAll(t, opts, packets)
+		kept := map[int]int{}
+		for _, tr := range traffic {
+			assert.Equal(t, 0.5, tr.SampleRate)
+			port := tr.SrcPort
+			if port == 9999 {
+				port = tr.DstPort
+			}
+			kept[port]++
+		}
+		assert.Equal(t, uint64(2*(flows-len(kept))), stats.PacketsSampledOut)
+		return kept
+	}
+
+	kept := sample()
+	assert.InDelta(t, flows/2, len(kept), flows/5)
+	for port, n := range kept {
+		assert.Equal(t, 2, n, "both directions of flow from port %d", port)
+	}
+	assert.Equal(t, kept, sample())
+}
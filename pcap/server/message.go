@@ -0,0 +1,122 @@
+package server
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/pb"
+)
+
+// The messages of traffic.proto. They are encoded by hand rather than
+// generated, and implement the Marshal and Unmarshal methods that gRPC's
+// protobuf codec uses in place of reflection.
+
+// A NetTraffic message. The server sends traffic encoded ahead of time, and
+// the client decodes it.
+type trafficMessage struct {
+	encoded []byte
+	traffic gnet.NetTraffic
+}
+
+func (m *trafficMessage) Marshal() ([]byte, error) {
+	return m.encoded, nil
+}
+
+func (m *trafficMessage) Unmarshal(b []byte) error {
+	t, err := pb.Unmarshal(b)
+	m.traffic = t
+	return err
+}
+
+func (m *trafficMessage) Reset()         { *m = trafficMessage{} }
+func (m *trafficMessage) String() string { return "NetTraffic" }
+func (*trafficMessage) ProtoMessage()    {}
+
+// A SubscribeRequest message.
+type subscribeRequest struct {
+	filter Filter
+}
+
+func (m *subscribeRequest) Marshal() ([]byte, error) {
+	var b []byte
+	for _, s := range m.filter.LayerTypes {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	for _, s := range m.filter.ContentTypes {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	for _, ip := range m.filter.Hosts {
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, ip)
+	}
+	if len(m.filter.Ports) > 0 {
+		var packed []byte
+		for _, p := range m.filter.Ports {
+			packed = protowire.AppendVarint(packed, uint64(p))
+		}
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b, nil
+}
+
+func (m *subscribeRequest) Unmarshal(b []byte) error {
+	m.filter = Filter{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return errors.Wrapf(protowire.ParseError(n), "field %d", num)
+		}
+		b = b[n:]
+
+		switch num {
+		case 1:
+			m.filter.LayerTypes = append(m.filter.LayerTypes, string(data))
+		case 2:
+			m.filter.ContentTypes = append(m.filter.ContentTypes, string(data))
+		case 3:
+			m.filter.Hosts = append(m.filter.Hosts, net.IP(append([]byte(nil), data...)))
+		case 4:
+			if typ == protowire.VarintType {
+				m.filter.Ports = append(m.filter.Ports, int(v))
+				continue
+			}
+			for len(data) > 0 {
+				p, n := protowire.ConsumeVarint(data)
+				if n < 0 {
+					return errors.Wrap(protowire.ParseError(n), "field 4")
+				}
+				m.filter.Ports = append(m.filter.Ports, int(p))
+				data = data[n:]
+			}
+		}
+	}
+	return nil
+}
+
+func (m *subscribeRequest) Reset()         { *m = subscribeRequest{} }
+func (m *subscribeRequest) String() string { return "SubscribeRequest" }
+func (*subscribeRequest) ProtoMessage()    {}
@@ -0,0 +1,318 @@
+// Package server exposes the traffic parsed by a pcap.TrafficParser over gRPC,
+// so that remote services can consume it without capturing packets
+// themselves. Clients subscribe with a Filter and receive the matching traffic
+// as it is parsed, in the form described by traffic.proto.
+//
+// The server never waits for slow subscribers: traffic that does not fit in a
+// subscriber's buffer is dropped for that subscriber and counted.
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/gnet/pb"
+	"github.com/mel2oo/go-pcap/pcap"
+)
+
+const DefaultSubscriberBuffer = 1000
+
+const subscribeMethod = "/gopcap.server.v1.TrafficService/Subscribe"
+
+// Selects the traffic sent to a subscriber. Traffic must match every
+// non-empty criterion, and any of its values.
+type Filter struct {
+	LayerTypes []string
+
+	// Names the content types were registered under with
+	// gnet.RegisterContentType, e.g. "HTTPRequest".
+	ContentTypes []string
+
+	// Matched against either endpoint.
+	Hosts []net.IP
+
+	// Matched against either port.
+	Ports []int
+}
+
+func (f Filter) Matches(t gnet.NetTraffic) bool {
+	if len(f.LayerTypes) > 0 && !containsString(f.LayerTypes, t.LayerType) {
+		return false
+	}
+	if len(f.ContentTypes) > 0 {
+		name, _ := gnet.ContentTypeName(t.Content)
+		if t.Content == nil || !containsString(f.ContentTypes, name) {
+			return false
+		}
+	}
+	if len(f.Hosts) > 0 {
+		matched := false
+		for _, ip := range f.Hosts {
+			if ip.Equal(t.SrcIP) || ip.Equal(t.DstIP) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.Ports) > 0 {
+		matched := false
+		for _, p := range f.Ports {
+			if p == t.SrcPort || p == t.DstPort {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+type Options struct {
+	// The number of messages that can be waiting to be sent to a subscriber.
+	SubscriberBuffer int
+}
+
+func NewOptions() Options {
+	return Options{SubscriberBuffer: DefaultSubscriberBuffer}
+}
+
+// Server sends traffic to its subscribers. Traffic is fed to it with Broadcast,
+// or by Serve from a TrafficParser.
+//
+// Safe for concurrent use.
+type Server struct {
+	opts Options
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// Set once Broadcast returns. Later subscriptions end right away.
+	done    bool
+	dropped int64
+	// The first error from encoding traffic.
+	err error
+}
+
+type subscriber struct {
+	filter  Filter
+	traffic chan []byte
+}
+
+func NewServer(opts Options) *Server {
+	if opts.SubscriberBuffer <= 0 {
+		opts.SubscriberBuffer = 1
+	}
+	return &Server{
+		opts:        opts,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// Adds the TrafficService to g.
+func (s *Server) Register(g *grpc.Server) {
+	g.RegisterService(&serviceDesc, s)
+}
+
+// Parses traffic with p and serves it on lis until the capture ends or ctx is
+// cancelled. Subscriptions end with the capture.
+func (s *Server) Serve(ctx context.Context, p *pcap.TrafficParser, lis net.Listener, fs ...gnet.TCPParserFactory) error {
+	traffic, err := p.Parse(ctx, fs...)
+	if err != nil {
+		return err
+	}
+
+	g := grpc.NewServer()
+	s.Register(g)
+	served := make(chan error, 1)
+	go func() {
+		served <- g.Serve(lis)
+	}()
+
+	s.Broadcast(traffic)
+	g.GracefulStop()
+	return <-served
+}
+
+// Sends all traffic from in to the subscribers it matches, and releases its
+// buffers. Once in is closed, all subscriptions end.
+func (s *Server) Broadcast(in <-chan gnet.NetTraffic) {
+	for t := range in {
+		s.broadcast(t)
+		if t.Content != nil {
+			t.Content.ReleaseBuffers()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	for sub := range s.subscribers {
+		close(sub.traffic)
+		delete(s.subscribers, sub)
+	}
+}
+
+// Returns the number of messages dropped because a subscriber's buffer was
+// full, across all subscribers.
+func (s *Server) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Returns the first error encountered while encoding traffic.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Server) broadcast(t gnet.NetTraffic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Traffic is only encoded once, and only if someone wants it.
+	var encoded []byte
+	for sub := range s.subscribers {
+		if !sub.filter.Matches(t) {
+			continue
+		}
+		if encoded == nil {
+			var err error
+			if encoded, err = pb.Marshal(t); err != nil {
+				if s.err == nil {
+					s.err = err
+				}
+				return
+			}
+		}
+		select {
+		case sub.traffic <- encoded:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// Registers sub. Returns false if the server is done broadcasting.
+func (s *Server) add(sub *subscriber) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return false
+	}
+	s.subscribers[sub] = struct{}{}
+	return true
+}
+
+func (s *Server) remove(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, sub)
+}
+
+func (s *Server) subscribe(f Filter, stream grpc.ServerStream) error {
+	for _, name := range f.ContentTypes {
+		if !containsString(gnet.RegisteredContentTypes(), name) {
+			return status.Errorf(codes.InvalidArgument, "unknown content type %q", name)
+		}
+	}
+
+	sub := &subscriber{filter: f, traffic: make(chan []byte, s.opts.SubscriberBuffer)}
+	if !s.add(sub) {
+		return nil
+	}
+	defer s.remove(sub)
+
+	for {
+		select {
+		case encoded, ok := <-sub.traffic:
+			if !ok {
+				return nil
+			}
+			if err := stream.SendMsg(&trafficMessage{encoded: encoded}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// Implemented by Server, for the type check in grpc.Server.RegisterService.
+type trafficService interface {
+	subscribe(f Filter, stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gopcap.server.v1.TrafficService",
+	HandlerType: (*trafficService)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Subscribe",
+		Handler:       subscribeHandler,
+		ServerStreams: true,
+	}},
+	Metadata: "pcap/server/traffic.proto",
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	var req subscribeRequest
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	return srv.(trafficService).subscribe(req.filter, stream)
+}
+
+// A subscription to a remote server.
+type Subscription struct {
+	stream grpc.ClientStream
+}
+
+// Subscribes to the traffic matching f on the server at the other end of cc.
+// The subscription lasts until ctx is cancelled or the server's capture ends.
+func Subscribe(ctx context.Context, cc grpc.ClientConnInterface, f Filter) (*Subscription, error) {
+	stream, err := cc.NewStream(ctx, &serviceDesc.Streams[0], subscribeMethod)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe")
+	}
+	if err := stream.SendMsg(&subscribeRequest{filter: f}); err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe")
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, errors.Wrap(err, "failed to subscribe")
+	}
+	return &Subscription{stream: stream}, nil
+}
+
+// Returns the next traffic, or io.EOF once the subscription has ended.
+func (s *Subscription) Recv() (gnet.NetTraffic, error) {
+	var m trafficMessage
+	if err := s.stream.RecvMsg(&m); err != nil {
+		if err == io.EOF {
+			return gnet.NetTraffic{}, err
+		}
+		return gnet.NetTraffic{}, errors.Wrap(err, "failed to receive traffic")
+	}
+	return m.traffic, nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Starts a gRPC server for s and returns a connection to it.
+func dial(t *testing.T, s *Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	g := grpc.NewServer()
+	s.Register(g)
+	go g.Serve(lis)
+	t.Cleanup(g.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return cc
+}
+
+func waitForSubscribers(t *testing.T, s *Server, n int) {
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.subscribers) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestSubscribe(t *testing.T) {
+	s := NewServer(NewOptions())
+	cc := dial(t, s)
+	ctx := context.Background()
+
+	web, err := Subscribe(ctx, cc, Filter{Ports: []int{80}, ContentTypes: []string{"TCPPacketMetadata"}})
+	assert.NoError(t, err)
+	all, err := Subscribe(ctx, cc, Filter{})
+	assert.NoError(t, err)
+	waitForSubscribers(t, s, 2)
+
+	traffic := []gnet.NetTraffic{
+		{LayerType: "TCP", SrcIP: net.IPv4(10, 0, 0, 1), SrcPort: 40000, DstIP: net.IPv4(10, 0, 0, 2), DstPort: 80,
+			Content: gnet.TCPPacketMetadata{SYN: true}},
+		{LayerType: "TCP", SrcPort: 40001, DstPort: 443, Content: gnet.TCPPacketMetadata{SYN: true}},
+		{LayerType: "DNS", SrcPort: 80, DstPort: 53},
+	}
+	in := make(chan gnet.NetTraffic, len(traffic))
+	for _, tr := range traffic {
+		in <- tr
+	}
+	close(in)
+	s.Broadcast(in)
+
+	got, err := web.Recv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, traffic[0], got)
+	}
+	_, err = web.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	for range traffic {
+		_, err := all.Recv()
+		assert.NoError(t, err)
+	}
+	_, err = all.Recv()
+	assert.Equal(t, io.EOF, err)
+	assert.Zero(t, s.Dropped())
+
+	// Subscriptions made after the capture ended end right away.
+	late, err := Subscribe(ctx, cc, Filter{})
+	assert.NoError(t, err)
+	_, err = late.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	s := NewServer(Options{SubscriberBuffer: 1})
+	sub := &subscriber{traffic: make(chan []byte, 1)}
+	assert.True(t, s.add(sub))
+
+	s.broadcast(gnet.NetTraffic{LayerType: "UDP"})
+	s.broadcast(gnet.NetTraffic{LayerType: "UDP"})
+	assert.Equal(t, int64(1), s.Dropped())
+	assert.Len(t, sub.traffic, 1)
+}
+
+func TestSubscribeUnknownContentType(t *testing.T) {
+	s := NewServer(NewOptions())
+	sub, err := Subscribe(context.Background(), dial(t, s), Filter{ContentTypes: []string{"Nope"}})
+	assert.NoError(t, err)
+	_, err = sub.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(errors.Cause(err)))
+}
+
+func TestSubscribeRequestEncoding(t *testing.T) {
+	in := subscribeRequest{filter: Filter{
+		LayerTypes:   []string{"HTTP"},
+		ContentTypes: []string{"HTTPRequest", "HTTPResponse"},
+		Hosts:        []net.IP{net.ParseIP("2001:db8::1")},
+		Ports:        []int{80, 8080},
+	}}
+	b, err := in.Marshal()
+	assert.NoError(t, err)
+	var out subscribeRequest
+	assert.NoError(t, out.Unmarshal(b))
+	assert.Equal(t, in, out)
+}
@@ -0,0 +1,75 @@
+package pcap
+
+import (
+	"context"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Close shuts down parsing started with Parse: it stops capture, flushes the
+// connections in progress, and waits for their parsers to return and for the
+// channel returned by Parse to be closed. The consumer must keep reading from
+// that channel meanwhile.
+//
+// If ctx is done first, the channel is closed at once and ctx.Err() is
+// returned. Parsers still running are left to finish in the background, and
+// their traffic is discarded.
+//
+// Close does nothing if Parse has not been called. A capture file or reader
+// that reaches its end shuts down the same way, without Close.
+func (p *TrafficParser) Close(ctx context.Context) error {
+	if p.stop == nil {
+		return nil
+	}
+	p.stop()
+	select {
+	case <-p.closed:
+		return nil
+	case <-ctx.Done():
+		p.abandonOnce.Do(func() { close(p.abandon) })
+		<-p.closed
+		return ctx.Err()
+	}
+}
+
+// Passes through traffic from in until it is closed or Close gives up on
+// draining it, whichever comes first.
+func (p *TrafficParser) drain(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(p.closed)
+		defer close(out)
+		for {
+			select {
+			case t, more := <-in:
+				if !more {
+					return
+				}
+				select {
+				case out <- t:
+				case <-p.abandon:
+					discard(t)
+					go discardAll(in)
+					return
+				}
+			case <-p.abandon:
+				go discardAll(in)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func discard(t gnet.NetTraffic) {
+	if t.Content != nil {
+		t.Content.ReleaseBuffers()
+	}
+}
+
+// Reads in to its end, so that the goroutines writing it can return.
+func discardAll(in <-chan gnet.NetTraffic) {
+	for t := range in {
+		discard(t)
+	}
+}
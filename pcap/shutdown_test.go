@@ -0,0 +1,100 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Delivers packets, then blocks until capture is cancelled, like a live
+// capture.
+type fakeLiveReader struct {
+	packets []gopacket.Packet
+}
+
+func (r fakeLiveReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	out := make(chan gopacket.Packet)
+	go func() {
+		defer close(out)
+		for _, p := range r.packets {
+			select {
+			case out <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return out, nil
+}
+
+func (r fakeLiveReader) Stats() CaptureStats {
+	return CaptureStats{}
+}
+
+func udpPackets(n int) []gopacket.Packet {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	var packets []gopacket.Packet
+	for i := 0; i < n; i++ {
+		packets = append(packets, CreateUDPPacket(client, server, 40000+i, 9999, []byte("x")))
+	}
+	return packets
+}
+
+func TestClose(t *testing.T) {
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeLiveReader{packets: udpPackets(3)},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	assert.NoError(t, p.Close(context.Background()), "before Parse")
+
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 3; i++ {
+		<-out
+	}
+
+	closed := make(chan error)
+	go func() { closed <- p.Close(context.Background()) }()
+	for range out {
+	}
+	assert.NoError(t, <-closed)
+}
+
+func TestCloseDeadline(t *testing.T) {
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeLiveReader{packets: udpPackets(100)},
+		outchan:  make(chan gnet.NetTraffic, 1),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Nothing reads out, so parsing gets stuck until Close gives up.
+	assert.Eventually(t, func() bool {
+		return atomic.LoadUint64(&p.counters.packets) >= 4
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, p.Close(ctx))
+
+	n := 0
+	for range out {
+		n++
+	}
+	assert.Less(t, n, 100)
+}
@@ -0,0 +1,181 @@
+package pcap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Statistics reported by a PcapReader. Counters a reader cannot report are
+// zero.
+type CaptureStats struct {
+	// Packets received by the capture backend.
+	PacketsReceived uint64
+
+	// Packets dropped because the kernel buffer was full.
+	PacketsDroppedByKernel uint64
+
+	// Packets dropped by the network interface or its driver.
+	PacketsDroppedByInterface uint64
+}
+
+func (s CaptureStats) add(o CaptureStats) CaptureStats {
+	return CaptureStats{
+		PacketsReceived:           s.PacketsReceived + o.PacketsReceived,
+		PacketsDroppedByKernel:    s.PacketsDroppedByKernel + o.PacketsDroppedByKernel,
+		PacketsDroppedByInterface: s.PacketsDroppedByInterface + o.PacketsDroppedByInterface,
+	}
+}
+
+// Statistics of a TrafficParser.
+type Stats struct {
+	CaptureStats
+
+	// Packets and bytes handed to the parser by the reader.
+	PacketsProcessed uint64
+	BytesProcessed   uint64
+
+	// Packets left unparsed by sampling. See WithFlowSampling.
+	PacketsSampledOut uint64
+
+	// Streams whose buffered data was delivered past a gap, and streams closed
+	// for being idle, by periodic flushes of the assembler.
+	StreamsFlushed uint64
+	StreamsClosed  uint64
+
+	// IP fragments received, datagrams reassembled from fragments, and
+	// incomplete datagrams whose fragments were discarded after a timeout.
+	FragmentsSeen        uint64
+	FragmentsReassembled uint64
+	FragmentsTimedOut    uint64
+
+	// Traffic discarded because the consumer fell behind, under an overflow
+	// policy other than OverflowBlock.
+	TrafficDropped uint64
+
+	// Traffic discarded by the filter set with WithFilter.
+	TrafficFiltered uint64
+
+	// Parsers abandoned for taking longer than Options.ParserTimeout.
+	ParsersTimedOut uint64
+
+	// Panics recovered while handling packets. See WithPanicHandler.
+	Panics uint64
+
+	// UDP flows started. See WithUDPFlows.
+	UDPFlows uint64
+
+	// TCP connections being reassembled.
+	TCPConnectionsOpen uint64
+
+	// TCP connections and UDP flows evicted while still active, to stay
+	// within the limits set with WithConnectionLimits.
+	TCPConnectionsEvicted uint64
+	UDPFlowsEvicted       uint64
+
+	// Number of times we got a nil assembler context; this can happen when the
+	// payload resides in a page other than the first in the reassembly buffer.
+	NilAssemblerContext uint64
+
+	// Number of times a parser completed without an assembler context for its
+	// last packet, which seems to happen when old data is flushed.
+	NilAssemblerContextAfterParse uint64
+
+	// Number of times we got an assembler context of the wrong type; this
+	// probably shouldn't happen at all.
+	BadAssemblerContextType uint64
+}
+
+// Counters updated while parsing, shared by the streams of a TrafficParser.
+// Accessed atomically.
+type parserCounters struct {
+	packets uint64
+	bytes   uint64
+
+	packetsSampledOut uint64
+
+	streamsFlushed uint64
+	streamsClosed  uint64
+
+	fragments            uint64
+	fragmentsReassembled uint64
+	fragmentsTimedOut    uint64
+
+	trafficDropped  uint64
+	trafficFiltered uint64
+
+	parsersTimedOut uint64
+	panics          uint64
+	udpFlows        uint64
+
+	tcpConnectionsOpen uint64
+
+	tcpConnectionsEvicted uint64
+	udpFlowsEvicted       uint64
+
+	nilAssemblerContext           uint64
+	nilAssemblerContextAfterParse uint64
+	badAssemblerContextType       uint64
+}
+
+func (c *parserCounters) stats() Stats {
+	return Stats{
+		PacketsProcessed:              atomic.LoadUint64(&c.packets),
+		BytesProcessed:                atomic.LoadUint64(&c.bytes),
+		PacketsSampledOut:             atomic.LoadUint64(&c.packetsSampledOut),
+		StreamsFlushed:                atomic.LoadUint64(&c.streamsFlushed),
+		StreamsClosed:                 atomic.LoadUint64(&c.streamsClosed),
+		FragmentsSeen:                 atomic.LoadUint64(&c.fragments),
+		FragmentsReassembled:          atomic.LoadUint64(&c.fragmentsReassembled),
+		FragmentsTimedOut:             atomic.LoadUint64(&c.fragmentsTimedOut),
+		TrafficDropped:                atomic.LoadUint64(&c.trafficDropped),
+		TrafficFiltered:               atomic.LoadUint64(&c.trafficFiltered),
+		ParsersTimedOut:               atomic.LoadUint64(&c.parsersTimedOut),
+		Panics:                        atomic.LoadUint64(&c.panics),
+		UDPFlows:                      atomic.LoadUint64(&c.udpFlows),
+		TCPConnectionsOpen:            atomic.LoadUint64(&c.tcpConnectionsOpen),
+		TCPConnectionsEvicted:         atomic.LoadUint64(&c.tcpConnectionsEvicted),
+		UDPFlowsEvicted:               atomic.LoadUint64(&c.udpFlowsEvicted),
+		NilAssemblerContext:           atomic.LoadUint64(&c.nilAssemblerContext),
+		NilAssemblerContextAfterParse: atomic.LoadUint64(&c.nilAssemblerContextAfterParse),
+		BadAssemblerContextType:       atomic.LoadUint64(&c.badAssemblerContextType),
+	}
+}
+
+// Reports the statistics of an open capture handle, and the last ones read
+// from it once it is closed.
+type handleStats struct {
+	mu   sync.Mutex
+	read func() (CaptureStats, error)
+	last CaptureStats
+}
+
+func (s *handleStats) open(read func() (CaptureStats, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.read = read
+	s.last = CaptureStats{}
+}
+
+// Must be called before the handle is closed.
+func (s *handleStats) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update()
+	s.read = nil
+}
+
+func (s *handleStats) get() CaptureStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update()
+	return s.last
+}
+
+func (s *handleStats) update() {
+	if s.read == nil {
+		return
+	}
+	if st, err := s.read(); err == nil {
+		s.last = st
+	}
+}
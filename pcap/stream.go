@@ -0,0 +1,193 @@
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"golang.org/x/net/bpf"
+)
+
+// Read packets in pcap or pcapng format from a stream, such as os.Stdin or an
+// HTTP response body, without writing it to disk. The format is detected from
+// the start of the stream. The stream is consumed, so it can only be captured
+// from once.
+type StreamReader struct {
+	Reader   io.Reader
+	BPFilter string
+
+	// As in FileReader.
+	ReplaySpeed float64
+
+	// Packets read from the stream, including those rejected by the filter.
+	// Accessed atomically.
+	received uint64
+
+	mu sync.Mutex
+	// Link type of the stream, once Capture has read its header.
+	linkType layers.LinkType
+	started  bool
+	filter   *bpf.VM
+	err      error
+}
+
+func NewStreamReader(r io.Reader, bpfilter string) *StreamReader {
+	return &StreamReader{
+		Reader:   r,
+		BPFilter: bpfilter,
+	}
+}
+
+func (s *StreamReader) Capture(ctx context.Context) (<-chan gopacket.Packet, error) {
+	r, err := newCaptureStream(s.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.linkType, s.started, s.filter, s.err = r.LinkType(), true, nil, nil
+	if len(s.BPFilter) > 0 {
+		if s.filter, err = newBPFVM(s.linkType, s.BPFilter); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	s.mu.Unlock()
+	atomic.StoreUint64(&s.received, 0)
+
+	out := make(chan gopacket.Packet, 10)
+	go func() {
+		defer close(out)
+		var pacer *replayPacer
+		if s.ReplaySpeed > 0 {
+			pacer = newReplayPacer(s.ReplaySpeed)
+		}
+
+		for ctx.Err() == nil {
+			data, ci, err := r.ReadPacketData()
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					s.mu.Lock()
+					s.err = err
+					s.mu.Unlock()
+				}
+				return
+			}
+			atomic.AddUint64(&s.received, 1)
+			if !s.matches(ci, data) {
+				continue
+			}
+
+			packet := gopacket.NewPacket(data, decoderFor(s.linkType), gopacket.Default)
+			md := packet.Metadata()
+			md.CaptureInfo = ci
+			md.Truncated = md.Truncated || ci.CaptureLength < ci.Length
+
+			if pacer != nil && !pacer.wait(ctx, ci.Timestamp) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case out <- packet:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func (s *StreamReader) matches(ci gopacket.CaptureInfo, data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.filter == nil {
+		return true
+	}
+	n, err := s.filter.Run(data)
+	return err == nil && n > 0
+}
+
+// Compiles expr into a program run in Go, so that streams can be filtered
+// without a libpcap handle.
+func newBPFVM(linkType layers.LinkType, expr string) (*bpf.VM, error) {
+	raw, err := compileBPF(linkType, expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid BPF filter %q: %w", expr, err)
+	}
+	insns, ok := bpf.Disassemble(raw)
+	if !ok {
+		return nil, fmt.Errorf("BPF filter %q uses unsupported instructions", expr)
+	}
+	vm, err := bpf.NewVM(insns)
+	if err != nil {
+		return nil, fmt.Errorf("BPF filter %q: %w", expr, err)
+	}
+	return vm, nil
+}
+
+// The error that ended the stream early, if any. A stream that ends cleanly
+// reports nil.
+func (s *StreamReader) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Replaces the filter, also for the rest of the stream being read.
+func (s *StreamReader) SetBPFFilter(expr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		filter, err := newBPFVM(s.linkType, expr)
+		if err != nil {
+			return err
+		}
+		s.filter = filter
+	}
+	s.BPFilter = expr
+	return nil
+}
+
+// Streams have no kernel or interface drops, so only packets read are counted.
+func (s *StreamReader) Stats() CaptureStats {
+	return CaptureStats{PacketsReceived: atomic.LoadUint64(&s.received)}
+}
+
+// Reads packets from a pcap or pcapng stream, as pcapgo.Reader and
+// pcapgo.NgReader do.
+type captureStream interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// The magic number that starts a pcapng section header block.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// Reads the header of a pcap or pcapng stream.
+func newCaptureStream(r io.Reader) (captureStream, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(pcapngMagic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture header: %w", err)
+	}
+	if bytes.Equal(magic, pcapngMagic) {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return nil, err
+		}
+		return ng, nil
+	}
+	pr, err := pcapgo.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
@@ -0,0 +1,167 @@
+package pcap
+
+import (
+	"time"
+
+	"github.com/google/gopacket/reassembly"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+// streamParser selects parsers for, and parses, a unidirectional stream of
+// in-order data that does not come directly from TCP reassembly, such as the
+// plaintext of a decrypted TLS connection. Unlike tcpFlow, it buffers data
+// itself instead of relying on the assembler to keep it.
+type streamParser struct {
+	bidiID uuid.UUID
+
+	factorySelector gnet.TCPParserFactorySelector
+
+	// Non-nil once the stream has switched protocols.
+	upgradeFactory gnet.TCPParserFactory
+
+	// Invoked with each result, and with data that could not be parsed.
+	emit func(start, end time.Time, c gnet.ParsedNetworkContent, payload []byte)
+
+	// Invoked with each result parsed from the stream.
+	onResult func(gnet.ParsedNetworkContent)
+
+	// Reports parsers that panic.
+	panics *panicReporter
+
+	// Data awaiting parser selection.
+	pending memview.MemView
+
+	currentParser  gnet.TCPParser
+	currentFactory gnet.TCPParserFactory
+	currentStart   time.Time
+
+	// The number of request-response exchanges parsed from the stream, and
+	// the direction of its data.
+	exchanges int
+	dir       gnet.FlowDirection
+
+	// The parser of the opposite direction of the connection, if any.
+	peer *streamParser
+}
+
+// Parses the next data in the stream, observed at t.
+func (p *streamParser) feed(data memview.MemView, t time.Time, isEnd bool) {
+	input := data
+	if p.currentParser == nil {
+		p.pending.SetMaxChunks(memview.DefaultMaxChunks)
+		p.pending.Append(data)
+		input, p.pending = p.pending, memview.MemView{}
+	}
+
+	for input.Len() > 0 || (isEnd && p.currentParser != nil) {
+		if p.currentParser == nil {
+			fact, decision, discardFront := selectFactory(p.factorySelector, p.upgradeFactory, input, isEnd)
+			if discardFront > 0 {
+				p.emit(t, t, gnet.DroppedBytes(discardFront), input.SubView(0, discardFront).Bytes())
+				p.dropped(nil)
+				input = input.SubView(discardFront, input.Len())
+			}
+
+			switch decision {
+			case gnet.NeedMoreData:
+				if isEnd {
+					p.emit(t, t, gnet.DroppedBytes(input.Len()), input.Bytes())
+				} else {
+					p.pending = input
+				}
+				return
+			case gnet.Accept:
+				p.currentParser = createParser(fact, p.bidiID, 0, 0, p.exchanges)
+				p.currentFactory = fact
+				p.currentStart = t
+			default:
+				if input.Len() > 0 {
+					p.emit(t, t, gnet.DroppedBytes(input.Len()), input.Bytes())
+				}
+				return
+			}
+		}
+
+		pnc, unused, _, err := p.panics.parse(p.currentParser, p.bidiID, input, isEnd)
+		if err != nil {
+			p.emit(p.currentStart, t, gnet.DroppedBytes(input.Len()), input.Bytes())
+			p.dropped(p.currentFactory)
+			p.currentParser = nil
+			return
+		}
+		if pnc == nil {
+			// The parser holds on to the input until it has a result.
+			return
+		}
+
+		p.emit(p.currentStart, t, pnc, nil)
+		if p.onResult != nil {
+			p.onResult(pnc)
+		}
+		if endsExchange(p.currentFactory, pnc) {
+			p.exchanges++
+		}
+		p.currentParser = nil
+		input = unused
+	}
+}
+
+// Keeps the exchange count in step with the opposite direction once data is
+// dropped, counting a message begun by a parser of fact, if not nil.
+func (p *streamParser) dropped(fact gnet.TCPParserFactory) {
+	peer := 0
+	if p.peer != nil {
+		peer = p.peer.exchanges
+	}
+	p.exchanges = resyncExchanges(p.dir, p.exchanges, peer, fact)
+}
+
+// Creates a parser with fact for the data starting at the given TCP seq/ack
+// numbers. Parsers of request-response exchanges are instead given the index
+// of the next exchange in their stream.
+func createParser(fact gnet.TCPParserFactory, bidiID uuid.UUID, seq, ack reassembly.Sequence, exchanges int) gnet.TCPParser {
+	if ef, ok := fact.(gnet.TCPExchangeParserFactory); ok {
+		return ef.CreateExchangeParser(bidiID, exchanges)
+	}
+	return fact.CreateParser(bidiID, seq, ack)
+}
+
+// Reports whether c, parsed by a parser from fact, ends a request-response
+// exchange.
+func endsExchange(fact gnet.TCPParserFactory, c gnet.ParsedNetworkContent) bool {
+	ef, ok := fact.(gnet.TCPExchangeParserFactory)
+	return ok && ef.EndsExchange(c)
+}
+
+// Returns the exchange count of direction dir of a connection after data sent
+// in that direction was dropped, given its count so far and that of the
+// opposite direction, peer. A message that a parser of fact had begun counts
+// as a lost exchange. As responses answer requests in order, lost responses
+// answer at most the requests parsed so far, so the next response answers the
+// next request. Lost requests are only known if a parser began one.
+func resyncExchanges(dir gnet.FlowDirection, exchanges, peer int, fact gnet.TCPParserFactory) int {
+	if _, ok := fact.(gnet.TCPExchangeParserFactory); ok {
+		exchanges++
+	}
+	if dir == gnet.ServerToClient && exchanges < peer {
+		exchanges = peer
+	}
+	return exchanges
+}
+
+// Selects the factory for a new parser. Once a connection has been upgraded to
+// another protocol, only the upgrade factory is considered.
+func selectFactory(fs gnet.TCPParserFactorySelector, upgradeFactory gnet.TCPParserFactory,
+	input memview.MemView, isEnd bool) (gnet.TCPParserFactory, gnet.AcceptDecision, int64) {
+	if upgradeFactory == nil {
+		return fs.Select(input, isEnd)
+	}
+
+	decision, discardFront := upgradeFactory.Accepts(input, isEnd)
+	if decision != gnet.Accept {
+		return nil, decision, discardFront
+	}
+	return upgradeFactory, decision, discardFront
+}
@@ -0,0 +1,52 @@
+package pcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	ghttp "github.com/mel2oo/go-pcap/gnet/http"
+	"github.com/mel2oo/go-pcap/mempool"
+	"github.com/mel2oo/go-pcap/memview"
+)
+
+func TestStreamParser(t *testing.T) {
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var results []gnet.ParsedNetworkContent
+	p := &streamParser{
+		bidiID:          uuid.New(),
+		factorySelector: gnet.TCPParserFactorySelector{ghttp.NewHTTPRequestParserFactory(pool)},
+		emit: func(_, _ time.Time, c gnet.ParsedNetworkContent, _ []byte) {
+			results = append(results, c)
+		},
+	}
+
+	// Two pipelined requests, split at arbitrary points, followed by garbage.
+	input := "GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+		"POST /b HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello" +
+		"\x00\x01\x02"
+	for _, chunk := range []string{input[:10], input[10:50], input[50:]} {
+		p.feed(memview.New([]byte(chunk)), time.Now(), false)
+	}
+	p.feed(memview.MemView{}, time.Now(), true)
+
+	if assert.Len(t, results, 3) {
+		if req, ok := results[0].(gnet.HTTPRequest); assert.True(t, ok) {
+			assert.Equal(t, "/a", req.URL.Path)
+			assert.Equal(t, 0, req.Seq)
+		}
+		if req, ok := results[1].(gnet.HTTPRequest); assert.True(t, ok) {
+			assert.Equal(t, "/b", req.URL.Path)
+			assert.Equal(t, "hello", req.Body.String())
+			assert.Equal(t, 1, req.Seq)
+		}
+		assert.Equal(t, gnet.DroppedBytes(3), results[2])
+	}
+}
@@ -0,0 +1,60 @@
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamReader(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	var packets [][]byte
+	for i := 0; i < 3; i++ {
+		packets = append(packets, CreateTCPSYN(net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), 40000+i, 80, 1).Data())
+	}
+
+	var classic, ng bytes.Buffer
+	pw := pcapgo.NewWriter(&classic)
+	assert.NoError(t, pw.WriteFileHeader(DefaultSnapLen, layers.LinkTypeEthernet))
+	nw, err := pcapgo.NewNgWriter(&ng, layers.LinkTypeEthernet)
+	assert.NoError(t, err)
+	for i, data := range packets {
+		ci := gopacket.CaptureInfo{
+			Timestamp:     start.Add(time.Duration(i) * time.Second),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}
+		assert.NoError(t, pw.WritePacket(ci, data))
+		assert.NoError(t, nw.WritePacket(ci, data))
+	}
+	assert.NoError(t, nw.Flush())
+
+	for name, buf := range map[string]*bytes.Buffer{"pcap": &classic, "pcapng": &ng} {
+		r := NewStreamReader(buf, "")
+		out, err := r.Capture(context.Background())
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		var ports []layers.TCPPort
+		for p := range out {
+			if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+				ports = append(ports, tcp.SrcPort)
+			}
+			assert.False(t, p.Metadata().Timestamp.Before(start), name)
+		}
+		assert.Equal(t, []layers.TCPPort{40000, 40001, 40002}, ports, name)
+		assert.Equal(t, uint64(3), r.Stats().PacketsReceived, name)
+		assert.NoError(t, r.Err(), name)
+	}
+
+	_, err = NewStreamReader(bytes.NewReader([]byte("not a capture")), "").Capture(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,119 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+	ghttp "github.com/mel2oo/go-pcap/gnet/http"
+	"github.com/mel2oo/go-pcap/mempool"
+)
+
+func TestParserTimeout(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	start := time.Unix(1700000000, 0)
+
+	// A request whose header block never ends, followed by another after the
+	// timeout.
+	stuck := []byte("GET /a HTTP/1.1\r\nHost: a\r\n")
+	next := []byte("GET /b HTTP/1.1\r\nHost: b\r\n\r\n")
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreatePacketWithSeq(client, server, 40000, 80, stuck, 101),
+		CreatePacketWithSeq(client, server, 40000, 80, next, 101+uint32(len(stuck))),
+	}
+	for i, p := range packets {
+		p.Metadata().Timestamp = start.Add(time.Duration(i) * 10 * time.Second)
+	}
+
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	opts := NewOptions()
+	opts.ParserTimeout = 5 * time.Second
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(), ghttp.NewHTTPRequestParserFactory(pool))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var dropped []gnet.DroppedBytes
+	var urls []string
+	for tr := range out {
+		switch c := tr.Content.(type) {
+		case gnet.DroppedBytes:
+			dropped = append(dropped, c)
+		case gnet.HTTPRequest:
+			urls = append(urls, c.URL.Path)
+		}
+		tr.Content.ReleaseBuffers()
+	}
+
+	assert.Equal(t, []gnet.DroppedBytes{gnet.DroppedBytes(len(stuck))}, dropped)
+	assert.Equal(t, []string{"/b"}, urls)
+	assert.Equal(t, uint64(1), p.Stats().ParsersTimedOut)
+}
+
+func TestStalledParserTimeout(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+
+	// A request whose body never completes, on a flow that then goes quiet.
+	stuck := []byte("POST /a HTTP/1.1\r\nHost: a\r\nContent-Length: 100\r\n\r\nabc")
+	packets := []gopacket.Packet{
+		CreateTCPSYN(client, server, 40000, 80, 100),
+		CreatePacketWithSeq(client, server, 40000, 80, stuck, 101),
+	}
+	for _, p := range packets {
+		p.Metadata().Timestamp = time.Now()
+	}
+
+	pool, err := mempool.MakeBufferPool(1024*1024, 4*1024)
+	if !assert.NoError(t, err) {
+		return
+	}
+	opts := NewOptions()
+	opts.ParserTimeout = 100 * time.Millisecond
+	opts.StreamFlushTimeout = 1
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeLiveReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background(), ghttp.NewHTTPRequestParserFactory(pool))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer p.Close(context.Background())
+
+	// Abandoned by the flush ticker, as no more data arrives on the flow.
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case tr := <-out:
+			tr.Content.ReleaseBuffers()
+			if d, ok := tr.Content.(gnet.DroppedBytes); ok {
+				assert.Equal(t, gnet.DroppedBytes(len(stuck)), d)
+				assert.Equal(t, uint64(1), p.Stats().ParsersTimedOut)
+
+				// The body buffered by the parser was released.
+				stats := pool.Stats()
+				assert.Equal(t, stats.TotalChunks, stats.FreeChunks)
+				return
+			}
+		case <-deadline:
+			t.Fatal("parser of stalled flow was not abandoned")
+		}
+	}
+}
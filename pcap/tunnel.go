@@ -0,0 +1,96 @@
+package pcap
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Tunnels nested deeper than this are not decapsulated.
+const maxTunnelDepth = 4
+
+// Reassembles fragmented datagrams and strips tunnel encapsulation, at every
+// level of nesting. Returns the innermost packet and the tunnels it was carried
+// in, outermost first, or nil if packet is a fragment of an incomplete
+// datagram.
+func (p *TrafficParser) unwrap(packet gopacket.Packet) (gopacket.Packet, []gnet.Tunnel) {
+	var tunnels []gnet.Tunnel
+	for depth := 0; ; depth++ {
+		if p.defragmenter != nil {
+			if packet = p.defragmenter.defrag(packet); packet == nil {
+				return nil, nil
+			}
+		}
+		if depth == maxTunnelDepth {
+			return packet, tunnels
+		}
+
+		inner, tunnel, ok := decapsulate(packet)
+		if !ok || inner.NetworkLayer() == nil {
+			return packet, tunnels
+		}
+		packet = inner
+		tunnels = append(tunnels, tunnel)
+	}
+}
+
+// Decodes the packet carried by packet, if it is a GRE, VXLAN, GENEVE or
+// IP-in-IP tunnel packet. The inner packet has the metadata of packet.
+func decapsulate(packet gopacket.Packet) (gopacket.Packet, gnet.Tunnel, bool) {
+	var tunnel gnet.Tunnel
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		tunnel.SrcIP, tunnel.DstIP = ip.SrcIP, ip.DstIP
+	case *layers.IPv6:
+		tunnel.SrcIP, tunnel.DstIP = ip.SrcIP, ip.DstIP
+	default:
+		return nil, tunnel, false
+	}
+
+	// The layer following the outer IP header, or the outer UDP header.
+	var next gopacket.Layer
+	ls := packet.Layers()
+	for i, l := range ls {
+		if l == packet.NetworkLayer() && i+1 < len(ls) {
+			next = ls[i+1]
+			if _, ok := next.(*layers.UDP); ok && i+2 < len(ls) {
+				next = ls[i+2]
+			}
+			break
+		}
+	}
+
+	var data []byte
+	var decoder gopacket.Decoder
+	switch l := next.(type) {
+	case *layers.GRE:
+		tunnel.Type = "GRE"
+		if l.KeyPresent {
+			tunnel.ID = l.Key
+		}
+		data, decoder = l.LayerPayload(), l.Protocol
+	case *layers.VXLAN:
+		tunnel.Type, tunnel.ID = "VXLAN", l.VNI
+		data, decoder = l.LayerPayload(), layers.LayerTypeEthernet
+	case *layers.Geneve:
+		tunnel.Type, tunnel.ID = "GENEVE", l.VNI
+		data, decoder = l.LayerPayload(), l.Protocol
+	case *layers.IPv4:
+		tunnel.Type = "IPIP"
+		data, decoder = packet.NetworkLayer().LayerPayload(), layers.LayerTypeIPv4
+	case *layers.IPv6:
+		tunnel.Type = "IPIP"
+		data, decoder = packet.NetworkLayer().LayerPayload(), layers.LayerTypeIPv6
+	default:
+		return nil, tunnel, false
+	}
+
+	inner := gopacket.NewPacket(data, decoder, gopacket.Default)
+	if md := packet.Metadata(); md != nil {
+		*inner.Metadata() = *md
+		inner.Metadata().CaptureLength = len(data)
+		inner.Metadata().Length = len(data)
+	}
+	return inner, tunnel, true
+}
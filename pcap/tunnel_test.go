@@ -0,0 +1,109 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+var (
+	outerSrc = net.IPv4(192, 168, 0, 1)
+	outerDst = net.IPv4(192, 168, 0, 2)
+)
+
+// Wraps the IPv4 packet inner in the given tunnel layers, between an outer
+// IPv4 header with the given protocol and the inner packet.
+func encapsulate(t *testing.T, protocol layers.IPProtocol, inner gopacket.Packet, tunnel ...gopacket.SerializableLayer) gopacket.Packet {
+	ls := []gopacket.SerializableLayer{
+		&layers.Ethernet{
+			EthernetType: layers.EthernetTypeIPv4,
+			SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
+			DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
+		},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: protocol, SrcIP: outerSrc, DstIP: outerDst},
+	}
+	ls = append(ls, tunnel...)
+	ls = append(ls, gopacket.Payload(inner.Data()))
+
+	buf := gopacket.NewSerializeBuffer()
+	if !assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...)) {
+		t.FailNow()
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestDecapsulate(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	frame := CreateUDPPacket(client, server, 40000, 53, []byte("query"))
+	ip := gopacket.NewPacket(frame.LinkLayer().LayerPayload(), layers.LayerTypeIPv4, gopacket.Default)
+
+	for _, tc := range []struct {
+		packet gopacket.Packet
+		want   gnet.Tunnel
+	}{
+		{
+			encapsulate(t, layers.IPProtocolGRE, ip, &layers.GRE{Protocol: layers.EthernetTypeIPv4, KeyPresent: true, Key: 7}),
+			gnet.Tunnel{Type: "GRE", SrcIP: outerSrc, DstIP: outerDst, ID: 7},
+		},
+		{
+			encapsulate(t, layers.IPProtocolUDP, frame, &layers.UDP{SrcPort: 50000, DstPort: 4789}, &layers.VXLAN{ValidIDFlag: true, VNI: 42}),
+			gnet.Tunnel{Type: "VXLAN", SrcIP: outerSrc, DstIP: outerDst, ID: 42},
+		},
+		{
+			encapsulate(t, layers.IPProtocolIPv4, ip),
+			gnet.Tunnel{Type: "IPIP", SrcIP: outerSrc, DstIP: outerDst},
+		},
+	} {
+		inner, tunnel, ok := decapsulate(tc.packet)
+		if !assert.True(t, ok, tc.want.Type) {
+			continue
+		}
+		assert.Equal(t, tc.want.Type, tunnel.Type)
+		assert.True(t, tc.want.SrcIP.Equal(tunnel.SrcIP), tc.want.Type)
+		assert.True(t, tc.want.DstIP.Equal(tunnel.DstIP), tc.want.Type)
+		assert.Equal(t, tc.want.ID, tunnel.ID, tc.want.Type)
+		if udp, ok := inner.TransportLayer().(*layers.UDP); assert.True(t, ok, tc.want.Type) {
+			assert.Equal(t, layers.UDPPort(53), udp.DstPort, tc.want.Type)
+		}
+	}
+
+	_, _, ok := decapsulate(frame)
+	assert.False(t, ok)
+}
+
+func TestParseTunneledTCP(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	syn := CreateTCPSYN(client, server, 40000, 80, 1)
+	vxlan := encapsulate(t, layers.IPProtocolUDP, syn, &layers.UDP{SrcPort: 50000, DstPort: 4789}, &layers.VXLAN{ValidIDFlag: true, VNI: 42})
+
+	p := &TrafficParser{
+		opts:     NewOptions(),
+		reader:   fakeMultiReader{packets: []gopacket.Packet{vxlan}},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var found bool
+	for c := range out {
+		if _, ok := c.Content.(gnet.TCPPacketMetadata); ok {
+			found = true
+			assert.True(t, client.Equal(c.SrcIP))
+			assert.Equal(t, 80, c.DstPort)
+			if assert.Len(t, c.Tunnels, 1) {
+				assert.Equal(t, "VXLAN", c.Tunnels[0].Type)
+				assert.Equal(t, uint32(42), c.Tunnels[0].ID)
+			}
+		}
+	}
+	assert.True(t, found)
+}
@@ -0,0 +1,229 @@
+package pcap
+
+import (
+	"container/list"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Default time after which a UDP flow without datagrams is forgotten.
+const DefaultUDPFlowTimeout = 30 * time.Second
+
+// The most UDP flows tracked at once unless set with WithConnectionLimits.
+const DefaultMaxUDPFlows = 65536
+
+// Groups UDP datagrams into flows by their addresses and ports, in either
+// direction, gives each flow a ConnectionID, and parses flows accepted by a
+// gnet.UDPParserFactory. Time is measured by packet timestamps. Once max flows
+// are tracked, the least recently active is evicted for each new one.
+//
+// Not safe for concurrent use.
+type udpFlowTable struct {
+	timeout   time.Duration
+	factories []gnet.UDPParserFactory
+
+	max   int
+	flows map[udpFlowKey]*udpFlow
+
+	// The flows in flows, least recently active first.
+	order *list.List
+
+	// The latest packet time seen.
+	now time.Time
+
+	counters *parserCounters
+	logger   gnet.Logger
+}
+
+// The endpoints of a flow, lower first, so that both directions share a key.
+type udpFlowKey struct {
+	a, b endpoint
+}
+
+func newUDPFlowKey(src, dst endpoint) udpFlowKey {
+	if dst.ip < src.ip || dst.ip == src.ip && dst.port < src.port {
+		return udpFlowKey{dst, src}
+	}
+	return udpFlowKey{src, dst}
+}
+
+type udpFlow struct {
+	id     uuid.UUID
+	key    udpFlowKey
+	client endpoint
+	last   time.Time
+
+	// The flow's element of udpFlowTable.order.
+	elem *list.Element
+
+	// Nil unless a factory accepted the flow and its parser has not failed.
+	parser gnet.UDPParser
+
+	// The first datagram of the flow, from the client, as a template for
+	// content completed when the flow ends.
+	first gnet.NetTraffic
+}
+
+func newUDPFlowTable(timeout time.Duration, max int, factories []gnet.UDPParserFactory, counters *parserCounters, logger gnet.Logger) *udpFlowTable {
+	if timeout <= 0 {
+		timeout = DefaultUDPFlowTimeout
+	}
+	if max <= 0 {
+		max = DefaultMaxUDPFlows
+	}
+	return &udpFlowTable{
+		timeout:   timeout,
+		factories: factories,
+		max:       max,
+		flows:     map[udpFlowKey]*udpFlow{},
+		order:     list.New(),
+		counters:  counters,
+		logger:    logger,
+	}
+}
+
+// Sets the ConnectionID of a UDP datagram, and its Content if it completes
+// content of the flow's parser. Flows ended by the datagram's arrival, after
+// being idle, are flushed to out.
+func (t *udpFlowTable) observe(traffic *gnet.NetTraffic, out chan<- gnet.NetTraffic) {
+	if t == nil {
+		return
+	}
+	ts := traffic.ObservationTime
+	if ts.After(t.now) {
+		t.now = ts
+	}
+
+	src := endpoint{string(traffic.SrcIP.To16()), traffic.SrcPort}
+	dst := endpoint{string(traffic.DstIP.To16()), traffic.DstPort}
+	key := newUDPFlowKey(src, dst)
+	f, ok := t.flows[key]
+	if ok && ts.Sub(f.last) > t.timeout {
+		t.end(f, out)
+		ok = false
+	}
+	if !ok {
+		for len(t.flows) >= t.max {
+			t.evict(t.order.Front().Value.(*udpFlow), out)
+		}
+		f = t.start(traffic, key, src)
+		f.elem = t.order.PushBack(f)
+		t.flows[key] = f
+	} else {
+		t.order.MoveToBack(f.elem)
+	}
+	if ts.After(f.last) {
+		f.last = ts
+	}
+	traffic.ConnectionID = f.id
+
+	if f.parser == nil {
+		return
+	}
+	dir := gnet.ClientToServer
+	if src != f.client {
+		dir = gnet.ServerToClient
+	}
+	c, err := f.parser.Parse(dir, traffic.Payload, false)
+	if err != nil {
+		t.logger.Debugf("%s failed on UDP flow %s: %v", f.parser.Name(), f.id, err)
+		f.parser = nil
+	} else if c != nil {
+		traffic.Content = c
+	}
+}
+
+func (t *udpFlowTable) start(traffic *gnet.NetTraffic, key udpFlowKey, client endpoint) *udpFlow {
+	atomic.AddUint64(&t.counters.udpFlows, 1)
+	f := &udpFlow{
+		id:     uuid.New(),
+		key:    key,
+		client: client,
+		last:   traffic.ObservationTime,
+		first:  *traffic,
+	}
+	f.first.Payload, f.first.Content = nil, nil
+	for _, fact := range t.factories {
+		if fact.Accepts(traffic.Payload, traffic.SrcPort, traffic.DstPort) {
+			f.parser = fact.CreateUDPParser(f.id)
+			break
+		}
+	}
+	return f
+}
+
+// Forgets a flow, emitting any content its parser completes on being told
+// that the flow ended.
+func (t *udpFlowTable) end(f *udpFlow, out chan<- gnet.NetTraffic) {
+	delete(t.flows, f.key)
+	t.order.Remove(f.elem)
+	if f.parser == nil {
+		return
+	}
+	c, err := f.parser.Parse(gnet.ClientToServer, nil, true)
+	if err != nil || c == nil {
+		return
+	}
+	out <- f.traffic(c)
+}
+
+// Ends the least recently active flow f to make room for a new one.
+func (t *udpFlowTable) evict(f *udpFlow, out chan<- gnet.NetTraffic) {
+	atomic.AddUint64(&t.counters.udpFlowsEvicted, 1)
+	t.logger.Debugf("evicted UDP flow %s", f.id)
+	t.end(f, out)
+	out <- f.traffic(gnet.ConnectionEvicted{ConnectionID: f.id})
+}
+
+// Wraps content about the flow, oriented like its first datagram.
+func (f *udpFlow) traffic(c gnet.ParsedNetworkContent) gnet.NetTraffic {
+	return gnet.NetTraffic{
+		LayerType:       f.first.LayerType,
+		SrcIP:           f.first.SrcIP,
+		SrcPort:         f.first.SrcPort,
+		DstIP:           f.first.DstIP,
+		DstPort:         f.first.DstPort,
+		Content:         c,
+		ConnectionID:    f.id,
+		Interface:       f.first.Interface,
+		Tunnels:         f.first.Tunnels,
+		VLANs:           f.first.VLANs,
+		ObservationTime: f.last,
+		FinalPacketTime: f.last,
+	}
+}
+
+// Ends the flows idle for longer than the timeout as of the latest packet
+// seen.
+func (t *udpFlowTable) expire(out chan<- gnet.NetTraffic) {
+	if t == nil {
+		return
+	}
+	for _, f := range t.flows {
+		if t.now.Sub(f.last) > t.timeout {
+			t.end(f, out)
+		}
+	}
+}
+
+// Ends all flows, once capture is over.
+func (t *udpFlowTable) endAll(out chan<- gnet.NetTraffic) {
+	if t == nil {
+		return
+	}
+	for _, f := range t.flows {
+		t.end(f, out)
+	}
+}
+
+// The number of flows tracked.
+func (t *udpFlowTable) active() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.flows)
+}
@@ -0,0 +1,96 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Counts the datagrams of flows starting with "count", in each direction.
+type countingUDPFactory struct{}
+
+func (countingUDPFactory) Name() string { return "Counting UDP Parser Factory" }
+
+func (countingUDPFactory) Accepts(payload []byte, _, _ int) bool {
+	return string(payload) == "count"
+}
+
+func (countingUDPFactory) CreateUDPParser(uuid.UUID) gnet.UDPParser {
+	return &countingUDPParser{}
+}
+
+type countingUDPParser struct {
+	counts [2]int
+}
+
+type udpCounts [2]int
+
+func (udpCounts) ReleaseBuffers() {}
+
+func (*countingUDPParser) Name() string { return "Counting UDP Parser" }
+
+func (p *countingUDPParser) Parse(dir gnet.FlowDirection, _ []byte, isEnd bool) (gnet.ParsedNetworkContent, error) {
+	if isEnd {
+		return udpCounts(p.counts), nil
+	}
+	p.counts[dir]++
+	return nil, nil
+}
+
+func TestUDPFlows(t *testing.T) {
+	client, server := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2)
+	packets := []gopacket.Packet{
+		CreateUDPPacket(client, server, 40000, 9999, []byte("count")),
+		CreateUDPPacket(server, client, 9999, 40000, []byte("a")),
+		CreateUDPPacket(client, server, 40000, 9999, []byte("b")),
+		CreateUDPPacket(client, server, 40001, 9999, []byte("other")),
+		// After the first flow has timed out.
+		CreateUDPPacket(client, server, 40000, 9999, []byte("c")),
+	}
+	start := time.Unix(1700000000, 0)
+	for i, p := range packets {
+		p.Metadata().Timestamp = start.Add(time.Duration(i) * time.Second)
+	}
+	packets[4].Metadata().Timestamp = start.Add(time.Minute)
+
+	opts := NewOptions()
+	WithUDPFlows(10*time.Second, countingUDPFactory{})(&opts)
+	p := &TrafficParser{
+		opts:     opts,
+		reader:   fakeMultiReader{packets: packets},
+		outchan:  make(chan gnet.NetTraffic, 100),
+		counters: &parserCounters{},
+	}
+	out, err := p.Parse(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var ids []uuid.UUID
+	var counts []udpCounts
+	for tr := range out {
+		if c, ok := tr.Content.(udpCounts); ok {
+			counts = append(counts, c)
+			assert.Equal(t, 40000, tr.SrcPort)
+			continue
+		}
+		ids = append(ids, tr.ConnectionID)
+	}
+
+	if assert.Len(t, ids, 5) {
+		assert.Equal(t, ids[0], ids[1])
+		assert.Equal(t, ids[0], ids[2])
+		assert.NotEqual(t, ids[0], ids[3])
+		assert.NotEqual(t, ids[0], ids[4])
+		assert.NotEqual(t, ids[3], ids[4])
+	}
+	assert.Equal(t, []udpCounts{{2, 1}}, counts)
+	assert.Equal(t, uint64(3), p.Stats().UDPFlows)
+}
@@ -0,0 +1,38 @@
+package pcap
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Returns the IDs of the 802.1Q VLAN tags of packet, outermost first, or nil
+// if it is untagged.
+func vlanIDs(packet gopacket.Packet) []uint16 {
+	var ids []uint16
+	for _, l := range packet.Layers() {
+		switch l := l.(type) {
+		case *layers.Dot1Q:
+			ids = append(ids, l.VLANIdentifier)
+		case gopacket.NetworkLayer:
+			// Tags of frames carried in tunnels are not counted.
+			return ids
+		}
+	}
+	return ids
+}
+
+// Reports whether traffic with the given VLAN IDs is parsed, according to the
+// VLANs option.
+func (p *TrafficParser) vlanSelected(ids []uint16) bool {
+	if len(p.opts.VLANs) == 0 {
+		return true
+	}
+	for _, id := range ids {
+		for _, want := range p.opts.VLANs {
+			if id == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package pcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Returns a UDP packet to port 53 from srcPort, tagged with the given VLAN
+// IDs, outermost first.
+func createVLANPacket(t *testing.T, srcPort int, vlans ...uint16) gopacket.Packet {
+	eth := &layers.Ethernet{
+		EthernetType: layers.EthernetTypeIPv4,
+		SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
+		DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
+	}
+	switch {
+	case len(vlans) == 1:
+		eth.EthernetType = layers.EthernetTypeDot1Q
+	case len(vlans) > 1:
+		eth.EthernetType = layers.EthernetTypeQinQ
+	}
+
+	ls := []gopacket.SerializableLayer{eth}
+	for i, id := range vlans {
+		next := layers.EthernetTypeDot1Q
+		if i == len(vlans)-1 {
+			next = layers.EthernetTypeIPv4
+		}
+		ls = append(ls, &layers.Dot1Q{VLANIdentifier: id, Type: next})
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: 53}
+	ls = append(ls, ip, udp, gopacket.Payload("query"))
+
+	buf := gopacket.NewSerializeBuffer()
+	if !assert.NoError(t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...)) {
+		t.FailNow()
+	}
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestVLANs(t *testing.T) {
+	packets := []gopacket.Packet{
+		createVLANPacket(t, 40000),
+		createVLANPacket(t, 40001, 10),
+		createVLANPacket(t, 40002, 100, 20),
+	}
+
+	parse := func(opts Options) map[int][]uint16 {
+		p := &TrafficParser{
+			opts:     opts,
+			reader:   fakeMultiReader{packets: packets},
+			outchan:  make(chan gnet.NetTraffic, 100),
+			counters: &parserCounters{},
+		}
+		out, err := p.Parse(context.Background())
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		vlans := map[int][]uint16{}
+		for c := range out {
+			vlans[c.SrcPort] = c.VLANs
+		}
+		return vlans
+	}
+
+	assert.Equal(t, map[int][]uint16{
+		40000: nil,
+		40001: {10},
+		40002: {100, 20},
+	}, parse(NewOptions()))
+
+	opts := NewOptions()
+	WithVLANs(20)(&opts)
+	assert.Equal(t, map[int][]uint16{40002: {100, 20}}, parse(opts))
+}
@@ -0,0 +1,137 @@
+package writer
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+)
+
+// Filter selects the flows to write. A flow, identified by its pair of IP
+// endpoints and ports in either direction, is selected once parsed traffic
+// from it is observed with a selected ConnectionID or content type, or when
+// it is selected directly with SelectFlow.
+//
+// Parsed traffic usually follows the packets it was parsed from, so a Filter
+// fed while packets are being written misses the start of the flows it
+// selects. To extract complete flows from a capture file, parse the file
+// through Run first, then read it again and write its packets with
+// Writer.WriteAll.
+//
+// Safe for concurrent use.
+type Filter struct {
+	mu            sync.RWMutex
+	connectionIDs map[uuid.UUID]struct{}
+	contentTypes  map[reflect.Type]struct{}
+	flows         map[string]struct{}
+}
+
+func NewFilter() *Filter {
+	return &Filter{
+		connectionIDs: map[uuid.UUID]struct{}{},
+		contentTypes:  map[reflect.Type]struct{}{},
+		flows:         map[string]struct{}{},
+	}
+}
+
+// Selects the flows of traffic with any of the given connection IDs.
+func (f *Filter) SelectConnection(ids ...uuid.UUID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range ids {
+		f.connectionIDs[id] = struct{}{}
+	}
+}
+
+// Selects the flows of traffic whose content has the same type as any of the
+// given examples, e.g. gnet.TLSClientHello{}.
+func (f *Filter) SelectContent(examples ...gnet.ParsedNetworkContent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range examples {
+		f.contentTypes[reflect.TypeOf(c)] = struct{}{}
+	}
+}
+
+// Selects the flow between the given endpoints, in both directions.
+func (f *Filter) SelectFlow(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flows[flowKey(srcIP, srcPort, dstIP, dstPort)] = struct{}{}
+}
+
+// Selects the flow of t if its connection or content is selected. Reports
+// whether the flow of t is selected.
+func (f *Filter) Observe(t gnet.NetTraffic) bool {
+	key := flowKey(t.SrcIP, t.SrcPort, t.DstIP, t.DstPort)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.flows[key]; ok {
+		return true
+	}
+
+	_, selected := f.connectionIDs[t.ConnectionID]
+	if !selected && t.Content != nil {
+		_, selected = f.contentTypes[reflect.TypeOf(t.Content)]
+	}
+	if selected {
+		f.flows[key] = struct{}{}
+	}
+	return selected
+}
+
+// Run passes through all traffic from in, observing each. The returned channel
+// is closed once in is closed.
+func (f *Filter) Run(in <-chan gnet.NetTraffic) <-chan gnet.NetTraffic {
+	out := make(chan gnet.NetTraffic, cap(in))
+	go func() {
+		defer close(out)
+		for t := range in {
+			f.Observe(t)
+			out <- t
+		}
+	}()
+	return out
+}
+
+// Reports whether p belongs to a selected flow.
+func (f *Filter) Matches(p gopacket.Packet) bool {
+	var srcIP, dstIP net.IP
+	switch l := p.NetworkLayer().(type) {
+	case *layers.IPv4:
+		srcIP, dstIP = l.SrcIP, l.DstIP
+	case *layers.IPv6:
+		srcIP, dstIP = l.SrcIP, l.DstIP
+	default:
+		return false
+	}
+
+	var srcPort, dstPort int
+	switch l := p.TransportLayer().(type) {
+	case *layers.TCP:
+		srcPort, dstPort = int(l.SrcPort), int(l.DstPort)
+	case *layers.UDP:
+		srcPort, dstPort = int(l.SrcPort), int(l.DstPort)
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.flows[flowKey(srcIP, srcPort, dstIP, dstPort)]
+	return ok
+}
+
+// Returns the same key for both directions of a flow.
+func flowKey(srcIP net.IP, srcPort int, dstIP net.IP, dstPort int) string {
+	src := net.JoinHostPort(srcIP.String(), fmt.Sprint(srcPort))
+	dst := net.JoinHostPort(dstIP.String(), fmt.Sprint(dstPort))
+	if src > dst {
+		src, dst = dst, src
+	}
+	return src + "|" + dst
+}
@@ -0,0 +1,228 @@
+package writer
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/pkg/errors"
+)
+
+// Snap length written to the header of rotated files when none is configured.
+// The same default as tcpdump.
+const defaultRotatingSnapLength = 262144
+
+type RotatingOptions struct {
+	// A new file is started once the current one holds at least MaxSize bytes,
+	// like tcpdump -C. 0 for no size limit.
+	MaxSize int64
+
+	// A new file is started once packets are Interval past the first packet of
+	// the current file, like tcpdump -G. 0 for no time limit.
+	Interval time.Duration
+
+	// Compress closed files with gzip, replacing each with a .gz file.
+	Compress bool
+
+	// Maximum number of bytes kept per packet. 0 for the default.
+	SnapLength uint32
+}
+
+// RotatingWriter writes packets to a sequence of pcap files, starting a new
+// file when the current one reaches the configured size or age. Files are
+// named after path, with the sequence number and the time of their first
+// packet inserted before the extension, e.g. capture_00001_20240102T150405.pcap.
+//
+// Files are created as packets arrive; no file is created if no packet is
+// written. Safe for concurrent use.
+type RotatingWriter struct {
+	mu       sync.Mutex
+	path     string
+	linkType layers.LinkType
+	opts     RotatingOptions
+
+	file    *os.File
+	w       *pcapgo.Writer
+	size    int64
+	started time.Time
+	index   int
+
+	// Compression of closed files runs in the background.
+	compressing sync.WaitGroup
+	errMu       sync.Mutex
+	err         error
+}
+
+func NewRotatingWriter(path string, linkType layers.LinkType, opts RotatingOptions) *RotatingWriter {
+	if opts.SnapLength == 0 {
+		opts.SnapLength = defaultRotatingSnapLength
+	}
+	return &RotatingWriter{
+		path:     path,
+		linkType: linkType,
+		opts:     opts,
+	}
+}
+
+// Writes p to the current file, first starting a new one if the current file
+// is full or too old.
+func (w *RotatingWriter) WritePacket(p gopacket.Packet) error {
+	var ci gopacket.CaptureInfo
+	if md := p.Metadata(); md != nil {
+		ci = md.CaptureInfo
+	}
+	return w.WriteData(ci, p.Data())
+}
+
+// Writes a packet with the given data. Capture and original lengths missing
+// from ci are taken from data, and packets without a timestamp are stamped
+// with the current time.
+func (w *RotatingWriter) WriteData(ci gopacket.CaptureInfo, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ci.Timestamp.IsZero() {
+		ci.Timestamp = time.Now()
+	}
+	if ci.Length < len(data) {
+		ci.Length = len(data)
+	}
+	if len(data) > int(w.opts.SnapLength) {
+		data = data[:w.opts.SnapLength]
+	}
+	ci.CaptureLength = len(data)
+
+	if w.file == nil || w.full(ci.Timestamp) {
+		if err := w.rotate(ci.Timestamp); err != nil {
+			return err
+		}
+	}
+
+	if err := w.w.WritePacket(ci, data); err != nil {
+		return errors.Wrapf(err, "failed to write packet to %s", w.file.Name())
+	}
+	// Each record has a 16-byte header.
+	w.size += int64(16 + len(data))
+	return nil
+}
+
+// Closes the current file and waits for the compression of closed files.
+// Returns the first error encountered while closing or compressing files.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	err := w.closeFile()
+	w.mu.Unlock()
+
+	w.compressing.Wait()
+	if err != nil {
+		return err
+	}
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.err
+}
+
+// Reports whether a packet at t belongs in a new file.
+func (w *RotatingWriter) full(t time.Time) bool {
+	if w.opts.MaxSize > 0 && w.size >= w.opts.MaxSize {
+		return true
+	}
+	return w.opts.Interval > 0 && t.Sub(w.started) >= w.opts.Interval
+}
+
+// Closes the current file and starts the next one, whose first packet is at t.
+func (w *RotatingWriter) rotate(t time.Time) error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	w.index++
+	name := w.fileName(t)
+	f, err := os.Create(name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s", name)
+	}
+
+	pw := pcapgo.NewWriterNanos(f)
+	if err := pw.WriteFileHeader(w.opts.SnapLength, w.linkType); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to write header to %s", name)
+	}
+
+	w.file, w.w = f, pw
+	w.size = 24 // file header
+	w.started = t
+	return nil
+}
+
+func (w *RotatingWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	f := w.file
+	w.file, w.w = nil, nil
+
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %s", f.Name())
+	}
+	if w.opts.Compress {
+		w.compressing.Add(1)
+		go func() {
+			defer w.compressing.Done()
+			if err := compressFile(f.Name()); err != nil {
+				w.errMu.Lock()
+				if w.err == nil {
+					w.err = err
+				}
+				w.errMu.Unlock()
+			}
+		}()
+	}
+	return nil
+}
+
+func (w *RotatingWriter) fileName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+	if ext == "" {
+		ext = ".pcap"
+	}
+	return fmt.Sprintf("%s_%05d_%s%s", base, w.index, t.UTC().Format("20060102T150405"), ext)
+}
+
+// Replaces the file at path with a gzip-compressed copy at path.gz.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s.gz", path)
+	}
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return errors.Wrapf(err, "failed to compress %s", path)
+	}
+	return os.Remove(path)
+}
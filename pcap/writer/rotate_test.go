@@ -0,0 +1,84 @@
+package writer
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func countPackets(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	r, err := pcapgo.NewReader(zr)
+	if !assert.NoError(t, err) {
+		return 0
+	}
+	assert.Equal(t, layers.LinkTypeEthernet, r.LinkType())
+
+	n := 0
+	for {
+		if _, _, err := r.ReadPacketData(); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Unix(1700000000, 0)
+	payload := make([]byte, 100)
+
+	w := NewRotatingWriter(filepath.Join(dir, "capture.pcap"), layers.LinkTypeEthernet,
+		RotatingOptions{MaxSize: 300, Compress: true})
+	for i := 0; i < 6; i++ {
+		p := createPacket(clientIP, serverIP, 40000, 80, payload, start.Add(time.Duration(i)*time.Second))
+		assert.NoError(t, w.WritePacket(p))
+	}
+	assert.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NoError(t, err)
+	sort.Strings(files)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "capture_00001_20231114T221320.pcap.gz"),
+		filepath.Join(dir, "capture_00002_20231114T221322.pcap.gz"),
+		filepath.Join(dir, "capture_00003_20231114T221324.pcap.gz"),
+	}, files)
+
+	for _, f := range files {
+		assert.Equal(t, 2, countPackets(t, f))
+	}
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Unix(1700000000, 0)
+
+	w := NewRotatingWriter(filepath.Join(dir, "capture"), layers.LinkTypeEthernet,
+		RotatingOptions{Interval: time.Minute})
+	for _, offset := range []time.Duration{0, 30 * time.Second, 61 * time.Second} {
+		p := createPacket(clientIP, serverIP, 40000, 80, nil, start.Add(offset))
+		assert.NoError(t, w.WritePacket(p))
+	}
+	assert.NoError(t, w.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "capture_*.pcap"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
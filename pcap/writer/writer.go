@@ -0,0 +1,212 @@
+// Package writer writes captured packets to pcapng files, either all of them
+// or only the flows selected by a Filter.
+package writer
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/pkg/errors"
+)
+
+// Name of the first interface described in the file, unless set with
+// WithInterfaceName.
+const DefaultInterfaceName = "intf0"
+
+// Timestamp resolution written for every interface: 10^-9 seconds.
+const nanosecondResolution = 9
+
+type Options struct {
+	// Name and description of the first interface in the file.
+	InterfaceName        string
+	InterfaceDescription string
+
+	// Maximum number of bytes kept per packet. 0 for unlimited.
+	SnapLength uint32
+
+	// If set, only packets of the flows it selects are written.
+	Filter *Filter
+}
+
+type Option func(*Options)
+
+func WithInterfaceName(name string) Option {
+	return func(o *Options) {
+		o.InterfaceName = name
+	}
+}
+
+func WithInterfaceDescription(description string) Option {
+	return func(o *Options) {
+		o.InterfaceDescription = description
+	}
+}
+
+// Truncates written packets to n bytes.
+func WithSnapLength(n uint32) Option {
+	return func(o *Options) {
+		o.SnapLength = n
+	}
+}
+
+// Writes only the packets of the flows selected by f.
+func WithFilter(f *Filter) Option {
+	return func(o *Options) {
+		o.Filter = f
+	}
+}
+
+// Writer writes packets to a pcapng file. The file starts with a section
+// header and an interface description block for the link type given to
+// NewWriter; further interfaces may be added with AddInterface. Timestamps
+// are written with nanosecond resolution.
+//
+// Safe for concurrent use.
+type Writer struct {
+	mu         sync.Mutex
+	ng         *pcapgo.NgWriter
+	closer     io.Closer
+	opts       Options
+	interfaces int
+}
+
+// Creates a Writer that writes to w. Close must be called to flush buffered
+// packets.
+func NewWriter(w io.Writer, linkType layers.LinkType, opt ...Option) (*Writer, error) {
+	opts := Options{InterfaceName: DefaultInterfaceName}
+	for _, o := range opt {
+		o(&opts)
+	}
+
+	ng, err := pcapgo.NewNgWriterInterface(w,
+		newInterface(opts.InterfaceName, opts.InterfaceDescription, linkType, opts.SnapLength),
+		pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to write pcapng header")
+	}
+
+	return &Writer{
+		ng:         ng,
+		opts:       opts,
+		interfaces: 1,
+	}, nil
+}
+
+// Creates the file at path, truncating it if it exists, and returns a Writer
+// to it. Close closes the file.
+func Create(path string, linkType layers.LinkType, opt ...Option) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", path)
+	}
+
+	w, err := NewWriter(f, linkType, opt...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+// Adds an interface description block to the file and returns the index of
+// the interface. Packets whose CaptureInfo carries that InterfaceIndex are
+// attributed to it.
+func (w *Writer) AddInterface(name string, linkType layers.LinkType) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id, err := w.ng.AddInterface(newInterface(name, "", linkType, w.opts.SnapLength))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to add interface %s", name)
+	}
+	w.interfaces++
+	return id, nil
+}
+
+// Writes p, unless the Writer has a filter that does not select its flow.
+// Reports whether p was written.
+func (w *Writer) WritePacket(p gopacket.Packet) (bool, error) {
+	if w.opts.Filter != nil && !w.opts.Filter.Matches(p) {
+		return false, nil
+	}
+
+	var ci gopacket.CaptureInfo
+	if md := p.Metadata(); md != nil {
+		ci = md.CaptureInfo
+	}
+	if err := w.WriteData(ci, p.Data()); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Writes all packets from packets until it is closed, skipping those the
+// filter does not select.
+func (w *Writer) WriteAll(packets <-chan gopacket.Packet) error {
+	for p := range packets {
+		if _, err := w.WritePacket(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes a packet with the given data, regardless of the filter. Capture and
+// original lengths missing from ci are taken from data, and packets from
+// interfaces that were not added to the file are attributed to the first one.
+func (w *Writer) WriteData(ci gopacket.CaptureInfo, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ci.Length < len(data) {
+		ci.Length = len(data)
+	}
+	if w.opts.SnapLength > 0 && len(data) > int(w.opts.SnapLength) {
+		data = data[:w.opts.SnapLength]
+	}
+	ci.CaptureLength = len(data)
+	if ci.InterfaceIndex < 0 || ci.InterfaceIndex >= w.interfaces {
+		ci.InterfaceIndex = 0
+	}
+
+	if err := w.ng.WritePacket(ci, data); err != nil {
+		return errors.Wrap(err, "failed to write packet")
+	}
+	return nil
+}
+
+// Writes buffered packets to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ng.Flush()
+}
+
+// Flushes buffered packets, and closes the file if the Writer was returned by
+// Create.
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func newInterface(name, description string, linkType layers.LinkType, snapLength uint32) pcapgo.NgInterface {
+	return pcapgo.NgInterface{
+		Name:                name,
+		Description:         description,
+		OS:                  runtime.GOOS,
+		LinkType:            linkType,
+		SnapLength:          snapLength,
+		TimestampResolution: nanosecondResolution,
+	}
+}
@@ -0,0 +1,115 @@
+package writer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/google/uuid"
+	"github.com/mel2oo/go-pcap/gnet"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	clientIP = net.IPv4(10, 0, 0, 1)
+	serverIP = net.IPv4(10, 0, 0, 2)
+)
+
+func createPacket(src, dst net.IP, srcPort, dstPort int, payload []byte, ts time.Time) gopacket.Packet {
+	eth := &layers.Ethernet{
+		EthernetType: layers.EthernetTypeIPv4,
+		SrcMAC:       net.HardwareAddr{0xFF, 0xAA, 0xFA, 0xAA, 0xFF, 0xAA},
+		DstMAC:       net.HardwareAddr{0xBD, 0xBD, 0xBD, 0xBD, 0xBD, 0xBD},
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	tcp := &layers.TCP{SrcPort: layers.TCPPort(srcPort), DstPort: layers.TCPPort(dstPort)}
+	buf := gopacket.NewSerializeBuffer()
+	gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true},
+		eth, ip, tcp, gopacket.Payload(payload))
+
+	p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	return p
+}
+
+func readAll(t *testing.T, data []byte) ([]gopacket.CaptureInfo, *pcapgo.NgReader) {
+	r, err := pcapgo.NewNgReader(bytes.NewReader(data), pcapgo.DefaultNgReaderOptions)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var cis []gopacket.CaptureInfo
+	for {
+		_, ci, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		cis = append(cis, ci)
+	}
+	return cis, r
+}
+
+func TestWriteNanosecondTimestamps(t *testing.T) {
+	ts := time.Unix(1700000000, 123456789)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, layers.LinkTypeEthernet, WithInterfaceName("eth0"))
+	assert.NoError(t, err)
+	written, err := w.WritePacket(createPacket(clientIP, serverIP, 40000, 80, []byte("GET"), ts))
+	assert.NoError(t, err)
+	assert.True(t, written)
+	assert.NoError(t, w.Close())
+
+	cis, r := readAll(t, buf.Bytes())
+	if assert.Len(t, cis, 1) {
+		assert.True(t, ts.Equal(cis[0].Timestamp), "got %v", cis[0].Timestamp)
+		assert.Equal(t, cis[0].CaptureLength, cis[0].Length)
+	}
+	intf, err := r.Interface(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "eth0", intf.Name)
+	assert.Equal(t, layers.LinkTypeEthernet, intf.LinkType)
+}
+
+func TestWriteSelectedFlows(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	tlsConn, httpConn := uuid.New(), uuid.New()
+
+	f := NewFilter()
+	f.SelectContent(gnet.TLSClientHello{})
+	assert.True(t, f.Observe(gnet.NetTraffic{
+		SrcIP: clientIP, SrcPort: 40001, DstIP: serverIP, DstPort: 443,
+		ConnectionID: tlsConn, Content: gnet.TLSClientHello{},
+	}))
+	assert.False(t, f.Observe(gnet.NetTraffic{
+		SrcIP: clientIP, SrcPort: 40002, DstIP: serverIP, DstPort: 80,
+		ConnectionID: httpConn, Content: gnet.HTTPRequest{},
+	}))
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, layers.LinkTypeEthernet, WithFilter(f))
+	assert.NoError(t, err)
+
+	packets := make(chan gopacket.Packet, 4)
+	packets <- createPacket(clientIP, serverIP, 40001, 443, []byte{0x16}, ts)
+	packets <- createPacket(serverIP, clientIP, 443, 40001, []byte{0x16}, ts)
+	packets <- createPacket(clientIP, serverIP, 40002, 80, []byte("GET"), ts)
+	packets <- createPacket(serverIP, clientIP, 80, 40002, []byte("HTTP"), ts)
+	close(packets)
+	assert.NoError(t, w.WriteAll(packets))
+	assert.NoError(t, w.Close())
+
+	cis, _ := readAll(t, buf.Bytes())
+	assert.Len(t, cis, 2)
+
+	// Selecting the other connection by ID adds its flow.
+	f.SelectConnection(httpConn)
+	assert.True(t, f.Observe(gnet.NetTraffic{
+		SrcIP: serverIP, SrcPort: 80, DstIP: clientIP, DstPort: 40002,
+		ConnectionID: httpConn, Content: gnet.HTTPResponse{},
+	}))
+	assert.True(t, f.Matches(createPacket(clientIP, serverIP, 40002, 80, nil, ts)))
+}